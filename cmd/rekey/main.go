@@ -0,0 +1,195 @@
+// Command rekey re-encrypts stored snippet content with the primary content
+// key. Run it after adding a new key to the front of -content-key (to rotate
+// keys), or after setting -content-key for the first time (to encrypt
+// existing plain text content). The hashes which copies of snippets are found
+// by are keyed with the primary key too, so it makes those again as well,
+// along with any made before they were keyed or left out altogether.
+//
+// Usage:
+//
+//	go run ./cmd/rekey -generate-key
+//	go run ./cmd/rekey -dsn="web:pass@/snippetbox?parseTime=true" -content-key="NEWKEY,OLDKEY"
+//
+// Rows are processed in batches, and each row is only updated if its content
+// hasn't changed since it was read, so it's safe to run while the web
+// application is serving requests. Once it reports that nothing is left to
+// re-encrypt, old keys can be removed from -content-key.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"snippetbox.floccinau.net/internal/crypto"
+	"snippetbox.floccinau.net/internal/models"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// table is a table with an encrypted content column. If hashed is set, it
+// also has a content_hash column, which is keyed with the same keys.
+type table struct {
+	name   string
+	hashed bool
+}
+
+// tables lists the tables with encrypted content columns.
+var tables = []table{
+	{name: "snippets", hashed: true},
+	{name: "snippet_revisions"},
+}
+
+func main() {
+	dsn := flag.String("dsn", "web:pass@/snippetbox?parseTime=true", "MySQL data source name")
+	contentKey := flag.String("content-key", os.Getenv("SNIPPETBOX_CONTENT_KEY"), "Base64 keys for encrypting snippet content (comma-separated, newest first)")
+	batchSize := flag.Int("batch", 100, "Number of rows to read at a time")
+	dryRun := flag.Bool("dry-run", false, "Count the rows which need re-encrypting without changing them")
+	generate := flag.Bool("generate-key", false, "Print a new random content key and exit")
+	flag.Parse()
+
+	if *generate {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(key)
+		return
+	}
+
+	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime)
+
+	keys, err := crypto.ParseKeyring(*contentKey)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	if !keys.Enabled() {
+		errorLog.Fatal("no -content-key given")
+	}
+
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	defer db.Close()
+
+	if err = db.Ping(); err != nil {
+		errorLog.Fatal(err)
+	}
+
+	for _, t := range tables {
+		n, err := rekeyTable(db, keys, t, *batchSize, *dryRun)
+		if err != nil {
+			errorLog.Fatalf("%s: %v", t.name, err)
+		}
+
+		if *dryRun {
+			infoLog.Printf("%s: %d rows need re-encrypting", t.name, n)
+		} else {
+			infoLog.Printf("%s: re-encrypted %d rows", t.name, n)
+		}
+	}
+}
+
+// rekeyTable re-encrypts the content column of every row in the table which
+// isn't encrypted with the primary key, and makes the content hash again
+// where it wasn't made with the primary key either. It returns how many rows
+// it changed (or would have changed, for a dry run).
+func rekeyTable(db *sql.DB, keys *crypto.Keyring, t table, batchSize int, dryRun bool) (int, error) {
+	// The table name comes from our own list, never from user input, so it's
+	// safe to put it in the query.
+	selectStmt := "SELECT id, content, NULL FROM " + t.name + " WHERE id > ? ORDER BY id LIMIT ?"
+	updateStmt := "UPDATE " + t.name + " SET content = ? WHERE id = ? AND content = ?"
+	if t.hashed {
+		selectStmt = "SELECT id, content, content_hash FROM " + t.name + " WHERE id > ? ORDER BY id LIMIT ?"
+		updateStmt = "UPDATE " + t.name + " SET content = ?, content_hash = ? WHERE id = ? AND content = ?"
+	}
+
+	type row struct {
+		id      int
+		content string
+		hash    sql.NullString
+	}
+
+	changed, lastID := 0, 0
+
+	for {
+		rows, err := db.Query(selectStmt, lastID, batchSize)
+		if err != nil {
+			return changed, err
+		}
+
+		var batch []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.content, &r.hash); err != nil {
+				rows.Close()
+				return changed, err
+			}
+			batch = append(batch, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return changed, err
+		}
+
+		if len(batch) == 0 {
+			return changed, nil
+		}
+
+		for _, r := range batch {
+			lastID = r.id
+
+			reencrypt := keys.NeedsRekey(r.content)
+			if !reencrypt && !t.hashed {
+				continue
+			}
+
+			plaintext, err := keys.Decrypt(r.content)
+			if err != nil {
+				return changed, err
+			}
+
+			// The hash is out of date whenever the content was encrypted
+			// with an old key, but also for content from before the hashes
+			// were keyed, so it's checked on every row.
+			var hash string
+			if t.hashed {
+				hash = models.ContentHash(keys, plaintext)
+				if !reencrypt && r.hash.String == hash {
+					continue
+				}
+			}
+			if dryRun {
+				changed++
+				continue
+			}
+
+			encrypted := r.content
+			if reencrypt {
+				encrypted, err = keys.Encrypt(plaintext)
+				if err != nil {
+					return changed, err
+				}
+			}
+
+			// If the row was edited since we read it, the update matches
+			// nothing. That's fine: the edit will have been encrypted, and
+			// hashed, with the primary key anyway.
+			args := []any{encrypted, r.id, r.content}
+			if t.hashed {
+				args = []any{encrypted, hash, r.id, r.content}
+			}
+			result, err := db.Exec(updateStmt, args...)
+			if err != nil {
+				return changed, err
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				changed++
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+)
+
+var firstNames = []string{
+	"Ada", "Alan", "Barbara", "Brian", "Carol", "Dennis", "Edsger", "Frances",
+	"Grace", "Guido", "Hedy", "Ivan", "Joan", "Ken", "Linus", "Margaret",
+	"Niklaus", "Ola", "Radia", "Rob", "Shafi", "Tim", "Ursula", "Whitfield",
+}
+
+var lastNames = []string{
+	"Allen", "Backus", "Cerf", "Dijkstra", "Engelbart", "Floyd", "Goldberg",
+	"Hamilton", "Hopper", "Kernighan", "Knuth", "Lamport", "Liskov", "Lovelace",
+	"McCarthy", "Perlman", "Pike", "Ritchie", "Sammet", "Thompson", "Turing",
+	"Wirth",
+}
+
+var bios = []string{
+	"Backend developer. Mostly Go, sometimes SQL I'm not proud of.",
+	"I collect one-liners.",
+	"Ops by day, tinkerer by night.",
+	"Learning something new every week and writing it down here.",
+	"Compilers, databases and bad puns.",
+	"",
+}
+
+var timeZones = []string{"", "Europe/London", "Europe/Madrid", "America/New_York", "America/Los_Angeles", "Asia/Tokyo", "Australia/Sydney"}
+
+// sample is a piece of code which snippets are made from, with the tags it
+// might be given.
+type sample struct {
+	language string
+	title    string
+	content  string
+	tags     []string
+}
+
+var samples = []sample{
+	{"go", "Read a file line by line", `f, err := os.Open(path)
+if err != nil {
+	return err
+}
+defer f.Close()
+
+scanner := bufio.NewScanner(f)
+for scanner.Scan() {
+	fmt.Println(scanner.Text())
+}
+return scanner.Err()`, []string{"files", "io", "stdlib"}},
+	{"go", "Graceful HTTP server shutdown", `go func() {
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+}()
+
+if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+	log.Fatal(err)
+}`, []string{"http", "servers", "context"}},
+	{"python", "Count words in a file", `from collections import Counter
+
+with open("book.txt") as f:
+    words = Counter(f.read().lower().split())
+
+for word, n in words.most_common(10):
+    print(f"{word:>12} {n}")`, []string{"files", "collections", "text"}},
+	{"python", "Retry with exponential backoff", `import random, time
+
+def retry(fn, attempts=5, base=0.5):
+    for i in range(attempts):
+        try:
+            return fn()
+        except Exception:
+            if i == attempts - 1:
+                raise
+            time.sleep(base * 2 ** i + random.random() / 10)`, []string{"errors", "networking"}},
+	{"sql", "Top posters this month", `SELECT u.name, COUNT(*) AS posts
+FROM snippets s
+JOIN users u ON u.id = s.user_id
+WHERE s.created >= DATE_FORMAT(NOW(), '%Y-%m-01')
+GROUP BY u.id
+ORDER BY posts DESC
+LIMIT 10;`, []string{"mysql", "reporting"}},
+	{"sql", "Delete duplicate rows", `DELETE t1 FROM contacts t1
+INNER JOIN contacts t2
+WHERE t1.id > t2.id AND t1.email = t2.email;`, []string{"mysql", "cleanup"}},
+	{"bash", "Find the biggest files", `du -ah . 2>/dev/null | sort -rh | head -n 20`, []string{"shell", "files", "disk"}},
+	{"bash", "Wait for a port to open", `until nc -z localhost 5432; do
+  echo "waiting for postgres..."
+  sleep 1
+done`, []string{"shell", "docker", "networking"}},
+	{"javascript", "Debounce a function", `function debounce(fn, ms) {
+  let timer;
+  return (...args) => {
+    clearTimeout(timer);
+    timer = setTimeout(() => fn(...args), ms);
+  };
+}`, []string{"frontend", "events"}},
+	{"javascript", "Copy text to the clipboard", `async function copy(text) {
+  await navigator.clipboard.writeText(text);
+  console.log("copied!");
+}`, []string{"frontend", "browser"}},
+	{"rust", "Parse command line arguments", `use std::env;
+
+fn main() {
+    let args: Vec<String> = env::args().skip(1).collect();
+    match args.as_slice() {
+        [name] => println!("Hello, {name}!"),
+        _ => eprintln!("usage: hello NAME"),
+    }
+}`, []string{"cli", "stdlib"}},
+	{"", "Haiku", `An old silent pond...
+A frog jumps into the pond,
+splash! Silence again.
+
+– Matsuo Bashō`, []string{"poetry"}},
+	{"", "Meeting notes template", `## Attendees
+
+## Decisions
+
+## Action items
+- [ ] `, []string{"notes", "templates"}},
+}
+
+var titleSuffixes = []string{"", "", "", " (again)", " in one line", ", the short way", " for beginners", " without dependencies"}
+
+var comments = []string{
+	"Nice, thanks for sharing!",
+	"This saved me an hour today.",
+	"You can drop the error check on the last line, it never fails.",
+	"Bookmarked.",
+	"Doesn't this break on empty input?",
+	"TIL. Is there a version of this for Windows?",
+	"Simple and clear 👍",
+	"I usually do it slightly differently, but this works too.",
+}
+
+// pick returns a random element of a slice.
+func pick[T any](rng *rand.Rand, s []T) T {
+	return s[rng.IntN(len(s))]
+}
+
+// fakeUser returns a name and a username for the nth seeded user. The
+// number keeps usernames unique, even when the tool is run more than once.
+func fakeUser(rng *rand.Rand, n int) (name, username string) {
+	first, last := pick(rng, firstNames), pick(rng, lastNames)
+	return first + " " + last, fmt.Sprintf("%s_%s%d", strings.ToLower(first), strings.ToLower(last), n)
+}
+
+// fakeSnippet returns a title, content, language and tags for a snippet.
+func fakeSnippet(rng *rand.Rand) (title, content, language string, tags []string) {
+	s := pick(rng, samples)
+
+	for _, tag := range s.tags {
+		if rng.IntN(3) > 0 {
+			tags = append(tags, tag)
+		}
+	}
+	if s.language != "" {
+		tags = append(tags, s.language)
+	}
+	slices.Sort(tags)
+
+	return s.title + pick(rng, titleSuffixes), s.content, s.language, tags
+}
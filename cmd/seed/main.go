@@ -0,0 +1,208 @@
+// Command seed fills a database with made-up users, snippets, tags, comments,
+// stars and views, for demos, load testing and local development.
+//
+// Usage:
+//
+//	go run ./cmd/seed -dsn="web:pass@/snippetbox?parseTime=true" -users=50 -snippets=1000
+//
+// Every seeded user has the same password, set with -password, and an email
+// address at example.com. Snippets are spread over the last -days days, so
+// that the archive and trending pages have something to show. The same
+// -rand-seed gives the same data, and running the tool again adds more rather
+// than replacing what's there.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"snippetbox.floccinau.net/internal/crypto"
+	"snippetbox.floccinau.net/internal/models"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func main() {
+	dsn := flag.String("dsn", "web:pass@/snippetbox?parseTime=true", "MySQL data source name")
+	contentKey := flag.String("content-key", os.Getenv("SNIPPETBOX_CONTENT_KEY"), "Base64 keys for encrypting snippet content (comma-separated, newest first)")
+	users := flag.Int("users", 20, "Number of users to create")
+	snippets := flag.Int("snippets", 200, "Number of snippets to create")
+	maxComments := flag.Int("comments", 3, "Most comments on each snippet")
+	maxStars := flag.Int("stars", 5, "Most stars on each snippet")
+	maxViews := flag.Int("views", 50, "Most views today of each snippet")
+	days := flag.Int("days", 90, "Spread snippets over this many days")
+	password := flag.String("password", "pa$$word", "Password of every seeded user")
+	seed := flag.Uint64("rand-seed", 1, "Seed for the random data")
+	flag.Parse()
+
+	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime)
+
+	if *users < 1 || *days < 1 {
+		errorLog.Fatal("-users and -days must be at least 1")
+	}
+	if *snippets < 0 || *maxComments < 0 || *maxStars < 0 || *maxViews < 0 {
+		errorLog.Fatal("-snippets, -comments, -stars and -views can't be negative")
+	}
+
+	keys, err := crypto.ParseKeyring(*contentKey)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	defer db.Close()
+
+	if err = db.Ping(); err != nil {
+		errorLog.Fatal(err)
+	}
+
+	s := &seeder{
+		db:       db,
+		rng:      rand.New(rand.NewPCG(*seed, *seed)),
+		comments: &models.CommentModel{DB: db},
+		stars:    &models.StarModel{DB: db, Keys: keys},
+		since:    time.Now().UTC().AddDate(0, 0, -*days),
+	}
+
+	s.snippets = models.NewSnippetModel(db)
+	defer s.snippets.Close()
+	s.snippets.Keys = keys
+
+	userIDs, err := s.seedUsers(*users, *password)
+	if err != nil {
+		errorLog.Fatalf("users: %v", err)
+	}
+	infoLog.Printf("created %d users with the password %q", len(userIDs), *password)
+
+	n, err := s.seedSnippets(userIDs, *snippets, *maxComments, *maxStars, *maxViews)
+	if err != nil {
+		errorLog.Fatalf("snippets: %v", err)
+	}
+	infoLog.Printf("created %d snippets", n)
+}
+
+// seeder holds what's needed to make up and store the data.
+type seeder struct {
+	db       *sql.DB
+	rng      *rand.Rand
+	snippets *models.SnippetModel
+	comments *models.CommentModel
+	stars    *models.StarModel
+	since    time.Time
+}
+
+// randomTime returns a random time between since and now.
+func (s *seeder) randomTime() time.Time {
+	span := time.Since(s.since)
+	return s.since.Add(time.Duration(s.rng.Int64N(int64(span)))).Truncate(time.Second)
+}
+
+// seedUsers creates n users and returns their IDs. The users are inserted
+// directly rather than with UserModel.Insert, so that the password is only
+// hashed once; bcrypt is deliberately slow.
+func (s *seeder) seedUsers(n int, password string) ([]int, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	// Number the users after the ones already there, so that their usernames
+	// and email addresses don't clash with an earlier run's.
+	var first int
+	err = s.db.QueryRow("SELECT COALESCE(MAX(id), 0) + 1 FROM users").Scan(&first)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := `INSERT INTO users (name, username, email, hashed_password, created, bio, time_zone)
+	VALUES(?, ?, ?, ?, ?, ?, ?)`
+
+	ids := make([]int, 0, n)
+	for i := range n {
+		name, username := fakeUser(s.rng, first+i)
+		email := username + "@example.com"
+
+		result, err := s.db.Exec(stmt, name, username, email, string(hash), s.randomTime(), pick(s.rng, bios), pick(s.rng, timeZones))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", username, err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, int(id))
+	}
+
+	return ids, nil
+}
+
+// seedSnippets creates n snippets belonging to random users, each with up
+// to maxComments comments, maxStars stars and maxViews views from today. It
+// returns how many snippets it created.
+func (s *seeder) seedSnippets(userIDs []int, n, maxComments, maxStars, maxViews int) (int, error) {
+	views := make(map[int]int)
+
+	for i := range n {
+		title, content, language, tags := fakeSnippet(s.rng)
+		owner := pick(s.rng, userIDs)
+
+		id, err := s.snippets.Insert(context.Background(), title, content, 365, owner, 0, "", language, "", time.Time{}, tags)
+		if err != nil {
+			return i, err
+		}
+
+		// Insert always creates snippets now, so they're moved back in time
+		// afterwards, along with their first revision.
+		created := s.randomTime()
+		_, err = s.db.Exec("UPDATE snippets SET created = ?, publish_at = ? WHERE id = ?", created, created, id)
+		if err != nil {
+			return i, err
+		}
+		_, err = s.db.Exec("UPDATE snippet_revisions SET created = ? WHERE snippet_id = ?", created, id)
+		if err != nil {
+			return i, err
+		}
+
+		for range s.rng.IntN(maxComments + 1) {
+			_, err = s.comments.Insert(id, pick(s.rng, userIDs), pick(s.rng, comments))
+			if err != nil {
+				return i, err
+			}
+		}
+
+		// Toggling a star twice would take it away again, so each user only
+		// stars a snippet once.
+		starred := make(map[int]bool)
+		for range s.rng.IntN(maxStars + 1) {
+			user := pick(s.rng, userIDs)
+			if starred[user] {
+				continue
+			}
+			starred[user] = true
+
+			_, err = s.stars.Toggle(user, id)
+			if err != nil {
+				return i, err
+			}
+		}
+
+		if v := s.rng.IntN(maxViews + 1); v > 0 {
+			views[id] = v
+		}
+	}
+
+	return n, s.snippets.AddViews(views)
+}
@@ -0,0 +1,220 @@
+// Command snip creates a snippet from standard input or a file, through the
+// JSON API, and prints its URL.
+//
+// Usage:
+//
+//	cat err.log | snip
+//	snip -lang=go -expires=7 main.go
+//	snip -private -title="Deploy key" < id_ed25519.pub
+//
+// It authenticates with the token in ~/.config/snippetbox/token (or
+// $SNIPPETBOX_TOKEN), which can be got from POST /api/v1/tokens/authentication,
+// and posts to the server in $SNIPPETBOX_URL, or http://localhost:4000.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxContentSize is the most that's read from the input. Anything bigger
+// probably isn't meant to be a snippet.
+const maxContentSize = 1 << 20
+
+func main() {
+	server := flag.String("server", envOr("SNIPPETBOX_URL", "http://localhost:4000"), "Address of the Snippetbox server")
+	tokenFile := flag.String("token-file", defaultTokenFile(), "File holding the API token")
+	title := flag.String("title", "", "Title of the snippet (default: the file name, or the first line)")
+	lang := flag.String("lang", "", "Language of the snippet, like go or python")
+	expires := flag.Int("expires", 365, "Days until the snippet expires: 1, 7 or 365")
+	private := flag.Bool("private", false, "Make a burn-after-reading snippet, whose link only works once")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [file]\n\nReads standard input if no file is given.\n\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	err := run(*server, *tokenFile, *title, *lang, *expires, *private, flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "snip:", err)
+		os.Exit(1)
+	}
+}
+
+func run(server, tokenFile, title, lang string, expires int, private bool, args []string) error {
+	if len(args) > 1 {
+		return errors.New("only one file can be given")
+	}
+
+	token, err := readToken(tokenFile)
+	if err != nil {
+		return err
+	}
+
+	in, name := io.Reader(os.Stdin), ""
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in, name = f, filepath.Base(args[0])
+	}
+
+	content, err := io.ReadAll(io.LimitReader(in, maxContentSize+1))
+	if err != nil {
+		return err
+	}
+	if len(content) > maxContentSize {
+		return fmt.Errorf("the input is bigger than %d bytes", maxContentSize)
+	}
+	if !utf8.Valid(content) {
+		return errors.New("the input isn't text")
+	}
+	if len(bytes.TrimSpace(content)) == 0 {
+		return errors.New("the input is empty")
+	}
+
+	if title == "" {
+		title = defaultTitle(name, string(content))
+	}
+
+	url, err := create(server, token, map[string]any{
+		"title":    title,
+		"content":  string(content),
+		"language": lang,
+		"expires":  expires,
+		"private":  private,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(url)
+	return nil
+}
+
+// create posts a snippet to the API and returns its URL.
+func create(server, token string, input map[string]any) (string, error) {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(server, "/")+"/api/v1/snippets", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var output struct {
+		URL   string `json:"url"`
+		Error any    `json:"error"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&output)
+	if err != nil {
+		return "", fmt.Errorf("unexpected response from the server: %s", resp.Status)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return "", fmt.Errorf("the server didn't accept the token: %s", errorText(output.Error))
+	case resp.StatusCode >= 300:
+		return "", fmt.Errorf("%s: %s", resp.Status, errorText(output.Error))
+	case resp.StatusCode == http.StatusAccepted:
+		fmt.Fprintln(os.Stderr, "snip: the snippet is held for review, and can be read once a moderator approves it")
+	}
+
+	return output.URL, nil
+}
+
+// errorText formats an error from the API, which is either a message or,
+// for validation failures, a map of field names to messages.
+func errorText(e any) string {
+	switch e := e.(type) {
+	case string:
+		return e
+	case map[string]any:
+		var parts []string
+		for field, msg := range e {
+			parts = append(parts, fmt.Sprintf("%s %v", field, msg))
+		}
+		return strings.Join(parts, "; ")
+	}
+	return "unknown error"
+}
+
+// readToken reads the API token from $SNIPPETBOX_TOKEN, or else the token
+// file.
+func readToken(path string) (string, error) {
+	if token := os.Getenv("SNIPPETBOX_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("no token in %s: get one from POST /api/v1/tokens/authentication and save it there", path)
+		}
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return token, nil
+}
+
+// defaultTokenFile returns ~/.config/snippetbox/token, or the equivalent
+// on systems which keep configuration somewhere else.
+func defaultTokenFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "snippetbox", "token")
+}
+
+// defaultTitle names a snippet after its file, or else its first non-blank
+// line.
+func defaultTitle(name, content string) string {
+	title := name
+	if title == "" {
+		for line := range strings.Lines(content) {
+			if title = strings.TrimSpace(line); title != "" {
+				break
+			}
+		}
+	}
+
+	if runes := []rune(title); len(runes) > 100 {
+		title = string(runes[:99]) + "…"
+	}
+	return title
+}
+
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
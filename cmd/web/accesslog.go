@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// clfTimeFormat is the timestamp format of the Common Log Format.
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// responseRecorder remembers the status code and the size of the body of a
+// response for the access log.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (rw *responseRecorder) WriteHeader(code int) {
+	// Informational responses, like 103 Early Hints, can come before the
+	// real one.
+	if rw.status == 0 && code >= 200 {
+		rw.status = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, to flush
+// event streams.
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Hijack takes over the connection for a WebSocket. The WebSocket library
+// asks for an http.Hijacker directly rather than going through
+// http.ResponseController.
+func (rw *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err == nil && rw.status == 0 {
+		rw.status = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+// The logAccess() middleware writes a line for each request to the access
+// log, in the Combined Log Format which Apache and nginx use, so that the
+// usual log analyzers can read it. The time the request took, in
+// microseconds, is added to the end like Apache's %D, followed by the
+// client's country when there's a GeoIP database. The tokens of
+// burn-after-reading links are filtered out, since they're the keys to the
+// snippets. Nothing is logged if there's no access log.
+func (app *application) logAccess(next http.Handler) http.Handler {
+	if app.accessLog == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rw := &responseRecorder{ResponseWriter: w}
+
+		// The query string of a burn-after-reading link is dropped along
+		// with its token.
+		uri := r.RequestURI
+		if p := redactOnceToken(r.URL.Path); p != r.URL.Path {
+			uri = p
+		}
+
+		next.ServeHTTP(rw, r)
+
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+		size := "-"
+		if rw.size > 0 {
+			size = fmt.Sprint(rw.size)
+		}
+
+		line := fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %s "%s" "%s" %d`,
+			app.clientIP(r),
+			start.Format(clfTimeFormat),
+			r.Method, logEscape(uri), r.Proto,
+			rw.status, size,
+			logEscape(orDash(r.Referer())),
+			logEscape(orDash(r.UserAgent())),
+			time.Since(start).Microseconds(),
+		)
+		if app.geoIP != nil {
+			line += " " + orDash(app.clientCountry(r))
+		}
+		app.accessLog.Print(line)
+	})
+}
+
+// logEscape escapes quotes, backslashes and control characters in a field
+// of the access log the way Apache does, so that a request can't forge or
+// break up log lines.
+func logEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// orDash returns s, or "-" for an empty field like the log formats expect.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/validator"
+)
+
+// accountDeleteForm holds the account deletion form data and any
+// validation errors.
+type accountDeleteForm struct {
+	Password string
+	Confirm  bool
+	validator.Validator
+}
+
+// The accountDelete handler shows the form for deleting the current user's
+// account.
+func (app *application) accountDelete(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = accountDeleteForm{}
+	app.render(w, http.StatusOK, "account_delete.tmpl.html", data)
+}
+
+// The accountDeletePost handler deletes the current user's account and
+// everything in it, once they've confirmed it with their password, and
+// logs them out. Users who log in with single sign-on don't have a
+// password, so they tick a box instead.
+func (app *application) accountDeletePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	form := accountDeleteForm{
+		Password: r.PostForm.Get("password"),
+		Confirm:  r.PostForm.Get("confirm") == "true",
+	}
+
+	if app.oidc != nil {
+		form.Check(form.Confirm, "confirm", "Tick the box to confirm")
+	} else {
+		form.Check(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	}
+
+	renderForm := func(status int) {
+		form.Password = ""
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, status, "account_delete.tmpl.html", data)
+	}
+
+	// The password is checked under the same throttle and lockout as
+	// logging in, so that a stolen session can't be used to guess it.
+	if form.Valid() && app.oidc == nil {
+		ip := app.clientIP(r)
+
+		attempt, err := app.beginLogin(user.Email, ip)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if status := attempt.status; status.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(status.retryAfter/time.Second)))
+			form.AddError("password", status.throttledMessage())
+			renderForm(http.StatusTooManyRequests)
+			return
+		}
+
+		id, err := app.auth.Authenticate(user.Email, form.Password)
+		switch {
+		case errors.Is(err, models.ErrInvalidCredentials) || (err == nil && id != user.ID):
+			if err := app.finishLogin(attempt, user.ID, false); err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+			form.AddError("password", "Your password is incorrect")
+		case err != nil:
+			app.serverError(w, r, err)
+			return
+		default:
+			// The right password isn't a login, so it isn't kept as one.
+			if err := app.loginAttempts.Cancel(attempt.id); err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+	}
+
+	if !form.Valid() {
+		renderForm(http.StatusUnprocessableEntity)
+		return
+	}
+
+	err = app.users.Delete(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	app.clearRememberCookie(w)
+
+	// The user is gone, so the entry isn't tied to them; the detail keeps
+	// which account it was.
+	app.audit(r, 0, models.EventAccountDelete, fmt.Sprintf("user %d", user.ID))
+
+	app.sessionManager.Put(r.Context(), "flash", "Your account has been deleted.")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// exportedComment is a comment in a data export.
+type exportedComment struct {
+	ID        int       `json:"id"`
+	SnippetID int       `json:"snippet_id"`
+	Content   string    `json:"content"`
+	Created   time.Time `json:"created"`
+}
+
+// exportedCollection is a collection in a data export, with the IDs of the
+// snippets in it.
+type exportedCollection struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Public      bool      `json:"public"`
+	Created     time.Time `json:"created"`
+	SnippetIDs  []int     `json:"snippet_ids"`
+}
+
+// The accountExport handler sends the current user a ZIP archive of
+// everything stored about them: their profile, each of their snippets, and
+// their comments, stars and collections, as JSON. The archive is written
+// straight to the response as it's built, so a big account doesn't have to
+// fit in memory. Once the first file is written the status can't change, so
+// an error after that cuts the download short, and the broken archive
+// shows it failed.
+func (app *application) accountExport(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	comments, err := app.comments.ByUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	stars, err := app.stars.ByUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	collections, err := app.collections.ForUser(user.ID, true)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	exportedCollections := []exportedCollection{}
+	for _, c := range collections {
+		items, err := app.collections.Items(c.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		ec := exportedCollection{
+			ID:          c.ID,
+			Name:        c.Name,
+			Description: c.Description,
+			Public:      c.Public,
+			Created:     c.Created,
+			SnippetIDs:  snippetIDs(items),
+		}
+		exportedCollections = append(exportedCollections, ec)
+	}
+
+	exportedComments := []exportedComment{}
+	for _, c := range comments {
+		exportedComments = append(exportedComments, exportedComment{
+			ID:        c.ID,
+			SnippetID: c.SnippetID,
+			Content:   c.Content,
+			Created:   c.Created,
+		})
+	}
+
+	filename := fmt.Sprintf("snippetbox-%s-%s.zip", user.Username, time.Now().UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+
+	zw := zip.NewWriter(w)
+
+	err = writeZipJSON(zw, "profile.json", user)
+	if err == nil {
+		err = app.snippets.EachByUser(r.Context(), user.ID, func(s *models.Snippet) error {
+			return writeZipJSON(zw, fmt.Sprintf("snippets/%d.json", s.ID), s)
+		})
+	}
+	if err == nil {
+		err = writeZipJSON(zw, "comments.json", exportedComments)
+	}
+	if err == nil {
+		err = writeZipJSON(zw, "stars.json", stars)
+	}
+	if err == nil {
+		err = writeZipJSON(zw, "collections.json", exportedCollections)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		app.errorLog.Printf("exporting data of user %d: %v", user.ID, err)
+		return
+	}
+
+	app.audit(r, user.ID, models.EventAccountExport, "")
+}
+
+// writeZipJSON adds a file called name to the archive, holding v as
+// indented JSON.
+func writeZipJSON(zw *zip.Writer, name string, v any) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "\t")
+	return enc.Encode(v)
+}
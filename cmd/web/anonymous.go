@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/bits"
+	"net/http"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/session"
+)
+
+// anonymousExpiryDays lists the expiry times, in days, that anonymous
+// snippets may have. They can't be kept for a year like account holders'.
+var anonymousExpiryDays = []int{1, 7}
+
+// anonymousPosting holds the settings for creating snippets without an
+// account, which is only allowed if enabled is set. Each IP address can
+// create at most limit snippets per window, and every snippet has to come
+// with the answer to a challenge.
+type anonymousPosting struct {
+	enabled   bool
+	limit     int
+	window    time.Duration
+	challenge challenger
+}
+
+// challenge is what the create form needs to show so that the visitor can
+// answer a challenge. Kind says which sort it is; "pow" challenges are
+// solved by the browser, by finding an answer which hashes (with Nonce) to
+// a value starting with Difficulty zero bits. "turnstile" and "hcaptcha"
+// challenges are CAPTCHAs, shown by the service's Script with SiteKey.
+type challenge struct {
+	Kind       string
+	Nonce      string
+	Difficulty int
+	SiteKey    string
+	Script     string
+}
+
+// challenger is the hook that anonymous posting uses to make each snippet
+// cost its author something, be it a CAPTCHA or some CPU time. Issue
+// returns a new challenge for the form, remembering whatever it needs to
+// check the answer, and Verify checks the answer in the posted form.
+type challenger interface {
+	Issue(r *http.Request) (*challenge, error)
+	Verify(r *http.Request) error
+}
+
+// errChallengeFailed is returned by Verify when the answer is missing or
+// wrong.
+var errChallengeFailed = errors.New("challenge failed")
+
+// powChallenger sets a proof-of-work challenge: find an answer such that the
+// SHA-256 hash of "nonce:answer" starts with bits zero bits. Each extra bit
+// doubles the work; 16 bits takes a browser about a second. The nonce
+// is kept in the session and can only be used once.
+type powChallenger struct {
+	sessionManager *session.Manager
+	bits           int
+}
+
+const powNonceKey = "powNonce"
+
+func (c *powChallenger) Issue(r *http.Request) (*challenge, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	nonce := hex.EncodeToString(b)
+
+	c.sessionManager.Put(r.Context(), powNonceKey, nonce)
+
+	return &challenge{Kind: "pow", Nonce: nonce, Difficulty: c.bits}, nil
+}
+
+func (c *powChallenger) Verify(r *http.Request) error {
+	nonce := c.sessionManager.PopString(r.Context(), powNonceKey)
+	answer := r.PostForm.Get("pow")
+	if nonce == "" || answer == "" {
+		return errChallengeFailed
+	}
+
+	sum := sha256.Sum256([]byte(nonce + ":" + answer))
+	if leadingZeroBits(sum[:]) < c.bits {
+		return errChallengeFailed
+	}
+
+	return nil
+}
+
+// leadingZeroBits counts the zero bits at the start of b.
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, x := range b {
+		if x != 0 {
+			return n + bits.LeadingZeros8(x)
+		}
+		n += 8
+	}
+	return n
+}
+
+// The requireAuthenticationUnlessAnonymous() middleware is like
+// requireAuthentication(), but lets anyone through when anonymous posting is
+// enabled.
+func (app *application) requireAuthenticationUnlessAnonymous(next http.Handler) http.Handler {
+	if !app.anonymous.enabled {
+		return app.requireAuthentication(app.requirePermission(models.PermissionSnippetsWrite)(next))
+	}
+
+	// Users who are logged in still need to be allowed to write snippets.
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+		if !user.IsAnonymous() && !user.Can(models.PermissionSnippetsWrite) {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
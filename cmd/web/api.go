@@ -0,0 +1,535 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/secrets"
+	"snippetbox.floccinau.net/internal/validator"
+)
+
+// The apiCreateAuthenticationToken handler exchanges an email address and
+// password for a stateless bearer token. Only the SHA-256 hash of the token
+// is stored, so the plaintext in this response is the only copy.
+func (app *application) apiCreateAuthenticationToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// With single sign-on there are no passwords to check, so API tokens
+	// are made on the tokens page instead.
+	if app.oidc != nil {
+		app.errorResponse(w, r, http.StatusForbidden, "password logins are disabled; create an API token on the account tokens page")
+		return
+	}
+
+	var v validator.Validator
+
+	v.Check(validator.NotBlank(input.Email), "email", "must be provided")
+	v.Check(input.Password != "", "password", "must be provided")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.FieldErrors)
+		return
+	}
+
+	// The token endpoint is just another way to log in, so it shares the
+	// brute-force protection used by the HTML login form.
+	ip := app.clientIP(r)
+
+	attempt, err := app.beginLogin(input.Email, ip)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	status := attempt.status
+
+	if status.retryAfter > 0 {
+		app.audit(r, 0, models.EventLoginLocked, input.Email)
+		app.loginThrottledResponse(w, r, status)
+		return
+	}
+
+	id, err := app.auth.Authenticate(input.Email, input.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			if err := app.finishLogin(attempt, 0, false); err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			app.invalidCredentialsResponse(w, r, status.failed())
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := app.finishLogin(attempt, id, true); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.tokens.New(id, 24*time.Hour, models.ScopeAuthentication)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The apiShowCurrentUser handler returns the user that the bearer token in
+// the request resolves to.
+func (app *application) apiShowCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The apiListSnippets handler returns a page of unexpired snippets. It takes
+// the query parameters page, page_size, sort (created, -created or title),
+// the filters tag, language and user (a user ID), and fields and expand.
+// Listings sorted by creation time can be paged through with cursor instead
+// of page, passing the next_cursor from the previous page's metadata.
+func (app *application) apiListSnippets(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	var v validator.Validator
+
+	var filter models.SnippetFilter
+	filter.Tag = strings.ToLower(app.readString(qs, "tag", ""))
+	filter.Language = strings.ToLower(app.readString(qs, "language", ""))
+	filter.UserID = app.readInt(qs, "user", 0, &v)
+
+	filters := models.Filters{
+		Page:         app.readInt(qs, "page", 1, &v),
+		PageSize:     app.readInt(qs, "page_size", 20, &v),
+		Sort:         app.readString(qs, "sort", "-created"),
+		SortSafelist: []string{"created", "-created", "title"},
+	}
+
+	if qs.Has("cursor") {
+		var err error
+		filters.After, err = models.ParseCursor(qs.Get("cursor"))
+		v.Check(err == nil, "cursor", "must be a next_cursor from this listing")
+		v.Check(!qs.Has("page"), "page", "can't be used with cursor")
+	}
+
+	// A parameter which isn't a number has already been reported, and the
+	// validator keeps that first error rather than a second one for the
+	// default value.
+	models.ValidateFilters(&v, filters)
+	v.Check(filter.UserID >= 0, "user", "must be a positive integer")
+
+	p := app.readProjection(qs, snippetFields, snippetExpansions, &v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.FieldErrors)
+		return
+	}
+
+	snippets, metadata, err := app.snippets.List(r.Context(), filter, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, snippet := range snippets {
+		app.redactProtected(r, snippet)
+	}
+
+	env := envelope{"snippets": snippets, "metadata": metadata}
+	if !p.IsZero() {
+		env["snippets"], err = app.projectSnippets(r, p, snippets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The apiShowSnippet handler returns a snippet. It takes the fields and
+// expand query parameters, like apiListSnippets.
+func (app *application) apiShowSnippet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var v validator.Validator
+	p := app.readProjection(r.URL.Query(), snippetFields, snippetExpansions, &v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.FieldErrors)
+		return
+	}
+
+	snippet, err := app.snippets.GetForUser(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.snippets.LoadTags(snippet)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.redactProtected(r, snippet)
+
+	env := envelope{"snippet": snippet}
+	if !p.IsZero() {
+		projected, err := app.projectSnippets(r, p, []*models.Snippet{snippet})
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env["snippet"] = projected[0]
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// apiSnippetInput is the JSON body of a request to create a snippet.
+type apiSnippetInput struct {
+	Title    string   `json:"title"`
+	Content  string   `json:"content"`
+	Language string   `json:"language"`
+	Tags     []string `json:"tags"`
+	Expires  int      `json:"expires"`
+	Private  bool     `json:"private"`
+}
+
+// checkedSnippet is a snippet to be created through the API, after it's been
+// cleaned and validated. cleaned and scan say what was changed in it, for
+// the warnings in the response.
+type checkedSnippet struct {
+	models.NewSnippet
+	cleaned bool
+	scan    secrets.Result
+}
+
+// The checkAPISnippet helper cleans and validates a snippet to be created
+// through the API, and scans it for secrets. The returned validator holds
+// any problems found.
+func (app *application) checkAPISnippet(r *http.Request, input apiSnippetInput) (checkedSnippet, validator.Validator) {
+	s, v := app.checkNewSnippet(input)
+	if s.scan.Has(secrets.Block) {
+		app.recordSecrets(r, 0, s.scan)
+	}
+	return s, v
+}
+
+// The checkNewSnippet helper is checkAPISnippet for snippets which don't
+// come in over HTTP. A snippet which is blocked for containing secrets isn't
+// recorded, so the caller must do that.
+func (app *application) checkNewSnippet(input apiSnippetInput) (checkedSnippet, validator.Validator) {
+	var s checkedSnippet
+
+	s.Expires = input.Expires
+	if s.Expires == 0 {
+		s.Expires = 365
+	}
+
+	s.Title, s.Content, s.cleaned = cleanSnippetText(input.Title, input.Content)
+
+	var v validator.Validator
+
+	v.Check(validator.NotBlank(s.Title), "title", "must be provided")
+	v.Check(validator.MaxChars(s.Title, 100), "title", "must not be more than 100 characters long")
+	v.Check(validator.NotBlank(s.Content), "content", "must be provided")
+	v.Check(validator.MaxBytes(s.Content, app.maxSnippetSize), "content", fmt.Sprintf("must not be more than %d bytes long", app.maxSnippetSize))
+	v.Check(validator.PermittedValue(s.Expires, 1, 7, 365), "expires", "must equal 1, 7 or 365")
+
+	var ok bool
+	s.Language, ok = normalizeLanguage(input.Language)
+	v.Check(ok, "language", "must only contain letters, numbers and + # . - and be up to 32 characters long")
+	var msg string
+	s.Tags, msg = normalizeTags(input.Tags)
+	v.Check(msg == "", "tags", "must be at most 5 tags, each only containing letters, numbers and + # . - and up to 32 characters long")
+	if input.Private {
+		v.Check(len(s.Tags) == 0, "tags", "can't be given for a private snippet")
+	}
+
+	s.scan = app.scanSecrets(s.Content)
+	if s.scan.Has(secrets.Block) {
+		v.AddError("content", "must not contain a private key or access key")
+	} else {
+		s.Content = s.scan.Text
+	}
+
+	return s, v
+}
+
+// The apiCreateSnippet handler creates a snippet owned by the API user. A
+// private snippet is made burn-after-reading, as it is for /api/create, and
+// only its link is returned, since reading it through the API would use it
+// up. The response always includes the snippet's URL, for clients which
+// just want to show it.
+func (app *application) apiCreateSnippet(w http.ResponseWriter, r *http.Request) {
+	var input apiSnippetInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	checked, v := app.checkAPISnippet(r, input)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.FieldErrors)
+		return
+	}
+	scan, cleaned := checked.scan, checked.cleaned
+
+	user := app.contextGetUser(r)
+
+	if input.Private {
+		token, err := app.snippets.InsertOnce(checked.Title, checked.Content, checked.Expires, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.recordSecrets(r, 0, scan)
+
+		env := envelope{"url": app.absoluteURL(r, "/snippet/once/"+token)}
+		err = app.writeJSON(w, http.StatusCreated, withSecretsWarning(withCleanedWarning(env, cleaned), scan), nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	heldReason := app.moderate(r, checked.Title, checked.Content)
+
+	id, err := app.snippets.Insert(r.Context(), checked.Title, checked.Content, checked.Expires, user.ID, 0, "", checked.Language, heldReason, time.Time{}, checked.Tags)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.recordSecrets(r, id, scan)
+
+	path := fmt.Sprintf("/snippet/view/%d", id)
+	headers := make(http.Header)
+	headers.Set("Location", path)
+
+	// A held snippet can't be read back until a moderator approves it, so
+	// only its link is returned.
+	if heldReason != "" {
+		env := envelope{"url": app.absoluteURL(r, path)}
+		err = app.writeJSON(w, http.StatusAccepted, withSecretsWarning(withCleanedWarning(env, cleaned), scan), headers)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err == nil {
+		err = app.snippets.LoadTags(snippet)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.notifySnippet(models.EventSnippetCreated, snippet)
+	app.announceSnippet(id)
+
+	env := envelope{"snippet": snippet, "url": app.absoluteURL(r, path)}
+	err = app.writeJSON(w, http.StatusCreated, withSecretsWarning(withCleanedWarning(env, cleaned), scan), headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The apiUpdateSnippet handler applies a partial update to a snippet which
+// the user may edit. Fields left out of the JSON body keep their current
+// values; to clear the language or tags, send an empty string or list. If
+// the body includes a version, the update is only made if the snippet is
+// still at that version, so that clients don't overwrite changes they
+// haven't seen.
+func (app *application) apiUpdateSnippet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	snippet, err := app.snippets.GetForUser(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFoundResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if !app.canEdit(user, snippet) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	// Pointers tell us whether a field was in the body at all: a missing
+	// field is nil, whereas an empty one points to the zero value.
+	var input struct {
+		Title    *string   `json:"title"`
+		Content  *string   `json:"content"`
+		Language *string   `json:"language"`
+		Tags     *[]string `json:"tags"`
+		Version  *int      `json:"version"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Version != nil && *input.Version != snippet.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	title, content, language := snippet.Title, snippet.Content, snippet.Language
+	// Only the fields which were sent are cleaned, so that leaving them out
+	// never changes them.
+	var titleCleaned, contentCleaned bool
+	if input.Title != nil {
+		title, titleCleaned = validator.CleanText(*input.Title)
+	}
+	if input.Content != nil {
+		content, contentCleaned = validator.CleanText(*input.Content)
+	}
+
+	var v validator.Validator
+
+	v.Check(validator.NotBlank(title), "title", "must be provided")
+	v.Check(validator.MaxChars(title, 100), "title", "must not be more than 100 characters long")
+	v.Check(validator.NotBlank(content), "content", "must be provided")
+	v.Check(validator.MaxBytes(content, app.maxSnippetSize), "content", fmt.Sprintf("must not be more than %d bytes long", app.maxSnippetSize))
+
+	if input.Language != nil {
+		var ok bool
+		language, ok = normalizeLanguage(*input.Language)
+		v.Check(ok, "language", "must only contain letters, numbers and + # . - and be up to 32 characters long")
+	}
+	var tags []string
+	if input.Tags != nil {
+		var msg string
+		tags, msg = normalizeTags(*input.Tags)
+		v.Check(msg == "", "tags", "must be at most 5 tags, each only containing letters, numbers and + # . - and up to 32 characters long")
+	}
+
+	var scan secrets.Result
+	if input.Content != nil {
+		scan = app.scanSecrets(content)
+		if scan.Has(secrets.Block) {
+			v.AddError("content", "must not contain a private key or access key")
+			app.recordSecrets(r, snippet.ID, scan)
+		} else {
+			content = scan.Text
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.FieldErrors)
+		return
+	}
+
+	// Only record a new revision if something which revisions keep track of
+	// has changed. Passing the version we read means that a change made by
+	// someone else since then is still detected. New tags are saved in the
+	// same transaction as the revision.
+	changed := input.Tags != nil
+	if title != snippet.Title || content != snippet.Content || language != snippet.Language {
+		changed = true
+		if input.Tags != nil {
+			err = app.snippets.UpdateWithTags(r.Context(), snippet.ID, user.ID, title, content, language, snippet.Version, tags)
+		} else {
+			err = app.snippets.Update(r.Context(), snippet.ID, user.ID, title, content, language, snippet.Version)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			case errors.Is(err, models.ErrNoRecord):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	} else if input.Tags != nil {
+		err = app.snippets.SetTags(snippet.ID, tags)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	snippet, err = app.snippets.GetForUser(r.Context(), snippet.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.snippets.LoadTags(snippet)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if changed {
+		app.related.invalidate(snippet.ID)
+		app.notifySnippet(models.EventSnippetUpdated, snippet)
+		app.broadcastSnippet(snippet.ID)
+	}
+	app.recordSecrets(r, snippet.ID, scan)
+
+	env := envelope{"snippet": snippet}
+	err = app.writeJSON(w, http.StatusOK, withSecretsWarning(withCleanedWarning(env, titleCleaned || contentCleaned), scan), nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The redactProtected helper blanks the content of a passphrase-protected
+// snippet unless the API user owns it. The API has no way to enter a
+// passphrase, so everyone else only sees the title.
+func (app *application) redactProtected(r *http.Request, snippet *models.Snippet) {
+	if snippet.Protected && !app.canEdit(app.contextGetUser(r), snippet) {
+		snippet.Content = ""
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippetbox.floccinau.net/internal/errreport"
+)
+
+// The errorResponse() method is a generic helper for sending JSON-formatted
+// error messages to API clients with a given status code. We use the any type
+// for the message parameter so that we can send more than plain strings.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
+	env := envelope{"error": message}
+
+	err := app.writeJSON(w, status, env, nil)
+	if err != nil {
+		app.errorLog.Output(2, err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// The serverErrorResponse() method is the JSON counterpart of serverError: it
+// logs the detailed error and stack trace, then sends a generic 500 response.
+func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+	app.errorLog.Output(2, trace)
+	app.reportError(r, err, "error", errreport.Callers(1))
+
+	message := "the server encountered a problem and could not process your request"
+	app.errorResponse(w, r, http.StatusInternalServerError, message)
+}
+
+func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the requested resource could not be found"
+	app.errorResponse(w, r, http.StatusNotFound, message)
+}
+
+// The badRequestResponse() method sends a 400 with the error's message, or
+// a 413 if the body was too large.
+func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if limit, ok := bodyTooLarge(err); ok {
+		app.requestTooLarge(w, r, limit)
+		return
+	}
+	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+}
+
+// The failedValidationResponse() method sends a 422 with a map of the
+// problems found, keyed by the name of the field or parameter.
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, problems map[string]string) {
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, problems)
+}
+
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "unable to update the record due to an edit conflict, please try again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request, status loginStatus) {
+	message := strings.ToLower(status.failedMessage())
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The loginThrottledResponse() method sends a 429 with a Retry-After header
+// when the login throttle is refusing attempts.
+func (app *application) loginThrottledResponse(w http.ResponseWriter, r *http.Request, status loginStatus) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(status.retryAfter/time.Second)))
+
+	message := strings.ToLower(status.throttledMessage())
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+// The WWW-Authenticate header tells the client which authentication scheme
+// it should use to authenticate.
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The insufficientScopeResponse() method sends a 403 when the bearer token
+// is good but wasn't given the API scope which the request needs. The
+// WWW-Authenticate header says which one, as in RFC 6750.
+func (app *application) insufficientScopeResponse(w http.ResponseWriter, r *http.Request, scope string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+
+	message := fmt.Sprintf("this token doesn't have the %s scope", scope)
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+// The rateLimitExceededResponse() method sends a 429 when a client has used
+// up its API quota, with a Retry-After header saying when the window ends.
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, limit int, reset time.Time) {
+	retryAfter := max(int(time.Until(reset).Round(time.Second)/time.Second), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	message := fmt.Sprintf("rate limit exceeded: %d requests per window, try again in %d seconds", limit, retryAfter)
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+// The maintenanceResponse() method sends a 503 when a change is turned away
+// because the site is in maintenance mode. The Retry-After header has already
+// been set.
+func (app *application) maintenanceResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the site is in read-only maintenance mode, please try again later"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// maxBatchSize is the most snippets one batch can create or delete. The
+// whole body is limited in size too, like any other API request.
+const maxBatchSize = 100
+
+// The outcomes of each item of a batch.
+const (
+	batchCreated   = "created"
+	batchHeld      = "held"
+	batchDeleted   = "deleted"
+	batchInvalid   = "invalid"
+	batchNotFound  = "not_found"
+	batchForbidden = "forbidden"
+	// batchSkipped items were fine, but weren't done because others in the
+	// same batch weren't.
+	batchSkipped = "skipped"
+)
+
+// batchResult is the outcome of one item of a batch, at the same index in
+// the response as the item was in the request.
+type batchResult struct {
+	Index   int               `json:"index"`
+	Status  string            `json:"status"`
+	ID      int               `json:"id,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
+	Warning string            `json:"warning,omitempty"`
+}
+
+// The batchFailedResponse method sends a 422 listing what happened to each
+// item of a batch which wasn't done.
+func (app *application) batchFailedResponse(w http.ResponseWriter, r *http.Request, results []batchResult) {
+	for i := range results {
+		if results[i].Status == "" {
+			results[i].Status = batchSkipped
+		}
+	}
+
+	env := envelope{"error": "nothing was done, because some items can't be", "results": results}
+	err := app.writeJSON(w, http.StatusUnprocessableEntity, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The apiBatchCreateSnippets handler creates several snippets, owned by the
+// API user, for tools which sync a directory of files or move snippets over
+// from somewhere else. Each is checked the same way as a snippet created on
+// its own, but private snippets can't be made in a batch.
+//
+// Batches, here and in apiBatchDeleteSnippets, are all or nothing: every
+// item is checked first, and if any of them can't be done, nothing is, and
+// the response says what was wrong with each item. Otherwise they're all
+// done in one transaction.
+func (app *application) apiBatchCreateSnippets(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Snippets []apiSnippetInput `json:"snippets"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if len(input.Snippets) == 0 {
+		app.failedValidationResponse(w, r, map[string]string{"snippets": "must contain at least one snippet"})
+		return
+	}
+	if len(input.Snippets) > maxBatchSize {
+		app.failedValidationResponse(w, r, map[string]string{"snippets": fmt.Sprintf("must not contain more than %d snippets", maxBatchSize)})
+		return
+	}
+
+	results := make([]batchResult, len(input.Snippets))
+	checked := make([]checkedSnippet, len(input.Snippets))
+	failed := false
+
+	for i, item := range input.Snippets {
+		results[i].Index = i
+
+		var problems map[string]string
+		checked[i], problems = app.checkBatchSnippet(r, item)
+		if problems != nil {
+			results[i].Status = batchInvalid
+			results[i].Errors = problems
+			failed = true
+		}
+	}
+
+	if failed {
+		app.batchFailedResponse(w, r, results)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	snippets := make([]models.NewSnippet, len(checked))
+	for i := range checked {
+		checked[i].HeldReason = app.moderate(r, checked[i].Title, checked[i].Content)
+		snippets[i] = checked[i].NewSnippet
+	}
+
+	ids, err := app.snippets.InsertMany(user.ID, snippets)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for i, id := range ids {
+		app.recordSecrets(r, id, checked[i].scan)
+
+		results[i].ID = id
+		results[i].URL = app.absoluteURL(r, fmt.Sprintf("/snippet/view/%d", id))
+		results[i].Warning = checked[i].warning()
+
+		// A held snippet can't be read until a moderator approves it, so
+		// nobody is told about it yet.
+		if checked[i].HeldReason != "" {
+			results[i].Status = batchHeld
+			continue
+		}
+		results[i].Status = batchCreated
+
+		app.notifySnippetChange(models.EventSnippetCreated, id)
+		app.announceSnippet(id)
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// warning returns the warning about what was changed in the snippet, like
+// the one in the response when a single snippet is created, or "".
+func (s checkedSnippet) warning() string {
+	if notice := secretsNotice(s.scan); notice != "" {
+		return notice
+	}
+	if s.cleaned {
+		return cleanedWarning
+	}
+	return ""
+}
+
+// The checkBatchSnippet helper checks one snippet of a batch, returning the
+// problems with it, if there are any.
+func (app *application) checkBatchSnippet(r *http.Request, input apiSnippetInput) (checkedSnippet, map[string]string) {
+	s, v := app.checkAPISnippet(r, input)
+	v.Check(!input.Private, "private", "can't be used in a batch")
+
+	if !v.Valid() {
+		return s, v.FieldErrors
+	}
+	return s, nil
+}
+
+// The apiBatchDeleteSnippets handler deletes several snippets, which the
+// API user must be able to edit, in one transaction.
+func (app *application) apiBatchDeleteSnippets(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		IDs []int `json:"ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if len(input.IDs) == 0 {
+		app.failedValidationResponse(w, r, map[string]string{"ids": "must contain at least one ID"})
+		return
+	}
+	if len(input.IDs) > maxBatchSize {
+		app.failedValidationResponse(w, r, map[string]string{"ids": fmt.Sprintf("must not contain more than %d IDs", maxBatchSize)})
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	results := make([]batchResult, len(input.IDs))
+	snippets := make([]*models.Snippet, len(input.IDs))
+	seen := make(map[int]bool, len(input.IDs))
+	failed := false
+
+	for i, id := range input.IDs {
+		results[i].Index = i
+		results[i].ID = id
+
+		if seen[id] {
+			results[i].Status = batchInvalid
+			results[i].Errors = map[string]string{"id": "is listed more than once"}
+			failed = true
+			continue
+		}
+		seen[id] = true
+
+		snippet, err := app.snippets.GetForUser(r.Context(), id, user.ID)
+		if err != nil {
+			if !errors.Is(err, models.ErrNoRecord) {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			results[i].Status = batchNotFound
+			failed = true
+			continue
+		}
+		if !app.canEdit(user, snippet) {
+			results[i].Status = batchForbidden
+			failed = true
+			continue
+		}
+		snippets[i] = snippet
+	}
+
+	if failed {
+		app.batchFailedResponse(w, r, results)
+		return
+	}
+
+	err = app.snippets.DeleteMany(input.IDs)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.editConflictResponse(w, r)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	for i, snippet := range snippets {
+		results[i].Status = batchDeleted
+
+		app.related.invalidate(snippet.ID)
+		app.notifySnippet(models.EventSnippetDeleted, &models.Snippet{
+			ID:      snippet.ID,
+			Title:   snippet.Title,
+			Created: snippet.Created,
+			Expires: snippet.Expires,
+			UserID:  snippet.UserID,
+			Version: snippet.Version,
+		})
+		app.publishToViewers(snippet.ID, socketMessage{Type: "snippet.deleted"})
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/projection"
+	"snippetbox.floccinau.net/internal/validator"
+)
+
+// The related resources which can be embedded in a snippet.
+const (
+	expandUser = "user"
+	expandTags = "tags"
+)
+
+var (
+	// snippetFields are the fields of a snippet which can be selected.
+	snippetFields = projection.FieldNames(models.Snippet{})
+	// snippetExpansions are the related resources which can be embedded in
+	// a snippet.
+	snippetExpansions = []string{expandUser, expandTags}
+)
+
+// apiUser is a user embedded in another resource. It only has what anyone
+// can see on the user's profile.
+type apiUser struct {
+	ID        int    `json:"id"`
+	Username  string `json:"username"`
+	Name      string `json:"name"`
+	Bio       string `json:"bio,omitempty"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+	URL       string `json:"url"`
+}
+
+// apiTag is a tag embedded in a snippet, with how many snippets have it
+// and where to list them.
+type apiTag struct {
+	Name     string `json:"name"`
+	Snippets int    `json:"snippets"`
+	URL      string `json:"url"`
+}
+
+// The readProjection helper reads the fields and expand query parameters,
+// which the endpoints that list and get snippets take: fields, to trim each
+// snippet down to the fields a client needs, like ?fields=id,title,created,
+// and expand, to embed related resources in each snippet, like
+// ?expand=user,tags. Without either, snippets are sent as they always have
+// been. fields and expansions are the names they can list; any others are
+// recorded as errors in v.
+func (app *application) readProjection(qs url.Values, fields, expansions []string, v *validator.Validator) projection.Projection {
+	selected := projection.ParseList(qs.Get("fields"))
+	if name := projection.Unknown(selected, fields); name != "" {
+		v.AddError("fields", fmt.Sprintf("must only list fields of the resource, and %q isn't one", name))
+	}
+
+	expand := projection.ParseList(qs.Get("expand"))
+	if name := projection.Unknown(expand, expansions); name != "" {
+		v.AddError("expand", fmt.Sprintf("must only list %s, and %q isn't one", strings.Join(expansions, " or "), name))
+	}
+
+	return projection.New(selected, expand)
+}
+
+// The projectSnippets helper applies a projection to snippets. The related
+// resources it expands are loaded for all the snippets at once, so a page
+// of snippets takes one query for each kind of resource.
+func (app *application) projectSnippets(r *http.Request, p projection.Projection, snippets []*models.Snippet) ([]map[string]any, error) {
+	var users map[int]*models.User
+	if p.Expands(expandUser) {
+		var ids []int
+		for _, s := range snippets {
+			if s.UserID != 0 && !slices.Contains(ids, s.UserID) {
+				ids = append(ids, s.UserID)
+			}
+		}
+
+		var err error
+		users, err = app.users.GetMany(ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var tagCounts map[string]int
+	if p.Expands(expandTags) {
+		var tags []string
+		for _, s := range snippets {
+			for _, tag := range s.Tags {
+				if !slices.Contains(tags, tag) {
+					tags = append(tags, tag)
+				}
+			}
+		}
+
+		var err error
+		tagCounts, err = app.snippets.CountTags(tags)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	projected := make([]map[string]any, len(snippets))
+	for i, s := range snippets {
+		embeds := make(map[string]any)
+
+		// Anonymous snippets, and those whose owner has just been deleted,
+		// have a null user.
+		if p.Expands(expandUser) {
+			var user *apiUser
+			if u, ok := users[s.UserID]; ok {
+				user = app.newAPIUser(r, u)
+			}
+			embeds[expandUser] = user
+		}
+
+		if p.Expands(expandTags) {
+			tags := make([]apiTag, len(s.Tags))
+			for j, tag := range s.Tags {
+				tags[j] = apiTag{
+					Name:     tag,
+					Snippets: tagCounts[tag],
+					URL:      app.absoluteURL(r, "/api/v1/snippets?tag="+url.QueryEscape(tag)),
+				}
+			}
+			embeds[expandTags] = tags
+		}
+
+		var err error
+		projected[i], err = p.Apply(s, embeds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return projected, nil
+}
+
+// The newAPIUser helper returns the public view of a user.
+func (app *application) newAPIUser(r *http.Request, u *models.User) *apiUser {
+	avatar := avatarURL(u, 72, app.gravatar)
+	if strings.HasPrefix(avatar, "/") {
+		avatar = app.absoluteURL(r, avatar)
+	}
+
+	return &apiUser{
+		ID:        u.ID,
+		Username:  u.Username,
+		Name:      u.ShownName(),
+		Bio:       u.Bio,
+		AvatarURL: avatar,
+		URL:       app.absoluteURL(r, "/user/"+url.PathEscape(u.Username)),
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/validator"
+)
+
+// maxAPITokens is how many unexpired tokens a user can have at once.
+const maxAPITokens = 50
+
+// apiTokenExpiryDays are the lifetimes a token can be given, in days.
+var apiTokenExpiryDays = []int{30, 90, 365}
+
+// apiTokenForm holds the form for making an API token and any validation
+// errors.
+type apiTokenForm struct {
+	Name    string
+	Scopes  []string
+	Expires int
+	validator.Validator
+}
+
+// HasScope reports whether scope is ticked in the form.
+func (f apiTokenForm) HasScope(scope string) bool {
+	return slices.Contains(f.Scopes, scope)
+}
+
+// The accountTokens handler lists the current user's API tokens, with a
+// form for making another.
+//
+// API tokens can be made on the /account/tokens page as well as by logging
+// in through the API. They're named, so that they can be told apart, and
+// limited to the API scopes ticked when they're made. The plaintext is shown
+// once, on the page after the token is made, and can't be got back after
+// that.
+func (app *application) accountTokens(w http.ResponseWriter, r *http.Request) {
+	app.renderTokens(w, r, http.StatusOK, apiTokenForm{Scopes: []string{models.APIScopeRead}, Expires: 90})
+}
+
+func (app *application) renderTokens(w http.ResponseWriter, r *http.Request, status int, form apiTokenForm) {
+	tokens, err := app.tokens.ForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.APITokens = tokens
+	data.APIScopes = models.APIScopes
+	data.APITokenExpiryDays = apiTokenExpiryDays
+	data.NewAPIToken = app.sessionManager.PopString(r.Context(), "newAPIToken")
+	data.Form = form
+
+	app.render(w, status, "tokens.tmpl.html", data)
+}
+
+func (app *application) accountTokensPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	expires, err := strconv.Atoi(r.PostForm.Get("expires"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := apiTokenForm{
+		Name:    strings.TrimSpace(r.PostForm.Get("name")),
+		Scopes:  r.PostForm["scopes"],
+		Expires: expires,
+	}
+
+	form.Check(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.Check(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.Check(len(form.Scopes) > 0, "scopes", "Choose at least one scope")
+	for _, scope := range form.Scopes {
+		form.Check(validator.PermittedValue(scope, models.APIScopes...), "scopes", "Unknown scope")
+	}
+	form.Check(validator.PermittedValue(form.Expires, apiTokenExpiryDays...), "expires", "This field must equal 30, 90 or 365")
+
+	user := app.contextGetUser(r)
+
+	if form.Valid() {
+		tokens, err := app.tokens.ForUser(user.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		if len(tokens) >= maxAPITokens {
+			form.AddNonFieldError("You have too many API tokens. Revoke some you no longer use first.")
+		}
+	}
+
+	if !form.Valid() {
+		app.renderTokens(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	// Keep the scopes in their usual order, whatever order they came in.
+	var scopes []string
+	for _, scope := range models.APIScopes {
+		if form.HasScope(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	token, err := app.tokens.NewNamed(user.ID, form.Name, scopes, time.Duration(form.Expires)*24*time.Hour)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, user.ID, models.EventTokenCreate, strconv.Itoa(token.ID))
+
+	app.sessionManager.Put(r.Context(), "newAPIToken", token.Plaintext)
+	app.sessionManager.Put(r.Context(), "flash", "API token created!")
+
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
+
+func (app *application) accountTokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	// Other users' tokens are reported as not found.
+	err = app.tokens.Revoke(id, user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, user.ID, models.EventTokenRevoke, strconv.Itoa(id))
+
+	app.sessionManager.Put(r.Context(), "flash", "API token revoked.")
+
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
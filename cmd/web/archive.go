@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"snippetbox.floccinau.net/internal/i18n"
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// archivePageSize is how many snippets are listed on each page of the
+// archive pages.
+const archivePageSize = 20
+
+// The archiveMonth handler lists the snippets created in a month, like
+// /archive/2024/05, newest first, with links to the months either side.
+func (app *application) archiveMonth(w http.ResponseWriter, r *http.Request) {
+	year, err := strconv.Atoi(r.PathValue("year"))
+	if err != nil || year < 2000 || year > 9999 {
+		app.notFound(w)
+		return
+	}
+
+	month, err := strconv.Atoi(r.PathValue("month"))
+	if err != nil || month < 1 || month > 12 || len(r.PathValue("month")) != 2 {
+		app.notFound(w)
+		return
+	}
+
+	start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	if start.After(time.Now()) {
+		app.notFound(w)
+		return
+	}
+
+	page, err := app.snippets.ByMonth(r.Context(), year, time.Month(month), app.keysetParam(r, archivePageSize))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.ArchiveTitle = i18n.Translate(data.Locale, "Snippets from %s %d", i18n.Translate(data.Locale, start.Format("Jan")), year)
+	data.ArchivePrev = archiveMonthPath(start.AddDate(0, -1, 0))
+	if next := start.AddDate(0, 1, 0); !next.After(time.Now()) {
+		data.ArchiveNext = archiveMonthPath(next)
+	}
+
+	app.renderArchive(w, r, data, page)
+}
+
+// archiveMonthPath returns the path of the archive page for t's month.
+func archiveMonthPath(t time.Time) string {
+	return fmt.Sprintf("/archive/%04d/%02d", t.Year(), t.Month())
+}
+
+// The languageSnippets handler lists the snippets in a language, like
+// /language/go, newest first.
+func (app *application) languageSnippets(w http.ResponseWriter, r *http.Request) {
+	language, ok := normalizeLanguage(r.PathValue("language"))
+	if !ok || language == "" {
+		app.notFound(w)
+		return
+	}
+
+	// Language names are lower case, so other spellings are sent to the
+	// canonical page.
+	if language != r.PathValue("language") {
+		http.Redirect(w, r, "/language/"+language, http.StatusMovedPermanently)
+		return
+	}
+
+	page, err := app.snippets.ByLanguage(r.Context(), language, app.keysetParam(r, archivePageSize))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.ArchiveTitle = i18n.Translate(data.Locale, "Snippets in %s", language)
+
+	app.renderArchive(w, r, data, page)
+}
+
+// The renderArchive helper renders a page of an archive listing, with the
+// snippets' star counts. The archives are paged through with cursors, so
+// that the old snippets at the end of a long listing are as quick to reach
+// as the new ones.
+func (app *application) renderArchive(w http.ResponseWriter, r *http.Request, data *templateData, page models.CursorPage) {
+	starCounts, err := app.stars.Counts(snippetIDs(page.Snippets))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.Snippets = page.Snippets
+	data.StarCounts = starCounts
+	data.SnippetCursors = newCursorInfo(page)
+
+	app.render(w, http.StatusOK, "archive.tmpl.html", data)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// immutableCacheControl is sent with fingerprinted files.
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// assetManifest maps the names of static files to their fingerprinted
+// names, and back.
+//
+// Static files are fingerprinted: when the server starts, each file under
+// ui/static gets a second name with a hash of its content in it, like
+// css/main.3f2a9c1b0d4e.css. Pages link to that name, through the asset
+// template function, and it's served with a Cache-Control header telling
+// browsers and proxies to keep it for a year without checking back. When a
+// file changes, so does its name, so visitors never see a stale copy. The
+// plain names still work, but have to be revalidated every time.
+type assetManifest struct {
+	hashed  map[string]string
+	logical map[string]string
+}
+
+// staticAssets is the manifest for ui/static, which the asset template
+// function uses. It's loaded at startup; in development mode it's left
+// empty, since the files are expected to change, and pages link to them by
+// their plain names.
+var staticAssets = &assetManifest{}
+
+// loadAssetManifest hashes every file under dir.
+func loadAssetManifest(dir string) (*assetManifest, error) {
+	m := &assetManifest{
+		hashed:  make(map[string]string),
+		logical: make(map[string]string),
+	}
+
+	fsys := os.DirFS(dir)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(b)
+
+		ext := path.Ext(name)
+		hashed := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:6]) + ext
+
+		m.hashed[name] = hashed
+		m.logical[hashed] = name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// url returns the path to link to a static file at, like
+// /static/css/main.3f2a9c1b0d4e.css for "css/main.css". A name which isn't
+// in the manifest is an error, so that a typo shows up straight away,
+// unless the manifest is empty, as it is in development mode.
+func (m *assetManifest) url(name string) (string, error) {
+	name = strings.TrimPrefix(name, "/")
+
+	if len(m.hashed) == 0 {
+		return "/static/" + name, nil
+	}
+
+	hashed, ok := m.hashed[name]
+	if !ok {
+		return "", fmt.Errorf("asset: no static file called %q", name)
+	}
+	return "/static/" + hashed, nil
+}
+
+// asset is the template function which resolves the name of a static file
+// to its fingerprinted URL, like {{asset "css/main.css"}}.
+func asset(name string) (string, error) {
+	return staticAssets.url(name)
+}
+
+// The staticFiles handler serves the files under ui/static, by either their
+// plain or their fingerprinted names. Fingerprinted files can be cached for
+// good; for the others browsers have to check for a newer version, which
+// costs little since the file server answers with 304 Not Modified when
+// there isn't one.
+func (app *application) staticFiles() http.Handler {
+	fileServer := http.FileServer(http.Dir("./ui/static/"))
+
+	return http.StripPrefix("/static", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name, ok := staticAssets.logical[strings.TrimPrefix(r.URL.Path, "/")]; ok {
+			w.Header().Set("Cache-Control", immutableCacheControl)
+
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = "/" + name
+			r2.URL.RawPath = ""
+			fileServer.ServeHTTP(w, r2)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-cache")
+		fileServer.ServeHTTP(w, r)
+	}))
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/storage"
+)
+
+// maxAttachments is the most files which can be attached to one snippet.
+const maxAttachments = 10
+
+// attachmentURLLifetime is how long a signed download link stays valid.
+const attachmentURLLifetime = time.Hour
+
+// allowedAttachmentTypes lists the content types which may be uploaded, keyed
+// by the type that http.DetectContentType sniffs from the file (never the
+// type the browser claims). Images are shown inline; everything else is
+// downloaded.
+var allowedAttachmentTypes = map[string]bool{
+	"image/png":                 true,
+	"image/jpeg":                true,
+	"image/gif":                 true,
+	"image/webp":                true,
+	"text/plain; charset=utf-8": true,
+	"application/pdf":           true,
+	"application/x-gzip":        true,
+	"application/zip":           true,
+}
+
+// attachmentLink is an attachment together with a signed URL to download it
+// and, for images, signed URLs for its thumbnail at 1x and 2x.
+type attachmentLink struct {
+	*models.Attachment
+	URL       string
+	ThumbURL  string
+	Thumb2URL string
+}
+
+// IsImage reports whether the attachment can be shown in an <img> tag.
+func (a attachmentLink) IsImage() bool {
+	return strings.HasPrefix(a.ContentType, "image/")
+}
+
+// Pending reports whether the attachment is still waiting for its virus
+// scan.
+func (a attachmentLink) Pending() bool {
+	return a.ScanStatus == models.ScanPending
+}
+
+// Quarantined reports whether the virus scanner found something in the
+// attachment.
+func (a attachmentLink) Quarantined() bool {
+	return a.ScanStatus == models.ScanQuarantined
+}
+
+// signAttachment returns the signature for downloading an attachment until
+// the given expiry time.
+func (app *application) signAttachment(id int, expires int64) string {
+	mac := hmac.New(sha256.New, app.downloadSecret)
+	fmt.Fprintf(mac, "attachment:%d:%d", id, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// The attachmentURL helper returns a signed, time-limited URL for downloading
+// an attachment. Anyone with the URL can download the file until it expires,
+// without needing a session, so it's only given to people who can see the
+// snippet.
+func (app *application) attachmentURL(a *models.Attachment) string {
+	expires := time.Now().Add(attachmentURLLifetime).Unix()
+
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("sig", app.signAttachment(a.ID, expires))
+
+	// The filename in the path is only there to make the link readable; the
+	// download is named from the attachment record. A file called "thumb"
+	// would clash with the thumbnail route, so it gets a different name here.
+	name := a.Filename
+	if name == "thumb" {
+		name = "thumb.download"
+	}
+
+	return fmt.Sprintf("/attachments/%d/%s?%s", a.ID, url.PathEscape(name), q.Encode())
+}
+
+// The attachmentLinks helper loads a snippet's attachments with signed URLs.
+// Attachments which haven't passed the virus scan get no URLs, since they
+// can't be downloaded.
+func (app *application) attachmentLinks(snippetID int) ([]attachmentLink, error) {
+	attachments, err := app.attachments.ListBySnippet(snippetID)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]attachmentLink, len(attachments))
+	for i, a := range attachments {
+		links[i] = attachmentLink{Attachment: a}
+		if a.ScanStatus != models.ScanClean {
+			continue
+		}
+		links[i].URL = app.attachmentURL(a)
+		if links[i].IsImage() {
+			links[i].ThumbURL = app.thumbURL(a, 96)
+			links[i].Thumb2URL = app.thumbURL(a, 192)
+		}
+	}
+	return links, nil
+}
+
+// cleanFilename makes an uploaded file's name safe to store and show: no
+// directories, no control characters, and not too long.
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+
+	if name == "" || name == "." || name == "/" {
+		name = "attachment"
+	}
+
+	if runes := []rune(name); len(runes) > 100 {
+		ext := filepath.Ext(name)
+		name = string(runes[:100-len([]rune(ext))]) + ext
+	}
+
+	return name
+}
+
+// The snippetAttachPost handler uploads a file and attaches it to a snippet.
+// Only people who can edit the snippet can attach files. Problems with the
+// file are reported with a flash message on the snippet's page.
+func (app *application) snippetAttachPost(w http.ResponseWriter, r *http.Request) {
+	snippet := app.editableSnippet(w, r)
+	if snippet == nil {
+		return
+	}
+
+	viewURL := fmt.Sprintf("/snippet/view/%d#attachments", snippet.ID)
+	fail := func(msg string) {
+		app.sessionManager.Put(r.Context(), "flash", msg)
+		http.Redirect(w, r, viewURL, http.StatusSeeOther)
+	}
+
+	count, err := app.attachments.Count(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if count >= maxAttachments {
+		fail(fmt.Sprintf("A snippet can't have more than %d attachments.", maxAttachments))
+		return
+	}
+
+	err = r.ParseMultipartForm(app.maxUploadSize)
+	if limit, ok := bodyTooLarge(err); ok {
+		app.requestTooLarge(w, r, limit)
+		return
+	} else if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		fail("Please choose a file to attach.")
+		return
+	}
+	defer file.Close()
+
+	if header.Size > app.maxUploadSize {
+		fail(fmt.Sprintf("Attachments can't be larger than %s.", humanBytes(app.maxUploadSize)))
+		return
+	}
+	if header.Size == 0 {
+		fail("That file is empty.")
+		return
+	}
+
+	// Sniff the content type from the start of the file, then rewind so the
+	// whole file gets stored.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		app.serverError(w, r, err)
+		return
+	}
+	contentType := http.DetectContentType(head[:n])
+	if !allowedAttachmentTypes[contentType] {
+		fail("Only images, text files, PDFs and zip or gzip archives can be attached.")
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	key, err := storage.NewKey()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.blobs.Put(r.Context(), key, file, header.Size, contentType)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// With a virus scanner, the file can't be downloaded until a job has
+	// scanned it.
+	status := models.ScanClean
+	if app.virusScanner != nil {
+		status = models.ScanPending
+	}
+
+	id, err := app.attachments.Insert(&models.Attachment{
+		SnippetID:   snippet.ID,
+		UserID:      app.contextGetUser(r).ID,
+		Filename:    cleanFilename(header.Filename),
+		ContentType: contentType,
+		Size:        header.Size,
+		StorageKey:  key,
+		ScanStatus:  status,
+	})
+	if err != nil {
+		app.blobs.Delete(r.Context(), key)
+		app.serverError(w, r, err)
+		return
+	}
+
+	if status == models.ScanPending {
+		// If the scan can't be queued the file stays pending, and can be
+		// scanned again from the quarantine page.
+		err = app.jobs.Enqueue(attachmentScanJob, attachmentScanPayload{AttachmentID: id})
+		if err != nil {
+			app.errorLog.Print(err)
+		}
+
+		app.sessionManager.Put(r.Context(), "flash", "File attached! It can be downloaded once it's been checked for viruses.")
+		http.Redirect(w, r, viewURL, http.StatusSeeOther)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "File attached!")
+	http.Redirect(w, r, viewURL, http.StatusSeeOther)
+}
+
+// The signedAttachment helper checks the signature on a request for an
+// attachment and loads the attachment named by its id path value. If the
+// signature is missing, wrong or expired, or there's no such attachment, it
+// sends an error response and returns nil.
+func (app *application) signedAttachment(w http.ResponseWriter, r *http.Request) *models.Attachment {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil
+	}
+
+	qs := r.URL.Query()
+	expires, err := strconv.ParseInt(qs.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		app.clientError(w, http.StatusForbidden)
+		return nil
+	}
+	if !hmac.Equal([]byte(qs.Get("sig")), []byte(app.signAttachment(id, expires))) {
+		app.clientError(w, http.StatusForbidden)
+		return nil
+	}
+
+	a, err := app.attachments.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil
+	}
+
+	// Links made before a file was quarantined mustn't still work.
+	if a.ScanStatus != models.ScanClean {
+		app.clientError(w, http.StatusForbidden)
+		return nil
+	}
+
+	return a
+}
+
+// The attachmentDownload handler serves an attachment from a signed URL made
+// by attachmentURL. It doesn't use the session, so the links keep working
+// when opened in another browser, until they expire.
+func (app *application) attachmentDownload(w http.ResponseWriter, r *http.Request) {
+	a := app.signedAttachment(w, r)
+	if a == nil {
+		return
+	}
+
+	disposition := "attachment"
+	if strings.HasPrefix(a.ContentType, "image/") {
+		disposition = "inline"
+	}
+
+	// If the store can hand out its own short-lived download links (like
+	// presigned S3 URLs), send the browser there, so the file doesn't have to
+	// pass through us.
+	if signer, ok := app.blobs.(storage.URLSigner); ok {
+		u, err := signer.SignedURL(r.Context(), a.StorageKey, a.Filename, disposition, 5*time.Minute)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, u, http.StatusFound)
+		return
+	}
+
+	blob, err := app.blobs.Open(r.Context(), a.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	defer blob.Close()
+
+	// Uploaded files are untrusted, so they're served in a sandbox with no
+	// permission to run scripts or load anything, whatever they contain.
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+
+	io.Copy(w, blob)
+}
+
+// The attachmentDeletePost handler removes an attachment and its file.
+func (app *application) attachmentDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	a, err := app.attachments.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	snippet, err := app.snippets.GetForUser(r.Context(), a.SnippetID, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if !app.canEdit(app.contextGetUser(r), snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err = app.removeAttachment(a)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Attachment deleted.")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d#attachments", snippet.ID), http.StatusSeeOther)
+}
+
+// The removeAttachment helper deletes an attachment's record, then its file.
+func (app *application) removeAttachment(a *models.Attachment) error {
+	err := app.attachments.Delete(a.ID)
+	if err != nil {
+		return err
+	}
+
+	// The record is gone, so the blob can't be reached any more even if this
+	// fails; just log it. Deleting from remote storage can be slow, so it's
+	// done after the response has been sent.
+	app.background(func() {
+		if err := app.blobs.Delete(context.Background(), a.StorageKey); err != nil {
+			app.errorLog.Print(err)
+		}
+		app.thumbCache.remove(a.StorageKey)
+	})
+
+	return nil
+}
+
+// humanBytes formats a size in bytes like "5 MB" or "320 KB".
+func humanBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%d KB", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
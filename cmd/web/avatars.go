@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/storage"
+	"snippetbox.floccinau.net/internal/thumbnail"
+)
+
+// avatarSize is the size, in pixels, that uploaded avatars are scaled down
+// to fit. Avatars are shown at up to 72px, so this is sharp on high-density
+// screens.
+const avatarSize = 192
+
+// avatarTypes lists the sniffed content types of images which can be
+// uploaded as avatars.
+var avatarTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// avatarURL returns the URL of a user's avatar at the given size, in pixels:
+// their uploaded avatar if they have one, or else their Gravatar if gravatar
+// is set. It returns an empty string if there's neither.
+func avatarURL(u *models.User, size int, gravatar bool) string {
+	switch {
+	case u.AvatarKey != "":
+		return "/avatars/" + u.AvatarKey
+	case gravatar && u.Email != "":
+		// Gravatar looks people up by the SHA-256 hash of their trimmed,
+		// lower-case email address, so the address itself isn't sent. People
+		// without a Gravatar get a generated pattern.
+		hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(u.Email))))
+		q := url.Values{"s": {strconv.Itoa(size)}, "d": {"identicon"}}
+		return "https://www.gravatar.com/avatar/" + hex.EncodeToString(hash[:]) + "?" + q.Encode()
+	default:
+		return ""
+	}
+}
+
+// avatar is a template function which draws a user's avatar at the given
+// size, in pixels: 24, 32 or 72. Users without an avatar get the first
+// letter of their name instead. It takes the page's data first, so call it
+// as {{avatar $ .User 32}}.
+func avatar(d *templateData, u *models.User, size int) template.HTML {
+	if u == nil {
+		return ""
+	}
+
+	// The image is fetched at twice the size, for high-density screens.
+	if src := avatarURL(u, 2*size, d.Gravatar); src != "" {
+		return template.HTML(fmt.Sprintf(`<img class='avatar' src='%s' width='%d' height='%d' alt=''>`,
+			template.HTMLEscapeString(src), size, size))
+	}
+
+	// The Content Security Policy doesn't allow style attributes, so the
+	// sizes of the placeholder are set in main.css.
+	return template.HTML(fmt.Sprintf(`<span class='avatar size-%d' aria-hidden='true'>%s</span>`,
+		size, template.HTMLEscapeString(u.Initial())))
+}
+
+// The accountAvatarPost handler replaces the current user's avatar with an
+// uploaded image. The image is scaled down and re-encoded before it's
+// stored, so the original file, and any metadata in it, is never kept.
+// Problems with the image are reported with a flash message on the profile
+// form.
+func (app *application) accountAvatarPost(w http.ResponseWriter, r *http.Request) {
+	fail := func(msg string) {
+		app.sessionManager.Put(r.Context(), "flash", msg)
+		http.Redirect(w, r, "/account/profile", http.StatusSeeOther)
+	}
+
+	err := r.ParseMultipartForm(app.maxUploadSize)
+	if limit, ok := bodyTooLarge(err); ok {
+		app.requestTooLarge(w, r, limit)
+		return
+	} else if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("avatar")
+	if err != nil {
+		fail("Please choose an image to upload.")
+		return
+	}
+	defer file.Close()
+
+	if header.Size > app.maxUploadSize {
+		fail(fmt.Sprintf("Avatars can't be larger than %s.", humanBytes(app.maxUploadSize)))
+		return
+	}
+
+	src, err := io.ReadAll(io.LimitReader(file, app.maxUploadSize))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	contentType := http.DetectContentType(src)
+	if !avatarTypes[contentType] {
+		fail("Avatars must be PNG, JPEG, GIF or WebP images.")
+		return
+	}
+
+	// Photos are kept as JPEG, and anything which may be transparent as PNG.
+	format := thumbnail.PNG
+	if contentType == thumbnail.JPEG {
+		format = thumbnail.JPEG
+	}
+
+	// Decoding is expensive, so avatars share the thumbnail generator's
+	// limit on how many images are decoded at once.
+	select {
+	case app.thumbCache.slots <- struct{}{}:
+	case <-r.Context().Done():
+		return
+	}
+	var img bytes.Buffer
+	err = thumbnail.Make(&img, src, avatarSize, format)
+	<-app.thumbCache.slots
+
+	if err != nil {
+		switch {
+		case errors.Is(err, thumbnail.ErrTooLarge):
+			fail("That image is too large.")
+		case errors.Is(err, thumbnail.ErrUnsupported):
+			fail("That image couldn't be read.")
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	key, err := storage.NewKey()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.blobs.Put(r.Context(), key, &img, int64(img.Len()), format)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	old, err := app.users.SetAvatar(user.ID, key)
+	if err != nil {
+		app.blobs.Delete(r.Context(), key)
+		app.serverError(w, r, err)
+		return
+	}
+	app.deleteAvatarBlob(r, old)
+
+	app.sessionManager.Put(r.Context(), "flash", "Avatar updated!")
+	http.Redirect(w, r, "/user/"+user.Username, http.StatusSeeOther)
+}
+
+// The accountAvatarDeletePost handler removes the current user's uploaded
+// avatar, so they're shown with their Gravatar or initial again.
+func (app *application) accountAvatarDeletePost(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	old, err := app.users.SetAvatar(user.ID, "")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.deleteAvatarBlob(r, old)
+
+	app.sessionManager.Put(r.Context(), "flash", "Avatar removed.")
+	http.Redirect(w, r, "/account/profile", http.StatusSeeOther)
+}
+
+// The deleteAvatarBlob helper deletes a replaced avatar's blob. Failures are
+// only logged: the blob is an orphan now, so the blob collector will delete
+// it later anyway.
+func (app *application) deleteAvatarBlob(r *http.Request, key string) {
+	if key == "" {
+		return
+	}
+
+	if err := app.blobs.Delete(r.Context(), key); err != nil {
+		app.errorLog.Printf("deleting avatar %s: %v", key, err)
+	}
+}
+
+// The avatarImage handler serves an uploaded avatar. Avatars are public, but
+// only blobs which really are avatars are served, so that attachments can't
+// be fetched by their storage key. A new avatar always gets a new key, so the
+// image at a URL never changes and browsers can cache it for good.
+func (app *application) avatarImage(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+
+	ok, err := app.users.HasAvatar(key)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if !ok {
+		app.notFound(w)
+		return
+	}
+
+	blob, err := app.blobs.Open(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	defer blob.Close()
+
+	img, err := io.ReadAll(blob)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("Content-Type", http.DetectContentType(img))
+	w.Header().Set("Content-Length", strconv.Itoa(len(img)))
+	w.Header().Set("Cache-Control", immutableCacheControl)
+
+	w.Write(img)
+}
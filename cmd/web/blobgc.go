@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Blobs which are younger than orphanGracePeriod are never collected, because
+// they may belong to an upload whose attachment record hasn't been written
+// yet.
+const orphanGracePeriod = time.Hour
+
+// orphanBatchSize is how many keys are checked against the database at once.
+const orphanBatchSize = 100
+
+// The collectOrphanedBlobs method deletes blobs which no attachment or avatar
+// refers to every interval, until the application shuts down. These are left
+// behind when a snippet is deleted (and its attachments with it, by the
+// foreign key), when an avatar is replaced or when an upload fails after the
+// blob was stored. A pass
+// which has started when the application shuts down is finished first.
+func (app *application) collectOrphanedBlobs(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Tables may be half-migrated in maintenance mode, so blobs could
+		// look orphaned when they aren't.
+		if !app.maintenance.Load() {
+			n, err := app.deleteOrphanedBlobs(context.Background())
+			if err != nil {
+				app.errorLog.Printf("collecting orphaned attachments: %v", err)
+			} else if n > 0 {
+				app.infoLog.Printf("Deleted %d orphaned attachment files", n)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-app.shutdown:
+			return
+		}
+	}
+}
+
+// The deleteOrphanedBlobs method makes one pass over the blob store and
+// returns how many blobs it deleted.
+func (app *application) deleteOrphanedBlobs(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-orphanGracePeriod)
+	deleted := 0
+
+	var batch []string
+	flush := func() error {
+		known, err := app.attachments.KnownKeys(batch)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range batch {
+			if known[key] {
+				continue
+			}
+			if err := app.blobs.Delete(ctx, key); err != nil {
+				return err
+			}
+			app.thumbCache.remove(key)
+			deleted++
+		}
+
+		batch = batch[:0]
+		return nil
+	}
+
+	err := app.blobs.Walk(ctx, func(key string, modified time.Time) error {
+		if modified.After(cutoff) {
+			return nil
+		}
+
+		batch = append(batch, key)
+		if len(batch) == orphanBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return deleted, err
+	}
+
+	if len(batch) > 0 {
+		err = flush()
+	}
+	return deleted, err
+}
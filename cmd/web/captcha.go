@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"snippetbox.floccinau.net/internal/session"
+)
+
+// captchaTimeout is how long the CAPTCHA service gets to check an answer.
+const captchaTimeout = 10 * time.Second
+
+// captchaVerifier is a CAPTCHA service, Cloudflare Turnstile or hCaptcha,
+// which the signup and anonymous create forms use when the visitor looks
+// like a bot. Most people never see one: it's only shown to addresses which
+// have loaded the form several times in the last hour, or to clients which
+// don't send the headers every browser does.
+//
+// The widget it shows in the form puts its answer in the Field form field,
+// and Verify asks the service whether the answer is right.
+type captchaVerifier interface {
+	// Widget returns the challenge which shows the widget in a form.
+	Widget() *challenge
+	// Origins lists the origins which the widget loads frames, styles
+	// and data from, for the Content Security Policy.
+	Origins() string
+	Field() string
+	Verify(ctx context.Context, response, remoteIP string) (bool, error)
+}
+
+// siteverifyCaptcha is a CAPTCHA service with a "siteverify" endpoint,
+// which takes the secret key, the answer and the visitor's IP address, and
+// says whether the answer is right. Turnstile and hCaptcha both work this
+// way.
+type siteverifyCaptcha struct {
+	kind      string
+	siteKey   string
+	secret    string
+	scriptURL string
+	verifyURL string
+	field     string
+	origins   string
+	client    *http.Client
+}
+
+// newCaptcha returns the CAPTCHA service named by the -captcha flag.
+func newCaptcha(kind, siteKey, secret string) (captchaVerifier, error) {
+	c := &siteverifyCaptcha{
+		kind:    kind,
+		siteKey: siteKey,
+		secret:  secret,
+		client:  &http.Client{Timeout: captchaTimeout},
+	}
+
+	switch kind {
+	case "turnstile":
+		c.scriptURL = "https://challenges.cloudflare.com/turnstile/v0/api.js"
+		c.verifyURL = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+		c.field = "cf-turnstile-response"
+		c.origins = "https://challenges.cloudflare.com"
+	case "hcaptcha":
+		c.scriptURL = "https://js.hcaptcha.com/1/api.js"
+		c.verifyURL = "https://api.hcaptcha.com/siteverify"
+		c.field = "h-captcha-response"
+		c.origins = "https://hcaptcha.com https://*.hcaptcha.com"
+	default:
+		return nil, fmt.Errorf("unknown -captcha %q: must be turnstile or hcaptcha", kind)
+	}
+
+	if siteKey == "" || secret == "" {
+		return nil, fmt.Errorf("-captcha=%s needs -captcha-site-key and -captcha-secret", kind)
+	}
+
+	return c, nil
+}
+
+func (c *siteverifyCaptcha) Widget() *challenge {
+	return &challenge{Kind: c.kind, SiteKey: c.siteKey, Script: c.scriptURL}
+}
+
+func (c *siteverifyCaptcha) Origins() string {
+	return c.origins
+}
+
+func (c *siteverifyCaptcha) Field() string {
+	return c.field
+}
+
+func (c *siteverifyCaptcha) Verify(ctx context.Context, response, remoteIP string) (bool, error) {
+	if response == "" {
+		return false, nil
+	}
+
+	form := url.Values{
+		"secret":   {c.secret},
+		"response": {response},
+		"remoteip": {remoteIP},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s siteverify: %s", c.kind, resp.Status)
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return false, err
+	}
+
+	return result.Success, nil
+}
+
+// errCaptchaFailed is returned by captchaChallenger's Verify when the
+// CAPTCHA wasn't answered, or was answered wrongly.
+var errCaptchaFailed = fmt.Errorf("captcha %w", errChallengeFailed)
+
+// captchaChallenger is a challenger which sets a CAPTCHA when risky says
+// the request looks like a bot, and the fallback challenge, if there is
+// one, otherwise. Whether a CAPTCHA was set is kept in the session under
+// key, so that the answer is checked against the same challenge. Someone
+// who posts the form without ever having loaded it has to answer a
+// CAPTCHA.
+type captchaChallenger struct {
+	sessionManager *session.Manager
+	key            string
+	captcha        captchaVerifier
+	fallback       challenger
+	risky          func(r *http.Request) bool
+	clientIP       func(r *http.Request) string
+}
+
+func (c *captchaChallenger) Issue(r *http.Request) (*challenge, error) {
+	if c.captcha != nil {
+		risky := c.risky(r)
+		c.sessionManager.Put(r.Context(), c.key, risky)
+		if risky {
+			return c.captcha.Widget(), nil
+		}
+	}
+
+	if c.fallback == nil {
+		return nil, nil
+	}
+	return c.fallback.Issue(r)
+}
+
+func (c *captchaChallenger) Verify(r *http.Request) error {
+	if c.captcha != nil {
+		issued := c.sessionManager.Exists(r.Context(), c.key)
+		wanted, _ := c.sessionManager.Pop(r.Context(), c.key).(bool)
+		if wanted || !issued {
+			return c.verifyCaptcha(r)
+		}
+	}
+
+	if c.fallback == nil {
+		return nil
+	}
+	return c.fallback.Verify(r)
+}
+
+func (c *captchaChallenger) verifyCaptcha(r *http.Request) error {
+	ok, err := c.captcha.Verify(r.Context(), r.PostForm.Get(c.captcha.Field()), c.clientIP(r))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errCaptchaFailed
+	}
+	return nil
+}
+
+// The captchaRisk helper reports whether a visitor loading a form should
+// be asked for a CAPTCHA. Each form shown counts against the address, and
+// once there have been more than captchaAfter in an hour every one gets a
+// CAPTCHA; so do clients which don't send the User-Agent and
+// Accept-Language headers that browsers always do.
+func (app *application) captchaRisk(form string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		if app.captchaAfter == 0 || r.UserAgent() == "" || r.Header.Get("Accept-Language") == "" {
+			return true
+		}
+
+		ok, _, _ := app.takeRateLimit(r, "captcha:"+form+":"+app.clientIP(r), app.captchaAfter, time.Hour)
+		return !ok
+	}
+}
+
+// The issueChallenge helper issues a challenge for a form. When it's a
+// CAPTCHA, the service's origins are added to the page's Content Security
+// Policy so that its widget can load.
+func (app *application) issueChallenge(w http.ResponseWriter, r *http.Request, c challenger) (*challenge, error) {
+	ch, err := c.Issue(r)
+	if err != nil || ch == nil {
+		return ch, err
+	}
+
+	if ch.SiteKey != "" {
+		w.Header().Set("Content-Security-Policy", contentSecurityPolicy(app.cspNonce(r), "'none'", app.captcha.Origins()))
+	}
+
+	return ch, nil
+}
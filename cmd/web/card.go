@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"snippetbox.floccinau.net/internal/card"
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// cardCache stores generated preview images on disk, so that we only draw
+// each one once. Cards are keyed by snippet ID and a hash of the title and
+// content, which means an edited snippet automatically gets a new card.
+type cardCache struct {
+	dir string
+}
+
+func (c *cardCache) path(s *models.Snippet) string {
+	sum := sha256.Sum256([]byte(s.Title + "\x00" + s.Content))
+	return filepath.Join(c.dir, fmt.Sprintf("%d-%s.png", s.ID, hex.EncodeToString(sum[:8])))
+}
+
+// get returns the cached card for a snippet, or nil if there isn't one.
+func (c *cardCache) get(s *models.Snippet) []byte {
+	if c.dir == "" {
+		return nil
+	}
+
+	img, err := os.ReadFile(c.path(s))
+	if err != nil {
+		return nil
+	}
+	return img
+}
+
+// put saves a card, replacing any cards for older versions of the snippet.
+// The file is written to a temporary name and then renamed, so concurrent
+// requests never see a half-written image.
+func (c *cardCache) put(s *models.Snippet, img []byte) error {
+	if c.dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+
+	stale, _ := filepath.Glob(filepath.Join(c.dir, strconv.Itoa(s.ID)+"-*.png"))
+	for _, name := range stale {
+		os.Remove(name)
+	}
+
+	f, err := os.CreateTemp(c.dir, "card-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(img); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), c.path(s))
+}
+
+// The snippetCardPNG handler serves the preview image which is used as the
+// og:image for a snippet.
+func (app *application) snippetCardPNG(w http.ResponseWriter, r *http.Request) {
+	snippet := app.publicSnippetFromPath(w, r)
+	if snippet == nil {
+		return
+	}
+
+	img := app.cardCache.get(snippet)
+	if img == nil {
+		var buf bytes.Buffer
+		err := card.Render(&buf, snippet.Title, snippet.Content)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		img = buf.Bytes()
+
+		// Failing to cache the image isn't a reason to fail the request.
+		if err := app.cardCache.put(snippet, img); err != nil {
+			app.errorLog.Print(err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(len(img)))
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(img)
+}
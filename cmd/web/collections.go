@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/validator"
+)
+
+// collectionForm holds the form data for creating or editing a collection,
+// and any validation errors.
+type collectionForm struct {
+	Name        string
+	Description string
+	Public      bool
+	validator.Validator
+}
+
+// The readCollectionForm helper parses and checks the collection form in the
+// request body. It returns false if the body couldn't be parsed, in which
+// case it has already sent an error response.
+func (app *application) readCollectionForm(w http.ResponseWriter, r *http.Request) (collectionForm, bool) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return collectionForm{}, false
+	}
+
+	form := collectionForm{
+		Name:        strings.TrimSpace(r.PostForm.Get("name")),
+		Description: strings.TrimSpace(r.PostForm.Get("description")),
+		Public:      r.PostForm.Get("public") == "true",
+	}
+
+	form.Check(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.Check(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.Check(validator.MaxChars(form.Description, 500), "description", "This field cannot be more than 500 characters long")
+
+	return form, true
+}
+
+// The accountCollections handler lists the current user's collections, with
+// a form for creating another.
+func (app *application) accountCollections(w http.ResponseWriter, r *http.Request) {
+	app.renderCollections(w, r, http.StatusOK, collectionForm{Public: true})
+}
+
+func (app *application) renderCollections(w http.ResponseWriter, r *http.Request, status int, form collectionForm) {
+	collections, err := app.collections.ForUser(app.contextGetUser(r).ID, true)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Collections = collections
+	data.Form = form
+
+	app.render(w, status, "collections.tmpl.html", data)
+}
+
+func (app *application) accountCollectionsPost(w http.ResponseWriter, r *http.Request) {
+	form, ok := app.readCollectionForm(w, r)
+	if !ok {
+		return
+	}
+
+	var id int
+	if form.Valid() {
+		var err error
+		id, err = app.collections.Insert(app.contextGetUser(r).ID, form.Name, form.Description, form.Public)
+		if errors.Is(err, models.ErrDuplicateCollection) {
+			form.AddError("name", "You already have a collection with this name")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		app.renderCollections(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Collection created!")
+
+	http.Redirect(w, r, fmt.Sprintf("/collections/%d", id), http.StatusSeeOther)
+}
+
+// The collectionFromPath helper loads the collection named in the URL. Only
+// its owner can see a private collection; anyone else is told it doesn't
+// exist. If owned is set, only the owner can see it at all. It sends the
+// error response itself and returns nil if the collection can't be seen.
+func (app *application) collectionFromPath(w http.ResponseWriter, r *http.Request, owned bool) *models.Collection {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil
+	}
+
+	collection, err := app.collections.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil
+	}
+
+	user := app.currentUser(r)
+	isOwner := user != nil && user.ID == collection.UserID
+	if (owned || !collection.Public) && !isOwner {
+		app.notFound(w)
+		return nil
+	}
+
+	return collection
+}
+
+// The collectionView handler shows a collection's snippets in order. Its
+// owner gets controls for reordering and removing them, and a form for
+// editing the collection.
+func (app *application) collectionView(w http.ResponseWriter, r *http.Request) {
+	collection := app.collectionFromPath(w, r, false)
+	if collection == nil {
+		return
+	}
+
+	app.renderCollection(w, r, http.StatusOK, collection, collectionForm{
+		Name:        collection.Name,
+		Description: collection.Description,
+		Public:      collection.Public,
+	})
+}
+
+func (app *application) renderCollection(w http.ResponseWriter, r *http.Request, status int, collection *models.Collection, form collectionForm) {
+	items, err := app.collections.Items(collection.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	owner, err := app.users.Get(collection.UserID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Collection = collection
+	data.Profile = owner
+	data.Snippets = items
+	data.CanEdit = data.User != nil && data.User.ID == collection.UserID
+	data.Form = form
+
+	app.render(w, status, "collection.tmpl.html", data)
+}
+
+func (app *application) collectionEditPost(w http.ResponseWriter, r *http.Request) {
+	collection := app.collectionFromPath(w, r, true)
+	if collection == nil {
+		return
+	}
+
+	form, ok := app.readCollectionForm(w, r)
+	if !ok {
+		return
+	}
+
+	if form.Valid() {
+		err := app.collections.Update(collection.ID, form.Name, form.Description, form.Public)
+		if errors.Is(err, models.ErrDuplicateCollection) {
+			form.AddError("name", "You already have a collection with this name")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		app.renderCollection(w, r, http.StatusUnprocessableEntity, collection, form)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Collection updated!")
+
+	http.Redirect(w, r, fmt.Sprintf("/collections/%d", collection.ID), http.StatusSeeOther)
+}
+
+func (app *application) collectionDeletePost(w http.ResponseWriter, r *http.Request) {
+	collection := app.collectionFromPath(w, r, true)
+	if collection == nil {
+		return
+	}
+
+	err := app.collections.Delete(collection.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Collection deleted.")
+
+	http.Redirect(w, r, "/collections", http.StatusSeeOther)
+}
+
+// The snippetCollectPost handler adds a snippet to one of the current user's
+// collections, which is picked on the snippet's page.
+func (app *application) snippetCollectPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	collectionID, err := strconv.Atoi(r.PostForm.Get("collection"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	collection, err := app.collections.Get(collectionID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+	if collection == nil || collection.UserID != app.contextGetUser(r).ID {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.collections.AddItem(collection.ID, snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Added to the collection.")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// The collectionItemFromPath helper loads the current user's collection and
+// the ID of the snippet in it which are named in the URL. It sends the error
+// response itself and returns nil if either isn't valid.
+func (app *application) collectionItemFromPath(w http.ResponseWriter, r *http.Request) (*models.Collection, int) {
+	collection := app.collectionFromPath(w, r, true)
+	if collection == nil {
+		return nil, 0
+	}
+
+	snippetID, err := strconv.Atoi(r.PathValue("snippet"))
+	if err != nil || snippetID < 1 {
+		app.notFound(w)
+		return nil, 0
+	}
+
+	return collection, snippetID
+}
+
+func (app *application) collectionItemDeletePost(w http.ResponseWriter, r *http.Request) {
+	collection, snippetID := app.collectionItemFromPath(w, r)
+	if collection == nil {
+		return
+	}
+
+	err := app.collections.RemoveItem(collection.ID, snippetID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/collections/%d", collection.ID), http.StatusSeeOther)
+}
+
+// The collectionItemMovePost handler moves a snippet one place up or down in
+// a collection, as the direction field says.
+func (app *application) collectionItemMovePost(w http.ResponseWriter, r *http.Request) {
+	collection, snippetID := app.collectionItemFromPath(w, r)
+	if collection == nil {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	direction := r.PostForm.Get("direction")
+	if direction != "up" && direction != "down" {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.collections.MoveItem(collection.ID, snippetID, direction == "down")
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/collections/%d#item-%d", collection.ID, snippetID), http.StatusSeeOther)
+}
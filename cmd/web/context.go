@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// Define a custom contextKey type, with the underlying type string. Using our
+// own type for request context keys avoids collisions with keys set by other
+// packages.
+type contextKey string
+
+const (
+	userContextKey     = contextKey("user")
+	cspNonceContextKey = contextKey("cspNonce")
+	countryContextKey  = contextKey("country")
+)
+
+// The contextSetUser() method returns a new copy of the request with the
+// provided User struct added to the context.
+func (app *application) contextSetUser(r *http.Request, user *models.User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// The contextGetUser() retrieves the User struct from the request context. The
+// only time that we'll use this helper is when we logically expect there to be
+// a User struct value in the context, and if it doesn't exist it will firmly
+// be an 'unexpected' error, so it's OK to panic.
+func (app *application) contextGetUser(r *http.Request) *models.User {
+	user, ok := r.Context().Value(userContextKey).(*models.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+
+	return user
+}
+
+// The cspNonce() helper returns the Content Security Policy nonce generated
+// for this request by the secureHeaders() middleware, or an empty string if
+// there isn't one.
+func (app *application) cspNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(cspNonceContextKey).(string)
+	return nonce
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippetbox.floccinau.net/internal/crypto"
+	"snippetbox.floccinau.net/internal/session"
+)
+
+// cookieConfig holds the settings for cookies, from the -cookie-* flags.
+type cookieConfig struct {
+	Secure bool
+	// Domain lets the cookies be sent to subdomains too. It can't be used
+	// with HostPrefix.
+	Domain   string
+	SameSite http.SameSite
+	// HostPrefix puts __Host- in front of cookie names, which tells
+	// browsers to refuse them unless they're Secure, for the whole site,
+	// and without a Domain, so that a subdomain can't set or overwrite
+	// them.
+	HostPrefix bool
+}
+
+// parseSameSite checks the value of the -cookie-samesite flag.
+func parseSameSite(s string) (http.SameSite, error) {
+	switch s {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	}
+	return 0, fmt.Errorf("unknown -cookie-samesite %q: must be lax or strict", s)
+}
+
+// validate checks that the settings can work together.
+func (c cookieConfig) validate() error {
+	if c.HostPrefix && !c.Secure {
+		return errors.New("-cookie-host-prefix needs HTTPS, or -cookie-secure behind a proxy which does it")
+	}
+	if c.HostPrefix && c.Domain != "" {
+		return errors.New("-cookie-host-prefix can't be used with -cookie-domain")
+	}
+	return nil
+}
+
+// name returns the name a cookie is sent with.
+func (c cookieConfig) name(base string) string {
+	if c.HostPrefix {
+		return "__Host-" + base
+	}
+	return base
+}
+
+// session returns the settings for the session cookie. Like the default,
+// it's kept when the browser is closed, until the session's Lifetime is up.
+func (c cookieConfig) session() session.Cookie {
+	return session.Cookie{
+		Name:     c.name("session"),
+		Domain:   c.Domain,
+		Path:     "/",
+		Persist:  true,
+		HttpOnly: true,
+		Secure:   c.Secure,
+		SameSite: c.SameSite,
+	}
+}
+
+// setCookie sends a cookie which lasts until expires, or deletes it if
+// expires is the zero time.
+//
+// Every cookie the server sets goes through here, so that they all get the
+// same attributes: HttpOnly, Secure over HTTPS, the configured SameSite mode
+// and domain, and the __Host- prefix if it's on. Cookies holding anything
+// which mustn't be read or changed by the browser are encrypted with
+// setSecureCookie. The tz cookie is the one exception: it's written by
+// main.js, so it can't be HttpOnly or signed, and is checked when it's read
+// instead.
+func (app *application) setCookie(w http.ResponseWriter, name, value string, expires time.Time) {
+	cookie := &http.Cookie{
+		Name:     app.cookies.name(name),
+		Value:    value,
+		Path:     "/",
+		Domain:   app.cookies.Domain,
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   app.cookies.Secure,
+		SameSite: app.cookies.SameSite,
+	}
+	if expires.IsZero() {
+		cookie.Value = ""
+		cookie.MaxAge = -1
+	}
+
+	http.SetCookie(w, cookie)
+}
+
+// readCookie returns the value of a cookie set with setCookie.
+func (app *application) readCookie(r *http.Request, name string) (string, bool) {
+	c, err := r.Cookie(app.cookies.name(name))
+	if err != nil {
+		return "", false
+	}
+	return c.Value, true
+}
+
+// cookieKey returns the key cookie values are encrypted with. It's made
+// from the same secret as attachment links, but the "cookie" label means
+// it's a different key.
+func (app *application) cookieKey() []byte {
+	mac := hmac.New(sha256.New, app.downloadSecret)
+	mac.Write([]byte("cookie"))
+	return mac.Sum(nil)
+}
+
+// setSecureCookie sends a cookie whose value is encrypted and
+// authenticated, so that the browser can neither read it nor change it.
+// The name and expiry are sealed in with the value, so that it can't be
+// moved to another cookie or kept past its time.
+func (app *application) setSecureCookie(w http.ResponseWriter, name, value string, expires time.Time) error {
+	plaintext := name + "|" + strconv.FormatInt(expires.Unix(), 10) + "|" + value
+
+	sealed, err := crypto.Seal(app.cookieKey(), []byte(plaintext))
+	if err != nil {
+		return err
+	}
+
+	app.setCookie(w, name, base64.RawURLEncoding.EncodeToString(sealed), expires)
+	return nil
+}
+
+// readSecureCookie returns the value of a cookie set with setSecureCookie.
+// It reports false if there's no such cookie, or it has been tampered with
+// or has expired.
+func (app *application) readSecureCookie(r *http.Request, name string) (string, bool) {
+	encoded, ok := app.readCookie(r, name)
+	if !ok {
+		return "", false
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+
+	plaintext, err := crypto.Open(app.cookieKey(), sealed)
+	if err != nil {
+		return "", false
+	}
+
+	parts := strings.SplitN(string(plaintext), "|", 3)
+	if len(parts) != 3 || parts[0] != name {
+		return "", false
+	}
+
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", false
+	}
+
+	return parts[2], true
+}
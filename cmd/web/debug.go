@@ -0,0 +1,94 @@
+package main
+
+import (
+	"database/sql"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/sqltrace"
+)
+
+// The debugRoutes() method returns a servemux with the net/http/pprof
+// profiling endpoints under /debug/pprof/ and the expvar variables at
+// /debug/vars. It doesn't check who's asking, so it must only be reachable
+// by admins or from this machine.
+func (app *application) debugRoutes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+	mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+
+	return mux
+}
+
+// publishDebugVars adds the application's own variables to the ones expvar
+// shows at /debug/vars: the number of goroutines, the database connection
+// pool statistics, the health of any read replicas, the timings of the
+// queries made by each model method and how often database operations were
+// retried. It must only be called once.
+func publishDebugVars(db *sql.DB, replicas *models.Replicas, tracer *sqltrace.Tracer) {
+	expvar.Publish("goroutines", expvar.Func(func() any {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("database", expvar.Func(func() any {
+		return db.Stats()
+	}))
+	if replicas.Len() > 0 {
+		expvar.Publish("replicas", expvar.Func(func() any {
+			return replicas.Status()
+		}))
+	}
+	expvar.Publish("queries", expvar.Func(func() any {
+		return tracer.Stats()
+	}))
+	expvar.Publish("retries", expvar.Func(func() any {
+		return models.RetryCounts()
+	}))
+}
+
+// logSlowQuery returns a function which logs a slow query to logger, with
+// the query's whitespace squashed so that it fits on one line.
+func logSlowQuery(logger *log.Logger) func(sqltrace.Query) {
+	return func(q sqltrace.Query) {
+		rows := "unknown"
+		if q.Rows >= 0 {
+			rows = strconv.FormatInt(q.Rows, 10)
+		}
+
+		logger.Printf("Slow query in %s took %s (rows: %s, error: %v): %s",
+			q.Caller, q.Duration.Round(time.Millisecond), rows, q.Err, strings.Join(strings.Fields(q.SQL), " "))
+	}
+}
+
+// checkDebugAddr returns an error unless addr is a loopback address, like
+// "localhost:6060" or "127.0.0.1:6060", so that the unauthenticated debug
+// listener can't be reached from other machines.
+func checkDebugAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	return fmt.Errorf("debug address %q is not a loopback address", addr)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// The snippetFromPath helper loads the unexpired snippet whose ID is in the
+// {id} path wildcard. It sends the error response itself and returns nil if
+// there isn't one.
+func (app *application) snippetFromPath(w http.ResponseWriter, r *http.Request) *models.Snippet {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil
+	}
+
+	return snippet
+}
+
+// The publicSnippetFromPath helper is like snippetFromPath, but also treats
+// passphrase-protected snippets as not found. Use it for anything which shows
+// a snippet's content outside of the view page.
+func (app *application) publicSnippetFromPath(w http.ResponseWriter, r *http.Request) *models.Snippet {
+	snippet := app.snippetFromPath(w, r)
+	if snippet != nil && snippet.Protected {
+		app.notFound(w)
+		return nil
+	}
+
+	return snippet
+}
+
+// The snippetAsset handler serves the per-snippet files under
+// /snippet/{id}/{asset}. They share one route because a pattern like
+// "/snippet/{id}/embed.js" would conflict with "/snippet/view/{id}" in the
+// servemux.
+func (app *application) snippetAsset(w http.ResponseWriter, r *http.Request) {
+	switch r.PathValue("asset") {
+	case "embed.js":
+		app.snippetEmbedJS(w, r)
+	case "card.png":
+		app.snippetCardPNG(w, r)
+	case "qr.png":
+		app.snippetQRPNG(w, r)
+	default:
+		app.notFound(w)
+	}
+}
+
+// The snippetEmbed handler serves a minimal, read-only page showing a single
+// snippet, designed to be shown in an <iframe> on other sites. Unlike every
+// other page it may be framed by anyone.
+func (app *application) snippetEmbed(w http.ResponseWriter, r *http.Request) {
+	snippet := app.publicSnippetFromPath(w, r)
+	if snippet == nil {
+		return
+	}
+
+	w.Header().Set("Content-Security-Policy", contentSecurityPolicy(app.cspNonce(r), "*"))
+	w.Header().Del("X-Frame-Options")
+
+	data := &templateData{
+		Snippet:  snippet,
+		CSPNonce: app.cspNonce(r),
+		BaseURL:  app.absoluteURL(r, ""),
+	}
+
+	app.renderLayout(w, http.StatusOK, "embed.tmpl.html", "embed", data)
+}
+
+// embedScript is the JavaScript served by snippetEmbedJS. It inserts a styled,
+// read-only copy of the snippet just before the <script> tag which loaded it.
+// The content is added with textContent (never innerHTML) and inside a shadow
+// root, so it can't run script or clash with the host page's CSS.
+const embedScript = `(function() {
+	var snippet = %s;
+	var script = document.currentScript;
+	if (!script) {
+		return;
+	}
+
+	var host = document.createElement("div");
+	host.className = "snippetbox-embed";
+	var root = host.attachShadow ? host.attachShadow({mode: "open"}) : host;
+
+	var style = document.createElement("style");
+	style.textContent = ".sb{border:1px solid #E4E5E7;border-radius:3px;background:#FFF;color:#34495E;font:14px/1.5 'Ubuntu Mono',monospace;margin:1em 0}" +
+		".sb-title{background:#F7F9FA;padding:.5em 1em;font-weight:bold;border-bottom:1px solid #E4E5E7}" +
+		".sb pre{margin:0;padding:1em;overflow:auto}" +
+		".sb-footer{background:#F7F9FA;padding:.5em 1em;border-top:1px solid #E4E5E7;font-size:12px}" +
+		".sb a{color:#62CB31;text-decoration:none}";
+	root.appendChild(style);
+
+	var box = document.createElement("div");
+	box.className = "sb";
+
+	var title = document.createElement("div");
+	title.className = "sb-title";
+	title.textContent = snippet.title;
+	box.appendChild(title);
+
+	var pre = document.createElement("pre");
+	pre.textContent = snippet.content;
+	box.appendChild(pre);
+
+	var footer = document.createElement("div");
+	footer.className = "sb-footer";
+	var link = document.createElement("a");
+	link.href = snippet.url;
+	link.target = "_blank";
+	link.rel = "noopener";
+	link.textContent = "View on Snippetbox";
+	footer.appendChild(link);
+	box.appendChild(footer);
+
+	root.appendChild(box);
+	script.parentNode.insertBefore(host, script);
+})();
+`
+
+// The snippetEmbedJS handler serves a script which third-party sites can
+// include with <script src=".../snippet/5/embed.js"></script> to show the
+// snippet inline.
+func (app *application) snippetEmbedJS(w http.ResponseWriter, r *http.Request) {
+	snippet := app.publicSnippetFromPath(w, r)
+	if snippet == nil {
+		return
+	}
+
+	// json.Marshal escapes <, > and & by default, so the data can't break
+	// out of the script.
+	js, err := json.Marshal(map[string]string{
+		"title":   snippet.Title,
+		"content": snippet.Content,
+		"url":     app.absoluteURL(r, fmt.Sprintf("/snippet/view/%d", snippet.ID)),
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The script is meant to be loaded by other origins, so allow both plain
+	// <script> inclusion and fetch() from anywhere. There are no cookies or
+	// credentials involved, so a wildcard is safe.
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cross-Origin-Resource-Policy", "cross-origin")
+	w.Header().Set("Cache-Control", app.sharedCacheControl(300))
+
+	fmt.Fprintf(w, embedScript, js)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/pubsub"
+)
+
+// newSnippetsTopic is the hub topic which new public snippets are published
+// to.
+const newSnippetsTopic = "snippets"
+
+// sseHeartbeat is how often a comment is sent on an idle event stream, so
+// that proxies don't time the connection out.
+const sseHeartbeat = 30 * time.Second
+
+// snippetEvent is the data of a "snippet" event on the /events stream. It
+// has what's needed to list the snippet, but not its content.
+type snippetEvent struct {
+	ID       int       `json:"id"`
+	Title    string    `json:"title"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+	Language string    `json:"language,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+	URL      string    `json:"url"`
+}
+
+// The announceSnippet method publishes a newly created snippet to the
+// /events stream, in the background. Snippets protected by a passphrase
+// aren't announced, and nor are snippets which aren't published yet.
+func (app *application) announceSnippet(id int) {
+	if app.events.Subscribers(newSnippetsTopic) == 0 {
+		return
+	}
+
+	app.background(func() {
+		snippet, err := app.snippets.Get(context.Background(), id)
+		if err == nil {
+			err = app.snippets.LoadTags(snippet)
+		}
+		if errors.Is(err, models.ErrNoRecord) {
+			return
+		} else if err != nil {
+			app.errorLog.Print(err)
+			return
+		}
+		if snippet.Protected {
+			return
+		}
+
+		data, err := json.Marshal(snippetEvent{
+			ID:       snippet.ID,
+			Title:    snippet.Title,
+			Created:  snippet.Created,
+			Expires:  snippet.Expires,
+			Language: snippet.Language,
+			Tags:     snippet.Tags,
+			URL:      fmt.Sprintf("/snippet/view/%d", snippet.ID),
+		})
+		if err != nil {
+			app.errorLog.Print(err)
+			return
+		}
+
+		app.events.Publish(newSnippetsTopic, pubsub.Message{
+			ID:    strconv.Itoa(snippet.ID),
+			Event: "snippet",
+			Data:  data,
+		})
+	})
+}
+
+// The eventStream handler streams new public snippets as Server-Sent
+// Events, one "snippet" event each. Clients which can't keep up are
+// disconnected, and can reconnect; EventSource does so automatically.
+func (app *application) eventStream(w http.ResponseWriter, r *http.Request) {
+	sub, err := app.events.Subscribe(newSnippetsTopic)
+	if err != nil {
+		if errors.Is(err, pubsub.ErrTooManySubscribers) || errors.Is(err, pubsub.ErrClosed) {
+			w.Header().Set("Retry-After", "30")
+			app.clientError(w, http.StatusServiceUnavailable)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	defer sub.Close()
+
+	// The stream stays open indefinitely, so it mustn't be cut off by the
+	// server's write timeout.
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stop nginx from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Tell the browser to wait 5 seconds before reconnecting.
+	fmt.Fprint(w, "retry: 5000\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case msg, ok := <-sub.C():
+			if !ok {
+				if sub.Evicted() {
+					app.infoLog.Printf("Disconnected slow event stream client %s", app.clientIP(r))
+				}
+				return
+			}
+			if msg.ID != "" {
+				fmt.Fprintf(w, "id: %s\n", msg.ID)
+			}
+			if msg.Event != "" {
+				fmt.Fprintf(w, "event: %s\n", msg.Event)
+			}
+			fmt.Fprintf(w, "data: %s\n\n", msg.Data)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case <-r.Context().Done():
+			return
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// honeypotField is the name of the honeypot field. It's named like a field
+// a bot would want to fill in.
+const honeypotField = "website"
+
+// formTimeField is the name of the field holding the signed timestamp.
+const formTimeField = "form_ts"
+
+// formMinFillTime is the shortest time that a person could fill in a form.
+const formMinFillTime = 3 * time.Second
+
+// signFormTime returns the signature of a form timestamp. It's signed with
+// the same secret as attachment links, but the "form:" prefix means one
+// can't be used as the other.
+func (app *application) signFormTime(ts int64) string {
+	mac := hmac.New(sha256.New, app.downloadSecret)
+	fmt.Fprintf(mac, "form:%d", ts)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// The formGuardToken helper returns the signed timestamp to put in a form.
+// When a submitted form is shown again, to fix a validation error say, it
+// keeps its original timestamp: otherwise someone who fixed it quickly would
+// be taken for a bot.
+func (app *application) formGuardToken(r *http.Request) string {
+	if token := r.PostForm.Get(formTimeField); token != "" {
+		if _, ok := app.parseFormTime(token); ok {
+			return token
+		}
+	}
+
+	ts := time.Now().Unix()
+	return strconv.FormatInt(ts, 10) + "." + app.signFormTime(ts)
+}
+
+// parseFormTime checks the signature of a form timestamp and returns the
+// time.
+func (app *application) parseFormTime(token string) (time.Time, bool) {
+	tsText, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return time.Time{}, false
+	}
+
+	ts, err := strconv.ParseInt(tsText, 10, 64)
+	if err != nil || !hmac.Equal([]byte(sig), []byte(app.signFormTime(ts))) {
+		return time.Time{}, false
+	}
+
+	return time.Unix(ts, 0), true
+}
+
+// The checkFormGuard helper checks the traps in a submitted form. It returns
+// an empty string if the form looks like it was filled in by a person, or
+// else why it looks like a bot. The form must have been parsed.
+func (app *application) checkFormGuard(r *http.Request) string {
+	if r.PostForm.Get(honeypotField) != "" {
+		return "honeypot filled in"
+	}
+
+	shown, ok := app.parseFormTime(r.PostForm.Get(formTimeField))
+	if !ok {
+		return "missing or forged timestamp"
+	}
+
+	if elapsed := time.Since(shown); elapsed < formMinFillTime {
+		return fmt.Sprintf("submitted after %s", elapsed.Round(time.Millisecond))
+	}
+
+	return ""
+}
+
+// The guardForm() middleware checks the traps in forms posted to the wrapped
+// handler. There are two. The first is a honeypot: a text field which is
+// hidden from people, but which a bot filling in every field it finds will
+// fill in. The second is a timestamp, signed so it can't be forged, of when
+// the form was shown; people take more than a few seconds to fill in a form,
+// bots often don't.
+//
+// Submissions which look like they came from a bot are logged and
+// dropped, and the bot is redirected to redirectTo as if it had succeeded,
+// so it doesn't learn that it was caught. It parses the form, so it can't be
+// used for multipart forms.
+func (app *application) guardForm(redirectTo string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := r.ParseForm()
+			if err != nil {
+				app.clientError(w, http.StatusBadRequest)
+				return
+			}
+
+			if reason := app.checkFormGuard(r); reason != "" {
+				app.infoLog.Printf("Dropped likely bot submission to %s from %s: %s", r.URL.Path, app.clientIP(r), reason)
+				http.Redirect(w, r, redirectTo, http.StatusSeeOther)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
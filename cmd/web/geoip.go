@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// geoIP looks up countries in a MaxMind-format GeoIP database, such as
+// GeoLite2 Country, so that each request can be tagged with the country it
+// came from. The country goes in the access log and the audit log, and
+// people in some countries can be stopped from posting without an account,
+// or allowed to post fewer snippets. A nil *geoIP is valid, and knows no
+// countries.
+type geoIP struct {
+	db *maxminddb.Reader
+	// blocked countries can't post without an account at all, and limited
+	// ones can post limit snippets per window instead of the usual number.
+	blocked []string
+	limited []string
+	limit   int
+}
+
+// openGeoIP opens the database at path. blocked and limited are space
+// separated lists of ISO country codes.
+func openGeoIP(path, blocked, limited string, limit int) (*geoIP, error) {
+	g := &geoIP{limit: limit}
+
+	var err error
+	g.blocked, err = parseCountries(blocked)
+	if err != nil {
+		return nil, err
+	}
+	g.limited, err = parseCountries(limited)
+	if err != nil {
+		return nil, err
+	}
+
+	g.db, err = maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// parseCountries parses a space separated list of two-letter country
+// codes, like "XX YY".
+func parseCountries(s string) ([]string, error) {
+	var countries []string
+	for _, code := range strings.Fields(strings.ToUpper(s)) {
+		if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+			return nil, fmt.Errorf("%q isn't a two-letter country code", code)
+		}
+		countries = append(countries, code)
+	}
+	return countries, nil
+}
+
+// country returns the ISO code of the country ip is in, or "" if it's not
+// in the database. Addresses which aren't placed in a country of their own,
+// like some mobile and satellite networks, get the country they're
+// registered in.
+func (g *geoIP) country(ip string) string {
+	if g == nil {
+		return ""
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+		RegisteredCountry struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"registered_country"`
+	}
+	err = g.db.Lookup(addr.Unmap()).Decode(&record)
+	if err != nil {
+		return ""
+	}
+
+	if record.Country.ISOCode != "" {
+		return record.Country.ISOCode
+	}
+	return record.RegisteredCountry.ISOCode
+}
+
+// blocks reports whether people in country can't post without an account.
+func (g *geoIP) blocks(country string) bool {
+	return g != nil && country != "" && slices.Contains(g.blocked, country)
+}
+
+// anonymousLimit returns how many snippets people in country can post
+// without an account in each window, when it's usually limit.
+func (g *geoIP) anonymousLimit(country string, limit int) int {
+	if g != nil && country != "" && slices.Contains(g.limited, country) {
+		return min(g.limit, limit)
+	}
+	return limit
+}
+
+// Close closes the database.
+func (g *geoIP) Close() error {
+	if g == nil {
+		return nil
+	}
+	return g.db.Close()
+}
+
+// The geolocate() middleware looks up the country each request came from,
+// for clientCountry(). It must come after realIP().
+func (app *application) geolocate(next http.Handler) http.Handler {
+	if app.geoIP == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if country := app.geoIP.country(app.clientIP(r)); country != "" {
+			ctx := context.WithValue(r.Context(), countryContextKey, country)
+			r = r.WithContext(ctx)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The clientCountry() helper returns the ISO code of the country the
+// request came from, or "" if it isn't known.
+func (app *application) clientCountry(r *http.Request) string {
+	country, _ := r.Context().Value(countryContextKey).(string)
+	return country
+}
+
+// anonymousBlockedMessage is shown to people who can't post without an
+// account because of where they are.
+const anonymousBlockedMessage = "Snippets can't be posted without an account from your location. Please log in."
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+
+	"snippetbox.floccinau.net/internal/dataloader"
+	"snippetbox.floccinau.net/internal/errreport"
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// graphQLPath is where the GraphQL endpoint is served.
+const graphQLPath = "/graphql"
+
+// maxGraphQLDepth is how deeply the fields of a query can be nested, so that
+// one query can't ask for the authors of the snippets of the authors of the
+// snippets... and so on. Introspection fields don't count.
+const maxGraphQLDepth = 10
+
+// maxGraphQLQuerySize is the longest query that's parsed, in bytes. Real
+// queries are much shorter, and the parser follows nesting recursively.
+const maxGraphQLQuerySize = 64 << 10
+
+// graphQLContextKey is the context key of the *graphQLRequest which
+// resolvers work with.
+const graphQLContextKey = contextKey("graphQL")
+
+// graphQLRequest is what the resolvers of one GraphQL request share: who's
+// asking, and the loaders which batch their lookups.
+type graphQLRequest struct {
+	r    *http.Request
+	user *models.User
+
+	users         *dataloader.Loader[int, *models.User]
+	commentCounts *dataloader.Loader[int, int]
+	comments      *dataloader.Loader[commentPageKey, []*models.Comment]
+}
+
+// commentPage is a page of a snippet's comments, as the offset and limit of
+// a connection.
+type commentPage struct {
+	offset, limit int
+}
+
+// commentPageKey names one page of one snippet's comments.
+type commentPageKey struct {
+	snippetID int
+	commentPage
+}
+
+// The newGraphQLRequest helper makes the resolvers' view of a request, with
+// new loaders, so that nothing loaded for one request is seen by another.
+func (app *application) newGraphQLRequest(r *http.Request) *graphQLRequest {
+	return &graphQLRequest{
+		r:    r,
+		user: app.contextGetUser(r),
+
+		users: dataloader.New(app.users.GetMany),
+		commentCounts: dataloader.New(func(ids []int) (map[int]int, error) {
+			return app.comments.Counts(ids)
+		}),
+		comments: dataloader.New(app.loadCommentPages),
+	}
+}
+
+// The loadCommentPages method is the comments loader's lookup. The pages
+// asked for are usually the same page of many snippets, so there's one
+// query for each different page.
+func (app *application) loadCommentPages(keys []commentPageKey) (map[commentPageKey][]*models.Comment, error) {
+	byPage := make(map[commentPage][]int)
+	for _, key := range keys {
+		byPage[key.commentPage] = append(byPage[key.commentPage], key.snippetID)
+	}
+
+	pages := make(map[commentPageKey][]*models.Comment, len(keys))
+	for page, ids := range byPage {
+		comments, err := app.comments.ListForSnippets(ids, page.offset, page.limit)
+		if err != nil {
+			return nil, err
+		}
+		for id, c := range comments {
+			pages[commentPageKey{id, page}] = c
+		}
+	}
+
+	return pages, nil
+}
+
+// graphQLFrom returns the *graphQLRequest in a resolver's context.
+func graphQLFrom(ctx context.Context) *graphQLRequest {
+	return ctx.Value(graphQLContextKey).(*graphQLRequest)
+}
+
+// errGraphQLInternal is what clients are told when a field can't be
+// resolved because of a problem on the server. The problem itself is
+// logged.
+var errGraphQLInternal = errors.New("the server encountered a problem and could not resolve this field")
+
+// The graphQLServerError method is the GraphQL counterpart of
+// serverErrorResponse: it logs the error and stack trace, and returns the
+// error for the field, which the client sees along with whatever else it
+// asked for.
+func (app *application) graphQLServerError(gr *graphQLRequest, err error) error {
+	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+	app.errorLog.Output(2, trace)
+	app.reportError(gr.r, err, "error", errreport.Callers(1))
+
+	return errGraphQLInternal
+}
+
+// The graphQL handler runs a GraphQL query, sent as the query, variables and
+// operationName parameters of a GET request, or as the same fields of a
+// JSON object in a POST.
+//
+// Queries read snippets, users, tags and comments, for clients which want
+// to fetch exactly the fields they need in one request. The endpoint only
+// reads: there are no mutations, so it takes API tokens with just the read
+// scope, even for POSTed queries. Lists are paged through with cursors, as
+// Relay-style connections.
+func (app *application) graphQL(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Query         string         `json:"query"`
+		OperationName string         `json:"operationName"`
+		Variables     map[string]any `json:"variables"`
+		// Some clients send extensions, for features which aren't
+		// supported here. They're ignored.
+		Extensions map[string]any `json:"extensions"`
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		qs := r.URL.Query()
+		input.Query = qs.Get("query")
+		input.OperationName = qs.Get("operationName")
+		if variables := qs.Get("variables"); variables != "" {
+			err := json.Unmarshal([]byte(variables), &input.Variables)
+			if err != nil {
+				app.badRequestResponse(w, r, errors.New("variables must be a JSON object"))
+				return
+			}
+		}
+	case http.MethodPost:
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		app.errorResponse(w, r, http.StatusMethodNotAllowed, fmt.Sprintf("the %s method is not supported for this resource", r.Method))
+		return
+	}
+
+	switch {
+	case strings.TrimSpace(input.Query) == "":
+		app.failedValidationResponse(w, r, map[string]string{"query": "must be provided"})
+		return
+	case len(input.Query) > maxGraphQLQuerySize:
+		app.failedValidationResponse(w, r, map[string]string{"query": fmt.Sprintf("must not be more than %d bytes long", maxGraphQLQuerySize)})
+		return
+	}
+
+	// A query which can't be run at all gets a 400. Once it's running, any
+	// errors come back alongside the fields which could be resolved.
+	status := http.StatusOK
+	var result *graphql.Result
+
+	doc, errs := app.parseGraphQL(input.Query)
+	if errs != nil {
+		status = http.StatusBadRequest
+		result = &graphql.Result{Errors: errs}
+	} else {
+		result = graphql.Execute(graphql.ExecuteParams{
+			Schema:        app.graphQLSchema,
+			AST:           doc,
+			OperationName: input.OperationName,
+			Args:          input.Variables,
+			Context:       context.WithValue(r.Context(), graphQLContextKey, app.newGraphQLRequest(r)),
+		})
+	}
+
+	env := envelope{}
+	if result.Data != nil {
+		env["data"] = result.Data
+	}
+	if len(result.Errors) > 0 {
+		env["errors"] = result.Errors
+	}
+
+	err := app.writeJSON(w, status, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The parseGraphQL method parses a query and checks it against the schema
+// and the depth limit, returning what's wrong with it if it can't be run.
+func (app *application) parseGraphQL(query string) (*ast.Document, []gqlerrors.FormattedError) {
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return nil, gqlerrors.FormatErrors(err)
+	}
+
+	// The endpoint only reads, so there's nothing for a mutation or a
+	// subscription to do.
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok && op.Operation != ast.OperationTypeQuery {
+			msg := fmt.Sprintf("%ss aren't supported, only queries", op.Operation)
+			return nil, []gqlerrors.FormattedError{gqlerrors.NewFormattedError(msg)}
+		}
+	}
+
+	// Fragments which spread themselves are invalid, but they're checked for
+	// here, since some of graphql-go's validation rules follow them forever.
+	depth, cycle := queryDepth(doc)
+	if cycle != "" {
+		msg := fmt.Sprintf("fragment %q spreads itself", cycle)
+		return nil, []gqlerrors.FormattedError{gqlerrors.NewFormattedError(msg)}
+	}
+	if depth > maxGraphQLDepth {
+		msg := fmt.Sprintf("query is nested %d fields deep, more than the limit of %d", depth, maxGraphQLDepth)
+		return nil, []gqlerrors.FormattedError{gqlerrors.NewFormattedError(msg)}
+	}
+
+	validation := graphql.ValidateDocument(&app.graphQLSchema, doc, nil)
+	if !validation.IsValid {
+		return nil, validation.Errors
+	}
+
+	return doc, nil
+}
+
+// queryDepth returns how deeply the fields of the operations in a query
+// are nested, following fragments. If a fragment spreads itself, directly
+// or through others, its name is returned too.
+func queryDepth(doc *ast.Document) (int, string) {
+	d := depthCounter{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		depths:    make(map[string]int),
+		visiting:  make(map[string]bool),
+	}
+	for _, def := range doc.Definitions {
+		if f, ok := def.(*ast.FragmentDefinition); ok {
+			d.fragments[f.Name.Value] = f
+		}
+	}
+
+	depth := 0
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok {
+			depth = max(depth, d.selectionDepth(op.SelectionSet))
+		}
+	}
+	for name := range d.fragments {
+		d.fragmentDepth(name)
+	}
+	return depth, d.cycle
+}
+
+// depthCounter works out the depth of selection sets. The depth of each
+// fragment is remembered, so that a query which spreads the same fragments
+// many times doesn't take long to check. cycle is set to the first fragment
+// found to spread itself.
+type depthCounter struct {
+	fragments map[string]*ast.FragmentDefinition
+	depths    map[string]int
+	visiting  map[string]bool
+	cycle     string
+}
+
+func (d *depthCounter) selectionDepth(set *ast.SelectionSet) int {
+	if set == nil {
+		return 0
+	}
+
+	depth := 0
+	for _, sel := range set.Selections {
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(sel.Name.Value, "__") {
+				continue
+			}
+			depth = max(depth, 1+d.selectionDepth(sel.SelectionSet))
+		case *ast.InlineFragment:
+			depth = max(depth, d.selectionDepth(sel.SelectionSet))
+		case *ast.FragmentSpread:
+			depth = max(depth, d.fragmentDepth(sel.Name.Value))
+		}
+	}
+	return depth
+}
+
+func (d *depthCounter) fragmentDepth(name string) int {
+	if depth, ok := d.depths[name]; ok {
+		return depth
+	}
+	f, ok := d.fragments[name]
+	if !ok {
+		return 0
+	}
+	if d.visiting[name] {
+		if d.cycle == "" {
+			d.cycle = name
+		}
+		return 0
+	}
+
+	d.visiting[name] = true
+	depth := d.selectionDepth(f.SelectionSet)
+	delete(d.visiting, name)
+
+	d.depths[name] = depth
+	return depth
+}
+
+// Cursors are the position of a node in its list, from 0, so the page after
+// a cursor starts at the next position. They're encoded so that clients
+// treat them as opaque, and don't depend on what's in them.
+const cursorPrefix = "cursor:"
+
+// maxCursor is the furthest into a list that a cursor can point.
+const maxCursor = 10_000_000
+
+func encodeCursor(position int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(position)))
+}
+
+func decodeCursor(cursor string) (int, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, false
+	}
+	s, ok := strings.CutPrefix(string(b), cursorPrefix)
+	if !ok {
+		return 0, false
+	}
+	position, err := strconv.Atoi(s)
+	if err != nil || position < 0 || position > maxCursor {
+		return 0, false
+	}
+	return position, true
+}
+
+// graphQLPage is one page of a connection: its nodes, where they start in
+// the whole list, and how long the whole list is.
+type graphQLPage struct {
+	nodes  []any
+	offset int
+	total  int
+}
+
+// graphQLEdge is a node of a connection, with its cursor.
+type graphQLEdge struct {
+	cursor string
+	node   any
+}
+
+// pageArgs returns the arguments of a connection field, along with any
+// others it takes.
+func pageArgs(others graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	args := graphql.FieldConfigArgument{
+		"first": &graphql.ArgumentConfig{
+			Type:         graphql.Int,
+			DefaultValue: 20,
+			Description:  fmt.Sprintf("How many to return, up to %d.", models.MaxPageSize),
+		},
+		"after": &graphql.ArgumentConfig{
+			Type:        graphql.String,
+			Description: "Return the ones after this cursor, from the last page's endCursor.",
+		},
+	}
+	for name, arg := range others {
+		args[name] = arg
+	}
+	return args
+}
+
+// readPageArgs returns the offset and limit of the page which the
+// arguments of a connection field ask for.
+func readPageArgs(args map[string]any) (offset, limit int, err error) {
+	limit, _ = args["first"].(int)
+	if limit < 1 || limit > models.MaxPageSize {
+		return 0, 0, fmt.Errorf("first must be between 1 and %d", models.MaxPageSize)
+	}
+
+	if after, ok := args["after"].(string); ok {
+		position, ok := decodeCursor(after)
+		if !ok {
+			return 0, 0, errors.New("after must be a cursor from this list")
+		}
+		offset = position + 1
+	}
+
+	return offset, limit, nil
+}
+
+// The graphiQL handler serves GraphiQL, an in-browser editor for trying out
+// GraphQL queries, in development mode. GraphiQL is loaded from unpkg.com,
+// so the page needs a policy of its own which allows that, and the inline
+// styles which GraphiQL sets.
+func (app *application) graphiQL(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf("default-src 'self'; "+
+		"script-src 'nonce-%s' 'strict-dynamic'; "+
+		"style-src 'self' https://unpkg.com 'unsafe-inline'; "+
+		"font-src 'self' https://unpkg.com data:; "+
+		"img-src 'self' data:; "+
+		"object-src 'none'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'", app.cspNonce(r)))
+
+	data := &templateData{CSPNonce: app.cspNonce(r)}
+
+	app.renderLayout(w, http.StatusOK, "graphiql.tmpl.html", "graphiql", data)
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// The newGraphQLSchema method builds the schema which the GraphQL endpoint
+// serves. Snippets, users and tags refer to each other, so their fields are
+// filled in once all the types exist.
+func (app *application) newGraphQLSchema() (graphql.Schema, error) {
+	var snippetType, userType, tagType, commentType *graphql.Object
+
+	pageInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "PageInfo",
+		Description: "Where a page of a connection is in the whole list.",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					page := p.Source.(*graphQLPage)
+					return page.offset+len(page.nodes) < page.total, nil
+				},
+			},
+			"endCursor": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The cursor to ask for the next page after, or null if the page is empty.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					page := p.Source.(*graphQLPage)
+					if len(page.nodes) == 0 {
+						return nil, nil
+					}
+					return encodeCursor(page.offset + len(page.nodes) - 1), nil
+				},
+			},
+		},
+	})
+
+	snippetConnection := graphQLConnection("Snippet", func() *graphql.Object { return snippetType }, pageInfoType)
+	commentConnection := graphQLConnection("Comment", func() *graphql.Object { return commentType }, pageInfoType)
+
+	snippetType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Snippet",
+		Description: "A published, unexpired snippet.",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":    &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+				"title": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"content": &graphql.Field{
+					Type:        graphql.String,
+					Description: "Null if the snippet is protected by a passphrase, except to its owner and moderators.",
+					Resolve:     app.resolveSnippetContent,
+				},
+				"language": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return nullIfEmpty(p.Source.(*models.Snippet).Language), nil
+					},
+				},
+				"tags": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tagType))),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return p.Source.(*models.Snippet).Tags, nil
+					},
+				},
+				"protected": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+				"version":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"created":   &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"expires":   &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"forkedFrom": &graphql.Field{
+					Type:        graphql.ID,
+					Description: "The ID of the snippet this one was forked from, if it was.",
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return nullIfZero(p.Source.(*models.Snippet).ForkedFrom), nil
+					},
+				},
+				"url": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.String),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						gr := graphQLFrom(p.Context)
+						return app.absoluteURL(gr.r, fmt.Sprintf("/snippet/view/%d", p.Source.(*models.Snippet).ID)), nil
+					},
+				},
+				"author": &graphql.Field{
+					Type:        userType,
+					Description: "Null if the snippet was posted anonymously, or its author has deleted their account.",
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return app.resolveUser(p, p.Source.(*models.Snippet).UserID)
+					},
+				},
+				"commentCount": &graphql.Field{
+					Type:    graphql.NewNonNull(graphql.Int),
+					Resolve: app.resolveCommentCount,
+				},
+				"comments": &graphql.Field{
+					Type:        graphql.NewNonNull(commentConnection),
+					Description: "The comments on the snippet, oldest first.",
+					Args:        pageArgs(nil),
+					Resolve:     app.resolveComments,
+				},
+			}
+		}),
+	})
+
+	userType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":       &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+				"username": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"name": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.String),
+					Description: "The user's display name, or the name they signed up with.",
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return p.Source.(*models.User).ShownName(), nil
+					},
+				},
+				"bio": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return nullIfEmpty(p.Source.(*models.User).Bio), nil
+					},
+				},
+				"created": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"email": &graphql.Field{
+					Type:        graphql.String,
+					Description: "Only shown to the user themselves, and to admins.",
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						gr := graphQLFrom(p.Context)
+						u := p.Source.(*models.User)
+						if u.ID != gr.user.ID && !gr.user.Can(models.PermissionAdminSystem) {
+							return nil, nil
+						}
+						return u.Email, nil
+					},
+				},
+				"avatarUrl": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						url := avatarURL(p.Source.(*models.User), 72, app.gravatar)
+						if strings.HasPrefix(url, "/") {
+							url = app.absoluteURL(graphQLFrom(p.Context).r, url)
+						}
+						return nullIfEmpty(url), nil
+					},
+				},
+				"snippets": &graphql.Field{
+					Type:        graphql.NewNonNull(snippetConnection),
+					Description: "The user's public snippets, newest first.",
+					Args:        pageArgs(nil),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return app.resolveSnippets(p, models.SnippetFilter{UserID: p.Source.(*models.User).ID})
+					},
+				},
+			}
+		}),
+	})
+
+	tagType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Tag",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"name": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.String),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return p.Source.(string), nil
+					},
+				},
+				"snippets": &graphql.Field{
+					Type:        graphql.NewNonNull(snippetConnection),
+					Description: "The public snippets with the tag, newest first.",
+					Args:        pageArgs(nil),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return app.resolveSnippets(p, models.SnippetFilter{Tag: p.Source.(string)})
+					},
+				},
+			}
+		}),
+	})
+
+	commentType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Comment",
+		Fields: graphql.Fields{
+			"id":      &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"content": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"created": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"author": &graphql.Field{
+				Type: userType,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return app.resolveUser(p, p.Source.(*models.Comment).UserID)
+				},
+			},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"snippet": &graphql.Field{
+				Type: snippetType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: app.resolveSnippet,
+			},
+			"snippets": &graphql.Field{
+				Type:        graphql.NewNonNull(snippetConnection),
+				Description: "The public snippets, newest first.",
+				Args: pageArgs(graphql.FieldConfigArgument{
+					"tag":      &graphql.ArgumentConfig{Type: graphql.String},
+					"language": &graphql.ArgumentConfig{Type: graphql.String},
+				}),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					var filter models.SnippetFilter
+					filter.Tag, _ = p.Args["tag"].(string)
+					filter.Language, _ = p.Args["language"].(string)
+					filter.Tag, filter.Language = strings.ToLower(filter.Tag), strings.ToLower(filter.Language)
+					return app.resolveSnippets(p, filter)
+				},
+			},
+			"user": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{
+					"username": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: app.resolveUserByUsername,
+			},
+			"me": &graphql.Field{
+				Type:        userType,
+				Description: "The user whose API token was sent, or null without one.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					gr := graphQLFrom(p.Context)
+					if gr.user.IsAnonymous() {
+						return nil, nil
+					}
+					return gr.user, nil
+				},
+			},
+			"tag": &graphql.Field{
+				Type: tagType,
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					name := strings.ToLower(strings.TrimSpace(p.Args["name"].(string)))
+					if !tagRX.MatchString(name) {
+						return nil, nil
+					}
+					return name, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+// graphQLConnection returns the connection type, and its edge type, for a
+// list of nodes. The node type is returned by a function, since it usually
+// refers back to the connection, and so doesn't exist yet.
+func graphQLConnection(name string, node func() *graphql.Object, pageInfoType *graphql.Object) *graphql.Object {
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: name + "Edge",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"cursor": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.String),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return p.Source.(graphQLEdge).cursor, nil
+					},
+				},
+				"node": &graphql.Field{
+					Type: graphql.NewNonNull(node()),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return p.Source.(graphQLEdge).node, nil
+					},
+				},
+			}
+		}),
+	})
+
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: name + "Connection",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"edges": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edgeType))),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						page := p.Source.(*graphQLPage)
+						edges := make([]graphQLEdge, len(page.nodes))
+						for i, n := range page.nodes {
+							edges[i] = graphQLEdge{cursor: encodeCursor(page.offset + i), node: n}
+						}
+						return edges, nil
+					},
+				},
+				"nodes": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(node()))),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return p.Source.(*graphQLPage).nodes, nil
+					},
+				},
+				"pageInfo": &graphql.Field{
+					Type: graphql.NewNonNull(pageInfoType),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return p.Source, nil
+					},
+				},
+				"totalCount": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.Int),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return p.Source.(*graphQLPage).total, nil
+					},
+				},
+			}
+		}),
+	})
+}
+
+// nullIfEmpty returns nil for an empty string, for optional fields which
+// are stored as "" when they're not set.
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullIfZero is nullIfEmpty for IDs.
+func nullIfZero(id int) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// The resolveSnippet method looks up the snippet with the id argument, if
+// the user can see it.
+func (app *application) resolveSnippet(p graphql.ResolveParams) (any, error) {
+	gr := graphQLFrom(p.Context)
+
+	id, err := strconv.Atoi(p.Args["id"].(string))
+	if err != nil || id < 1 {
+		return nil, nil
+	}
+
+	snippet, err := app.snippets.GetForUser(p.Context, id, gr.user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil, nil
+		}
+		return nil, app.graphQLServerError(gr, err)
+	}
+
+	err = app.snippets.LoadTags(snippet)
+	if err != nil {
+		return nil, app.graphQLServerError(gr, err)
+	}
+
+	return snippet, nil
+}
+
+// The resolveSnippets method returns a page of the public snippets which
+// match the filter, for a connection field. List loads the snippets' tags
+// along with them.
+func (app *application) resolveSnippets(p graphql.ResolveParams, filter models.SnippetFilter) (any, error) {
+	gr := graphQLFrom(p.Context)
+
+	offset, limit, err := readPageArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := models.Filters{
+		Page:         1,
+		PageSize:     limit,
+		Offset:       offset,
+		Sort:         "-created",
+		SortSafelist: []string{"-created"},
+	}
+
+	snippets, metadata, err := app.snippets.List(p.Context, filter, filters)
+	if err != nil {
+		return nil, app.graphQLServerError(gr, err)
+	}
+
+	page := &graphQLPage{offset: offset, total: metadata.TotalRecords}
+	for _, s := range snippets {
+		page.nodes = append(page.nodes, s)
+	}
+	return page, nil
+}
+
+// The resolveSnippetContent method hides the content of a snippet which is
+// protected by a passphrase, like redactProtected does for the JSON API.
+func (app *application) resolveSnippetContent(p graphql.ResolveParams) (any, error) {
+	snippet := p.Source.(*models.Snippet)
+	if snippet.Protected && !app.canEdit(graphQLFrom(p.Context).user, snippet) {
+		return nil, nil
+	}
+	return snippet.Content, nil
+}
+
+// The resolveUser method returns the user with the given ID through the
+// users loader, so that the authors of all the snippets or comments in a
+// list are looked up together.
+func (app *application) resolveUser(p graphql.ResolveParams, id int) (any, error) {
+	if id == 0 {
+		return nil, nil
+	}
+
+	gr := graphQLFrom(p.Context)
+	load := gr.users.Load(id)
+
+	return func() (any, error) {
+		user, err := load()
+		if err != nil {
+			return nil, app.graphQLServerError(gr, err)
+		}
+		return user, nil
+	}, nil
+}
+
+// The resolveUserByUsername method looks up the user with the username
+// argument.
+func (app *application) resolveUserByUsername(p graphql.ResolveParams) (any, error) {
+	user, err := app.users.GetByUsername(p.Args["username"].(string))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil, nil
+		}
+		return nil, app.graphQLServerError(graphQLFrom(p.Context), err)
+	}
+	return user, nil
+}
+
+// The resolveCommentCount method counts a snippet's comments through the
+// comment counts loader. The comments on a snippet which is protected by a
+// passphrase aren't counted, as they aren't listed either.
+func (app *application) resolveCommentCount(p graphql.ResolveParams) (any, error) {
+	gr := graphQLFrom(p.Context)
+	snippet := p.Source.(*models.Snippet)
+	if snippet.Protected && !app.canEdit(gr.user, snippet) {
+		return 0, nil
+	}
+	load := gr.commentCounts.Load(snippet.ID)
+
+	return func() (any, error) {
+		n, err := load()
+		if err != nil {
+			return nil, app.graphQLServerError(gr, err)
+		}
+		return n, nil
+	}, nil
+}
+
+// The resolveComments method returns a page of a snippet's comments through
+// the comments loader, which fetches the same page of every snippet in a
+// list at once. The total comes from the comment counts loader. Like the
+// web view, which keeps them behind the unlock page, it doesn't show the
+// comments on a snippet which is protected by a passphrase to anyone but
+// the people who can edit it.
+func (app *application) resolveComments(p graphql.ResolveParams) (any, error) {
+	gr := graphQLFrom(p.Context)
+	snippet := p.Source.(*models.Snippet)
+
+	offset, limit, err := readPageArgs(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	if snippet.Protected && !app.canEdit(gr.user, snippet) {
+		return &graphQLPage{offset: offset}, nil
+	}
+
+	loadComments := gr.comments.Load(commentPageKey{snippet.ID, commentPage{offset, limit}})
+	loadCount := gr.commentCounts.Load(snippet.ID)
+
+	return func() (any, error) {
+		comments, err := loadComments()
+		if err != nil {
+			return nil, app.graphQLServerError(gr, err)
+		}
+		total, err := loadCount()
+		if err != nil {
+			return nil, app.graphQLServerError(gr, err)
+		}
+
+		page := &graphQLPage{offset: offset, total: total}
+		for _, c := range comments {
+			page.nodes = append(page.nodes, c)
+		}
+		return page, nil
+	}, nil
+}
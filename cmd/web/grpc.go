@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"snippetbox.floccinau.net/internal/errreport"
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/pubsub"
+	"snippetbox.floccinau.net/internal/secrets"
+	"snippetbox.floccinau.net/internal/snippetboxv1"
+	"snippetbox.floccinau.net/internal/validator"
+)
+
+// grpcServer adapts a *grpc.Server to the streamService interface. Like
+// http.Server, Serve returns http.ErrServerClosed once Shutdown has been
+// called.
+type grpcServer struct {
+	*grpc.Server
+}
+
+func (s grpcServer) Serve(ln net.Listener) error {
+	err := s.Server.Serve(ln)
+	if err == nil || errors.Is(err, grpc.ErrServerStopped) {
+		return http.ErrServerClosed
+	}
+	return err
+}
+
+// Shutdown stops taking calls and waits for those in progress to finish.
+// Any which are still going when ctx is done are cut off.
+func (s grpcServer) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// The newGRPCServer method returns the gRPC server, using the certificate
+// and key in the given files. Links to snippets start with baseURL, or are
+// left out if it's empty.
+//
+// With -grpc-addr set, the snippetbox.v1 SnippetService is served over gRPC
+// on its own port, for internal services which would rather use gRPC than
+// the JSON API. It works on the same models, and takes the same API tokens,
+// sent as "authorization: Bearer <token>" metadata. It's only ever served
+// over TLS, since the tokens are sent with every call.
+func (app *application) newGRPCServer(certFile, keyFile, baseURL string) (*grpc.Server, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// gRPC only speaks HTTP/2.
+	cfg := tlsConfig()
+	cfg.Certificates = []tls.Certificate{cert}
+	cfg.NextProtos = []string{"h2"}
+
+	srv := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(cfg)),
+		grpc.UnaryInterceptor(app.grpcUnary),
+		grpc.StreamInterceptor(app.grpcStream),
+	)
+	snippetboxv1.RegisterSnippetServiceServer(srv, &snippetService{app: app, baseURL: baseURL})
+
+	return srv, nil
+}
+
+// The grpcUnary method is the interceptor which every unary call goes
+// through. It authenticates the call, and recovers from panics, which would
+// otherwise take the whole server down.
+func (app *application) grpcUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer app.grpcRecover(&err)
+
+	ctx, err = app.grpcAuthenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// The grpcStream method is grpcUnary for streaming calls.
+func (app *application) grpcStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer app.grpcRecover(&err)
+
+	ctx, err := app.grpcAuthenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, authenticatedStream{ss, ctx})
+}
+
+// authenticatedStream is a stream whose context has the user who made the
+// call.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// The grpcRecover helper turns a panic in a call into an Internal error,
+// logging and reporting it like recoverPanic does. It must be deferred.
+func (app *application) grpcRecover(err *error) {
+	if p := recover(); p != nil {
+		*err = app.grpcServerError(fmt.Errorf("%v", p))
+	}
+}
+
+// The grpcServerError helper is the gRPC counterpart of
+// serverErrorResponse: it logs the error and stack trace, reports the
+// error, and returns an Internal error for the client.
+func (app *application) grpcServerError(err error) error {
+	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
+	app.errorLog.Output(2, trace)
+	app.reportError(nil, err, "error", errreport.Callers(1))
+
+	return status.Error(codes.Internal, "the server encountered a problem and could not process your request")
+}
+
+// grpcFailedValidation returns an InvalidArgument error for the problems
+// found with a request, naming each field in a BadRequest detail. They're
+// in the message too, for clients which don't read the details.
+func grpcFailedValidation(problems map[string]string) error {
+	var msgs []string
+	details := &errdetails.BadRequest{}
+	for _, field := range slices.Sorted(maps.Keys(problems)) {
+		msgs = append(msgs, field+" "+problems[field])
+		details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: problems[field],
+		})
+	}
+
+	st := status.New(codes.InvalidArgument, strings.Join(msgs, "; "))
+	if withDetails, err := st.WithDetails(details); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+var (
+	errGRPCNotFound     = status.Error(codes.NotFound, "the requested resource could not be found")
+	errGRPCInvalidToken = status.Error(codes.Unauthenticated, "invalid or missing authentication token")
+)
+
+// The grpcAuthenticate method finds the user whose API token is in the
+// metadata of a call to method, and returns a context with the user in it.
+// CreateSnippet needs a token with the write scope, and the other methods
+// the read scope.
+func (app *application) grpcAuthenticate(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) != 1 {
+		return nil, errGRPCInvalidToken
+	}
+
+	// Tokens are always 26 characters long, so there's no point hitting the
+	// database for anything else.
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok || len(token) != 26 {
+		return nil, errGRPCInvalidToken
+	}
+
+	user, t, err := app.users.GetForToken(models.ScopeAuthentication, token)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil, errGRPCInvalidToken
+		}
+		return nil, app.grpcServerError(err)
+	}
+
+	scope := models.APIScopeRead
+	if method == snippetboxv1.SnippetService_CreateSnippet_FullMethodName {
+		scope = models.APIScopeWrite
+	}
+	if !t.HasScope(scope) {
+		return nil, status.Errorf(codes.PermissionDenied, "this token doesn't have the %s scope", scope)
+	}
+
+	err = app.loadPermissions(user)
+	if err != nil {
+		return nil, app.grpcServerError(err)
+	}
+
+	app.background(func() {
+		if err := app.tokens.Touch(t.ID); err != nil {
+			app.errorLog.Print(err)
+		}
+	})
+
+	return context.WithValue(ctx, userContextKey, user), nil
+}
+
+// grpcUser returns the user who made a call, which grpcAuthenticate put in
+// its context.
+func grpcUser(ctx context.Context) *models.User {
+	user, ok := ctx.Value(userContextKey).(*models.User)
+	if !ok {
+		panic("missing user value in call context")
+	}
+	return user
+}
+
+// grpcClientIP returns the IP address a call came from.
+func grpcClientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	addr := p.Addr.String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// snippetService implements snippetbox.v1.SnippetService.
+type snippetService struct {
+	snippetboxv1.UnimplementedSnippetServiceServer
+
+	app     *application
+	baseURL string
+}
+
+// snippetMessage returns a snippet as a message for user, hiding the
+// content of a snippet protected by a passphrase unless they can edit it.
+func (s *snippetService) snippetMessage(user *models.User, snippet *models.Snippet) *snippetboxv1.Snippet {
+	m := &snippetboxv1.Snippet{
+		Id:         int64(snippet.ID),
+		Title:      snippet.Title,
+		Content:    snippet.Content,
+		Language:   snippet.Language,
+		Tags:       snippet.Tags,
+		Created:    timestamppb.New(snippet.Created),
+		Expires:    timestamppb.New(snippet.Expires),
+		UserId:     int64(snippet.UserID),
+		ForkedFrom: int64(snippet.ForkedFrom),
+		Protected:  snippet.Protected,
+		Version:    int32(snippet.Version),
+	}
+	if snippet.Protected && !s.app.canEdit(user, snippet) {
+		m.Content = ""
+	}
+	if s.baseURL != "" {
+		m.Url = fmt.Sprintf("%s/snippet/view/%d", s.baseURL, snippet.ID)
+	}
+	return m
+}
+
+// CreateSnippet creates a public snippet, checked and moderated the same way
+// as one created through the JSON API.
+func (s *snippetService) CreateSnippet(ctx context.Context, req *snippetboxv1.CreateSnippetRequest) (*snippetboxv1.CreateSnippetResponse, error) {
+	app := s.app
+	user := grpcUser(ctx)
+
+	if !user.Can(models.PermissionSnippetsWrite) {
+		return nil, status.Error(codes.PermissionDenied, "your user account doesn't have the necessary permissions to access this resource")
+	}
+	if app.maintenance.Load() {
+		return nil, status.Error(codes.Unavailable, "the site is in read-only maintenance mode, please try again later")
+	}
+
+	ip := grpcClientIP(ctx)
+
+	checked, v := app.checkNewSnippet(apiSnippetInput{
+		Title:    req.Title,
+		Content:  req.Content,
+		Language: req.Language,
+		Tags:     req.Tags,
+		Expires:  int(req.Expires),
+	})
+	if checked.scan.Has(secrets.Block) {
+		app.recordSecretsFrom(0, user.ID, ip, checked.scan)
+	}
+	if !v.Valid() {
+		return nil, grpcFailedValidation(v.FieldErrors)
+	}
+
+	heldReason := app.moderateFor(ctx, user, ip, checked.Title, checked.Content)
+
+	id, err := app.snippets.Insert(ctx, checked.Title, checked.Content, checked.Expires, user.ID, 0, "", checked.Language, heldReason, time.Time{}, checked.Tags)
+	if err != nil {
+		return nil, app.grpcServerError(err)
+	}
+	app.recordSecretsFrom(id, user.ID, ip, checked.scan)
+
+	resp := &snippetboxv1.CreateSnippetResponse{Id: int64(id), Warning: checked.warning()}
+
+	// A held snippet can't be read back until a moderator approves it.
+	if heldReason != "" {
+		resp.Held = true
+		return resp, nil
+	}
+
+	snippet, err := app.snippets.Get(ctx, id)
+	if err == nil {
+		err = app.snippets.LoadTags(snippet)
+	}
+	if err != nil {
+		return nil, app.grpcServerError(err)
+	}
+
+	app.notifySnippet(models.EventSnippetCreated, snippet)
+	app.announceSnippet(id)
+
+	resp.Snippet = s.snippetMessage(user, snippet)
+	return resp, nil
+}
+
+// GetSnippet returns a snippet which the caller can see.
+func (s *snippetService) GetSnippet(ctx context.Context, req *snippetboxv1.GetSnippetRequest) (*snippetboxv1.Snippet, error) {
+	app := s.app
+	user := grpcUser(ctx)
+
+	if req.Id < 1 {
+		return nil, errGRPCNotFound
+	}
+
+	snippet, err := app.snippets.GetForUser(ctx, int(req.Id), user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil, errGRPCNotFound
+		}
+		return nil, app.grpcServerError(err)
+	}
+
+	err = app.snippets.LoadTags(snippet)
+	if err != nil {
+		return nil, app.grpcServerError(err)
+	}
+
+	return s.snippetMessage(user, snippet), nil
+}
+
+// ListSnippets returns a page of unexpired snippets, newest first. Its page
+// tokens are the same cursors as the JSON API's, so that later pages pick up
+// where the last one ended rather than counting their way there.
+func (s *snippetService) ListSnippets(ctx context.Context, req *snippetboxv1.ListSnippetsRequest) (*snippetboxv1.ListSnippetsResponse, error) {
+	app := s.app
+	user := grpcUser(ctx)
+
+	var v validator.Validator
+
+	pageSize := int(req.PageSize)
+	if pageSize == 0 {
+		pageSize = 20
+	}
+	v.Check(pageSize >= 1 && pageSize <= models.MaxPageSize, "page_size", fmt.Sprintf("must be between 1 and %d", models.MaxPageSize))
+
+	var after models.Cursor
+	if req.PageToken != "" {
+		var err error
+		after, err = models.ParseCursor(req.PageToken)
+		v.Check(err == nil, "page_token", "must be a next_page_token from this list")
+	}
+
+	v.Check(req.UserId >= 0, "user_id", "must be a positive integer")
+
+	if !v.Valid() {
+		return nil, grpcFailedValidation(v.FieldErrors)
+	}
+
+	filter := models.SnippetFilter{
+		Tag:      strings.ToLower(req.Tag),
+		Language: strings.ToLower(req.Language),
+		UserID:   int(req.UserId),
+	}
+	filters := models.Filters{
+		Page:         1,
+		PageSize:     pageSize,
+		After:        after,
+		Sort:         "-created",
+		SortSafelist: []string{"-created"},
+	}
+
+	snippets, metadata, err := app.snippets.List(ctx, filter, filters)
+	if err != nil {
+		return nil, app.grpcServerError(err)
+	}
+
+	resp := &snippetboxv1.ListSnippetsResponse{
+		NextPageToken: metadata.NextCursor,
+		TotalSize:     int32(metadata.TotalRecords),
+	}
+	for _, snippet := range snippets {
+		resp.Snippets = append(resp.Snippets, s.snippetMessage(user, snippet))
+	}
+
+	return resp, nil
+}
+
+// WatchSnippets streams the snippets announced on the /events stream, with
+// their content, until the client goes away. Clients which can't keep up
+// are disconnected, like they are from /events.
+func (s *snippetService) WatchSnippets(req *snippetboxv1.WatchSnippetsRequest, stream grpc.ServerStreamingServer[snippetboxv1.Snippet]) error {
+	app := s.app
+	ctx := stream.Context()
+	user := grpcUser(ctx)
+
+	sub, err := app.events.Subscribe(newSnippetsTopic)
+	if err != nil {
+		if errors.Is(err, pubsub.ErrTooManySubscribers) || errors.Is(err, pubsub.ErrClosed) {
+			return status.Error(codes.Unavailable, "too many clients are watching for snippets, please try again later")
+		}
+		return app.grpcServerError(err)
+	}
+	defer sub.Close()
+
+	tag, language := strings.ToLower(req.Tag), strings.ToLower(req.Language)
+
+	for {
+		select {
+		case msg, ok := <-sub.C():
+			if !ok {
+				if sub.Evicted() {
+					app.infoLog.Printf("Disconnected slow gRPC watcher %s", grpcClientIP(ctx))
+					return status.Error(codes.ResourceExhausted, "the client fell too far behind")
+				}
+				return status.Error(codes.Unavailable, "the server is shutting down")
+			}
+
+			id, err := strconv.Atoi(msg.ID)
+			if err != nil {
+				continue
+			}
+
+			// The snippet may have been deleted since it was announced.
+			snippet, err := app.snippets.Get(stream.Context(), id)
+			if err == nil {
+				err = app.snippets.LoadTags(snippet)
+			}
+			if errors.Is(err, models.ErrNoRecord) {
+				continue
+			} else if err != nil {
+				return app.grpcServerError(err)
+			}
+
+			if tag != "" && !slices.Contains(snippet.Tags, tag) {
+				continue
+			}
+			if language != "" && snippet.Language != language {
+				continue
+			}
+
+			err = stream.Send(s.snippetMessage(user, snippet))
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
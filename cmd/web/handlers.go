@@ -3,14 +3,21 @@ package main
 import (
 	"errors"
 	"fmt"
-
-	//"html/template"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"snippetbox.floccinau.net/internal/diff"
 	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/secrets"
+	"snippetbox.floccinau.net/internal/validator"
 )
 
+// homePageSize is how many snippets are listed on each page of the home
+// page.
+const homePageSize = 10
+
 // Chapter 3.3: Dependency injection |
 // Change the signature of the home handler do it is defined as a method against
 // *application
@@ -20,52 +27,75 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Logged-in users see the latest snippets from the people they follow,
+	// or everyone's if there aren't any. Everyone's can be paged back through
+	// with cursors, from the links under them.
+	var snippets []*models.Snippet
+	var cursors models.CursorPage
+	var err error
+	feed := false
+
+	k := app.keysetParam(r, homePageSize)
+	paging := !k.Before.IsZero() || !k.After.IsZero()
+
+	if user := app.currentUser(r); user != nil && !paging {
+		snippets, err = app.follows.Feed(r.Context(), user.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		feed = len(snippets) > 0
+	}
+
 	// Chapter 4.8: Multiple-record SQL queries |
-	snippets, err := app.snippets.Latest()
-	if err != nil {
-		app.serverError(w, err)
-		return
-	}
-	// Chapter 4.8: Multiple-record SQL queries
-	for _, snippet := range snippets {
-		fmt.Fprintf(w, "%+v\n", snippet)
-	}
-
-	// Initialize a slice containing the paths to the two files. It's important
-	// to note that the file containing our base template must be the *first*
-	// file in the slice.
-	//files := []string{
-	//	"./ui/html/base.tmpl.html",
-	//	"./ui/html/partials/nav.tmpl.html",
-	//	"./ui/html/pages/home.tmpl.html",
-	//}
-
-	// Use the template.ParseFiles() function to read the files and store the
-	// templates in a template set. Notice that we can pass the slice of file
-	// paths as a variadic parameter?
-	//ts, err := template.ParseFiles(files...)
-	//if err != nil {
-	// Chapter 3.3: Dependency injection |
-	// Because the home handler function is now a method against application
-	// it can access its fields, including the error logger. We'll write the log
-	// message to this instead of the standart logger.
-	// app.errorLog.Println(err.Error())
-	// Chapter 3.4: Cenralized error handling |
-	// Use the serverError() helper
-	//	app.serverError(w, err)
-	//	return
-	//}
-
-	// Use the ExecuteTemplate() method to write the content of the "base"
-	// template as the response body.
-	//err = ts.ExecuteTemplate(w, "base", nil)
-	//if err != nil {
-	//	app.serverError(w, err)
-	//}
+	// The first page comes from the same query as the rest, so that its
+	// Older cursor carries on exactly where it stops.
+	if paging || !feed {
+		cursors, err = app.snippets.Recent(r.Context(), k)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		snippets = cursors.Snippets
+	}
+
+	// Everyone sees the snippets which admins have pinned to the home page.
+	announcements, err := app.snippets.Announcements()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	ids := snippetIDs(snippets)
+
+	counts, err := app.comments.Counts(ids)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	starCounts, err := app.stars.Counts(ids)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Render the home page from the template cache, passing in the latest
+	// snippets alongside the common template data.
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.CommentCounts = counts
+	data.StarCounts = starCounts
+	data.Feed = feed
+	data.SnippetCursors = newCursorInfo(cursors)
+	data.Announcements = announcements
+
+	app.render(w, http.StatusOK, "home.tmpl.html", data)
 }
 
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	// The snippet ID is now part of the URL path, e.g. /snippet/view/5.
+	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil || id < 1 {
 		app.notFound(w)
 		return
@@ -75,44 +105,1322 @@ func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 	// Use the SnippetModel object's Get method to retrieve the data for a
 	// specific record based on its ID. If no matching record is found,
 	// return a 404 Not Found response.
-	snippet, err := app.snippets.Get(id)
+	// Snippets which are scheduled to be published later can be previewed
+	// by the people who could edit them, and snippets which belong to an
+	// organization can only be seen by its members.
+	snippet, err := app.snippets.GetForUser(r.Context(), id, app.contextGetUser(r).ID)
+	if errors.Is(err, models.ErrNoRecord) {
+		snippet, err = app.scheduledSnippet(r, id)
+	}
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
 			app.notFound(w)
 		} else {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
 		}
 		return
 	}
 
-	// Chapter 4.7: Single-record SQL queries |
-	// Write a snippet data as a plain-text HTTP response body.
-	fmt.Fprintf(w, "%+v", snippet)
+	// Views of protected snippets only count once they're unlocked, and
+	// previews of scheduled ones don't count at all.
+	if !app.snippetLocked(r, snippet) && !snippet.PublishAt.After(time.Now()) {
+		app.recordView(r, snippet.ID)
+	}
+
+	app.renderSnippetView(w, r, http.StatusOK, snippet, commentForm{})
+}
+
+// The renderSnippetView helper renders the snippet view page, including the
+// requested page of comments and the (possibly invalid) comment form.
+func (app *application) renderSnippetView(w http.ResponseWriter, r *http.Request, status int, snippet *models.Snippet, form commentForm) {
+	// Protected snippets ask for their passphrase instead.
+	if app.snippetLocked(r, snippet) {
+		app.renderUnlock(w, r, http.StatusOK, snippet, snippetUnlockForm{})
+		return
+	}
+
+	page := app.pageParam(r)
+
+	comments, total, err := app.comments.ListBySnippet(snippet.ID, page, commentsPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	stars, err := app.stars.Count(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	views, err := app.snippets.ViewCount(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	forks, err := app.snippets.ForksOf(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	related, err := app.relatedSnippets(r.Context(), snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	attachments, err := app.attachmentLinks(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.snippets.LoadTags(snippet)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Forks = forks
+	data.Related = related
+	data.Attachments = attachments
+	data.MaxUploadSize = app.maxUploadSize
+	data.Comments = comments
+	data.CommentPages = newPageInfo(page, commentsPageSize, total)
+	data.StarCount = stars
+	data.ViewCount = views
+	data.CanEdit = app.canEdit(data.User, snippet)
+	data.Scheduled = snippet.PublishAt.After(time.Now())
+	data.Form = form
+	data.Meta = newSnippetMeta(data.BaseURL, snippet)
+	data.ReportReasons = models.ReportReasons
+
+	if data.User != nil {
+		data.Starred, err = app.stars.IsStarred(data.User.ID, snippet.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data.Collections, err = app.collections.ForUser(data.User.ID, true)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		data.Collected, err = app.collections.Containing(data.User.ID, snippet.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	app.render(w, status, "view.tmpl.html", data)
+}
+
+// Define a snippetCreateForm struct to represent the form data and validation
+// errors for the form fields. Note that all the struct fields are deliberately
+// exported (i.e. start with a capital letter). This is because struct fields
+// must be exported in order to be read by the html/template package when
+// rendering the template.
+type snippetCreateForm struct {
+	Title            string
+	Content          string
+	Expires          int
+	BurnAfterReading bool
+	Passphrase       string
+	Language         string
+	Tags             string
+	// AllowDuplicate is set when the author has been shown Duplicate, a
+	// public snippet with the same content, and wants to publish theirs
+	// anyway.
+	AllowDuplicate bool
+	Duplicate      *models.Snippet
+	// AllowSecrets is set when the author has been shown Secrets, the
+	// things in the content which look like passwords or tokens, and wants
+	// to publish it anyway.
+	AllowSecrets bool
+	Secrets      []string
+	// PublishAt is the time to publish the snippet at, as sent by a
+	// datetime-local input, or empty to publish it now.
+	PublishAt string
+	// OrgID is the organization the snippet goes in, or 0 for the author's
+	// personal workspace.
+	OrgID int
+	validator.Validator
 }
 
 func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.Header().Set("Allow", http.MethodPost)
-		app.clientError(w, http.StatusMethodNotAllowed)
+	// Initialize a new snippetCreateForm instance and pass it to the template.
+	// Notice how this is also a great opportunity to set any default or
+	// 'initial' values for the form --- here we set the initial value for the
+	// snippet expiry to 365 days.
+	form := snippetCreateForm{
+		Expires: 365,
+	}
+
+	// Anonymous snippets can't be kept for a year.
+	if !app.isAuthenticated(r) {
+		form.Expires = 7
+	}
+
+	// New snippets go in the workspace the author is working in, unless
+	// they choose another. The form only offers the organizations they're
+	// a member of, so one they've left falls back to their own.
+	form.OrgID = app.sessionManager.GetInt(r.Context(), "orgID")
+
+	app.renderCreate(w, r, http.StatusOK, form)
+}
+
+// The renderCreate helper shows the create form. Visitors without an account
+// get a new challenge to answer with each form.
+func (app *application) renderCreate(w http.ResponseWriter, r *http.Request, status int, form snippetCreateForm) {
+	data := app.newTemplateData(r)
+	data.Form = form
+
+	if !data.IsAuthenticated {
+		var err error
+		data.Challenge, err = app.issueChallenge(w, r, app.anonymous.challenge)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	app.render(w, status, "create.tmpl.html", data)
+}
+
+func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
+	// First we call r.ParseForm() which adds any data in POST request bodies
+	// to the r.PostForm map.
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	// Chapter 4.6: Executing SQL statements |
-	// Create some variables holding dummy data. We'll remove these later on
-	// during the build.
-	title := "O snail"
-	content := "O snail\nClimb Mount Fuji,\nBut slowly, slowly!\n\n- Kobayashi Issa"
-	expires := 7
+	// The r.PostForm.Get() method always returns the form data as a *string*.
+	// However, we're expecting our expires value to be a number, and want to
+	// represent it in our Go code as an integer. So we need to manually convert
+	// the form data to an integer using strconv.Atoi(), and we send a 400 Bad
+	// Request response if the conversion fails.
+	expires, err := strconv.Atoi(r.PostForm.Get("expires"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The workspace is left out of the form when the author has no
+	// organizations.
+	orgID := 0
+	if v := r.PostForm.Get("org"); v != "" {
+		orgID, err = strconv.Atoi(v)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	form := snippetCreateForm{
+		Title:            r.PostForm.Get("title"),
+		Content:          r.PostForm.Get("content"),
+		Expires:          expires,
+		BurnAfterReading: r.PostForm.Get("burn") == "true",
+		Passphrase:       r.PostForm.Get("passphrase"),
+		Language:         r.PostForm.Get("language"),
+		Tags:             r.PostForm.Get("tags"),
+		AllowDuplicate:   r.PostForm.Get("duplicate") == "true",
+		AllowSecrets:     r.PostForm.Get("secrets") == "true",
+		PublishAt:        r.PostForm.Get("publish_at"),
+		OrgID:            orgID,
+	}
+
+	// The title and content are normalized, and any characters which could
+	// disguise what they say are removed, before they're checked.
+	var cleaned bool
+	form.Title, form.Content, cleaned = cleanSnippetText(form.Title, form.Content)
+	app.warnCleaned(r, cleaned)
+
+	// Each check adds an error message to the form's FieldErrors map if it
+	// fails. Only the first failing check for a field is kept.
+	form.Check(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.Check(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.Check(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.Check(validator.MaxBytes(form.Content, app.maxSnippetSize), "content", "This field cannot be more than "+humanBytes(app.maxSnippetSize)+" long")
+	user := app.contextGetUser(r)
+	if user.IsAnonymous() {
+		form.Check(validator.PermittedValue(form.Expires, anonymousExpiryDays...), "expires", "Snippets posted without an account must expire within a week")
+	} else {
+		form.Check(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	}
+	if form.Passphrase != "" {
+		form.Check(!form.BurnAfterReading, "passphrase", "Burn-after-reading snippets can't also have a passphrase")
+		form.Check(validator.MinChars(form.Passphrase, 8), "passphrase", "This field must be at least 8 characters long")
+	}
+
+	language, ok := normalizeLanguage(form.Language)
+	form.Check(ok, "language", "Language names can only contain letters, numbers and + # . - and be up to 32 characters long")
+	tags, msg := parseTags(form.Tags)
+	form.Check(msg == "", "tags", msg)
+
+	// Only snippets with an owner can be scheduled, since nobody else could
+	// see them before they're published.
+	publishAt, err := parsePublishAt(form.PublishAt, app.timeZone(r))
+	form.Check(err == nil, "publish_at", "This isn't a date and time we understand")
+	if !publishAt.IsZero() {
+		form.Check(!user.IsAnonymous(), "publish_at", "Log in to schedule snippets")
+		form.Check(!form.BurnAfterReading, "publish_at", "Burn-after-reading snippets can't be scheduled")
+		form.Check(publishAt.After(time.Now()), "publish_at", "This must be in the future")
+		form.Check(publishAt.Before(time.Now().AddDate(0, 0, form.Expires)), "publish_at", "This must be before the snippet expires")
+	}
+
+	// Only members can put snippets in an organization.
+	if form.OrgID != 0 {
+		form.Check(!form.BurnAfterReading, "org", "Burn-after-reading snippets can't go in an organization")
+		_, err := app.orgs.Role(form.OrgID, user.ID)
+		if errors.Is(err, models.ErrNoRecord) {
+			form.AddError("org", "You aren't a member of this organization")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	// Secrets which can't be anything else are refused or redacted.
+	scan := app.scanSecrets(form.Content)
+	if scan.Has(secrets.Block) {
+		form.AddError("content", secretsBlockedMessage)
+		app.recordSecrets(r, 0, scan)
+	} else {
+		form.Content = scan.Text
+	}
+
+	if user.IsAnonymous() {
+		err := app.anonymous.challenge.Verify(r)
+		switch {
+		case errors.Is(err, errCaptchaFailed):
+			form.AddNonFieldError("Please complete the CAPTCHA.")
+		case errors.Is(err, errChallengeFailed):
+			form.AddNonFieldError("Please let the page check your browser before publishing (this needs JavaScript), or log in.")
+		case err != nil:
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	// If there are any validation errors, then re-display the create.tmpl.html
+	// template, passing in the snippetCreateForm instance as dynamic data in
+	// the Form field. Note that we use the HTTP status code 422 Unprocessable
+	// Entity when sending the response to indicate that there was a
+	// validation error.
+	if !form.Valid() {
+		// Don't send the passphrase back to the browser.
+		form.Passphrase = ""
+
+		app.renderCreate(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	// Ask the author to check anything which only might be a secret,
+	// unless they already have.
+	if warnings := scan.Descriptions(secrets.Warn); len(warnings) > 0 && !form.AllowSecrets {
+		form.Secrets = warnings
+		form.Passphrase = ""
+		app.renderCreate(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	// Point the author at any public snippet which already has the same
+	// content, unless they've said to go ahead. Private snippets and
+	// organizations' snippets aren't checked, since nobody else could find
+	// them anyway.
+	if !form.AllowDuplicate && !form.BurnAfterReading && form.Passphrase == "" && form.OrgID == 0 {
+		duplicate, err := app.snippets.FindDuplicate(form.Content)
+		if err == nil {
+			form.Duplicate = duplicate
+			app.renderCreate(w, r, http.StatusUnprocessableEntity, form)
+			return
+		} else if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	// Each IP address can only post a few snippets without an account, and
+	// fewer, or none, from some countries.
+	if user.IsAnonymous() {
+		country := app.clientCountry(r)
+		if app.geoIP.blocks(country) {
+			form.Passphrase = ""
+			form.AddNonFieldError(anonymousBlockedMessage)
+			app.renderCreate(w, r, http.StatusForbidden, form)
+			return
+		}
+
+		limit := app.geoIP.anonymousLimit(country, app.anonymous.limit)
+		ok, _, reset := app.takeRateLimit(r, "anon-snippet:"+app.clientIP(r), limit, app.anonymous.window)
+		if !ok {
+			retryAfter := time.Until(reset)
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			form.Passphrase = ""
+			form.AddNonFieldError("You've posted too many snippets without an account. Try again in " + humanDuration(retryAfter) + ", or log in.")
+			app.renderCreate(w, r, http.StatusTooManyRequests, form)
+			return
+		}
+	}
+
+	// Anonymous snippets are stored without an owner.
+	userID := user.ID
+
+	// Burn-after-reading snippets are stored separately, and the only way to
+	// read them is the share link, so show it to the user straight away.
+	if form.BurnAfterReading {
+		token, err := app.snippets.InsertOnce(form.Title, form.Content, form.Expires, userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.recordSecrets(r, 0, scan)
+		app.warnSecrets(r, scan)
+		app.renderOnceCreated(w, r, token)
+		return
+	}
 
 	// Chapter 4.6: Executing SQL statements |
 	// Pass the data to the SnippetModel.Insert() method, receiving the
 	// ID of the new record back
+	// Snippets which the moderation checks flag are held for review rather
+	// than published.
+	heldReason := app.moderate(r, form.Title, form.Content)
+
+	id, err := app.snippets.Insert(r.Context(), form.Title, form.Content, form.Expires, userID, form.OrgID, form.Passphrase, language, heldReason, publishAt, tags)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.recordSecrets(r, id, scan)
+	app.warnSecrets(r, scan)
+
+	// A scheduled snippet is announced when it's published, if it's been
+	// approved by then.
+	if !publishAt.IsZero() {
+		err = app.schedulePublish(id, publishAt)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	// Nobody hears about a held snippet until it's approved, and it can't be
+	// viewed yet, so there's nothing to redirect to.
+	if heldReason != "" {
+		app.sessionManager.Put(r.Context(), "flash", "Thanks! Your snippet will be published once a moderator has checked it.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	// Only the author can see a scheduled snippet until it's published, so
+	// it isn't announced yet.
+	if !publishAt.IsZero() {
+		app.sessionManager.Put(r.Context(), "flash", "Snippet scheduled! Only you can see it until it's published.")
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+		return
+	}
+
+	// Organizations' snippets are only for their members, so they aren't
+	// announced or sent to webhooks.
+	if form.OrgID == 0 {
+		app.notifySnippetChange(models.EventSnippetCreated, id)
+		app.announceSnippet(id)
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
+
+// Define a userSignupForm struct to represent and hold the form data and any
+// validation errors for the signup form fields.
+type userSignupForm struct {
+	Name     string
+	Username string
+	Email    string
+	Password string
+	Invite   string
+	validator.Validator
+}
+
+// The userSignup handler shows the signup form. When registration is
+// invite-only, the code comes from the link in the invitation, and it's
+// checked straight away so that nobody fills in the form for nothing.
+func (app *application) userSignup(w http.ResponseWriter, r *http.Request) {
+	// With single sign-on, new users are made the first time they log in.
+	if app.oidc != nil {
+		http.Redirect(w, r, "/auth/oidc/login", http.StatusSeeOther)
+		return
+	}
+
+	if app.registration == registrationClosed {
+		data := app.newTemplateData(r)
+		data.Form = userSignupForm{}
+		app.render(w, http.StatusForbidden, "signup.tmpl.html", data)
+		return
+	}
+
+	form := userSignupForm{}
+	if app.registration == registrationInvite {
+		form.Invite = strings.TrimSpace(r.URL.Query().Get("invite"))
+		if form.Invite != "" {
+			ok, err := app.inviteUsable(form.Invite)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+			form.Check(ok, "invite", invalidInviteMessage)
+		}
+	}
+
+	app.renderSignup(w, r, http.StatusOK, form)
+}
+
+// The renderSignup helper shows the signup form, with a CAPTCHA if the
+// visitor looks like a bot.
+func (app *application) renderSignup(w http.ResponseWriter, r *http.Request, status int, form userSignupForm) {
+	data := app.newTemplateData(r)
+	data.Form = form
+
+	var err error
+	data.Challenge, err = app.issueChallenge(w, r, app.signupChallenge)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, status, "signup.tmpl.html", data)
+}
+
+func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
+	if app.registration == registrationClosed || app.oidc != nil {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := userSignupForm{
+		Name:     r.PostForm.Get("name"),
+		Username: strings.TrimSpace(r.PostForm.Get("username")),
+		Email:    r.PostForm.Get("email"),
+		Password: r.PostForm.Get("password"),
+		Invite:   strings.TrimSpace(r.PostForm.Get("invite")),
+	}
+
+	form.Check(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	checkUsername(&form.Validator, form.Username)
+	form.Check(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.Check(validator.IsEmail(form.Email), "email", "This field must be a valid email address")
+	form.Check(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.Check(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+	if app.registration == registrationInvite {
+		form.Check(validator.NotBlank(form.Invite), "invite", "This field cannot be blank")
+	}
+
+	err = app.signupChallenge.Verify(r)
+	if errors.Is(err, errChallengeFailed) {
+		form.AddNonFieldError("Please complete the CAPTCHA.")
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The invitation is used before the account is made, so that two
+	// people can't both take its last use, and given back if making the
+	// account fails.
+	if form.Valid() && app.registration == registrationInvite {
+		err = app.invites.Use(form.Invite)
+		if errors.Is(err, models.ErrInvalidInvite) {
+			form.AddError("invite", invalidInviteMessage)
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		app.renderSignup(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	id, err := app.users.Insert(form.Name, form.Username, form.Email, form.Password)
+	if err != nil {
+		if app.registration == registrationInvite {
+			if err := app.invites.Release(form.Invite); err != nil {
+				app.errorLog.Print(err)
+			}
+		}
+
+		switch {
+		case errors.Is(err, models.ErrDuplicateEmail):
+			form.AddError("email", "Email address is already in use")
+		case errors.Is(err, models.ErrDuplicateUsername):
+			form.AddError("username", "This username isn't available")
+		default:
+			app.serverError(w, r, err)
+			return
+		}
+
+		app.renderSignup(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	err = app.permissions.AddForUser(id, models.DefaultPermissions...)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, 0, models.EventSignup, form.Email)
+
+	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful. Please log in.")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// Define a userLoginForm struct. The embedded Validator's NonFieldErrors
+// holds errors which aren't related to a specific form field, like bad
+// credentials or a lockout.
+type userLoginForm struct {
+	Email    string
+	Password string
+	Remember bool
+	validator.Validator
+}
+
+func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
+	if app.oidc != nil {
+		http.Redirect(w, r, "/auth/oidc/login", http.StatusSeeOther)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = userLoginForm{}
+	app.render(w, http.StatusOK, "login.tmpl.html", data)
+}
+
+func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
+	if app.oidc != nil {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := userLoginForm{
+		Email:    r.PostForm.Get("email"),
+		Password: r.PostForm.Get("password"),
+		Remember: r.PostForm.Get("remember") == "true",
+	}
+
+	form.Check(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+	form.Check(validator.NotBlank(form.Password), "password", "This field cannot be blank")
 
-	id, err := app.snippets.Insert(title, content, expires)
+	renderForm := func(status int) {
+		form.Password = ""
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, status, "login.tmpl.html", data)
+	}
+
+	if !form.Valid() {
+		renderForm(http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Check the login throttle before going anywhere near the password, so
+	// that a locked account can't be used to test guesses.
+	ip := app.clientIP(r)
+
+	attempt, err := app.beginLogin(form.Email, ip)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	status := attempt.status
+
+	if status.retryAfter > 0 {
+		app.audit(r, 0, models.EventLoginLocked, form.Email)
+		w.Header().Set("Retry-After", strconv.Itoa(int(status.retryAfter/time.Second)))
+		form.AddNonFieldError(status.throttledMessage())
+		renderForm(http.StatusTooManyRequests)
+		return
+	}
+
+	id, err := app.auth.Authenticate(form.Email, form.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			if err := app.finishLogin(attempt, 0, false); err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			form.AddNonFieldError(status.failed().failedMessage())
+			renderForm(http.StatusUnprocessableEntity)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.finishLogin(attempt, id, true); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// logIn() renews the session token before logging the user in. It's
+	// good practice to generate a new session ID when the authentication
+	// state or privilege levels changes for the user (e.g. login and logout
+	// operations).
+	err = app.logIn(r, id)
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("/snippet/view?id=%d", id), http.StatusSeeOther)
+	// If they asked to be remembered, give them a cookie which logs them
+	// back in once the session has expired.
+	if form.Remember {
+		token, err := app.rememberTokens.New(id, rememberTTL)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		err = app.setRememberCookie(w, token)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Remove the authenticatedUserID from the session data so that the user
+	// is 'logged out'.
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+
+	// Forget them too, or the remember-me cookie would log them straight
+	// back in.
+	if selector, _, ok := app.rememberSelector(r); ok {
+		err = app.rememberTokens.Delete(selector)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.clearRememberCookie(w)
+	}
+
+	app.audit(r, user.ID, models.EventLogout, "")
+
+	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// commentsPageSize is the number of comments shown per page on the snippet
+// view page.
+const commentsPageSize = 20
+
+// Define a commentForm struct to hold the comment form data and any
+// validation errors.
+type commentForm struct {
+	Content string
+	validator.Validator
+}
+
+func (app *application) snippetCommentPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.snippets.GetForUser(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// The comments on a protected snippet are only shown once it's been
+	// unlocked, so they can only be added to then too.
+	if app.snippetLocked(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := commentForm{
+		Content: r.PostForm.Get("content"),
+	}
+
+	var cleaned bool
+	form.Content, cleaned = validator.CleanText(form.Content)
+	app.warnCleaned(r, cleaned)
+
+	form.Check(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.Check(validator.MaxChars(form.Content, 2000), "content", "This field cannot be more than 2000 characters long")
+
+	if !form.Valid() {
+		app.renderSnippetView(w, r, http.StatusUnprocessableEntity, snippet, form)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	commentID, err := app.comments.Insert(snippet.ID, user.ID, form.Content)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.broadcastComment(snippet.ID, commentID)
+
+	app.sessionManager.Put(r.Context(), "flash", "Comment added!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d#comments", snippet.ID), http.StatusSeeOther)
+}
+
+func (app *application) commentDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	comment, err := app.comments.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	// Only the author of a comment, or a moderator, is allowed to delete it.
+	err = app.comments.Delete(comment.ID, user)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusForbidden)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.publishToViewers(comment.SnippetID, socketMessage{
+		Type:    "comment.deleted",
+		Comment: &socketComment{ID: comment.ID},
+	})
+
+	app.sessionManager.Put(r.Context(), "flash", "Comment deleted.")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d#comments", comment.SnippetID), http.StatusSeeOther)
+}
+
+// The snippetStarPost handler stars or unstars a snippet for the current
+// user. It's a plain form POST, so it works without JavaScript.
+func (app *application) snippetStarPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.snippets.GetForUser(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// A protected snippet can't be starred before it's been unlocked.
+	if app.snippetLocked(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	_, err = app.stars.Toggle(user.ID, snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// The accountStarred handler lists the snippets the current user has starred.
+func (app *application) accountStarred(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	snippets, err := app.stars.StarredBy(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	starCounts, err := app.stars.Counts(snippetIDs(snippets))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.StarCounts = starCounts
+
+	app.render(w, http.StatusOK, "starred.tmpl.html", data)
+}
+
+// The snippetForkPost handler copies a snippet to the current user and
+// redirects them to their new copy.
+func (app *application) snippetForkPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.snippets.GetForUser(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// The fork would belong to the user, who could then read it without the
+	// passphrase, so protected snippets must be unlocked first.
+	if app.snippetLocked(r, snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	newID, err := app.snippets.Fork(id, user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.notifySnippetChange(models.EventSnippetCreated, newID)
+	app.announceSnippet(newID)
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet forked!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", newID), http.StatusSeeOther)
+}
+
+// Define a snippetEditForm struct to hold the edit form data and any
+// validation errors.
+type snippetEditForm struct {
+	Title    string
+	Content  string
+	Language string
+	Tags     string
+	Version  int
+	validator.Validator
+}
+
+// The canEdit helper reports whether the user may edit (and restore old
+// revisions of) the snippet: its owner, if they can still write snippets,
+// and moderators can.
+func (app *application) canEdit(user *models.User, snippet *models.Snippet) bool {
+	if user == nil || user.IsAnonymous() {
+		return false
+	}
+	if user.Can(models.PermissionAdminModerate) {
+		return true
+	}
+	return user.Can(models.PermissionSnippetsWrite) && snippet.UserID != 0 && snippet.UserID == user.ID
+}
+
+// The editableSnippet helper loads the snippet named in the URL and checks
+// that the current user may edit it. It sends the error response itself and
+// returns nil if not.
+func (app *application) editableSnippet(w http.ResponseWriter, r *http.Request) *models.Snippet {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil
+	}
+
+	snippet, err := app.snippets.GetForUser(r.Context(), id, app.contextGetUser(r).ID)
+	if errors.Is(err, models.ErrNoRecord) {
+		snippet, err = app.scheduledSnippet(r, id)
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil
+	}
+
+	if !app.canEdit(app.contextGetUser(r), snippet) {
+		app.clientError(w, http.StatusForbidden)
+		return nil
+	}
+
+	return snippet
+}
+
+func (app *application) snippetEdit(w http.ResponseWriter, r *http.Request) {
+	snippet := app.editableSnippet(w, r)
+	if snippet == nil {
+		return
+	}
+
+	err := app.snippets.LoadTags(snippet)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Form = snippetEditForm{
+		Title:    snippet.Title,
+		Content:  snippet.Content,
+		Language: snippet.Language,
+		Tags:     strings.Join(snippet.Tags, ", "),
+		Version:  snippet.Version,
+	}
+
+	app.render(w, http.StatusOK, "edit.tmpl.html", data)
+}
+
+func (app *application) snippetEditPost(w http.ResponseWriter, r *http.Request) {
+	snippet := app.editableSnippet(w, r)
+	if snippet == nil {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The version the edit started from is sent back with the form, so that
+	// we can tell if someone else saved a change in the meantime.
+	version, err := strconv.Atoi(r.PostForm.Get("version"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := snippetEditForm{
+		Title:    r.PostForm.Get("title"),
+		Content:  r.PostForm.Get("content"),
+		Language: r.PostForm.Get("language"),
+		Tags:     r.PostForm.Get("tags"),
+		Version:  version,
+	}
+
+	var cleaned bool
+	form.Title, form.Content, cleaned = cleanSnippetText(form.Title, form.Content)
+	app.warnCleaned(r, cleaned)
+
+	form.Check(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+	form.Check(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
+	form.Check(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+	form.Check(validator.MaxBytes(form.Content, app.maxSnippetSize), "content", "This field cannot be more than "+humanBytes(app.maxSnippetSize)+" long")
+
+	language, ok := normalizeLanguage(form.Language)
+	form.Check(ok, "language", "Language names can only contain letters, numbers and + # . - and be up to 32 characters long")
+	tags, msg := parseTags(form.Tags)
+	form.Check(msg == "", "tags", msg)
+
+	scan := app.scanSecrets(form.Content)
+	if scan.Has(secrets.Block) {
+		form.AddError("content", secretsBlockedMessage)
+		app.recordSecrets(r, snippet.ID, scan)
+	} else {
+		form.Content = scan.Text
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Snippet = snippet
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "edit.tmpl.html", data)
+		return
+	}
+
+	err = app.snippets.UpdateWithTags(r.Context(), snippet.ID, app.contextGetUser(r).ID, form.Title, form.Content, language, form.Version, tags)
+	if err != nil {
+		if errors.Is(err, models.ErrEditConflict) {
+			// Keep the user's changes in the form, but base them on the
+			// latest version so that saving again overwrites it.
+			form.AddNonFieldError("Someone else changed this snippet while you were editing it. Check the history, then save again to replace their changes with yours.")
+			form.Version = snippet.Version
+
+			data := app.newTemplateData(r)
+			data.Snippet = snippet
+			data.Form = form
+			app.render(w, http.StatusConflict, "edit.tmpl.html", data)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.recordSecrets(r, snippet.ID, scan)
+	app.warnSecrets(r, scan)
+
+	app.related.invalidate(snippet.ID)
+	app.notifySnippetChange(models.EventSnippetUpdated, snippet.ID)
+	app.broadcastSnippet(snippet.ID)
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet updated!")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// The snippetHistory handler lists the recorded revisions of a snippet.
+func (app *application) snippetHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.snippets.GetForUser(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if app.snippetLocked(r, snippet) {
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+		return
+	}
+
+	revisions, err := app.revisions.List(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Revisions = revisions
+	data.CanEdit = app.canEdit(data.User, snippet)
+
+	app.render(w, http.StatusOK, "history.tmpl.html", data)
+}
+
+// The snippetDiff handler renders a unified diff between two revisions of a
+// snippet, given as the "from" and "to" query string parameters. By default
+// it compares the latest revision with the one before it.
+func (app *application) snippetDiff(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.snippets.GetForUser(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if app.snippetLocked(r, snippet) {
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+		return
+	}
+
+	revisions, err := app.revisions.List(snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if len(revisions) < 2 {
+		app.notFound(w)
+		return
+	}
+
+	qs := r.URL.Query()
+
+	to, err := strconv.Atoi(qs.Get("to"))
+	if err != nil {
+		to = revisions[0].Number
+	}
+	from, err := strconv.Atoi(qs.Get("from"))
+	if err != nil {
+		from = to - 1
+	}
+
+	fromRev, err := app.revisions.Get(snippet.ID, from)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	toRev, err := app.revisions.Get(snippet.ID, to)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+	data.Diff = &revisionDiff{
+		From:         fromRev,
+		To:           toRev,
+		TitleHunks:   diff.Hunks(diff.Lines(fromRev.Title, toRev.Title), 0),
+		ContentHunks: diff.Hunks(diff.Lines(fromRev.Content, toRev.Content), 3),
+	}
+
+	app.render(w, http.StatusOK, "diff.tmpl.html", data)
+}
+
+// The snippetRestorePost handler makes an old revision current again. The
+// restore is itself recorded as a new revision, so nothing is lost.
+func (app *application) snippetRestorePost(w http.ResponseWriter, r *http.Request) {
+	snippet := app.editableSnippet(w, r)
+	if snippet == nil {
+		return
+	}
+
+	number, err := strconv.Atoi(r.PostFormValue("revision"))
+	if err != nil || number < 1 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	rev, err := app.revisions.Get(snippet.ID, number)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Revisions don't record the language, so restoring one keeps the
+	// current language.
+	err = app.snippets.Update(r.Context(), snippet.ID, app.contextGetUser(r).ID, rev.Title, rev.Content, snippet.Language, 0)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.related.invalidate(snippet.ID)
+	app.notifySnippetChange(models.EventSnippetUpdated, snippet.ID)
+	app.broadcastSnippet(snippet.ID)
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Restored revision %d.", rev.Number))
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/history/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// The snippetDeletePost handler deletes a snippet for good. Its owner's
+// webhooks are told which snippet went, but not what was in it.
+func (app *application) snippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	snippet := app.editableSnippet(w, r)
+	if snippet == nil {
+		return
+	}
+
+	err := app.snippets.Delete(snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.related.invalidate(snippet.ID)
+
+	app.notifySnippet(models.EventSnippetDeleted, &models.Snippet{
+		ID:      snippet.ID,
+		Title:   snippet.Title,
+		Created: snippet.Created,
+		Expires: snippet.Expires,
+		UserID:  snippet.UserID,
+		Version: snippet.Version,
+	})
+	app.publishToViewers(snippet.ID, socketMessage{Type: "snippet.deleted"})
+
+	app.sessionManager.Put(r.Context(), "flash", "Snippet deleted.")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models/mocks"
+	"snippetbox.floccinau.net/internal/testutils"
+)
+
+// insertSnippet adds a public snippet to the mocks, expiring in a week, and
+// returns its ID.
+func insertSnippet(t *testing.T, snippets *mocks.SnippetModel, title string, userID int) int {
+	t.Helper()
+
+	id, err := snippets.Insert(context.Background(), title, title+"...", 7, userID, 0, "", "", "", time.Time{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// insertUser adds a user to the mocks and returns their ID.
+func insertUser(t *testing.T, users *mocks.UserModel, name string) int {
+	t.Helper()
+
+	id, err := users.Insert(name, strings.ToLower(name), strings.ToLower(name)+"@example.com", "pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestHome(t *testing.T) {
+	app, m := newTestApplication(t)
+
+	alice := insertUser(t, m.users, "Alice")
+	bob := insertUser(t, m.users, "Bob")
+	insertSnippet(t, m.snippets, "An old silent pond", bob)
+	insertSnippet(t, m.snippets, "Over the wintry forest", alice)
+
+	_, err := m.follows.Toggle(alice, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, app)
+
+	t.Run("Anonymous", func(t *testing.T) {
+		code, _, body := ts.Get(t, "/")
+		if code != http.StatusOK {
+			t.Fatalf("got status %d; want %d", code, http.StatusOK)
+		}
+		for _, want := range []string{"An old silent pond", "Over the wintry forest"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("want body to contain %q", want)
+			}
+		}
+		if strings.Contains(body, "From People You Follow") {
+			t.Errorf("want no feed for anonymous users")
+		}
+	})
+
+	t.Run("Following", func(t *testing.T) {
+		ts.logIn(t, alice)
+
+		code, _, body := ts.Get(t, "/")
+		if code != http.StatusOK {
+			t.Fatalf("got status %d; want %d", code, http.StatusOK)
+		}
+		if !strings.Contains(body, "From People You Follow") {
+			t.Errorf("want the feed of followed users")
+		}
+		if !strings.Contains(body, "An old silent pond") {
+			t.Errorf("want body to contain %q", "An old silent pond")
+		}
+		if strings.Contains(body, "Over the wintry forest") {
+			t.Errorf("want the feed to leave out snippets by users who aren't followed")
+		}
+	})
+}
+
+func TestSnippetView(t *testing.T) {
+	app, m := newTestApplication(t)
+
+	alice := insertUser(t, m.users, "Alice")
+	id := insertSnippet(t, m.snippets, "An old silent pond", 0)
+
+	_, err := m.comments.Insert(id, alice, "A frog jumps into the pond")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.stars.Toggle(alice, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, app)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody []string
+	}{
+		{
+			name:     "Valid ID",
+			urlPath:  "/snippet/view/1",
+			wantCode: http.StatusOK,
+			wantBody: []string{"An old silent pond...", "A frog jumps into the pond", "1 star"},
+		},
+		{
+			name:     "Non-existent ID",
+			urlPath:  "/snippet/view/2",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Negative ID",
+			urlPath:  "/snippet/view/-1",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/snippet/view/foo",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.Get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("want body to contain %q", want)
+				}
+			}
+		})
+	}
+}
+
+func TestSnippetViewLoggedIn(t *testing.T) {
+	app, m := newTestApplication(t)
+
+	alice := insertUser(t, m.users, "Alice")
+	id := insertSnippet(t, m.snippets, "An old silent pond", 0)
+
+	_, err := m.stars.Toggle(alice, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	haiku, err := m.collections.Insert(alice, "Haiku", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.collections.Insert(alice, "Spring", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.collections.AddItem(haiku, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, app)
+	ts.logIn(t, alice)
+
+	code, _, body := ts.Get(t, "/snippet/view/1")
+	if code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", code, http.StatusOK)
+	}
+	for _, want := range []string{"Unstar", "Haiku (added)", "Spring"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want body to contain %q", want)
+		}
+	}
+}
+
+// formTime returns a signed form timestamp from a minute ago, so that the
+// form guard doesn't take a test for a bot which filled the form in too
+// quickly.
+func formTime(app *application) string {
+	ts := time.Now().Add(-time.Minute).Unix()
+	return strconv.FormatInt(ts, 10) + "." + app.signFormTime(ts)
+}
+
+func TestUserSignupAndLogin(t *testing.T) {
+	app := newTestDBApplication(t)
+	ts := newTestServer(t, app)
+
+	_, _, body := ts.Get(t, "/user/signup")
+	csrfToken := testutils.ExtractCSRFToken(t, body)
+
+	t.Run("Signup", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("name", "Carol")
+		form.Add("username", "carol")
+		form.Add("email", "carol@example.com")
+		form.Add("password", "validPa$$word")
+		form.Add(formTimeField, formTime(app))
+		form.Add("csrf_token", csrfToken)
+
+		code, header, _ := ts.PostForm(t, "/user/signup", form)
+		if code != http.StatusSeeOther {
+			t.Fatalf("got status %d; want %d", code, http.StatusSeeOther)
+		}
+		if got := header.Get("Location"); got != "/user/login" {
+			t.Errorf("got redirect to %q; want %q", got, "/user/login")
+		}
+	})
+
+	_, _, body = ts.Get(t, "/user/login")
+	if !strings.Contains(body, "Your signup was successful") {
+		t.Errorf("want the signup flash on the login page")
+	}
+	csrfToken = testutils.ExtractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		email        string
+		password     string
+		csrfToken    string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:      "Missing CSRF token",
+			email:     "carol@example.com",
+			password:  "validPa$$word",
+			csrfToken: "",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:      "Wrong password",
+			email:     "carol@example.com",
+			password:  "wrongPa$$word",
+			csrfToken: csrfToken,
+			wantCode:  http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "Valid login",
+			email:        "carol@example.com",
+			password:     "validPa$$word",
+			csrfToken:    csrfToken,
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("email", tt.email)
+			form.Add("password", tt.password)
+			form.Add("csrf_token", tt.csrfToken)
+
+			code, header, _ := ts.PostForm(t, "/user/login", form)
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			if got := header.Get("Location"); got != tt.wantLocation {
+				t.Errorf("got redirect to %q; want %q", got, tt.wantLocation)
+			}
+		})
+	}
+
+	// The session is now logged in as Carol.
+	_, _, body = ts.Get(t, "/")
+	if !strings.Contains(body, "Logout") {
+		t.Errorf("want the home page to offer to log out")
+	}
+}
+
+func TestAccountExport(t *testing.T) {
+	app, m := newTestApplication(t)
+
+	alice := insertUser(t, m.users, "Alice")
+	id := insertSnippet(t, m.snippets, "An old silent pond", alice)
+
+	ts := newTestServer(t, app)
+
+	code, header, _ := ts.Get(t, "/account/export")
+	if code != http.StatusSeeOther {
+		t.Fatalf("anonymous: got status %d; want %d", code, http.StatusSeeOther)
+	}
+	if got := header.Get("Location"); got != "/user/login" {
+		t.Errorf("anonymous: got redirect to %q; want %q", got, "/user/login")
+	}
+
+	// The export is on its own chain, which doesn't buffer the response,
+	// so check the session still logs Alice in.
+	ts.logIn(t, alice)
+
+	code, header, body := ts.Get(t, "/account/export")
+	if code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", code, http.StatusOK)
+	}
+	if got := header.Get("Content-Type"); got != "application/zip" {
+		t.Errorf("got content type %q; want %q", got, "application/zip")
+	}
+
+	zr, err := zip.NewReader(strings.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, f := range zr.File {
+		names[f.Name] = true
+	}
+	for _, want := range []string{"profile.json", "snippets/" + strconv.Itoa(id) + ".json", "comments.json", "stars.json", "collections.json"} {
+		if !names[want] {
+			t.Errorf("want the archive to contain %s", want)
+		}
+	}
+}
+
+func TestSnippetAssetCaching(t *testing.T) {
+	app, m := newTestApplication(t)
+
+	id := insertSnippet(t, m.snippets, "An old silent pond", 0)
+	protected, err := m.snippets.Insert(context.Background(), "A secret", "A secret...", 7, 0, 0, "hash", "", "", time.Time{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		canonicalHost string
+		id            int
+		asset         string
+		wantCode      int
+		wantCache     string
+		wantURL       string
+	}{
+		{"Script", "", id, "embed.js", http.StatusOK, "private, max-age=300", "http://evil.example/snippet/view/1"},
+		{"Script, canonical host", "snippets.example", id, "embed.js", http.StatusOK, "public, max-age=300", "http://snippets.example/snippet/view/1"},
+		{"QR code", "", id, "qr.png", http.StatusOK, "private, max-age=86400", ""},
+		{"QR code, canonical host", "snippets.example", id, "qr.png", http.StatusOK, "public, max-age=86400", ""},
+		{"Protected script", "", protected, "embed.js", http.StatusNotFound, "", ""},
+		{"Protected QR code", "", protected, "qr.png", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app.canonicalHost = tt.canonicalHost
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Host = "evil.example"
+			r.SetPathValue("id", strconv.Itoa(tt.id))
+			r.SetPathValue("asset", tt.asset)
+			rr := httptest.NewRecorder()
+			app.snippetAsset(rr, r)
+
+			if rr.Code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", rr.Code, tt.wantCode)
+			}
+			if got := rr.Header().Get("Cache-Control"); tt.wantCache != "" && got != tt.wantCache {
+				t.Errorf("got Cache-Control %q; want %q", got, tt.wantCache)
+			}
+			if tt.wantURL != "" && !strings.Contains(rr.Body.String(), tt.wantURL) {
+				t.Errorf("want body to contain %q", tt.wantURL)
+			}
+		})
+	}
+}
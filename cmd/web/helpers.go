@@ -1,23 +1,55 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"snippetbox.floccinau.net/internal/errreport"
+	"snippetbox.floccinau.net/internal/i18n"
+	"snippetbox.floccinau.net/internal/models"
 )
 
 // Chapter 3.4: Centralized handling |
 // The serverError helper writes an error message and stack trace to the errorLog,
 // then sends a generic 500 Internal Server Error response to the user.
-func (app *application) serverError(w http.ResponseWriter, err error) {
+// The error is also sent to the error reporting service, if there is one,
+// with the request; r can be nil where there's no request at hand.
+func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
 	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
 	// 2 cause we need error message from file when error appeared,
 	// not from this file.
 	app.errorLog.Output(2, trace)
+	app.reportError(r, err, "error", errreport.Callers(1))
 
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
+// The reportError helper sends an error, with the stack where it happened,
+// to the error reporting service, along with the request and the user who
+// made it.
+func (app *application) reportError(r *http.Request, err error, level string, stack []uintptr) {
+	if app.errReporter == nil {
+		return
+	}
+
+	rep := errreport.Report{Err: err, Level: level, Stack: stack, Request: r}
+	if r != nil {
+		rep.ClientIP = app.clientIP(r)
+		if user := app.currentUser(r); user != nil {
+			rep.User = &errreport.User{ID: strconv.Itoa(user.ID), Username: user.Username}
+		}
+	}
+
+	app.errReporter.Send(rep)
+}
+
 // Chapter 3.4: Centralized error handling |
 // The clientError helper sends a specific status code and corresponding description
 // to the user. We'll use this later to send responses like 400 "Bad Request"
@@ -33,3 +65,258 @@ func (app *application) clientError(w http.ResponseWriter, status int) {
 func (app *application) notFound(w http.ResponseWriter) {
 	app.clientError(w, http.StatusNotFound)
 }
+
+// The render helper looks up the template set for the page in the cache,
+// executes the "base" template with the data and sends the page with the
+// given status code.
+func (app *application) render(w http.ResponseWriter, status int, page string, data *templateData) {
+	app.renderLayout(w, status, page, "base", data)
+}
+
+// The renderLayout helper is like render, but executes the named layout
+// template instead of "base". Pages which aren't shown inside the usual site
+// chrome, like the embeddable snippet, define their own layout.
+func (app *application) renderLayout(w http.ResponseWriter, status int, page, layout string, data *templateData) {
+	ts, err := app.pageTemplate(page)
+	if err != nil {
+		app.templateError(w, err)
+		return
+	}
+
+	// The page is rendered into a buffer first, so that if a template fails
+	// part way through, the visitor gets a clean 500 Internal Server Error
+	// (or, in development mode, the error itself) rather than half a page
+	// sent with the status the handler asked for. The status code is only
+	// written once the whole page is ready.
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	err = ts.ExecuteTemplate(buf, layout, data)
+	if err != nil {
+		app.templateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// bufferPool holds buffers for rendering pages into, so that a new one, and
+// the memory it grows to hold a whole page, isn't allocated every time.
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// maxPooledBuffer is the size of the largest buffer which is put back in
+// bufferPool. The odd huge page shouldn't keep its memory in use forever.
+const maxPooledBuffer = 1 << 20
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// The newTemplateData helper returns a pointer to a templateData struct
+// initialized with the data which is common to every page.
+func (app *application) newTemplateData(r *http.Request) *templateData {
+	data := &templateData{
+		CurrentYear:      time.Now().Year(),
+		Flash:            app.sessionManager.PopString(r.Context(), "flash"),
+		Warning:          app.sessionManager.PopString(r.Context(), "warning"),
+		IsAuthenticated:  app.isAuthenticated(r),
+		CSPNonce:         app.cspNonce(r),
+		User:             app.currentUser(r),
+		BaseURL:          app.absoluteURL(r, ""),
+		AllowAnonymous:   app.anonymous.enabled,
+		RegistrationMode: string(app.registration),
+		SSO:              app.oidc != nil,
+		FormGuard:        app.formGuardToken(r),
+		Gravatar:         app.gravatar,
+		Maintenance:      app.maintenance.Load(),
+		Version:          app.version,
+		Locale:           app.locale(r),
+		TimeZone:         app.timeZone(r),
+		Languages:        i18n.Languages(),
+	}
+
+	data.csrfToken = func() (string, error) {
+		return app.csrfToken(r)
+	}
+
+	if data.User != nil {
+		data.Orgs, data.CurrentOrgID = app.userOrgs(r, data.User)
+	}
+
+	return data
+}
+
+// The currentUser helper returns the user making the request, or nil if the
+// request is unauthenticated.
+func (app *application) currentUser(r *http.Request) *models.User {
+	user, ok := r.Context().Value(userContextKey).(*models.User)
+	if !ok || user.IsAnonymous() {
+		return nil
+	}
+
+	return user
+}
+
+// The isAuthenticated helper returns true if the request is from an
+// authenticated user, otherwise false.
+func (app *application) isAuthenticated(r *http.Request) bool {
+	return app.currentUser(r) != nil
+}
+
+// The clientIP helper returns the IP address of the client which made the
+// request, without the port.
+func (app *application) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// The audit helper writes an event to the audit log. A failure to write the
+// audit log is logged but doesn't fail the request.
+func (app *application) audit(r *http.Request, userID int, event, detail string) {
+	err := app.auditLog.Insert(userID, app.clientIP(r), app.clientCountry(r), event, detail)
+	if err != nil {
+		app.errorLog.Output(2, err.Error())
+	}
+}
+
+// The pageParam helper reads the page number from the "page" query string
+// parameter, defaulting to the first page for missing or invalid values.
+func (app *application) pageParam(r *http.Request) int {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+
+	return page
+}
+
+// The keysetParam helper reads the before and after query parameters of a
+// listing paged through with cursors, for pages of limit snippets. A missing
+// or malformed cursor is ignored, like a bad page number, and the newest page
+// is shown instead.
+func (app *application) keysetParam(r *http.Request, limit int) models.Keyset {
+	k := models.Keyset{Limit: limit}
+	qs := r.URL.Query()
+
+	if c, err := models.ParseCursor(qs.Get("after")); err == nil {
+		k.After = c
+	} else if c, err := models.ParseCursor(qs.Get("before")); err == nil {
+		k.Before = c
+	}
+
+	return k
+}
+
+// snippetIDs returns the IDs of the given snippets, in order.
+func snippetIDs(snippets []*models.Snippet) []int {
+	ids := make([]int, len(snippets))
+	for i, s := range snippets {
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+// The requestScheme helper returns the scheme, http or https, the request
+// was made over. Behind a trusted proxy, realIP() has already set it to
+// the one the proxy was asked for.
+func requestScheme(r *http.Request) string {
+	if r.URL.Scheme != "" {
+		return r.URL.Scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// The absoluteURL helper turns a path like "/snippet/view/1" into an absolute
+// URL, for links which are shown outside of our own pages. It uses the
+// canonical host if there is one, and otherwise the host of the current
+// request.
+func (app *application) absoluteURL(r *http.Request, path string) string {
+	host := r.Host
+	if app.canonicalHost != "" {
+		host = app.canonicalHost
+	}
+
+	return requestScheme(r) + "://" + host + path
+}
+
+// The sharedCacheControl helper returns the Cache-Control header for a
+// response with absolute URLs in it, which can be kept for maxAge seconds.
+// Without a canonical host the URLs come from the request's Host header,
+// which anyone can set, so only the browser which asked may keep it. A
+// shared cache would hand the URLs on to everyone else.
+func (app *application) sharedCacheControl(maxAge int) string {
+	if app.canonicalHost == "" {
+		return fmt.Sprintf("private, max-age=%d", maxAge)
+	}
+	return fmt.Sprintf("public, max-age=%d", maxAge)
+}
+
+// The loadPermissions helper fills in the user's permissions, which aren't
+// loaded with the rest of the user.
+func (app *application) loadPermissions(user *models.User) error {
+	permissions, err := app.permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+	user.Permissions = permissions
+	return nil
+}
+
+// The background helper runs fn in a new goroutine. A panic in fn is
+// recovered and logged rather than crashing the application, and the
+// goroutine is tracked so that waitBackground can wait for it to finish
+// before the application exits.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if p := recover(); p != nil {
+				app.errorLog.Output(2, fmt.Sprintf("panic in background task: %v\n%s", p, debug.Stack()))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// The waitBackground helper waits for the tasks started with background to
+// finish, or for ctx to be done, whichever happens first.
+func (app *application) waitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		app.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// BenchmarkRender renders the home page with a full page of snippets, into
+// a buffer from bufferPool like renderLayout does, and into a new buffer
+// each time like it used to.
+func BenchmarkRender(b *testing.B) {
+	// The templates are found relative to the root of the module.
+	b.Chdir("../..")
+
+	templateCache, err := newTemplateCache()
+	if err != nil {
+		b.Fatal(err)
+	}
+	ts := templateCache["home.tmpl.html"]
+
+	data := &templateData{
+		CurrentYear:   2024,
+		Locale:        "en",
+		TimeZone:      time.UTC,
+		CommentCounts: map[int]int{},
+		StarCounts:    map[int]int{},
+	}
+	created := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	for i := 1; i <= homePageSize; i++ {
+		data.Snippets = append(data.Snippets, &models.Snippet{ID: i, Title: "An old silent pond", Created: created})
+		data.CommentCounts[i] = i
+		data.StarCounts[i] = 2 * i
+	}
+
+	b.Run("pooled buffer", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			buf := getBuffer()
+			if err := ts.ExecuteTemplate(buf, "base", data); err != nil {
+				b.Fatal(err)
+			}
+			buf.WriteTo(io.Discard)
+			putBuffer(buf)
+		}
+	})
+
+	b.Run("new buffer", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			var buf bytes.Buffer
+			if err := ts.ExecuteTemplate(&buf, "base", data); err != nil {
+				b.Fatal(err)
+			}
+			buf.WriteTo(io.Discard)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// altSvcMaxAge is how long, in seconds, browsers remember that the site can
+// be reached over HTTP/3.
+const altSvcMaxAge = 24 * 60 * 60
+
+// newHTTP3Server returns a server for h over HTTP/3, on the UDP port addr,
+// with the HTTPS server's TLS settings in tlsConf. If those don't bring
+// their own certificates, as they do with -autocert, the certificate and key
+// are loaded from certFile and keyFile, like http.Server.ServeTLS does.
+//
+// 0-RTT is turned off: requests sent in it can be replayed by anyone who
+// sees them, and some of the site's forms change things.
+func newHTTP3Server(addr string, h http.Handler, tlsConf *tls.Config, certFile, keyFile string) (*http3.Server, error) {
+	tlsConf = tlsConf.Clone()
+	if tlsConf.GetCertificate == nil && len(tlsConf.Certificates) == 0 {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http3.Server{
+		Addr:       addr,
+		Handler:    h,
+		TLSConfig:  tlsConf,
+		QUICConfig: &quic.Config{Allow0RTT: false},
+	}, nil
+}
+
+// altSvcHeader returns the Alt-Svc header which tells browsers that they
+// can switch to HTTP/3 on the port of addr. They try it from their next
+// request, and carry on over HTTP/2 if UDP is blocked on the way.
+func altSvcHeader(addr string) (string, error) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if port == "" || port == "0" {
+		return "", fmt.Errorf("no port to advertise in %q", addr)
+	}
+
+	return fmt.Sprintf(`h3=":%s"; ma=%d`, port, altSvcMaxAge), nil
+}
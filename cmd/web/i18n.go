@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	// Time zones are looked up by name, and the server mightn't have the
+	// time zone database installed, so a copy is built into the binary.
+	_ "time/tzdata"
+
+	"snippetbox.floccinau.net/internal/i18n"
+)
+
+// languageCookie is the name of the cookie holding the language a visitor
+// picked from the footer.
+const languageCookie = "lang"
+
+// The locale helper returns the language to show a page in. A language the
+// visitor picked wins over the ones their browser asks for.
+func (app *application) locale(r *http.Request) string {
+	picked, _ := app.readCookie(r, languageCookie)
+
+	return i18n.Match(picked, r.Header.Get("Accept-Language"))
+}
+
+// timeZoneCookie is the name of the cookie holding the visitor's time zone,
+// like "Europe/Madrid". It's set by main.js from the browser's settings.
+const timeZoneCookie = "tz"
+
+// The timeZone helper returns the time zone to show times to a visitor in:
+// the one set on their profile, or else the one from their browser. It's UTC
+// if they haven't got one or it's not a zone we know about.
+func (app *application) timeZone(r *http.Request) *time.Location {
+	var name string
+	if user := app.currentUser(r); user != nil && user.TimeZone != "" {
+		name = user.TimeZone
+	} else if c, err := r.Cookie(timeZoneCookie); err == nil {
+		name, _ = url.QueryUnescape(c.Value)
+	}
+
+	if name == "" || name == "Local" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+// The setLanguage handler remembers the language a visitor picked, for a
+// year, and sends them back to the page they picked it on.
+func (app *application) setLanguage(w http.ResponseWriter, r *http.Request) {
+	lang := r.PathValue("lang")
+
+	supported := slices.ContainsFunc(i18n.Languages(), func(l i18n.Language) bool {
+		return l.Tag == lang
+	})
+	if !supported {
+		app.notFound(w)
+		return
+	}
+
+	app.setCookie(w, languageCookie, lang, time.Now().AddDate(1, 0, 0))
+
+	// Only go back to pages on this site, so the handler can't be used to
+	// send people elsewhere.
+	back := "/"
+	if ref, err := url.Parse(r.Referer()); err == nil && ref.Host == r.Host && ref.Path != "" {
+		back = ref.Path
+		if ref.RawQuery != "" {
+			back += "?" + ref.RawQuery
+		}
+	}
+
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
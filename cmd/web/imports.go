@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippetbox.floccinau.net/internal/gist"
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/validator"
+	"snippetbox.floccinau.net/internal/worker"
+)
+
+// gistImportJob is the kind of job which imports a user's gists.
+const gistImportJob = "gist.import"
+
+const (
+	// gistImportExpiry is how many days imported snippets last.
+	gistImportExpiry = 365
+
+	// gistImportLimit is how many imports each user can start an hour.
+	gistImportLimit = 3
+)
+
+// githubUsernameRX matches a valid GitHub username.
+var githubUsernameRX = regexp.MustCompile(`^[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,38})$`)
+
+// gistImportPayload is the payload of a gistImportJob. The token is
+// encrypted with the content keys, since it's stored in the jobs table
+// until the import is done.
+type gistImportPayload struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+// gistImportForm holds the gist import form data and any validation errors.
+type gistImportForm struct {
+	Username string
+	Token    string
+	validator.Validator
+}
+
+// The accountImport handler shows the form for importing gists.
+func (app *application) accountImport(w http.ResponseWriter, r *http.Request) {
+	data := app.newTemplateData(r)
+	data.Form = gistImportForm{}
+	app.render(w, http.StatusOK, "import.tmpl.html", data)
+}
+
+// The accountImportPost handler queues an import of the gists of a GitHub
+// user, or of the user a token belongs to.
+func (app *application) accountImportPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	form := gistImportForm{
+		Username: strings.TrimSpace(r.PostForm.Get("username")),
+		Token:    strings.TrimSpace(r.PostForm.Get("token")),
+	}
+
+	form.Check(form.Username != "" || form.Token != "", "username", "Enter a GitHub username or a token")
+	if form.Username != "" {
+		form.Check(validator.Matches(form.Username, githubUsernameRX), "username", "This isn't a valid GitHub username")
+	}
+	form.Check(validator.MaxChars(form.Token, 255), "token", "This field cannot be more than 255 characters long")
+
+	if !form.Valid() {
+		form.Token = ""
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "import.tmpl.html", data)
+		return
+	}
+
+	ok, _, reset := app.takeRateLimit(r, "gist-import:"+strconv.Itoa(user.ID), gistImportLimit, time.Hour)
+	if !ok {
+		form.Token = ""
+		form.AddNonFieldError("You've started too many imports. Try again in " + humanDuration(time.Until(reset)) + ".")
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusTooManyRequests, "import.tmpl.html", data)
+		return
+	}
+
+	token, err := app.keys.Encrypt(form.Token)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.jobs.Enqueue(gistImportJob, gistImportPayload{UserID: user.ID, Username: form.Username, Token: token})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Your gists are being imported. They'll appear on your profile in a few minutes.")
+
+	http.Redirect(w, r, "/user/"+user.Username, http.StatusSeeOther)
+}
+
+// The importGists method is the handler for gistImportJob jobs, which import
+// a user's public GitHub Gists as snippets. The import runs as a job since
+// fetching every file of every gist can take a while. Each file of a gist
+// becomes a snippet, keeping its language and the time the gist was
+// created. Files which were imported before, or which are bigger than a
+// snippet can be, are skipped, so an import can safely be run again to pick
+// up new gists.
+//
+// Running out of GitHub's rate limit retries the job once it resets, and the
+// snippets already imported are skipped then. Imported snippets go through the
+// moderation checks, but aren't announced to webhooks or the /events
+// stream, which a burst of old snippets would only flood.
+func (app *application) importGists(ctx context.Context, job *worker.Job) error {
+	var input gistImportPayload
+	err := job.Decode(&input)
+	if err != nil {
+		return worker.Permanent(err)
+	}
+
+	// If the user has deleted their account since, there's nothing to do.
+	user, err := app.users.Get(input.UserID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	// Moderators' snippets aren't checked, so their permissions are needed.
+	err = app.loadPermissions(user)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.keys.Decrypt(input.Token)
+	if err != nil {
+		return worker.Permanent(err)
+	}
+
+	client := &gist.Client{Token: token}
+
+	gists, err := client.List(ctx, input.Username)
+	if err != nil {
+		return gistError(err)
+	}
+
+	var imported, skipped int
+	for _, g := range gists {
+		for _, name := range slices.Sorted(maps.Keys(g.Files)) {
+			f := g.Files[name]
+
+			content, ok, err := client.Content(ctx, f, app.maxSnippetSize)
+			if err != nil {
+				return gistError(err)
+			}
+			content, _ = validator.CleanText(content)
+			if !ok || strings.TrimSpace(content) == "" {
+				skipped++
+				continue
+			}
+
+			title := gistTitle(g, f)
+			_, err = app.snippets.Import(user.ID, models.ImportedSnippet{
+				Title:      title,
+				Content:    content,
+				Language:   gistLanguage(f.Language),
+				Created:    g.Created,
+				Expires:    gistImportExpiry,
+				Source:     gistSource(g, f),
+				HeldReason: app.moderateFor(ctx, user, "", title, content),
+			})
+			if errors.Is(err, models.ErrAlreadyImported) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			imported++
+		}
+	}
+
+	detail := fmt.Sprintf("%d snippets from %d gists, %d files skipped", imported, len(gists), skipped)
+	err = app.auditLog.Insert(user.ID, "", "", models.EventGistImport, detail)
+	if err != nil {
+		app.errorLog.Print(err)
+	}
+
+	return nil
+}
+
+// gistError decides what happens to an import which failed with err. A
+// user or token which GitHub doesn't know won't be any better next time,
+// and running out of the rate limit is retried once it resets.
+func gistError(err error) error {
+	if errors.Is(err, gist.ErrNotFound) || errors.Is(err, gist.ErrUnauthorized) {
+		return worker.Permanent(err)
+	}
+
+	var rateErr *gist.RateLimitError
+	if errors.As(err, &rateErr) {
+		return worker.RetryAfter(err, time.Until(rateErr.Reset)+time.Second)
+	}
+
+	return err
+}
+
+// gistTitle makes the title of the snippet for a file of a gist: the
+// gist's description, with the file name if the gist has more than one
+// file, or else just the file name.
+func gistTitle(g *gist.Gist, f *gist.File) string {
+	title, _ := validator.CleanText(g.Description)
+	title = strings.TrimSpace(title)
+	switch {
+	case title == "":
+		title = f.Filename
+	case len(g.Files) > 1:
+		title += " (" + f.Filename + ")"
+	}
+
+	return truncate(100, title)
+}
+
+// gistSource identifies a file of a gist, for finding out whether it's
+// already been imported. It's cut to the size of the column.
+func gistSource(g *gist.Gist, f *gist.File) string {
+	source := "gist:" + g.ID + "/" + f.Filename
+	if runes := []rune(source); len(runes) > 255 {
+		source = string(runes[:255])
+	}
+	return source
+}
+
+// gistLanguage turns the name GitHub gives a file's language, like "Go" or
+// "Vim Script", into a snippet language, like "go" or "vim-script". Names
+// which can't be used are left out.
+func gistLanguage(name string) string {
+	language, ok := normalizeLanguage(strings.ReplaceAll(name, " ", "-"))
+	if !ok {
+		return ""
+	}
+	return language
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/validator"
+)
+
+// registrationMode says who can sign up: anyone, only people with an
+// invitation from a moderator, or nobody.
+type registrationMode string
+
+const (
+	registrationOpen   registrationMode = "open"
+	registrationInvite registrationMode = "invite"
+	registrationClosed registrationMode = "closed"
+)
+
+// parseRegistrationMode checks the value of the -registration-mode flag.
+func parseRegistrationMode(s string) (registrationMode, error) {
+	switch mode := registrationMode(s); mode {
+	case registrationOpen, registrationInvite, registrationClosed:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown registration mode %q", s)
+}
+
+// invalidInviteMessage is shown on the signup form when the invitation code
+// can't be used.
+const invalidInviteMessage = "This invitation isn't valid, or has expired or been used up"
+
+// inviteExpiryDays are the lifetimes an invitation can be given, in days.
+var inviteExpiryDays = []int{1, 7, 30}
+
+// maxInviteUses is the most people one invitation can sign up.
+const maxInviteUses = 1000
+
+// The inviteUsable helper reports whether the invitation with the given
+// code can still be used.
+func (app *application) inviteUsable(code string) (bool, error) {
+	invite, err := app.invites.Get(code)
+	if errors.Is(err, models.ErrNoRecord) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return invite.Usable(), nil
+}
+
+// inviteForm holds the form for making an invitation and any validation
+// errors.
+type inviteForm struct {
+	MaxUses int
+	Expires int
+	validator.Validator
+}
+
+// The adminInvites handler lists the invitations, with links to sign up
+// with, and a form for making another.
+func (app *application) adminInvites(w http.ResponseWriter, r *http.Request) {
+	app.renderInvites(w, r, http.StatusOK, inviteForm{MaxUses: 1, Expires: 7})
+}
+
+func (app *application) renderInvites(w http.ResponseWriter, r *http.Request, status int, form inviteForm) {
+	invites, err := app.invites.All()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Invites = invites
+	data.InviteExpiryDays = inviteExpiryDays
+	data.Form = form
+
+	app.render(w, status, "invites.tmpl.html", data)
+}
+
+func (app *application) adminInvitesPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// A missing or mistyped number of uses fails the check below.
+	maxUses, _ := strconv.Atoi(r.PostForm.Get("max_uses"))
+	expires, err := strconv.Atoi(r.PostForm.Get("expires"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := inviteForm{
+		MaxUses: maxUses,
+		Expires: expires,
+	}
+
+	form.Check(form.MaxUses >= 1 && form.MaxUses <= maxInviteUses, "max_uses", fmt.Sprintf("This field must be a number from 1 to %d", maxInviteUses))
+	form.Check(validator.PermittedValue(form.Expires, inviteExpiryDays...), "expires", "This field must equal 1, 7 or 30")
+
+	if !form.Valid() {
+		app.renderInvites(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	invite, err := app.invites.Insert(user.ID, form.MaxUses, time.Duration(form.Expires)*24*time.Hour)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, user.ID, models.EventInviteCreate, strconv.Itoa(invite.ID))
+
+	app.sessionManager.Put(r.Context(), "flash", "Invitation created!")
+
+	http.Redirect(w, r, "/admin/invites", http.StatusSeeOther)
+}
+
+func (app *application) adminInviteRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	err = app.invites.Revoke(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, app.contextGetUser(r).ID, models.EventInviteRevoke, strconv.Itoa(id))
+
+	app.sessionManager.Put(r.Context(), "flash", "Invitation revoked.")
+
+	http.Redirect(w, r, "/admin/invites", http.StatusSeeOther)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/validator"
+)
+
+// ipFilter holds the addresses which are allowed and denied. When the allow
+// list isn't empty, only addresses on it get in; the deny list and the bans
+// are checked either way.
+//
+// The -ip-allowlist and -ip-denylist files list addresses and CIDR ranges,
+// and administrators can ban more from the /admin/ip-bans page, which are
+// kept in the database. The files and the bans are read again on SIGHUP, so
+// the lists can be changed without a restart.
+type ipFilter struct {
+	allowPath string
+	denyPath  string
+
+	mu     sync.RWMutex
+	allow  []netip.Prefix
+	deny   []netip.Prefix
+	banned []netip.Prefix
+}
+
+// readIPList reads a file of IP addresses and CIDR ranges, one per line.
+// Blank lines, and anything after a #, are ignored.
+func readIPList(path string) ([]netip.Prefix, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var prefixes []netip.Prefix
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		prefix, err := parsePrefix(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	return prefixes, scanner.Err()
+}
+
+// loadFiles reads the allow and deny lists. If either can't be read, the
+// lists in use are left as they were.
+func (f *ipFilter) loadFiles() error {
+	var allow, deny []netip.Prefix
+	var err error
+
+	if f.allowPath != "" {
+		allow, err = readIPList(f.allowPath)
+		if err != nil {
+			return err
+		}
+	}
+	if f.denyPath != "" {
+		deny, err = readIPList(f.denyPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	f.mu.Lock()
+	f.allow, f.deny = allow, deny
+	f.mu.Unlock()
+
+	return nil
+}
+
+// setBans replaces the banned ranges with those from the database. They
+// were checked when they were added, so any which don't parse are skipped.
+func (f *ipFilter) setBans(bans []*models.IPBan) {
+	var banned []netip.Prefix
+	for _, ban := range bans {
+		if prefix, err := netip.ParsePrefix(ban.CIDR); err == nil {
+			banned = append(banned, prefix)
+		}
+	}
+
+	f.mu.Lock()
+	f.banned = banned
+	f.mu.Unlock()
+}
+
+// allowed reports whether requests from addr may be served.
+func (f *ipFilter) allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if len(f.allow) > 0 && !prefixesContain(f.allow, addr) {
+		return false
+	}
+	return !prefixesContain(f.deny, addr) && !prefixesContain(f.banned, addr)
+}
+
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// The loadIPBans helper reads the bans from the database into the filter.
+func (app *application) loadIPBans() error {
+	bans, err := app.ipBans.All()
+	if err != nil {
+		return err
+	}
+
+	app.ipFilter.setBans(bans)
+	return nil
+}
+
+// reloadIPFilterOnHangup reads the allow and deny lists and the bans again
+// whenever the process gets SIGHUP. Bans made on the admin page take effect
+// straight away on the server they were made on, and on any others the
+// next time they get SIGHUP.
+func (app *application) reloadIPFilterOnHangup() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			if err := app.ipFilter.loadFiles(); err != nil {
+				app.errorLog.Print(err)
+			}
+			if err := app.loadIPBans(); err != nil {
+				app.errorLog.Print(err)
+			}
+			app.infoLog.Print("reloaded IP allow and deny lists")
+		}
+	}()
+}
+
+// The filterIP() middleware turns away requests from addresses which
+// aren't allowed, before they reach any handler. It must come after
+// realIP(), so that it sees the client's address rather than a proxy's.
+// Requests over a Unix socket without a trusted proxy in front have no
+// address, and are let through.
+func (app *application) filterIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+		if err == nil && !app.ipFilter.allowed(addrPort.Addr()) {
+			app.clientError(w, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ipBanForm holds the form for banning an address or range and any
+// validation errors.
+type ipBanForm struct {
+	CIDR   string
+	Reason string
+	validator.Validator
+}
+
+// The adminIPBans handler lists the banned addresses, with a form for
+// banning another. The address can be filled in from a link on the audit
+// log page.
+func (app *application) adminIPBans(w http.ResponseWriter, r *http.Request) {
+	app.renderIPBans(w, r, http.StatusOK, ipBanForm{CIDR: r.URL.Query().Get("ip")})
+}
+
+func (app *application) renderIPBans(w http.ResponseWriter, r *http.Request, status int, form ipBanForm) {
+	bans, err := app.ipBans.All()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.IPBans = bans
+	data.Form = form
+
+	app.render(w, status, "ipbans.tmpl.html", data)
+}
+
+func (app *application) adminIPBansPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := ipBanForm{
+		CIDR:   strings.TrimSpace(r.PostForm.Get("cidr")),
+		Reason: strings.TrimSpace(r.PostForm.Get("reason")),
+	}
+
+	prefix, err := parsePrefix(form.CIDR)
+	form.Check(err == nil, "cidr", "This field must be an IP address or CIDR range")
+	form.Check(validator.NotBlank(form.Reason), "reason", "This field cannot be blank")
+	form.Check(validator.MaxChars(form.Reason, 255), "reason", "This field cannot be more than 255 characters long")
+
+	// Stop administrators locking themselves out by mistake.
+	if err == nil {
+		if self, err := netip.ParseAddr(app.clientIP(r)); err == nil {
+			form.Check(!prefix.Contains(self.Unmap()), "cidr", "This would ban your own address")
+		}
+	}
+
+	if !form.Valid() {
+		app.renderIPBans(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	_, err = app.ipBans.Insert(prefix.String(), form.Reason, user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateIPBan) {
+			form.AddError("cidr", "This address or range is already banned")
+			app.renderIPBans(w, r, http.StatusUnprocessableEntity, form)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.loadIPBans()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, user.ID, models.EventIPBan, prefix.String()+": "+form.Reason)
+
+	app.sessionManager.Put(r.Context(), "flash", "Address banned.")
+
+	http.Redirect(w, r, "/admin/ip-bans", http.StatusSeeOther)
+}
+
+func (app *application) adminIPBanDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	cidr, err := app.ipBans.Delete(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.loadIPBans()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, app.contextGetUser(r).ID, models.EventIPUnban, cidr)
+
+	app.sessionManager.Put(r.Context(), "flash", "Ban lifted.")
+
+	http.Redirect(w, r, "/admin/ip-bans", http.StatusSeeOther)
+}
+
+// auditPageSize is how many audit log entries the admin page shows.
+const auditPageSize = 200
+
+// The adminAudit handler shows the latest entries in the audit log, or
+// only those from one address, with links for banning the addresses.
+func (app *application) adminAudit(w http.ResponseWriter, r *http.Request) {
+	ip := strings.TrimSpace(r.URL.Query().Get("ip"))
+
+	var events []*models.AuditEvent
+	var err error
+	if ip != "" {
+		events, err = app.auditLog.ForIP(ip, auditPageSize)
+	} else {
+		events, err = app.auditLog.Latest(auditPageSize)
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.AuditEvents = events
+	data.AuditIP = ip
+
+	app.render(w, http.StatusOK, "audit.tmpl.html", data)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// writeIPList writes the lines to a file in dir, and returns its path.
+func writeIPList(t *testing.T, dir, name, lines string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(lines), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// filterStatus sends a request from remoteAddr through the filterIP()
+// middleware, and returns the status it gets.
+func filterStatus(app *application, remoteAddr string) int {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = remoteAddr
+	rr := httptest.NewRecorder()
+	app.filterIP(next).ServeHTTP(rr, r)
+	return rr.Code
+}
+
+func TestFilterIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		allow      string
+		deny       string
+		bans       []string
+		remoteAddr string
+		wantCode   int
+	}{
+		{name: "No lists", remoteAddr: "203.0.113.7:1234", wantCode: http.StatusOK},
+		{name: "Allowed", allow: "203.0.113.0/24", remoteAddr: "203.0.113.7:1234", wantCode: http.StatusOK},
+		{name: "Not allowed", allow: "203.0.113.0/24", remoteAddr: "198.51.100.1:1234", wantCode: http.StatusForbidden},
+		{name: "Denied", deny: "203.0.113.7", remoteAddr: "203.0.113.7:1234", wantCode: http.StatusForbidden},
+		{name: "Not denied", deny: "203.0.113.7", remoteAddr: "203.0.113.8:1234", wantCode: http.StatusOK},
+		{name: "Deny beats allow", allow: "203.0.113.0/24", deny: "203.0.113.7", remoteAddr: "203.0.113.7:1234", wantCode: http.StatusForbidden},
+		{name: "Ban beats allow", allow: "203.0.113.0/24", bans: []string{"203.0.113.0/28"}, remoteAddr: "203.0.113.7:1234", wantCode: http.StatusForbidden},
+		{name: "Banned", bans: []string{"2001:db8::/32"}, remoteAddr: "[2001:db8::1]:1234", wantCode: http.StatusForbidden},
+		{name: "Comments and blank lines", deny: "# bad actors\n\n203.0.113.7 # again\n", remoteAddr: "203.0.113.7:1234", wantCode: http.StatusForbidden},
+		{name: "Mapped address, IPv4 list", deny: "203.0.113.0/24", remoteAddr: "[::ffff:203.0.113.7]:1234", wantCode: http.StatusForbidden},
+		{name: "Mapped address, IPv4 allow list", allow: "203.0.113.0/24", remoteAddr: "[::ffff:203.0.113.7]:1234", wantCode: http.StatusOK},
+		{name: "IPv4 address, mapped list entry", deny: "::ffff:203.0.113.7", remoteAddr: "203.0.113.7:1234", wantCode: http.StatusForbidden},
+		{name: "IPv4 address, mapped list range", deny: "::ffff:203.0.113.0/120", remoteAddr: "203.0.113.7:1234", wantCode: http.StatusForbidden},
+		{name: "IPv6 address, IPv4 allow list", allow: "203.0.113.0/24", remoteAddr: "[2001:db8::1]:1234", wantCode: http.StatusForbidden},
+		{name: "Unix socket", allow: "203.0.113.0/24", remoteAddr: "@", wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			f := &ipFilter{}
+			if tt.allow != "" {
+				f.allowPath = writeIPList(t, dir, "allow.txt", tt.allow)
+			}
+			if tt.deny != "" {
+				f.denyPath = writeIPList(t, dir, "deny.txt", tt.deny)
+			}
+			if err := f.loadFiles(); err != nil {
+				t.Fatal(err)
+			}
+
+			var bans []*models.IPBan
+			for _, cidr := range tt.bans {
+				bans = append(bans, &models.IPBan{CIDR: cidr})
+			}
+			f.setBans(bans)
+
+			app := &application{ipFilter: f}
+			if code := filterStatus(app, tt.remoteAddr); code != tt.wantCode {
+				t.Errorf("got status %d; want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestIPFilterLoadFilesKeepsListsOnError(t *testing.T) {
+	dir := t.TempDir()
+	deny := writeIPList(t, dir, "deny.txt", "203.0.113.7\n")
+
+	f := &ipFilter{denyPath: deny}
+	if err := f.loadFiles(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeIPList(t, dir, "deny.txt", "203.0.113.7\nnonsense\n")
+	if err := f.loadFiles(); err == nil {
+		t.Fatal("got no error for a bad list; want one")
+	}
+
+	if f.allowed(netip.MustParseAddr("203.0.113.7")) {
+		t.Error("got the address allowed; want the old deny list kept")
+	}
+}
+
+// TestIPFilterReload swaps the lists back and forth while requests are
+// being filtered. Run with -race, it checks that the swap doesn't race
+// with the requests, and either way that addresses which both lists agree
+// on get the same answer throughout.
+func TestIPFilterReload(t *testing.T) {
+	dir := t.TempDir()
+	allowA := writeIPList(t, dir, "allow-a.txt", "203.0.113.0/24\n")
+	allowB := writeIPList(t, dir, "allow-b.txt", "203.0.113.0/25\n198.51.100.0/24\n")
+
+	f := &ipFilter{allowPath: allowA}
+	if err := f.loadFiles(); err != nil {
+		t.Fatal(err)
+	}
+	app := &application{ipFilter: f}
+
+	// 203.0.113.7 is on both lists and 192.0.2.1 on neither, so they get
+	// the same answer whichever list is in use.
+	var wg sync.WaitGroup
+	errs := make(chan string, 100)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				if code := filterStatus(app, "203.0.113.7:1234"); code != http.StatusOK {
+					errs <- "an address on both lists was turned away"
+					return
+				}
+				if code := filterStatus(app, "192.0.2.1:1234"); code != http.StatusForbidden {
+					errs <- "an address on neither list was let in"
+					return
+				}
+			}
+		}()
+	}
+
+	for i := range 200 {
+		// Only this goroutine reads the paths, in loadFiles.
+		if i%2 == 0 {
+			f.allowPath = allowB
+		} else {
+			f.allowPath = allowA
+		}
+
+		if err := f.loadFiles(); err != nil {
+			t.Fatal(err)
+		}
+		f.setBans([]*models.IPBan{{CIDR: "198.51.100.0/28"}})
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
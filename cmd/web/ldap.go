@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// authenticator checks the email address and password someone logs in
+// with, and returns the ID of their user. It returns
+// models.ErrInvalidCredentials if they don't match. The UserModel checks
+// them against the database; ldapAuthenticator against an LDAP server.
+type authenticator interface {
+	Authenticate(email, password string) (int, error)
+}
+
+// ldapTimeout is how long the LDAP server gets to answer each request.
+const ldapTimeout = 5 * time.Second
+
+// ldapConfig holds the settings for checking passwords against an LDAP
+// server, from the -ldap-* flags.
+type ldapConfig struct {
+	URL      string
+	StartTLS bool
+	// BindDN and BindPassword are the account used to search for users. If
+	// BindDN is empty, the searches are made anonymously.
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter finds a user by their email address, which replaces its
+	// %s.
+	UserFilter string
+	// UsernameAttr is the attribute which the usernames of new users are
+	// made from.
+	UsernameAttr string
+	// Group is the DN of a group which users must be a member of to log in,
+	// or empty to let anyone in who's found.
+	Group string
+}
+
+// ldapAuthenticator checks passwords against an LDAP server, such as
+// OpenLDAP or Active Directory. The user is looked up by their email
+// address, and their password checked by binding as them. The first time
+// someone logs in, a local user is made for them, so that they can own
+// snippets like anyone else; a local user with the same email address is
+// taken to be them.
+type ldapAuthenticator struct {
+	config      ldapConfig
+	users       models.UserStore
+	permissions models.PermissionStore
+	infoLog     *log.Logger
+}
+
+func (a *ldapAuthenticator) Authenticate(email, password string) (int, error) {
+	// An empty password makes an unauthenticated bind, which many servers
+	// accept for any DN.
+	if password == "" {
+		return 0, models.ErrInvalidCredentials
+	}
+
+	entry, err := a.check(email, password)
+	if err != nil {
+		return 0, err
+	}
+
+	return a.provision(entry, email)
+}
+
+// check finds the user with the email address on the LDAP server, binds as
+// them with the password, and checks that they're in the group if one is
+// required. It returns their entry.
+func (a *ldapAuthenticator) check(email, password string) (*ldap.Entry, error) {
+	conn, err := ldap.DialURL(a.config.URL, ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetTimeout(ldapTimeout)
+
+	if a.config.StartTLS {
+		u, err := url.Parse(a.config.URL)
+		if err != nil {
+			return nil, err
+		}
+		err = conn.StartTLS(&tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = a.bindSearcher(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ask for two entries, so that an address shared by more than one is
+	// noticed rather than logging in as whichever comes first.
+	search := ldap.NewSearchRequest(
+		a.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout/time.Second), false,
+		fmt.Sprintf(a.config.UserFilter, ldap.EscapeFilter(email)),
+		[]string{"mail", "displayName", "cn", a.config.UsernameAttr},
+		nil,
+	)
+
+	result, err := conn.Search(search)
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, err
+	}
+	if err != nil || len(result.Entries) != 1 {
+		return nil, models.ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	err = conn.Bind(entry.DN, password)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, models.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if a.config.Group != "" {
+		// The user may not be allowed to read the group, so search as
+		// before.
+		err = a.bindSearcher(conn)
+		if err != nil {
+			return nil, err
+		}
+
+		search := ldap.NewSearchRequest(
+			a.config.Group, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, int(ldapTimeout/time.Second), false,
+			fmt.Sprintf("(member=%s)", ldap.EscapeFilter(entry.DN)),
+			[]string{"dn"},
+			nil,
+		)
+
+		result, err := conn.Search(search)
+		if err != nil {
+			return nil, err
+		}
+		if len(result.Entries) == 0 {
+			return nil, models.ErrInvalidCredentials
+		}
+	}
+
+	return entry, nil
+}
+
+// bindSearcher binds as the account which searches for users, or
+// anonymously if there isn't one.
+func (a *ldapAuthenticator) bindSearcher(conn *ldap.Conn) error {
+	if a.config.BindDN == "" {
+		return conn.UnauthenticatedBind("")
+	}
+	return conn.Bind(a.config.BindDN, a.config.BindPassword)
+}
+
+// provision returns the ID of the local user for the LDAP entry, making one
+// the first time they log in.
+func (a *ldapAuthenticator) provision(entry *ldap.Entry, email string) (int, error) {
+	if mail := entry.GetAttributeValue("mail"); mail != "" {
+		email = mail
+	}
+
+	user, err := a.users.GetByEmail(email)
+	if err == nil {
+		return user.ID, nil
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		return 0, err
+	}
+
+	name := entry.GetAttributeValue("displayName")
+	if name == "" {
+		name = entry.GetAttributeValue("cn")
+	}
+
+	id, err := provisionUser(a.users, a.permissions, name, entry.GetAttributeValue(a.config.UsernameAttr), email)
+	if err != nil {
+		return 0, err
+	}
+
+	a.infoLog.Printf("created user %d for LDAP login %s", id, email)
+
+	return id, nil
+}
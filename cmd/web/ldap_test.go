@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+func TestLDAPProvision(t *testing.T) {
+	tests := []struct {
+		name       string
+		attributes map[string][]string
+		email      string
+		wantUser   string
+		wantName   string
+	}{
+		{
+			name:       "Same email",
+			attributes: map[string][]string{"uid": {"alice"}},
+			email:      "alice@example.com",
+			wantUser:   "Alice",
+		},
+		{
+			name:       "Mail attribute",
+			attributes: map[string][]string{"uid": {"a.liddell"}, "mail": {"alice@example.com"}},
+			email:      "a.liddell@corp.example.com",
+			wantUser:   "Alice",
+		},
+		{
+			name:       "New user",
+			attributes: map[string][]string{"uid": {"carol"}, "displayName": {"Carol Smith"}},
+			email:      "carol@example.com",
+			wantName:   "Carol Smith",
+		},
+		{
+			name:       "New user without a display name",
+			attributes: map[string][]string{"uid": {"dave"}, "cn": {"Dave"}},
+			email:      "dave@example.com",
+			wantName:   "Dave",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, m := newTestApplication(t)
+			alice := insertUser(t, m.users, "Alice")
+
+			a := &ldapAuthenticator{
+				config:      ldapConfig{UsernameAttr: "uid"},
+				users:       m.users,
+				permissions: m.permissions,
+				infoLog:     app.infoLog,
+			}
+
+			id, err := a.provision(ldap.NewEntry("cn=test,dc=example,dc=com", tt.attributes), tt.email)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantUser != "" {
+				if id != alice {
+					t.Errorf("got user %d; want Alice (%d)", id, alice)
+				}
+				return
+			}
+
+			if id == alice {
+				t.Fatal("got Alice; want a new user")
+			}
+			user, err := m.users.Get(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Name != tt.wantName {
+				t.Errorf("got name %q; want %q", user.Name, tt.wantName)
+			}
+			if want := tt.attributes["uid"][0]; !strings.EqualFold(user.Username, want) {
+				t.Errorf("got username %q; want %q", user.Username, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor systemd passes to a
+// socket-activated service; 0, 1 and 2 are stdin, stdout and stderr.
+const listenFDsStart = 3
+
+// listen opens the listener for the main server. If systemd started the
+// process through socket activation, the socket it passes in is used.
+// Otherwise spec says what to listen on: "unix:/path/to.sock" for a Unix
+// socket, or an empty string for a TCP listener on addr.
+func listen(spec, addr string) (net.Listener, error) {
+	ln, err := systemdListener()
+	if ln != nil || err != nil {
+		return ln, err
+	}
+
+	if path, ok := strings.CutPrefix(spec, "unix:"); ok {
+		return listenUnix(path)
+	}
+	if spec != "" {
+		return nil, fmt.Errorf("-listen: %q isn't unix:/path/to.sock", spec)
+	}
+
+	return net.Listen("tcp", addr)
+}
+
+// systemdListener returns the first socket passed in by systemd socket
+// activation, or nil if the process wasn't socket-activated. The LISTEN_*
+// variables are cleared, so they aren't inherited by child processes.
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(listenFDsStart, "systemd-socket")
+	defer f.Close()
+
+	// FileListener duplicates the file descriptor, so the original can be
+	// closed.
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("socket activation: %w", err)
+	}
+
+	return ln, nil
+}
+
+// listenUnix listens on a Unix socket at path. A socket left behind by a
+// process which didn't shut down cleanly is removed first, but any other
+// kind of file is left alone. The socket can be used by its group, so that
+// a reverse proxy in the same group can connect. It's removed again when the
+// listener is closed.
+func listenUnix(path string) (net.Listener, error) {
+	info, err := os.Lstat(path)
+	switch {
+	case err == nil && info.Mode().Type() == fs.ModeSocket:
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	case err == nil:
+		return nil, fmt.Errorf("%s exists and isn't a socket", path)
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0o660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	return ln, nil
+}
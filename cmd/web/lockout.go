@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// loginThrottle holds the settings for brute-force protection on login.
+// Failures are counted per account (by the submitted email address) and per
+// client IP. Once an account has more than freeAttempts consecutive failures
+// each further attempt must wait an exponentially growing delay, and after
+// maxFailures the account is locked for the lockout duration. An IP which
+// fails maxIPFailures times within the window is locked out in the same way,
+// whichever accounts it was trying.
+type loginThrottle struct {
+	freeAttempts  int
+	baseDelay     time.Duration
+	maxFailures   int
+	maxIPFailures int
+	lockout       time.Duration
+	window        time.Duration
+}
+
+// loginStatus is the result of checking a login attempt against the
+// throttle.
+type loginStatus struct {
+	// retryAfter is how long the client must wait before another attempt
+	// will be considered. Zero means the attempt may go ahead.
+	retryAfter time.Duration
+	// locked is true if the wait is due to a full lockout rather than the
+	// backoff delay.
+	locked bool
+	// remaining is the number of failures left before a lockout.
+	remaining int
+}
+
+// loginAttempt is a login attempt which has been counted against the
+// throttle, and status is whether it may go ahead.
+type loginAttempt struct {
+	id     int64
+	email  string
+	ip     string
+	status loginStatus
+}
+
+// The beginLogin helper counts a login attempt for the email from the ip
+// against the throttle, before the password is checked, and reports whether
+// it may go ahead. The attempt is stored as a failure before the recent
+// failures are counted, so that of any number of guesses sent at once, only
+// as many get through as the throttle would allow one after another. An
+// attempt which isn't allowed is taken back again, so trying while throttled
+// doesn't make the wait any longer.
+func (app *application) beginLogin(email, ip string) (*loginAttempt, error) {
+	t := app.loginThrottle
+	now := time.Now().UTC()
+
+	id, err := app.loginAttempts.Begin(email, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := app.loginAttempts.Failures(email, ip, now.Add(-t.window), id)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &loginAttempt{id: id, email: email, ip: ip, status: t.check(f, now)}
+	if a.status.retryAfter > 0 {
+		if err := app.loginAttempts.Cancel(id); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// The check() method works out the status of an attempt made at now, given
+// the recent failures for the account and the IP.
+func (t loginThrottle) check(f *models.LoginFailures, now time.Time) loginStatus {
+	status := loginStatus{remaining: max(t.maxFailures-f.Account, 0)}
+
+	wait := func(last time.Time, d time.Duration) time.Duration {
+		return last.Add(d).Sub(now).Round(time.Second)
+	}
+
+	switch {
+	case f.IP >= t.maxIPFailures:
+		status.retryAfter = wait(f.LastIPFailure, t.lockout)
+		status.locked = true
+	case f.Account >= t.maxFailures:
+		status.retryAfter = wait(f.LastAccountFailure, t.lockout)
+		status.locked = true
+	case f.Account >= t.freeAttempts:
+		// The delay is capped at the lockout anyway, and a bigger shift
+		// could overflow a Duration and turn the backoff off.
+		delay := t.baseDelay << min(f.Account-t.freeAttempts, 20)
+		status.retryAfter = wait(f.LastAccountFailure, min(delay, t.lockout))
+	}
+
+	// Once the wait has passed the attempt may go ahead, and it isn't
+	// locked any more.
+	if status.retryAfter <= 0 {
+		status.retryAfter = 0
+		status.locked = false
+	}
+
+	return status
+}
+
+// The finishLogin helper records the outcome of an attempt which went ahead
+// and writes it to the audit log. The attempt is already counted as a
+// failure, so only a success needs storing.
+func (app *application) finishLogin(a *loginAttempt, userID int, succeeded bool) error {
+	event := models.EventLoginFailure
+	if succeeded {
+		event = models.EventLoginSuccess
+	}
+
+	if err := app.auditLog.Insert(userID, a.ip, app.geoIP.country(a.ip), event, a.email); err != nil {
+		app.errorLog.Output(2, err.Error())
+	}
+
+	if !succeeded {
+		return nil
+	}
+	return app.loginAttempts.Succeeded(a.id)
+}
+
+// The expireLoginAttempts method deletes login attempts which are older than
+// the throttle window every interval, until the application shuts down.
+// They're never counted again, and without this a brute-force attack would
+// leave the table growing for good.
+func (app *application) expireLoginAttempts(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Tables may be half-migrated in maintenance mode.
+		if !app.maintenance.Load() {
+			n, err := app.loginAttempts.DeleteBefore(time.Now().Add(-app.loginThrottle.window))
+			if err != nil {
+				app.errorLog.Printf("expiring login attempts: %v", err)
+			} else if n > 0 {
+				app.infoLog.Printf("Deleted %d expired login attempts", n)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-app.shutdown:
+			return
+		}
+	}
+}
+
+// The failed() method returns the status after one more failed attempt.
+func (s loginStatus) failed() loginStatus {
+	s.remaining = max(s.remaining-1, 0)
+	return s
+}
+
+// The message methods build the user-facing text for a throttled or failed
+// login. They say the same thing whether or not an account exists for the
+// email address, so they can't be used to enumerate accounts. The number of
+// remaining attempts is only mentioned once it's getting low.
+func (s loginStatus) throttledMessage() string {
+	if s.locked {
+		return fmt.Sprintf("Too many failed login attempts. Please try again in %s.", humanDuration(s.retryAfter))
+	}
+	return fmt.Sprintf("Please wait %s before trying again.", humanDuration(s.retryAfter))
+}
+
+func (s loginStatus) failedMessage() string {
+	msg := "Email or password is incorrect"
+	switch {
+	case s.remaining == 1:
+		msg += " (1 attempt remaining before a temporary lockout)"
+	case s.remaining > 1 && s.remaining <= 3:
+		msg += fmt.Sprintf(" (%d attempts remaining before a temporary lockout)", s.remaining)
+	}
+	return msg
+}
+
+func humanDuration(d time.Duration) string {
+	switch {
+	case d >= 2*time.Minute:
+		return fmt.Sprintf("%d minutes", int(d.Round(time.Minute).Minutes()))
+	case d >= time.Minute:
+		return "1 minute"
+	case d > time.Second:
+		return fmt.Sprintf("%d seconds", int(d.Seconds()))
+	default:
+		return "1 second"
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+func TestLoginThrottleCheck(t *testing.T) {
+	throttle := loginThrottle{
+		freeAttempts:  3,
+		baseDelay:     time.Second,
+		maxFailures:   10,
+		maxIPFailures: 50,
+		lockout:       15 * time.Minute,
+		window:        time.Hour,
+	}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+
+	tests := []struct {
+		name          string
+		failures      models.LoginFailures
+		wantRetry     time.Duration
+		wantLocked    bool
+		wantRemaining int
+	}{
+		{
+			name:          "No failures",
+			wantRemaining: 10,
+		},
+		{
+			name:          "Free attempts",
+			failures:      models.LoginFailures{Account: 2, LastAccountFailure: now},
+			wantRemaining: 8,
+		},
+		{
+			name:          "First delay",
+			failures:      models.LoginFailures{Account: 3, LastAccountFailure: now},
+			wantRetry:     time.Second,
+			wantRemaining: 7,
+		},
+		{
+			name:          "Doubled delay",
+			failures:      models.LoginFailures{Account: 5, LastAccountFailure: now},
+			wantRetry:     4 * time.Second,
+			wantRemaining: 5,
+		},
+		{
+			name:          "Delay passed",
+			failures:      models.LoginFailures{Account: 5, LastAccountFailure: ago(10 * time.Second)},
+			wantRemaining: 5,
+		},
+		{
+			name:       "Account locked",
+			failures:   models.LoginFailures{Account: 10, LastAccountFailure: now},
+			wantRetry:  15 * time.Minute,
+			wantLocked: true,
+		},
+		{
+			name:       "Account lockout partly served",
+			failures:   models.LoginFailures{Account: 12, LastAccountFailure: ago(5 * time.Minute)},
+			wantRetry:  10 * time.Minute,
+			wantLocked: true,
+		},
+		{
+			name:          "Account lockout served",
+			failures:      models.LoginFailures{Account: 10, LastAccountFailure: ago(20 * time.Minute)},
+			wantRemaining: 0,
+		},
+		{
+			name:          "IP locked",
+			failures:      models.LoginFailures{IP: 50, LastIPFailure: ago(time.Minute)},
+			wantRetry:     14 * time.Minute,
+			wantLocked:    true,
+			wantRemaining: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := throttle.check(&tt.failures, now)
+
+			if got.retryAfter != tt.wantRetry {
+				t.Errorf("got retryAfter %v; want %v", got.retryAfter, tt.wantRetry)
+			}
+			if got.locked != tt.wantLocked {
+				t.Errorf("got locked %t; want %t", got.locked, tt.wantLocked)
+			}
+			if got.remaining != tt.wantRemaining {
+				t.Errorf("got remaining %d; want %d", got.remaining, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestBeginLoginConcurrent(t *testing.T) {
+	app, _ := newTestApplication(t)
+
+	// Guesses sent all at once must be throttled just as if they'd been sent
+	// one after another: only the free attempts may go ahead.
+	const guesses = 20
+
+	statuses := make(chan loginStatus, guesses)
+	var wg sync.WaitGroup
+	for range guesses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a, err := app.beginLogin("alice@example.com", "192.0.2.1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			statuses <- a.status
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	allowed := 0
+	for status := range statuses {
+		if status.retryAfter == 0 {
+			allowed++
+		}
+	}
+	if allowed != app.loginThrottle.freeAttempts {
+		t.Errorf("got %d of %d guesses allowed; want %d", allowed, guesses, app.loginThrottle.freeAttempts)
+	}
+
+	// The throttled guesses were taken back, so only the ones which went
+	// ahead are counted.
+	f, err := app.loginAttempts.Failures("alice@example.com", "192.0.2.1", time.Now().Add(-time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Account != allowed {
+		t.Errorf("got %d failures counted; want %d", f.Account, allowed)
+	}
+}
+
+func TestBeginLoginAfterSuccess(t *testing.T) {
+	app, _ := newTestApplication(t)
+
+	a, err := app.beginLogin("alice@example.com", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.loginAttempts.Succeeded(a.id); err != nil {
+		t.Fatal(err)
+	}
+
+	// A successful login starts the account's count again.
+	a, err = app.beginLogin("alice@example.com", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.status.remaining != app.loginThrottle.maxFailures {
+		t.Errorf("got %d remaining; want %d", a.status.remaining, app.loginThrottle.maxFailures)
+	}
+}
+
+func TestLoginStatusMessages(t *testing.T) {
+	tests := []struct {
+		name   string
+		status loginStatus
+		want   string
+	}{
+		{"Many remaining", loginStatus{remaining: 10}.failed(), "Email or password is incorrect"},
+		{"Three remaining", loginStatus{remaining: 4}.failed(), "Email or password is incorrect (3 attempts remaining before a temporary lockout)"},
+		{"One remaining", loginStatus{remaining: 2}.failed(), "Email or password is incorrect (1 attempt remaining before a temporary lockout)"},
+		{"None remaining", loginStatus{}.failed(), "Email or password is incorrect"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.status.failedMessage(); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+
+	locked := loginStatus{retryAfter: 15 * time.Minute, locked: true}
+	if got, want := locked.throttledMessage(), "Too many failed login attempts. Please try again in 15 minutes."; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	delayed := loginStatus{retryAfter: 4 * time.Second}
+	if got, want := delayed.throttledMessage(), "Please wait 4 seconds before trying again."; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestHumanDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "1 second"},
+		{time.Second, "1 second"},
+		{4 * time.Second, "4 seconds"},
+		{time.Minute, "1 minute"},
+		{119 * time.Second, "1 minute"},
+		{2 * time.Minute, "2 minutes"},
+		{14*time.Minute + 31*time.Second, "15 minutes"},
+	}
+
+	for _, tt := range tests {
+		if got := humanDuration(tt.d); got != tt.want {
+			t.Errorf("humanDuration(%v) = %q; want %q", tt.d, got, tt.want)
+		}
+	}
+}
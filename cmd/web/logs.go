@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"snippetbox.floccinau.net/internal/logfile"
+)
+
+// logOutputs opens the files the info, error and access logs are written
+// to, all rotated the same way, and keeps them so they can be reopened.
+type logOutputs struct {
+	opts  logfile.Options
+	files []*logfile.File
+}
+
+// open returns where a log with the path given on the command line should
+// be written: std if the path is empty, stdout if it's "-", and otherwise
+// a log file.
+func (o *logOutputs) open(path string, std io.Writer) (io.Writer, error) {
+	switch path {
+	case "":
+		return std, nil
+	case "-":
+		return os.Stdout, nil
+	}
+
+	f, err := logfile.Open(path, o.opts)
+	if err != nil {
+		return nil, err
+	}
+	o.files = append(o.files, f)
+	return f, nil
+}
+
+// reopenOnHangup reopens the log files whenever the process gets SIGHUP, as
+// logrotate's postrotate scripts expect after they've moved the logs away.
+func (o *logOutputs) reopenOnHangup(errorLog *log.Logger) {
+	if len(o.files) == 0 {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			for _, f := range o.files {
+				if err := f.Reopen(); err != nil {
+					errorLog.Print(err)
+				}
+			}
+		}
+	}()
+}
+
+// Close closes the log files.
+func (o *logOutputs) Close() {
+	for _, f := range o.files {
+		f.Close()
+	}
+}
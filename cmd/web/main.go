@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
 	"flag"
+	"fmt"
+	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	// Chapter 4.5: Designing a database model |
 	// Import the models package that we just created. You need to prefix this with
@@ -15,7 +24,21 @@ import (
 	// used, you can find it at the top of the go.mod file.
 	"snippetbox.floccinau.net/internal/models"
 
-	_ "github.com/go-sql-driver/mysql"
+	"snippetbox.floccinau.net/internal/crypto"
+	"snippetbox.floccinau.net/internal/errreport"
+	"snippetbox.floccinau.net/internal/logfile"
+	"snippetbox.floccinau.net/internal/moderation"
+	"snippetbox.floccinau.net/internal/pubsub"
+	"snippetbox.floccinau.net/internal/secrets"
+	"snippetbox.floccinau.net/internal/session"
+	"snippetbox.floccinau.net/internal/sqltrace"
+	"snippetbox.floccinau.net/internal/storage"
+	"snippetbox.floccinau.net/internal/virusscan"
+	"snippetbox.floccinau.net/internal/worker"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/graphql-go/graphql"
+	"github.com/redis/go-redis/v9"
 )
 
 // Define an application struct to hold the application-wide dependencies for the
@@ -23,11 +46,81 @@ import (
 // we'll add more to it as the build progresses.
 // Chapter 4.5: Designing a database model |
 // Add a snippets field to the application struct. This will allow us to
-// make the SnippetModel object available to our handlers.
+// make the SnippetModel object available to our handlers. The snippets,
+// users, permissions, orgs, comments, stars, follows, collections and
+// attachments fields are interfaces, so that tests can swap in the in-memory
+// models from internal/models/mocks.
 type application struct {
-	errorLog *log.Logger
-	infoLog  *log.Logger
-	snippets *models.SnippetModel
+	errorLog        *log.Logger
+	infoLog         *log.Logger
+	accessLog       *log.Logger
+	errReporter     *errreport.Reporter
+	securityTxtBody []byte
+	db              *sql.DB
+	replicas        *models.Replicas
+	keys            *crypto.Keyring
+	version         buildInfo
+	snippets        models.SnippetStore
+	users           models.UserStore
+	tokens          *models.TokenModel
+	rememberTokens  *models.RememberTokenModel
+	invites         *models.InviteModel
+	registration    registrationMode
+	permissions     models.PermissionStore
+	auth            authenticator
+	oidc            *oidcProvider
+	identities      models.IdentityStore
+	orgs            models.OrgStore
+	comments        models.CommentStore
+	stars           models.StarStore
+	revisions       *models.RevisionModel
+	loginAttempts   models.LoginAttemptStore
+	auditLog        models.AuditStore
+	templateCache   map[string]*template.Template
+	dev             bool
+	timeouts        requestTimeouts
+	sessionManager  *session.Manager
+	loginThrottle   loginThrottle
+	cardCache       *cardCache
+	thumbCache      *thumbCache
+	unlockLimiter   *attemptLimiter
+	attachments     models.AttachmentStore
+	blobs           storage.Blobs
+	maxUploadSize   int64
+	maxSnippetSize  int64
+	downloadSecret  []byte
+	cookies         cookieConfig
+	trustedOrigins  []string
+	rateLimits      apiRateLimits
+	anonymous       anonymousPosting
+	captcha         captchaVerifier
+	captchaAfter    int
+	signupChallenge challenger
+	moderation      *moderation.Pipeline
+	reports         *models.ReportModel
+	reportThreshold int
+	gravatar        bool
+	canonicalHost   string
+	altSvc          string
+	trustedProxies  trustedProxies
+	ipFilter        *ipFilter
+	geoIP           *geoIP
+	ipBans          *models.IPBanModel
+	secretScanner   *secrets.Scanner
+	secretFindings  *models.SecretFindingModel
+	virusScanner    virusscan.Scanner
+	follows         models.FollowStore
+	collections     models.CollectionStore
+	views           *viewCounter
+	related         *relatedCache
+	webhooks        *models.WebhookModel
+	webhookClient   *http.Client
+	jobs            *worker.Queue
+	maintenance     atomic.Bool
+	events          *pubsub.Hub
+	graphQLSchema   graphql.Schema
+	shutdown        chan struct{}
+	wg              sync.WaitGroup
 }
 
 func main() {
@@ -37,11 +130,266 @@ func main() {
 	// flag will be stored in the addr variable at runtime.
 	// example: go run ./cmd/web -addr=":9999"
 	// Note: you may use the -help flag to list all the avaliable command-line flags
+	// The value returned from the flag.String() is a pointer to the flag
+	// value, not the value itself. So we need to dereference the pointer (i.e.
+	// prefix it with the * symbol) before using it.
 	addr := flag.String("addr", ":4000", "HTTP network address")
 
+	// Behind a reverse proxy on the same machine, the server can listen on a
+	// Unix socket instead. When systemd starts it through socket activation,
+	// it uses the socket systemd passes in and ignores both.
+	listenSpec := flag.String("listen", "", "Listen on a Unix socket instead of -addr (e.g. unix:/run/snippetbox/web.sock)")
+
+	// The client address is only taken from X-Forwarded-For or X-Real-IP,
+	// and the scheme and host from X-Forwarded-Proto and X-Forwarded-Host,
+	// on requests from these proxies.
+	trustedProxyList := flag.String("trusted-proxies", "", `Reverse proxies to take the client IP, scheme and host from (space separated IPs and CIDR ranges, "unix" for a Unix socket)`)
+
+	// Requests can be limited to some addresses, or turned away from
+	// others, by files of IPs and CIDR ranges. They're read again on
+	// SIGHUP, along with the bans made on the admin pages.
+	ipAllowlist := flag.String("ip-allowlist", "", "File of IPs and CIDR ranges, one per line, which are the only ones let in")
+	ipDenylist := flag.String("ip-denylist", "", "File of IPs and CIDR ranges, one per line, which are turned away")
+
+	// A GeoIP database tags requests with the country they came from, for
+	// the logs. People in some countries can be stopped from posting
+	// without an account, or allowed fewer anonymous snippets.
+	geoIPDB := flag.String("geoip-db", "", "MaxMind GeoIP country or city database (.mmdb) to look up visitors' countries in")
+	geoIPBlock := flag.String("geoip-block", "", `Space-separated country codes which can't post without an account (e.g. "XX YY")`)
+	geoIPLimit := flag.String("geoip-limit", "", "Space-separated country codes which get -geoip-limit-snippets instead of -anon-snippets")
+	geoIPLimitSnippets := flag.Int("geoip-limit-snippets", 1, "Most anonymous snippets per hour from one IP address in a -geoip-limit country")
+
+	// New and edited snippets are scanned for credentials, like access keys
+	// and private keys, which are blocked, redacted or warned about. The
+	// built-in rules can be replaced with a JSON file of rules.
+	secretScan := flag.Bool("secret-scan", true, "Scan snippets for credentials before publishing them")
+	secretRules := flag.String("secret-rules", "", "JSON file of secret scanning rules to use instead of the built-in ones")
+
+	// Attachments can be checked for viruses by clamd or an ICAP server
+	// after they're uploaded, e.g. -virus-scanner=clamav://localhost:3310
+	// or -virus-scanner=icap://av.example.com:1344/avscan.
+	virusScannerURL := flag.String("virus-scanner", "", "clamav:// or icap:// address of a virus scanner for attachments")
+
+	// With a certificate and key the site is served over HTTPS on -addr, and
+	// a second listener on -http-addr redirects plain HTTP to it. Requests
+	// for any host other than -canonical-host are redirected there.
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file (serves HTTPS when set with -tls-key)")
+	tlsKey := flag.String("tls-key", "", "TLS private key file")
+	httpAddr := flag.String("http-addr", ":80", "Address to redirect plain HTTP to HTTPS from, when TLS is on")
+	canonicalHost := flag.String("canonical-host", "", "Host name to redirect all other host names to (e.g. snippetbox.example.com)")
+	acmeWebroot := flag.String("acme-webroot", "", "Directory to serve ACME HTTP-01 challenges from (the webroot given to certbot)")
+
+	// With TLS, the site can be served over HTTP/3 too, on the same port
+	// over UDP. Responses over HTTPS advertise it with an Alt-Svc header.
+	useHTTP3 := flag.Bool("http3", false, "Also serve HTTPS over HTTP/3 (QUIC) on the UDP port of -addr")
+
+	// Instead of a certificate and key, the server can get its own
+	// certificates from Let's Encrypt for the hosts in -autocert-hosts, or
+	// for -canonical-host if that's not set.
+	useAutocert := flag.Bool("autocert", false, "Get and renew TLS certificates from Let's Encrypt automatically")
+	autocertDir := flag.String("autocert-dir", "./certs", "Directory for caching certificates from Let's Encrypt")
+	autocertHosts := flag.String("autocert-hosts", "", "Host names to get certificates for (space separated)")
+	autocertEmail := flag.String("autocert-email", "", "Contact address for Let's Encrypt about problems with the certificates")
+
 	// Chapter 4.4 Creating a database connection pool |
 	dsn := flag.String("dsn", "web:pass@/snippetbox?parseTime=true", "MySQL data source name")
 
+	// Reads which can stand to be a moment out of date can be sent to read
+	// replicas instead, which are checked every so often so that those which
+	// are down are skipped.
+	dsnReplicas := flag.String("dsn-replicas", "", "Comma-separated data source names of MySQL read replicas to send reads to")
+	replicaCheckInterval := flag.Duration("replica-check-interval", 10*time.Second, "How often to check that the read replicas are up")
+
+	// Transactions and reads which fail with a transient error, like a
+	// deadlock or a lost connection, are tried again after a short wait.
+	dbRetries := flag.Int("db-retries", models.Retries.Attempts, "Most tries of a database operation which fails with a transient error (1 to not retry)")
+	dbRetryDelay := flag.Duration("db-retry-delay", models.Retries.BaseDelay, "Wait before retrying a database operation, doubled after each try")
+
+	// Brute-force protection for logins: how many consecutive failures an
+	// account may have before it's locked, and for how long.
+	loginMaxFailures := flag.Int("login-max-failures", 10, "Failed logins before an account is temporarily locked")
+	loginLockout := flag.Duration("login-lockout", 15*time.Minute, "How long an account or IP stays locked after too many failed logins")
+
+	// The keys which snippet content is encrypted with at rest, as a
+	// comma-separated list of base64-encoded 32-byte keys. The first key is
+	// used for new content; any others are old keys which are still needed to
+	// read content that hasn't been re-encrypted with cmd/rekey yet.
+	contentKey := flag.String("content-key", os.Getenv("SNIPPETBOX_CONTENT_KEY"), "Base64 keys for encrypting snippet content (comma-separated, newest first)")
+
+	// Where uploaded attachments are stored, how big they may be, and the
+	// secret which attachment download links are signed with. Cookies which
+	// hold secrets are encrypted with a key made from it too. If no secret
+	// is given a random one is used, which means links stop working when the
+	// application restarts.
+	storageBackend := flag.String("storage", "disk", `Where to store attachments: "disk" or "s3" (configured with SNIPPETBOX_S3_* environment variables)`)
+	uploadDir := flag.String("upload-dir", "./uploads", "Directory for storing snippet attachments on disk")
+	maxUploadSize := flag.Int64("max-upload-size", 5<<20, "Largest attachment that can be uploaded, in bytes")
+	maxSnippetSize := flag.Int64("max-snippet-size", 1<<20, "Largest snippet content that can be posted, in bytes")
+	downloadSecret := flag.String("download-secret", os.Getenv("SNIPPETBOX_DOWNLOAD_SECRET"), "Secret for signing attachment download links and encrypting cookies")
+
+	// How cookies are sent. They're Secure over HTTPS; -cookie-host-prefix
+	// locks them to this host so that other subdomains can't set them.
+	cookieSecure := flag.Bool("cookie-secure", false, "Mark cookies Secure even without -tls-cert, for when a proxy does the HTTPS")
+	cookieDomain := flag.String("cookie-domain", "", "Domain to send cookies to, to share them with subdomains (e.g. example.com)")
+	cookieSameSite := flag.String("cookie-samesite", "lax", "SameSite mode for cookies: lax or strict")
+	cookieHostPrefix := flag.Bool("cookie-host-prefix", false, "Give cookie names the __Host- prefix (needs HTTPS and no -cookie-domain)")
+
+	// Users who haven't uploaded an avatar are shown with their Gravatar.
+	// Turning it off shows the first letter of their name instead, and
+	// means their browsers never contact gravatar.com.
+	gravatar := flag.Bool("gravatar", true, "Show the Gravatar of users who haven't uploaded an avatar")
+
+	// Web pages on other origins which may call the JSON API from the
+	// browser, e.g. -cors-trusted-origins="https://a.example https://b.example".
+	corsTrustedOrigins := flag.String("cors-trusted-origins", "", "Trusted CORS origins for the API (space separated)")
+
+	// API rate limits, in requests per minute: a ceiling for each IP
+	// address, and quotas for anonymous clients (per IP address) and for
+	// each account. Give a Redis address to share the counts between
+	// several instances of the application; otherwise they're kept in
+	// memory.
+	apiRateIP := flag.Int("api-rate-ip", 300, "Most API requests per minute from one IP address")
+	apiRateAnon := flag.Int("api-rate-anon", 60, "API requests per minute allowed for anonymous clients")
+	apiRateUser := flag.Int("api-rate-user", 600, "API requests per minute allowed for each account")
+	rateLimitRedis := flag.String("ratelimit-redis", "", "Redis address for sharing API rate limits (e.g. localhost:6379)")
+
+	// Signups can be limited to people with an invitation, or turned off.
+	registrationModeFlag := flag.String("registration-mode", "open", "Who can sign up: open, invite (with an invitation) or closed")
+
+	// Passwords can be checked against an LDAP server, such as Active
+	// Directory, instead of the database. Users are found by their email
+	// address, and a local user is made for each the first time they log
+	// in.
+	var ldapConf ldapConfig
+	flag.StringVar(&ldapConf.URL, "ldap-url", "", "LDAP server to check passwords against instead of the database (e.g. ldaps://ldap.example.com)")
+	flag.BoolVar(&ldapConf.StartTLS, "ldap-start-tls", false, "Use StartTLS on an ldap:// connection")
+	flag.StringVar(&ldapConf.BindDN, "ldap-bind-dn", "", "DN to bind as when searching for users (anonymous if empty)")
+	flag.StringVar(&ldapConf.BindPassword, "ldap-bind-password", os.Getenv("SNIPPETBOX_LDAP_BIND_PASSWORD"), "Password for -ldap-bind-dn")
+	flag.StringVar(&ldapConf.BaseDN, "ldap-base-dn", "", "Where to search for users (e.g. ou=people,dc=example,dc=com)")
+	flag.StringVar(&ldapConf.UserFilter, "ldap-user-filter", "(mail=%s)", "Filter which finds a user by the email address they log in with")
+	flag.StringVar(&ldapConf.UsernameAttr, "ldap-username-attr", "uid", `Attribute to make new users' usernames from ("sAMAccountName" for Active Directory)`)
+	flag.StringVar(&ldapConf.Group, "ldap-group", "", "DN of a group which users must be a member of to log in")
+
+	// Or all logins can be handed to an OpenID Connect provider, such as
+	// Keycloak, Okta or Entra ID. The provider's groups or roles can be
+	// mapped to permissions, and it can end sessions with a backchannel
+	// logout.
+	var oidcConf oidcConfig
+	flag.StringVar(&oidcConf.Issuer, "oidc-issuer", "", "OpenID Connect provider to log users in with instead of passwords (e.g. https://id.example.com/realms/main)")
+	flag.StringVar(&oidcConf.ClientID, "oidc-client-id", "", "Client ID registered with the OpenID Connect provider")
+	flag.StringVar(&oidcConf.ClientSecret, "oidc-client-secret", os.Getenv("SNIPPETBOX_OIDC_CLIENT_SECRET"), "Client secret registered with the OpenID Connect provider")
+	oidcScopes := flag.String("oidc-scopes", "openid email profile", "Space-separated scopes to ask the OpenID Connect provider for")
+	flag.StringVar(&oidcConf.RolesClaim, "oidc-roles-claim", "groups", "ID token claim which lists the user's groups or roles")
+	oidcRoleMap := flag.String("oidc-role-map", "", `Space-separated role=permission,... mappings (e.g. "mods=admin:moderate admins=admin:moderate,admin:system")`)
+
+	// Let people create snippets without an account. Anonymous snippets
+	// expire within a week, each IP address can only post a few an hour,
+	// and the browser has to solve a proof-of-work challenge for each one.
+	allowAnonymous := flag.Bool("allow-anonymous", false, "Allow snippets to be created without an account")
+	anonSnippets := flag.Int("anon-snippets", 5, "Most anonymous snippets per hour from one IP address")
+	anonPoWBits := flag.Int("anon-pow-bits", 16, "Difficulty of the proof-of-work challenge for anonymous snippets, in bits")
+
+	// Signups and anonymous snippets can ask for a CAPTCHA from Cloudflare
+	// Turnstile or hCaptcha instead, but only from visitors who look like
+	// bots: those without the headers browsers send, and addresses which
+	// load the form more than -captcha-after times an hour.
+	captchaKind := flag.String("captcha", "", "CAPTCHA service for risky signups and anonymous snippets: turnstile or hcaptcha")
+	captchaSiteKey := flag.String("captcha-site-key", "", "Site key from the CAPTCHA service")
+	captchaSecret := flag.String("captcha-secret", os.Getenv("SNIPPETBOX_CAPTCHA_SECRET"), "Secret key from the CAPTCHA service")
+	captchaAfter := flag.Int("captcha-after", 3, "Forms an IP address can load in an hour before it's asked for a CAPTCHA (0 to always ask)")
+
+	// New snippets are checked for spam, and held for an administrator to
+	// review if any check flags them. Each check can be turned off: set the
+	// link limits to 0, leave the word list and spam service empty, or set
+	// -duplicate-max to 0.
+	maxLinks := flag.Int("moderation-max-links", 20, "Hold snippets with more links than this for review")
+	maxLinkRatio := flag.Float64("moderation-link-ratio", 0.5, "Hold snippets where links make up more than this fraction of the text")
+	bannedWords := flag.String("banned-words", "", "File of banned words or phrases, one per line")
+	duplicateMax := flag.Int("duplicate-max", 3, "Hold snippets whose content has been posted more than this many times in an hour")
+	spamCheckURL := flag.String("spam-check-url", "", "URL of an external spam-checking service")
+
+	// Snippets reported by this many different people are hidden until an
+	// administrator has reviewed them. 0 never hides reported snippets.
+	reportThreshold := flag.Int("report-threshold", 3, "Hide snippets after this many reports")
+
+	// Webhooks are normally only delivered to public addresses. Allow
+	// private ones when developing against a receiver on the same machine.
+	webhookAllowPrivate := flag.Bool("webhook-allow-private", false, "Allow webhooks to be delivered to private and loopback addresses")
+
+	// Background jobs, like webhook deliveries, are queued in the database
+	// so that they survive restarts and can be shared between instances.
+	// The memory queue is handy for development.
+	queueBackend := flag.String("queue", "mysql", `Where to queue background jobs: "mysql" or "memory"`)
+	workers := flag.Int("workers", 4, "Number of background jobs to run at once")
+
+	// Development mode re-reads the templates on every request and shows
+	// template errors in the browser. Don't use it in production.
+	dev := flag.Bool("dev", false, "Development mode: reload templates on each request")
+
+	// How long requests get to finish before they're given up on. Uploads
+	// can take longer.
+	requestTimeout := flag.Duration("request-timeout", 10*time.Second, "How long pages and API requests get to finish")
+	uploadTimeout := flag.Duration("upload-timeout", time.Minute, "How long uploads get to finish")
+
+	// Queries which take longer than this are logged. Timings for every
+	// query are shown at /debug/vars either way.
+	slowQueryThreshold := flag.Duration("slow-query-threshold", 200*time.Millisecond, "Log database queries which take longer than this (0 to log none)")
+
+	// Every request can be logged to an access log, apart from the info and
+	// error logs, in the format log analyzers expect.
+	accessLogPath := flag.String("access-log", "", `File to write an access log to in the Combined Log Format ("-" for stdout)`)
+
+	// The info and error logs go to stdout and stderr unless they're given
+	// files. Log files are rotated when they reach -log-max-size or every
+	// -log-rotate, whichever comes first, and reopened on SIGHUP for tools
+	// like logrotate.
+	infoLogPath := flag.String("info-log", "", "File to write the info log to (default stdout)")
+	errorLogPath := flag.String("error-log", "", "File to write the error log to (default stderr)")
+	logMaxSize := flag.Int64("log-max-size", 100, "Rotate log files when they reach this many megabytes (0 for no limit)")
+	logRotate := flag.Duration("log-rotate", 0, "Rotate log files this often, e.g. 24h for every day at midnight UTC (0 for never)")
+	logMaxBackups := flag.Int("log-max-backups", 10, "Most rotated log files to keep for each log (0 for all)")
+	logMaxAge := flag.Duration("log-max-age", 30*24*time.Hour, "How long to keep rotated log files (0 for ever)")
+
+	// Server errors and panics can also be sent to Sentry, or anything else
+	// which speaks its protocol.
+	sentryDSN := flag.String("sentry-dsn", os.Getenv("SENTRY_DSN"), "DSN of the Sentry project to report errors to")
+	sentryEnvironment := flag.String("sentry-environment", "production", "Environment to report errors from")
+	sentrySampleRate := flag.Float64("sentry-sample-rate", 1, "Fraction of errors to report, from 0 to 1")
+
+	// The profiling endpoints under /debug are always available to admins.
+	// They can also be served without logging in on a separate address, which
+	// must be on the loopback interface.
+	debugAddr := flag.String("debug-addr", "", "Loopback address to serve the /debug endpoints on without authentication (e.g. localhost:6060)")
+
+	// The TCP paste listener takes pastes piped to netcat, like termbin.com.
+	// Its replies are links, so it needs to know the site's address.
+	tcpAddr := flag.String("tcp-addr", "", "Address to accept pastes over plain TCP on (e.g. :9999)")
+	tcpBaseURL := flag.String("tcp-base-url", "", "Base URL of the links the TCP paste listener replies with (default: https:// and the canonical host)")
+	tcpMaxSize := flag.Int64("tcp-max-size", 512<<10, "Largest paste in bytes the TCP paste listener accepts")
+	tcpLimit := flag.Int("tcp-limit", 10, "Most pastes per hour over TCP from one IP address")
+
+	// The gRPC service is for internal services which would rather not use
+	// the JSON API. It's always served over TLS, with the HTTPS certificate
+	// unless it's given its own.
+	grpcAddr := flag.String("grpc-addr", "", "Address to serve the snippetbox.v1 gRPC service on (e.g. :9443)")
+	grpcTLSCert := flag.String("grpc-tls-cert", "", "TLS certificate file for the gRPC service (default -tls-cert)")
+	grpcTLSKey := flag.String("grpc-tls-key", "", "TLS private key file for the gRPC service (default -tls-key)")
+
+	// Maintenance mode makes the site read-only while migrations are run.
+	// Admins can also switch it on and off from the moderation page.
+	maintenance := flag.Bool("maintenance", false, "Start in read-only maintenance mode")
+
+	showVersion := flag.Bool("version", false, "Print the version and exit")
+
+	// security.txt tells security researchers how to report vulnerabilities.
+	securityTxtPath := flag.String("security-txt", "", "File to serve at /.well-known/security.txt")
+
+	// Where to keep the generated snippet preview images and attachment
+	// thumbnails. An empty value turns a cache off and draws every image on
+	// request.
+	cardCacheDir := flag.String("card-cache", filepath.Join(os.TempDir(), "snippetbox-cards"), "Directory for caching snippet preview images")
+	thumbCacheDir := flag.String("thumb-cache", filepath.Join(os.TempDir(), "snippetbox-thumbs"), "Directory for caching attachment thumbnails")
+
 	// Chapter 3.1: Command-line flags |
 	// Importantly, we use the flag.Parse() function to parse the command-line flag.
 	// This reads in the command-line flag value and assigns it to the addr
@@ -50,23 +398,93 @@ func main() {
 	// encountered during parsing the application will be terminated.
 	flag.Parse()
 
+	version := readBuildInfo()
+	if *showVersion {
+		fmt.Printf("snippetbox %s (%s)\n", version, version.GoVersion)
+		return
+	}
+
 	// Chapter 3.2: Leveled logging
 	// Use log.New() to create a logger for writing information messages. This takes
 	// three parameters: the destination to write the logs to (os.Stdout), a string
 	// prefix for message (INFO followed by a tab), and flags to indicate what
 	// additional information to include (local date and time). Note that the flags
 	// are joined using the bitwise OR operator |.
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+	logs := &logOutputs{opts: logfile.Options{
+		MaxSize:    *logMaxSize << 20,
+		Interval:   *logRotate,
+		MaxBackups: *logMaxBackups,
+		MaxAge:     *logMaxAge,
+	}}
+	infoOut, err := logs.open(*infoLogPath, os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	errorOut, err := logs.open(*errorLogPath, os.Stderr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer logs.Close()
+
+	infoLog := log.New(infoOut, "INFO\t", log.Ldate|log.Ltime)
 	// Create a logger for writing error messages in the same way, but use stderr as
 	// the destination and use the log.Lshortfile flag to include the relevant
 	// file name and line number.
-	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+	errorLog := log.New(errorOut, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+
+	var accessLog *log.Logger
+	if *accessLogPath != "" {
+		accessOut, err := logs.open(*accessLogPath, os.Stdout)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		accessLog = log.New(accessOut, "", 0)
+	}
+	logs.reopenOnHangup(errorLog)
+
+	var securityTxt []byte
+	if *securityTxtPath != "" {
+		var expires time.Time
+		securityTxt, expires, err = loadSecurityTxt(*securityTxtPath)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		if time.Now().After(expires) {
+			errorLog.Printf("%s expired on %s", *securityTxtPath, expires.Format(time.DateOnly))
+		}
+	}
+
+	var errReporter *errreport.Reporter
+	if *sentryDSN != "" {
+		errReporter, err = errreport.New(*sentryDSN, errreport.Options{
+			Environment: *sentryEnvironment,
+			Release:     version.String(),
+			SampleRate:  *sentrySampleRate,
+			ErrorLog:    errorLog,
+			ScrubPath:   redactOnceToken,
+		})
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	infoLog.Printf("Snippetbox %s, revision %q, built with %s", version, version.Revision, version.GoVersion)
+
+	// Database operations which fail with a transient error are tried again.
+	models.Retries.Attempts = max(*dbRetries, 1)
+	models.Retries.BaseDelay = *dbRetryDelay
 
 	// Chapter 4.4: Creating a database connection pool |
 	// To keep the main() function tidy I've put the code for creating a connection
 	// pool into the separate openDB() function below.We pass openDB() the DSN
 	// from the command-line flag.
-	db, err := openDB(*dsn)
+	// Every query is timed, and put down to the model method which made it.
+	tracer := &sqltrace.Tracer{
+		SlowThreshold: *slowQueryThreshold,
+		OnSlow:        logSlowQuery(infoLog),
+		CallerPrefix:  "/internal/models.",
+	}
+	db, err := openDB(*dsn, tracer)
 	if err != nil {
 		errorLog.Fatal(err)
 	}
@@ -76,13 +494,255 @@ func main() {
 	// before the main() function exits.
 	defer db.Close()
 
+	// A replica which is down at startup doesn't stop the application from
+	// starting; it's just left out until it's back.
+	var replicas *models.Replicas
+	if *dsnReplicas != "" {
+		replicas = &models.Replicas{}
+		for _, replicaDSN := range strings.Split(*dsnReplicas, ",") {
+			replica, name, err := openReplica(strings.TrimSpace(replicaDSN), tracer)
+			if err != nil {
+				errorLog.Fatal(err)
+			}
+			replicas.Add(name, replica)
+		}
+		defer replicas.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		for _, status := range replicas.Check(ctx) {
+			errorLog.Printf("Read replica %s is down: %s", status.Name, status.Error)
+		}
+		cancel()
+	}
+
+	keys, err := crypto.ParseKeyring(*contentKey)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	if !keys.Enabled() {
+		infoLog.Print("No -content-key set, so snippet content will be stored unencrypted")
+	}
+
+	secret := []byte(*downloadSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			errorLog.Fatal(err)
+		}
+		infoLog.Print("No -download-secret set, so attachment links and remember-me cookies will stop working on restart")
+	}
+
+	var blobs storage.Blobs
+	switch *storageBackend {
+	case "disk":
+		blobs = &storage.Disk{Dir: *uploadDir}
+	case "s3":
+		cfg, err := storage.S3ConfigFromEnv()
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		blobs, err = storage.NewS3(context.Background(), cfg)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	default:
+		errorLog.Fatalf("unknown -storage backend %q", *storageBackend)
+	}
+
+	var geo *geoIP
+	if *geoIPDB != "" {
+		geo, err = openGeoIP(*geoIPDB, *geoIPBlock, *geoIPLimit, *geoIPLimitSnippets)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		defer geo.Close()
+	} else if *geoIPBlock != "" || *geoIPLimit != "" {
+		errorLog.Fatal("-geoip-block and -geoip-limit need -geoip-db")
+	}
+
+	var virusScanner virusscan.Scanner
+	if *virusScannerURL != "" {
+		virusScanner, err = virusscan.New(*virusScannerURL)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	var secretScanner *secrets.Scanner
+	if *secretScan {
+		rules := secrets.DefaultRules()
+		if *secretRules != "" {
+			rules, err = secrets.LoadRules(*secretRules)
+			if err != nil {
+				errorLog.Fatal(err)
+			}
+		}
+		secretScanner, err = secrets.NewScanner(rules)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	var rateStore rateStore = newMemoryRateStore()
+	if *rateLimitRedis != "" {
+		client := redis.NewClient(&redis.Options{Addr: *rateLimitRedis})
+		if err := client.Ping(context.Background()).Err(); err != nil {
+			errorLog.Fatal(err)
+		}
+		defer client.Close()
+		rateStore = &redisRateStore{client: client}
+	}
+
+	registration, err := parseRegistrationMode(*registrationModeFlag)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	var oidcProv *oidcProvider
+	if oidcConf.Issuer != "" {
+		oidcConf.Scopes = strings.Fields(*oidcScopes)
+		oidcConf.RoleMap, err = parseRoleMap(*oidcRoleMap)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		oidcProv, err = newOIDCProvider(ctx, oidcConf)
+		cancel()
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	var captcha captchaVerifier
+	if *captchaKind != "" {
+		captcha, err = newCaptcha(*captchaKind, *captchaSiteKey, *captchaSecret)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	var jobStore worker.Store
+	switch *queueBackend {
+	case "mysql":
+		jobStore = worker.NewMySQLStore(db)
+	case "memory":
+		jobStore = worker.NewMemStore()
+	default:
+		errorLog.Fatalf("unknown -queue backend %q", *queueBackend)
+	}
+
+	jobs := worker.New(jobStore)
+	jobs.Workers = *workers
+	jobs.ErrorLog = errorLog
+
+	checks := []moderation.Check{
+		moderation.LinkDensity{MaxLinks: *maxLinks, MaxRatio: *maxLinkRatio},
+	}
+	if *bannedWords != "" {
+		words, err := moderation.LoadBannedWords(*bannedWords)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		checks = append(checks, words)
+	}
+	if *duplicateMax > 0 {
+		checks = append(checks, moderation.Duplicates{
+			Store:  &models.ContentHashModel{DB: db},
+			Max:    *duplicateMax,
+			Window: time.Hour,
+		})
+	}
+	if *spamCheckURL != "" {
+		checks = append(checks, moderation.External{URL: *spamCheckURL, Client: &http.Client{Timeout: moderationTimeout}})
+	}
+
 	// *Chapter 4.9: Transactions and other details |
 	// trying to add Prepared statements in my db
-	snippets, err := models.NewSnippetModel(db)
+	snippets := models.NewSnippetModel(db)
+	defer snippets.Close()
+	snippets.Keys = keys
+	snippets.Replicas = replicas
+
+	// Fingerprint the static files before parsing the templates, which link
+	// to them by their fingerprinted names. In development mode they're
+	// linked to by their plain names, so that changes show up on the next
+	// refresh.
+	if !*dev {
+		staticAssets, err = loadAssetManifest("./ui/static")
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	// Initialize a new template cache, so that every page template is parsed
+	// once at startup rather than on each request.
+	templateCache, err := newTemplateCache()
 	if err != nil {
 		errorLog.Fatal(err)
 	}
 
+	// Use the session.New() function to initialize a new session manager.
+	// Then we configure it to use our MySQL database as the session store,
+	// and set a lifetime of 12 hours (so that sessions automatically expire
+	// 12 hours after first being created).
+	sessionManager := session.New()
+	sessionManager.Store = session.NewMySQLStore(db, errorLog)
+	sessionManager.Lifetime = 12 * time.Hour
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		errorLog.Fatal("-tls-cert and -tls-key must be set together")
+	}
+	if *useAutocert && *tlsCert != "" {
+		errorLog.Fatal("-autocert can't be used with -tls-cert and -tls-key")
+	}
+	useTLS := *tlsCert != "" || *useAutocert
+	if *useHTTP3 && !useTLS {
+		errorLog.Fatal("-http3 needs -tls-cert and -tls-key, or -autocert")
+	}
+
+	proxies, err := parseTrustedProxies(*trustedProxyList)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	ipf := &ipFilter{allowPath: *ipAllowlist, denyPath: *ipDenylist}
+	err = ipf.loadFiles()
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Over HTTPS cookies are never sent on a plain HTTP request. Behind a
+	// proxy which does the HTTPS, -cookie-secure says so.
+	cookies := cookieConfig{
+		Secure:     useTLS || *cookieSecure,
+		Domain:     *cookieDomain,
+		HostPrefix: *cookieHostPrefix,
+	}
+	cookies.SameSite, err = parseSameSite(*cookieSameSite)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	err = cookies.validate()
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	// The browser comes back from the OpenID Connect provider on a link
+	// from another site, which doesn't bring strict cookies with it.
+	if cookies.SameSite == http.SameSiteStrictMode && oidcProv != nil {
+		errorLog.Fatal("-cookie-samesite=strict can't be used with -oidc-issuer")
+	}
+	sessionManager.Cookie = cookies.session()
+
+	// Passwords are checked against the users in the database, or against
+	// an LDAP server when one is configured.
+	users := &models.UserModel{DB: db}
+	permissions := &models.PermissionModel{DB: db}
+	var auth authenticator = users
+	if ldapConf.URL != "" {
+		auth = &ldapAuthenticator{config: ldapConf, users: users, permissions: permissions, infoLog: infoLog}
+	}
+
 	// Chapter 3.3: Dependency injection |
 	// Initialize a new instance of our application struct, containing the
 	// dependencies.
@@ -90,11 +750,161 @@ func main() {
 	// Initialize a models.SnippetModel instance and add it to the application
 	// dependecnies.
 	app := &application{
-		errorLog: errorLog,
-		infoLog:  infoLog,
-		snippets: snippets,
+		errorLog:        errorLog,
+		infoLog:         infoLog,
+		accessLog:       accessLog,
+		errReporter:     errReporter,
+		securityTxtBody: securityTxt,
+		db:              db,
+		replicas:        replicas,
+		keys:            keys,
+		version:         version,
+		snippets:        snippets,
+		users:           users,
+		auth:            auth,
+		oidc:            oidcProv,
+		identities:      &models.IdentityModel{DB: db},
+		rememberTokens:  &models.RememberTokenModel{DB: db},
+		tokens:          &models.TokenModel{DB: db},
+		invites:         &models.InviteModel{DB: db},
+		registration:    registration,
+		permissions:     permissions,
+		orgs:            &models.OrgModel{DB: db},
+		comments:        &models.CommentModel{DB: db},
+		stars:           &models.StarModel{DB: db, Keys: keys},
+		revisions:       &models.RevisionModel{DB: db, Keys: keys},
+		loginAttempts:   &models.LoginAttemptModel{DB: db},
+		auditLog:        &models.AuditModel{DB: db},
+		templateCache:   templateCache,
+		dev:             *dev,
+		sessionManager:  sessionManager,
+		timeouts: requestTimeouts{
+			page:   *requestTimeout,
+			upload: *uploadTimeout,
+		},
+		loginThrottle: loginThrottle{
+			freeAttempts:  3,
+			baseDelay:     time.Second,
+			maxFailures:   *loginMaxFailures,
+			maxIPFailures: 5 * *loginMaxFailures,
+			lockout:       *loginLockout,
+			window:        time.Hour,
+		},
+		cardCache:  &cardCache{dir: *cardCacheDir},
+		thumbCache: newThumbCache(*thumbCacheDir, 4),
+		// Allow 5 wrong passphrases per IP address and snippet every 15
+		// minutes.
+		unlockLimiter:  newAttemptLimiter(5, 15*time.Minute),
+		attachments:    &models.AttachmentModel{DB: db},
+		blobs:          blobs,
+		maxUploadSize:  *maxUploadSize,
+		maxSnippetSize: *maxSnippetSize,
+		downloadSecret: secret,
+		cookies:        cookies,
+		trustedOrigins: strings.Fields(*corsTrustedOrigins),
+		rateLimits: apiRateLimits{
+			store:  rateStore,
+			window: time.Minute,
+			ip:     *apiRateIP,
+			anon:   *apiRateAnon,
+			user:   *apiRateUser,
+		},
+		anonymous: anonymousPosting{
+			enabled:   *allowAnonymous,
+			limit:     *anonSnippets,
+			window:    time.Hour,
+			challenge: &powChallenger{sessionManager: sessionManager, bits: *anonPoWBits},
+		},
+		moderation:      &moderation.Pipeline{Checks: checks},
+		reports:         &models.ReportModel{DB: db},
+		reportThreshold: *reportThreshold,
+		gravatar:        *gravatar,
+		canonicalHost:   *canonicalHost,
+		trustedProxies:  proxies,
+		ipFilter:        ipf,
+		geoIP:           geo,
+		ipBans:          &models.IPBanModel{DB: db},
+		secretScanner:   secretScanner,
+		secretFindings:  &models.SecretFindingModel{DB: db},
+		virusScanner:    virusScanner,
+		follows:         &models.FollowModel{DB: db, Keys: keys},
+		collections:     &models.CollectionModel{DB: db, Keys: keys},
+		views:           &viewCounter{},
+		related:         &relatedCache{},
+		webhooks:        &models.WebhookModel{DB: db, Keys: keys},
+		webhookClient:   newWebhookClient(*webhookAllowPrivate),
+		jobs:            jobs,
+		// Each /events client can fall 16 snippets behind before it's
+		// disconnected, and there can be up to 1000 clients at once.
+		events:   pubsub.NewHub(16, 1000),
+		shutdown: make(chan struct{}),
+	}
+	app.maintenance.Store(*maintenance)
+
+	app.graphQLSchema, err = app.newGraphQLSchema()
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	err = app.loadIPBans()
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	app.reloadIPFilterOnHangup()
+
+	// Wrap the proof-of-work challenge, and give signups a challenge of
+	// their own, so that risky visitors get a CAPTCHA if one is set up.
+	app.captcha = captcha
+	app.captchaAfter = *captchaAfter
+	app.anonymous.challenge = &captchaChallenger{
+		sessionManager: sessionManager,
+		key:            "captchaCreate",
+		captcha:        captcha,
+		fallback:       app.anonymous.challenge,
+		risky:          app.captchaRisk("create"),
+		clientIP:       app.clientIP,
+	}
+	app.signupChallenge = &captchaChallenger{
+		sessionManager: sessionManager,
+		key:            "captchaSignup",
+		captcha:        captcha,
+		risky:          app.captchaRisk("signup"),
+		clientIP:       app.clientIP,
+	}
+
+	// Clean up attachment and avatar files which no longer belong to any
+	// snippet or user.
+	app.background(func() { app.collectOrphanedBlobs(6 * time.Hour) })
+
+	// Delete login attempts which the throttle no longer counts every 5
+	// minutes, as the session store does with expired sessions.
+	app.background(func() { app.expireLoginAttempts(5 * time.Minute) })
+
+	// Save the counted snippet views every 30 seconds.
+	app.background(func() { app.flushViews(30 * time.Second) })
+
+	if replicas.Len() > 0 {
+		app.background(func() { app.checkReplicas(*replicaCheckInterval) })
 	}
 
+	// Register the handlers for each kind of background job, then start
+	// the workers. The webhook client gives up after 30 seconds, so a
+	// delivery never needs longer than that.
+	jobs.Register(webhookJob, app.deliverWebhook, worker.Options{
+		MaxAttempts: maxWebhookAttempts,
+		Timeout:     45 * time.Second,
+	})
+	jobs.Register(snippetPublishJob, app.publishScheduled, worker.Options{})
+	jobs.Register(gistImportJob, app.importGists, worker.Options{
+		MaxAttempts: 10,
+		Timeout:     4 * time.Minute,
+	})
+	jobs.Register(attachmentScanJob, app.scanAttachment, worker.Options{
+		MaxAttempts: 10,
+		Timeout:     3 * time.Minute,
+	})
+	jobs.Start()
+
 	// Chapter 3.2: The http.Server error log
 	// Initialize a new http.Server struct. We set the Addr and Handler fields so
 	// that the server uses the same network address and routes before, and set
@@ -107,28 +917,180 @@ func main() {
 		Handler: app.routes(),
 	}
 
-	// The value returned from the flag.String() is a pointer to the flag
-	// value, not the value itself. So we need to dereference the pointer (i.e.
-	// prefix it with the * symbol) before using it. Note that we're using the
-	// log.Printf() function to interpolate the address with the log message.
-	infoLog.Printf("Starting server on %s", *addr)
+	// Event streams never finish by themselves, so end them when the server
+	// shuts down.
+	srv.RegisterOnShutdown(app.events.Close)
+
+	ln, err := listen(*listenSpec, *addr)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	servers := []*server{{name: "server", srv: srv, ln: ln, certFile: *tlsCert, keyFile: *tlsKey}}
+
+	// With TLS, a second server redirects plain HTTP to HTTPS.
+	if useTLS {
+		srv.TLSConfig = tlsConfig()
+		srv.Protocols = httpsProtocols()
+		redirect := app.redirectToHTTPS(*addr, *acmeWebroot)
+
+		// The certificate manager answers the HTTP-01 challenges on the
+		// plain HTTP listener itself, and passes everything else on.
+		if *useAutocert {
+			hosts := strings.Fields(*autocertHosts)
+			if len(hosts) == 0 && *canonicalHost != "" {
+				hosts = []string{*canonicalHost}
+			}
+			if len(hosts) == 0 {
+				errorLog.Fatal("-autocert needs -autocert-hosts or -canonical-host")
+			}
+
+			certManager := newCertManager(*autocertDir, *autocertEmail, hosts)
+			srv.TLSConfig = autocertTLSConfig(certManager)
+			redirect = certManager.HTTPHandler(redirect)
+		}
+
+		// The HTTP/3 server shares the HTTPS server's routes and
+		// certificates.
+		if *useHTTP3 {
+			h3, err := newHTTP3Server(*addr, srv.Handler, srv.TLSConfig, *tlsCert, *tlsKey)
+			if err != nil {
+				errorLog.Fatal(err)
+			}
+			app.altSvc, err = altSvcHeader(*addr)
+			if err != nil {
+				errorLog.Fatalf("-http3: %v", err)
+			}
+
+			servers = append(servers, &server{name: "HTTP/3 server", addr: *addr, srv: h3})
+		}
+
+		servers = append(servers, &server{
+			name: "HTTPS redirector",
+			addr: *httpAddr,
+			srv: &http.Server{
+				Addr:              *httpAddr,
+				ErrorLog:          errorLog,
+				Handler:           redirect,
+				ReadHeaderTimeout: 5 * time.Second,
+			},
+		})
+	}
+
+	publishDebugVars(db, replicas, tracer)
+
+	// The debug server doesn't check who's asking, so it's only ever served
+	// on the loopback interface.
+	if *debugAddr != "" {
+		err = checkDebugAddr(*debugAddr)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+
+		servers = append(servers, &server{
+			name: "debug server",
+			addr: *debugAddr,
+			srv: &http.Server{
+				Addr:     *debugAddr,
+				ErrorLog: errorLog,
+				Handler:  app.debugRoutes(),
+			},
+		})
+	}
+
+	if *tcpAddr != "" {
+		baseURL := *tcpBaseURL
+		if baseURL == "" {
+			if *canonicalHost == "" {
+				errorLog.Fatal("-tcp-addr needs -tcp-base-url or -canonical-host")
+			}
+			baseURL = "https://" + *canonicalHost
+		}
+
+		servers = append(servers, &server{
+			name: "TCP paste listener",
+			addr: *tcpAddr,
+			srv: &pasteListener{
+				app:     app,
+				baseURL: strings.TrimSuffix(baseURL, "/"),
+				maxSize: *tcpMaxSize,
+				limit:   *tcpLimit,
+				window:  time.Hour,
+			},
+		})
+	}
+
+	if *grpcAddr != "" {
+		certFile, keyFile := *grpcTLSCert, *grpcTLSKey
+		if certFile == "" && keyFile == "" {
+			certFile, keyFile = *tlsCert, *tlsKey
+		}
+		if certFile == "" || keyFile == "" {
+			errorLog.Fatal("-grpc-addr needs -grpc-tls-cert and -grpc-tls-key, or -tls-cert and -tls-key")
+		}
+
+		// Without a canonical host, the server doesn't know its own
+		// address, so snippets are sent without their links.
+		baseURL := ""
+		if *canonicalHost != "" {
+			baseURL = "https://" + *canonicalHost
+		}
+
+		grpcSrv, err := app.newGRPCServer(certFile, keyFile, baseURL)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+
+		servers = append(servers, &server{
+			name: "gRPC server",
+			addr: *grpcAddr,
+			srv:  grpcServer{grpcSrv},
+		})
+	}
 
 	// Chapter 4.4: Creating a database connection pool |
 	// Because the err variable is now already declared in the code above, we need
 	// to use the assignment operator = here, instead of the := 'declare and adsign'
 	// operator
-	err = srv.ListenAndServe()
-	errorLog.Fatal(err)
+	err = app.run(servers...)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	infoLog.Print("Stopped server")
 }
 
 // Chapter 4.4: Creating a database connection pool |
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
+// The connections are wrapped so that queries are traced with tracer.
+func openDB(dsn string, tracer *sqltrace.Tracer) (*sql.DB, error) {
+	cfg, err := mysql.ParseDSN(dsn)
 	if err != nil {
 		return nil, err
 	}
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db := sql.OpenDB(sqltrace.Wrap(connector, tracer))
 	if err = db.Ping(); err != nil {
 		return nil, err
 	}
 	return db, nil
 }
+
+// openReplica is like openDB, but for a read replica. It returns the
+// replica's address to report it by too, and doesn't check that the replica
+// can be reached, since one which is down is skipped until it's back.
+func openReplica(dsn string, tracer *sqltrace.Tracer) (*sql.DB, string, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, "", err
+	}
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return sql.OpenDB(sqltrace.Wrap(connector, tracer)), cfg.Addr, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// maintenanceRetryAfter is how long, in seconds, clients are asked to wait
+// before trying a write again.
+const maintenanceRetryAfter = 300
+
+// maintenanceExempt lists the paths which still accept writes in maintenance
+// mode, so that admins can log in and switch it off again.
+var maintenanceExempt = []string{"/user/login", "/user/logout", "/admin/maintenance"}
+
+// safeMethod reports whether an HTTP method only reads.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// The rejectWrites helper reports whether a request has to be turned away
+// because the site is in maintenance mode. If so, it sets the Retry-After
+// header.
+//
+// In maintenance mode the site is read-only: pages can still be read, but
+// anything which would write to the database is turned away with a 503, so
+// that operators can run migrations safely. It's switched on at start-up
+// with the -maintenance flag, or at runtime from the moderation page.
+// Switching it at runtime only affects this instance of the application.
+func (app *application) rejectWrites(w http.ResponseWriter, r *http.Request) bool {
+	if !app.maintenance.Load() || safeMethod(r.Method) || slices.Contains(maintenanceExempt, r.URL.Path) {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(maintenanceRetryAfter))
+	return true
+}
+
+// The readOnly() middleware shows the maintenance page instead of making
+// changes while the site is in maintenance mode. It must be used after
+// authenticateSession(), so that the page can be rendered.
+func (app *application) readOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.rejectWrites(w, r) {
+			app.render(w, http.StatusServiceUnavailable, "maintenance.tmpl.html", app.newTemplateData(r))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The readOnlyAPI() middleware is the JSON API's counterpart of readOnly().
+func (app *application) readOnlyAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.rejectWrites(w, r) {
+			app.maintenanceResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The adminMaintenancePost handler switches maintenance mode on or off.
+func (app *application) adminMaintenancePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	on := r.PostForm.Get("enabled") == "true"
+	app.maintenance.Store(on)
+
+	state, event, flash := "off", models.EventMaintenanceOff, "Maintenance mode is off."
+	if on {
+		state, event, flash = "on", models.EventMaintenanceOn, "Maintenance mode is on: the site is read-only."
+	}
+
+	user := app.contextGetUser(r)
+	app.audit(r, user.ID, event, "")
+	app.infoLog.Printf("maintenance mode switched %s by user %d", state, user.ID)
+
+	app.sessionManager.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, "/admin/moderation", http.StatusSeeOther)
+}
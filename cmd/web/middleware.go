@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"snippetbox.floccinau.net/internal/errreport"
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// The secureHeaders() middleware sets a strict Content Security Policy along
+// with a handful of other security headers on every response. A fresh random
+// nonce is generated for each request and stored in the request context, and
+// only <script> and <style> elements carrying that nonce are allowed to run.
+// There's no 'unsafe-inline', so an injected inline script is refused by the
+// browser even if it slips past template escaping.
+func (app *application) secureHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		nonce := base64.StdEncoding.EncodeToString(b)
+
+		w.Header().Set("Content-Security-Policy", contentSecurityPolicy(nonce, "'none'"))
+		w.Header().Set("Reporting-Endpoints", fmt.Sprintf("%s=%q", cspReportGroup, cspReportPath))
+		w.Header().Set("Referrer-Policy", "origin-when-cross-origin")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("X-Frame-Options", "deny")
+		w.Header().Set("X-XSS-Protection", "0")
+		if requestScheme(r) == "https" {
+			w.Header().Set("Strict-Transport-Security", hstsHeader)
+			if app.altSvc != "" {
+				w.Header().Set("Alt-Svc", app.altSvc)
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), cspNonceContextKey, nonce)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// handlerPanic is a panic recovered from a handler, with the stack of where
+// it happened. The timeout() middleware runs handlers on a goroutine of
+// their own, so it recovers their panics and panics again with one of
+// these, which keeps the original stack.
+type handlerPanic struct {
+	value any
+	trace []byte
+	stack []uintptr
+}
+
+// newHandlerPanic records a recovered panic. It must be called straight from
+// the deferred function which recovered it.
+func newHandlerPanic(value any) *handlerPanic {
+	if hp, ok := value.(*handlerPanic); ok {
+		return hp
+	}
+	// The frames skipped are newHandlerPanic, the deferred function and
+	// runtime.gopanic, so that the stack starts where panic was called.
+	return &handlerPanic{value: value, trace: debug.Stack(), stack: errreport.Callers(3)}
+}
+
+// The recoverPanic() middleware turns a panic in a handler into a 500
+// Internal Server Error response, logs it with its stack trace, and reports
+// it to the error reporting service. The connection is closed afterwards,
+// since whatever the handler was doing might have left it in a bad state.
+func (app *application) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+
+			hp := newHandlerPanic(p)
+			// http.ErrAbortHandler is how handlers abort a response
+			// deliberately, and net/http handles it quietly.
+			if hp.value == http.ErrAbortHandler {
+				panic(http.ErrAbortHandler)
+			}
+
+			err := fmt.Errorf("panic: %v", hp.value)
+			app.errorLog.Output(2, fmt.Sprintf("%s\n%s", err, hp.trace))
+			app.reportError(r, err, "fatal", hp.stack)
+
+			w.Header().Set("Connection", "close")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// contentSecurityPolicy builds the value of the Content-Security-Policy header
+// for the given nonce. frameAncestors controls which sites may frame the
+// page; it's 'none' everywhere except the embeddable snippet page. Pages
+// which show a CAPTCHA pass its service's origins as widgetOrigins, so that
+// the widget can load its frames, styles and data from them.
+func contentSecurityPolicy(nonce, frameAncestors string, widgetOrigins ...string) string {
+	var widget, widgetStyle string
+	if len(widgetOrigins) > 0 {
+		origins := strings.Join(widgetOrigins, " ")
+		widget = "frame-src 'self' " + origins + "; connect-src 'self' " + origins + "; "
+		widgetStyle = " " + origins
+	}
+
+	return fmt.Sprintf("default-src 'self'; "+
+		"script-src 'nonce-%[1]s' 'strict-dynamic'; "+
+		"style-src 'self' 'nonce-%[1]s' fonts.googleapis.com%[5]s; "+
+		"font-src fonts.gstatic.com; "+
+		"img-src 'self' data: https://www.gravatar.com; "+
+		"%[6]sobject-src 'none'; base-uri 'none'; form-action 'self'; frame-ancestors %[2]s; "+
+		"report-uri %[3]s; report-to %[4]s", nonce, frameAncestors, cspReportPath, cspReportGroup, widgetStyle, widget)
+}
+
+// The earlyHints() middleware tells browsers about the stylesheet every
+// page needs before the page itself is ready, so they can start fetching it
+// while the handler is still running its queries. The preload Link header
+// goes out in a 103 Early Hints response to HTTP/2 clients; some HTTP/1.1
+// clients mishandle informational responses, so they only get it with the
+// page. Only the stylesheet is preloaded: scripts are only allowed by their
+// nonce, which a Link header can't carry. It must come before timeout(),
+// which buffers the response.
+func (app *application) earlyHints(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			if css, err := asset("css/main.css"); err == nil {
+				w.Header().Add("Link", "<"+css+">; rel=preload; as=style")
+				if r.ProtoMajor >= 2 {
+					w.WriteHeader(http.StatusEarlyHints)
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The enableCORS() middleware lets web pages on the trusted origins call the
+// API from the browser. Simple requests get an Access-Control-Allow-Origin
+// header; preflight requests (OPTIONS with an Access-Control-Request-Method
+// header) are answered here with the methods and headers the API accepts.
+// Credentials aren't allowed: the API authenticates with bearer tokens, not
+// cookies.
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response depends on the Origin header, so caches mustn't give
+		// a response for one origin to another.
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+
+		if origin != "" && slices.Contains(app.trustedOrigins, origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, POST, PATCH, DELETE")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+				w.Header().Set("Access-Control-Max-Age", "600")
+
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The authenticate() middleware resolves the bearer token in the
+// Authorization header (if any) to a user and stores it in the request
+// context. Requests without an Authorization header are treated as coming
+// from the AnonymousUser. Tokens can only be used for GET and HEAD requests
+// if they have the read scope, and for anything else if they have the write
+// scope.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// This indicates to any caches that the response may vary based on
+		// the value of the Authorization header in the request.
+		w.Header().Add("Vary", "Authorization")
+
+		authorizationHeader := r.Header.Get("Authorization")
+
+		if authorizationHeader == "" {
+			r = app.contextSetUser(r, models.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// We expect the value of the Authorization header to be in the
+		// format "Bearer <token>".
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		token := headerParts[1]
+
+		// Tokens are always 26 characters long, so there's no point hitting
+		// the database for anything else.
+		if len(token) != 26 {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		user, t, err := app.users.GetForToken(models.ScopeAuthentication, token)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.invalidAuthenticationTokenResponse(w, r)
+			} else {
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// GraphQL queries only read, even when they're POSTed.
+		scope := models.APIScopeWrite
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.URL.Path == graphQLPath {
+			scope = models.APIScopeRead
+		}
+		if !t.HasScope(scope) {
+			app.insufficientScopeResponse(w, r, scope)
+			return
+		}
+
+		err = app.loadPermissions(user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.background(func() {
+			if err := app.tokens.Touch(t.ID); err != nil {
+				app.errorLog.Print(err)
+			}
+		})
+
+		r = app.contextSetUser(r, user)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The requireAuthenticatedUser() middleware rejects requests from the
+// AnonymousUser. It must be used after authenticate().
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// The requireUserPermission() middleware is the API counterpart of
+// requirePermission(). It rejects requests from the AnonymousUser, and from
+// users who don't have the permission with the given code.
+func (app *application) requireUserPermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if !app.contextGetUser(r).Can(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireAuthenticatedUser(fn)
+}
+
+// The authenticateSession() middleware is the HTML counterpart of
+// authenticate(). It looks up the user ID stored in the session at login and
+// adds the matching user (or the AnonymousUser) to the request context.
+func (app *application) authenticateSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := app.sessionManager.GetInt(r.Context(), "authenticatedUserID")
+		if id == 0 {
+			r = app.contextSetUser(r, models.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := app.users.Get(id)
+		if err != nil {
+			// If the user has been deleted since they logged in we simply
+			// treat the request as unauthenticated.
+			if errors.Is(err, models.ErrNoRecord) {
+				app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+				r = app.contextSetUser(r, models.AnonymousUser)
+				next.ServeHTTP(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		err = app.loadPermissions(user)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		r = app.contextSetUser(r, user)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The requireAuthentication() middleware redirects unauthenticated users to
+// the login page. It must be used after authenticateSession().
+func (app *application) requireAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAuthenticated(r) {
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		// Otherwise set the "Cache-Control: no-store" header so that pages
+		// require authentication are not stored in the users browser cache
+		// (or other intermediary cache).
+		w.Header().Add("Cache-Control", "no-store")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The requirePermission() middleware only lets through users who have the
+// permission with the given code, like "admin:moderate"; anyone else gets a
+// 403 Forbidden. It must be used after requireAuthentication().
+func (app *application) requirePermission(code string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.contextGetUser(r).Can(code) {
+				app.clientError(w, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// The csrfProtect() middleware guards against cross-site request forgery. Each
+// session gets a random token which the templates embed in every form as a
+// hidden csrf_token field; any unsafe request (POST, PUT, DELETE...) which
+// doesn't send back the matching token, either in the form or in an
+// X-CSRF-Token header, is rejected. The token is only made when a page with
+// a form is rendered (see csrfToken), so a session which has never been
+// shown one has no token, and nothing it sends is accepted. It must be used
+// after the session manager's LoadAndSave() middleware.
+func (app *application) csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := app.sessionManager.GetString(r.Context(), "csrfToken")
+
+		sent := r.Header.Get("X-CSRF-Token")
+		if sent == "" {
+			// A body which was cut off by limitBody() can't be parsed, and
+			// would otherwise look like a missing token.
+			if limit, ok := bodyTooLarge(r.ParseForm()); ok {
+				app.requestTooLarge(w, r, limit)
+				return
+			}
+			sent = r.PostFormValue("csrf_token")
+		}
+
+		if token == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The csrfToken helper returns the session's CSRF token, making one the
+// first time a page needs it. Anonymous visitors who only read pages
+// without forms on them don't get one, so no session is stored for them.
+func (app *application) csrfToken(r *http.Request) (string, error) {
+	token := app.sessionManager.GetString(r.Context(), "csrfToken")
+	if token != "" {
+		return token, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	app.sessionManager.Put(r.Context(), "csrfToken", token)
+
+	return token, nil
+}
+
+// The limitBody() middleware refuses requests with a body larger than n
+// bytes. Requests which say up front that they're too big get a 413 straight
+// away; for the others the body is wrapped in http.MaxBytesReader, so reading
+// past the limit fails. It must come before anything that reads the body,
+// like csrfProtect() does when it parses the form.
+func (app *application) limitBody(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				app.requestTooLarge(w, r, n)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// formBodyLimit is the largest form the page routes accept. Percent-encoding
+// can make a snippet's content up to three times longer, and the other
+// fields need some room too.
+func (app *application) formBodyLimit() int64 {
+	return 3*app.maxSnippetSize + 64<<10
+}
+
+// jsonBodyLimit is the largest request body the JSON API accepts, leaving
+// room for escaping in the content and for the other fields.
+func (app *application) jsonBodyLimit() int64 {
+	return 2*app.maxSnippetSize + 64<<10
+}
+
+// The requestTooLarge helper answers a request whose body is more than
+// limit bytes with a 413: a page for browsers, a JSON error for the API and
+// plain text for the pastebin endpoint, whose tools show it as it is.
+func (app *application) requestTooLarge(w http.ResponseWriter, r *http.Request, limit int64) {
+	// Don't try to read the rest of the body before closing the connection.
+	w.Header().Set("Connection", "close")
+
+	switch {
+	case r.URL.Path == "/api/create":
+		pasteError(w, http.StatusRequestEntityTooLarge, "The paste can't be more than "+humanBytes(limit)+".")
+	case strings.HasPrefix(r.URL.Path, "/api/"):
+		app.errorResponse(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("the request body must not be larger than %d bytes", limit))
+	default:
+		data := app.sessionlessTemplateData(r)
+		data.MaxBodySize = limit
+		app.render(w, http.StatusRequestEntityTooLarge, "toolarge.tmpl.html", data)
+	}
+}
+
+// bodyTooLarge reports whether err came from reading past the limit set by
+// http.MaxBytesReader, and if so what the limit was.
+func bodyTooLarge(err error) (int64, bool) {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return maxBytesError.Limit, true
+	}
+	return 0, false
+}
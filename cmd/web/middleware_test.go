@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"snippetbox.floccinau.net/internal/testutils"
+)
+
+func TestEnableCORS(t *testing.T) {
+	app := &application{trustedOrigins: []string{"https://trusted.example.com"}}
+
+	// next stands in for the API, which preflight requests mustn't reach.
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	tests := []struct {
+		name          string
+		method        string
+		origin        string
+		requestMethod string
+		wantCode      int
+		wantOrigin    string
+		wantMethods   string
+		wantBody      string
+	}{
+		{
+			name:          "Preflight for batch delete",
+			method:        http.MethodOptions,
+			origin:        "https://trusted.example.com",
+			requestMethod: http.MethodDelete,
+			wantCode:      http.StatusOK,
+			wantOrigin:    "https://trusted.example.com",
+			wantMethods:   "OPTIONS, GET, POST, PATCH, DELETE",
+		},
+		{
+			name:          "Preflight for batch create",
+			method:        http.MethodOptions,
+			origin:        "https://trusted.example.com",
+			requestMethod: http.MethodPost,
+			wantCode:      http.StatusOK,
+			wantOrigin:    "https://trusted.example.com",
+			wantMethods:   "OPTIONS, GET, POST, PATCH, DELETE",
+		},
+		{
+			name:          "Preflight from untrusted origin",
+			method:        http.MethodOptions,
+			origin:        "https://evil.example.com",
+			requestMethod: http.MethodDelete,
+			wantCode:      http.StatusOK,
+			wantBody:      "OK",
+		},
+		{
+			name:       "Batch delete from trusted origin",
+			method:     http.MethodDelete,
+			origin:     "https://trusted.example.com",
+			wantCode:   http.StatusOK,
+			wantOrigin: "https://trusted.example.com",
+			wantBody:   "OK",
+		},
+		{
+			name:     "Batch delete without origin",
+			method:   http.MethodDelete,
+			wantCode: http.StatusOK,
+			wantBody: "OK",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/v1/snippets:batchDelete", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				r.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+
+			rr := httptest.NewRecorder()
+			app.enableCORS(next).ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("got status %d; want %d", rr.Code, tt.wantCode)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("got Access-Control-Allow-Origin %q; want %q", got, tt.wantOrigin)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Methods"); got != tt.wantMethods {
+				t.Errorf("got Access-Control-Allow-Methods %q; want %q", got, tt.wantMethods)
+			}
+			if got := rr.Body.String(); got != tt.wantBody {
+				t.Errorf("got body %q; want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCSRFTokenOnlyForForms(t *testing.T) {
+	app, _ := newTestApplication(t)
+	ts := newTestServer(t, app)
+
+	// Reading a page without a form doesn't store a session.
+	code, header, _ := ts.Get(t, "/")
+	if code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", code, http.StatusOK)
+	}
+	if cookie := header.Get("Set-Cookie"); cookie != "" {
+		t.Errorf("got Set-Cookie %q; want no session", cookie)
+	}
+
+	// Without a token in the session, nothing is accepted, even an empty
+	// token.
+	code, _, _ = ts.PostForm(t, "/user/login", url.Values{"csrf_token": {""}})
+	if code != http.StatusBadRequest {
+		t.Errorf("got status %d without a token; want %d", code, http.StatusBadRequest)
+	}
+
+	// A page with a form makes one, and it's kept.
+	_, header, body := ts.Get(t, "/user/login")
+	if !strings.HasPrefix(header.Get("Set-Cookie"), app.sessionManager.Cookie.Name+"=") {
+		t.Errorf("got Set-Cookie %q; want a session", header.Get("Set-Cookie"))
+	}
+	token := testutils.ExtractCSRFToken(t, body)
+	if token == "" {
+		t.Fatal("got no CSRF token in the login form")
+	}
+
+	_, _, body = ts.Get(t, "/user/signup")
+	if got := testutils.ExtractCSRFToken(t, body); got != token {
+		t.Errorf("got token %q on the next form; want %q", got, token)
+	}
+}
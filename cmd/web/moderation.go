@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/moderation"
+)
+
+// moderationTimeout is how long the moderation checks have, in total, to
+// look at a new snippet. It's mostly there for the external check.
+const moderationTimeout = 5 * time.Second
+
+// The moderate helper runs a new snippet through the moderation checks and
+// returns the reason to hold it for review, or an empty string if it can be
+// published. Snippets from moderators aren't checked. Checks which fail
+// to run are logged and otherwise ignored, so that a broken spam service
+// doesn't stop anyone posting.
+func (app *application) moderate(r *http.Request, title, content string) string {
+	return app.moderateFor(r.Context(), app.contextGetUser(r), app.clientIP(r), title, content)
+}
+
+// The moderateFor helper is moderate for a snippet which isn't being posted
+// in a request, like one being imported in the background. The ip is the
+// address the user is posting from, if it's known.
+func (app *application) moderateFor(ctx context.Context, user *models.User, ip, title, content string) string {
+	if user.Can(models.PermissionAdminModerate) {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, moderationTimeout)
+	defer cancel()
+
+	verdict, err := app.moderation.Run(ctx, &moderation.Content{
+		Title:  title,
+		Body:   content,
+		UserID: user.ID,
+		IP:     ip,
+	})
+	if err != nil {
+		app.errorLog.Print(err)
+	}
+
+	// Keep the reason within the size of the column.
+	reason := verdict.Reason()
+	if runes := []rune(reason); len(runes) > 255 {
+		reason = string(runes[:255])
+	}
+
+	return reason
+}
+
+// The adminModeration handler shows the snippets which are held for review.
+func (app *application) adminModeration(w http.ResponseWriter, r *http.Request) {
+	held, err := app.snippets.Held()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Held = held
+
+	app.render(w, http.StatusOK, "moderation.tmpl.html", data)
+}
+
+// adminSnippetID reads the snippet ID from the path of an admin page.
+func adminSnippetID(r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	return id, err == nil && id > 0
+}
+
+// The adminApprovePost handler publishes a held snippet, and then tells
+// webhooks and the /events stream about it as if it had just been created.
+func (app *application) adminApprovePost(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminSnippetID(r)
+	if !ok {
+		app.notFound(w)
+		return
+	}
+
+	err := app.snippets.Approve(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Any reports of the snippet have been dealt with too, and mustn't hide
+	// it again.
+	err = app.reports.Dismiss(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, app.contextGetUser(r).ID, models.EventModerationApprove, strconv.Itoa(id))
+	app.notifySnippetChange(models.EventSnippetCreated, id)
+	app.announceSnippet(id)
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet #%d published.", id))
+
+	http.Redirect(w, r, "/admin/moderation", http.StatusSeeOther)
+}
+
+// The adminRejectPost handler deletes a held snippet. It was never
+// published, so nobody else is told.
+func (app *application) adminRejectPost(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminSnippetID(r)
+	if !ok {
+		app.notFound(w)
+		return
+	}
+
+	err := app.snippets.Reject(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, app.contextGetUser(r).ID, models.EventModerationReject, strconv.Itoa(id))
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet #%d deleted.", id))
+
+	http.Redirect(w, r, "/admin/moderation", http.StatusSeeOther)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// oEmbedResponse is a "rich" oEmbed response (see https://oembed.com). The
+// html is an <iframe> pointing at the embeddable snippet page.
+type oEmbedResponse struct {
+	XMLName      xml.Name `json:"-" xml:"oembed"`
+	Type         string   `json:"type" xml:"type"`
+	Version      string   `json:"version" xml:"version"`
+	Title        string   `json:"title" xml:"title"`
+	ProviderName string   `json:"provider_name" xml:"provider_name"`
+	ProviderURL  string   `json:"provider_url" xml:"provider_url"`
+	CacheAge     int      `json:"cache_age,omitempty" xml:"cache_age,omitempty"`
+	HTML         string   `json:"html" xml:"html"`
+	Width        int      `json:"width" xml:"width"`
+	Height       int      `json:"height" xml:"height"`
+}
+
+// oEmbedPath matches the snippet URLs which we can provide embeds for.
+var oEmbedPath = regexp.MustCompile(`^/snippet/(?:view|embed)/(\d+)$`)
+
+// The oEmbed handler implements an oEmbed provider endpoint, so that sites
+// like Slack and WordPress can unfurl links to snippets. It takes the snippet
+// URL in the url query string parameter, and optionally format (json or
+// xml), maxwidth and maxheight.
+func (app *application) oEmbed(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	format := qs.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "xml" {
+		// The oEmbed spec asks for a 501 for unsupported formats.
+		app.clientError(w, http.StatusNotImplemented)
+		return
+	}
+
+	u, err := url.Parse(qs.Get("url"))
+	if err != nil || u.Host != r.Host {
+		app.notFound(w)
+		return
+	}
+
+	match := oEmbedPath.FindStringSubmatch(u.Path)
+	if match == nil {
+		app.notFound(w)
+		return
+	}
+
+	id, err := strconv.Atoi(match[1])
+	if err != nil {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Protected snippets can't be embedded, so there's nothing to describe.
+	if snippet.Protected {
+		app.notFound(w)
+		return
+	}
+
+	width, height := 600, 400
+	if mw, err := strconv.Atoi(qs.Get("maxwidth")); err == nil && mw > 0 && mw < width {
+		width = mw
+	}
+	if mh, err := strconv.Atoi(qs.Get("maxheight")); err == nil && mh > 0 && mh < height {
+		height = mh
+	}
+
+	embedURL := app.absoluteURL(r, fmt.Sprintf("/snippet/embed/%d", snippet.ID))
+
+	// Consumers are only asked to keep the response for a while if its
+	// URLs come from the canonical host rather than the Host header.
+	var cacheAge int
+	if app.canonicalHost != "" {
+		cacheAge = 3600
+	}
+
+	resp := oEmbedResponse{
+		Type:         "rich",
+		Version:      "1.0",
+		Title:        snippet.Title,
+		ProviderName: "Snippetbox",
+		ProviderURL:  app.absoluteURL(r, "/"),
+		CacheAge:     cacheAge,
+		HTML: fmt.Sprintf(`<iframe src="%s" width="%d" height="%d" frameborder="0" title="%s"></iframe>`,
+			embedURL, width, height, template.HTMLEscapeString(snippet.Title)),
+		Width:  width,
+		Height: height,
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if format == "xml" {
+		out, err := xml.MarshalIndent(resp, "", "\t")
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		w.Write([]byte(xml.Header))
+		w.Write(out)
+		return
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
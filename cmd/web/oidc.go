@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// backchannelLogoutEvent is the event which marks a logout token, from the
+// OpenID Connect Back-Channel Logout spec.
+const backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// oidcConfig holds the settings for delegating logins to an OpenID Connect
+// provider, from the -oidc-* flags.
+type oidcConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// RolesClaim is the ID token claim which lists the user's groups or
+	// roles at the provider.
+	RolesClaim string
+	// RoleMap maps the values of RolesClaim to the permissions they give.
+	// The permissions it mentions are kept in step with the claim at every
+	// login; any others are left alone. If it's empty, permissions are
+	// managed here as usual.
+	RoleMap map[string][]string
+}
+
+// oidcProvider is the OpenID Connect provider which users log in with,
+// when one is configured. All logins then go through it: there's no
+// signing up or logging in with a password.
+type oidcProvider struct {
+	config   oidcConfig
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+	// logoutVerifier checks logout tokens. They're signed like ID tokens,
+	// but don't have to expire.
+	logoutVerifier *oidc.IDTokenVerifier
+}
+
+// newOIDCProvider fetches the provider's discovery document, so it has to
+// be reachable when the application starts.
+func newOIDCProvider(ctx context.Context, config oidcConfig) (*oidcProvider, error) {
+	provider, err := oidc.NewProvider(ctx, config.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oidcProvider{
+		config:         config,
+		provider:       provider,
+		verifier:       provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+		logoutVerifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID, SkipExpiryCheck: true}),
+	}, nil
+}
+
+// oauth2Config returns the OAuth 2.0 settings for a login which comes back
+// to redirectURL.
+func (p *oidcProvider) oauth2Config(redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		Endpoint:     p.provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       p.config.Scopes,
+	}
+}
+
+// roles returns the values of the roles claim in an ID token. Providers
+// send either a list or a single string.
+func (p *oidcProvider) roles(idToken *oidc.IDToken) ([]string, error) {
+	var claims map[string]any
+	err := idToken.Claims(&claims)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := claims[p.config.RolesClaim].(type) {
+	case string:
+		return strings.Fields(v), nil
+	case []any:
+		var roles []string
+		for _, role := range v {
+			if s, ok := role.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+		return roles, nil
+	}
+
+	return nil, nil
+}
+
+// parseRoleMap parses the -oidc-role-map flag, which is a space-separated
+// list of role=permission,permission entries.
+func parseRoleMap(s string) (map[string][]string, error) {
+	roleMap := make(map[string][]string)
+
+	for _, entry := range strings.Fields(s) {
+		role, codes, ok := strings.Cut(entry, "=")
+		if !ok || role == "" {
+			return nil, fmt.Errorf("invalid role mapping %q", entry)
+		}
+
+		for _, code := range strings.Split(codes, ",") {
+			if !slices.Contains(models.AllPermissions, code) {
+				return nil, fmt.Errorf("unknown permission %q in role mapping %q", code, entry)
+			}
+			roleMap[role] = append(roleMap[role], code)
+		}
+	}
+
+	return roleMap, nil
+}
+
+// randomState returns a random string for the state, nonce and PKCE
+// verifier of a login.
+func randomState() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// The oidcLogin handler starts a login by sending the user to the
+// provider. The state, nonce and PKCE verifier are kept in the session for
+// the callback to check.
+func (app *application) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	state, err := randomState()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	nonce, err := randomState()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	app.sessionManager.Put(r.Context(), "oidcState", state)
+	app.sessionManager.Put(r.Context(), "oidcNonce", nonce)
+	app.sessionManager.Put(r.Context(), "oidcVerifier", verifier)
+
+	config := app.oidc.oauth2Config(app.absoluteURL(r, "/auth/oidc/callback"))
+	http.Redirect(w, r, config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), http.StatusFound)
+}
+
+// The oidcCallback handler finishes a login when the provider sends the
+// user back. It exchanges the code for an ID token, finds or makes the
+// local user, brings their permissions into line with their roles, and
+// logs them in.
+func (app *application) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	state := app.sessionManager.PopString(r.Context(), "oidcState")
+	nonce := app.sessionManager.PopString(r.Context(), "oidcNonce")
+	verifier := app.sessionManager.PopString(r.Context(), "oidcVerifier")
+
+	query := r.URL.Query()
+	if state == "" || query.Get("state") != state {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The provider turned the login down, or the user cancelled it.
+	if query.Get("error") != "" {
+		app.infoLog.Printf("oidc login refused: %s: %s", query.Get("error"), query.Get("error_description"))
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	config := app.oidc.oauth2Config(app.absoluteURL(r, "/auth/oidc/callback"))
+	token, err := config.Exchange(r.Context(), query.Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		app.serverError(w, r, errors.New("oidc: no id_token in token response"))
+		return
+	}
+
+	idToken, err := app.oidc.verifier.Verify(r.Context(), rawIDToken)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if idToken.Nonce != nonce {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		Name              string `json:"name"`
+		PreferredUsername string `json:"preferred_username"`
+		SID               string `json:"sid"`
+	}
+	err = idToken.Claims(&claims)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	id, err := app.oidcUser(idToken, claims.Email, claims.EmailVerified, claims.Name, claims.PreferredUsername)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) || errors.Is(err, errNoEmail) {
+			app.infoLog.Printf("oidc login for %s refused: %v", idToken.Subject, err)
+			app.clientError(w, http.StatusForbidden)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.syncRoles(id, idToken)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.logIn(r, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Remember which session this login made, so that a backchannel logout
+	// can find it.
+	err = app.identities.AddSession(app.sessionManager.Token(r.Context()), idToken.Issuer, idToken.Subject, claims.SID, time.Now().Add(app.sessionManager.Lifetime))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, id, models.EventLoginSuccess, claims.Email)
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// errNoEmail is returned by oidcUser when someone new logs in and the
+// provider hasn't said what their email address is.
+var errNoEmail = errors.New("oidc: no email claim")
+
+// oidcUser returns the ID of the local user for an ID token. The first
+// time someone logs in, they're linked to the local user with their email
+// address if the provider has verified it, and otherwise a user is made for
+// them.
+func (app *application) oidcUser(idToken *oidc.IDToken, email string, emailVerified bool, name, username string) (int, error) {
+	id, err := app.identities.UserFor(idToken.Issuer, idToken.Subject)
+	if err == nil {
+		return id, nil
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		return 0, err
+	}
+
+	if email == "" {
+		return 0, errNoEmail
+	}
+
+	// An unverified address could be anyone's, so it's never used to take
+	// over an existing user; making a new one with it fails instead.
+	user, err := app.users.GetByEmail(email)
+	if err == nil && emailVerified {
+		id = user.ID
+	} else if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		return 0, err
+	} else {
+		id, err = provisionUser(app.users, app.permissions, name, username, email)
+		if err != nil {
+			return 0, err
+		}
+		app.infoLog.Printf("created user %d for OIDC login %s", id, email)
+	}
+
+	err = app.identities.Link(idToken.Issuer, idToken.Subject, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// syncRoles gives the user the permissions which their roles at the
+// provider map to, and takes away the mapped permissions which they don't.
+func (app *application) syncRoles(userID int, idToken *oidc.IDToken) error {
+	if len(app.oidc.config.RoleMap) == 0 {
+		return nil
+	}
+
+	roles, err := app.oidc.roles(idToken)
+	if err != nil {
+		return err
+	}
+
+	var grant, revoke []string
+	for role, codes := range app.oidc.config.RoleMap {
+		for _, code := range codes {
+			if slices.Contains(roles, role) {
+				grant = append(grant, code)
+			} else {
+				revoke = append(revoke, code)
+			}
+		}
+	}
+	// A permission given by any role is kept even if another role which
+	// would give it is missing.
+	revoke = slices.DeleteFunc(revoke, func(code string) bool {
+		return slices.Contains(grant, code)
+	})
+
+	err = app.permissions.AddForUser(userID, grant...)
+	if err != nil {
+		return err
+	}
+
+	return app.permissions.RemoveForUser(userID, revoke...)
+}
+
+// The oidcBackchannelLogout handler is called by the provider, not the
+// user's browser, when the user logs out there. It ends the sessions the
+// logout token names by deleting them from the session store.
+func (app *application) oidcBackchannelLogout(w http.ResponseWriter, r *http.Request) {
+	// The spec asks for responses not to be cached, errors included.
+	w.Header().Set("Cache-Control", "no-store")
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	logoutToken, err := app.oidc.logoutVerifier.Verify(r.Context(), r.PostForm.Get("logout_token"))
+	if err != nil {
+		app.infoLog.Printf("oidc backchannel logout: %v", err)
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	var claims struct {
+		SID    string                     `json:"sid"`
+		Events map[string]json.RawMessage `json:"events"`
+	}
+	err = logoutToken.Claims(&claims)
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// A logout token must have the logout event and must not have a nonce,
+	// so that an ID token can't be passed off as one. Old tokens are turned
+	// away since they're never replayed legitimately.
+	_, isLogout := claims.Events[backchannelLogoutEvent]
+	if !isLogout || logoutToken.Nonce != "" || (logoutToken.Subject == "" && claims.SID == "") || time.Since(logoutToken.IssuedAt) > 5*time.Minute {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := app.identities.TakeSessions(logoutToken.Issuer, logoutToken.Subject, claims.SID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	for _, token := range tokens {
+		err := app.sessionManager.Store.Delete(token)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	app.audit(r, 0, models.EventLogoutBackchannel, fmt.Sprintf("%s: %d sessions", logoutToken.Subject, len(tokens)))
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/models/mocks"
+)
+
+const testClientID = "snippetbox"
+
+// fakeProvider is an OpenID Connect provider whose token endpoint hands
+// out an ID token for alice@example.com, with whatever nonce it's told to
+// put in it.
+type fakeProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	nonce string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fp := &fakeProvider{key: key}
+	fp.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/token" {
+			http.NotFound(w, r)
+			return
+		}
+
+		fp.mu.Lock()
+		nonce := fp.nonce
+		fp.mu.Unlock()
+
+		idToken, err := fp.sign(map[string]any{
+			"iss":            fp.URL,
+			"aud":            testClientID,
+			"sub":            "alice",
+			"iat":            time.Now().Unix(),
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"nonce":          nonce,
+			"email":          "alice@example.com",
+			"email_verified": true,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	}))
+	t.Cleanup(fp.Close)
+
+	return fp
+}
+
+// setNonce sets the nonce for the next ID token.
+func (fp *fakeProvider) setNonce(nonce string) {
+	fp.mu.Lock()
+	fp.nonce = nonce
+	fp.mu.Unlock()
+}
+
+// sign returns the claims as a JWT signed with RS256.
+func (fp *fakeProvider) sign(claims map[string]any) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, fp.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// oidcProvider returns the application's side of the fake provider.
+func (fp *fakeProvider) oidcProvider() *oidcProvider {
+	config := oidcConfig{
+		Issuer:   fp.URL,
+		ClientID: testClientID,
+		Scopes:   []string{oidc.ScopeOpenID, "email"},
+	}
+	provider := (&oidc.ProviderConfig{
+		IssuerURL:  fp.URL,
+		AuthURL:    fp.URL + "/authorize",
+		TokenURL:   fp.URL + "/token",
+		Algorithms: []string{oidc.RS256},
+	}).NewProvider(context.Background())
+	keys := &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{&fp.key.PublicKey}}
+
+	return &oidcProvider{
+		config:         config,
+		provider:       provider,
+		verifier:       oidc.NewVerifier(fp.URL, keys, &oidc.Config{ClientID: testClientID}),
+		logoutVerifier: oidc.NewVerifier(fp.URL, keys, &oidc.Config{ClientID: testClientID, SkipExpiryCheck: true}),
+	}
+}
+
+func TestOIDCCallback(t *testing.T) {
+	keep := func(s string) string { return s }
+	drop := func(string) string { return "" }
+	change := func(s string) string { return s + "x" }
+
+	tests := []struct {
+		name     string
+		state    func(string) string
+		nonce    func(string) string
+		wantCode int
+	}{
+		{"Valid", keep, keep, http.StatusSeeOther},
+		{"No state", drop, keep, http.StatusBadRequest},
+		{"Wrong state", change, keep, http.StatusBadRequest},
+		{"No nonce", keep, drop, http.StatusBadRequest},
+		{"Wrong nonce", keep, change, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fp := newFakeProvider(t)
+			app, m := newTestApplication(t)
+			app.oidc = fp.oidcProvider()
+			alice := insertUser(t, m.users, "Alice")
+			ts := newTestServer(t, app)
+
+			code, header, _ := ts.Get(t, "/auth/oidc/login")
+			if code != http.StatusFound {
+				t.Fatalf("login: got status %d; want %d", code, http.StatusFound)
+			}
+			authURL, err := url.Parse(header.Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			state, nonce := authURL.Query().Get("state"), authURL.Query().Get("nonce")
+			if state == "" || nonce == "" {
+				t.Fatalf("got state %q and nonce %q in %s; want both", state, nonce, authURL)
+			}
+
+			fp.setNonce(tt.nonce(nonce))
+			callback := "/auth/oidc/callback?code=code&state=" + url.QueryEscape(tt.state(state))
+
+			code, _, _ = ts.Get(t, callback)
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d", code, tt.wantCode)
+			}
+			if tt.wantCode != http.StatusSeeOther {
+				return
+			}
+
+			// Alice's verified email address linked her account at the
+			// provider to her user.
+			id, err := app.identities.UserFor(fp.URL, "alice")
+			if err != nil || id != alice {
+				t.Errorf("got user %d, %v linked; want %d", id, err, alice)
+			}
+
+			// The state is used up, so the callback can't be replayed.
+			code, _, _ = ts.Get(t, callback)
+			if code != http.StatusBadRequest {
+				t.Errorf("replayed: got status %d; want %d", code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestOIDCUser(t *testing.T) {
+	const issuer = "https://id.example.com"
+
+	tests := []struct {
+		name          string
+		linkTo        string
+		email         string
+		emailVerified bool
+		wantUser      string
+		wantNewUser   bool
+		wantErr       error
+	}{
+		{name: "Already linked", linkTo: "Bob", email: "alice@example.com", emailVerified: true, wantUser: "Bob"},
+		{name: "Verified email", email: "alice@example.com", emailVerified: true, wantUser: "Alice"},
+		{name: "Unverified email", email: "alice@example.com", wantErr: models.ErrDuplicateEmail},
+		{name: "New email", email: "carol@example.com", wantNewUser: true},
+		{name: "No email", emailVerified: true, wantErr: errNoEmail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, m := newTestApplication(t)
+			identities := &mocks.IdentityModel{}
+			app.identities = identities
+
+			users := map[string]int{
+				"Alice": insertUser(t, m.users, "Alice"),
+				"Bob":   insertUser(t, m.users, "Bob"),
+			}
+			if tt.linkTo != "" {
+				err := identities.Link(issuer, "subject", users[tt.linkTo])
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			idToken := &oidc.IDToken{Issuer: issuer, Subject: "subject"}
+			id, err := app.oidcUser(idToken, tt.email, tt.emailVerified, "", "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if _, err := identities.UserFor(issuer, "subject"); !errors.Is(err, models.ErrNoRecord) {
+					t.Errorf("got error %v looking up the link; want %v", err, models.ErrNoRecord)
+				}
+				return
+			}
+
+			if tt.wantNewUser {
+				if id == users["Alice"] || id == users["Bob"] {
+					t.Errorf("got existing user %d; want a new one", id)
+				}
+				user, err := m.users.Get(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if user.Email != tt.email {
+					t.Errorf("got email %q; want %q", user.Email, tt.email)
+				}
+			} else if id != users[tt.wantUser] {
+				t.Errorf("got user %d; want %s (%d)", id, tt.wantUser, users[tt.wantUser])
+			}
+
+			linked, err := identities.UserFor(issuer, "subject")
+			if err != nil || linked != id {
+				t.Errorf("got user %d, %v linked; want %d", linked, err, id)
+			}
+		})
+	}
+}
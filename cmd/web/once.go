@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// onceHeaders stops a burn-after-reading page from being cached, and stops its
+// URL (which contains the only key to the snippet) being sent to other sites
+// in the Referer header.
+func onceHeaders(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+}
+
+// onceTokenPath is the start of the path of a burn-after-reading link. The
+// rest of the path is the token.
+const onceTokenPath = "/snippet/once/"
+
+// redactOnceToken returns p, the unescaped path of a request, with the token
+// of a burn-after-reading link replaced by "[Filtered]", so that the links
+// don't end up in logs, where anyone who can read them could use them. The
+// path is cleaned first, like the router does, so that a link which is
+// spelled differently still matches.
+func redactOnceToken(p string) string {
+	if strings.HasPrefix(path.Clean(p), onceTokenPath) {
+		return onceTokenPath + "[Filtered]"
+	}
+	return p
+}
+
+// The renderOnceCreated helper shows the share link for a burn-after-reading
+// snippet which has just been created. This is the only time it's shown.
+func (app *application) renderOnceCreated(w http.ResponseWriter, r *http.Request, token string) {
+	onceHeaders(w)
+
+	data := app.newTemplateData(r)
+	data.ShareURL = app.absoluteURL(r, onceTokenPath+token)
+
+	app.render(w, http.StatusCreated, "oncelink.tmpl.html", data)
+}
+
+// The snippetOnce handler asks the visitor to confirm that they want to read
+// a burn-after-reading snippet. Reading it destroys it, so this is a separate
+// step: otherwise link previews in chat apps would use up the only view.
+func (app *application) snippetOnce(w http.ResponseWriter, r *http.Request) {
+	token := r.PathValue("token")
+
+	exists, err := app.snippets.OnceExists(token)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if !exists {
+		app.notFound(w)
+		return
+	}
+
+	onceHeaders(w)
+
+	data := app.newTemplateData(r)
+	data.ShareURL = onceTokenPath + token
+
+	app.render(w, http.StatusOK, "once.tmpl.html", data)
+}
+
+// The snippetOncePost handler shows a burn-after-reading snippet and deletes
+// it.
+func (app *application) snippetOncePost(w http.ResponseWriter, r *http.Request) {
+	snippet, err := app.snippets.ConsumeOnce(r.PathValue("token"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	onceHeaders(w)
+
+	data := app.newTemplateData(r)
+	data.Snippet = snippet
+
+	app.render(w, http.StatusOK, "once.tmpl.html", data)
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+
+	swaggerFiles "github.com/swaggo/files"
+)
+
+// apiOperation describes one API endpoint for the OpenAPI document.
+type apiOperation struct {
+	method, path string
+	summary      string
+	auth         bool
+	params       []apiParam
+	body         map[string]any
+	responses    map[string]any
+}
+
+// apiParam describes a path or query parameter.
+type apiParam struct {
+	name, in, kind, description string
+	enum                        []string
+}
+
+// apiOperations lists the endpoints under /api/v1.
+func apiOperations() []apiOperation {
+	id := apiParam{name: "id", in: "path", kind: "integer", description: "The snippet ID"}
+	fields := apiParam{name: "fields", in: "query", kind: "string", description: "Comma-separated fields of each snippet to return, instead of all of them (e.g. id,title,created)"}
+	expand := apiParam{name: "expand", in: "query", kind: "string", description: "Comma-separated related resources to embed in each snippet: user (the owner's public profile, or null) and tags (each tag's name, how many snippets have it, and the URL listing them)"}
+
+	return []apiOperation{
+		{
+			method:  "POST",
+			path:    "/tokens/authentication",
+			summary: "Exchange an email address and password for a bearer token, valid for 24 hours",
+			body: objectSchema(map[string]any{
+				"email":    map[string]any{"type": "string", "format": "email"},
+				"password": map[string]any{"type": "string", "format": "password"},
+			}, "email", "password"),
+			responses: map[string]any{
+				"201": jsonResponse("The new token", objectSchema(map[string]any{
+					"authentication_token": schemaOf(models.Token{}),
+				})),
+				"400": errorRef("BadRequest"),
+				"401": errorRef("Unauthorized"),
+				"422": errorRef("ValidationFailed"),
+				"429": errorRef("TooManyRequests"),
+			},
+		},
+		{
+			method:  "GET",
+			path:    "/users/me",
+			summary: "Get the user that the bearer token belongs to",
+			auth:    true,
+			responses: map[string]any{
+				"200": jsonResponse("The current user", objectSchema(map[string]any{
+					"user": ref("User"),
+				})),
+				"401": errorRef("Unauthorized"),
+				"403": errorRef("Forbidden"),
+			},
+		},
+		{
+			method:  "GET",
+			path:    "/snippets",
+			summary: "List unexpired snippets, a page at a time",
+			params: []apiParam{
+				{name: "page", in: "query", kind: "integer", description: "Page number, from 1"},
+				{name: "cursor", in: "query", kind: "string", description: "The next_cursor from the previous page, instead of page, to page through a listing sorted by created or -created quickly however deep it goes"},
+				{name: "page_size", in: "query", kind: "integer", description: "Snippets per page, up to 100 (default 20)"},
+				{name: "sort", in: "query", kind: "string", description: "Sort order (default -created)", enum: []string{"created", "-created", "title"}},
+				{name: "tag", in: "query", kind: "string", description: "Only snippets with this tag"},
+				{name: "language", in: "query", kind: "string", description: "Only snippets in this language"},
+				{name: "user", in: "query", kind: "integer", description: "Only snippets owned by this user ID"},
+				fields,
+				expand,
+			},
+			responses: map[string]any{
+				"200": jsonResponse("A page of snippets", objectSchema(map[string]any{
+					"snippets": map[string]any{"type": "array", "items": ref("Snippet")},
+					"metadata": ref("Metadata"),
+				})),
+				"422": errorRef("ValidationFailed"),
+			},
+		},
+		{
+			method:  "POST",
+			path:    "/snippets",
+			summary: "Create a snippet. A private snippet can only be read once, through its link, so only the link is returned.",
+			auth:    true,
+			body: objectSchema(map[string]any{
+				"title":    map[string]any{"type": "string", "maxLength": 100},
+				"content":  map[string]any{"type": "string"},
+				"language": map[string]any{"type": "string"},
+				"tags":     map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "maxItems": maxTags},
+				"expires":  map[string]any{"type": "integer", "description": "Days until the snippet expires (default 365)", "enum": []int{1, 7, 365}},
+				"private":  map[string]any{"type": "boolean"},
+			}, "title", "content"),
+			responses: map[string]any{
+				"201": jsonResponse("The new snippet and its URL", objectSchema(map[string]any{
+					"snippet": ref("Snippet"),
+					"url":     map[string]any{"type": "string", "format": "uri"},
+				}, "url")),
+				"202": jsonResponse("The snippet's URL; it's held for review, and can be read once it's approved", objectSchema(map[string]any{
+					"url": map[string]any{"type": "string", "format": "uri"},
+				}, "url")),
+				"400": errorRef("BadRequest"),
+				"401": errorRef("Unauthorized"),
+				"403": errorRef("Forbidden"),
+				"422": errorRef("ValidationFailed"),
+			},
+		},
+		{
+			method:  "POST",
+			path:    "/snippets:batchCreate",
+			summary: fmt.Sprintf("Create up to %d snippets in one transaction. If any of them isn't valid, none are created, and the results say what was wrong with each.", maxBatchSize),
+			auth:    true,
+			body: objectSchema(map[string]any{
+				"snippets": map[string]any{"type": "array", "maxItems": maxBatchSize, "items": objectSchema(map[string]any{
+					"title":    map[string]any{"type": "string", "maxLength": 100},
+					"content":  map[string]any{"type": "string"},
+					"language": map[string]any{"type": "string"},
+					"tags":     map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "maxItems": maxTags},
+					"expires":  map[string]any{"type": "integer", "description": "Days until the snippet expires (default 365)", "enum": []int{1, 7, 365}},
+				}, "title", "content")},
+			}, "snippets"),
+			responses: map[string]any{
+				"201": jsonResponse("What happened to each snippet, in the order they were given", batchResultsSchema(false)),
+				"400": errorRef("BadRequest"),
+				"401": errorRef("Unauthorized"),
+				"403": errorRef("Forbidden"),
+				"422": jsonResponse("Nothing was created; the results say which snippets weren't valid", batchResultsSchema(true)),
+			},
+		},
+		{
+			method:  "DELETE",
+			path:    "/snippets:batchDelete",
+			summary: fmt.Sprintf("Delete up to %d snippets you own in one transaction. If any of them can't be deleted, none are.", maxBatchSize),
+			auth:    true,
+			body: objectSchema(map[string]any{
+				"ids": map[string]any{"type": "array", "maxItems": maxBatchSize, "items": map[string]any{"type": "integer"}},
+			}, "ids"),
+			responses: map[string]any{
+				"200": jsonResponse("What happened to each snippet, in the order they were given", batchResultsSchema(false)),
+				"400": errorRef("BadRequest"),
+				"401": errorRef("Unauthorized"),
+				"403": errorRef("Forbidden"),
+				"409": errorRef("EditConflict"),
+				"422": jsonResponse("Nothing was deleted; the results say which snippets can't be", batchResultsSchema(true)),
+			},
+		},
+		{
+			method:  "GET",
+			path:    "/snippets/{id}",
+			summary: "Get a snippet. The content of passphrase-protected snippets is only included for their owner.",
+			params:  []apiParam{id, fields, expand},
+			responses: map[string]any{
+				"200": jsonResponse("The snippet", objectSchema(map[string]any{
+					"snippet": ref("Snippet"),
+				})),
+				"404": errorRef("NotFound"),
+				"422": errorRef("ValidationFailed"),
+			},
+		},
+		{
+			method:  "PATCH",
+			path:    "/snippets/{id}",
+			summary: "Change some fields of a snippet you own. Include version to make sure you don't overwrite someone else's change.",
+			auth:    true,
+			params:  []apiParam{id},
+			body: objectSchema(map[string]any{
+				"title":    map[string]any{"type": "string", "maxLength": 100},
+				"content":  map[string]any{"type": "string"},
+				"language": map[string]any{"type": "string"},
+				"tags":     map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "maxItems": maxTags},
+				"version":  map[string]any{"type": "integer"},
+			}),
+			responses: map[string]any{
+				"200": jsonResponse("The updated snippet", objectSchema(map[string]any{
+					"snippet": ref("Snippet"),
+				})),
+				"400": errorRef("BadRequest"),
+				"401": errorRef("Unauthorized"),
+				"403": errorRef("Forbidden"),
+				"404": errorRef("NotFound"),
+				"409": errorRef("EditConflict"),
+				"422": errorRef("ValidationFailed"),
+			},
+		},
+		{
+			method:  "GET",
+			path:    "/openapi.json",
+			summary: "This document",
+			responses: map[string]any{
+				"200": map[string]any{"description": "The OpenAPI document"},
+			},
+		},
+	}
+}
+
+// batchResultsSchema describes the response to a batch request: the
+// outcome of each item, and an error message if nothing was done.
+func batchResultsSchema(failed bool) map[string]any {
+	result := objectSchema(map[string]any{
+		"index":   map[string]any{"type": "integer"},
+		"status":  map[string]any{"type": "string", "enum": []string{batchCreated, batchHeld, batchDeleted, batchInvalid, batchNotFound, batchForbidden, batchSkipped}},
+		"id":      map[string]any{"type": "integer"},
+		"url":     map[string]any{"type": "string", "format": "uri"},
+		"errors":  map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+		"warning": map[string]any{"type": "string"},
+	}, "index", "status")
+
+	results := map[string]any{"type": "array", "items": result}
+	if failed {
+		return objectSchema(map[string]any{"error": map[string]any{"type": "string"}, "results": results}, "error", "results")
+	}
+	return objectSchema(map[string]any{"results": results}, "results")
+}
+
+// openAPIDocument builds the OpenAPI 3 document for the API served at
+// serverURL. It's built when it's requested rather than kept in a file, so
+// that it can't drift from the code: the schemas are generated from the
+// JSON tags on the model structs, and the operations are listed next to
+// each other in apiOperations, in the same order as apiRoutes().
+func openAPIDocument(serverURL string) map[string]any {
+	paths := map[string]any{}
+
+	for _, op := range apiOperations() {
+		operation := map[string]any{
+			"summary":   op.summary,
+			"responses": op.responses,
+		}
+
+		if len(op.params) > 0 {
+			var params []any
+			for _, p := range op.params {
+				schema := map[string]any{"type": p.kind}
+				if p.enum != nil {
+					schema["enum"] = p.enum
+				}
+				params = append(params, map[string]any{
+					"name":        p.name,
+					"in":          p.in,
+					"required":    p.in == "path",
+					"description": p.description,
+					"schema":      schema,
+				})
+			}
+			operation["parameters"] = params
+		}
+
+		if op.body != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": op.body}},
+			}
+		}
+
+		// Every operation is rate limited.
+		if _, ok := op.responses["429"]; !ok {
+			op.responses["429"] = errorRef("TooManyRequests")
+		}
+
+		if op.auth {
+			operation["security"] = []any{map[string]any{"bearerAuth": []string{}}}
+		}
+
+		item, _ := paths[op.path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[op.path] = item
+		}
+		item[strings.ToLower(op.method)] = operation
+	}
+
+	// Errors are always {"error": ...}. Validation failures map field names
+	// to messages; everything else has a message string.
+	messageError := objectSchema(map[string]any{"error": map[string]any{"type": "string"}}, "error")
+	errorResponses := map[string]any{
+		"BadRequest":      jsonResponse("The request body couldn't be read", messageError),
+		"Unauthorized":    jsonResponse("The credentials or bearer token are missing or wrong", messageError),
+		"Forbidden":       jsonResponse("You aren't allowed to do that, or the bearer token doesn't have the scope for it", messageError),
+		"NotFound":        jsonResponse("There's no such resource", messageError),
+		"EditConflict":    jsonResponse("The resource has changed since the given version", messageError),
+		"TooManyRequests": jsonResponse("Too many requests; see the Retry-After header", messageError),
+		"ValidationFailed": jsonResponse("Some fields or parameters aren't valid", objectSchema(map[string]any{
+			"error": map[string]any{
+				"type":                 "object",
+				"additionalProperties": map[string]any{"type": "string"},
+			},
+		}, "error")),
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Snippetbox API",
+			"version":     "1.0.0",
+			"description": "Create, read and update snippets. Responses are JSON objects whose top-level keys name what they contain, like {\"snippet\": {...}}. Requests are rate limited per IP address, or per account when authenticated; the X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset headers show how much of the quota is left.",
+		},
+		"servers": []any{map[string]any{"url": serverURL}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": map[string]any{
+				"Snippet":  schemaOf(models.Snippet{}),
+				"User":     schemaOf(models.User{}),
+				"Metadata": schemaOf(models.Metadata{}),
+			},
+			"responses": errorResponses,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "A token from POST /tokens/authentication, or one made at /account/tokens. GET requests need the read scope; anything else needs the write scope.",
+				},
+			},
+		},
+	}
+}
+
+func ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+func errorRef(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/responses/" + name}
+}
+
+func jsonResponse(description string, schema map[string]any) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content":     map[string]any{"application/json": map[string]any{"schema": schema}},
+	}
+}
+
+func objectSchema(properties map[string]any, required ...string) map[string]any {
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf generates a JSON schema for a value from its Go type and JSON
+// tags, in the same way encoding/json would encode it. Fields tagged "-" are
+// left out, and fields without omitempty are marked as required.
+func schemaOf(v any) map[string]any {
+	return typeSchema(reflect.TypeOf(v))
+}
+
+func typeSchema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.String:
+		return map[string]any{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]any{"type": "number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case t.Kind() == reflect.Struct:
+		properties := map[string]any{}
+		var required []string
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+
+			properties[name] = typeSchema(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+
+		return objectSchema(properties, required...)
+	}
+
+	return map[string]any{}
+}
+
+// The apiOpenAPI handler serves the OpenAPI document describing the API.
+func (app *application) apiOpenAPI(w http.ResponseWriter, r *http.Request) {
+	doc := openAPIDocument(app.absoluteURL(r, "/api/v1"))
+
+	err := app.writeJSON(w, http.StatusOK, envelope(doc), nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// swaggerAssets serves the Swagger UI scripts and styles, which are
+// compiled into the binary by the swaggo/files package.
+var swaggerAssets = http.StripPrefix("/api/docs", http.FileServer(swaggerFiles.HTTP))
+
+// The apiDocs handler serves the Swagger UI page for exploring the API. It's
+// a page of its own rather than using the site's layout, and needs a more
+// relaxed style policy than the rest of the site because Swagger UI sets
+// inline styles. (Browsers ignore 'unsafe-inline' when there's a nonce, so
+// styles don't get one here.)
+func (app *application) apiDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf("default-src 'self'; "+
+		"script-src 'nonce-%s' 'strict-dynamic'; "+
+		"style-src 'self' 'unsafe-inline'; "+
+		"img-src 'self' data:; "+
+		"object-src 'none'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'", app.cspNonce(r)))
+
+	data := &templateData{CSPNonce: app.cspNonce(r)}
+
+	app.renderLayout(w, http.StatusOK, "apidocs.tmpl.html", "apidocs", data)
+}
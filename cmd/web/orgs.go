@@ -0,0 +1,434 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/validator"
+)
+
+// orgSlugRX matches a valid organization slug: lower case letters, digits
+// and hyphens, not starting with a hyphen.
+var orgSlugRX = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{2,49}$`)
+
+// orgPageSize is how many snippets are shown on each page of an
+// organization's listing.
+const orgPageSize = 20
+
+// The userOrgs helper returns the organizations which the user is a member
+// of, for the switcher in the nav, along with the ID of the one they're
+// working in, or 0 for their personal workspace. Errors are logged rather
+// than failing the page, since the switcher isn't essential.
+//
+// Organizations are shared workspaces. Their snippets can only be seen by
+// their members, and aren't listed anywhere public. The current workspace
+// is kept in the session as "orgID", and new snippets go in it unless the
+// user picks another. Snippets in the personal workspace are public as
+// usual.
+func (app *application) userOrgs(r *http.Request, user *models.User) ([]*models.Org, int) {
+	orgs, err := app.orgs.ForUser(user.ID)
+	if err != nil {
+		app.errorLog.Print(err)
+		return nil, 0
+	}
+
+	// They may have left the organization they were working in since it was
+	// chosen.
+	current := app.sessionManager.GetInt(r.Context(), "orgID")
+	for _, org := range orgs {
+		if org.ID == current {
+			return orgs, current
+		}
+	}
+	return orgs, 0
+}
+
+// The memberOrg helper loads the organization named in the URL, along with
+// the current user's role in it. People who aren't members get a 404, so
+// that the names of organizations can't be found out by guessing. It sends
+// the error response itself and returns nil if the organization can't be
+// shown.
+func (app *application) memberOrg(w http.ResponseWriter, r *http.Request) (*models.Org, string) {
+	org, err := app.orgs.GetBySlug(r.PathValue("slug"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil, ""
+	}
+
+	role, err := app.orgs.Role(org.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil, ""
+	}
+
+	return org, role
+}
+
+// The ownedOrg helper is like memberOrg, but members who aren't owners get a
+// 403 Forbidden.
+func (app *application) ownedOrg(w http.ResponseWriter, r *http.Request) *models.Org {
+	org, role := app.memberOrg(w, r)
+	if org == nil {
+		return nil
+	}
+	if role != models.OrgRoleOwner {
+		app.clientError(w, http.StatusForbidden)
+		return nil
+	}
+	return org
+}
+
+// orgForm holds the form for making an organization and any validation
+// errors.
+type orgForm struct {
+	Name string
+	Slug string
+	validator.Validator
+}
+
+// The accountOrgs handler lists the current user's organizations, with a
+// form for making another.
+func (app *application) accountOrgs(w http.ResponseWriter, r *http.Request) {
+	app.renderOrgs(w, r, http.StatusOK, orgForm{})
+}
+
+func (app *application) renderOrgs(w http.ResponseWriter, r *http.Request, status int, form orgForm) {
+	data := app.newTemplateData(r)
+	data.Form = form
+
+	app.render(w, status, "orgs.tmpl.html", data)
+}
+
+func (app *application) accountOrgsPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := orgForm{
+		Name: strings.TrimSpace(r.PostForm.Get("name")),
+		Slug: strings.ToLower(strings.TrimSpace(r.PostForm.Get("slug"))),
+	}
+
+	form.Check(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.Check(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+	form.Check(validator.Matches(form.Slug, orgSlugRX), "slug", "Addresses must be 3 to 50 lower case letters, numbers or hyphens")
+
+	if !form.Valid() {
+		app.renderOrgs(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	id, err := app.orgs.Insert(form.Name, form.Slug, user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateOrgSlug) {
+			form.AddError("slug", "This address is already taken")
+			app.renderOrgs(w, r, http.StatusUnprocessableEntity, form)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, user.ID, models.EventOrgCreate, form.Slug)
+
+	// Switch to the new organization, since that's most likely what its
+	// owner wants to work in next.
+	app.sessionManager.Put(r.Context(), "orgID", id)
+	app.sessionManager.Put(r.Context(), "flash", "Organization created!")
+
+	http.Redirect(w, r, "/orgs/"+form.Slug, http.StatusSeeOther)
+}
+
+// The orgSwitchPost handler changes the current user's workspace, and takes
+// them to its snippets.
+func (app *application) orgSwitchPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PostForm.Get("org"))
+	if err != nil || id < 0 {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if id == 0 {
+		app.sessionManager.Remove(r.Context(), "orgID")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	_, err = app.orgs.Role(id, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.clientError(w, http.StatusForbidden)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	org, err := app.orgs.Get(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "orgID", org.ID)
+
+	http.Redirect(w, r, "/orgs/"+org.Slug, http.StatusSeeOther)
+}
+
+// The orgView handler lists an organization's snippets, to its members.
+func (app *application) orgView(w http.ResponseWriter, r *http.Request) {
+	org, role := app.memberOrg(w, r)
+	if org == nil {
+		return
+	}
+
+	page := app.pageParam(r)
+
+	snippets, total, err := app.snippets.ByOrg(r.Context(), org.ID, page, orgPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	starCounts, err := app.stars.Counts(snippetIDs(snippets))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Org = org
+	data.OrgRole = role
+	data.Snippets = snippets
+	data.StarCounts = starCounts
+	data.SnippetPages = newPageInfo(page, orgPageSize, total)
+
+	app.render(w, http.StatusOK, "org.tmpl.html", data)
+}
+
+// orgSettingsForm holds the forms on an organization's settings page, for
+// renaming it and for adding a member or changing their role, and any
+// validation errors.
+type orgSettingsForm struct {
+	Name     string
+	Username string
+	Role     string
+	validator.Validator
+}
+
+// The orgSettings handler shows an organization's settings and members, to
+// its owners.
+func (app *application) orgSettings(w http.ResponseWriter, r *http.Request) {
+	org := app.ownedOrg(w, r)
+	if org == nil {
+		return
+	}
+
+	app.renderOrgSettings(w, r, http.StatusOK, org, orgSettingsForm{Name: org.Name, Role: models.OrgRoleMember})
+}
+
+func (app *application) renderOrgSettings(w http.ResponseWriter, r *http.Request, status int, org *models.Org, form orgSettingsForm) {
+	members, err := app.orgs.Members(org.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Org = org
+	data.OrgRole = models.OrgRoleOwner
+	data.OrgMembers = members
+	data.OrgRoles = models.OrgRoles
+	data.Form = form
+
+	app.render(w, status, "org_settings.tmpl.html", data)
+}
+
+// The orgSettingsPost handler renames an organization.
+func (app *application) orgSettingsPost(w http.ResponseWriter, r *http.Request) {
+	org := app.ownedOrg(w, r)
+	if org == nil {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := orgSettingsForm{
+		Name: strings.TrimSpace(r.PostForm.Get("name")),
+		Role: models.OrgRoleMember,
+	}
+
+	form.Check(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+	form.Check(validator.MaxChars(form.Name, 100), "name", "This field cannot be more than 100 characters long")
+
+	if !form.Valid() {
+		app.renderOrgSettings(w, r, http.StatusUnprocessableEntity, org, form)
+		return
+	}
+
+	err = app.orgs.Rename(org.ID, form.Name)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Organization renamed!")
+
+	http.Redirect(w, r, "/orgs/"+org.Slug+"/settings", http.StatusSeeOther)
+}
+
+// The orgMembersPost handler adds someone to an organization by their
+// username, or changes the role of someone who's already a member.
+func (app *application) orgMembersPost(w http.ResponseWriter, r *http.Request) {
+	org := app.ownedOrg(w, r)
+	if org == nil {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := orgSettingsForm{
+		Name:     org.Name,
+		Username: strings.TrimSpace(r.PostForm.Get("username")),
+		Role:     r.PostForm.Get("role"),
+	}
+
+	form.Check(validator.NotBlank(form.Username), "username", "This field cannot be blank")
+	form.Check(validator.PermittedValue(form.Role, models.OrgRoles...), "role", "This field must equal member or owner")
+
+	var member *models.User
+	if form.Valid() {
+		member, err = app.users.GetByUsername(form.Username)
+		if errors.Is(err, models.ErrNoRecord) {
+			form.AddError("username", "There's nobody with this username")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if form.Valid() {
+		err = app.orgs.SetMember(org.ID, member.ID, form.Role)
+		if errors.Is(err, models.ErrLastOwner) {
+			form.AddNonFieldError("An organization must have at least one owner. Make someone else an owner first.")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		app.renderOrgSettings(w, r, http.StatusUnprocessableEntity, org, form)
+		return
+	}
+
+	app.audit(r, app.contextGetUser(r).ID, models.EventOrgMemberSet, org.Slug+" "+member.Username+" "+form.Role)
+
+	app.sessionManager.Put(r.Context(), "flash", "Member saved!")
+
+	http.Redirect(w, r, "/orgs/"+org.Slug+"/settings", http.StatusSeeOther)
+}
+
+// The orgMemberRemovePost handler takes someone out of an organization.
+// Owners can remove anyone, and members can remove themselves, to leave it.
+// The last owner can't leave, so that there's always someone who can change
+// the settings; they can delete the organization instead.
+func (app *application) orgMemberRemovePost(w http.ResponseWriter, r *http.Request) {
+	org, role := app.memberOrg(w, r)
+	if org == nil {
+		return
+	}
+
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || userID < 1 {
+		app.notFound(w)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if role != models.OrgRoleOwner && userID != user.ID {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	err = app.orgs.RemoveMember(org.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNoRecord):
+			app.notFound(w)
+		case errors.Is(err, models.ErrLastOwner):
+			app.sessionManager.Put(r.Context(), "warning", "An organization must have at least one owner. Make someone else an owner first, or delete the organization.")
+			http.Redirect(w, r, "/orgs/"+org.Slug, http.StatusSeeOther)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, user.ID, models.EventOrgMemberRemove, org.Slug+" "+strconv.Itoa(userID))
+
+	if userID == user.ID {
+		app.sessionManager.Put(r.Context(), "flash", "You've left the organization.")
+		http.Redirect(w, r, "/orgs", http.StatusSeeOther)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Member removed.")
+
+	http.Redirect(w, r, "/orgs/"+org.Slug+"/settings", http.StatusSeeOther)
+}
+
+// The orgDeletePost handler deletes an organization, along with all of its
+// snippets.
+func (app *application) orgDeletePost(w http.ResponseWriter, r *http.Request) {
+	org := app.ownedOrg(w, r)
+	if org == nil {
+		return
+	}
+
+	err := app.orgs.Delete(org.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, app.contextGetUser(r).ID, models.EventOrgDelete, org.Slug)
+
+	app.sessionManager.Put(r.Context(), "flash", "Organization deleted.")
+
+	http.Redirect(w, r, "/orgs", http.StatusSeeOther)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/validator"
+)
+
+// unlockedSnippetsKey is the session key holding the IDs of the protected
+// snippets which the user has entered the passphrase for.
+const unlockedSnippetsKey = "unlockedSnippets"
+
+// attemptLimiter counts failed attempts per key (like an IP address and
+// snippet ID) in memory, and refuses further attempts once max failures have
+// been made within window.
+type attemptLimiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	failures map[string]*attemptWindow
+}
+
+type attemptWindow struct {
+	count int
+	reset time.Time
+}
+
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{max: max, window: window, failures: map[string]*attemptWindow{}}
+}
+
+// allow reports whether another attempt may be made for key and, if not, how
+// long until one can.
+func (l *attemptLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.failures[key]
+	if !ok || time.Now().After(f.reset) {
+		return true, 0
+	}
+	if f.count < l.max {
+		return true, 0
+	}
+	return false, time.Until(f.reset)
+}
+
+// fail records a failed attempt for key.
+func (l *attemptLimiter) fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	// Drop expired entries every so often, so the map can't grow forever.
+	if len(l.failures) > 10000 {
+		for k, f := range l.failures {
+			if now.After(f.reset) {
+				delete(l.failures, k)
+			}
+		}
+	}
+
+	f, ok := l.failures[key]
+	if !ok || now.After(f.reset) {
+		f = &attemptWindow{reset: now.Add(l.window)}
+		l.failures[key] = f
+	}
+	f.count++
+}
+
+// reset forgets the failed attempts for key.
+func (l *attemptLimiter) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.failures, key)
+}
+
+// The snippetLocked helper reports whether a snippet is passphrase-protected
+// and the current user hasn't unlocked it. A snippet's owner and admins never
+// need the passphrase.
+func (app *application) snippetLocked(r *http.Request, snippet *models.Snippet) bool {
+	if !snippet.Protected || app.canEdit(app.currentUser(r), snippet) {
+		return false
+	}
+
+	unlocked, _ := app.sessionManager.Get(r.Context(), unlockedSnippetsKey).([]int)
+	return !slices.Contains(unlocked, snippet.ID)
+}
+
+// Define a snippetUnlockForm struct to hold any validation errors for the
+// passphrase form. The passphrase itself is never sent back to the browser.
+type snippetUnlockForm struct {
+	validator.Validator
+}
+
+// The renderUnlock helper shows the passphrase prompt for a protected snippet
+// in place of the snippet itself.
+func (app *application) renderUnlock(w http.ResponseWriter, r *http.Request, status int, snippet *models.Snippet, form snippetUnlockForm) {
+	data := app.newTemplateData(r)
+	data.Snippet = &models.Snippet{ID: snippet.ID, Title: snippet.Title, Protected: true}
+	data.Form = form
+
+	w.Header().Set("Cache-Control", "no-store")
+	app.render(w, status, "unlock.tmpl.html", data)
+}
+
+// The snippetUnlockPost handler checks the passphrase for a protected snippet.
+// Failed attempts are limited per IP address and snippet, so passphrases
+// can't be guessed by brute force.
+func (app *application) snippetUnlockPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.snippets.GetForUser(r.Context(), id, app.contextGetUser(r).ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	key := fmt.Sprintf("%s/%d", app.clientIP(r), id)
+	var form snippetUnlockForm
+
+	if ok, retryAfter := app.unlockLimiter.allow(key); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		form.AddError("passphrase", "Too many wrong passphrases. Try again in "+humanDuration(retryAfter)+".")
+		app.renderUnlock(w, r, http.StatusTooManyRequests, snippet, form)
+		return
+	}
+
+	ok, err := app.snippets.CheckPassphrase(id, r.PostForm.Get("passphrase"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if !ok {
+		app.unlockLimiter.fail(key)
+		form.AddError("passphrase", "That passphrase isn't right")
+		app.renderUnlock(w, r, http.StatusUnprocessableEntity, snippet, form)
+		return
+	}
+
+	app.unlockLimiter.reset(key)
+
+	unlocked, _ := app.sessionManager.Get(r.Context(), unlockedSnippetsKey).([]int)
+	if !slices.Contains(unlocked, id) {
+		app.sessionManager.Put(r.Context(), unlockedSnippetsKey, append(unlocked, id))
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+}
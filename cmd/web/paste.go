@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/secrets"
+	"snippetbox.floccinau.net/internal/validator"
+)
+
+// pasteExpiries maps the expiry codes used by pastebin.com's API to days.
+// Snippets can only last 1, 7 or 365 days, so each code gets the shortest of
+// those which is at least as long; "N", never, gets the longest.
+var pasteExpiries = map[string]int{
+	"10M": 1,
+	"1H":  1,
+	"1D":  1,
+	"1W":  7,
+	"2W":  365,
+	"1M":  365,
+	"6M":  365,
+	"1Y":  365,
+	"N":   365,
+}
+
+// parsePasteExpiry reads the expiry of a paste, which is either one of the
+// pastebin.com codes or a number of days. An empty expiry gets def.
+func parsePasteExpiry(s string, def int) (int, bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return def, true
+	}
+
+	if days, ok := pasteExpiries[s]; ok {
+		return days, true
+	}
+
+	days, err := strconv.Atoi(s)
+	if err != nil || days < 1 {
+		return 0, false
+	}
+	for _, allowed := range []int{1, 7, 365} {
+		if days <= allowed {
+			return allowed, true
+		}
+	}
+	return 365, true
+}
+
+// pasteTitle makes a title for a paste which wasn't given one, from its
+// first non-blank line.
+func pasteTitle(content string) string {
+	for line := range strings.Lines(content) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		return truncate(100, line)
+	}
+	return "Untitled"
+}
+
+// pasteError sends a plain-text error, which is what pastebin tools show
+// their users.
+func pasteError(w http.ResponseWriter, status int, msg string) {
+	http.Error(w, msg, status)
+}
+
+// The pasteCreate handler creates a snippet from a pastebin-style form post.
+// The content is in the "content" field, or "paste" as some tools call it.
+// The optional fields are "title", "language" (or "syntax"), "expiry" and
+// "private". A private paste is made burn-after-reading, since that's the
+// only kind of snippet which isn't listed anywhere; its link works once.
+//
+// It's served at POST /api/create, and answers 200 OK with the snippet's
+// URL as plain text, like the pastebins which command line tools such as
+// pastebinit and wgetpaste were written for, so those tools and the scripts
+// built on them work unchanged. Scripts which know about the account token
+// can send it as a bearer token to post as a user; without one the snippet
+// is anonymous, which is only allowed if anonymous posting is on. There's
+// no browser check for scripts to pass, so anonymous pastes rely on the
+// rate limits and the moderation checks.
+func (app *application) pasteCreate(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		pasteError(w, http.StatusBadRequest, "The form couldn't be read.")
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if user.IsAnonymous() && !app.anonymous.enabled {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		pasteError(w, http.StatusUnauthorized, "Posting needs an account: send your API token as a bearer token.")
+		return
+	}
+	if !user.IsAnonymous() && !user.Can(models.PermissionSnippetsWrite) {
+		pasteError(w, http.StatusForbidden, "Your account isn't allowed to post snippets.")
+		return
+	}
+
+	content := r.PostForm.Get("content")
+	if content == "" {
+		content = r.PostForm.Get("paste")
+	}
+	content, _ = validator.CleanText(content)
+	if strings.TrimSpace(content) == "" {
+		pasteError(w, http.StatusBadRequest, "The paste is empty.")
+		return
+	}
+	if !validator.MaxBytes(content, app.maxSnippetSize) {
+		pasteError(w, http.StatusRequestEntityTooLarge, "The paste can't be more than "+humanBytes(app.maxSnippetSize)+".")
+		return
+	}
+
+	scan := app.scanSecrets(content)
+	if scan.Has(secrets.Block) {
+		app.recordSecrets(r, 0, scan)
+		pasteError(w, http.StatusUnprocessableEntity, secretsBlockedMessage)
+		return
+	}
+	content = scan.Text
+
+	title, _ := validator.CleanText(r.PostForm.Get("title"))
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = pasteTitle(content)
+	}
+	if len([]rune(title)) > 100 {
+		pasteError(w, http.StatusBadRequest, "The title can't be more than 100 characters long.")
+		return
+	}
+
+	languageName := r.PostForm.Get("language")
+	if languageName == "" {
+		languageName = r.PostForm.Get("syntax")
+	}
+	language, ok := normalizeLanguage(languageName)
+	if !ok {
+		pasteError(w, http.StatusBadRequest, "Language names can only contain letters, numbers and + # . - and be up to 32 characters long.")
+		return
+	}
+
+	def := 365
+	if user.IsAnonymous() {
+		def = slices.Max(anonymousExpiryDays)
+	}
+	expires, ok := parsePasteExpiry(r.PostForm.Get("expiry"), def)
+	if !ok {
+		pasteError(w, http.StatusBadRequest, "The expiry must be a number of days or a code like 1D, 1W or N.")
+		return
+	}
+	if user.IsAnonymous() && !slices.Contains(anonymousExpiryDays, expires) {
+		pasteError(w, http.StatusBadRequest, "Snippets posted without an account must expire within a week.")
+		return
+	}
+
+	private := r.PostForm.Get("private")
+	burn := private != "" && private != "0" && private != "false"
+
+	if user.IsAnonymous() {
+		country := app.clientCountry(r)
+		if app.geoIP.blocks(country) {
+			pasteError(w, http.StatusForbidden, anonymousBlockedMessage)
+			return
+		}
+
+		limit := app.geoIP.anonymousLimit(country, app.anonymous.limit)
+		ok, _, reset := app.takeRateLimit(r, "anon-snippet:"+app.clientIP(r), limit, app.anonymous.window)
+		if !ok {
+			retryAfter := time.Until(reset)
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			pasteError(w, http.StatusTooManyRequests, "You've posted too many snippets without an account. Try again in "+humanDuration(retryAfter)+".")
+			return
+		}
+	}
+
+	if burn {
+		token, err := app.snippets.InsertOnce(title, content, expires, user.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.recordSecrets(r, 0, scan)
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, app.absoluteURL(r, "/snippet/once/"+token))
+		pasteNotice(w, scan)
+		return
+	}
+
+	heldReason := app.moderate(r, title, content)
+
+	id, err := app.snippets.Insert(r.Context(), title, content, expires, user.ID, 0, "", language, heldReason, time.Time{}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.recordSecrets(r, id, scan)
+
+	// A held snippet can't be viewed until it's approved, but the link will
+	// work then, so it's still given.
+	if heldReason == "" {
+		app.notifySnippetChange(models.EventSnippetCreated, id)
+		app.announceSnippet(id)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, app.absoluteURL(r, fmt.Sprintf("/snippet/view/%d", id)))
+	pasteNotice(w, scan)
+}
+
+// pasteNotice writes what the secret scan found after the URL, so that
+// scripts reading only the first line still get the URL.
+func pasteNotice(w http.ResponseWriter, scan secrets.Result) {
+	if notice := secretsNotice(scan); notice != "" {
+		fmt.Fprintln(w, notice)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// maxPinnedSnippets is how many snippets a user can pin to their profile.
+const maxPinnedSnippets = 3
+
+// The snippetPinPost handler pins one of the current user's snippets to the
+// top of their profile, or unpins it if it's pinned already.
+func (app *application) snippetPinPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// Snippets are pinned to their owner's profile, so even admins can only
+	// pin their own.
+	user := app.contextGetUser(r)
+	if snippet.UserID != user.ID {
+		app.clientError(w, http.StatusForbidden)
+		return
+	}
+
+	if snippet.Pinned {
+		err = app.snippets.Unpin(snippet.ID)
+	} else {
+		err = app.snippets.Pin(snippet.ID, user.ID, maxPinnedSnippets)
+	}
+
+	switch {
+	case errors.Is(err, models.ErrTooManyPins):
+		app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("You can only pin %d snippets. Unpin one first.", maxPinnedSnippets))
+	case errors.Is(err, models.ErrNoRecord):
+		app.notFound(w)
+		return
+	case err != nil:
+		app.serverError(w, r, err)
+		return
+	case snippet.Pinned:
+		app.sessionManager.Put(r.Context(), "flash", "Snippet unpinned.")
+	default:
+		app.sessionManager.Put(r.Context(), "flash", "Snippet pinned to your profile!")
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// The adminAnnouncePost handler pins a snippet to the home page as an
+// announcement, or unpins it if it's pinned already.
+func (app *application) adminAnnouncePost(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminSnippetID(r)
+	if !ok {
+		app.notFound(w)
+		return
+	}
+
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.snippets.SetAnnouncement(snippet.ID, !snippet.Announcement)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if snippet.Announcement {
+		app.audit(r, app.contextGetUser(r).ID, models.EventAnnouncementUnpin, strconv.Itoa(id))
+		app.sessionManager.Put(r.Context(), "flash", "Snippet unpinned from the home page.")
+	} else {
+		app.audit(r, app.contextGetUser(r).ID, models.EventAnnouncementPin, strconv.Itoa(id))
+		app.sessionManager.Put(r.Context(), "flash", "Snippet pinned to the home page!")
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/validator"
+)
+
+// profileSnippetsPageSize is how many snippets are listed on each page of a
+// profile.
+const profileSnippetsPageSize = 20
+
+// usernameRX matches a valid username: letters, digits, underscores and
+// hyphens.
+var usernameRX = regexp.MustCompile(`^[a-zA-Z0-9_-]{3,32}$`)
+
+// reservedUsernames can't be taken, because profiles live at /user/{username}
+// alongside these pages.
+var reservedUsernames = []string{"signup", "login", "logout", "admin", "anonymous"}
+
+// checkUsername adds an error to v under "username" if username can't be
+// used.
+func checkUsername(v *validator.Validator, username string) {
+	v.Check(validator.NotBlank(username), "username", "This field cannot be blank")
+	v.Check(validator.Matches(username, usernameRX), "username", "Usernames must be 3 to 32 letters, numbers, underscores or hyphens")
+	v.Check(!slices.Contains(reservedUsernames, strings.ToLower(username)), "username", "This username isn't available")
+}
+
+// The userProfile handler shows a user's public profile and a page of their
+// snippets, pinned ones first and then newest first.
+func (app *application) userProfile(w http.ResponseWriter, r *http.Request) {
+	profile, err := app.users.GetByUsername(r.PathValue("username"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	page := app.pageParam(r)
+
+	snippets, metadata, err := app.snippets.List(r.Context(), models.SnippetFilter{UserID: profile.ID, PinnedFirst: true}, models.Filters{
+		Page:         page,
+		PageSize:     profileSnippetsPageSize,
+		Sort:         "-created",
+		SortSafelist: []string{"-created"},
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	starCounts, err := app.stars.Counts(snippetIDs(snippets))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	followers, following, err := app.follows.Counts(profile.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// People see their own private collections on their profile, but nobody
+	// else does.
+	user := app.currentUser(r)
+	collections, err := app.collections.ForUser(profile.ID, user != nil && user.ID == profile.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Snippets which are scheduled to be published later are only listed
+	// for their owner.
+	var scheduled []*models.Snippet
+	if user != nil && user.ID == profile.ID {
+		scheduled, err = app.snippets.Scheduled(profile.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	data := app.newTemplateData(r)
+	data.Profile = profile
+	data.Collections = collections
+	data.ScheduledSnippets = scheduled
+	data.FollowerCount = followers
+	data.FollowingCount = following
+	data.Snippets = snippets
+	data.SnippetPages = newPageInfo(page, profileSnippetsPageSize, metadata.TotalRecords)
+	data.StarCounts = starCounts
+
+	if data.User != nil {
+		data.Following, err = app.follows.IsFollowing(data.User.ID, profile.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	app.render(w, http.StatusOK, "profile.tmpl.html", data)
+}
+
+// The userFollowPost handler makes the current user follow someone, or stop
+// following them if they already do, and sends them back to the profile.
+func (app *application) userFollowPost(w http.ResponseWriter, r *http.Request) {
+	profile, err := app.users.GetByUsername(r.PathValue("username"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if user.ID == profile.ID {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	_, err = app.follows.Toggle(user.ID, profile.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/user/"+profile.Username, http.StatusSeeOther)
+}
+
+// profileForm holds the profile edit form data and any validation errors.
+type profileForm struct {
+	Username    string
+	DisplayName string
+	Bio         string
+	TimeZone    string
+	validator.Validator
+}
+
+// The accountProfile handler shows the form for editing the current user's
+// profile.
+func (app *application) accountProfile(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	data := app.newTemplateData(r)
+	data.Form = profileForm{
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		TimeZone:    user.TimeZone,
+	}
+
+	app.render(w, http.StatusOK, "profile_edit.tmpl.html", data)
+}
+
+// The accountProfilePost handler saves the current user's profile, and then
+// shows it.
+func (app *application) accountProfilePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	form := profileForm{
+		Username:    strings.TrimSpace(r.PostForm.Get("username")),
+		DisplayName: strings.TrimSpace(r.PostForm.Get("display_name")),
+		Bio:         strings.TrimSpace(r.PostForm.Get("bio")),
+		TimeZone:    strings.TrimSpace(r.PostForm.Get("time_zone")),
+	}
+
+	checkUsername(&form.Validator, form.Username)
+	form.Check(validator.MaxChars(form.DisplayName, 100), "display_name", "This field cannot be more than 100 characters long")
+	form.Check(validator.MaxChars(form.Bio, 500), "bio", "This field cannot be more than 500 characters long")
+	if form.TimeZone != "" {
+		_, err := time.LoadLocation(form.TimeZone)
+		form.Check(err == nil && form.TimeZone != "Local", "time_zone", "This isn't a time zone we know about")
+	}
+
+	if form.Valid() {
+		err = app.users.UpdateProfile(user.ID, form.Username, form.DisplayName, form.Bio, form.TimeZone)
+		if errors.Is(err, models.ErrDuplicateUsername) {
+			form.AddError("username", "This username isn't available")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, http.StatusUnprocessableEntity, "profile_edit.tmpl.html", data)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Profile updated!")
+
+	http.Redirect(w, r, "/user/"+form.Username, http.StatusSeeOther)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// provisionUser makes a local user for someone who logs in through an
+// outside service such as LDAP or an OpenID Connect provider, and returns
+// their ID. The name and username are what the service knows them by, and
+// either may be empty. New users get the default permissions, and a random
+// password, since they never log in with it.
+func provisionUser(users models.UserStore, permissions models.PermissionStore, name, username, email string) (int, error) {
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return 0, err
+	}
+	password := hex.EncodeToString(b)
+
+	// A number is added to the username if someone already has it.
+	base := suggestUsername(username, email)
+	var id int
+	for n := 1; ; n++ {
+		username := base
+		if n > 1 {
+			username = fmt.Sprintf("%s-%d", base, n)
+		}
+
+		id, err = users.Insert(name, username, email, password)
+		if errors.Is(err, models.ErrDuplicateUsername) && n < 10 {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		break
+	}
+
+	err = permissions.AddForUser(id, models.DefaultPermissions...)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// notUsernameRX matches the characters which can't be used in usernames.
+var notUsernameRX = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// suggestUsername makes a username from what an outside service calls
+// someone, falling back to the part of the email address before the @. It's
+// left short enough to have a number added.
+func suggestUsername(name, email string) string {
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+
+	username := notUsernameRX.ReplaceAllString(name, "")
+	if len(username) > 28 {
+		username = username[:28]
+	}
+	if len(username) < 3 {
+		username = "user-" + username
+	}
+
+	return username
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// trustedProxies are the reverse proxies whose X-Forwarded-For,
+// X-Real-IP, X-Forwarded-Proto and X-Forwarded-Host headers are believed.
+// Anyone else could set the headers to whatever they liked, to get around
+// rate limits, put someone else's address in the audit log, or have links
+// built with their own host name.
+type trustedProxies struct {
+	prefixes []netip.Prefix
+	// unix trusts whatever connects over a Unix socket, which only
+	// processes on the same machine with access to the socket can do.
+	unix bool
+}
+
+// parseTrustedProxies parses a space separated list of IP addresses and
+// CIDR ranges, like "127.0.0.1 10.0.0.0/8". The word "unix" trusts
+// connections over a Unix socket.
+func parseTrustedProxies(s string) (trustedProxies, error) {
+	var p trustedProxies
+
+	for _, field := range strings.Fields(s) {
+		if field == "unix" {
+			p.unix = true
+			continue
+		}
+
+		prefix, err := parsePrefix(field)
+		if err != nil {
+			return trustedProxies{}, fmt.Errorf("trusted proxy %q: %w", field, err)
+		}
+		p.prefixes = append(p.prefixes, prefix)
+	}
+
+	return p, nil
+}
+
+// parsePrefix parses an IP address or CIDR range. An address is returned
+// as a range holding just that address, and a range has any bits past its
+// length cleared. IPv4-mapped IPv6 addresses and ranges are turned into
+// plain IPv4 ones, since that's how addresses are compared with them.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		if addr := prefix.Addr(); addr.Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(addr.Unmap(), prefix.Bits()-96)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// enabled reports whether any proxies are trusted.
+func (p trustedProxies) enabled() bool {
+	return p.unix || len(p.prefixes) > 0
+}
+
+// trusts reports whether addr, an IP address, is one of the proxies.
+func (p trustedProxies) trusts(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// trustsPeer reports whether the connection a request came in on is from
+// one of the proxies. Requests over a Unix socket have no IP address.
+func (p trustedProxies) trustsPeer(remoteAddr string) bool {
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return p.unix
+	}
+	return p.trusts(addrPort.Addr())
+}
+
+// forwardedFor returns the address of the client a trusted proxy forwarded
+// a request for. Each proxy appends the address it got the request from to
+// X-Forwarded-For, so the list is read from the right, past the trusted
+// proxies, and the first address which isn't one of them is the client's.
+// Anything to the left of that came from the client, and can't be believed.
+func (p trustedProxies) forwardedFor(r *http.Request) (netip.Addr, bool) {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	if len(hops) == 0 {
+		addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+		return addr, err == nil
+	}
+
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr
+		if !p.trusts(addr) {
+			break
+		}
+	}
+
+	return client, client.IsValid()
+}
+
+// lastForwarded returns the last value of a forwarded header, which is the
+// one the proxy the request came from added, with any earlier ones having
+// come from further away.
+func lastForwarded(r *http.Request, name string) string {
+	values := r.Header.Values(name)
+	if len(values) == 0 {
+		return ""
+	}
+	fields := strings.Split(values[len(values)-1], ",")
+	return strings.TrimSpace(fields[len(fields)-1])
+}
+
+// forwardedProto returns the scheme, http or https, that a trusted proxy
+// got a request over.
+func forwardedProto(r *http.Request) (string, bool) {
+	proto := strings.ToLower(lastForwarded(r, "X-Forwarded-Proto"))
+	return proto, proto == "http" || proto == "https"
+}
+
+// forwardedHost returns the host a trusted proxy got a request for. It has
+// to look like a host name or address, with an optional port, since it's
+// put into URLs.
+func forwardedHost(r *http.Request) (string, bool) {
+	host := lastForwarded(r, "X-Forwarded-Host")
+	if host == "" || strings.ContainsAny(host, "/\\@?#%\" <>") {
+		return "", false
+	}
+	if _, err := url.Parse("http://" + host); err != nil {
+		return "", false
+	}
+	return host, true
+}
+
+// The realIP() middleware replaces the remote address of requests which
+// came through a trusted proxy with the address of the client the proxy
+// forwarded them for, so that rate limits, logs and the audit log see the
+// client rather than the proxy. The scheme and host the proxy was asked
+// for replace the request's own too, so that links are built with them.
+// Requests from anywhere else are left as they are, whatever their headers
+// say.
+func (app *application) realIP(next http.Handler) http.Handler {
+	if !app.trustedProxies.enabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.trustedProxies.trustsPeer(r.RemoteAddr) {
+			if client, ok := app.trustedProxies.forwardedFor(r); ok {
+				r.RemoteAddr = net.JoinHostPort(client.Unmap().String(), "0")
+			}
+			if proto, ok := forwardedProto(r); ok {
+				r.URL.Scheme = proto
+			}
+			if host, ok := forwardedHost(r); ok {
+				r.Host = host
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
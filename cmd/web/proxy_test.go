@@ -0,0 +1,190 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestForwardedFor(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8 192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		xff    []string
+		realIP string
+		want   string
+		wantOK bool
+	}{
+		{name: "One hop", xff: []string{"203.0.113.7"}, want: "203.0.113.7", wantOK: true},
+		{name: "Past the proxies", xff: []string{"203.0.113.7, 10.1.2.3, 192.0.2.1"}, want: "203.0.113.7", wantOK: true},
+		{name: "Forged on the left", xff: []string{"198.51.100.1, 203.0.113.7, 10.1.2.3"}, want: "203.0.113.7", wantOK: true},
+		{name: "Several headers", xff: []string{"198.51.100.1", "203.0.113.7, 10.1.2.3"}, want: "203.0.113.7", wantOK: true},
+		{name: "Spaces", xff: []string{" 203.0.113.7 ,10.1.2.3 "}, want: "203.0.113.7", wantOK: true},
+		{name: "IPv6", xff: []string{"2001:db8::1, 10.1.2.3"}, want: "2001:db8::1", wantOK: true},
+		{name: "Garbage stops the walk", xff: []string{"203.0.113.7, nonsense, 10.1.2.3"}, want: "10.1.2.3", wantOK: true},
+		{name: "All proxies", xff: []string{"10.9.9.9, 10.1.2.3"}, want: "10.9.9.9", wantOK: true},
+		{name: "Only garbage", xff: []string{"nonsense"}, wantOK: false},
+		{name: "X-Real-IP", realIP: "203.0.113.7", want: "203.0.113.7", wantOK: true},
+		{name: "X-Real-IP ignored with X-Forwarded-For", xff: []string{"203.0.113.7"}, realIP: "198.51.100.1", want: "203.0.113.7", wantOK: true},
+		{name: "Bad X-Real-IP", realIP: "nonsense", wantOK: false},
+		{name: "Neither", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			got, ok := proxies.forwardedFor(r)
+			if ok != tt.wantOK {
+				t.Fatalf("got ok %t; want %t", ok, tt.wantOK)
+			}
+			if ok && got != netip.MustParseAddr(tt.want) {
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		proxies    string
+		remoteAddr string
+		header     http.Header
+		wantAddr   string
+		wantScheme string
+		wantHost   string
+	}{
+		{
+			name:       "No proxies",
+			remoteAddr: "10.1.2.3:1234",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.7"}, "X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"evil.example"}},
+			wantAddr:   "10.1.2.3:1234",
+			wantScheme: "http",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "Untrusted peer",
+			proxies:    "10.0.0.0/8",
+			remoteAddr: "198.51.100.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.7"}, "X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"evil.example"}},
+			wantAddr:   "198.51.100.1:1234",
+			wantScheme: "http",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "Trusted peer",
+			proxies:    "10.0.0.0/8",
+			remoteAddr: "10.1.2.3:1234",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.7"}, "X-Forwarded-Proto": {"https"}, "X-Forwarded-Host": {"snippets.example:8443"}},
+			wantAddr:   "203.0.113.7:0",
+			wantScheme: "https",
+			wantHost:   "snippets.example:8443",
+		},
+		{
+			name:       "IPv4-mapped peer",
+			proxies:    "10.0.0.0/8",
+			remoteAddr: "[::ffff:10.1.2.3]:1234",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.7"}},
+			wantAddr:   "203.0.113.7:0",
+			wantScheme: "http",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "Unix socket",
+			proxies:    "unix",
+			remoteAddr: "@",
+			header:     http.Header{"X-Real-Ip": {"2001:db8::1"}, "X-Forwarded-Proto": {"HTTPS"}},
+			wantAddr:   "[2001:db8::1]:0",
+			wantScheme: "https",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "Last values win",
+			proxies:    "10.0.0.0/8",
+			remoteAddr: "10.1.2.3:1234",
+			header:     http.Header{"X-Forwarded-Proto": {"http", "https, https"}, "X-Forwarded-Host": {"evil.example, snippets.example"}},
+			wantAddr:   "10.1.2.3:1234",
+			wantScheme: "https",
+			wantHost:   "snippets.example",
+		},
+		{
+			name:       "Bad values",
+			proxies:    "10.0.0.0/8",
+			remoteAddr: "10.1.2.3:1234",
+			header:     http.Header{"X-Forwarded-Proto": {"javascript"}, "X-Forwarded-Host": {"evil.example/path"}},
+			wantAddr:   "10.1.2.3:1234",
+			wantScheme: "http",
+			wantHost:   "example.com",
+		},
+		{
+			name:       "Credentials in host",
+			proxies:    "10.0.0.0/8",
+			remoteAddr: "10.1.2.3:1234",
+			header:     http.Header{"X-Forwarded-Host": {"user@evil.example"}},
+			wantAddr:   "10.1.2.3:1234",
+			wantScheme: "http",
+			wantHost:   "example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies, err := parseTrustedProxies(tt.proxies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			app := &application{trustedProxies: proxies}
+
+			var addr, scheme, host string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				addr, scheme, host = r.RemoteAddr, requestScheme(r), r.Host
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.header {
+				r.Header[http.CanonicalHeaderKey(k)] = v
+			}
+			app.realIP(next).ServeHTTP(httptest.NewRecorder(), r)
+
+			if addr != tt.wantAddr {
+				t.Errorf("got remote address %q; want %q", addr, tt.wantAddr)
+			}
+			if scheme != tt.wantScheme {
+				t.Errorf("got scheme %q; want %q", scheme, tt.wantScheme)
+			}
+			if host != tt.wantHost {
+				t.Errorf("got host %q; want %q", host, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestAbsoluteURL(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Host = "evil.example"
+
+	app := &application{}
+	if got, want := app.absoluteURL(r, "/snippet/view/1"), "http://evil.example/snippet/view/1"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	// With a canonical host, the request's Host header isn't used.
+	app.canonicalHost = "snippets.example"
+	r.URL.Scheme = "https"
+	if got, want := app.absoluteURL(r, "/snippet/view/1"), "https://snippets.example/snippet/view/1"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// The QR code sizes, in pixels, which may be requested with ?size=.
+const (
+	qrDefaultSize = 256
+	qrMinSize     = 128
+	qrMaxSize     = 1024
+)
+
+// The snippetQRPNG handler serves a QR code of a snippet's share URL, so that
+// it can be opened on a phone by pointing the camera at the screen. Like the
+// other files served for a snippet, it's only there for public ones.
+func (app *application) snippetQRPNG(w http.ResponseWriter, r *http.Request) {
+	snippet := app.publicSnippetFromPath(w, r)
+	if snippet == nil {
+		return
+	}
+
+	size := qrDefaultSize
+	if s := r.URL.Query().Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		size = min(max(n, qrMinSize), qrMaxSize)
+	}
+
+	url := app.absoluteURL(r, fmt.Sprintf("/snippet/view/%d", snippet.ID))
+
+	img, err := qrcode.Encode(url, qrcode.Medium, size)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(len(img)))
+	w.Header().Set("Cache-Control", app.sharedCacheControl(86400))
+	w.Write(img)
+}
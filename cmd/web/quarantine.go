@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/storage"
+	"snippetbox.floccinau.net/internal/worker"
+)
+
+// attachmentScanJob is the kind of job which scans an attachment.
+const attachmentScanJob = "attachment.scan"
+
+// quarantinePageSize is how many attachments of each kind the quarantine
+// page shows.
+const quarantinePageSize = 100
+
+// attachmentScanPayload is the payload of an attachmentScanJob.
+type attachmentScanPayload struct {
+	AttachmentID int `json:"attachment_id"`
+}
+
+// The scanAttachment method is the handler for attachmentScanJob jobs. With
+// -virus-scanner set, one is queued for each attachment after it's
+// uploaded, and it can't be downloaded until the scan says it's clean.
+// Infected attachments are quarantined: they stay blocked, their owner is
+// told through the attachment.quarantined webhook and on the snippet's
+// page, and moderators can release or delete them on the /admin/quarantine
+// page.
+//
+// A scanner which can't be reached, or fails, retries the job, and the
+// attachment stays pending until it succeeds.
+func (app *application) scanAttachment(ctx context.Context, job *worker.Job) error {
+	var input attachmentScanPayload
+	err := job.Decode(&input)
+	if err != nil {
+		return worker.Permanent(err)
+	}
+
+	// If the attachment has been deleted, or a moderator has already
+	// decided about it, there's nothing to do.
+	a, err := app.attachments.Get(input.AttachmentID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+	if a.ScanStatus != models.ScanPending {
+		return nil
+	}
+
+	if app.virusScanner == nil {
+		return worker.Permanent(errors.New("no virus scanner is configured"))
+	}
+
+	blob, err := app.blobs.Open(ctx, a.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return worker.Permanent(err)
+		}
+		return err
+	}
+	defer blob.Close()
+
+	result, err := app.virusScanner.Scan(ctx, io.LimitReader(blob, a.Size))
+	if err != nil {
+		return err
+	}
+
+	if !result.Infected {
+		err = app.attachments.SetScanStatus(a.ID, models.ScanClean, "")
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	err = app.attachments.SetScanStatus(a.ID, models.ScanQuarantined, truncate(255, result.Threat))
+	if errors.Is(err, models.ErrNoRecord) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	a.ScanStatus, a.Threat = models.ScanQuarantined, result.Threat
+
+	detail := fmt.Sprintf("attachment %d (%s) of snippet %d: %s", a.ID, a.Filename, a.SnippetID, result.Threat)
+	err = app.auditLog.Insert(a.UserID, "", "", models.EventAttachmentQuarantine, detail)
+	if err != nil {
+		app.errorLog.Print(err)
+	}
+
+	app.notifyQuarantine(a)
+
+	return nil
+}
+
+// webhookAttachment is the attachment in the payload of an
+// attachment.quarantined webhook.
+type webhookAttachment struct {
+	ID       int    `json:"id"`
+	Filename string `json:"filename"`
+	Threat   string `json:"threat"`
+}
+
+// The notifyQuarantine method tells the owner of a quarantined attachment,
+// through their webhooks.
+func (app *application) notifyQuarantine(a *models.Attachment) {
+	if a.UserID == 0 {
+		return
+	}
+
+	payload := webhookPayload{
+		Event:      models.EventAttachmentQuarantined,
+		Created:    time.Now().UTC(),
+		Attachment: &webhookAttachment{ID: a.ID, Filename: a.Filename, Threat: a.Threat},
+	}
+
+	// The snippet is left out if it's gone, or not published yet.
+	snippet, err := app.snippets.Get(context.Background(), a.SnippetID)
+	if err == nil {
+		payload.Snippet = snippet
+	} else if !errors.Is(err, models.ErrNoRecord) {
+		app.errorLog.Print(err)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		app.errorLog.Print(err)
+		return
+	}
+
+	app.queueWebhooks(a.UserID, models.EventAttachmentQuarantined, body)
+}
+
+// The adminQuarantine handler lists the quarantined attachments, and any
+// whose scan hasn't finished.
+func (app *application) adminQuarantine(w http.ResponseWriter, r *http.Request) {
+	quarantined, err := app.attachments.ListByScanStatus(models.ScanQuarantined, quarantinePageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	pending, err := app.attachments.ListByScanStatus(models.ScanPending, quarantinePageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.QuarantinedAttachments = quarantined
+	data.PendingAttachments = pending
+
+	app.render(w, http.StatusOK, "quarantine.tmpl.html", data)
+}
+
+// The quarantinedAttachment helper loads the attachment named by the id
+// path value. If there's no such attachment, it sends an error response
+// and returns nil.
+func (app *application) quarantinedAttachment(w http.ResponseWriter, r *http.Request) *models.Attachment {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil
+	}
+
+	a, err := app.attachments.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil
+	}
+	return a
+}
+
+// The adminQuarantineReleasePost handler lets an attachment be downloaded,
+// when a moderator has decided the scanner was wrong about it.
+func (app *application) adminQuarantineReleasePost(w http.ResponseWriter, r *http.Request) {
+	a := app.quarantinedAttachment(w, r)
+	if a == nil {
+		return
+	}
+
+	err := app.attachments.Release(a.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, app.contextGetUser(r).ID, models.EventAttachmentRelease, fmt.Sprintf("attachment %d (%s) of snippet %d", a.ID, a.Filename, a.SnippetID))
+
+	app.sessionManager.Put(r.Context(), "flash", "Attachment released.")
+	http.Redirect(w, r, "/admin/quarantine", http.StatusSeeOther)
+}
+
+// The adminQuarantineRescanPost handler queues another scan of an
+// attachment whose scan never finished, like when the scanner was down for
+// longer than the job kept retrying.
+func (app *application) adminQuarantineRescanPost(w http.ResponseWriter, r *http.Request) {
+	a := app.quarantinedAttachment(w, r)
+	if a == nil {
+		return
+	}
+	if a.ScanStatus != models.ScanPending {
+		app.notFound(w)
+		return
+	}
+
+	err := app.jobs.Enqueue(attachmentScanJob, attachmentScanPayload{AttachmentID: a.ID})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Attachment queued to be scanned again.")
+	http.Redirect(w, r, "/admin/quarantine", http.StatusSeeOther)
+}
+
+// The adminQuarantineDeletePost handler deletes an attachment and its file.
+func (app *application) adminQuarantineDeletePost(w http.ResponseWriter, r *http.Request) {
+	a := app.quarantinedAttachment(w, r)
+	if a == nil {
+		return
+	}
+
+	err := app.removeAttachment(a)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Attachment deleted.")
+	http.Redirect(w, r, "/admin/quarantine", http.StatusSeeOther)
+}
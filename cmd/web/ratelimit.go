@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// rateStore counts requests per key in fixed windows. incr adds one to the
+// count for key, starting a new window if the last one has ended, and
+// returns the new count and when the window ends.
+type rateStore interface {
+	incr(ctx context.Context, key string, window time.Duration) (int, time.Time, error)
+}
+
+// memoryRateStore keeps the counts in memory. It's fine for a single
+// instance of the application; use redisRateStore to share limits between
+// several.
+type memoryRateStore struct {
+	mu      sync.Mutex
+	windows map[string]*attemptWindow
+}
+
+func newMemoryRateStore() *memoryRateStore {
+	return &memoryRateStore{windows: map[string]*attemptWindow{}}
+}
+
+func (s *memoryRateStore) incr(ctx context.Context, key string, window time.Duration) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	// Drop ended windows every so often, so the map can't grow forever.
+	if len(s.windows) > 10000 {
+		for k, w := range s.windows {
+			if now.After(w.reset) {
+				delete(s.windows, k)
+			}
+		}
+	}
+
+	w, ok := s.windows[key]
+	if !ok || now.After(w.reset) {
+		w = &attemptWindow{reset: now.Add(window)}
+		s.windows[key] = w
+	}
+	w.count++
+
+	return w.count, w.reset, nil
+}
+
+// redisIncrScript increments a counter, sets it to expire at the end of the
+// window if it's new, and returns the count and the milliseconds left in the
+// window. Doing this in one script means a counter can't be left without an
+// expiry if the connection drops between the two commands.
+var redisIncrScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return {count, redis.call("PTTL", KEYS[1])}
+`)
+
+// redisRateStore keeps the counts in Redis, so that every instance of the
+// application shares the same limits.
+type redisRateStore struct {
+	client *redis.Client
+}
+
+func (s *redisRateStore) incr(ctx context.Context, key string, window time.Duration) (int, time.Time, error) {
+	res, err := redisIncrScript.Run(ctx, s.client, []string{"ratelimit:" + key}, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	return int(res[0]), time.Now().Add(time.Duration(res[1]) * time.Millisecond), nil
+}
+
+// apiRateLimits holds the number of API requests allowed in each window.
+// Every request counts against the per-IP ceiling first, so that a client
+// can't get around the limits by sending made-up tokens. Then anonymous
+// requests count against a small quota for their IP address, and
+// authenticated requests against a bigger quota for their account, however
+// many tokens or addresses they're spread over.
+type apiRateLimits struct {
+	store  rateStore
+	window time.Duration
+	ip     int
+	anon   int
+	user   int
+}
+
+// takeRateLimit counts a request against key and reports whether it's
+// within limit for the window, along with how many requests are left and
+// when the window ends. If the store fails the request is allowed: it's
+// better to serve a few requests too many than to take the API down along
+// with the store.
+func (app *application) takeRateLimit(r *http.Request, key string, limit int, window time.Duration) (bool, int, time.Time) {
+	count, reset, err := app.rateLimits.store.incr(r.Context(), key, window)
+	if err != nil {
+		app.errorLog.Output(2, err.Error())
+		return true, limit, time.Now().Add(window)
+	}
+
+	return count <= limit, max(limit-count, 0), reset
+}
+
+// The rateLimitIP() middleware applies the per-IP ceiling to every API
+// request.
+func (app *application) rateLimitIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, _, reset := app.takeRateLimit(r, "ip:"+app.clientIP(r), app.rateLimits.ip, app.rateLimits.window)
+		if !ok {
+			app.rateLimitExceededResponse(w, r, app.rateLimits.ip, reset)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The rateLimitQuota() middleware counts a request against the account's
+// quota, or the IP address's for anonymous requests, and reports the quota
+// in the X-RateLimit-* headers. It must be used after authenticate().
+func (app *application) rateLimitQuota(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, limit := "anon:"+app.clientIP(r), app.rateLimits.anon
+		if user := app.contextGetUser(r); !user.IsAnonymous() {
+			key, limit = "user:"+strconv.Itoa(user.ID), app.rateLimits.user
+		}
+
+		ok, remaining, reset := app.takeRateLimit(r, key, limit, app.rateLimits.window)
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+		if !ok {
+			app.rateLimitExceededResponse(w, r, limit, reset)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// relatedLimit is how many related snippets are shown on the view page.
+const relatedLimit = 5
+
+// relatedTTL is how long related snippets are cached for. Changing a
+// snippet's tags or title drops it from the cache straight away, but other
+// changes, like new snippets, only show up once the cached lists expire.
+const relatedTTL = 10 * time.Minute
+
+// relatedCache keeps each snippet's related snippets in memory, since
+// finding them means scoring a few hundred candidates.
+type relatedCache struct {
+	mu      sync.Mutex
+	entries map[int]relatedEntry
+}
+
+type relatedEntry struct {
+	snippets []*models.Snippet
+	expires  time.Time
+}
+
+// get returns the cached related snippets of a snippet, and whether there
+// were any cached.
+func (c *relatedCache) get(id int) ([]*models.Snippet, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[id]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.snippets, true
+}
+
+// put caches the related snippets of a snippet. Expired entries are dropped
+// at the same time, so the cache doesn't grow for ever.
+func (c *relatedCache) put(id int, snippets []*models.Snippet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.entries == nil {
+		c.entries = make(map[int]relatedEntry)
+	}
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[id] = relatedEntry{snippets: snippets, expires: now.Add(relatedTTL)}
+}
+
+// invalidate drops a snippet's related snippets from the cache, along with
+// the cached lists it appears in, after its tags or title change or it's
+// deleted.
+func (c *relatedCache) invalidate(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, id)
+	for k, e := range c.entries {
+		if slices.ContainsFunc(e.snippets, func(s *models.Snippet) bool { return s.ID == id }) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// The relatedSnippets helper returns the snippets related to a snippet, from
+// the cache if they're there.
+func (app *application) relatedSnippets(ctx context.Context, id int) ([]*models.Snippet, error) {
+	if related, ok := app.related.get(id); ok {
+		return related, nil
+	}
+
+	related, err := app.snippets.Related(ctx, id, relatedLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	app.related.put(id, related)
+	return related, nil
+}
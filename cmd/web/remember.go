@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// rememberCookie is the name of the cookie which logs users back in after
+// their session expires, if they ticked "remember me" when logging in.
+const rememberCookie = "remember"
+
+// rememberTTL is how long "remember me" lasts. It isn't extended by using
+// it, so users have to log in with their password at least this often.
+const rememberTTL = 30 * 24 * time.Hour
+
+// setRememberCookie sends the remember-me cookie for the token. It's
+// encrypted, so the selector and verifier can't be read from it.
+func (app *application) setRememberCookie(w http.ResponseWriter, token *models.RememberToken) error {
+	return app.setSecureCookie(w, rememberCookie, token.Selector+":"+token.Verifier, token.Expiry)
+}
+
+// clearRememberCookie tells the browser to delete the remember-me cookie.
+func (app *application) clearRememberCookie(w http.ResponseWriter) {
+	app.setCookie(w, rememberCookie, "", time.Time{})
+}
+
+// rememberSelector returns the selector and verifier from the remember-me
+// cookie, if the request has one.
+func (app *application) rememberSelector(r *http.Request) (selector, verifier string, ok bool) {
+	value, ok := app.readSecureCookie(r, rememberCookie)
+	if !ok {
+		return "", "", false
+	}
+
+	return strings.Cut(value, ":")
+}
+
+// The rememberMe() middleware logs users back in from their remember-me
+// cookie when they don't have a logged-in session. The cookie's verifier is
+// replaced each time, so a copy of it only works until the real one is next
+// used; when an old one turns up, all of the user's remember-me tokens are
+// revoked. It must be used after the session is loaded and before
+// authenticateSession().
+func (app *application) rememberMe(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.sessionManager.Exists(r.Context(), "authenticatedUserID") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		selector, verifier, ok := app.rememberSelector(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, err := app.rememberTokens.Use(selector, verifier)
+		if err != nil {
+			switch {
+			case errors.Is(err, models.ErrRememberTokenReused):
+				app.audit(r, token.UserID, models.EventRememberReused, "")
+				app.clearRememberCookie(w)
+			case errors.Is(err, models.ErrNoRecord):
+				app.clearRememberCookie(w)
+			default:
+				app.serverError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		err = app.logIn(r, token.UserID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		// A request made at the same moment as the one which rotated the
+		// token gets no new verifier, and leaves the cookie alone.
+		if token.Verifier != "" {
+			err = app.setRememberCookie(w, token)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+
+		app.audit(r, token.UserID, models.EventLoginSuccess, "remember me")
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// checkReplicas checks that the read replicas are up every interval, until
+// the application shuts down. Replicas which go down are logged as errors,
+// and those which come back up again are logged too.
+func (app *application) checkReplicas(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-app.shutdown:
+			return
+		}
+
+		// A replica has until the next check to answer.
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		for _, status := range app.replicas.Check(ctx) {
+			if status.Healthy {
+				app.infoLog.Printf("Read replica %s is back up", status.Name)
+			} else {
+				app.errorLog.Printf("Read replica %s is down: %s", status.Name, status.Error)
+			}
+		}
+		cancel()
+	}
+}
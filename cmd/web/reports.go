@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/validator"
+)
+
+// reportForm holds the fields of the form for reporting a snippet.
+type reportForm struct {
+	Reason  string
+	Details string
+	validator.Validator
+}
+
+// The reporter helper identifies who is making a request, for counting
+// reports: users by their account, and everyone else by IP address.
+func (app *application) reporter(r *http.Request) (int, string) {
+	if user := app.currentUser(r); user != nil {
+		return user.ID, "user:" + strconv.Itoa(user.ID)
+	}
+	return 0, "ip:" + app.clientIP(r)
+}
+
+// The snippetReportPost handler records a report of a snippet. Once a
+// snippet has been reported by enough different people, it's hidden until a
+// moderator has looked at it.
+func (app *application) snippetReportPost(w http.ResponseWriter, r *http.Request) {
+	snippet := app.snippetFromPath(w, r)
+	if snippet == nil {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := reportForm{
+		Reason:  r.PostForm.Get("reason"),
+		Details: r.PostForm.Get("details"),
+	}
+
+	// The form only offers the permitted reasons and limits the length of
+	// the details, so anything else didn't come from it.
+	form.Check(slices.Contains(models.ReportReasons, form.Reason), "reason", "Choose a reason")
+	form.Check(validator.MaxChars(form.Details, 500), "details", "This field cannot be more than 500 characters long")
+	if !form.Valid() {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	userID, reporter := app.reporter(r)
+
+	n, err := app.reports.Insert(snippet.ID, userID, reporter, form.Reason, form.Details)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if app.reportThreshold > 0 && n >= app.reportThreshold {
+		err = app.snippets.Hold(snippet.ID, fmt.Sprintf("reported %d times", n))
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.infoLog.Printf("Hid snippet %d after %d reports", snippet.ID, n)
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Thanks for letting us know. A moderator will take a look.")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// The adminReports handler lists the snippets which have been reported.
+func (app *application) adminReports(w http.ResponseWriter, r *http.Request) {
+	reported, err := app.reports.Open()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Reported = reported
+
+	app.render(w, http.StatusOK, "reports.tmpl.html", data)
+}
+
+// The adminDismissReportsPost handler clears the reports of a snippet which
+// a moderator has decided is fine.
+func (app *application) adminDismissReportsPost(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminSnippetID(r)
+	if !ok {
+		app.notFound(w)
+		return
+	}
+
+	err := app.reports.Dismiss(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, app.contextGetUser(r).ID, models.EventModerationDismiss, strconv.Itoa(id))
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Reports of snippet #%d dismissed.", id))
+
+	http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+}
+
+// The adminHidePost handler hides a reported snippet by holding it for
+// review, which moves it to the moderation queue.
+func (app *application) adminHidePost(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminSnippetID(r)
+	if !ok {
+		app.notFound(w)
+		return
+	}
+
+	err := app.snippets.Hold(id, "hidden by a moderator")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.audit(r, app.contextGetUser(r).ID, models.EventModerationHide, strconv.Itoa(id))
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Snippet #%d hidden and moved to the moderation queue.", id))
+
+	http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+}
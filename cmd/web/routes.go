@@ -1,26 +1,257 @@
 package main
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/justinas/alice"
+
+	"snippetbox.floccinau.net/internal/models"
+)
 
 // Chapter 3.5: Isolating the application routes |
-// The routes() method returns a servemux containing our application routes
-func (app *application) routes() *http.ServeMux {
+// The routes() method returns a handler containing our application routes
+func (app *application) routes() http.Handler {
 	mux := http.NewServeMux()
 
-	// Create a file server which serves files out of the "./ui/static" directory.
-	// Note that the path given to the http.Dir function is relative to the project
-	// directory root.
-	fileServer := http.FileServer(http.Dir("./ui/static/"))
+	// Static files are served out of the "./ui/static" directory, by their
+	// plain or fingerprinted names, for all URL paths that start with
+	// "/static/".
+	mux.Handle("/static/", app.staticFiles())
+
+	// The embeddable snippet page and script are shown on other sites, so
+	// they deliberately skip the session and CSRF middleware.
+	mux.HandleFunc("GET /snippet/embed/{id}", app.snippetEmbed)
+	mux.HandleFunc("GET /snippet/{id}/{asset}", app.snippetAsset)
+	mux.HandleFunc("GET /api/oembed", app.oEmbed)
+
+	// The stream of new snippets is long-lived and doesn't need the
+	// session, so it skips the session middleware.
+	mux.HandleFunc("GET /events", app.eventStream)
+
+	// WebSocket connections can't be hijacked through the session
+	// middleware's buffered writer, so the live view of a snippet skips it
+	// too, and is only offered for public snippets.
+	mux.HandleFunc("GET /ws/snippet/{id}", app.snippetSocket)
+
+	// Interactive API documentation. The page itself is at /api/docs, and
+	// the Swagger UI files it loads are under /api/docs/.
+	mux.HandleFunc("GET /api/docs", app.apiDocs)
+	mux.Handle("GET /api/docs/", swaggerAssets)
+
+	// Avatars are public, and named by a key which changes with every
+	// upload, so they're served without the session like static files.
+	mux.HandleFunc("GET /avatars/{key}", app.avatarImage)
+
+	// Health checks and the running version are for load balancers and
+	// monitoring, so they don't need the session either.
+	mux.HandleFunc("GET /healthz", app.healthz)
+	mux.HandleFunc("GET /version", app.versionInfo)
 
-	// Use the mux.Handle() function to register the file server as the handler for
-	// all URL paths that start with "/static/". For matching paths, we strip the
-	// "/static" prefix before the request reaches the file server.
-	mux.Handle("/static/", http.StripPrefix("/static", fileServer))
+	// Violation reports come from browsers without cookies, and
+	// security.txt is for anyone, so neither needs the session.
+	mux.HandleFunc("POST "+cspReportPath, app.cspReport)
+	if app.securityTxtBody != nil {
+		mux.HandleFunc("GET /.well-known/security.txt", app.securityTxt)
+	}
+
+	// Picking a language only sets a cookie, so it doesn't need the session.
+	mux.HandleFunc("GET /locale/{lang}", app.setLanguage)
+
+	// Attachment downloads and thumbnails are authorized by the signature in
+	// their URL rather than by the session.
+	mux.HandleFunc("GET /attachments/{id}/{filename}", app.attachmentDownload)
+	mux.HandleFunc("GET /attachments/{id}/thumb", app.attachmentThumb)
+
+	// Create a middleware chain for our dynamic application routes. These load
+	// and save the session, check the CSRF token on unsafe requests, log
+	// remembered users back in and resolve the logged-in user. In
+	// maintenance mode they turn away any changes. Each group of routes puts
+	// its own time limit and body size limit in front.
+	session := alice.New(app.sessionManager.LoadAndSave, app.csrfProtect, app.rememberMe, app.authenticateSession, app.trackSession, app.readOnly)
+	dynamic := alice.New(app.earlyHints, app.timeout(app.timeouts.page), app.limitBody(app.formBodyLimit())).Extend(session)
 
 	// Register the other application routes as normal.
-	mux.HandleFunc("/", app.home)
-	mux.HandleFunc("/snippet/create", app.snippetCreate)
-	mux.HandleFunc("/snippet/view", app.snippetView)
+	mux.Handle("/", dynamic.ThenFunc(app.home))
+	mux.Handle("GET /snippet/view/{id}", dynamic.ThenFunc(app.snippetView))
+	mux.Handle("GET /trending", dynamic.ThenFunc(app.trending))
+	mux.Handle("GET /archive/{year}/{month}", dynamic.ThenFunc(app.archiveMonth))
+	mux.Handle("GET /collections/{id}", dynamic.ThenFunc(app.collectionView))
+	mux.Handle("GET /language/{language}", dynamic.ThenFunc(app.languageSnippets))
+	mux.Handle("GET /snippet/history/{id}", dynamic.ThenFunc(app.snippetHistory))
+	mux.Handle("GET /snippet/diff/{id}", dynamic.ThenFunc(app.snippetDiff))
+	mux.Handle("POST /snippet/unlock/{id}", dynamic.ThenFunc(app.snippetUnlockPost))
+	mux.Handle("POST /snippet/report/{id}", dynamic.ThenFunc(app.snippetReportPost))
+	mux.Handle("GET /snippet/once/{token}", dynamic.ThenFunc(app.snippetOnce))
+	mux.Handle("POST /snippet/once/{token}", dynamic.ThenFunc(app.snippetOncePost))
+	mux.Handle("GET /user/signup", dynamic.ThenFunc(app.userSignup))
+	mux.Handle("POST /user/signup", dynamic.Append(app.guardForm("/user/login")).ThenFunc(app.userSignupPost))
+	mux.Handle("GET /user/login", dynamic.ThenFunc(app.userLogin))
+	mux.Handle("POST /user/login", dynamic.ThenFunc(app.userLoginPost))
+	mux.Handle("GET /user/{username}", dynamic.ThenFunc(app.userProfile))
+
+	// With an OpenID Connect provider, logins go through it instead. The
+	// backchannel logout comes from the provider's server rather than a
+	// browser, so it has no session or CSRF token.
+	if app.oidc != nil {
+		mux.Handle("GET /auth/oidc/login", dynamic.ThenFunc(app.oidcLogin))
+		mux.Handle("GET /auth/oidc/callback", dynamic.ThenFunc(app.oidcCallback))
+		mux.Handle("POST /auth/oidc/backchannel-logout", alice.New(app.timeout(app.timeouts.page), app.limitBody(app.formBodyLimit())).ThenFunc(app.oidcBackchannelLogout))
+	}
+
+	// Creating snippets needs an account unless anonymous posting is on.
+	// The signup and create forms are popular with bots, so they're
+	// guarded with a honeypot and a minimum time to fill them in.
+	create := dynamic.Append(app.requireAuthenticationUnlessAnonymous)
+	mux.Handle("GET /snippet/create", create.ThenFunc(app.snippetCreate))
+	mux.Handle("POST /snippet/create", create.Append(app.guardForm("/")).ThenFunc(app.snippetCreatePost))
+
+	// Routes which are only available to logged-in users. Those which
+	// change snippets also need the snippets:write permission.
+	protected := dynamic.Append(app.requireAuthentication)
+	write := protected.Append(app.requirePermission(models.PermissionSnippetsWrite))
+
+	mux.Handle("POST /snippet/comment/{id}", protected.ThenFunc(app.snippetCommentPost))
+	mux.Handle("POST /comment/delete/{id}", protected.ThenFunc(app.commentDeletePost))
+	mux.Handle("POST /snippet/star/{id}", protected.ThenFunc(app.snippetStarPost))
+	mux.Handle("POST /snippet/collect/{id}", protected.ThenFunc(app.snippetCollectPost))
+	mux.Handle("POST /snippet/pin/{id}", write.ThenFunc(app.snippetPinPost))
+	mux.Handle("POST /user/{username}/follow", protected.ThenFunc(app.userFollowPost))
+	mux.Handle("POST /snippet/fork/{id}", write.ThenFunc(app.snippetForkPost))
+	mux.Handle("GET /snippet/edit/{id}", write.ThenFunc(app.snippetEdit))
+	mux.Handle("POST /snippet/edit/{id}", write.ThenFunc(app.snippetEditPost))
+	mux.Handle("POST /snippet/restore/{id}", write.ThenFunc(app.snippetRestorePost))
+	mux.Handle("POST /attachment/delete/{id}", write.ThenFunc(app.attachmentDeletePost))
+	mux.Handle("POST /snippet/delete/{id}", write.ThenFunc(app.snippetDeletePost))
+	mux.Handle("GET /account/webhooks", protected.ThenFunc(app.accountWebhooks))
+	mux.Handle("POST /account/webhooks", protected.ThenFunc(app.accountWebhooksPost))
+	mux.Handle("GET /account/webhooks/{id}", protected.ThenFunc(app.accountWebhook))
+	mux.Handle("POST /account/webhooks/{id}/delete", protected.ThenFunc(app.accountWebhookDeletePost))
+	mux.Handle("POST /account/webhooks/deliveries/{id}/redeliver", protected.ThenFunc(app.webhookRedeliverPost))
+	mux.Handle("GET /account/tokens", protected.ThenFunc(app.accountTokens))
+	mux.Handle("POST /account/tokens", protected.ThenFunc(app.accountTokensPost))
+	mux.Handle("POST /account/tokens/{id}/revoke", protected.ThenFunc(app.accountTokenRevokePost))
+	mux.Handle("GET /account/sessions", protected.ThenFunc(app.accountSessions))
+	mux.Handle("POST /account/sessions/{id}/revoke", protected.ThenFunc(app.accountSessionRevokePost))
+	mux.Handle("POST /account/sessions/revoke-all", protected.ThenFunc(app.accountSessionsRevokeAllPost))
+	mux.Handle("GET /collections", protected.ThenFunc(app.accountCollections))
+	mux.Handle("POST /collections", protected.ThenFunc(app.accountCollectionsPost))
+	mux.Handle("POST /collections/{id}/edit", protected.ThenFunc(app.collectionEditPost))
+	mux.Handle("POST /collections/{id}/delete", protected.ThenFunc(app.collectionDeletePost))
+	mux.Handle("POST /collections/{id}/items/{snippet}/delete", protected.ThenFunc(app.collectionItemDeletePost))
+	mux.Handle("POST /collections/{id}/items/{snippet}/move", protected.ThenFunc(app.collectionItemMovePost))
+	mux.Handle("GET /orgs", protected.ThenFunc(app.accountOrgs))
+	mux.Handle("POST /orgs", protected.ThenFunc(app.accountOrgsPost))
+	mux.Handle("POST /orgs/switch", protected.ThenFunc(app.orgSwitchPost))
+	mux.Handle("GET /orgs/{slug}", protected.ThenFunc(app.orgView))
+	mux.Handle("GET /orgs/{slug}/settings", protected.ThenFunc(app.orgSettings))
+	mux.Handle("POST /orgs/{slug}/settings", protected.ThenFunc(app.orgSettingsPost))
+	mux.Handle("POST /orgs/{slug}/members", protected.ThenFunc(app.orgMembersPost))
+	mux.Handle("POST /orgs/{slug}/members/{id}/remove", protected.ThenFunc(app.orgMemberRemovePost))
+	mux.Handle("POST /orgs/{slug}/delete", protected.ThenFunc(app.orgDeletePost))
+
+	// Uploads are limited in size before the session and CSRF middleware get
+	// to read the body. The extra 64KB leaves room for the multipart headers
+	// and other form fields. They get longer to finish than other pages.
+	upload := alice.New(app.timeout(app.timeouts.upload), app.limitBody(app.maxUploadSize+64<<10)).
+		Extend(session).Append(app.requireAuthentication)
+
+	mux.Handle("POST /snippet/attach/{id}", upload.Append(app.requirePermission(models.PermissionSnippetsWrite)).ThenFunc(app.snippetAttachPost))
+	mux.Handle("POST /account/avatar", upload.ThenFunc(app.accountAvatarPost))
+	mux.Handle("POST /account/avatar/delete", protected.ThenFunc(app.accountAvatarDeletePost))
+	mux.Handle("GET /account/starred", protected.ThenFunc(app.accountStarred))
+	mux.Handle("GET /account/profile", protected.ThenFunc(app.accountProfile))
+	mux.Handle("POST /account/profile", protected.ThenFunc(app.accountProfilePost))
+	// The export is written as it's built, so it skips the page time limit
+	// and the session middleware's buffering, either of which would hold
+	// the whole archive in memory.
+	export := alice.New(app.sessionManager.LoadAndStream, app.csrfProtect, app.rememberMe, app.authenticateSession, app.trackSession, app.readOnly, app.requireAuthentication)
+	mux.Handle("GET /account/export", export.ThenFunc(app.accountExport))
+	mux.Handle("GET /account/import", protected.ThenFunc(app.accountImport))
+	mux.Handle("POST /account/import", write.ThenFunc(app.accountImportPost))
+	mux.Handle("GET /account/delete", protected.ThenFunc(app.accountDelete))
+	mux.Handle("POST /account/delete", protected.ThenFunc(app.accountDeletePost))
+	mux.Handle("POST /user/logout", protected.ThenFunc(app.userLogoutPost))
+
+	// The administration pages. Moderators look after what's posted, and
+	// the admin:system permission covers running the site.
+	moderate := protected.Append(app.requirePermission(models.PermissionAdminModerate))
+	system := protected.Append(app.requirePermission(models.PermissionAdminSystem))
+
+	mux.Handle("GET /admin/moderation", moderate.ThenFunc(app.adminModeration))
+	mux.Handle("POST /admin/moderation/{id}/approve", moderate.ThenFunc(app.adminApprovePost))
+	mux.Handle("POST /admin/moderation/{id}/reject", moderate.ThenFunc(app.adminRejectPost))
+	mux.Handle("GET /admin/reports", moderate.ThenFunc(app.adminReports))
+	mux.Handle("POST /admin/reports/{id}/dismiss", moderate.ThenFunc(app.adminDismissReportsPost))
+	mux.Handle("POST /admin/reports/{id}/hide", moderate.ThenFunc(app.adminHidePost))
+	mux.Handle("POST /admin/announcements/{id}", moderate.ThenFunc(app.adminAnnouncePost))
+	mux.Handle("GET /admin/invites", moderate.ThenFunc(app.adminInvites))
+	mux.Handle("POST /admin/invites", moderate.ThenFunc(app.adminInvitesPost))
+	mux.Handle("POST /admin/invites/{id}/revoke", moderate.ThenFunc(app.adminInviteRevokePost))
+	mux.Handle("GET /admin/secrets", moderate.ThenFunc(app.adminSecrets))
+	mux.Handle("GET /admin/quarantine", moderate.ThenFunc(app.adminQuarantine))
+	mux.Handle("POST /admin/quarantine/{id}/release", moderate.ThenFunc(app.adminQuarantineReleasePost))
+	mux.Handle("POST /admin/quarantine/{id}/rescan", moderate.ThenFunc(app.adminQuarantineRescanPost))
+	mux.Handle("POST /admin/quarantine/{id}/delete", moderate.ThenFunc(app.adminQuarantineDeletePost))
+	mux.Handle("POST /admin/maintenance", system.ThenFunc(app.adminMaintenancePost))
+	mux.Handle("GET /admin/audit", system.ThenFunc(app.adminAudit))
+	mux.Handle("GET /admin/ip-bans", system.ThenFunc(app.adminIPBans))
+	mux.Handle("POST /admin/ip-bans", system.ThenFunc(app.adminIPBansPost))
+	mux.Handle("POST /admin/ip-bans/{id}/delete", system.ThenFunc(app.adminIPBanDeletePost))
+
+	// Profiling and runtime variables, for diagnosing problems in production.
+	// Profiles can take as long as they're asked to, so there's no time
+	// limit.
+	mux.Handle("/debug/", session.Append(app.requireAuthentication, app.requirePermission(models.PermissionAdminSystem)).Then(app.debugRoutes()))
+
+	// The JSON API lives on its own servemux so that every /api/v1 route
+	// passes through the CORS, rate limiting and authenticate() middleware.
+	// The per-IP ceiling goes before authenticate() so that requests with
+	// bad tokens count against it too.
+	api := alice.New(app.timeout(app.timeouts.page), app.enableCORS, app.limitBody(app.jsonBodyLimit()), app.readOnlyAPI, app.rateLimitIP, app.authenticate, app.rateLimitQuota)
+	mux.Handle("/api/v1/", api.Then(app.apiRoutes()))
+
+	// GraphQL takes the same tokens and has the same rate limits as the
+	// JSON API. Queries only read, so they're still answered in
+	// maintenance mode. GraphiQL, for trying them out, is only served in
+	// development mode.
+	graphQL := alice.New(app.timeout(app.timeouts.page), app.enableCORS, app.limitBody(app.jsonBodyLimit()), app.rateLimitIP, app.authenticate, app.rateLimitQuota)
+	mux.Handle(graphQLPath, graphQL.ThenFunc(app.graphQL))
+	if app.dev {
+		mux.HandleFunc("GET /graphiql", app.graphiQL)
+	}
+
+	// The pastebin-compatible endpoint is for scripts, so it takes a bearer
+	// token rather than the session, and shares the API's rate limits.
+	paste := alice.New(app.timeout(app.timeouts.page), app.limitBody(app.formBodyLimit()), app.readOnlyAPI, app.rateLimitIP, app.authenticate, app.rateLimitQuota)
+	mux.Handle("POST /api/create", paste.ThenFunc(app.pasteCreate))
+
+	// Every response, including static files and the API, goes through
+	// secureHeaders() so that the Content Security Policy is always sent.
+	// realIP() comes first, so everything after it, including the access
+	// log and the IP filter, sees the client's address, and geolocate()
+	// next, so that they see its country. recoverPanic() comes after the
+	// access log, so that requests which panic are logged with their 500,
+	// as are requests the filter turns away.
+	return app.realIP(app.geolocate(app.logAccess(app.filterIP(app.recoverPanic(app.secureHeaders(app.requireCanonicalHost(mux)))))))
+}
+
+// The apiRoutes() method returns a servemux containing the /api/v1 routes.
+func (app *application) apiRoutes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /api/v1/tokens/authentication", app.apiCreateAuthenticationToken)
+	mux.HandleFunc("GET /api/v1/users/me", app.requireAuthenticatedUser(app.apiShowCurrentUser))
+	mux.HandleFunc("GET /api/v1/snippets", app.apiListSnippets)
+	mux.HandleFunc("POST /api/v1/snippets", app.requireUserPermission(models.PermissionSnippetsWrite, app.apiCreateSnippet))
+	mux.HandleFunc("POST /api/v1/snippets:batchCreate", app.requireUserPermission(models.PermissionSnippetsWrite, app.apiBatchCreateSnippets))
+	mux.HandleFunc("DELETE /api/v1/snippets:batchDelete", app.requireUserPermission(models.PermissionSnippetsWrite, app.apiBatchDeleteSnippets))
+	mux.HandleFunc("GET /api/v1/snippets/{id}", app.apiShowSnippet)
+	mux.HandleFunc("PATCH /api/v1/snippets/{id}", app.requireUserPermission(models.PermissionSnippetsWrite, app.apiUpdateSnippet))
+	mux.HandleFunc("GET /api/v1/openapi.json", app.apiOpenAPI)
+
+	// Anything else under /api/v1 gets a JSON 404 rather than the plain-text
+	// one from http.NotFound.
+	mux.HandleFunc("/api/v1/", app.notFoundResponse)
 
 	return mux
 }
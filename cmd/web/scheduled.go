@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/worker"
+)
+
+// snippetPublishJob is the kind of job which announces a scheduled snippet
+// once it's published.
+const snippetPublishJob = "snippet.publish"
+
+// publishAtLayout is the layout of the value sent by a datetime-local input.
+const publishAtLayout = "2006-01-02T15:04"
+
+// snippetPublishPayload is the payload of a snippetPublishJob.
+type snippetPublishPayload struct {
+	SnippetID int `json:"snippet_id"`
+}
+
+// parsePublishAt parses the value of the publish_at form field, which is in
+// the visitor's time zone. An empty value means now, and is returned as the
+// zero time.
+func parsePublishAt(value string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.ParseInLocation(publishAtLayout, value, loc)
+}
+
+// The schedulePublish method queues the job which announces a snippet once
+// it's published at the given time. A scheduled snippet is stored straight
+// away, but isn't shown anywhere except to its owner until its publish_at
+// time. The job then tells webhooks and the /events stream about it as if
+// it had just been created.
+func (app *application) schedulePublish(id int, at time.Time) error {
+	return app.jobs.EnqueueAt(snippetPublishJob, snippetPublishPayload{SnippetID: id}, at)
+}
+
+// The publishScheduled method is the handler for snippetPublishJob jobs. If
+// the snippet has been deleted, or is held for review, there's nothing to
+// announce; approving a held snippet announces it instead.
+func (app *application) publishScheduled(ctx context.Context, job *worker.Job) error {
+	var input snippetPublishPayload
+	err := job.Decode(&input)
+	if err != nil {
+		return worker.Permanent(err)
+	}
+
+	_, err = app.snippets.Get(ctx, input.SnippetID)
+	if err == nil {
+		app.notifySnippetChange(models.EventSnippetCreated, input.SnippetID)
+		app.announceSnippet(input.SnippetID)
+		return nil
+	}
+	if !errors.Is(err, models.ErrNoRecord) {
+		return err
+	}
+
+	// The job can run a little early if the clocks of the database and the
+	// worker disagree, so try again when the snippet is due.
+	snippet, err := app.snippets.GetScheduled(input.SnippetID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	return worker.RetryAfter(errors.New("snippet is not published yet"), time.Until(snippet.PublishAt)+time.Second)
+}
+
+// The scheduledSnippet helper returns a snippet which is scheduled to be
+// published later, if the current user could edit it. Anyone else gets
+// models.ErrNoRecord, as if it didn't exist yet.
+func (app *application) scheduledSnippet(r *http.Request, id int) (*models.Snippet, error) {
+	snippet, err := app.snippets.GetScheduled(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !app.canEdit(app.currentUser(r), snippet) {
+		return nil, models.ErrNoRecord
+	}
+
+	return snippet, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/secrets"
+)
+
+// secretsBlockedMessage is shown when a snippet is refused because of a
+// secret in it.
+const secretsBlockedMessage = "This looks like it contains a private key or access key. Remove it before publishing."
+
+// secretsRedactedWarning and secretsWarning are shown once a snippet with
+// secrets in it has been saved.
+const (
+	secretsRedactedWarning = "Parts of your snippet which looked like passwords, keys or tokens were replaced with [REDACTED]."
+	secretsWarning         = "Your snippet looks like it contains a password or token. If it's a real one, change it now."
+)
+
+// The scanSecrets helper checks content against the secret rules. New and
+// edited snippets are scanned for things which look like passwords, keys
+// and tokens before they're saved. Depending on the rule which matched, the
+// snippet is refused, the secret is replaced with [REDACTED], or the author
+// is warned. Each submission where something was found is recorded for the
+// /admin/secrets page, without the secret.
+func (app *application) scanSecrets(content string) secrets.Result {
+	return app.secretScanner.Scan(content)
+}
+
+// The recordSecrets helper records a submission in which the scan found
+// something, for the admin page. A failure is logged but doesn't fail the
+// request.
+func (app *application) recordSecrets(r *http.Request, snippetID int, scan secrets.Result) {
+	var userID int
+	if user := app.currentUser(r); user != nil {
+		userID = user.ID
+	}
+
+	app.recordSecretsFrom(snippetID, userID, app.clientIP(r), scan)
+}
+
+// recordSecretsFrom is recordSecrets for submissions which didn't come in
+// over HTTP, like pastes over TCP.
+func (app *application) recordSecretsFrom(snippetID, userID int, ip string, scan secrets.Result) {
+	if len(scan.Findings) == 0 {
+		return
+	}
+
+	outcome := models.SecretsWarned
+	switch {
+	case scan.Has(secrets.Block):
+		outcome = models.SecretsBlocked
+	case scan.Has(secrets.Redact):
+		outcome = models.SecretsRedacted
+	}
+
+	err := app.secretFindings.Insert(snippetID, userID, ip, scan.RuleIDs(), outcome)
+	if err != nil {
+		app.errorLog.Print(err)
+	}
+}
+
+// secretsNotice returns the warning for the author of a snippet which has
+// been saved, or "" if the scan found nothing.
+func secretsNotice(scan secrets.Result) string {
+	switch {
+	case scan.Has(secrets.Redact):
+		return secretsRedactedWarning
+	case scan.Has(secrets.Warn):
+		return secretsWarning
+	}
+	return ""
+}
+
+// The warnSecrets helper shows the author of a saved snippet what the scan
+// found, on the next page.
+func (app *application) warnSecrets(r *http.Request, scan secrets.Result) {
+	if notice := secretsNotice(scan); notice != "" {
+		app.sessionManager.Put(r.Context(), "warning", notice)
+	}
+}
+
+// withSecretsWarning adds what the scan found to an API response, if it
+// found anything. It replaces any other warning, since it matters more.
+func withSecretsWarning(env envelope, scan secrets.Result) envelope {
+	if notice := secretsNotice(scan); notice != "" {
+		env["warning"] = notice
+	}
+	return env
+}
+
+// secretsPageSize is how many findings the admin page shows.
+const secretsPageSize = 200
+
+// The adminSecrets handler lists the latest submissions in which the
+// secret scanner found something.
+func (app *application) adminSecrets(w http.ResponseWriter, r *http.Request) {
+	findings, err := app.secretFindings.Latest(secretsPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.SecretFindings = findings
+
+	app.render(w, http.StatusOK, "secrets.tmpl.html", data)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// cspReportPath is where browsers send reports of Content Security Policy
+// violations, and cspReportGroup is the name it's given in the
+// Reporting-Endpoints header.
+const (
+	cspReportPath  = "/csp-report"
+	cspReportGroup = "csp-endpoint"
+)
+
+// cspReportLimit is how many violation reports are accepted from one IP
+// address a minute. A page can break the policy many times over, and the
+// endpoint takes anything anyone sends it, so it's kept from flooding the
+// log.
+const cspReportLimit = 30
+
+// loadSecurityTxt reads the security.txt file, which tells security
+// researchers how to report vulnerabilities (RFC 9116). It must have the
+// two required fields, Contact and Expires. A file which has expired is
+// still served, since an out of date contact is better than none, but a
+// warning is logged.
+func loadSecurityTxt(path string) ([]byte, time.Time, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var contact bool
+	var expires time.Time
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.HasPrefix(name, "#") {
+			continue
+		}
+
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "contact":
+			contact = true
+		case "expires":
+			expires, err = time.Parse(time.RFC3339, strings.TrimSpace(value))
+			if err != nil {
+				return nil, time.Time{}, fmt.Errorf("%s: Expires must be an RFC 3339 date and time: %w", path, err)
+			}
+		}
+	}
+
+	if !contact || expires.IsZero() {
+		return nil, time.Time{}, fmt.Errorf("%s: security.txt needs both Contact and Expires fields", path)
+	}
+
+	return b, expires, nil
+}
+
+// The securityTxt handler serves /.well-known/security.txt.
+func (app *application) securityTxt(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(app.securityTxtBody)
+}
+
+// cspViolation is the part of a violation report which is logged. Browsers
+// send it in one of two shapes: the older report-uri one, with hyphenated
+// names, and the Reporting API one, with camel-cased names.
+type cspViolation struct {
+	DocumentURL        string
+	EffectiveDirective string
+	BlockedURL         string
+	SourceFile         string
+	LineNumber         int
+	Disposition        string
+}
+
+// legacyCSPReport is a report sent because of the report-uri directive,
+// as application/csp-report.
+type legacyCSPReport struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		BlockedURI         string `json:"blocked-uri"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+		Disposition        string `json:"disposition"`
+	} `json:"csp-report"`
+}
+
+// reportingAPIReport is one of the reports sent because of the report-to
+// directive, as application/reports+json.
+type reportingAPIReport struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		BlockedURL         string `json:"blockedURL"`
+		SourceFile         string `json:"sourceFile"`
+		LineNumber         int    `json:"lineNumber"`
+		Disposition        string `json:"disposition"`
+	} `json:"body"`
+}
+
+// parseCSPReports decodes the violations in a report request, according to
+// its content type.
+func parseCSPReports(contentType string, body []byte) ([]cspViolation, error) {
+	contentType, _, _ = strings.Cut(contentType, ";")
+
+	switch strings.TrimSpace(contentType) {
+	case "application/csp-report", "application/json":
+		var report legacyCSPReport
+		if err := json.Unmarshal(body, &report); err != nil {
+			return nil, err
+		}
+
+		rep := report.Report
+		directive := rep.EffectiveDirective
+		if directive == "" {
+			directive = rep.ViolatedDirective
+		}
+		return []cspViolation{{
+			DocumentURL:        rep.DocumentURI,
+			EffectiveDirective: directive,
+			BlockedURL:         rep.BlockedURI,
+			SourceFile:         rep.SourceFile,
+			LineNumber:         rep.LineNumber,
+			Disposition:        rep.Disposition,
+		}}, nil
+
+	case "application/reports+json":
+		var reports []reportingAPIReport
+		if err := json.Unmarshal(body, &reports); err != nil {
+			return nil, err
+		}
+
+		var violations []cspViolation
+		for _, rep := range reports {
+			if rep.Type != "csp-violation" {
+				continue
+			}
+			violations = append(violations, cspViolation(rep.Body))
+		}
+		return violations, nil
+	}
+
+	return nil, fmt.Errorf("unsupported content type %q", contentType)
+}
+
+// valid reports whether the violation looks like it came from a browser
+// loading one of the site's pages on host, rather than being made up. The
+// directive must be a plain name, like script-src-elem, and the disposition
+// one of the two a browser sends, so that neither can carry anything else
+// into the log.
+func (v cspViolation) valid(host string) bool {
+	u, err := url.Parse(v.DocumentURL)
+	return err == nil && strings.EqualFold(u.Host, host) &&
+		isDirectiveName(v.EffectiveDirective) &&
+		(v.Disposition == "" || v.Disposition == "enforce" || v.Disposition == "report")
+}
+
+// isDirectiveName reports whether s could be the name of a CSP directive:
+// lower-case letters and hyphens, and not empty.
+func isDirectiveName(s string) bool {
+	if s == "" || len(s) > 64 {
+		return false
+	}
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// noise reports whether the violation was caused by a browser extension
+// injecting its own scripts or styles, which the site can't do anything
+// about.
+func (v cspViolation) noise() bool {
+	for _, scheme := range []string{"chrome-extension", "moz-extension", "safari-extension", "safari-web-extension"} {
+		if strings.HasPrefix(v.BlockedURL, scheme) || strings.HasPrefix(v.SourceFile, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// The cspReport handler logs the Content Security Policy violations which
+// browsers report, so that the policy can be watched for pages it breaks.
+// Reports are limited in size and number from each IP address, and ones
+// which don't come from the site's own pages are thrown away. Browsers
+// don't do anything with the response, so it's always 204 No Content
+// unless the request was bad.
+func (app *application) cspReport(w http.ResponseWriter, r *http.Request) {
+	ok, _, _ := app.takeRateLimit(r, "csp:"+app.clientIP(r), cspReportLimit, time.Minute)
+	if !ok {
+		app.clientError(w, http.StatusTooManyRequests)
+		return
+	}
+
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(http.MaxBytesReader(w, r.Body, 64<<10))
+	if err != nil {
+		app.clientError(w, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	violations, err := parseCSPReports(r.Header.Get("Content-Type"), buf.Bytes())
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	for _, v := range violations {
+		if !v.valid(r.Host) || v.noise() {
+			continue
+		}
+		// The blocked URL and source file are quoted, since anyone can send
+		// a report and they could otherwise start new lines in the log.
+		app.infoLog.Printf("CSP violation on %s: %s blocked %q (%q:%d, %s)",
+			v.DocumentURL, v.EffectiveDirective, orDash(v.BlockedURL), orDash(v.SourceFile), v.LineNumber, orDash(v.Disposition))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// shutdownTimeout is how long the requests in flight, then the background
+// tasks and running jobs, get between them to finish when the application
+// shuts down. Jobs which are still running after that are retried when the
+// application next starts.
+const shutdownTimeout = 30 * time.Second
+
+// service is something the application serves until it's shut down. Most
+// are streamServices, like an *http.Server or the TCP paste listener; the
+// HTTP/3 server is a packetService.
+type service interface {
+	Shutdown(ctx context.Context) error
+}
+
+// streamService is a service which is served on a listener.
+type streamService interface {
+	Serve(ln net.Listener) error
+	Shutdown(ctx context.Context) error
+}
+
+// packetService is a service which is served on a UDP socket. Shutting it
+// down leaves the socket open.
+type packetService interface {
+	Serve(pc net.PacketConn) error
+	Shutdown(ctx context.Context) error
+}
+
+// server is one of the servers the application runs, like the public site,
+// the HTTP to HTTPS redirector or the debug server.
+type server struct {
+	name string
+	srv  service
+	// ln is the listener to serve a streamService on. If it's nil, the
+	// server listens on TCP at addr. A packetService is served on pc, a UDP
+	// socket opened at addr.
+	ln   net.Listener
+	pc   net.PacketConn
+	addr string
+	// An *http.Server uses TLS if its TLSConfig is set, with the
+	// certificate and key in these files, unless TLSConfig has its own
+	// certificates.
+	certFile, keyFile string
+}
+
+// listen opens the server's listener or UDP socket, unless it's already
+// open.
+func (s *server) listen() error {
+	var err error
+	switch s.srv.(type) {
+	case packetService:
+		if s.pc == nil {
+			s.pc, err = net.ListenPacket("udp", s.addr)
+		}
+	default:
+		if s.ln == nil {
+			s.ln, err = net.Listen("tcp", s.addr)
+		}
+	}
+	return err
+}
+
+// localAddr returns the address the server is listening on.
+func (s *server) localAddr() net.Addr {
+	if s.pc != nil {
+		return s.pc.LocalAddr()
+	}
+	return s.ln.Addr()
+}
+
+// close closes the server's listener or UDP socket.
+func (s *server) close() error {
+	if s.pc != nil {
+		return s.pc.Close()
+	}
+	return s.ln.Close()
+}
+
+func (s *server) serve() error {
+	switch srv := s.srv.(type) {
+	case *http.Server:
+		if srv.TLSConfig != nil {
+			return srv.ServeTLS(s.ln, s.certFile, s.keyFile)
+		}
+		return srv.Serve(s.ln)
+	case packetService:
+		return srv.Serve(s.pc)
+	case streamService:
+		return srv.Serve(s.ln)
+	}
+	return fmt.Errorf("can't serve a %T", s.srv)
+}
+
+// The run method serves each of the servers until the application gets
+// SIGINT or SIGTERM, or one of them fails, and then shuts them all down
+// along with the background tasks and jobs. It returns the first error,
+// if there was one.
+func (app *application) run(servers ...*server) error {
+	// Every listener is opened before anything is served, so that an
+	// address which is already in use stops the application straight away.
+	for i, s := range servers {
+		err := s.listen()
+		if err != nil {
+			for _, s := range servers[:i] {
+				s.close()
+			}
+			return fmt.Errorf("%s: %w", s.name, err)
+		}
+	}
+
+	g, ctx := errgroup.WithContext(context.Background())
+
+	for _, s := range servers {
+		g.Go(func() error {
+			app.infoLog.Printf("Starting %s on %s", s.name, s.localAddr())
+
+			err := s.serve()
+			if !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("%s: %w", s.name, err)
+			}
+			return nil
+		})
+	}
+
+	g.Go(func() error {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(quit)
+
+		// The context is cancelled when one of the servers fails, and
+		// the others are shut down along with it.
+		select {
+		case sig := <-quit:
+			app.infoLog.Printf("Shutting down server (%s)", sig)
+		case <-ctx.Done():
+			app.infoLog.Print("Shutting down server")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		var err error
+		for _, s := range servers {
+			err = errors.Join(err, s.srv.Shutdown(ctx))
+			if s.pc != nil {
+				err = errors.Join(err, s.pc.Close())
+			}
+		}
+
+		// Requests can start background tasks, so wait for those only once
+		// the servers have stopped.
+		close(app.shutdown)
+		return errors.Join(err, app.waitBackground(ctx), app.jobs.Shutdown(ctx), app.errReporter.Close(ctx))
+	})
+
+	return g.Wait()
+}
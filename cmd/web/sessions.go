@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// sessionSeenInterval is how often the last-seen time of a session is
+// updated. Updating it on every request would mean saving the session on
+// every request too.
+const sessionSeenInterval = time.Minute
+
+// activeSession is one of a user's logged-in sessions, as listed on the
+// sessions page. ID is a hash of the session token, so that the token
+// itself is never put in a page.
+type activeSession struct {
+	ID        string
+	Device    string
+	IP        string
+	Started   time.Time
+	LastSeen  time.Time
+	Expires   time.Time
+	IsCurrent bool
+}
+
+// sessionID returns the ID a session is shown with.
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// logIn logs the user in to the current session. The token is renewed
+// first, so that it can't have been planted by someone else.
+func (app *application) logIn(r *http.Request, userID int) error {
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", userID)
+	app.sessionManager.Put(r.Context(), "sessionStarted", now)
+	app.sessionManager.Put(r.Context(), "sessionLastSeen", now)
+	app.sessionManager.Put(r.Context(), "sessionIP", app.clientIP(r))
+	app.sessionManager.Put(r.Context(), "sessionUserAgent", r.UserAgent())
+
+	return nil
+}
+
+// The trackSession() middleware keeps the last-seen time, address and
+// browser of logged-in sessions up to date. It must be used after
+// authenticateSession().
+func (app *application) trackSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.isAuthenticated(r) {
+			lastSeen := app.sessionManager.GetTime(r.Context(), "sessionLastSeen")
+			if time.Since(lastSeen) > sessionSeenInterval {
+				app.sessionManager.Put(r.Context(), "sessionLastSeen", time.Now())
+				app.sessionManager.Put(r.Context(), "sessionIP", app.clientIP(r))
+				app.sessionManager.Put(r.Context(), "sessionUserAgent", r.UserAgent())
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// userSessions returns the user's logged-in sessions, most recently used
+// first, for the /account/sessions page, where users can end any they don't
+// recognize. The session store is searched for them, rather than keeping a
+// separate list which could fall out of step.
+func (app *application) userSessions(r *http.Request, userID int) ([]*activeSession, error) {
+	current := app.sessionManager.Token(r.Context())
+
+	var sessions []*activeSession
+	err := app.sessionManager.Iterate(r.Context(), func(ctx context.Context) error {
+		if app.sessionManager.GetInt(ctx, "authenticatedUserID") != userID {
+			return nil
+		}
+
+		token := app.sessionManager.Token(ctx)
+		sessions = append(sessions, &activeSession{
+			ID:        sessionID(token),
+			Device:    describeUserAgent(app.sessionManager.GetString(ctx, "sessionUserAgent")),
+			IP:        app.sessionManager.GetString(ctx, "sessionIP"),
+			Started:   app.sessionManager.GetTime(ctx, "sessionStarted"),
+			LastSeen:  app.sessionManager.GetTime(ctx, "sessionLastSeen"),
+			Expires:   app.sessionManager.Deadline(ctx),
+			IsCurrent: token == current,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(sessions, func(a, b *activeSession) int {
+		return b.LastSeen.Compare(a.LastSeen)
+	})
+
+	return sessions, nil
+}
+
+// endSessions ends the user's sessions which match, and returns how many
+// there were.
+func (app *application) endSessions(r *http.Request, userID int, match func(token string) bool) (int, error) {
+	var n int
+	err := app.sessionManager.Iterate(r.Context(), func(ctx context.Context) error {
+		if app.sessionManager.GetInt(ctx, "authenticatedUserID") != userID || !match(app.sessionManager.Token(ctx)) {
+			return nil
+		}
+
+		n++
+		return app.sessionManager.Destroy(ctx)
+	})
+
+	return n, err
+}
+
+// describeUserAgent turns a User-Agent header into something like "Firefox
+// on Linux". It only knows the common browsers and systems; anything else
+// is "Unknown".
+func describeUserAgent(ua string) string {
+	var browser string
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(ua, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	case strings.HasPrefix(ua, "curl/"):
+		browser = "curl"
+	}
+
+	var system string
+	switch {
+	case strings.Contains(ua, "Android"):
+		system = "Android"
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"):
+		system = "iOS"
+	case strings.Contains(ua, "Windows"):
+		system = "Windows"
+	case strings.Contains(ua, "Mac OS X"):
+		system = "macOS"
+	case strings.Contains(ua, "CrOS"):
+		system = "ChromeOS"
+	case strings.Contains(ua, "Linux"):
+		system = "Linux"
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	return "Unknown"
+}
+
+// The accountSessions handler lists the current user's logged-in sessions.
+func (app *application) accountSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := app.userSessions(r, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Sessions = sessions
+	app.render(w, http.StatusOK, "sessions.tmpl.html", data)
+}
+
+// The accountSessionRevokePost handler ends one of the current user's
+// other sessions. Sessions which aren't theirs are reported as not found.
+func (app *application) accountSessionRevokePost(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	id := r.PathValue("id")
+	current := app.sessionManager.Token(r.Context())
+
+	n, err := app.endSessions(r, user.ID, func(token string) bool {
+		return token != current && sessionID(token) == id
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if n == 0 {
+		app.notFound(w)
+		return
+	}
+
+	app.audit(r, user.ID, models.EventSessionRevoke, id)
+
+	app.sessionManager.Put(r.Context(), "flash", "Session ended.")
+
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+// The accountSessionsRevokeAllPost handler logs the current user out
+// everywhere but here. Their remember-me cookies are revoked too, or they'd
+// just log the other browsers back in.
+func (app *application) accountSessionsRevokeAllPost(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	current := app.sessionManager.Token(r.Context())
+
+	n, err := app.endSessions(r, user.ID, func(token string) bool {
+		return token != current
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.rememberTokens.DeleteAllForUser(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.clearRememberCookie(w)
+
+	app.audit(r, user.ID, models.EventSessionRevokeAll, fmt.Sprintf("%d sessions", n))
+
+	app.sessionManager.Put(r.Context(), "flash", "You've been logged out everywhere else.")
+
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// maxTags is the most tags a snippet can have.
+const maxTags = 5
+
+// tagRX matches a normalized tag or language name: lower case letters,
+// digits and a little punctuation (for names like "c++", "c#" or "objective-c"),
+// starting with a letter or digit.
+var tagRX = regexp.MustCompile(`^[a-z0-9][a-z0-9+#.-]{0,31}$`)
+
+// parseTags splits a comma-separated list of tags, as typed into the create
+// and edit forms, into normalized tags without duplicates. It returns an
+// error message for the form if any tag isn't valid.
+func parseTags(s string) ([]string, string) {
+	return normalizeTags(strings.Split(s, ","))
+}
+
+// normalizeTags lower-cases and sorts a list of tags, dropping blanks and
+// duplicates. It returns an error message if any tag isn't valid or there are
+// too many.
+func normalizeTags(fields []string) ([]string, string) {
+	var tags []string
+
+	for _, field := range fields {
+		tag := strings.ToLower(strings.TrimSpace(field))
+		if tag == "" || slices.Contains(tags, tag) {
+			continue
+		}
+		if !tagRX.MatchString(tag) {
+			return nil, "Tags can only contain letters, numbers and + # . - and be up to 32 characters long"
+		}
+		tags = append(tags, tag)
+	}
+
+	if len(tags) > maxTags {
+		return nil, "A snippet can't have more than 5 tags"
+	}
+
+	slices.Sort(tags)
+	return tags, ""
+}
+
+// normalizeLanguage lower-cases a language name, returning false if it isn't
+// a valid name. An empty name is valid and means the language isn't known.
+func normalizeLanguage(s string) (string, bool) {
+	language := strings.ToLower(strings.TrimSpace(s))
+	if language == "" {
+		return "", true
+	}
+	return language, tagRX.MatchString(language)
+}
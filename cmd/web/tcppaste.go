@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/secrets"
+	"snippetbox.floccinau.net/internal/validator"
+)
+
+const (
+	// pasteIdleTimeout is how long the listener waits for more of a paste
+	// before taking it as finished.
+	pasteIdleTimeout = 2 * time.Second
+
+	// pasteReadTimeout is the longest a paste can take to send altogether.
+	pasteReadTimeout = 30 * time.Second
+
+	// maxPasteConns is how many pastes can be received at once.
+	maxPasteConns = 64
+)
+
+// pasteListener serves the TCP paste protocol, which lets people paste
+// from a terminal without any client, in the style of termbin.com:
+//
+//	cat file | nc snippetbox.example.com 9999
+//
+// Whatever is sent becomes an anonymous snippet with the longest expiry
+// anonymous snippets can have, and the snippet's URL is written back before
+// the connection is closed. Netcat doesn't always close its side of the
+// connection when its input ends, so the paste also ends when nothing has
+// arrived for pasteIdleTimeout.
+//
+// Like http.Server, Serve returns http.ErrServerClosed once Shutdown has
+// been called.
+type pasteListener struct {
+	app     *application
+	baseURL string
+	maxSize int64
+	// limit is how many pastes each IP address can make in window.
+	limit  int
+	window time.Duration
+
+	mu     sync.Mutex
+	ln     net.Listener
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func (pl *pasteListener) Serve(ln net.Listener) error {
+	pl.mu.Lock()
+	if pl.closed {
+		pl.mu.Unlock()
+		ln.Close()
+		return http.ErrServerClosed
+	}
+	pl.ln = ln
+	pl.conns = make(map[net.Conn]struct{})
+	pl.mu.Unlock()
+
+	sem := make(chan struct{}, maxPasteConns)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			pl.mu.Lock()
+			closed := pl.closed
+			pl.mu.Unlock()
+			if closed {
+				return http.ErrServerClosed
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+
+			// Running out of file descriptors and the like doesn't last, so
+			// wait a moment and carry on.
+			pl.app.errorLog.Printf("paste listener: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		// When too many pastes are being sent, new connections wait for
+		// a slot rather than being accepted without limit.
+		sem <- struct{}{}
+
+		pl.mu.Lock()
+		if pl.closed {
+			pl.mu.Unlock()
+			conn.Close()
+			return http.ErrServerClosed
+		}
+		pl.conns[conn] = struct{}{}
+		pl.wg.Add(1)
+		pl.mu.Unlock()
+
+		go func() {
+			defer func() {
+				pl.mu.Lock()
+				delete(pl.conns, conn)
+				pl.mu.Unlock()
+				conn.Close()
+				<-sem
+				pl.wg.Done()
+			}()
+			pl.handle(conn)
+		}()
+	}
+}
+
+// Shutdown stops accepting pastes and waits for those being received to
+// finish, or for ctx to be done, when their connections are closed.
+func (pl *pasteListener) Shutdown(ctx context.Context) error {
+	pl.mu.Lock()
+	pl.closed = true
+	if pl.ln != nil {
+		pl.ln.Close()
+	}
+	pl.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		pl.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		pl.mu.Lock()
+		for conn := range pl.conns {
+			conn.Close()
+		}
+		pl.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// handle receives one paste and replies with its URL, or with what went
+// wrong.
+func (pl *pasteListener) handle(conn net.Conn) {
+	app := pl.app
+
+	ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		ip = conn.RemoteAddr().String()
+	}
+
+	reply := func(format string, args ...any) {
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		fmt.Fprintf(conn, format+"\n", args...)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pasteReadTimeout+10*time.Second)
+	defer cancel()
+
+	country := app.geoIP.country(ip)
+	if app.geoIP.blocks(country) {
+		reply("Pastes can't be made from your location.")
+		return
+	}
+
+	count, reset, err := app.rateLimits.store.incr(ctx, "tcp-paste:"+ip, pl.window)
+	if err != nil {
+		app.errorLog.Print(err)
+	} else if count > app.geoIP.anonymousLimit(country, pl.limit) {
+		reply("You've pasted too much. Try again in %s.", humanDuration(time.Until(reset)))
+		return
+	}
+
+	content, err := readPaste(conn, pl.maxSize)
+	switch {
+	case errors.Is(err, errPasteTooBig):
+		reply("Pastes can't be more than %d bytes.", pl.maxSize)
+		return
+	case err != nil:
+		return
+	case len(bytes.TrimSpace(content)) == 0:
+		reply("Nothing to paste.")
+		return
+	case !utf8.Valid(content):
+		reply("Only text can be pasted.")
+		return
+	}
+
+	text, _ := validator.CleanText(string(content))
+
+	scan := app.scanSecrets(text)
+	if scan.Has(secrets.Block) {
+		app.recordSecretsFrom(0, 0, ip, scan)
+		reply("%s", secretsBlockedMessage)
+		return
+	}
+	text = scan.Text
+
+	title := pasteTitle(text)
+	expires := slices.Max(anonymousExpiryDays)
+	heldReason := app.moderateFor(ctx, models.AnonymousUser, ip, title, text)
+
+	id, err := app.snippets.Insert(ctx, title, text, expires, 0, 0, "", "", heldReason, time.Time{}, nil)
+	if err != nil {
+		app.errorLog.Print(err)
+		reply("Sorry, the paste couldn't be saved.")
+		return
+	}
+	app.recordSecretsFrom(id, 0, ip, scan)
+
+	if heldReason == "" {
+		app.notifySnippetChange(models.EventSnippetCreated, id)
+		app.announceSnippet(id)
+	}
+
+	reply("%s/snippet/view/%d", pl.baseURL, id)
+	if notice := secretsNotice(scan); notice != "" {
+		// After the URL, so that scripts reading one line still get it.
+		reply("%s", notice)
+	}
+}
+
+// errPasteTooBig is returned by readPaste when more than the maximum size
+// is sent.
+var errPasteTooBig = errors.New("paste too big")
+
+// readPaste reads a paste until the client closes its side of the
+// connection or stops sending for pasteIdleTimeout, whichever comes first.
+func readPaste(conn net.Conn, maxSize int64) ([]byte, error) {
+	var buf bytes.Buffer
+	chunk := make([]byte, 32<<10)
+	deadline := time.Now().Add(pasteReadTimeout)
+
+	for {
+		idle := time.Now().Add(pasteIdleTimeout)
+		if idle.After(deadline) {
+			idle = deadline
+		}
+		conn.SetReadDeadline(idle)
+
+		n, err := conn.Read(chunk)
+		buf.Write(chunk[:n])
+		if int64(buf.Len()) > maxSize {
+			return nil, errPasteTooBig
+		}
+
+		switch {
+		case err == nil:
+			continue
+		case errors.Is(err, io.EOF):
+			return buf.Bytes(), nil
+		case errors.Is(err, os.ErrDeadlineExceeded) && time.Now().Before(deadline):
+			// Nothing more arrived for a while, so that's the paste.
+			return buf.Bytes(), nil
+		default:
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+
+	"snippetbox.floccinau.net/internal/highlight"
+	"snippetbox.floccinau.net/internal/i18n"
+	"snippetbox.floccinau.net/internal/markdown"
+)
+
+// pageFunctions holds template functions which only one page needs, keyed
+// by the page's file name. They're registered along with the shared
+// functions when that page is parsed, so a new page can bring its own
+// helpers without adding them to every template set.
+var pageFunctions = map[string]template.FuncMap{
+	"diff.tmpl.html": {
+		"diffClass": diffClass,
+		"diffSign":  diffSign,
+	},
+	"history.tmpl.html": {
+		"revisionBefore": func(n int) int {
+			return n - 1
+		},
+	},
+}
+
+// truncate shortens s to at most n characters, ending it with an ellipsis
+// if anything was cut off. The length comes first so that it can be used in
+// a pipeline, like {{.Content | truncate 200}}. A length of 0 or less
+// leaves nothing.
+func truncate(n int, s string) string {
+	if n <= 0 {
+		return ""
+	}
+
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:n-1])) + "…"
+}
+
+// pluralize picks the message for n things, like "%d star" or "%d stars",
+// and translates it into the viewer's language. Both messages are given n
+// to format. It takes the page's data first, like humanDate.
+func pluralize(d *templateData, n int, one, many string) string {
+	if n == 1 {
+		return i18n.Translate(d.Locale, one, n)
+	}
+	return i18n.Translate(d.Locale, many, n)
+}
+
+// renderMarkdown renders text which people have written, like profile bios,
+// as Markdown. The markdown package escapes everything in it, so the result
+// is safe to put in the page as it is.
+func renderMarkdown(s string) template.HTML {
+	return template.HTML(markdown.Render(s))
+}
+
+// highlightLine wraps the comments, strings, numbers and keywords in a line
+// of code in spans with classes like 'hl-comment', for the stylesheet to
+// colour.
+func highlightLine(line string) template.HTML {
+	var b strings.Builder
+	for _, tok := range highlight.Line(line) {
+		if tok.Kind == highlight.Plain {
+			b.WriteString(template.HTMLEscapeString(tok.Text))
+			continue
+		}
+		fmt.Fprintf(&b, "<span class='hl-%s'>%s</span>", tok.Kind, template.HTMLEscapeString(tok.Text))
+	}
+	return template.HTML(b.String())
+}
+
+// routeURLs are the paths of the pages which templates link to by name with
+// urlFor. Each %s is filled in with one of urlFor's arguments.
+var routeURLs = map[string]string{
+	"snippet":        "/snippet/view/%s",
+	"snippetEdit":    "/snippet/edit/%s",
+	"snippetHistory": "/snippet/history/%s",
+	"user":           "/user/%s",
+	"language":       "/language/%s",
+	"collection":     "/collections/%s",
+	"org":            "/orgs/%s",
+	"orgSettings":    "/orgs/%s/settings",
+}
+
+// urlFor builds the path of a page from its name in routeURLs and the
+// values which go in it, which are escaped, like
+// {{urlFor "user" .Username}}. An unknown name or the wrong number of
+// values is an error, so a mistake shows up as soon as the page is
+// rendered.
+func urlFor(name string, args ...any) (string, error) {
+	pattern, ok := routeURLs[name]
+	if !ok {
+		return "", fmt.Errorf("urlFor: no route called %q", name)
+	}
+	if want := strings.Count(pattern, "%s"); len(args) != want {
+		return "", fmt.Errorf("urlFor: route %q needs %d values, not %d", name, want, len(args))
+	}
+
+	escaped := make([]any, len(args))
+	for i, arg := range args {
+		escaped[i] = url.PathEscape(fmt.Sprint(arg))
+	}
+	return fmt.Sprintf(pattern, escaped...), nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		s    string
+		want string
+	}{
+		{name: "Short", n: 10, s: "Hello", want: "Hello"},
+		{name: "Exact", n: 5, s: "Hello", want: "Hello"},
+		{name: "Long", n: 5, s: "Hello, world", want: "Hell…"},
+		{name: "Trailing space", n: 7, s: "Hello, world", want: "Hello,…"},
+		{name: "Space before cut", n: 8, s: "Hello, world", want: "Hello,…"},
+		{name: "Multibyte", n: 4, s: "日本語のテキスト", want: "日本語…"},
+		{name: "One", n: 1, s: "Hello", want: "…"},
+		{name: "Zero", n: 0, s: "Hello", want: ""},
+		{name: "Negative", n: -1, s: "Hello", want: ""},
+		{name: "Empty", n: 5, s: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncate(tt.n, tt.s); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPluralize(t *testing.T) {
+	tests := []struct {
+		name   string
+		locale string
+		n      int
+		want   string
+	}{
+		{name: "Zero", locale: "en", n: 0, want: "0 followers"},
+		{name: "One", locale: "en", n: 1, want: "1 follower"},
+		{name: "Many", locale: "en", n: 2, want: "2 followers"},
+		{name: "Translated one", locale: "es", n: 1, want: "1 seguidor"},
+		{name: "Translated many", locale: "es", n: 3, want: "3 seguidores"},
+		{name: "Unknown locale", locale: "xx", n: 3, want: "3 followers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &templateData{Locale: tt.locale}
+			if got := pluralize(d, tt.n, "%d follower", "%d followers"); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestURLFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   string
+		args    []any
+		want    string
+		wantErr bool
+	}{
+		{name: "Int", route: "snippet", args: []any{42}, want: "/snippet/view/42"},
+		{name: "String", route: "user", args: []any{"alice"}, want: "/user/alice"},
+		{name: "Escaped", route: "language", args: []any{"c++/cli"}, want: "/language/c++%2Fcli"},
+		{name: "Traversal", route: "user", args: []any{"../admin"}, want: "/user/..%2Fadmin"},
+		{name: "Query", route: "user", args: []any{"a?b=c"}, want: "/user/a%3Fb=c"},
+		{name: "Suffix", route: "orgSettings", args: []any{"acme"}, want: "/orgs/acme/settings"},
+		{name: "Unknown route", route: "nope", args: []any{1}, wantErr: true},
+		{name: "Too few values", route: "snippet", wantErr: true},
+		{name: "Too many values", route: "snippet", args: []any{1, 2}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := urlFor(tt.route, tt.args...)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %q; want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"snippetbox.floccinau.net/internal/diff"
+	"snippetbox.floccinau.net/internal/i18n"
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// Define a templateData type to act as the holding structure for any dynamic
+// data that we want to pass to our HTML templates.
+type templateData struct {
+	CurrentYear            int
+	Snippet                *models.Snippet
+	Snippets               []*models.Snippet
+	Forks                  []*models.Snippet
+	Related                []*models.Snippet
+	Form                   any
+	Flash                  string
+	Warning                string
+	IsAuthenticated        bool
+	csrfToken              func() (string, error)
+	CSPNonce               string
+	User                   *models.User
+	Comments               []*models.Comment
+	CommentPages           pageInfo
+	CommentCounts          map[int]int
+	StarCount              int
+	ViewCount              int
+	Starred                bool
+	StarCounts             map[int]int
+	CanEdit                bool
+	Scheduled              bool
+	Revisions              []*models.Revision
+	Diff                   *revisionDiff
+	BaseURL                string
+	Meta                   *pageMeta
+	ShareURL               string
+	Attachments            []attachmentLink
+	MaxUploadSize          int64
+	MaxBodySize            int64
+	Webhooks               []*models.Webhook
+	Webhook                *models.Webhook
+	WebhookEvents          []string
+	Deliveries             []*models.WebhookDelivery
+	APITokens              []*models.Token
+	APIScopes              []string
+	APITokenExpiryDays     []int
+	NewAPIToken            string
+	Invites                []*models.Invite
+	InviteExpiryDays       []int
+	IPBans                 []*models.IPBan
+	AuditEvents            []*models.AuditEvent
+	AuditIP                string
+	SecretFindings         []*models.SecretFinding
+	QuarantinedAttachments []*models.Attachment
+	PendingAttachments     []*models.Attachment
+	Orgs                   []*models.Org
+	CurrentOrgID           int
+	Org                    *models.Org
+	OrgRole                string
+	OrgMembers             []*models.OrgMember
+	OrgRoles               []string
+	RegistrationMode       string
+	SSO                    bool
+	Sessions               []*activeSession
+	AllowAnonymous         bool
+	Challenge              *challenge
+	Held                   []*models.HeldSnippet
+	Reported               []*models.ReportedSnippet
+	ReportReasons          []string
+	FormGuard              string
+	Profile                *models.User
+	SnippetPages           pageInfo
+	SnippetCursors         cursorInfo
+	Following              bool
+	FollowerCount          int
+	FollowingCount         int
+	Feed                   bool
+	Announcements          []*models.Snippet
+	ScheduledSnippets      []*models.Snippet
+	Ranked                 []*models.RankedSnippet
+	TrendingWindow         string
+	ArchiveTitle           string
+	Collections            []*models.Collection
+	Collection             *models.Collection
+	Collected              map[int]bool
+	ArchivePrev            string
+	ArchiveNext            string
+	Gravatar               bool
+	Maintenance            bool
+	Version                buildInfo
+	Locale                 string
+	TimeZone               *time.Location
+	Languages              []i18n.Language
+}
+
+// pageMeta holds the Open Graph and Twitter Card metadata for a page, which
+// is what chat apps and social networks use to build link previews.
+type pageMeta struct {
+	Title       string
+	Description string
+	URL         string
+	Image       string
+	Created     time.Time
+}
+
+// metaDescriptionLength is the most characters of content that we put in a
+// preview description. Most sites cut off anything much longer than this.
+const metaDescriptionLength = 200
+
+// newSnippetMeta builds the preview metadata for a snippet. The description is
+// taken from the first few non-blank lines of its content.
+func newSnippetMeta(baseURL string, s *models.Snippet) *pageMeta {
+	return &pageMeta{
+		Title:       s.Title,
+		Description: metaDescription(s.Content, 3),
+		URL:         fmt.Sprintf("%s/snippet/view/%d", baseURL, s.ID),
+		Image:       fmt.Sprintf("%s/snippet/%d/card.png", baseURL, s.ID),
+		Created:     s.Created,
+	}
+}
+
+// metaDescription joins the first n non-blank lines of content with spaces and
+// truncates the result to metaDescriptionLength characters.
+func metaDescription(content string, n int) string {
+	var parts []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts = append(parts, line)
+		if len(parts) == n {
+			break
+		}
+	}
+
+	return truncate(metaDescriptionLength, strings.Join(parts, " "))
+}
+
+// revisionDiff holds the differences between two revisions of a snippet for
+// the diff page.
+type revisionDiff struct {
+	From         *models.Revision
+	To           *models.Revision
+	TitleHunks   []diff.Hunk
+	ContentHunks []diff.Hunk
+}
+
+// pageInfo describes where a page sits within a paginated listing, so that
+// templates can render previous/next links.
+type pageInfo struct {
+	Page     int
+	PageSize int
+	Total    int
+}
+
+func newPageInfo(page, pageSize, total int) pageInfo {
+	return pageInfo{Page: page, PageSize: pageSize, Total: total}
+}
+
+// LastPage returns the number of the final page (at least 1).
+func (p pageInfo) LastPage() int {
+	if p.PageSize <= 0 || p.Total == 0 {
+		return 1
+	}
+	return (p.Total + p.PageSize - 1) / p.PageSize
+}
+
+func (p pageInfo) HasPrev() bool { return p.Page > 1 }
+func (p pageInfo) HasNext() bool { return p.Page < p.LastPage() }
+func (p pageInfo) Prev() int     { return p.Page - 1 }
+func (p pageInfo) Next() int     { return p.Page + 1 }
+
+// cursorInfo holds the cursors of the pages either side of a page of a
+// listing paged through with cursors, so that templates can render
+// newer/older links. Either is empty at the end of the listing.
+type cursorInfo struct {
+	Newer string
+	Older string
+}
+
+func newCursorInfo(p models.CursorPage) cursorInfo {
+	return cursorInfo{Newer: p.Newer.String(), Older: p.Older.String()}
+}
+
+// CSRFToken returns the token for the page's forms. It's only made the
+// first time a template asks for it, so that pages without forms don't
+// need one. Pages rendered without the session have no token.
+func (d *templateData) CSRFToken() (string, error) {
+	if d.csrfToken == nil {
+		return "", nil
+	}
+	return d.csrfToken()
+}
+
+// zone returns the time zone to show times in, falling back to UTC.
+func (d *templateData) zone() *time.Location {
+	if d.TimeZone == nil {
+		return time.UTC
+	}
+	return d.TimeZone
+}
+
+// Create a humanDate function which returns a nicely formatted string
+// representation of a time.Time object, in the viewer's language and time
+// zone. It takes the page's data first, so call it as {{humanDate $ .Created}}.
+func humanDate(d *templateData, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	t = t.In(d.zone())
+	month := i18n.Translate(d.Locale, t.Format("Jan"))
+
+	return i18n.Translate(d.Locale, "%s %s %d at %s", t.Format("02"), month, t.Year(), t.Format("15:04"))
+}
+
+// timeUnits are the units which timeAgo counts in, largest first.
+var timeUnits = []struct {
+	size time.Duration
+	one  [2]string
+	many [2]string
+}{
+	{365 * 24 * time.Hour, [2]string{"1 year ago", "in 1 year"}, [2]string{"%d years ago", "in %d years"}},
+	{30 * 24 * time.Hour, [2]string{"1 month ago", "in 1 month"}, [2]string{"%d months ago", "in %d months"}},
+	{24 * time.Hour, [2]string{"1 day ago", "in 1 day"}, [2]string{"%d days ago", "in %d days"}},
+	{time.Hour, [2]string{"1 hour ago", "in 1 hour"}, [2]string{"%d hours ago", "in %d hours"}},
+	{time.Minute, [2]string{"1 minute ago", "in 1 minute"}, [2]string{"%d minutes ago", "in %d minutes"}},
+}
+
+// timeAgo describes how long ago a time was, or how long until it is, like
+// "3 hours ago" or "in 6 days", in the viewer's language. It's rounded down
+// to the largest whole unit.
+func timeAgo(d *templateData, t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	// Index 0 of each unit's messages is for the past, 1 for the future.
+	elapsed, tense := time.Since(t), 0
+	if elapsed < 0 {
+		elapsed, tense = -elapsed, 1
+	}
+
+	for _, u := range timeUnits {
+		n := int(elapsed / u.size)
+		switch {
+		case n == 1:
+			return i18n.Translate(d.Locale, u.one[tense])
+		case n > 1:
+			return i18n.Translate(d.Locale, u.many[tense], n)
+		}
+	}
+
+	if tense == 1 {
+		return i18n.Translate(d.Locale, "in a moment")
+	}
+	return i18n.Translate(d.Locale, "just now")
+}
+
+// Initialize a template.FuncMap object and store it in a global variable. This
+// is essentially a string-keyed map which acts as a lookup between the names
+// of our custom template functions and the functions themselves.
+// Functions which only one page uses go in pageFunctions instead.
+var functions = template.FuncMap{
+	"humanDate":  humanDate,
+	"timeAgo":    timeAgo,
+	"avatar":     avatar,
+	"lines":      lines,
+	"humanBytes": humanBytes,
+	"pathEscape": url.PathEscape,
+	"T":          i18n.Translate,
+	"truncate":   truncate,
+	"pluralize":  pluralize,
+	"markdown":   renderMarkdown,
+	"highlight":  highlightLine,
+	"urlFor":     urlFor,
+	"asset":      asset,
+}
+
+// numberedLine is one line of a snippet's content along with its 1-based
+// line number.
+type numberedLine struct {
+	Number int
+	Text   string
+}
+
+// lines splits content into numbered lines so that templates can render
+// each one with its own anchor (#L1, #L2, ...). A trailing newline doesn't
+// produce an extra empty line.
+func lines(content string) []numberedLine {
+	content = strings.TrimSuffix(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	parts := strings.Split(content, "\n")
+	numbered := make([]numberedLine, len(parts))
+	for i, text := range parts {
+		numbered[i] = numberedLine{Number: i + 1, Text: text}
+	}
+
+	return numbered
+}
+
+// diffClass and diffSign return the CSS class and the unified diff prefix
+// character for a line of a diff.
+func diffClass(op diff.Op) string {
+	switch op {
+	case diff.Insert:
+		return "diff-add"
+	case diff.Delete:
+		return "diff-del"
+	}
+	return "diff-ctx"
+}
+
+func diffSign(op diff.Op) string {
+	switch op {
+	case diff.Insert:
+		return "+"
+	case diff.Delete:
+		return "-"
+	}
+	return " "
+}
+
+// newTemplateCache parses every page template once at startup, together with
+// the base layout and partials, and caches the resulting template sets keyed
+// by page name (like 'home.tmpl.html').
+func newTemplateCache() (map[string]*template.Template, error) {
+	cache := map[string]*template.Template{}
+
+	// Use the filepath.Glob() function to get a slice of all filepaths that
+	// match the pattern "./ui/html/pages/*.tmpl.html".
+	pages, err := filepath.Glob("./ui/html/pages/*.tmpl.html")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, page := range pages {
+		// Extract the file name (like 'home.tmpl.html') from the full filepath
+		// and assign it to the name variable.
+		name := filepath.Base(page)
+
+		ts, err := parsePage(page)
+		if err != nil {
+			return nil, err
+		}
+
+		cache[name] = ts
+	}
+
+	return cache, nil
+}
+
+// parsePage parses the page template at the given path, together with the
+// base layout and partials.
+func parsePage(page string) (*template.Template, error) {
+	// The template.FuncMap must be registered with the template set before
+	// you call the ParseFiles() method. This means we have to use
+	// template.New() to create an empty template set, use the Funcs()
+	// method to register the template.FuncMap, and then parse the files
+	// as normal.
+	// Any functions of the page's own are added after the shared ones.
+	name := filepath.Base(page)
+	ts, err := template.New(name).Funcs(functions).Funcs(pageFunctions[name]).ParseFiles("./ui/html/base.tmpl.html")
+	if err != nil {
+		return nil, err
+	}
+
+	// Call ParseGlob() *on this template set* to add any partials.
+	ts, err = ts.ParseGlob("./ui/html/partials/*.tmpl.html")
+	if err != nil {
+		return nil, err
+	}
+
+	// Call ParseFiles() *on this template set* to add the page template.
+	return ts.ParseFiles(page)
+}
+
+// The pageTemplate helper returns the template set for a page. In
+// development mode the templates are parsed from disk again every time, so
+// that changes show up on the next refresh.
+func (app *application) pageTemplate(page string) (*template.Template, error) {
+	if app.dev {
+		path := filepath.Join("./ui/html/pages", page)
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("the template %s does not exist", page)
+		}
+		return parsePage(path)
+	}
+
+	ts, ok := app.templateCache[page]
+	if !ok {
+		return nil, fmt.Errorf("the template %s does not exist", page)
+	}
+	return ts, nil
+}
+
+// The templateError helper reports a template which couldn't be parsed or
+// executed. In development mode the error is shown in the browser, since
+// that's where whoever is editing the template is looking; otherwise it's
+// treated like any other server error.
+func (app *application) templateError(w http.ResponseWriter, err error) {
+	if !app.dev {
+		app.serverError(w, nil, err)
+		return
+	}
+
+	app.errorLog.Output(2, err.Error())
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, "Template error\n\n%s\n\n%s", err, debug.Stack())
+}
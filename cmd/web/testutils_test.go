@@ -0,0 +1,161 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/models/mocks"
+	"snippetbox.floccinau.net/internal/session"
+	"snippetbox.floccinau.net/internal/testutils"
+)
+
+// testModels are the mocks behind a test application, so that tests can add
+// the records they need and look at what the handlers stored.
+type testModels struct {
+	snippets    *mocks.SnippetModel
+	users       *mocks.UserModel
+	permissions *mocks.PermissionModel
+	orgs        *mocks.OrgModel
+	comments    *mocks.CommentModel
+	stars       *mocks.StarModel
+	follows     *mocks.FollowModel
+	collections *mocks.CollectionModel
+	attachments *mocks.AttachmentModel
+}
+
+// newTestApplication returns an application which keeps everything in
+// memory: the models are mocks, which are returned too, and the sessions are
+// in a memory store. Logs are thrown away.
+func newTestApplication(t *testing.T) (*application, *testModels) {
+	t.Helper()
+
+	// The templates are found relative to the root of the module.
+	t.Chdir("../..")
+
+	templateCache, err := newTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &testModels{
+		snippets:    &mocks.SnippetModel{},
+		users:       &mocks.UserModel{},
+		permissions: &mocks.PermissionModel{},
+	}
+	m.orgs = &mocks.OrgModel{Users: m.users}
+	m.comments = &mocks.CommentModel{Users: m.users}
+	m.stars = &mocks.StarModel{Snippets: m.snippets}
+	m.follows = &mocks.FollowModel{Snippets: m.snippets}
+	m.collections = &mocks.CollectionModel{Snippets: m.snippets}
+	m.attachments = &mocks.AttachmentModel{Users: m.users}
+
+	cookies := cookieConfig{Secure: true}
+	sessionManager := session.New()
+	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Cookie = cookies.session()
+
+	app := &application{
+		errorLog:       log.New(io.Discard, "", 0),
+		infoLog:        log.New(io.Discard, "", 0),
+		accessLog:      log.New(io.Discard, "", 0),
+		snippets:       m.snippets,
+		users:          m.users,
+		permissions:    m.permissions,
+		auth:           m.users,
+		orgs:           m.orgs,
+		comments:       m.comments,
+		stars:          m.stars,
+		follows:        m.follows,
+		collections:    m.collections,
+		attachments:    m.attachments,
+		templateCache:  templateCache,
+		sessionManager: sessionManager,
+		timeouts:       requestTimeouts{page: time.Minute, upload: time.Minute},
+		cookies:        cookies,
+		registration:   registrationOpen,
+		signupChallenge: &captchaChallenger{
+			sessionManager: sessionManager,
+			key:            "captchaSignup",
+		},
+		downloadSecret: []byte("test download secret"),
+		loginThrottle: loginThrottle{
+			freeAttempts:  3,
+			baseDelay:     time.Second,
+			maxFailures:   10,
+			maxIPFailures: 50,
+			lockout:       15 * time.Minute,
+			window:        time.Hour,
+		},
+		views:         &viewCounter{},
+		related:       &relatedCache{},
+		ipFilter:      &ipFilter{},
+		loginAttempts: &mocks.LoginAttemptModel{},
+		identities:    &mocks.IdentityModel{},
+		auditLog:      &mocks.AuditModel{},
+		shutdown:      make(chan struct{}),
+	}
+	return app, m
+}
+
+// newTestDBApplication returns a test application whose users, permissions,
+// login attempts and audit log are kept in the test database, so that
+// signing up and logging in can be tested end to end. The test is skipped if
+// there's no test database.
+func newTestDBApplication(t *testing.T) *application {
+	t.Helper()
+
+	db := testutils.NewTestDB(t)
+
+	app, _ := newTestApplication(t)
+	app.db = db
+	app.users = &models.UserModel{DB: db}
+	app.auth = app.users
+	app.permissions = &models.PermissionModel{DB: db}
+	app.loginAttempts = &models.LoginAttemptModel{DB: db}
+	app.auditLog = &models.AuditModel{DB: db}
+	app.rememberTokens = &models.RememberTokenModel{DB: db}
+	return app
+}
+
+// testServer serves a test application's routes, and lets tests log in
+// without the login form, which needs the login throttle's tables.
+type testServer struct {
+	*testutils.TestServer
+}
+
+// newTestServer starts serving app's routes, along with /test/login/{id},
+// which logs the session in as the user with the ID.
+func newTestServer(t *testing.T, app *application) *testServer {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.Handle("/", app.routes())
+	mux.Handle("GET /test/login/{id}", app.sessionManager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		err = app.logIn(r, id)
+		if err != nil {
+			app.serverError(w, r, err)
+		}
+	})))
+
+	return &testServer{testutils.NewTestServer(t, mux)}
+}
+
+// logIn logs the test server's session in as the user with the ID.
+func (ts *testServer) logIn(t *testing.T, userID int) {
+	t.Helper()
+
+	code, _, _ := ts.Get(t, "/test/login/"+strconv.Itoa(userID))
+	if code != http.StatusOK {
+		t.Fatalf("logging in: got status %d; want %d", code, http.StatusOK)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/storage"
+	"snippetbox.floccinau.net/internal/thumbnail"
+)
+
+// thumbSizes are the thumbnail sizes which can be asked for. Requests are
+// rounded up to one of these, so that there's a small number of thumbnails
+// to cache per image however the w parameter is set.
+var thumbSizes = []int{96, 192, 384, 768}
+
+// defaultThumbSize is used when no size is asked for. Thumbnails are shown
+// at 96px, so this is sharp on high-density screens.
+const defaultThumbSize = 192
+
+// thumbCache stores generated thumbnails on disk. Attachments are never
+// changed after they're uploaded, so thumbnails are keyed by the storage key,
+// size and format and never go stale.
+//
+// Decoding a large image takes a lot of memory and CPU, so only a few
+// thumbnails are generated at once; other requests wait for a free slot.
+type thumbCache struct {
+	dir   string
+	slots chan struct{}
+}
+
+func newThumbCache(dir string, concurrency int) *thumbCache {
+	return &thumbCache{dir: dir, slots: make(chan struct{}, concurrency)}
+}
+
+func (c *thumbCache) path(key string, size int, format string) string {
+	ext := ".png"
+	if format == thumbnail.JPEG {
+		ext = ".jpg"
+	}
+	return filepath.Join(c.dir, fmt.Sprintf("%s-%d%s", key, size, ext))
+}
+
+// get returns a cached thumbnail, or nil if there isn't one.
+func (c *thumbCache) get(key string, size int, format string) []byte {
+	if c.dir == "" {
+		return nil
+	}
+
+	img, err := os.ReadFile(c.path(key, size, format))
+	if err != nil {
+		return nil
+	}
+	return img
+}
+
+// put saves a thumbnail, writing it to a temporary name first so that
+// concurrent requests never see a half-written image.
+func (c *thumbCache) put(key string, size int, format string, img []byte) error {
+	if c.dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(c.dir, "thumb-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(img); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), c.path(key, size, format))
+}
+
+// remove deletes every cached thumbnail of a blob.
+func (c *thumbCache) remove(key string) {
+	if c.dir == "" {
+		return
+	}
+
+	names, _ := filepath.Glob(filepath.Join(c.dir, key+"-*"))
+	for _, name := range names {
+		os.Remove(name)
+	}
+}
+
+// thumbSize rounds a requested size up to the nearest of thumbSizes.
+func thumbSize(s string) int {
+	if s == "" {
+		return defaultThumbSize
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return defaultThumbSize
+	}
+
+	for _, size := range thumbSizes {
+		if n <= size {
+			return size
+		}
+	}
+	return thumbSizes[len(thumbSizes)-1]
+}
+
+// The thumbURL helper returns a signed URL for an image attachment's
+// thumbnail. It's signed the same way as the download link, since anyone
+// allowed to download the image may see the thumbnail.
+func (app *application) thumbURL(a *models.Attachment, size int) string {
+	expires := time.Now().Add(attachmentURLLifetime).Unix()
+
+	q := url.Values{}
+	q.Set("w", strconv.Itoa(size))
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("sig", app.signAttachment(a.ID, expires))
+
+	return fmt.Sprintf("/attachments/%d/thumb?%s", a.ID, q.Encode())
+}
+
+// The attachmentThumb handler serves a resized copy of an image attachment,
+// generating it the first time it's asked for. The w query parameter sets the
+// longest side of the thumbnail.
+func (app *application) attachmentThumb(w http.ResponseWriter, r *http.Request) {
+	a := app.signedAttachment(w, r)
+	if a == nil {
+		return
+	}
+
+	if !strings.HasPrefix(a.ContentType, "image/") {
+		app.notFound(w)
+		return
+	}
+
+	size := thumbSize(r.URL.Query().Get("w"))
+	format := thumbnail.Negotiate(r.Header.Get("Accept"), a.ContentType)
+
+	img := app.thumbCache.get(a.StorageKey, size, format)
+	if img == nil {
+		select {
+		case app.thumbCache.slots <- struct{}{}:
+			defer func() { <-app.thumbCache.slots }()
+		case <-r.Context().Done():
+			return
+		}
+
+		blob, err := app.blobs.Open(r.Context(), a.StorageKey)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				app.notFound(w)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+		src, err := io.ReadAll(io.LimitReader(blob, a.Size))
+		blob.Close()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		var buf bytes.Buffer
+		err = thumbnail.Make(&buf, src, size, format)
+		if err != nil {
+			if errors.Is(err, thumbnail.ErrTooLarge) || errors.Is(err, thumbnail.ErrUnsupported) {
+				app.clientError(w, http.StatusUnprocessableEntity)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+		img = buf.Bytes()
+
+		// Failing to cache the thumbnail isn't a reason to fail the request.
+		if err := app.thumbCache.put(a.StorageKey, size, format, img); err != nil {
+			app.errorLog.Print(err)
+		}
+	}
+
+	// The format depends on the Accept header, so caches must keep a copy
+	// per Accept value.
+	w.Header().Set("Vary", "Accept")
+	w.Header().Set("Content-Type", format)
+	w.Header().Set("Content-Length", strconv.Itoa(len(img)))
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Write(img)
+}
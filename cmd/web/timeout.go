@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"snippetbox.floccinau.net/internal/i18n"
+)
+
+// requestTimeouts holds how long each group of routes is given to respond.
+type requestTimeouts struct {
+	// page is the limit for pages and the API.
+	page time.Duration
+
+	// upload is the limit for routes which receive uploads, since reading
+	// the file can take a while on a slow connection.
+	upload time.Duration
+}
+
+// The timeout() middleware gives the rest of the chain d to respond. The
+// request's context is cancelled after d, which stops any database queries
+// made with it, like the snippet lookups, inserts and updates which most
+// handlers are built around. If the handler hasn't finished by then,
+// whatever it wrote is thrown away and the client gets the "taking too
+// long" page with a 503 instead, like http.TimeoutHandler. Because the
+// response is buffered, it mustn't be used on routes which stream, like the
+// /events stream.
+func (app *application) timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+
+			// A panic in the handler is passed back to this goroutine,
+			// along with where it happened, for recoverPanic() to report.
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- newHandlerPanic(p)
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				for k, v := range tw.header {
+					w.Header()[k] = v
+				}
+				if tw.code == 0 {
+					tw.code = http.StatusOK
+				}
+				w.WriteHeader(tw.code)
+				w.Write(tw.buf.Bytes())
+
+			case <-ctx.Done():
+				tw.mu.Lock()
+				tw.timedOut = true
+				tw.mu.Unlock()
+
+				// If the client went away there's nobody to tell.
+				if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					return
+				}
+
+				app.errorLog.Printf("%s %s timed out after %s", r.Method, redactOnceToken(r.URL.Path), d)
+				app.renderTimeout(w, r)
+			}
+		})
+	}
+}
+
+// The renderTimeout helper shows the page for a request which took too long,
+// or sends a JSON error to API clients. The handler may still be running and
+// using the session, so the page is rendered without it, as if the visitor
+// wasn't logged in.
+func (app *application) renderTimeout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "30")
+
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		app.errorResponse(w, r, http.StatusServiceUnavailable, "the request took too long, please try again")
+		return
+	}
+
+	app.render(w, http.StatusServiceUnavailable, "timeout.tmpl.html", app.sessionlessTemplateData(r))
+}
+
+// The sessionlessTemplateData helper is like newTemplateData, but doesn't
+// touch the session, for error pages shown when the session isn't loaded or
+// can't safely be used.
+func (app *application) sessionlessTemplateData(r *http.Request) *templateData {
+	return &templateData{
+		CurrentYear: time.Now().Year(),
+		CSPNonce:    app.cspNonce(r),
+		BaseURL:     app.absoluteURL(r, ""),
+		Locale:      app.locale(r),
+		TimeZone:    app.timeZone(r),
+		Languages:   i18n.Languages(),
+		Version:     app.version,
+	}
+}
+
+// timeoutWriter buffers a response for the timeout() middleware. Once the
+// request has timed out, writes fail with http.ErrHandlerTimeout.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	code     int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut || tw.code != 0 {
+		return
+	}
+	tw.code = code
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// hstsHeader tells browsers to only ever use HTTPS for the site and its
+// subdomains, for two years. The preload directive asks for the domain to
+// be built into browsers, which the preload list only accepts with at least
+// a year's max-age and includeSubDomains.
+const hstsHeader = "max-age=63072000; includeSubDomains; preload"
+
+// acmeChallengePath is where certificate authorities look for the token of an
+// ACME HTTP-01 challenge. They only ever ask over plain HTTP.
+const acmeChallengePath = "/.well-known/acme-challenge/"
+
+// tlsConfig returns the TLS settings for the HTTPS server. Only the elliptic
+// curves with assembly implementations are offered, so handshakes are cheap.
+// HTTP/2 is offered first, and HTTP/1.1 for clients which don't speak it.
+func tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		NextProtos:       []string{"h2", "http/1.1"},
+	}
+}
+
+// httpsProtocols are the protocols the HTTPS server speaks. net/http turns
+// HTTP/2 off if the server has its own TLSNextProto map or TLS settings
+// which don't allow it, so it's asked for explicitly, and the server fails
+// to start rather than quietly falling back to HTTP/1.1.
+func httpsProtocols() *http.Protocols {
+	p := new(http.Protocols)
+	p.SetHTTP1(true)
+	p.SetHTTP2(true)
+	return p
+}
+
+// newCertManager returns a manager which gets certificates for hosts from
+// Let's Encrypt, and renews them before they expire. Certificates and the
+// account key are kept in cacheDir, so they survive restarts; Let's Encrypt
+// limits how often the same certificate can be issued. Certificates are only
+// ever asked for on behalf of the hosts in the list, so a request naming
+// some other host can't make the server ask for one.
+func newCertManager(cacheDir, email string, hosts []string) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cacheDir),
+		HostPolicy: autocert.HostWhitelist(hosts...),
+		Email:      email,
+	}
+}
+
+// autocertTLSConfig returns the TLS settings for the HTTPS server when its
+// certificates come from m. The TLS-ALPN-01 challenge is answered in the
+// handshake, so it's offered alongside HTTP/2 and HTTP/1.1.
+func autocertTLSConfig(m *autocert.Manager) *tls.Config {
+	cfg := tlsConfig()
+	cfg.GetCertificate = m.GetCertificate
+	cfg.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+	return cfg
+}
+
+// The redirectToHTTPS handler is served on the plain HTTP port when TLS is
+// on. It answers ACME HTTP-01 challenges from the files a client like
+// certbot writes to acmeWebroot, if it's set, and sends everything else to
+// the same address over HTTPS on httpsAddr's port.
+//
+// The redirect keeps the host, rather than going straight to the canonical
+// host, because the HSTS preload list wants a site's HTTP address to redirect
+// to HTTPS on the same host first. The requireCanonicalHost middleware then
+// moves people on to the canonical host, over HTTPS.
+func (app *application) redirectToHTTPS(httpsAddr, acmeWebroot string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+
+	mux := http.NewServeMux()
+
+	if acmeWebroot != "" {
+		dir := filepath.Join(acmeWebroot, filepath.FromSlash(acmeChallengePath))
+		mux.HandleFunc("GET "+acmeChallengePath+"{token}", func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, filepath.Join(dir, r.PathValue("token")))
+		})
+	}
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		// 308 keeps the method and body, so a form posted to the HTTP
+		// address isn't turned into a GET.
+		w.Header().Set("Connection", "close")
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+
+	return mux
+}
+
+// The requireCanonicalHost() middleware redirects requests for any other host
+// name, like www.example.com, to the same path on the canonical host. It
+// does nothing if no canonical host is set. Health checks are let through,
+// since load balancers usually send them to an IP address.
+func (app *application) requireCanonicalHost(next http.Handler) http.Handler {
+	if app.canonicalHost == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Host, app.canonicalHost) || r.URL.Path == "/healthz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		http.Redirect(w, r, requestScheme(r)+"://"+app.canonicalHost+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+
+	"snippetbox.floccinau.net/internal/validator"
+)
+
+// cleanedWarning tells the user that characters were removed from what they
+// posted by validator.CleanText.
+const cleanedWarning = "Invisible control characters, which can make text display differently from how it reads, were removed from what you posted."
+
+// cleanSnippetText runs validator.CleanText over a snippet's title and
+// content, and reports whether anything was removed from either.
+func cleanSnippetText(title, content string) (string, string, bool) {
+	title, titleChanged := validator.CleanText(title)
+	content, contentChanged := validator.CleanText(content)
+	return title, content, titleChanged || contentChanged
+}
+
+// The warnCleaned helper shows cleanedWarning on the next page the user
+// sees, if cleaned is true.
+func (app *application) warnCleaned(r *http.Request, cleaned bool) {
+	if cleaned {
+		app.sessionManager.Put(r.Context(), "warning", cleanedWarning)
+	}
+}
+
+// withCleanedWarning adds cleanedWarning to an API response if cleaned is
+// true.
+func withCleanedWarning(env envelope, cleaned bool) envelope {
+	if cleaned {
+		env["warning"] = cleanedWarning
+	}
+	return env
+}
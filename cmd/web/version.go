@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// buildTime is when the binary was built. The go command doesn't record it,
+// so it's set by the release build with
+//
+//	go build -ldflags="-X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/web
+var buildTime string
+
+// buildInfo describes the running binary. The revision is read from the
+// version control information which the go command embeds when it builds
+// from a checkout, so it's empty for binaries built with go run or outside
+// a repository.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Committed string `json:"committed,omitempty"`
+	Built     string `json:"built,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// readBuildInfo returns the build information of the running binary.
+func readBuildInfo() buildInfo {
+	b := buildInfo{Version: "devel", Built: buildTime}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	b.GoVersion = info.GoVersion
+
+	// Tagged releases have a module version; builds from a checkout have
+	// "(devel)", and the revision says which one.
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		b.Version = v
+	}
+
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Revision = s.Value
+		case "vcs.time":
+			b.Committed = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+
+	return b
+}
+
+// String returns the version to show people, like "v1.2.0", or
+// "devel-3f2a9c1" for a build from a checkout. Builds with uncommitted
+// changes are marked "+dirty".
+func (b buildInfo) String() string {
+	s := b.Version
+	if b.Version == "devel" && b.Revision != "" {
+		s += "-" + b.Revision[:min(len(b.Revision), 7)]
+	}
+	if b.Modified {
+		s += "+dirty"
+	}
+	return s
+}
+
+// The healthz handler reports whether the application can serve requests,
+// for load balancers and uptime monitors, along with the version which is
+// running. It answers 503 Service Unavailable if the database can't be
+// reached.
+func (app *application) healthz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	status, code := "available", http.StatusOK
+	if err := app.db.PingContext(ctx); err != nil {
+		app.errorLog.Printf("health check: %v", err)
+		status, code = "unavailable", http.StatusServiceUnavailable
+	} else if app.maintenance.Load() {
+		status = "maintenance"
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	err := app.writeJSON(w, code, envelope{"status": status, "system_info": app.version}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// The versionInfo handler shows the version which is running.
+func (app *application) versionInfo(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"build": app.version}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// viewDedupeWindow is how long a visitor's repeat views of a snippet are
+// ignored for, so that reloading a page doesn't count as another view.
+const viewDedupeWindow = 30 * time.Minute
+
+// crawlerAgents are fragments of the (lower-case) User-Agent headers sent by
+// search engines, link previewers and scripts. Their requests aren't counted
+// as views.
+var crawlerAgents = []string{
+	"bot", "crawler", "spider", "slurp", "archiver", "facebookexternalhit",
+	"embedly", "preview", "headless", "curl", "wget", "python-", "go-http-client",
+	"java/", "libwww", "httpclient", "okhttp",
+}
+
+// isCrawler reports whether a User-Agent header looks like it came from a
+// program rather than a person. Browsers always send one, so requests
+// without one are counted as crawlers too.
+func isCrawler(userAgent string) bool {
+	if userAgent == "" {
+		return true
+	}
+
+	ua := strings.ToLower(userAgent)
+	return slices.ContainsFunc(crawlerAgents, func(s string) bool {
+		return strings.Contains(ua, s)
+	})
+}
+
+// viewKey identifies a visitor's views of a snippet.
+type viewKey struct {
+	snippetID int
+	visitor   string
+}
+
+// viewCounter counts snippet views in memory between flushes to the
+// database, so that viewing a snippet doesn't have to wait for a write, and
+// a popular snippet's row isn't updated on every view. It remembers who has
+// viewed what recently, so that each visitor's views are only counted once
+// within viewDedupeWindow.
+type viewCounter struct {
+	mu     sync.Mutex
+	counts map[int]int
+	seen   map[viewKey]time.Time
+}
+
+// add counts a view of a snippet by a visitor, unless they've viewed it
+// within viewDedupeWindow already. It reports whether the view was counted.
+func (c *viewCounter) add(snippetID int, visitor string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts == nil {
+		c.counts = make(map[int]int)
+		c.seen = make(map[viewKey]time.Time)
+	}
+
+	key := viewKey{snippetID, visitor}
+	if last, ok := c.seen[key]; ok && now.Sub(last) < viewDedupeWindow {
+		return false
+	}
+
+	c.seen[key] = now
+	c.counts[snippetID]++
+	return true
+}
+
+// take returns the views counted since it was last called, and starts
+// counting again from zero. Visitors who were last seen longer ago than
+// viewDedupeWindow are forgotten, so the counter doesn't grow for ever.
+func (c *viewCounter) take(now time.Time) map[int]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := c.counts
+	c.counts = make(map[int]int)
+
+	maps.DeleteFunc(c.seen, func(_ viewKey, last time.Time) bool {
+		return now.Sub(last) >= viewDedupeWindow
+	})
+
+	return counts
+}
+
+// restore counts views taken from the counter again, after they couldn't be
+// saved.
+func (c *viewCounter) restore(counts map[int]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts == nil {
+		c.counts = make(map[int]int)
+		c.seen = make(map[viewKey]time.Time)
+	}
+
+	for id, n := range counts {
+		c.counts[id] += n
+	}
+}
+
+// The recordView helper counts a view of a snippet, unless it's from a
+// crawler. Signed-in users are told apart by their account and everyone
+// else by their session, or by their IP address if they haven't got one.
+func (app *application) recordView(r *http.Request, snippetID int) {
+	if isCrawler(r.UserAgent()) {
+		return
+	}
+
+	var visitor string
+	user := app.currentUser(r)
+	token := app.sessionManager.Token(r.Context())
+	switch {
+	case user != nil:
+		visitor = "user:" + strconv.Itoa(user.ID)
+	case token != "":
+		visitor = "session:" + token
+	default:
+		visitor = "ip:" + app.clientIP(r)
+	}
+
+	app.views.add(snippetID, visitor, time.Now())
+}
+
+// The flushViews method writes the counted views to the database every
+// interval, until the application shuts down, when it writes them one last
+// time. If a write fails, the views are counted again in the next one.
+func (app *application) flushViews(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var done bool
+		select {
+		case <-ticker.C:
+		case <-app.shutdown:
+			done = true
+		}
+
+		// Views are kept counting in memory in maintenance mode, and
+		// saved once it's over.
+		if app.maintenance.Load() && !done {
+			continue
+		}
+
+		counts := app.views.take(time.Now())
+		if err := app.snippets.AddViews(counts); err != nil {
+			app.errorLog.Printf("saving snippet views: %v", err)
+			app.views.restore(counts)
+		}
+
+		if done {
+			return
+		}
+	}
+}
+
+// trendingWindows are the periods the trending page can rank snippets over,
+// keyed by the value of its window parameter.
+var trendingWindows = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+}
+
+// trendingPageSize is how many snippets are listed on each page of the
+// trending page.
+const trendingPageSize = 20
+
+// The trending handler lists the snippets which are most popular at the
+// moment, by views and stars with recent ones counting for more.
+func (app *application) trending(w http.ResponseWriter, r *http.Request) {
+	window := r.URL.Query().Get("window")
+	if _, ok := trendingWindows[window]; !ok {
+		window = "week"
+	}
+
+	page := app.pageParam(r)
+
+	ranked, total, err := app.snippets.Trending(r.Context(), trendingWindows[window], page, trendingPageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Ranked = ranked
+	data.TrendingWindow = window
+	data.SnippetPages = newPageInfo(page, trendingPageSize, total)
+
+	app.render(w, http.StatusOK, "trending.tmpl.html", data)
+}
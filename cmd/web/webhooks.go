@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/validator"
+	"snippetbox.floccinau.net/internal/worker"
+)
+
+// webhookJob is the kind of job which sends a webhook delivery.
+const webhookJob = "webhook.deliver"
+
+const (
+	// maxWebhookAttempts is how many times a delivery is tried before it's
+	// marked as failed. With the backoff below that's about a day.
+	maxWebhookAttempts = 10
+
+	// webhookBackoff is the wait before the first retry; it doubles for
+	// each retry after that, up to maxWebhookBackoff.
+	webhookBackoff    = 30 * time.Second
+	maxWebhookBackoff = 6 * time.Hour
+
+	// webhookLogSize is how many deliveries are shown in the delivery log.
+	webhookLogSize = 50
+)
+
+// webhookRetryDelay returns how long to wait before the next attempt after
+// the given number of failed attempts. A little jitter keeps retries from a
+// burst of events from all arriving at once.
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := maxWebhookBackoff
+	if attempts <= 16 {
+		delay = min(webhookBackoff<<(attempts-1), maxWebhookBackoff)
+	}
+	return delay + mathrand.N(delay/10+1)
+}
+
+// newWebhookClient returns the HTTP client which deliveries are sent with.
+// Unless allowPrivate is set, it refuses to connect to loopback, private
+// and link-local addresses, so that webhooks can't be used to reach services
+// on our own network. The check is made on the address actually dialled,
+// after DNS resolution, so a hostname can't be used to get around it.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			ip := ap.Addr().Unmap()
+			if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+				return fmt.Errorf("webhook address %s is not public", ip)
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConnsPerHost: 2,
+		},
+		// Redirects aren't followed: the endpoint should be registered with
+		// its final URL.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// webhookPayload is the JSON body sent for an event. Attachment is only set
+// for attachment events.
+type webhookPayload struct {
+	Event      string             `json:"event"`
+	Created    time.Time          `json:"created"`
+	Snippet    *models.Snippet    `json:"snippet"`
+	Attachment *webhookAttachment `json:"attachment,omitempty"`
+}
+
+// The notifySnippet method queues event for the webhooks of the snippet's
+// owner. The deliveries are queued in the background, after the response
+// has been sent, and failures are logged rather than failing the request,
+// since the change itself has already been made.
+func (app *application) notifySnippet(event string, snippet *models.Snippet) {
+	if snippet.UserID == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(webhookPayload{Event: event, Created: time.Now().UTC(), Snippet: snippet})
+	if err != nil {
+		app.errorLog.Output(2, err.Error())
+		return
+	}
+
+	userID := snippet.UserID
+	app.background(func() {
+		app.queueWebhooks(userID, event, payload)
+	})
+}
+
+// The notifySnippetChange method is like notifySnippet, but loads the
+// snippet with the given ID, along with its tags, in the background first.
+// Nobody is told about snippets which aren't published yet; a scheduled
+// snippet is announced by its publish job.
+func (app *application) notifySnippetChange(event string, id int) {
+	app.background(func() {
+		snippet, err := app.snippets.Get(context.Background(), id)
+		if err == nil {
+			err = app.snippets.LoadTags(snippet)
+		}
+		if errors.Is(err, models.ErrNoRecord) {
+			return
+		} else if err != nil {
+			app.errorLog.Print(err)
+			return
+		}
+		if snippet.UserID == 0 {
+			return
+		}
+
+		payload, err := json.Marshal(webhookPayload{Event: event, Created: time.Now().UTC(), Snippet: snippet})
+		if err != nil {
+			app.errorLog.Print(err)
+			return
+		}
+
+		app.queueWebhooks(snippet.UserID, event, payload)
+	})
+}
+
+// The queueWebhooks method records a delivery of the payload to each of the
+// user's webhooks which subscribe to event, and queues a job to send each
+// one. Webhooks are delivered in the background: the webhook_deliveries
+// table, which the delivery log is shown from, holds each delivery, and the
+// webhookJob sends it, so a slow or broken endpoint never holds up a
+// request and nothing is lost if the application restarts. Failed
+// deliveries are retried with exponential backoff.
+func (app *application) queueWebhooks(userID int, event string, payload []byte) {
+	ids, err := app.webhooks.QueueDeliveries(userID, event, payload)
+	if err != nil {
+		app.errorLog.Print(err)
+		return
+	}
+
+	for _, id := range ids {
+		err = app.jobs.Enqueue(webhookJob, webhookJobPayload{DeliveryID: id})
+		if err != nil {
+			app.errorLog.Print(err)
+		}
+	}
+}
+
+// webhookJobPayload is the payload of a webhookJob.
+type webhookJobPayload struct {
+	DeliveryID int `json:"delivery_id"`
+}
+
+// The deliverWebhook method is the handler for webhookJob jobs. It makes one
+// attempt at a delivery and records the outcome in the delivery log. Failed
+// attempts are retried by the job queue, after the delay shown in the log.
+func (app *application) deliverWebhook(ctx context.Context, job *worker.Job) error {
+	var input webhookJobPayload
+	err := job.Decode(&input)
+	if err != nil {
+		return worker.Permanent(err)
+	}
+
+	// If the delivery or its webhook has been deleted there's nothing to
+	// do.
+	d, err := app.webhooks.GetDelivery(input.DeliveryID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+	hook, err := app.webhooks.Get(d.WebhookID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil
+		}
+		return err
+	}
+
+	code, sendErr := app.postWebhook(ctx, hook, d)
+
+	status, next := models.DeliveryDelivered, time.Now()
+	delay := time.Duration(0)
+	msg := ""
+	if sendErr != nil {
+		msg = sendErr.Error()
+		if job.Attempts >= job.MaxAttempts {
+			status = models.DeliveryFailed
+		} else {
+			status = models.DeliveryPending
+			delay = webhookRetryDelay(job.Attempts)
+			next = next.Add(delay)
+		}
+	}
+
+	err = app.webhooks.RecordAttempt(d.ID, status, code, msg, next)
+	if err != nil {
+		app.errorLog.Print(err)
+	}
+
+	if sendErr != nil {
+		return worker.RetryAfter(sendErr, delay)
+	}
+	return nil
+}
+
+// The postWebhook method sends a delivery to its webhook and returns the
+// response status code. Anything other than a 2xx response is an error.
+//
+// The payload is signed with an HMAC-SHA256 of the timestamp, a dot and the
+// body, keyed with the webhook's secret, in the X-Snippetbox-Signature
+// header. Including the timestamp lets receivers reject replayed requests.
+func (app *application) postWebhook(ctx context.Context, hook *models.Webhook, d *models.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewBufferString(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Snippetbox-Webhooks/1.0")
+	req.Header.Set("X-Snippetbox-Event", d.Event)
+	req.Header.Set("X-Snippetbox-Delivery", strconv.Itoa(d.ID))
+	req.Header.Set("X-Snippetbox-Timestamp", timestamp)
+	req.Header.Set("X-Snippetbox-Signature", "sha256="+signWebhook(hook.Secret, timestamp, d.Payload))
+
+	resp, err := app.webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Read (some of) the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// signWebhook returns the hex-encoded signature of a payload.
+func signWebhook(secret, timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookForm holds the form for adding a webhook. The secret is optional;
+// if it's left blank one is generated.
+type webhookForm struct {
+	URL    string
+	Secret string
+	Events []string
+	validator.Validator
+}
+
+// Subscribed reports whether event is ticked in the form.
+func (f webhookForm) Subscribed(event string) bool {
+	return slices.Contains(f.Events, event)
+}
+
+// The accountWebhooks handler lists the current user's webhooks, with a form
+// for adding another.
+func (app *application) accountWebhooks(w http.ResponseWriter, r *http.Request) {
+	app.renderWebhooks(w, r, http.StatusOK, webhookForm{Events: models.WebhookEvents})
+}
+
+func (app *application) renderWebhooks(w http.ResponseWriter, r *http.Request, status int, form webhookForm) {
+	webhooks, err := app.webhooks.ForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Webhooks = webhooks
+	data.WebhookEvents = models.WebhookEvents
+	data.Form = form
+
+	app.render(w, status, "webhooks.tmpl.html", data)
+}
+
+func (app *application) accountWebhooksPost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := webhookForm{
+		URL:    r.PostForm.Get("url"),
+		Secret: r.PostForm.Get("secret"),
+		Events: r.PostForm["events"],
+	}
+
+	u, err := url.Parse(form.URL)
+	form.Check(validator.NotBlank(form.URL), "url", "This field cannot be blank")
+	form.Check(validator.MaxChars(form.URL, 2048), "url", "This field cannot be more than 2048 characters long")
+	form.Check(err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "", "url", "This field must be an http or https URL")
+	if form.Secret != "" {
+		form.Check(validator.MinChars(form.Secret, 16), "secret", "This field must be at least 16 characters long")
+		form.Check(validator.MaxChars(form.Secret, 128), "secret", "This field cannot be more than 128 characters long")
+	}
+	form.Check(len(form.Events) > 0, "events", "Choose at least one event")
+	for _, event := range form.Events {
+		form.Check(validator.PermittedValue(event, models.WebhookEvents...), "events", "Unknown event")
+	}
+
+	if !form.Valid() {
+		form.Secret = ""
+		app.renderWebhooks(w, r, http.StatusUnprocessableEntity, form)
+		return
+	}
+
+	flash := "Webhook added!"
+	if form.Secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		form.Secret = hex.EncodeToString(b)
+		flash = "Webhook added! Its signing secret is " + form.Secret + " — copy it now, because it won't be shown again."
+	}
+
+	// Keep the events in their usual order, whatever order they came in.
+	var events []string
+	for _, event := range models.WebhookEvents {
+		if form.Subscribed(event) {
+			events = append(events, event)
+		}
+	}
+
+	_, err = app.webhooks.Insert(app.contextGetUser(r).ID, u.String(), form.Secret, events)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", flash)
+
+	http.Redirect(w, r, "/account/webhooks", http.StatusSeeOther)
+}
+
+// The ownWebhook helper loads the webhook named in the URL and checks that
+// it belongs to the current user. It sends the error response itself and
+// returns nil if not. Other users' webhooks are reported as not found.
+func (app *application) ownWebhook(w http.ResponseWriter, r *http.Request) *models.Webhook {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return nil
+	}
+
+	hook, err := app.webhooks.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil
+	}
+
+	if hook.UserID != app.contextGetUser(r).ID {
+		app.notFound(w)
+		return nil
+	}
+
+	return hook
+}
+
+// The accountWebhook handler shows the delivery log of one webhook.
+func (app *application) accountWebhook(w http.ResponseWriter, r *http.Request) {
+	hook := app.ownWebhook(w, r)
+	if hook == nil {
+		return
+	}
+
+	deliveries, err := app.webhooks.Deliveries(hook.ID, webhookLogSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Webhook = hook
+	data.Deliveries = deliveries
+
+	app.render(w, http.StatusOK, "webhook.tmpl.html", data)
+}
+
+func (app *application) accountWebhookDeletePost(w http.ResponseWriter, r *http.Request) {
+	hook := app.ownWebhook(w, r)
+	if hook == nil {
+		return
+	}
+
+	err := app.webhooks.Delete(hook.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "Webhook deleted.")
+
+	http.Redirect(w, r, "/account/webhooks", http.StatusSeeOther)
+}
+
+// The webhookRedeliverPost handler queues a delivery to be sent again.
+func (app *application) webhookRedeliverPost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	d, err := app.webhooks.GetDelivery(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	hook, err := app.webhooks.Get(d.WebhookID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	if hook.UserID != app.contextGetUser(r).ID {
+		app.notFound(w)
+		return
+	}
+
+	err = app.webhooks.Redeliver(d.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.jobs.Enqueue(webhookJob, webhookJobPayload{DeliveryID: d.ID})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", fmt.Sprintf("Delivery %d queued to be sent again.", d.ID))
+
+	http.Redirect(w, r, fmt.Sprintf("/account/webhooks/%d", hook.ID), http.StatusSeeOther)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+	"snippetbox.floccinau.net/internal/pubsub"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsWriteWait is how long a message may take to write.
+	wsWriteWait = 10 * time.Second
+
+	// wsPongWait is how long to wait for a pong (or any other message)
+	// before deciding the client has gone.
+	wsPongWait = 60 * time.Second
+
+	// wsPingPeriod is how often pings are sent. It must be less than
+	// wsPongWait.
+	wsPingPeriod = wsPongWait * 9 / 10
+
+	// wsMaxMessageSize is the largest message read from a client. Clients
+	// don't send anything but control messages, so this is small.
+	wsMaxMessageSize = 512
+)
+
+// snippetTopic returns the events hub topic for a snippet's live updates.
+func snippetTopic(id int) string {
+	return "snippet:" + strconv.Itoa(id)
+}
+
+// socketMessage is a message sent to the viewers of a snippet. Type is one
+// of "snippet.updated", "snippet.deleted", "comment.created" and
+// "comment.deleted".
+type socketMessage struct {
+	Type    string          `json:"type"`
+	Snippet *models.Snippet `json:"snippet,omitempty"`
+	Comment *socketComment  `json:"comment,omitempty"`
+}
+
+type socketComment struct {
+	ID      int       `json:"id"`
+	Author  string    `json:"author,omitempty"`
+	Avatar  string    `json:"avatar,omitempty"`
+	Content string    `json:"content,omitempty"`
+	Created time.Time `json:"created,omitzero"`
+}
+
+// The checkSocketOrigin method allows WebSocket connections from pages on
+// our own site and on the trusted origins. Browsers always send an Origin
+// header with WebSocket requests, and don't apply the same-origin policy to
+// them, so without this check any site could open a socket with the
+// visitor's cookies. Clients which aren't browsers don't send an Origin.
+func (app *application) checkSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if u.Host == r.Host {
+		return true
+	}
+
+	return slices.Contains(app.trustedOrigins, origin)
+}
+
+// The publishToViewers method sends a message to everyone viewing a snippet.
+func (app *application) publishToViewers(snippetID int, msg socketMessage) {
+	topic := snippetTopic(snippetID)
+	if app.events.Subscribers(topic) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		app.errorLog.Print(err)
+		return
+	}
+
+	app.events.Publish(topic, pubsub.Message{Event: msg.Type, Data: data})
+}
+
+// The broadcastSnippet method sends the current version of a snippet to its
+// viewers, in the background.
+func (app *application) broadcastSnippet(id int) {
+	if app.events.Subscribers(snippetTopic(id)) == 0 {
+		return
+	}
+
+	app.background(func() {
+		snippet, err := app.snippets.Get(context.Background(), id)
+		if err == nil {
+			err = app.snippets.LoadTags(snippet)
+		}
+		if err != nil {
+			app.errorLog.Print(err)
+			return
+		}
+		if snippet.Protected {
+			return
+		}
+
+		app.publishToViewers(id, socketMessage{Type: "snippet.updated", Snippet: snippet})
+	})
+}
+
+// The broadcastComment method sends a new comment to the viewers of its
+// snippet, in the background.
+func (app *application) broadcastComment(snippetID, commentID int) {
+	if app.events.Subscribers(snippetTopic(snippetID)) == 0 {
+		return
+	}
+
+	app.background(func() {
+		c, err := app.comments.Get(commentID)
+		if err != nil {
+			app.errorLog.Print(err)
+			return
+		}
+
+		app.publishToViewers(snippetID, socketMessage{
+			Type: "comment.created",
+			Comment: &socketComment{
+				ID:      c.ID,
+				Author:  c.Author,
+				Avatar:  avatarURL(c.Commenter, 64, app.gravatar),
+				Content: c.Content,
+				Created: c.Created,
+			},
+		})
+	})
+}
+
+// The snippetSocket handler upgrades the connection to a WebSocket and
+// sends the snippet's live updates down it until either side closes it.
+// People viewing a snippet open one at /ws/snippet/{id} to be told about
+// edits and comments as they happen. Each socket subscribes to the
+// snippet's topic on the events hub; the hub buffers messages for each
+// socket and drops sockets which fall too far behind. Only snippets without
+// a passphrase have sockets, since the socket doesn't go through the
+// session to check whether a protected snippet has been unlocked.
+func (app *application) snippetSocket(w http.ResponseWriter, r *http.Request) {
+	snippet := app.publicSnippetFromPath(w, r)
+	if snippet == nil {
+		return
+	}
+
+	sub, err := app.events.Subscribe(snippetTopic(snippet.ID))
+	if err != nil {
+		if errors.Is(err, pubsub.ErrTooManySubscribers) || errors.Is(err, pubsub.ErrClosed) {
+			w.Header().Set("Retry-After", "30")
+			app.clientError(w, http.StatusServiceUnavailable)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	defer sub.Close()
+
+	upgrader := websocket.Upgrader{CheckOrigin: app.checkSocketOrigin}
+
+	// Upgrade sends an error response itself if the handshake fails.
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	go app.readSocket(conn, sub)
+	app.writeSocket(conn, sub)
+}
+
+// The readSocket method reads from a socket until it fails, which is how a
+// closed connection is noticed. Reading is also what processes pongs, which
+// push the read deadline back. When it returns, the subscription is closed,
+// which stops writeSocket.
+func (app *application) readSocket(conn *websocket.Conn, sub *pubsub.Subscription) {
+	defer sub.Close()
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		if _, _, err := conn.NextReader(); err != nil {
+			return
+		}
+	}
+}
+
+// The writeSocket method sends messages from the subscription down the
+// socket, along with regular pings, until the subscription ends or a write
+// fails. It's the only thing which writes to the connection, as gorilla's
+// websocket package requires.
+func (app *application) writeSocket(conn *websocket.Conn, sub *pubsub.Subscription) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg, ok := <-sub.C():
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+
+			if !ok {
+				// The client went away, fell too far behind, or the
+				// application is shutting down.
+				code, text := websocket.CloseGoingAway, "shutting down"
+				if sub.Evicted() {
+					code, text = websocket.CloseTryAgainLater, "too slow"
+				}
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, text))
+				return
+			}
+
+			if err := conn.WriteMessage(websocket.TextMessage, msg.Data); err != nil {
+				return
+			}
+
+			if msg.Event == "snippet.deleted" {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "snippet deleted"))
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
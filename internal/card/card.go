@@ -0,0 +1,200 @@
+// Package card draws the preview images ("cards") which social networks and
+// chat apps show when a link to a snippet is shared.
+package card
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// The size of a card. 1200x630 is the size recommended for og:image, and is
+// also what Twitter uses for summary_large_image cards.
+const (
+	Width  = 1200
+	Height = 630
+)
+
+// MaxLines is the most lines of a snippet's content which are drawn.
+const MaxLines = 15
+
+const (
+	padding    = 48
+	headerSize = 28
+	titleSize  = 40
+	codeSize   = 22
+	lineHeight = 28
+	tabWidth   = 4
+)
+
+// The colour scheme, based on the site's own header and link colours.
+var (
+	background = color.RGBA{0x1e, 0x23, 0x2b, 0xff}
+	brand      = color.RGBA{0x34, 0x91, 0x9b, 0xff}
+	titleColor = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	plainColor = color.RGBA{0xd8, 0xde, 0xe9, 0xff}
+	gutter     = color.RGBA{0x5c, 0x66, 0x77, 0xff}
+	keyword    = color.RGBA{0xc5, 0x94, 0xc5, 0xff}
+	stringLit  = color.RGBA{0x99, 0xc7, 0x94, 0xff}
+	comment    = color.RGBA{0x7a, 0x84, 0x95, 0xff}
+	number     = color.RGBA{0xf9, 0xae, 0x58, 0xff}
+)
+
+type faceSet struct {
+	header, title, code font.Face
+}
+
+// loadFaces parses the embedded Go fonts the first time a card is drawn.
+var loadFaces = sync.OnceValues(func() (*faceSet, error) {
+	bold, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, err
+	}
+	mono, err := opentype.Parse(gomono.TTF)
+	if err != nil {
+		return nil, err
+	}
+
+	newFace := func(f *opentype.Font, size float64) (font.Face, error) {
+		return opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	}
+
+	var fs faceSet
+	if fs.header, err = newFace(bold, headerSize); err != nil {
+		return nil, err
+	}
+	if fs.title, err = newFace(bold, titleSize); err != nil {
+		return nil, err
+	}
+	if fs.code, err = newFace(mono, codeSize); err != nil {
+		return nil, err
+	}
+	return &fs, nil
+})
+
+// Render draws a card for a snippet with the given title and content, and
+// writes it to w as a PNG image.
+func Render(w io.Writer, title, content string) error {
+	faces, err := loadFaces()
+	if err != nil {
+		return err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	// A strip of the brand colour down the left hand side, and the site name
+	// in the top left corner.
+	draw.Draw(img, image.Rect(0, 0, 12, Height), image.NewUniform(brand), image.Point{}, draw.Src)
+
+	d := &font.Drawer{Dst: img}
+	y := padding + headerSize
+	drawText(d, faces.header, brand, padding, y, "Snippetbox")
+
+	y += titleSize + 24
+	drawText(d, faces.title, titleColor, padding, y, truncate(d, faces.title, title, Width-2*padding))
+
+	// Then the first lines of content, with line numbers in a gutter.
+	y += 24
+	codeLeft := padding + 3*advance(faces.code) + 24
+	codeWidth := Width - padding - codeLeft
+	for i, line := range firstLines(content, MaxLines) {
+		y += lineHeight
+		if y > Height-padding/2 {
+			break
+		}
+
+		num := strconv.Itoa(i + 1)
+		numX := codeLeft - 24 - len(num)*advance(faces.code)
+		drawText(d, faces.code, gutter, numX, y, num)
+
+		x := codeLeft
+		for _, tok := range tokenize(truncate(d, faces.code, line, codeWidth)) {
+			x = drawText(d, faces.code, tok.color, x, y, tok.text)
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// drawText draws s with its baseline at (x, y) and returns the x position at
+// which the text ended.
+func drawText(d *font.Drawer, face font.Face, c color.Color, x, y int, s string) int {
+	d.Face = face
+	d.Src = image.NewUniform(c)
+	d.Dot = fixed.P(x, y)
+	d.DrawString(s)
+	return d.Dot.X.Round()
+}
+
+// advance returns the width of one character of a monospaced face.
+func advance(face font.Face) int {
+	a, _ := face.GlyphAdvance('0')
+	return a.Round()
+}
+
+// truncate shortens s, adding an ellipsis, so that it fits in width pixels.
+func truncate(d *font.Drawer, face font.Face, s string, width int) string {
+	d.Face = face
+	if d.MeasureString(s).Round() <= width {
+		return s
+	}
+
+	runes := []rune(s)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		t := strings.TrimRightFunc(string(runes), unicode.IsSpace) + "…"
+		if d.MeasureString(t).Round() <= width {
+			return t
+		}
+	}
+	return ""
+}
+
+// firstLines returns up to n lines of content with tabs expanded, so that
+// indentation is drawn the same as it would be in an editor.
+func firstLines(content string, n int) []string {
+	content = strings.TrimRight(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	all := strings.Split(content, "\n")
+	if len(all) > n {
+		all = all[:n]
+	}
+
+	for i, line := range all {
+		all[i] = expandTabs(line)
+	}
+	return all
+}
+
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+
+	var b strings.Builder
+	col := 0
+	for _, r := range line {
+		if r == '\t' {
+			spaces := tabWidth - col%tabWidth
+			b.WriteString(strings.Repeat(" ", spaces))
+			col += spaces
+			continue
+		}
+		b.WriteRune(r)
+		col++
+	}
+	return b.String()
+}
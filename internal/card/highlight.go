@@ -0,0 +1,33 @@
+package card
+
+import (
+	"image/color"
+
+	"snippetbox.floccinau.net/internal/highlight"
+)
+
+// token is a run of text drawn in a single colour.
+type token struct {
+	text  string
+	color color.Color
+}
+
+// kindColors are the colours each kind of highlighted text is drawn in.
+var kindColors = map[highlight.Kind]color.Color{
+	highlight.Plain:   plainColor,
+	highlight.Comment: comment,
+	highlight.String:  stringLit,
+	highlight.Number:  number,
+	highlight.Keyword: keyword,
+}
+
+// tokenize splits a line into coloured tokens, using the same highlighting
+// as the snippet pages. It's only a preview, so being occasionally wrong
+// doesn't matter much.
+func tokenize(line string) []token {
+	var tokens []token
+	for _, t := range highlight.Line(line) {
+		tokens = append(tokens, token{t.Text, kindColors[t.Kind]})
+	}
+	return tokens
+}
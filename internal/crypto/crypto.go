@@ -0,0 +1,277 @@
+// Package crypto provides envelope encryption for data stored at rest.
+//
+// Every value is encrypted with its own random data key using AES-256-GCM,
+// and the data key is in turn encrypted ("wrapped") with a long-lived key
+// encryption key from a Keyring. The wrapped data key is stored alongside the
+// ciphertext, so a value can be decrypted as long as the keyring still holds
+// the key which wrapped it.
+//
+// A Keyring holds one primary key, which is used for all new encryption, and
+// any number of older keys, which are only used for decryption. To rotate
+// keys, add a new key at the front of the list, restart, and re-encrypt the
+// existing data with cmd/rekey; the old key can then be removed.
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the size of a key encryption key in bytes (AES-256).
+const KeySize = 32
+
+// prefix marks an encrypted value. Anything without it is treated as
+// plaintext which was stored before encryption was turned on.
+const prefix = "enc1:"
+
+var (
+	// ErrUnknownKey is returned when a value was encrypted with a key which
+	// isn't in the keyring.
+	ErrUnknownKey = errors.New("crypto: value was encrypted with an unknown key")
+
+	// ErrMalformed is returned when an encrypted value can't be parsed or
+	// fails authentication.
+	ErrMalformed = errors.New("crypto: malformed or tampered ciphertext")
+)
+
+// Keyring holds the key encryption keys. The zero value, and a nil *Keyring,
+// has no keys: it stores values in plain text and can't decrypt anything.
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// NewKeyring creates a keyring from raw 32-byte keys. The first key is the
+// primary key.
+func NewKeyring(keys ...[]byte) (*Keyring, error) {
+	kr := &Keyring{keys: map[string][]byte{}}
+
+	for i, key := range keys {
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("crypto: key %d is %d bytes long, not %d", i+1, len(key), KeySize)
+		}
+
+		id := keyID(key)
+		kr.keys[id] = key
+		if i == 0 {
+			kr.primary = id
+		}
+	}
+
+	return kr, nil
+}
+
+// ParseKeyring creates a keyring from a comma-separated list of base64
+// encoded keys, like the value of the -content-key flag. An empty string
+// gives an empty keyring.
+func ParseKeyring(s string) (*Keyring, error) {
+	var keys [][]byte
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		key, err := base64.StdEncoding.DecodeString(field)
+		if err != nil {
+			return nil, fmt.Errorf("crypto: key %d is not valid base64: %w", len(keys)+1, err)
+		}
+		keys = append(keys, key)
+	}
+
+	return NewKeyring(keys...)
+}
+
+// GenerateKey returns a new random key, base64 encoded for use with
+// ParseKeyring.
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// keyID identifies a key by a short hash of it, so that the key itself never
+// needs to be written down anywhere but the configuration.
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// Enabled reports whether the keyring has a primary key to encrypt with.
+func (kr *Keyring) Enabled() bool {
+	return kr != nil && kr.primary != ""
+}
+
+// Encrypt encrypts plaintext with a new data key wrapped by the primary key.
+// If the keyring is empty it returns the plaintext unchanged.
+//
+// The result looks like "enc1:<key id>:<base64 data>", where the data is the
+// wrapped data key followed by the nonce and the ciphertext.
+func (kr *Keyring) Encrypt(plaintext string) (string, error) {
+	if !kr.Enabled() {
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	wrapped, err := Seal(kr.keys[kr.primary], dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := Seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + kr.primary + ":" + base64.StdEncoding.EncodeToString(append(wrapped, sealed...)), nil
+}
+
+// Decrypt reverses Encrypt. Values which aren't encrypted are returned
+// unchanged, so that data stored before encryption was enabled can still be
+// read.
+func (kr *Keyring) Decrypt(value string) (string, error) {
+	id, data, ok := parse(value)
+	if !ok {
+		return value, nil
+	}
+
+	if kr == nil {
+		return "", ErrUnknownKey
+	}
+	kek, ok := kr.keys[id]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+
+	// The wrapped data key is a fixed size: nonce, key and GCM tag.
+	wrappedLen := 12 + KeySize + 16
+	if len(data) < wrappedLen {
+		return "", ErrMalformed
+	}
+
+	dataKey, err := Open(kek, data[:wrappedLen])
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := Open(dataKey, data[wrappedLen:])
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// NeedsRekey reports whether a stored value should be re-encrypted: because
+// it's plain text and the keyring has a key, or because it was encrypted with
+// a key other than the primary one.
+func (kr *Keyring) NeedsRekey(value string) bool {
+	id, _, ok := parse(value)
+	if !ok {
+		return kr.Enabled()
+	}
+	return !kr.Enabled() || id != kr.primary
+}
+
+// Hash returns a hex-encoded HMAC-SHA256 of value, keyed with a key derived
+// from the primary key for the given purpose. Equal values can be found by
+// their hashes, but without the key the hashes can't be checked against
+// guesses at the values. Hashes made under different primary keys don't
+// match, so they have to be made again when keys are rotated. If the
+// keyring is empty, values are stored in plain text anyway, and it returns
+// a plain SHA-256 hash.
+func (kr *Keyring) Hash(purpose, value string) string {
+	if !kr.Enabled() {
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:])
+	}
+
+	// The key for the purpose is the HMAC of its name under the primary
+	// key, so that hashes made for one purpose can't be used for another.
+	derive := hmac.New(sha256.New, kr.keys[kr.primary])
+	derive.Write([]byte("snippetbox " + purpose))
+
+	mac := hmac.New(sha256.New, derive.Sum(nil))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsEncrypted reports whether a stored value is encrypted.
+func IsEncrypted(value string) bool {
+	_, _, ok := parse(value)
+	return ok
+}
+
+func parse(value string) (id string, data []byte, ok bool) {
+	rest, found := strings.CutPrefix(value, prefix)
+	if !found {
+		return "", nil, false
+	}
+
+	id, encoded, found := strings.Cut(rest, ":")
+	if !found {
+		return "", nil, false
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, false
+	}
+
+	return id, data, true
+}
+
+// Seal encrypts plaintext with AES-GCM under a 16, 24 or 32 byte key,
+// returning a random nonce followed by the ciphertext.
+func Seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open decrypts and authenticates the output of Seal.
+func Open(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
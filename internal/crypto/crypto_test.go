@@ -0,0 +1,344 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newKey returns a key of KeySize bytes, all set to b, so that the tests
+// can tell keys apart.
+func newKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+// newTestKeyring returns a keyring of the keys, failing the test if it
+// can't be made.
+func newTestKeyring(t *testing.T, keys ...[]byte) *Keyring {
+	t.Helper()
+
+	kr, err := NewKeyring(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+// tamper decodes the encrypted value, flips a bit of the byte at i (counted
+// from the end if it's negative) and encodes it again.
+func tamper(t *testing.T, value string, i int) string {
+	t.Helper()
+
+	head, encoded, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i < 0 {
+		i += len(data)
+	}
+	data[i] ^= 1
+	return prefix + head + ":" + base64.StdEncoding.EncodeToString(data)
+}
+
+func TestKeyringRoundTrip(t *testing.T) {
+	kr := newTestKeyring(t, newKey(1))
+
+	tests := []struct {
+		name      string
+		plaintext string
+	}{
+		{"Empty", ""},
+		{"Short", "An old silent pond"},
+		{"Unicode", "古池や蛙飛び込む水の音"},
+		{"Looks encrypted", "enc1:not:really"},
+		{"Long", strings.Repeat("splash! ", 10000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := kr.Encrypt(tt.plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsEncrypted(value) {
+				t.Fatalf("got %q; want an encrypted value", value)
+			}
+			if tt.plaintext != "" && strings.Contains(value, tt.plaintext) {
+				t.Errorf("the plaintext is in the encrypted value")
+			}
+
+			got, err := kr.Decrypt(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.plaintext {
+				t.Errorf("got %q; want %q", got, tt.plaintext)
+			}
+		})
+	}
+
+	t.Run("Fresh data key", func(t *testing.T) {
+		a, err := kr.Encrypt("same")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := kr.Encrypt("same")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a == b {
+			t.Error("the same plaintext encrypted to the same value twice")
+		}
+	})
+}
+
+func TestKeyringRotation(t *testing.T) {
+	oldKEK, newKEK := newKey(1), newKey(2)
+
+	old := newTestKeyring(t, oldKEK)
+	value, err := old.Encrypt("An old silent pond")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The new key is first, so it's the primary one, and the old key is
+	// still there to decrypt what it encrypted.
+	rotated := newTestKeyring(t, newKEK, oldKEK)
+
+	got, err := rotated.Decrypt(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "An old silent pond" {
+		t.Errorf("got %q; want %q", got, "An old silent pond")
+	}
+	if !rotated.NeedsRekey(value) {
+		t.Error("a value encrypted with the old key doesn't need re-encrypting")
+	}
+
+	rekeyed, err := rotated.Encrypt(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.NeedsRekey(rekeyed) {
+		t.Error("a value encrypted with the primary key needs re-encrypting")
+	}
+
+	// Once the old key is removed, what it encrypted can't be read, but
+	// what was re-encrypted can.
+	retired := newTestKeyring(t, newKEK)
+	if _, err := retired.Decrypt(value); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("got error %v; want %v", err, ErrUnknownKey)
+	}
+	if got, err := retired.Decrypt(rekeyed); err != nil || got != "An old silent pond" {
+		t.Errorf("got %q, %v; want %q", got, err, "An old silent pond")
+	}
+}
+
+func TestNewKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    [][]byte
+		wantErr bool
+		enabled bool
+	}{
+		{"None", nil, false, false},
+		{"One", [][]byte{newKey(1)}, false, true},
+		{"Two", [][]byte{newKey(1), newKey(2)}, false, true},
+		{"Empty", [][]byte{{}}, true, false},
+		{"AES-128", [][]byte{make([]byte, 16)}, true, false},
+		{"Short", [][]byte{make([]byte, KeySize-1)}, true, false},
+		{"Long", [][]byte{make([]byte, KeySize+1)}, true, false},
+		{"Second short", [][]byte{newKey(1), make([]byte, 16)}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr, err := NewKeyring(tt.keys...)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error; want one")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kr.Enabled() != tt.enabled {
+				t.Errorf("got Enabled() = %t; want %t", kr.Enabled(), tt.enabled)
+			}
+		})
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	key1 := base64.StdEncoding.EncodeToString(newKey(1))
+	key2 := base64.StdEncoding.EncodeToString(newKey(2))
+
+	tests := []struct {
+		name    string
+		s       string
+		wantErr bool
+		primary []byte
+	}{
+		{"Empty", "", false, nil},
+		{"Only commas", " , ,", false, nil},
+		{"One", key1, false, newKey(1)},
+		{"Two", key2 + ", " + key1, false, newKey(2)},
+		{"Not base64", "not base64!", true, nil},
+		{"Short", base64.StdEncoding.EncodeToString(make([]byte, 16)), true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr, err := ParseKeyring(tt.s)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got no error; want one")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.primary == nil {
+				if kr.Enabled() {
+					t.Error("got an enabled keyring; want an empty one")
+				}
+				return
+			}
+			if kr.primary != keyID(tt.primary) {
+				t.Errorf("got primary key %s; want %s", kr.primary, keyID(tt.primary))
+			}
+		})
+	}
+}
+
+func TestKeyringDecryptErrors(t *testing.T) {
+	kr := newTestKeyring(t, newKey(1))
+
+	value, err := kr.Encrypt("An old silent pond")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := keyID(newKey(1))
+
+	tests := []struct {
+		name  string
+		value string
+		want  error
+	}{
+		{"Tampered ciphertext", tamper(t, value, -1), ErrMalformed},
+		{"Tampered data key", tamper(t, value, 20), ErrMalformed},
+		{"Tampered nonce", tamper(t, value, 0), ErrMalformed},
+		{"Truncated", prefix + id + ":" + base64.StdEncoding.EncodeToString([]byte("short")), ErrMalformed},
+		{"Unknown key", prefix + "00000000:" + strings.SplitN(value, ":", 3)[2], ErrUnknownKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := kr.Decrypt(tt.value)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got error %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyringDisabled(t *testing.T) {
+	encrypted, err := newTestKeyring(t, newKey(1)).Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		kr   *Keyring
+	}{
+		{"Nil", nil},
+		{"Zero", &Keyring{}},
+		{"No keys", newTestKeyring(t)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.kr.Enabled() {
+				t.Fatal("got an enabled keyring")
+			}
+
+			// Values are stored, and read back, as they are.
+			value, err := tt.kr.Encrypt("An old silent pond")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value != "An old silent pond" {
+				t.Errorf("got %q from Encrypt; want the plaintext", value)
+			}
+			got, err := tt.kr.Decrypt(value)
+			if err != nil || got != value {
+				t.Errorf("got %q, %v from Decrypt; want %q", got, err, value)
+			}
+			if tt.kr.NeedsRekey(value) {
+				t.Error("a plaintext value needs re-encrypting without a key")
+			}
+
+			// What was encrypted before can't be read without its key,
+			// and is left for cmd/rekey.
+			if _, err := tt.kr.Decrypt(encrypted); !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("got error %v; want %v", err, ErrUnknownKey)
+			}
+			if !tt.kr.NeedsRekey(encrypted) {
+				t.Error("an encrypted value doesn't need re-encrypting without a key")
+			}
+		})
+	}
+}
+
+func TestKeyringPlaintextPassesThrough(t *testing.T) {
+	kr := newTestKeyring(t, newKey(1))
+
+	// Values stored before encryption was turned on are read as they are,
+	// and picked up by cmd/rekey.
+	got, err := kr.Decrypt("An old silent pond")
+	if err != nil || got != "An old silent pond" {
+		t.Errorf("got %q, %v; want the plaintext", got, err)
+	}
+	if !kr.NeedsRekey("An old silent pond") {
+		t.Error("a plaintext value doesn't need encrypting with a key")
+	}
+}
+
+func TestKeyringHash(t *testing.T) {
+	kr := newTestKeyring(t, newKey(1))
+	rotated := newTestKeyring(t, newKey(2), newKey(1))
+
+	a := kr.Hash("dup-hash", "An old silent pond")
+	if len(a) != 64 {
+		t.Fatalf("got a %d character hash; want 64", len(a))
+	}
+	if got := kr.Hash("dup-hash", "An old silent pond"); got != a {
+		t.Errorf("got %q for the same value; want %q", got, a)
+	}
+
+	tests := []struct {
+		name string
+		got  string
+	}{
+		{"Other value", kr.Hash("dup-hash", "A frog jumps in")},
+		{"Other purpose", kr.Hash("other", "An old silent pond")},
+		{"Rotated key", rotated.Hash("dup-hash", "An old silent pond")},
+		{"No key", (*Keyring)(nil).Hash("dup-hash", "An old silent pond")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got == a {
+				t.Errorf("got the same hash %q; want a different one", a)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Package dataloader batches lookups by key, so that resolving the same
+// field of many objects, like the author of every snippet in a list, takes
+// one query rather than one for each object. Keys are collected as they're
+// asked for, and fetched together the first time any of their values is
+// needed. A Loader also remembers the values it has fetched, so it should
+// only live as long as one request.
+package dataloader
+
+import "sync"
+
+// Loader loads values of type V by keys of type K.
+type Loader[K comparable, V any] struct {
+	fetch func(keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	results map[K]*result[V]
+}
+
+type result[V any] struct {
+	value V
+	err   error
+	done  bool
+}
+
+// New returns a Loader which uses fetch to look up a batch of keys. Keys
+// which fetch leaves out of its map get the zero value of V.
+func New[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{fetch: fetch, results: make(map[K]*result[V])}
+}
+
+// Load asks for the value for key, and returns a function which returns it.
+// The key isn't looked up until that function, or the function for another
+// key, is called; then every key asked for so far is looked up at once.
+func (l *Loader[K, V]) Load(key K) func() (V, error) {
+	l.mu.Lock()
+	res, ok := l.results[key]
+	if !ok {
+		res = &result[V]{}
+		l.results[key] = res
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (V, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if !res.done {
+			l.dispatch()
+		}
+		return res.value, res.err
+	}
+}
+
+// dispatch fetches all the pending keys. It must be called with l.mu held.
+func (l *Loader[K, V]) dispatch() {
+	keys := l.pending
+	l.pending = nil
+
+	values, err := l.fetch(keys)
+	for _, key := range keys {
+		res := l.results[key]
+		res.value, res.err, res.done = values[key], err, true
+	}
+}
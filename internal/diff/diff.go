@@ -0,0 +1,251 @@
+// Package diff computes line-based differences between two texts and formats
+// them as unified diffs. It uses Myers' O(ND) algorithm, which is fast when
+// the two texts are similar, as successive revisions of a snippet usually
+// are.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is the kind of edit a Line represents.
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// Line is a single line of an edit script. OldLine and NewLine are the
+// 1-based line numbers in the old and new texts; one of them is zero for
+// inserted and deleted lines.
+type Line struct {
+	Op      Op
+	Text    string
+	OldLine int
+	NewLine int
+}
+
+// Hunk is a group of nearby changes with surrounding context lines, as shown
+// between "@@" headers in a unified diff.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []Line
+}
+
+// Header returns the "@@ -a,b +c,d @@" line for the hunk.
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// Lines returns the full edit script which turns a into b.
+func Lines(a, b string) []Line {
+	return myers(splitLines(a), splitLines(b))
+}
+
+// Hunks groups the changes in an edit script into hunks, each with up to
+// context unchanged lines before and after. It returns nil if there are no
+// changes.
+func Hunks(lines []Line, context int) []Hunk {
+	var hunks []Hunk
+
+	i := 0
+	for i < len(lines) {
+		// Find the next change.
+		for i < len(lines) && lines[i].Op == Equal {
+			i++
+		}
+		if i == len(lines) {
+			break
+		}
+
+		start := max(i-context, 0)
+
+		// Extend the hunk until we see more than 2*context equal lines in a
+		// row (or run out of lines).
+		end := i
+		for end < len(lines) {
+			if lines[end].Op != Equal {
+				end++
+				continue
+			}
+			run := 0
+			for end+run < len(lines) && lines[end+run].Op == Equal {
+				run++
+			}
+			if end+run == len(lines) || run > 2*context {
+				end += min(run, context)
+				break
+			}
+			end += run
+		}
+
+		hunks = append(hunks, newHunk(lines[start:end]))
+		i = end
+	}
+
+	return hunks
+}
+
+func newHunk(lines []Line) Hunk {
+	h := Hunk{Lines: lines}
+
+	for _, l := range lines {
+		if l.Op != Insert {
+			if h.OldStart == 0 {
+				h.OldStart = l.OldLine
+			}
+			h.OldLines++
+		}
+		if l.Op != Delete {
+			if h.NewStart == 0 {
+				h.NewStart = l.NewLine
+			}
+			h.NewLines++
+		}
+	}
+
+	// By convention an empty range starts at the line before it.
+	if h.OldLines == 0 {
+		h.OldStart = precedingLine(lines, true)
+	}
+	if h.NewLines == 0 {
+		h.NewStart = precedingLine(lines, false)
+	}
+
+	return h
+}
+
+func precedingLine(lines []Line, old bool) int {
+	for _, l := range lines {
+		if old && l.NewLine > 0 {
+			return l.NewLine - 1
+		}
+		if !old && l.OldLine > 0 {
+			return l.OldLine - 1
+		}
+	}
+	return 0
+}
+
+// Unified returns a unified diff of a and b with three lines of context,
+// labelled with the given names. It returns an empty string if the texts are
+// the same.
+func Unified(fromName, toName, a, b string) string {
+	hunks := Hunks(Lines(a, b), 3)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	for _, h := range hunks {
+		sb.WriteString(h.Header())
+		sb.WriteByte('\n')
+		for _, l := range h.Lines {
+			switch l.Op {
+			case Equal:
+				sb.WriteByte(' ')
+			case Insert:
+				sb.WriteByte('+')
+			case Delete:
+				sb.WriteByte('-')
+			}
+			sb.WriteString(l.Text)
+			sb.WriteByte('\n')
+		}
+	}
+
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// myers finds the shortest edit script between a and b. For each number of
+// edits d it records how far along each diagonal k it got, then walks that
+// trace backwards to recover the path.
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	total := n + m
+	offset := total + 1
+
+	v := make([]int, 2*total+3)
+	var trace [][]int
+
+	var found bool
+	for d := 0; d <= total && !found; d++ {
+		trace = append(trace, append([]int(nil), v...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	var script []Line
+	x, y := n, m
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			script = append(script, Line{Op: Equal, Text: a[x-1], OldLine: x, NewLine: y})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				script = append(script, Line{Op: Insert, Text: b[y-1], NewLine: y})
+			} else {
+				script = append(script, Line{Op: Delete, Text: a[x-1], OldLine: x})
+			}
+		}
+
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(script)-1; i < j; i, j = i+1, j-1 {
+		script[i], script[j] = script[j], script[i]
+	}
+
+	return script
+}
@@ -0,0 +1,180 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// script writes an edit script compactly, one line per Line: the op, the
+// old and new line numbers, and the text, like "+ 0 2 b".
+func script(lines []Line) string {
+	var sb strings.Builder
+	for _, l := range lines {
+		op := map[Op]string{Equal: "=", Insert: "+", Delete: "-"}[l.Op]
+		fmt.Fprintf(&sb, "%s %d %d %s\n", op, l.OldLine, l.NewLine, l.Text)
+	}
+	return sb.String()
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "Both empty",
+			want: "",
+		},
+		{
+			name: "Old empty",
+			b:    "one\ntwo\n",
+			want: "+ 0 1 one\n+ 0 2 two\n",
+		},
+		{
+			name: "New empty",
+			a:    "one\ntwo\n",
+			want: "- 1 0 one\n- 2 0 two\n",
+		},
+		{
+			name: "Identical",
+			a:    "one\ntwo\nthree\n",
+			b:    "one\ntwo\nthree\n",
+			want: "= 1 1 one\n= 2 2 two\n= 3 3 three\n",
+		},
+		{
+			name: "Insertion",
+			a:    "one\nthree\n",
+			b:    "one\ntwo\nthree\n",
+			want: "= 1 1 one\n+ 0 2 two\n= 2 3 three\n",
+		},
+		{
+			name: "Deletion",
+			a:    "one\ntwo\nthree\n",
+			b:    "one\nthree\n",
+			want: "= 1 1 one\n- 2 0 two\n= 3 2 three\n",
+		},
+		{
+			name: "Replacement",
+			a:    "one\ntwo\nthree\n",
+			b:    "one\n2\nthree\n",
+			want: "= 1 1 one\n- 2 0 two\n+ 0 2 2\n= 3 3 three\n",
+		},
+		{
+			// Only the line endings differ, so nothing has changed.
+			name: "CRLF and LF",
+			a:    "one\r\ntwo\r\n",
+			b:    "one\ntwo\n",
+			want: "= 1 1 one\n= 2 2 two\n",
+		},
+		{
+			name: "CRLF and LF with a change",
+			a:    "one\r\ntwo\r\n",
+			b:    "one\nTwo\n",
+			want: "= 1 1 one\n- 2 0 two\n+ 0 2 Two\n",
+		},
+		{
+			name: "No final newline",
+			a:    "one\ntwo",
+			b:    "one\ntwo\n",
+			want: "= 1 1 one\n= 2 2 two\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := script(Lines(tt.a, tt.b))
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "Both empty",
+			want: "",
+		},
+		{
+			name: "Identical",
+			a:    "one\ntwo\n",
+			b:    "one\ntwo\n",
+			want: "",
+		},
+		{
+			name: "CRLF and LF",
+			a:    "one\r\ntwo\r\n",
+			b:    "one\ntwo\n",
+			want: "",
+		},
+		{
+			name: "Old empty",
+			b:    "one\ntwo\n",
+			want: "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+one\n+two\n",
+		},
+		{
+			name: "New empty",
+			a:    "one\ntwo\n",
+			want: "--- a\n+++ b\n@@ -1,2 +0,0 @@\n-one\n-two\n",
+		},
+		{
+			name: "Insertion",
+			a:    "one\nthree\n",
+			b:    "one\ntwo\nthree\n",
+			want: "--- a\n+++ b\n@@ -1,2 +1,3 @@\n one\n+two\n three\n",
+		},
+		{
+			name: "Deletion",
+			a:    "one\ntwo\nthree\n",
+			b:    "one\nthree\n",
+			want: "--- a\n+++ b\n@@ -1,3 +1,2 @@\n one\n-two\n three\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified("a", "b", tt.a, tt.b)
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHunks(t *testing.T) {
+	// Lines 1 to 20, with line 2 and line 18 changed: far enough apart,
+	// with three lines of context, to be separate hunks.
+	var a, b []string
+	for i := 1; i <= 20; i++ {
+		a = append(a, fmt.Sprint(i))
+		switch i {
+		case 2, 18:
+			b = append(b, fmt.Sprintf("%d changed", i))
+		default:
+			b = append(b, fmt.Sprint(i))
+		}
+	}
+
+	hunks := Hunks(Lines(strings.Join(a, "\n"), strings.Join(b, "\n")), 3)
+
+	want := []string{"@@ -1,5 +1,5 @@", "@@ -15,6 +15,6 @@"}
+	if len(hunks) != len(want) {
+		t.Fatalf("got %d hunks; want %d", len(hunks), len(want))
+	}
+	for i, h := range hunks {
+		if h.Header() != want[i] {
+			t.Errorf("got hunk %d header %q; want %q", i, h.Header(), want[i])
+		}
+	}
+
+	if hunks := Hunks(Lines("same\n", "same\n"), 3); hunks != nil {
+		t.Errorf("got %d hunks for identical texts; want none", len(hunks))
+	}
+}
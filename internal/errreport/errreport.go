@@ -0,0 +1,238 @@
+// Package errreport sends errors, with their stack traces and the request
+// they happened in, to Sentry or any other service which speaks its
+// protocol, like GlitchTip. Reports are sent in the background, so
+// reporting an error never holds up the response.
+//
+// Form fields, query parameters and headers which look like they hold a
+// password, token or other secret are replaced with "[Filtered]" before a
+// report leaves the process, and cookies are never sent. Secrets in the
+// request's path are filtered with Options.ScrubPath.
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	mrand "math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queueSize is how many reports can wait to be sent. Reports made while
+// the queue is full, like during an outage of the reporting service, are
+// dropped.
+const queueSize = 100
+
+// Options configure a Reporter.
+type Options struct {
+	// Environment and Release are attached to every report, so that errors
+	// can be told apart by where they happened and which version was
+	// running.
+	Environment string
+	Release     string
+	// SampleRate is the fraction of reports which are sent, from 0 to 1.
+	SampleRate float64
+	// ErrorLog is where problems sending reports are logged.
+	ErrorLog *log.Logger
+	// ScrubPath, if set, is called with the path of each request before
+	// it's reported, to filter out secrets which the application keeps in
+	// its URLs.
+	ScrubPath func(path string) string
+}
+
+// Reporter sends reports to a Sentry-compatible service. A nil *Reporter
+// is valid and drops every report, so callers don't need to check whether
+// reporting is turned on.
+type Reporter struct {
+	endpoint string
+	auth     string
+	opts     Options
+	client   *http.Client
+	server   string
+
+	// mu stops reports being queued while the queue is being closed.
+	mu     sync.RWMutex
+	closed bool
+	queue  chan []byte
+	done   chan struct{}
+}
+
+// New returns a Reporter which sends to the project in dsn, which looks
+// like https://PUBLIC_KEY@sentry.example.com/PROJECT_ID, and starts sending
+// reports in the background.
+func New(dsn string, opts Options) (*Reporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("errreport: invalid DSN: %w", err)
+	}
+
+	key := u.User.Username()
+	// Sentry can be served under a path, which goes before /api.
+	path, project := "", strings.TrimSuffix(u.Path, "/")
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		path, project = project[:i], project[i+1:]
+	}
+	if u.Scheme == "" || u.Host == "" || key == "" || project == "" {
+		return nil, errors.New("errreport: invalid DSN: want https://KEY@HOST/PROJECT")
+	}
+
+	if opts.ErrorLog == nil {
+		opts.ErrorLog = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	server, _ := os.Hostname()
+
+	rp := &Reporter{
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path, project),
+		auth:     fmt.Sprintf("Sentry sentry_version=7, sentry_client=snippetbox-errreport/1.0, sentry_key=%s", key),
+		opts:     opts,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		server:   server,
+		queue:    make(chan []byte, queueSize),
+		done:     make(chan struct{}),
+	}
+	go rp.sendLoop()
+
+	return rp, nil
+}
+
+// Report is an error to send.
+type Report struct {
+	Err error
+	// Level is "error" or "fatal"; panics are fatal.
+	Level string
+	// Stack holds the program counters of the stack where the error
+	// happened, from Callers.
+	Stack []uintptr
+	// Request is the request the error happened in, if any.
+	Request *http.Request
+	// User is the user who made the request, if they're logged in.
+	User *User
+	// ClientIP is the address of the client which made the request.
+	ClientIP string
+}
+
+// User identifies the user an error happened to.
+type User struct {
+	ID       string
+	Username string
+}
+
+// Send queues a report to be sent, subject to the sample rate. It never
+// blocks.
+func (rp *Reporter) Send(rep Report) {
+	if rp == nil {
+		return
+	}
+	if rp.opts.SampleRate < 1 && mrand.Float64() >= rp.opts.SampleRate {
+		return
+	}
+
+	body, err := rp.envelope(rep)
+	if err != nil {
+		rp.opts.ErrorLog.Printf("errreport: %v", err)
+		return
+	}
+
+	rp.mu.RLock()
+	defer rp.mu.RUnlock()
+
+	if rp.closed {
+		return
+	}
+
+	select {
+	case rp.queue <- body:
+	default:
+		rp.opts.ErrorLog.Print("errreport: queue full, dropping report")
+	}
+}
+
+// Close stops the Reporter once the reports in the queue have been sent,
+// or ctx is done.
+func (rp *Reporter) Close(ctx context.Context) error {
+	if rp == nil {
+		return nil
+	}
+
+	rp.mu.Lock()
+	if !rp.closed {
+		rp.closed = true
+		close(rp.queue)
+	}
+	rp.mu.Unlock()
+
+	select {
+	case <-rp.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("errreport: %w", ctx.Err())
+	}
+}
+
+func (rp *Reporter) sendLoop() {
+	defer close(rp.done)
+
+	for body := range rp.queue {
+		if err := rp.post(body); err != nil {
+			rp.opts.ErrorLog.Printf("errreport: %v", err)
+		}
+	}
+}
+
+func (rp *Reporter) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, rp.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", rp.auth)
+
+	resp, err := rp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("sending report: %s", resp.Status)
+	}
+	return nil
+}
+
+// envelope encodes a report as a Sentry envelope with a single event.
+func (rp *Reporter) envelope(rep Report) ([]byte, error) {
+	ev := rp.event(rep)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+
+	header := map[string]string{"event_id": ev.EventID, "sent_at": time.Now().UTC().Format(time.RFC3339)}
+	if err := enc.Encode(header); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(map[string]string{"type": "event"}); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(ev); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// eventID returns a random ID for an event: a UUID without the dashes.
+func eventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
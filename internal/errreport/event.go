@@ -0,0 +1,278 @@
+package errreport
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// filtered replaces the values of sensitive fields.
+const filtered = "[Filtered]"
+
+// sensitiveWords are the parts of form field, query parameter and header
+// names which mark their values as secret.
+var sensitiveWords = []string{
+	"password", "passphrase", "passwd", "secret", "token", "csrf", "auth",
+	"key", "session", "cookie", "otp", "totp", "credit", "card",
+}
+
+// sensitive reports whether a field with this name might hold a secret.
+func sensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range sensitiveWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// mainModule is the module path of the program, used to mark which stack
+// frames are its own code rather than the standard library's or a
+// dependency's.
+var mainModule = func() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Path
+	}
+	return ""
+}()
+
+// Callers returns the program counters of the calling goroutine's stack,
+// for Report.Stack. The argument skip is the number of frames to leave out,
+// with 0 starting at the caller of Callers.
+func Callers(skip int) []uintptr {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	return pcs[:n]
+}
+
+// event is an error event in Sentry's event payload format. It and the
+// types below only include the fields used here.
+type event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Exception   eventExceptions   `json:"exception"`
+	Request     *eventRequest     `json:"request,omitempty"`
+	User        *eventUser        `json:"user,omitempty"`
+	Contexts    map[string]any    `json:"contexts,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+type eventExceptions struct {
+	Values []eventException `json:"values"`
+}
+
+type eventException struct {
+	Type       string           `json:"type"`
+	Value      string           `json:"value"`
+	Stacktrace *eventStacktrace `json:"stacktrace,omitempty"`
+}
+
+type eventStacktrace struct {
+	Frames []eventFrame `json:"frames"`
+}
+
+type eventFrame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type eventRequest struct {
+	URL         string            `json:"url"`
+	Method      string            `json:"method"`
+	QueryString string            `json:"query_string,omitempty"`
+	Data        map[string]string `json:"data,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+}
+
+type eventUser struct {
+	ID        string `json:"id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	IPAddress string `json:"ip_address,omitempty"`
+}
+
+// event builds the event for a report.
+func (rp *Reporter) event(rep Report) *event {
+	level := rep.Level
+	if level == "" {
+		level = "error"
+	}
+
+	ev := &event{
+		EventID:     eventID(),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+		Platform:    "go",
+		Level:       level,
+		ServerName:  rp.server,
+		Release:     rp.opts.Release,
+		Environment: rp.opts.Environment,
+		Exception: eventExceptions{Values: []eventException{{
+			Type:       errorType(rep.Err),
+			Value:      rep.Err.Error(),
+			Stacktrace: stacktrace(rep.Stack),
+		}}},
+		Contexts: map[string]any{
+			"runtime": map[string]string{"name": "go", "version": runtime.Version()},
+		},
+	}
+
+	if rep.Request != nil {
+		ev.Request = request(rep.Request, rep.ClientIP, rp.opts.ScrubPath)
+		if rep.Request.Pattern != "" {
+			ev.Tags = map[string]string{"route": rep.Request.Pattern}
+		}
+	}
+	if rep.User != nil || rep.ClientIP != "" {
+		ev.User = &eventUser{IPAddress: rep.ClientIP}
+		if rep.User != nil {
+			ev.User.ID, ev.User.Username = rep.User.ID, rep.User.Username
+		}
+	}
+
+	return ev
+}
+
+// errorType names the type of the innermost wrapped error, which says more
+// about what went wrong than the *fmt.wrapError around it.
+func errorType(err error) string {
+	for {
+		next := errors.Unwrap(err)
+		if next == nil {
+			return fmt.Sprintf("%T", err)
+		}
+		err = next
+	}
+}
+
+// stacktrace turns program counters into frames, oldest first as Sentry
+// expects.
+func stacktrace(pcs []uintptr) *eventStacktrace {
+	if len(pcs) == 0 {
+		return nil
+	}
+
+	var frames []eventFrame
+	iter := runtime.CallersFrames(pcs)
+	for {
+		f, more := iter.Next()
+
+		module, function := splitFunction(f.Function)
+		frames = append(frames, eventFrame{
+			Function: function,
+			Module:   module,
+			Filename: trimPath(f.File),
+			AbsPath:  f.File,
+			Lineno:   f.Line,
+			InApp:    module == "main" || (mainModule != "" && strings.HasPrefix(module, mainModule)),
+		})
+
+		if !more {
+			break
+		}
+	}
+
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+
+	return &eventStacktrace{Frames: frames}
+}
+
+// splitFunction splits a function name like
+// "snippetbox.floccinau.net/internal/models.(*SnippetModel).Get" into its
+// package path and the rest.
+func splitFunction(name string) (module, function string) {
+	slash := strings.LastIndex(name, "/") + 1
+	dot := strings.Index(name[slash:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	return name[:slash+dot], name[slash+dot+1:]
+}
+
+// trimPath shortens a file path to its last two elements, like
+// "web/handlers.go", for showing in the stack trace.
+func trimPath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return path
+	}
+	if j := strings.LastIndex(path[:i], "/"); j >= 0 {
+		return path[j+1:]
+	}
+	return path
+}
+
+// request describes a request, with its secrets filtered out, including
+// those in its path if there's a scrubPath function. Only form values which
+// the handler already parsed are included; the body isn't read again.
+func request(r *http.Request, clientIP string, scrubPath func(string) string) *eventRequest {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	path := r.URL.Path
+	if scrubPath != nil {
+		path = scrubPath(path)
+	}
+
+	er := &eventRequest{
+		URL:         scheme + "://" + r.Host + path,
+		Method:      r.Method,
+		QueryString: scrubValues(r.URL.Query()).Encode(),
+		Headers:     make(map[string]string),
+	}
+
+	for name, values := range r.Header {
+		switch {
+		case name == "Cookie":
+			continue
+		case sensitive(name):
+			er.Headers[name] = filtered
+		default:
+			er.Headers[name] = strings.Join(values, ", ")
+		}
+	}
+
+	if len(r.PostForm) > 0 {
+		er.Data = make(map[string]string)
+		for name, values := range scrubValues(r.PostForm) {
+			er.Data[name] = strings.Join(values, ", ")
+		}
+	}
+
+	if clientIP != "" {
+		er.Env = map[string]string{"REMOTE_ADDR": clientIP}
+	}
+
+	return er
+}
+
+// scrubValues returns a copy of values with the sensitive ones filtered.
+func scrubValues(values url.Values) url.Values {
+	scrubbed := make(url.Values, len(values))
+	for name, v := range values {
+		if sensitive(name) {
+			scrubbed[name] = []string{filtered}
+			continue
+		}
+		scrubbed[name] = v
+	}
+	return scrubbed
+}
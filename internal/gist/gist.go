@@ -0,0 +1,199 @@
+// Package gist lists a user's gists through the GitHub REST API and fetches
+// the files in them.
+package gist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the address of the GitHub REST API.
+const DefaultBaseURL = "https://api.github.com"
+
+// perPage is how many gists are asked for in each page of a listing, the
+// most the API allows.
+const perPage = 100
+
+// ErrNotFound is returned when the GitHub user doesn't exist.
+var ErrNotFound = errors.New("gist: user not found")
+
+// ErrUnauthorized is returned when GitHub doesn't accept the token.
+var ErrUnauthorized = errors.New("gist: bad credentials")
+
+// RateLimitError is returned when GitHub's rate limit has been used up. The
+// request can be made again after Reset.
+type RateLimitError struct {
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("gist: rate limit exceeded until %s", e.Reset.Format(time.RFC3339))
+}
+
+// Gist is a gist, with the files in it.
+type Gist struct {
+	ID          string           `json:"id"`
+	Description string           `json:"description"`
+	Public      bool             `json:"public"`
+	Created     time.Time        `json:"created_at"`
+	Files       map[string]*File `json:"files"`
+}
+
+// File is one file of a gist. Listings don't include the content, which is
+// fetched from RawURL.
+type File struct {
+	Filename string `json:"filename"`
+	Language string `json:"language"`
+	RawURL   string `json:"raw_url"`
+	Size     int64  `json:"size"`
+}
+
+// Client talks to the GitHub API. Without a token it's limited to 60
+// requests an hour from each IP address; with one, to 5,000.
+type Client struct {
+	// BaseURL is the address of the API. The default is DefaultBaseURL.
+	BaseURL string
+	// Token is an OAuth or personal access token, which is optional.
+	Token string
+	// HTTPClient makes the requests. The default has a 30 second timeout.
+	HTTPClient *http.Client
+}
+
+func (c *Client) baseURL() string {
+	if c.BaseURL == "" {
+		return DefaultBaseURL
+	}
+	return strings.TrimSuffix(c.BaseURL, "/")
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return &http.Client{Timeout: 30 * time.Second}
+	}
+	return c.HTTPClient
+}
+
+// List returns all the public gists of the GitHub user, oldest first. If
+// username is empty, it returns the public gists of the user the token
+// belongs to.
+func (c *Client) List(ctx context.Context, username string) ([]*Gist, error) {
+	path := "/gists"
+	if username != "" {
+		path = "/users/" + url.PathEscape(username) + "/gists"
+	} else if c.Token == "" {
+		return nil, errors.New("gist: a username or token is needed")
+	}
+
+	var gists []*Gist
+	for page := 1; ; page++ {
+		var batch []*Gist
+		err := c.get(ctx, fmt.Sprintf("%s%s?per_page=%d&page=%d", c.baseURL(), path, perPage, page), &batch)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, g := range batch {
+			// The gists of the token's own user include their secret ones.
+			if g.Public {
+				gists = append(gists, g)
+			}
+		}
+
+		if len(batch) < perPage {
+			break
+		}
+	}
+
+	// GitHub lists the newest first.
+	for i, j := 0, len(gists)-1; i < j; i, j = i+1, j-1 {
+		gists[i], gists[j] = gists[j], gists[i]
+	}
+
+	return gists, nil
+}
+
+// Content fetches the content of a file, reading at most max bytes. It
+// returns false if the file is bigger than that.
+func (c *Client) Content(ctx context.Context, f *File, max int64) (string, bool, error) {
+	if f.Size > max {
+		return "", false, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.RawURL, nil)
+	if err != nil {
+		return "", false, err
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("gist: fetching %s: %s", f.Filename, resp.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return "", false, err
+	}
+	if int64(len(b)) > max {
+		return "", false, nil
+	}
+
+	return string(b), true, nil
+}
+
+// get fetches an API URL and decodes the JSON response into v.
+func (c *Client) get(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return json.NewDecoder(resp.Body).Decode(v)
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests) &&
+		(resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != ""):
+		return &RateLimitError{Reset: rateLimitReset(resp.Header)}
+	}
+
+	return fmt.Errorf("gist: %s", resp.Status)
+}
+
+// rateLimitReset works out when a rate limit ends from the Retry-After or
+// X-RateLimit-Reset header, or else waits a minute as GitHub advises.
+func rateLimitReset(h http.Header) time.Time {
+	if secs, err := strconv.Atoi(h.Get("Retry-After")); err == nil {
+		return time.Now().Add(time.Duration(secs) * time.Second)
+	}
+	if epoch, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		return time.Unix(epoch, 0)
+	}
+	return time.Now().Add(time.Minute)
+}
@@ -0,0 +1,137 @@
+// Package highlight does a rough, language-agnostic syntax highlighting of
+// code: comments, string literals, numbers and keywords which are common to
+// most popular languages. Snippets don't always say which language they're
+// written in, and it's only meant to make them easier to read, so being
+// occasionally wrong doesn't matter much.
+package highlight
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Kind is the kind of text a Token holds.
+type Kind int
+
+const (
+	Plain Kind = iota
+	Comment
+	String
+	Number
+	Keyword
+)
+
+// String returns the name of the kind, like "comment", which is used as a
+// CSS class.
+func (k Kind) String() string {
+	switch k {
+	case Comment:
+		return "comment"
+	case String:
+		return "string"
+	case Number:
+		return "number"
+	case Keyword:
+		return "keyword"
+	}
+	return "plain"
+}
+
+// Token is a run of text of a single kind.
+type Token struct {
+	Text string
+	Kind Kind
+}
+
+// keywords are highlighted in any language. It's a list of words which are
+// keywords in most of the popular ones.
+var keywords = map[string]bool{
+	"break": true, "case": true, "class": true, "const": true, "continue": true,
+	"def": true, "default": true, "defer": true, "do": true, "else": true,
+	"elif": true, "enum": true, "export": true, "false": true, "fn": true,
+	"for": true, "from": true, "func": true, "function": true, "go": true,
+	"if": true, "impl": true, "import": true, "in": true, "interface": true,
+	"let": true, "map": true, "match": true, "mut": true, "new": true,
+	"nil": true, "None": true, "null": true, "package": true, "pub": true,
+	"range": true, "return": true, "select": true, "self": true, "static": true,
+	"struct": true, "switch": true, "this": true, "true": true, "True": true,
+	"False": true, "try": true, "catch": true, "type": true, "use": true,
+	"var": true, "while": true, "with": true, "yield": true, "async": true,
+	"await": true, "lambda": true, "public": true, "private": true,
+}
+
+// Line splits a line into tokens. Anything it doesn't recognise is Plain.
+func Line(line string) []Token {
+	var tokens []Token
+	var plain strings.Builder
+
+	emit := func(text string, kind Kind) {
+		if plain.Len() > 0 {
+			tokens = append(tokens, Token{plain.String(), Plain})
+			plain.Reset()
+		}
+		tokens = append(tokens, Token{text, kind})
+	}
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		rest := string(runes[i:])
+
+		switch {
+		// Line comments run to the end of the line.
+		case strings.HasPrefix(rest, "//") || strings.HasPrefix(rest, "--") ||
+			(r == '#' && (i == 0 || unicode.IsSpace(runes[i-1]))):
+			emit(rest, Comment)
+			i = len(runes)
+
+		// Strings run to the matching quote, skipping escaped characters.
+		// An unterminated string runs to the end of the line.
+		case r == '"' || r == '\'' || r == '`':
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(runes))
+			emit(string(runes[i:j]), String)
+			i = j
+
+		case unicode.IsDigit(r) && (i == 0 || !isWordRune(runes[i-1])):
+			j := i
+			for j < len(runes) && (isWordRune(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			emit(string(runes[i:j]), Number)
+			i = j
+
+		case isWordRune(r):
+			j := i
+			for j < len(runes) && isWordRune(runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+			if keywords[word] {
+				emit(word, Keyword)
+			} else {
+				plain.WriteString(word)
+			}
+			i = j
+
+		default:
+			plain.WriteRune(r)
+			i++
+		}
+	}
+
+	if plain.Len() > 0 {
+		tokens = append(tokens, Token{plain.String(), Plain})
+	}
+	return tokens
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
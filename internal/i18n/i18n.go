@@ -0,0 +1,112 @@
+// Package i18n translates the user interface. Messages are written in
+// English in the templates and handlers, and the English text is the key
+// into each other language's catalog, so a message which hasn't been
+// translated yet is shown in English.
+//
+// The catalogs are JSON files in the locales directory, embedded into the
+// binary and named by language tag (like es.json). Each holds the language's
+// name, in that language, and its messages:
+//
+//	{
+//		"name": "Español",
+//		"messages": {
+//			"Create snippet": "Crear fragmento",
+//			"Created %s": "Creado %s"
+//		}
+//	}
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+//go:embed locales/*.json
+var localesFS embed.FS
+
+// Source is the language which messages are written in.
+const Source = "en"
+
+// Language is a language the interface can be shown in.
+type Language struct {
+	Tag  string
+	Name string
+}
+
+type catalog struct {
+	Name     string            `json:"name"`
+	Messages map[string]string `json:"messages"`
+}
+
+var (
+	catalogs  = map[string]*catalog{Source: {Name: "English"}}
+	languages []Language
+	matcher   language.Matcher
+)
+
+// The catalogs are part of the binary, so a broken one is a bug which
+// should stop the program from starting at all.
+func init() {
+	tags := []language.Tag{language.MustParse(Source)}
+	languages = []Language{{Tag: Source, Name: catalogs[Source].Name}}
+
+	files, err := localesFS.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, f := range files {
+		data, err := localesFS.ReadFile(path.Join("locales", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+
+		c := &catalog{}
+		if err := json.Unmarshal(data, c); err != nil {
+			panic(fmt.Sprintf("i18n: %s: %v", f.Name(), err))
+		}
+
+		tag := language.MustParse(strings.TrimSuffix(f.Name(), ".json"))
+		catalogs[tag.String()] = c
+		tags = append(tags, tag)
+		languages = append(languages, Language{Tag: tag.String(), Name: c.Name})
+	}
+
+	matcher = language.NewMatcher(tags)
+}
+
+// Languages returns the languages the interface can be shown in, English
+// first.
+func Languages() []Language {
+	return languages
+}
+
+// Match picks the best supported language for a visitor. Each preference is
+// either a single language tag, like one chosen from a menu, or the value of
+// an Accept-Language header; earlier preferences win. It falls back to
+// English.
+func Match(preferences ...string) string {
+	_, i := language.MatchStrings(matcher, preferences...)
+	return languages[i].Tag
+}
+
+// Translate returns msg in the given language, or in English if there's no
+// translation. If there are any args, the message is used as a format for
+// fmt.Sprintf.
+func Translate(lang, msg string, args ...any) string {
+	if c, ok := catalogs[lang]; ok {
+		if t := c.Messages[msg]; t != "" {
+			msg = t
+		}
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
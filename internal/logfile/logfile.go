@@ -0,0 +1,201 @@
+// Package logfile writes logs to a file which is rotated when it gets too
+// big or too old. Rotated files are kept next to the log with the time they
+// were rotated in their name, like info-20260102T150405.000.log, and the
+// oldest are removed once there are too many of them or they're too old.
+//
+// A File can also be reopened, for when an external tool like logrotate
+// has moved it out of the way.
+package logfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the format of the time in the names of rotated files.
+// It sorts in time order, and has milliseconds so that two rotations in the
+// same second don't clash.
+const backupTimeFormat = "20060102T150405.000"
+
+// Options say when a log file is rotated and how many rotated files are
+// kept. The zero value never rotates.
+type Options struct {
+	// MaxSize is the size in bytes at which the file is rotated.
+	MaxSize int64
+	// Interval rotates the file when the clock passes a multiple of it,
+	// counted from the zero time in UTC: 24 hours rotates at midnight UTC.
+	Interval time.Duration
+	// MaxBackups is the most rotated files to keep.
+	MaxBackups int
+	// MaxAge is how long rotated files are kept.
+	MaxAge time.Duration
+}
+
+// File is a log file which rotates itself. It's safe for concurrent use,
+// so it can be shared by several loggers.
+type File struct {
+	path string
+	opts Options
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+// Open opens the log file at path for appending, creating it if it doesn't
+// exist.
+func Open(path string, opts Options) (*File, error) {
+	lf := &File{path: path, opts: opts}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+func (lf *File) open() error {
+	f, err := os.OpenFile(lf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	// A log which was carried on from before counts as opened when it was
+	// last written to, so that a restart doesn't put off its rotation.
+	lf.f, lf.size, lf.opened = f, info.Size(), time.Now()
+	if info.Size() > 0 {
+		lf.opened = info.ModTime()
+	}
+	return nil
+}
+
+// Write appends p to the file, first rotating it if it's due.
+func (lf *File) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if lf.due(len(p)) {
+		// If the file can't be rotated, carry on writing to the old one
+		// rather than losing the log.
+		if err := lf.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "logfile: %v\n", err)
+		}
+	}
+
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+// due reports whether the file should be rotated before n more bytes are
+// written to it.
+func (lf *File) due(n int) bool {
+	if lf.opts.MaxSize > 0 && lf.size > 0 && lf.size+int64(n) > lf.opts.MaxSize {
+		return true
+	}
+	if d := lf.opts.Interval; d > 0 && !time.Now().Truncate(d).Equal(lf.opened.Truncate(d)) {
+		return true
+	}
+	return false
+}
+
+// Rotate moves the file aside and starts a new one.
+func (lf *File) Rotate() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	return lf.rotate()
+}
+
+func (lf *File) rotate() error {
+	ext := filepath.Ext(lf.path)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(lf.path, ext), time.Now().UTC().Format(backupTimeFormat), ext)
+
+	if err := os.Rename(lf.path, backup); err != nil {
+		return err
+	}
+
+	old := lf.f
+	if err := lf.open(); err != nil {
+		// Keep the old file, which is now the backup, so nothing is lost.
+		return err
+	}
+	old.Close()
+
+	return lf.prune()
+}
+
+// prune removes the rotated files which are beyond MaxBackups or older than
+// MaxAge.
+func (lf *File) prune() error {
+	if lf.opts.MaxBackups <= 0 && lf.opts.MaxAge <= 0 {
+		return nil
+	}
+
+	ext := filepath.Ext(lf.path)
+	prefix := strings.TrimSuffix(lf.path, ext) + "-"
+	matches, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return err
+	}
+
+	// Only files with a rotation time in their name are backups of this log,
+	// and not some other log with a similar name.
+	var backups []string
+	for _, name := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups = append(backups, name)
+		}
+	}
+
+	// Newest first.
+	slices.Sort(backups)
+	slices.Reverse(backups)
+
+	err = nil
+	for i, name := range backups {
+		remove := lf.opts.MaxBackups > 0 && i >= lf.opts.MaxBackups
+		if !remove && lf.opts.MaxAge > 0 {
+			info, statErr := os.Stat(name)
+			remove = statErr == nil && time.Since(info.ModTime()) > lf.opts.MaxAge
+		}
+		if remove {
+			err = errors.Join(err, os.Remove(name))
+		}
+	}
+
+	return err
+}
+
+// Reopen closes the file and opens the file at its path again, which is a
+// new file if the old one has been moved.
+func (lf *File) Reopen() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	old := lf.f
+	if err := lf.open(); err != nil {
+		return err
+	}
+	return old.Close()
+}
+
+// Close closes the file.
+func (lf *File) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	return lf.f.Close()
+}
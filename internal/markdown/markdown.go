@@ -0,0 +1,182 @@
+// Package markdown renders a small, safe subset of Markdown to HTML, for the
+// short pieces of prose people write on the site, like profile bios. It
+// understands paragraphs, headings, lists, block quotes, fenced code blocks,
+// inline code, **strong** and *emphasised* text and links. There's no raw
+// HTML: everything in the source is escaped, and links can only go to http,
+// https and mailto URLs.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	headingRX    = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	bulletRX     = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	numberRX     = regexp.MustCompile(`^\s*\d{1,9}[.)]\s+(.*)$`)
+	quoteRX      = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	fenceRX      = regexp.MustCompile("^\\s*(```|~~~)")
+	allowedURLRX = regexp.MustCompile(`(?i)^(https?://|mailto:)`)
+	escapableRX  = regexp.MustCompile("^\\\\[\\\\`*_{}\\[\\]()#+\\-.!>~]")
+	linkDestRX   = regexp.MustCompile(`^\(\s*([^\s()]+)\s*\)`)
+)
+
+// Render converts src to HTML.
+func Render(src string) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	var b strings.Builder
+	var para []string
+
+	flush := func() {
+		if len(para) > 0 {
+			b.WriteString("<p>" + inline(strings.Join(para, "\n")) + "</p>\n")
+			para = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+
+		case fenceRX.MatchString(line):
+			flush()
+			fence := fenceRX.FindStringSubmatch(line)[1]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+
+		case headingRX.MatchString(line):
+			flush()
+			m := headingRX.FindStringSubmatch(line)
+			level := string(rune('0' + len(m[1])))
+			b.WriteString("<h" + level + ">" + inline(m[2]) + "</h" + level + ">\n")
+
+		case bulletRX.MatchString(line), numberRX.MatchString(line):
+			flush()
+			rx, tag := bulletRX, "ul"
+			if !bulletRX.MatchString(line) {
+				rx, tag = numberRX, "ol"
+			}
+			b.WriteString("<" + tag + ">\n")
+			for ; i < len(lines) && rx.MatchString(lines[i]); i++ {
+				b.WriteString("<li>" + inline(rx.FindStringSubmatch(lines[i])[1]) + "</li>\n")
+			}
+			i--
+			b.WriteString("</" + tag + ">\n")
+
+		case quoteRX.MatchString(line):
+			flush()
+			var quote []string
+			for ; i < len(lines) && quoteRX.MatchString(lines[i]); i++ {
+				quote = append(quote, quoteRX.FindStringSubmatch(lines[i])[1])
+			}
+			i--
+			b.WriteString("<blockquote>" + Render(strings.Join(quote, "\n")) + "</blockquote>\n")
+
+		default:
+			para = append(para, strings.TrimSpace(line))
+		}
+	}
+	flush()
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// inline renders the inline markup within a block: code spans, strong and
+// emphasised text, links and backslash escapes. Anything else is escaped
+// and passed through.
+func inline(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); {
+		rest := s[i:]
+
+		// Like in CommonMark, a * in the middle of a word, as in 2*3,
+		// doesn't start emphasis.
+		canOpen := i == 0 || !isAlnum(s[i-1])
+
+		switch {
+		case escapableRX.MatchString(rest):
+			b.WriteString(html.EscapeString(rest[1:2]))
+			i += 2
+			continue
+
+		case rest[0] == '`':
+			if j := strings.IndexByte(rest[1:], '`'); j >= 0 {
+				b.WriteString("<code>" + html.EscapeString(rest[1:1+j]) + "</code>")
+				i += j + 2
+				continue
+			}
+
+		case strings.HasPrefix(rest, "**") && canOpen:
+			if j := closing(rest[2:], "**"); j > 0 && rest[2] != ' ' {
+				b.WriteString("<strong>" + inline(rest[2:2+j]) + "</strong>")
+				i += j + 4
+				continue
+			}
+
+		case rest[0] == '*' && canOpen:
+			if j := closing(rest[1:], "*"); j > 0 && rest[1] != ' ' {
+				b.WriteString("<em>" + inline(rest[1:1+j]) + "</em>")
+				i += j + 2
+				continue
+			}
+
+		case rest[0] == '[':
+			if text, dest, n, ok := link(rest); ok {
+				b.WriteString(`<a href="` + html.EscapeString(dest) + `" rel="nofollow ugc">` + inline(text) + "</a>")
+				i += n
+				continue
+			}
+		}
+
+		b.WriteString(html.EscapeString(rest[:1]))
+		i++
+	}
+
+	return b.String()
+}
+
+// closing returns the index of the delimiter which closes a span of
+// emphasis in s, or -1 if there isn't one. Escaped delimiters don't count,
+// and nor do ones after a space, which can't close a span.
+func closing(s, delim string) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case strings.HasPrefix(s[i:], delim) && i > 0 && s[i-1] != ' ':
+			return i
+		}
+	}
+	return -1
+}
+
+// link parses a [text](destination) link at the start of s, returning its
+// parts and its length. Links to anything but http, https and mailto URLs
+// aren't treated as links, so a javascript: URL can't be slipped in.
+func link(s string) (text, dest string, n int, ok bool) {
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return "", "", 0, false
+	}
+
+	m := linkDestRX.FindStringSubmatch(s[end+1:])
+	if m == nil || !allowedURLRX.MatchString(m[1]) {
+		return "", "", 0, false
+	}
+
+	return s[1:end], m[1], end + 1 + len(m[0]), true
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
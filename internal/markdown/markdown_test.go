@@ -0,0 +1,203 @@
+package markdown
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "Paragraphs",
+			src:  "One\ntwo\n\nThree",
+			want: "<p>One\ntwo</p>\n<p>Three</p>",
+		},
+		{
+			name: "Windows line endings",
+			src:  "One\r\n\r\nTwo",
+			want: "<p>One</p>\n<p>Two</p>",
+		},
+		{
+			name: "Heading",
+			src:  "## Hello *there* ##",
+			want: "<h2>Hello <em>there</em></h2>",
+		},
+		{
+			name: "Bullet list",
+			src:  "- one\n* two\n\nAfter",
+			want: "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n<p>After</p>",
+		},
+		{
+			name: "Numbered list",
+			src:  "1. one\n2) two",
+			want: "<ol>\n<li>one</li>\n<li>two</li>\n</ol>",
+		},
+		{
+			name: "Block quote",
+			src:  "> quoted\n> **text**",
+			want: "<blockquote><p>quoted\n<strong>text</strong></p></blockquote>",
+		},
+		{
+			name: "Fenced code",
+			src:  "```\n<b>&amp;</b>\n**not strong**\n```",
+			want: "<pre><code>&lt;b&gt;&amp;amp;&lt;/b&gt;\n**not strong**</code></pre>",
+		},
+		{
+			name: "Unclosed fence",
+			src:  "~~~\ncode",
+			want: "<pre><code>code</code></pre>",
+		},
+		{
+			name: "Inline code",
+			src:  "Run `rm -rf <dir>` *now*",
+			want: "<p>Run <code>rm -rf &lt;dir&gt;</code> <em>now</em></p>",
+		},
+		{
+			name: "Strong and emphasis",
+			src:  "**bold** and *italic* but 2*3*4",
+			want: "<p><strong>bold</strong> and <em>italic</em> but 2*3*4</p>",
+		},
+		{
+			name: "Unclosed emphasis",
+			src:  "**open and * alone",
+			want: "<p>**open and * alone</p>",
+		},
+		{
+			name: "Backslash escapes",
+			src:  `\*not emphasis\* and \[not a link\]`,
+			want: "<p>*not emphasis* and [not a link]</p>",
+		},
+		{
+			name: "Link",
+			src:  "[Go](https://go.dev/doc)",
+			want: `<p><a href="https://go.dev/doc" rel="nofollow ugc">Go</a></p>`,
+		},
+		{
+			name: "Mailto link",
+			src:  "[mail](mailto:alice@example.com)",
+			want: `<p><a href="mailto:alice@example.com" rel="nofollow ugc">mail</a></p>`,
+		},
+		{
+			name: "Link with emphasis",
+			src:  "[*Go*](http://go.dev)",
+			want: `<p><a href="http://go.dev" rel="nofollow ugc"><em>Go</em></a></p>`,
+		},
+
+		// Everything below tries to get markup or script into the page.
+		{
+			name: "Raw HTML",
+			src:  "<script>alert(1)</script>",
+			want: "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>",
+		},
+		{
+			name: "Raw HTML in heading",
+			src:  "# <img src=x onerror=alert(1)>",
+			want: "<h1>&lt;img src=x onerror=alert(1)&gt;</h1>",
+		},
+		{
+			name: "Raw HTML in list",
+			src:  "- <iframe src='https://evil.example.com'>",
+			want: "<ul>\n<li>&lt;iframe src=&#39;https://evil.example.com&#39;&gt;</li>\n</ul>",
+		},
+		{
+			name: "Entities",
+			src:  "&lt;script&gt; &amp; &#x3C;",
+			want: "<p>&amp;lt;script&amp;gt; &amp;amp; &amp;#x3C;</p>",
+		},
+		{
+			name: "JavaScript link",
+			src:  "[click](javascript:alert(1))",
+			want: "<p>[click](javascript:alert(1))</p>",
+		},
+		{
+			name: "JavaScript link in capitals",
+			src:  "[click](JAVASCRIPT:alert(1))",
+			want: "<p>[click](JAVASCRIPT:alert(1))</p>",
+		},
+		{
+			name: "JavaScript link with leading space",
+			src:  "[click]( javascript:alert(1))",
+			want: "<p>[click]( javascript:alert(1))</p>",
+		},
+		{
+			name: "Data link",
+			src:  "[click](data:text/html,<script>alert(1)</script>)",
+			want: "<p>[click](data:text/html,&lt;script&gt;alert(1)&lt;/script&gt;)</p>",
+		},
+		{
+			name: "Relative link",
+			src:  "[click](/user/logout)",
+			want: "<p>[click](/user/logout)</p>",
+		},
+		{
+			name: "JavaScript link nested in text",
+			src:  "[a [b](javascript:x)](https://ok.example.com)",
+			want: "<p>[a [b](javascript:x)](https://ok.example.com)</p>",
+		},
+		{
+			name: "Double quote in link",
+			src:  `[x](https://example.com/"onmouseover="alert(1))`,
+			want: `<p>[x](https://example.com/&#34;onmouseover=&#34;alert(1))</p>`,
+		},
+		{
+			name: "Single quote in link",
+			src:  `[x](https://example.com/'onmouseover='alert)`,
+			want: `<p><a href="https://example.com/&#39;onmouseover=&#39;alert" rel="nofollow ugc">x</a></p>`,
+		},
+		{
+			name: "Angle brackets in link",
+			src:  `[x](https://example.com/"><script>alert</script>)`,
+			want: `<p><a href="https://example.com/&#34;&gt;&lt;script&gt;alert&lt;/script&gt;" rel="nofollow ugc">x</a></p>`,
+		},
+		{
+			name: "HTML in link text",
+			src:  `[<b onclick="x">hi</b>](https://example.com)`,
+			want: `<p><a href="https://example.com" rel="nofollow ugc">&lt;b onclick=&#34;x&#34;&gt;hi&lt;/b&gt;</a></p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.src); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// allowedTagRX matches the tags which Render writes. Every < in its output
+// must start one of them; anything else would be markup from the source.
+var allowedTagRX = regexp.MustCompile(`^(</?(p|h[1-6]|ul|ol|li|blockquote|pre|code|strong|em|a)>|<a href="(https?://|mailto:)[^"<>]*" rel="nofollow ugc">)`)
+
+// TestRenderNoRawTags checks that no tags but the ones Render writes itself
+// come out of it, whatever the input looks like.
+func TestRenderNoRawTags(t *testing.T) {
+	inputs := []string{
+		"<script>alert(1)</script>",
+		"**<script>**",
+		"`</code><script>`",
+		"> <svg onload=alert(1)>",
+		"1. <a href='javascript:alert(1)'>x</a>",
+		"[<script>](https://example.com)",
+		`[x](https://example.com"onclick="alert)`,
+		"[x](https://example.com\"><img src=x>)",
+		"```\n</code></pre><script>alert(1)</script>\n```",
+		"\\<script>",
+		"# </h1><script>",
+		"*</em><script>*",
+	}
+
+	for _, src := range inputs {
+		got := Render(src)
+		for i := range len(got) {
+			if got[i] == '<' && !allowedTagRX.MatchString(got[i:]) {
+				t.Errorf("Render(%q) = %q, which has raw markup at %d", src, got, i)
+				break
+			}
+		}
+	}
+}
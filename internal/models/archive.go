@@ -0,0 +1,68 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// ByMonth returns the page that k picks out of the unexpired snippets created
+// in a month (in UTC), newest first. Snippets belonging to organizations
+// aren't included.
+func (m *SnippetModel) ByMonth(ctx context.Context, year int, month time.Month, k Keyset) (CursorPage, error) {
+	start := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	return m.listKeyset(ctx, `snippets.created >= ? AND snippets.created < ? AND snippets.org_id IS NULL`, []any{start, end}, k)
+}
+
+// ByLanguage returns the page that k picks out of the unexpired snippets in a
+// language, newest first. Snippets belonging to organizations aren't
+// included.
+func (m *SnippetModel) ByLanguage(ctx context.Context, language string, k Keyset) (CursorPage, error) {
+	return m.listKeyset(ctx, `snippets.language = ? AND snippets.org_id IS NULL`, []any{language}, k)
+}
+
+// ByOrg returns one page of the unexpired snippets belonging to an
+// organization, newest first, along with how many such snippets there are.
+// Pages are numbered from 1.
+func (m *SnippetModel) ByOrg(ctx context.Context, orgID, page, pageSize int) ([]*Snippet, int, error) {
+	return m.listPage(ctx, `snippets.org_id = ?`, []any{orgID}, page, pageSize)
+}
+
+// listPage returns one page of the unexpired, visible snippets which match
+// the where clause, newest first, along with how many there are.
+func (m *SnippetModel) listPage(ctx context.Context, where string, args []any, page, pageSize int) ([]*Snippet, int, error) {
+	stmt := `SELECT COUNT(*) OVER(), ` + snippetColumns + `
+	FROM snippets
+	WHERE ` + where + ` AND snippets.expires > NOW() AND snippets.held_reason IS NULL
+	AND snippets.publish_at <= UTC_TIMESTAMP()
+	ORDER BY snippets.created DESC, snippets.id DESC
+	LIMIT ? OFFSET ?`
+
+	rows, err := retrying(m.DB).QueryContext(ctx, stmt, append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var snippets []*Snippet
+	total := 0
+
+	for rows.Next() {
+		s, err := scanSnippet(countingScanner{rows, &total}, m.Keys)
+		if err != nil {
+			return nil, 0, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	if err = m.LoadTags(snippets...); err != nil {
+		return nil, 0, err
+	}
+
+	return snippets, total, nil
+}
@@ -0,0 +1,262 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// The states of an attachment's virus scan. Only clean attachments can be
+// downloaded.
+const (
+	ScanPending     = "pending"
+	ScanClean       = "clean"
+	ScanQuarantined = "quarantined"
+)
+
+// Define an Attachment type to hold the details of a file attached to a
+// snippet. The file itself is kept in blob storage under StorageKey.
+// Threat names what the virus scanner found in a quarantined attachment.
+type Attachment struct {
+	ID          int
+	SnippetID   int
+	UserID      int
+	Filename    string
+	ContentType string
+	Size        int64
+	StorageKey  string
+	ScanStatus  string
+	Threat      string
+	Created     time.Time
+}
+
+// attachmentColumns lists the columns which scanAttachment expects, in order.
+const attachmentColumns = `id, snippet_id, user_id, filename, content_type, size, storage_key, scan_status, threat, created`
+
+func scanAttachment(sc scanner) (*Attachment, error) {
+	a := &Attachment{}
+	var userID sql.NullInt64
+
+	err := sc.Scan(&a.ID, &a.SnippetID, &userID, &a.Filename, &a.ContentType, &a.Size, &a.StorageKey, &a.ScanStatus, &a.Threat, &a.Created)
+	if err != nil {
+		return nil, err
+	}
+
+	a.UserID = int(userID.Int64)
+
+	return a, nil
+}
+
+// Define an AttachmentModel type which wraps a database connection pool.
+type AttachmentModel struct {
+	DB *sql.DB
+}
+
+// Insert records a new attachment and returns its ID. The blob must already
+// have been stored under a.StorageKey. An empty ScanStatus counts as clean.
+func (m *AttachmentModel) Insert(a *Attachment) (int, error) {
+	stmt := `INSERT INTO attachments (snippet_id, user_id, filename, content_type, size, storage_key, scan_status, created)
+	VALUES(?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	owner := sql.NullInt64{Int64: int64(a.UserID), Valid: a.UserID != 0}
+
+	status := a.ScanStatus
+	if status == "" {
+		status = ScanClean
+	}
+
+	result, err := retrying(m.DB).Exec(stmt, a.SnippetID, owner, a.Filename, a.ContentType, a.Size, a.StorageKey, status)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Get returns an attachment of an unexpired snippet.
+func (m *AttachmentModel) Get(id int) (*Attachment, error) {
+	stmt := `SELECT ` + attachmentColumns + ` FROM attachments
+	WHERE id = ? AND snippet_id IN (SELECT id FROM snippets WHERE expires > NOW())`
+
+	a, err := scanAttachment(retrying(m.DB).QueryRow(stmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// ListBySnippet returns the attachments of a snippet, oldest first.
+func (m *AttachmentModel) ListBySnippet(snippetID int) ([]*Attachment, error) {
+	stmt := `SELECT ` + attachmentColumns + ` FROM attachments
+	WHERE snippet_id = ?
+	ORDER BY id`
+
+	rows, err := retrying(m.DB).Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []*Attachment{}
+
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// SetScanStatus records the outcome of an attachment's virus scan. Only a
+// pending attachment is changed, so a scan which finishes late can't undo a
+// moderator's decision; it returns ErrNoRecord if the attachment isn't
+// pending.
+func (m *AttachmentModel) SetScanStatus(id int, status, threat string) error {
+	stmt := `UPDATE attachments SET scan_status = ?, threat = ?
+	WHERE id = ? AND scan_status = ?`
+
+	return m.changeScanStatus(stmt, status, threat, id, ScanPending)
+}
+
+// Release clears a quarantined attachment, or one whose scan never
+// finished, so that it can be downloaded. It returns ErrNoRecord if the
+// attachment is already clean.
+func (m *AttachmentModel) Release(id int) error {
+	stmt := `UPDATE attachments SET scan_status = ?, threat = ''
+	WHERE id = ? AND scan_status <> ?`
+
+	return m.changeScanStatus(stmt, ScanClean, id, ScanClean)
+}
+
+func (m *AttachmentModel) changeScanStatus(stmt string, args ...any) error {
+	result, err := retrying(m.DB).Exec(stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// ListByScanStatus returns the attachments whose virus scan is in the given
+// state, oldest first.
+func (m *AttachmentModel) ListByScanStatus(status string, limit int) ([]*Attachment, error) {
+	stmt := `SELECT ` + attachmentColumns + ` FROM attachments
+	WHERE scan_status = ?
+	ORDER BY id LIMIT ?`
+
+	rows, err := retrying(m.DB).Query(stmt, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []*Attachment{}
+
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// Count returns how many attachments a snippet has.
+func (m *AttachmentModel) Count(snippetID int) (int, error) {
+	var n int
+	err := retrying(m.DB).QueryRow("SELECT COUNT(*) FROM attachments WHERE snippet_id = ?", snippetID).Scan(&n)
+	return n, err
+}
+
+// Delete removes an attachment's record. The caller is responsible for
+// deleting its blob.
+func (m *AttachmentModel) Delete(id int) error {
+	result, err := retrying(m.DB).Exec("DELETE FROM attachments WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// KnownKeys returns which of the given storage keys belong to an attachment
+// or to a user's avatar. Blobs whose keys aren't known are orphans: their
+// upload failed part way, their snippet has been deleted or the avatar has
+// been replaced.
+func (m *AttachmentModel) KnownKeys(keys []string) (map[string]bool, error) {
+	known := make(map[string]bool, len(keys))
+	if len(keys) == 0 {
+		return known, nil
+	}
+
+	// The keys are needed twice, once for each table.
+	args := make([]any, 0, 2*len(keys))
+	for range 2 {
+		for _, key := range keys {
+			args = append(args, key)
+		}
+	}
+
+	in := `IN (?` + strings.Repeat(", ?", len(keys)-1) + `)`
+	stmt := `SELECT storage_key FROM attachments WHERE storage_key ` + in + `
+	UNION SELECT avatar_key FROM users WHERE avatar_key ` + in
+
+	rows, err := retrying(m.DB).Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		known[key] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return known, nil
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Define constants for the events that we write to the audit log.
+const (
+	EventLoginSuccess = "login.success"
+	EventLoginFailure = "login.failure"
+	EventLoginLocked  = "login.locked"
+	EventLogout       = "logout"
+	EventSignup       = "signup"
+
+	EventLogoutBackchannel = "logout.backchannel"
+	EventRememberReused    = "remember.reused"
+	EventSessionRevoke     = "session.revoke"
+	EventSessionRevokeAll  = "session.revoke_all"
+
+	EventAccountDelete = "account.delete"
+	EventAccountExport = "account.export"
+	EventGistImport    = "import.gist"
+
+	EventTokenCreate = "token.create"
+	EventTokenRevoke = "token.revoke"
+
+	EventInviteCreate = "invite.create"
+	EventInviteRevoke = "invite.revoke"
+
+	EventOrgCreate       = "org.create"
+	EventOrgDelete       = "org.delete"
+	EventOrgMemberSet    = "org.member.set"
+	EventOrgMemberRemove = "org.member.remove"
+
+	EventModerationApprove = "moderation.approve"
+	EventModerationReject  = "moderation.reject"
+	EventModerationHide    = "moderation.hide"
+	EventModerationDismiss = "moderation.dismiss"
+
+	EventAnnouncementPin   = "announcement.pin"
+	EventAnnouncementUnpin = "announcement.unpin"
+
+	EventMaintenanceOn  = "maintenance.on"
+	EventMaintenanceOff = "maintenance.off"
+
+	EventIPBan   = "ip.ban"
+	EventIPUnban = "ip.unban"
+
+	EventAttachmentQuarantine = "attachment.quarantine"
+	EventAttachmentRelease    = "attachment.release"
+)
+
+// Define an AuditEvent type to hold the data for an individual audit log
+// entry. A UserID of zero means that the event isn't tied to a known user,
+// and Country is empty when it isn't known.
+type AuditEvent struct {
+	ID      int
+	UserID  int
+	IP      string
+	Country string
+	Event   string
+	Detail  string
+	Created time.Time
+}
+
+// Define an AuditModel type which wraps a database connection pool.
+type AuditModel struct {
+	DB *sql.DB
+}
+
+// Insert appends a new entry to the audit log.
+func (m *AuditModel) Insert(userID int, ip, country, event, detail string) error {
+	stmt := `INSERT INTO audit_log (user_id, ip, country, event, detail, created)
+	VALUES(?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	var uid sql.NullInt64
+	if userID > 0 {
+		uid = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
+
+	_, err := retrying(m.DB).Exec(stmt, uid, ip, country, event, detail)
+	return err
+}
+
+// Latest returns the most recent audit log entries, newest first.
+func (m *AuditModel) Latest(limit int) ([]*AuditEvent, error) {
+	stmt := `SELECT id, user_id, ip, country, event, detail, created FROM audit_log
+	ORDER BY id DESC LIMIT ?`
+
+	return m.query(stmt, limit)
+}
+
+// ForIP returns the most recent audit log entries from an IP address,
+// newest first.
+func (m *AuditModel) ForIP(ip string, limit int) ([]*AuditEvent, error) {
+	stmt := `SELECT id, user_id, ip, country, event, detail, created FROM audit_log
+	WHERE ip = ? ORDER BY id DESC LIMIT ?`
+
+	return m.query(stmt, ip, limit)
+}
+
+func (m *AuditModel) query(stmt string, args ...any) ([]*AuditEvent, error) {
+	rows, err := retrying(m.DB).Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*AuditEvent{}
+
+	for rows.Next() {
+		e := &AuditEvent{}
+		var uid sql.NullInt64
+		err = rows.Scan(&e.ID, &uid, &e.IP, &e.Country, &e.Event, &e.Detail, &e.Created)
+		if err != nil {
+			return nil, err
+		}
+		e.UserID = int(uid.Int64)
+		events = append(events, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
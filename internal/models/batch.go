@@ -0,0 +1,106 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+)
+
+// NewSnippet is one of the snippets given to InsertMany.
+type NewSnippet struct {
+	Title    string
+	Content  string
+	Language string
+	Tags     []string
+	// Expires is how many days from now the snippet expires in.
+	Expires int
+	// HeldReason is set if the moderation checks flagged the snippet.
+	HeldReason string
+}
+
+// InsertMany stores several snippets for the user in one transaction, and
+// returns their IDs in the same order. Either every snippet is stored, with
+// its tags and first revision, or none are.
+func (m *SnippetModel) InsertMany(userID int, snippets []NewSnippet) ([]int, error) {
+	owner := sql.NullInt64{Int64: int64(userID), Valid: userID != 0}
+
+	// Encrypting doesn't need the transaction, so it's done first to keep
+	// the transaction short.
+	hashes := make([]string, len(snippets))
+	contents := make([]string, len(snippets))
+	for i, s := range snippets {
+		hashes[i] = ContentHash(m.Keys, s.Content)
+
+		var err error
+		contents[i], err = m.Keys.Encrypt(s.Content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stmt, err := m.Stmts.Prepare(context.Background(), insertSnippetSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, len(snippets))
+	err = withTx(m.DB, func(q Queries) error {
+		insert := q.Stmt(stmt)
+
+		for i, s := range snippets {
+			lang := sql.NullString{String: s.Language, Valid: s.Language != ""}
+			held := sql.NullString{String: s.HeldReason, Valid: s.HeldReason != ""}
+
+			result, err := insert.Exec(s.Title, contents[i], hashes[i], lang, s.Expires, owner, nil, nil, held, nil)
+			if err != nil {
+				return err
+			}
+
+			id, err := result.LastInsertId()
+			if err != nil {
+				return err
+			}
+			ids[i] = int(id)
+
+			err = setTags(q, ids[i], s.Tags)
+			if err != nil {
+				return err
+			}
+
+			_, err = q.Exec(`INSERT INTO snippet_revisions (snippet_id, revision, title, content, user_id, created)
+			SELECT id, 1, title, content, user_id, created FROM snippets WHERE id = ?`, id)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// DeleteMany removes several snippets in one transaction. If any of them
+// has already gone, none are removed and it returns ErrNoRecord.
+func (m *SnippetModel) DeleteMany(ids []int) error {
+	return withTx(m.DB, func(q Queries) error {
+		for _, id := range ids {
+			result, err := q.Exec("DELETE FROM snippets WHERE id = ?", id)
+			if err != nil {
+				return err
+			}
+
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return ErrNoRecord
+			}
+		}
+
+		return nil
+	})
+}
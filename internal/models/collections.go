@@ -0,0 +1,247 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"snippetbox.floccinau.net/internal/crypto"
+)
+
+// Define a Collection type to hold a named, ordered group of snippets which
+// a user has put together. Private collections are only shown to their
+// owner.
+type Collection struct {
+	ID          int
+	UserID      int
+	Name        string
+	Description string
+	Public      bool
+	Created     time.Time
+	ItemCount   int
+}
+
+// Define a CollectionModel type which wraps a database connection pool. Keys
+// decrypts the content of the snippets returned by Items.
+type CollectionModel struct {
+	DB   *sql.DB
+	Keys *crypto.Keyring
+}
+
+// collectionColumns lists the columns which scanCollection expects, in
+// order, including the number of snippets in the collection.
+const collectionColumns = `collections.id, collections.user_id, collections.name,
+	collections.description, collections.public, collections.created,
+	(SELECT COUNT(*) FROM collection_items i WHERE i.collection_id = collections.id)`
+
+func scanCollection(sc scanner) (*Collection, error) {
+	c := &Collection{}
+	err := sc.Scan(&c.ID, &c.UserID, &c.Name, &c.Description, &c.Public, &c.Created, &c.ItemCount)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// duplicateCollection returns ErrDuplicateCollection if err is a violation
+// of the collections_uc_user_name key, and err otherwise.
+func duplicateCollection(err error) error {
+	var mySQLError *mysql.MySQLError
+	if errors.As(err, &mySQLError) {
+		if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "collections_uc_user_name") {
+			return ErrDuplicateCollection
+		}
+	}
+	return err
+}
+
+// Insert adds a new, empty collection for the user and returns its ID.
+func (m *CollectionModel) Insert(userID int, name, description string, public bool) (int, error) {
+	stmt := `INSERT INTO collections (user_id, name, description, public, created)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := retrying(m.DB).Exec(stmt, userID, name, description, public)
+	if err != nil {
+		return 0, duplicateCollection(err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Get returns a collection by its ID.
+func (m *CollectionModel) Get(id int) (*Collection, error) {
+	stmt := `SELECT ` + collectionColumns + ` FROM collections WHERE id = ?`
+
+	c, err := scanCollection(retrying(m.DB).QueryRow(stmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// ForUser returns the user's collections, sorted by name. Unless private is
+// set, only their public collections are returned.
+func (m *CollectionModel) ForUser(userID int, private bool) ([]*Collection, error) {
+	stmt := `SELECT ` + collectionColumns + ` FROM collections
+	WHERE user_id = ? AND (public OR ?)
+	ORDER BY name, id`
+
+	rows, err := retrying(m.DB).Query(stmt, userID, private)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []*Collection
+	for rows.Next() {
+		c, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+
+	return collections, rows.Err()
+}
+
+// Update changes a collection's name, description and visibility.
+func (m *CollectionModel) Update(id int, name, description string, public bool) error {
+	stmt := `UPDATE collections SET name = ?, description = ?, public = ? WHERE id = ?`
+
+	_, err := retrying(m.DB).Exec(stmt, name, description, public, id)
+	return duplicateCollection(err)
+}
+
+// Delete removes a collection. The snippets in it aren't affected.
+func (m *CollectionModel) Delete(id int) error {
+	_, err := retrying(m.DB).Exec("DELETE FROM collections WHERE id = ?", id)
+	return err
+}
+
+// Items returns the unexpired snippets in a collection, in the collection's
+// order.
+func (m *CollectionModel) Items(collectionID int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets INNER JOIN collection_items i ON i.snippet_id = snippets.id
+	WHERE i.collection_id = ? AND snippets.expires > NOW() AND snippets.held_reason IS NULL
+	AND snippets.publish_at <= UTC_TIMESTAMP() AND snippets.org_id IS NULL
+	ORDER BY i.position, i.added`
+
+	rows, err := retrying(m.DB).Query(stmt, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+	for rows.Next() {
+		s, err := scanSnippet(rows, m.Keys)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	return snippets, rows.Err()
+}
+
+// Containing returns the IDs of the user's collections which the snippet is
+// in.
+func (m *CollectionModel) Containing(userID, snippetID int) (map[int]bool, error) {
+	stmt := `SELECT c.id FROM collections c
+	INNER JOIN collection_items i ON i.collection_id = c.id
+	WHERE c.user_id = ? AND i.snippet_id = ?`
+
+	rows, err := retrying(m.DB).Query(stmt, userID, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+
+	return ids, rows.Err()
+}
+
+// AddItem adds a snippet to the end of a collection. Adding a snippet which
+// is already in the collection does nothing.
+func (m *CollectionModel) AddItem(collectionID, snippetID int) error {
+	stmt := `INSERT IGNORE INTO collection_items (collection_id, snippet_id, position, added)
+	SELECT ?, ?, COALESCE(MAX(position), 0) + 1, UTC_TIMESTAMP()
+	FROM collection_items WHERE collection_id = ?`
+
+	_, err := retrying(m.DB).Exec(stmt, collectionID, snippetID, collectionID)
+	return err
+}
+
+// RemoveItem takes a snippet out of a collection.
+func (m *CollectionModel) RemoveItem(collectionID, snippetID int) error {
+	_, err := retrying(m.DB).Exec("DELETE FROM collection_items WHERE collection_id = ? AND snippet_id = ?", collectionID, snippetID)
+	return err
+}
+
+// MoveItem swaps a snippet with the one before it in a collection, or with
+// the one after it if down is set. Moving the first snippet up, or the last
+// one down, does nothing. It returns ErrNoRecord if the snippet isn't in the
+// collection.
+func (m *CollectionModel) MoveItem(collectionID, snippetID int, down bool) error {
+	return withTx(m.DB, func(q Queries) error {
+		// Lock the collection's items so that concurrent moves don't give two
+		// snippets the same position.
+		var position int
+		stmt := `SELECT position FROM collection_items WHERE collection_id = ? AND snippet_id = ? FOR UPDATE`
+		err := q.QueryRow(stmt, collectionID, snippetID).Scan(&position)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNoRecord
+			}
+			return err
+		}
+
+		// The neighbour is the nearest snippet which Items would show, so that
+		// expired snippets don't make a move look like it did nothing.
+		neighbour := `SELECT i.snippet_id, i.position
+		FROM collection_items i INNER JOIN snippets ON snippets.id = i.snippet_id
+		WHERE i.collection_id = ? AND snippets.expires > NOW() AND snippets.held_reason IS NULL
+		AND snippets.publish_at <= UTC_TIMESTAMP()`
+		stmt = neighbour + ` AND i.position < ? ORDER BY i.position DESC LIMIT 1 FOR UPDATE`
+		if down {
+			stmt = neighbour + ` AND i.position > ? ORDER BY i.position LIMIT 1 FOR UPDATE`
+		}
+
+		var otherID, otherPosition int
+		err = q.QueryRow(stmt, collectionID, position).Scan(&otherID, &otherPosition)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			return err
+		}
+
+		stmt = `UPDATE collection_items SET position = ? WHERE collection_id = ? AND snippet_id = ?`
+		if _, err = q.Exec(stmt, otherPosition, collectionID, snippetID); err != nil {
+			return err
+		}
+		_, err = q.Exec(stmt, position, collectionID, otherID)
+		return err
+	})
+}
@@ -0,0 +1,236 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Define a Comment type to hold the data for an individual comment. Author is
+// the name of the user who wrote it, joined in from the users table.
+// Commenter is the user who wrote it too, with just the fields needed to
+// show them (their name, username, email and avatar) filled in.
+type Comment struct {
+	ID        int
+	SnippetID int
+	UserID    int
+	Author    string
+	Content   string
+	Created   time.Time
+	Commenter *User
+}
+
+// commentColumns lists the columns which scanComment expects, in order. The
+// queries using it must join the author as u.
+const commentColumns = `c.id, c.snippet_id, c.user_id, u.name, c.content, c.created,
+	u.username, u.email, u.avatar_key`
+
+// scanComment copies the commentColumns of the current row into a new
+// Comment.
+func scanComment(sc scanner) (*Comment, error) {
+	c := &Comment{Commenter: &User{}}
+	var avatarKey sql.NullString
+
+	err := sc.Scan(&c.ID, &c.SnippetID, &c.UserID, &c.Author, &c.Content, &c.Created,
+		&c.Commenter.Username, &c.Commenter.Email, &avatarKey)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Commenter.ID = c.UserID
+	c.Commenter.Name = c.Author
+	c.Commenter.AvatarKey = avatarKey.String
+
+	return c, nil
+}
+
+// Define a CommentModel type which wraps a database connection pool.
+type CommentModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a new comment to a snippet and returns its ID.
+func (m *CommentModel) Insert(snippetID, userID int, content string) (int, error) {
+	stmt := `INSERT INTO comments (snippet_id, user_id, content, created)
+	VALUES(?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := retrying(m.DB).Exec(stmt, snippetID, userID, content)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Get returns a specific comment based on its id.
+func (m *CommentModel) Get(id int) (*Comment, error) {
+	stmt := `SELECT ` + commentColumns + `
+	FROM comments c INNER JOIN users u ON u.id = c.user_id
+	WHERE c.id = ?`
+
+	c, err := scanComment(retrying(m.DB).QueryRow(stmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// ListBySnippet returns one page of the comments on a snippet, oldest first,
+// along with the total number of comments so that the caller can work out how
+// many pages there are. Pages are numbered from 1.
+func (m *CommentModel) ListBySnippet(snippetID, page, pageSize int) ([]*Comment, int, error) {
+	var total int
+
+	err := retrying(m.DB).QueryRow("SELECT COUNT(*) FROM comments WHERE snippet_id = ?", snippetID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stmt := `SELECT ` + commentColumns + `
+	FROM comments c INNER JOIN users u ON u.id = c.user_id
+	WHERE c.snippet_id = ?
+	ORDER BY c.created, c.id
+	LIMIT ? OFFSET ?`
+
+	rows, err := retrying(m.DB).Query(stmt, snippetID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	comments := []*Comment{}
+
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		comments = append(comments, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return comments, total, nil
+}
+
+// ListForSnippets is ListBySnippet for several snippets at once: it returns
+// the comments on each of them, oldest first, skipping the first offset and
+// returning at most limit, keyed by snippet ID. It uses one query however
+// many snippets there are.
+func (m *CommentModel) ListForSnippets(snippetIDs []int, offset, limit int) (map[int][]*Comment, error) {
+	comments := make(map[int][]*Comment, len(snippetIDs))
+	if len(snippetIDs) == 0 {
+		return comments, nil
+	}
+
+	args := make([]any, 0, len(snippetIDs)+2)
+	for _, id := range snippetIDs {
+		args = append(args, id)
+	}
+	args = append(args, offset, offset+limit)
+
+	// Each snippet's comments are numbered in order, so that the same page
+	// can be taken from every snippet.
+	stmt := `SELECT ` + commentColumns + `
+	FROM (
+		SELECT comments.*, ROW_NUMBER() OVER(PARTITION BY snippet_id ORDER BY created, id) AS n
+		FROM comments
+		WHERE snippet_id IN (?` + strings.Repeat(", ?", len(snippetIDs)-1) + `)
+	) c INNER JOIN users u ON u.id = c.user_id
+	WHERE c.n > ? AND c.n <= ?
+	ORDER BY c.snippet_id, c.n`
+
+	rows, err := retrying(m.DB).Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments[c.SnippetID] = append(comments[c.SnippetID], c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// Delete removes a comment. Only the comment's author or an admin may delete
+// it; for anyone else (or if the comment doesn't exist) ErrNoRecord is
+// returned.
+func (m *CommentModel) Delete(id int, user *User) error {
+	stmt := `DELETE FROM comments WHERE id = ? AND (user_id = ? OR ?)`
+
+	result, err := retrying(m.DB).Exec(stmt, id, user.ID, user.Can(PermissionAdminModerate))
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Counts returns the number of comments on each of the given snippets, keyed
+// by snippet ID. Snippets without comments are left out of the map, so
+// looking them up gives zero.
+func (m *CommentModel) Counts(snippetIDs []int) (map[int]int, error) {
+	counts := make(map[int]int, len(snippetIDs))
+	if len(snippetIDs) == 0 {
+		return counts, nil
+	}
+
+	args := make([]any, len(snippetIDs))
+	for i, id := range snippetIDs {
+		args[i] = id
+	}
+
+	stmt := `SELECT snippet_id, COUNT(*) FROM comments
+	WHERE snippet_id IN (?` + strings.Repeat(", ?", len(snippetIDs)-1) + `)
+	GROUP BY snippet_id`
+
+	rows, err := retrying(m.DB).Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,210 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned by ParseCursor for tokens which weren't made
+// by Cursor.String.
+var ErrInvalidCursor = errors.New("models: invalid cursor")
+
+// Cursor marks a place in a listing of snippets ordered by creation time, as
+// the creation time and ID of the snippet at that place. The ID breaks ties
+// between snippets created in the same second, so the order is stable.
+//
+// Listings paged through with cursors pick up from where the last page ended,
+// rather than skipping the pages before with OFFSET, so a deep page costs no
+// more than the first. The (created, id) order is served by the created
+// indexes, since InnoDB secondary indexes end with the primary key.
+type Cursor struct {
+	Created time.Time
+	ID      int
+}
+
+// CursorFor returns the cursor at s.
+func CursorFor(s *Snippet) Cursor {
+	return Cursor{Created: s.Created, ID: s.ID}
+}
+
+// IsZero reports whether c is the zero Cursor, which marks no place at all.
+func (c Cursor) IsZero() bool {
+	return c.ID == 0
+}
+
+// Compare returns a negative number if c comes before d in creation order, a
+// positive number if it comes after, and 0 if they're the same.
+func (c Cursor) Compare(d Cursor) int {
+	if n := c.Created.Compare(d.Created); n != 0 {
+		return n
+	}
+	return c.ID - d.ID
+}
+
+// String returns c as an opaque token to put in URLs and API responses.
+// Clients should only hand it back, not make their own. The zero Cursor is
+// the empty string.
+func (c Cursor) String() string {
+	if c.IsZero() {
+		return ""
+	}
+
+	token := strconv.FormatInt(c.Created.UnixMicro(), 10) + "." + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(token))
+}
+
+// ParseCursor returns the cursor which token is the String of. It returns
+// ErrInvalidCursor if the token is malformed.
+func ParseCursor(token string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	created, id, ok := strings.Cut(string(b), ".")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	micros, err := strconv.ParseInt(created, 10, 64)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	n, err := strconv.Atoi(id)
+	if err != nil || n < 1 {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return Cursor{Created: time.UnixMicro(micros).UTC(), ID: n}, nil
+}
+
+// where returns a condition for the snippets which come before c in creation
+// order, if op is "<", or after it, if op is ">", and its arguments. The
+// condition is spelled out rather than written as a row comparison, which
+// MySQL doesn't always use an index for.
+func (c Cursor) where(op string) (string, []any) {
+	return `(snippets.created ` + op + ` ? OR (snippets.created = ? AND snippets.id ` + op + ` ?))`,
+		[]any{c.Created, c.Created, c.ID}
+}
+
+// Keyset says which page of a listing paged through with cursors to return:
+// the Limit snippets just older than Before, or, if After is set, the Limit
+// snippets just newer than After, or, if neither is set, the newest Limit
+// snippets.
+type Keyset struct {
+	Before Cursor
+	After  Cursor
+	Limit  int
+}
+
+// CursorPage is one page of a listing paged through with cursors, newest
+// first. Newer is the cursor to use as the After of the page before this one,
+// and Older the cursor to use as the Before of the page after; either is zero
+// if there's no such page.
+type CursorPage struct {
+	Snippets []*Snippet
+	Newer    Cursor
+	Older    Cursor
+}
+
+// Recent returns one page of the unexpired snippets, newest first, for
+// paging back through the snippets on the home page. Snippets belonging to
+// organizations aren't included.
+func (m *SnippetModel) Recent(ctx context.Context, k Keyset) (CursorPage, error) {
+	return m.listKeyset(ctx, `snippets.org_id IS NULL`, nil, k)
+}
+
+// listKeyset returns the page of the unexpired, visible snippets which match
+// the where clause that k picks out. One more snippet than the page holds is
+// fetched, to tell whether there's another page beyond it, and nothing is
+// counted, so that every page costs the same.
+func (m *SnippetModel) listKeyset(ctx context.Context, where string, args []any, k Keyset) (CursorPage, error) {
+	// Pages newer than a cursor are read oldest first, from just after the
+	// cursor, and then turned around.
+	order := "DESC"
+	switch {
+	case !k.After.IsZero():
+		cond, condArgs := k.After.where(">")
+		where += " AND " + cond
+		args = append(args, condArgs...)
+		order = "ASC"
+	case !k.Before.IsZero():
+		cond, condArgs := k.Before.where("<")
+		where += " AND " + cond
+		args = append(args, condArgs...)
+	}
+
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets
+	WHERE ` + where + ` AND snippets.expires > NOW() AND snippets.held_reason IS NULL
+	AND snippets.publish_at <= UTC_TIMESTAMP()
+	ORDER BY snippets.created ` + order + `, snippets.id ` + order + `
+	LIMIT ?`
+
+	rows, err := retrying(m.DB).QueryContext(ctx, stmt, append(args, k.Limit+1)...)
+	if err != nil {
+		return CursorPage{}, err
+	}
+	defer rows.Close()
+
+	var snippets []*Snippet
+	for rows.Next() {
+		s, err := scanSnippet(rows, m.Keys)
+		if err != nil {
+			return CursorPage{}, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return CursorPage{}, err
+	}
+
+	more := len(snippets) > k.Limit
+	if more {
+		snippets = snippets[:k.Limit]
+	}
+	if order == "ASC" {
+		slices.Reverse(snippets)
+	}
+
+	if err = m.LoadTags(snippets...); err != nil {
+		return CursorPage{}, err
+	}
+
+	return NewCursorPage(snippets, k, more), nil
+}
+
+// NewCursorPage returns the page of snippets, newest first, which was listed
+// with k. more says whether there were more snippets beyond the page in the
+// direction it was listed in; the page it was reached from is taken to be
+// there still.
+func NewCursorPage(snippets []*Snippet, k Keyset, more bool) CursorPage {
+	page := CursorPage{Snippets: snippets}
+	if len(snippets) == 0 {
+		return page
+	}
+
+	newest, oldest := CursorFor(snippets[0]), CursorFor(snippets[len(snippets)-1])
+	if k.After.IsZero() {
+		if !k.Before.IsZero() {
+			page.Newer = newest
+		}
+		if more {
+			page.Older = oldest
+		}
+	} else {
+		if more {
+			page.Newer = newest
+		}
+		page.Older = oldest
+	}
+
+	return page
+}
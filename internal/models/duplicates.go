@@ -0,0 +1,49 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"unicode"
+
+	"snippetbox.floccinau.net/internal/crypto"
+)
+
+// ContentHash returns the hash of a snippet's content which copies of it
+// are found by. The case is lowered and all whitespace removed first, so
+// that copies which have only been re-indented or re-wrapped have the same
+// hash. It's keyed with the content keys, so that it can't be used to
+// check guesses at encrypted content, and cmd/rekey makes it again when
+// the keys are rotated.
+func ContentHash(keys *crypto.Keyring, content string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, content)
+
+	return keys.Hash("dup-hash", normalized)
+}
+
+// FindDuplicate returns the oldest public snippet whose content is the same
+// as content, ignoring case and whitespace. Snippets which are protected by a
+// passphrase, held for review or expired aren't matched. If there isn't one,
+// it returns ErrNoRecord.
+func (m *SnippetModel) FindDuplicate(content string) (*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets
+	WHERE content_hash = ? AND expires > NOW() AND held_reason IS NULL AND publish_at <= UTC_TIMESTAMP()
+	AND passphrase_hash IS NULL AND org_id IS NULL
+	ORDER BY id LIMIT 1`
+
+	s, err := scanSnippet(retrying(m.DB).QueryRow(stmt, ContentHash(m.Keys, content)), m.Keys)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return s, nil
+}
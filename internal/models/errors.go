@@ -6,3 +6,53 @@ import (
 
 // Chapter 4.7: Single-record SQL queries
 var ErrNoRecord = errors.New("models: no matching record found")
+
+// ErrInvalidCredentials is returned by UserModel.Authenticate when a user
+// tries to login with an incorrect email address or password.
+var ErrInvalidCredentials = errors.New("models: invalid credentials")
+
+// ErrDuplicateEmail is returned by UserModel.Insert when a user tries to
+// signup with an email address that's already in use.
+var ErrDuplicateEmail = errors.New("models: duplicate email")
+
+// ErrEditConflict is returned by SnippetModel.Update when the snippet has
+// been changed since the version the edit was based on.
+var ErrEditConflict = errors.New("models: edit conflict")
+
+// ErrDuplicateUsername is returned by UserModel.Insert and
+// UserModel.UpdateProfile when the username is already taken.
+var ErrDuplicateUsername = errors.New("models: duplicate username")
+
+// ErrDuplicateCollection is returned by CollectionModel.Insert and
+// CollectionModel.Update when the user already has a collection with the
+// same name.
+var ErrDuplicateCollection = errors.New("models: duplicate collection")
+
+// ErrTooManyPins is returned by SnippetModel.Pin when the snippet's owner
+// already has as many pinned snippets as they're allowed.
+var ErrTooManyPins = errors.New("models: too many pinned snippets")
+
+// ErrAlreadyImported is returned by SnippetModel.Import when the user has
+// already imported a snippet from the same source.
+var ErrAlreadyImported = errors.New("models: snippet already imported")
+
+// ErrInvalidInvite is returned by InviteModel.Use when there's no invitation
+// with the code, or it has expired or been used up.
+var ErrInvalidInvite = errors.New("models: invalid invite")
+
+// ErrDuplicateOrgSlug is returned by OrgModel.Insert when the slug is already
+// taken by another organization.
+var ErrDuplicateOrgSlug = errors.New("models: duplicate organization slug")
+
+// ErrLastOwner is returned by OrgModel.SetMember and OrgModel.RemoveMember
+// when the change would leave an organization without an owner.
+var ErrLastOwner = errors.New("models: organization would have no owner")
+
+// ErrRememberTokenReused is returned by RememberTokenModel.Use when a
+// remember-me cookie which has already been used is presented again, which
+// means someone has a copy of it.
+var ErrRememberTokenReused = errors.New("models: remember token reused")
+
+// ErrDuplicateIPBan is returned by IPBanModel.Insert when the address or
+// range is already banned.
+var ErrDuplicateIPBan = errors.New("models: duplicate IP ban")
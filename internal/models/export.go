@@ -0,0 +1,95 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// EachByUser calls fn with each of the user's snippets, for the export of
+// their data, oldest first, with their tags loaded. Unlike the rest of the
+// snippet methods, it includes snippets which are expired, held or not
+// published yet. The snippets are read one at a time, so an export of a
+// big account doesn't need them all in memory. It stops at the first error
+// fn returns.
+func (m *SnippetModel) EachByUser(ctx context.Context, userID int, fn func(*Snippet) error) error {
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets
+	WHERE user_id = ?
+	ORDER BY id`
+
+	rows, err := retrying(m.DB).QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s, err := scanSnippet(rows, m.Keys)
+		if err != nil {
+			return err
+		}
+
+		if err := m.LoadTags(s); err != nil {
+			return err
+		}
+
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ByUser returns all the comments which the user has written, oldest first,
+// for the export of their data.
+func (m *CommentModel) ByUser(ctx context.Context, userID int) ([]*Comment, error) {
+	stmt := `SELECT ` + commentColumns + `
+	FROM comments c INNER JOIN users u ON u.id = c.user_id
+	WHERE c.user_id = ?
+	ORDER BY c.id`
+
+	rows, err := retrying(m.DB).QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*Comment{}
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+
+	return comments, rows.Err()
+}
+
+// Star is a snippet which a user has starred, and when.
+type Star struct {
+	SnippetID int       `json:"snippet_id"`
+	Created   time.Time `json:"created"`
+}
+
+// ByUser returns all the user's stars, oldest first, including those of
+// snippets which have since expired.
+func (m *StarModel) ByUser(ctx context.Context, userID int) ([]Star, error) {
+	rows, err := retrying(m.DB).QueryContext(ctx, "SELECT snippet_id, created FROM stars WHERE user_id = ? ORDER BY created", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stars := []Star{}
+	for rows.Next() {
+		var s Star
+		if err := rows.Scan(&s.SnippetID, &s.Created); err != nil {
+			return nil, err
+		}
+		stars = append(stars, s)
+	}
+
+	return stars, rows.Err()
+}
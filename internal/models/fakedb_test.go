@@ -0,0 +1,124 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+// fakeDB is a database/sql driver for testing the plumbing around queries,
+// like the statement cache and retries, without a MySQL server. Every query
+// returns a single row with the column n set to 1, and every statement
+// affects one row, unless an error has been queued for it: the queued errors
+// are returned, in order, by the next statements to be executed or queried.
+type fakeDB struct {
+	mu       sync.Mutex
+	prepares int
+	execs    int
+	queries  int
+	errs     []error
+}
+
+// newFakeDB returns a connection pool on a new fakeDB, which is closed when
+// the test finishes.
+func newFakeDB(t *testing.T) (*sql.DB, *fakeDB) {
+	t.Helper()
+
+	f := &fakeDB{}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { db.Close() })
+	return db, f
+}
+
+// failNext queues errs to be returned by the next statements run.
+func (f *fakeDB) failNext(errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs = append(f.errs, errs...)
+}
+
+// counts returns how many statements have been prepared, executed and
+// queried.
+func (f *fakeDB) counts() (prepares, execs, queries int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.prepares, f.execs, f.queries
+}
+
+// nextErr returns the next queued error, or nil if there isn't one.
+func (f *fakeDB) nextErr() error {
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.prepares++
+	return fakeStmt(c), nil
+}
+
+func (c fakeConn) Close() error { return nil }
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fakeDB: transactions aren't supported")
+}
+
+type fakeStmt struct {
+	db *fakeDB
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.execs++
+	if err := s.db.nextErr(); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.queries++
+	if err := s.db.nextErr(); err != nil {
+		return nil, err
+	}
+	return &fakeRows{}, nil
+}
+
+// fakeRows is the one row, n = 1, which every query returns.
+type fakeRows struct {
+	done bool
+}
+
+func (r *fakeRows) Columns() []string { return []string{"n"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"slices"
+	"strings"
+
+	"snippetbox.floccinau.net/internal/validator"
+)
+
+// Filters holds the paging and sorting parameters for a listing. Sort is one
+// of the values in SortSafelist: a column name, optionally prefixed with "-"
+// for descending order. Only safelisted values ever reach a query.
+type Filters struct {
+	Page         int
+	PageSize     int
+	Sort         string
+	SortSafelist []string
+	// Offset, if it's set, is how many records to skip instead of the pages
+	// before Page, for listings paged through with cursors rather than page
+	// numbers.
+	Offset int
+	// After, if it's set, is the cursor of the last record of the previous
+	// page, for listings sorted by creation time and paged through with
+	// cursors. It takes the place of Page, and the records aren't counted.
+	After Cursor
+}
+
+// MaxPageSize is the most records that can be asked for in one page.
+const MaxPageSize = 100
+
+// ValidateFilters checks the paging and sorting parameters, adding any
+// problems to v under the names of the query parameters.
+func ValidateFilters(v *validator.Validator, f Filters) {
+	v.Check(f.Page > 0, "page", "must be greater than zero")
+	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
+	v.Check(f.PageSize <= MaxPageSize, "page_size", "must be a maximum of 100")
+	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "must be one of "+strings.Join(f.SortSafelist, ", "))
+	v.Check(f.After.IsZero() || f.byCreated(), "cursor", "can only be used when sorting by created or -created")
+}
+
+// sortColumn returns the column to sort by. It panics if Sort isn't in the
+// safelist, because that means ValidateFilters wasn't called, and an unchecked
+// value must never end up in SQL.
+func (f Filters) sortColumn() string {
+	if !slices.Contains(f.SortSafelist, f.Sort) {
+		panic("models: unsafe sort parameter: " + f.Sort)
+	}
+	return strings.TrimPrefix(f.Sort, "-")
+}
+
+// byCreated reports whether the listing is sorted by creation time, so that
+// it can be paged through with cursors.
+func (f Filters) byCreated() bool {
+	return strings.TrimPrefix(f.Sort, "-") == "created"
+}
+
+func (f Filters) sortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+func (f Filters) limit() int {
+	return f.PageSize
+}
+
+func (f Filters) offset() int {
+	if f.Offset > 0 {
+		return f.Offset
+	}
+	return (f.Page - 1) * f.PageSize
+}
+
+// Metadata describes a page of results, for API clients to page through a
+// listing with. It's empty when there are no results.
+type Metadata struct {
+	CurrentPage  int `json:"current_page,omitempty"`
+	PageSize     int `json:"page_size,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+	TotalRecords int `json:"total_records,omitempty"`
+	// NextCursor is the cursor for the next page of a listing sorted by
+	// creation time, or empty if it's the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     (totalRecords + pageSize - 1) / pageSize,
+		TotalRecords: totalRecords,
+	}
+}
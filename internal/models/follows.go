@@ -0,0 +1,95 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+
+	"snippetbox.floccinau.net/internal/crypto"
+)
+
+// Define a FollowModel type which wraps a database connection pool. A follow
+// is a (follower, followed) pair of users. Keys decrypts the content of the
+// snippets returned by Feed.
+type FollowModel struct {
+	DB   *sql.DB
+	Keys *crypto.Keyring
+}
+
+// Toggle makes the follower follow the other user if they don't yet, or
+// stop following them if they do. It reports whether the follower is
+// following the other user afterwards.
+func (m *FollowModel) Toggle(followerID, followedID int) (bool, error) {
+	result, err := retrying(m.DB).Exec("DELETE FROM follows WHERE follower_id = ? AND followed_id = ?", followerID, followedID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n > 0 {
+		return false, nil
+	}
+
+	stmt := `INSERT IGNORE INTO follows (follower_id, followed_id, created)
+	VALUES(?, ?, UTC_TIMESTAMP())`
+
+	_, err = retrying(m.DB).Exec(stmt, followerID, followedID)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// IsFollowing reports whether the follower follows the other user.
+func (m *FollowModel) IsFollowing(followerID, followedID int) (bool, error) {
+	var exists bool
+	stmt := "SELECT EXISTS(SELECT true FROM follows WHERE follower_id = ? AND followed_id = ?)"
+	err := retrying(m.DB).QueryRow(stmt, followerID, followedID).Scan(&exists)
+	return exists, err
+}
+
+// Counts returns how many followers a user has, and how many users they
+// follow.
+func (m *FollowModel) Counts(userID int) (followers, following int, err error) {
+	stmt := `SELECT
+	(SELECT COUNT(*) FROM follows WHERE followed_id = ?),
+	(SELECT COUNT(*) FROM follows WHERE follower_id = ?)`
+
+	err = retrying(m.DB).QueryRow(stmt, userID, userID).Scan(&followers, &following)
+	return followers, following, err
+}
+
+// Feed returns the 10 most recently created snippets by the users whom the
+// given user follows.
+func (m *FollowModel) Feed(ctx context.Context, userID int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets INNER JOIN follows ON follows.followed_id = snippets.user_id
+	WHERE follows.follower_id = ? AND snippets.expires > NOW() AND snippets.held_reason IS NULL
+	AND snippets.publish_at <= UTC_TIMESTAMP() AND snippets.org_id IS NULL
+	ORDER BY snippets.id DESC LIMIT 10`
+
+	rows, err := retrying(m.DB).QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s, err := scanSnippet(rows, m.Keys)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Define an IdentityModel type which wraps a database connection pool. It
+// links users to their accounts at an OpenID Connect provider, and keeps
+// track of the sessions those accounts log in to.
+type IdentityModel struct {
+	DB *sql.DB
+}
+
+// UserFor returns the ID of the user linked to the account with the given
+// issuer and subject, or ErrNoRecord if there isn't one.
+func (m *IdentityModel) UserFor(issuer, subject string) (int, error) {
+	stmt := `SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?`
+
+	var id int
+	err := retrying(m.DB).QueryRow(stmt, issuer, subject).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Link links the account with the given issuer and subject to a user.
+func (m *IdentityModel) Link(issuer, subject string, userID int) error {
+	stmt := `INSERT INTO user_identities (issuer, subject, user_id, created)
+	VALUES (?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err := retrying(m.DB).Exec(stmt, issuer, subject, userID)
+	return err
+}
+
+// AddSession records that the account logged in to the session with the
+// given token. sid is the provider's ID for its own session, if it sent
+// one. Expired records are cleared out at the same time.
+func (m *IdentityModel) AddSession(token, issuer, subject, sid string, expiry time.Time) error {
+	_, err := retrying(m.DB).Exec(`DELETE FROM oidc_sessions WHERE expiry < UTC_TIMESTAMP()`)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO oidc_sessions (session_token, issuer, subject, sid, expiry)
+	VALUES (?, ?, ?, NULLIF(?, ''), ?)`
+
+	_, err = retrying(m.DB).Exec(stmt, token, issuer, subject, sid, expiry.UTC())
+	return err
+}
+
+// TakeSessions removes and returns the tokens of the sessions to end for a
+// backchannel logout. If sid is set only that session of the account's is
+// ended, and otherwise all of them are.
+func (m *IdentityModel) TakeSessions(issuer, subject, sid string) ([]string, error) {
+	where := `issuer = ? AND subject = ?`
+	args := []any{issuer, subject}
+	if sid != "" {
+		// A logout token is allowed to leave out the subject if it has a
+		// sid.
+		where = `issuer = ? AND sid = ?`
+		args = []any{issuer, sid}
+	}
+
+	var tokens []string
+	err := withTx(m.DB, func(q Queries) error {
+		// Start afresh if the transaction is being retried.
+		tokens = nil
+
+		rows, err := q.Query(`SELECT session_token FROM oidc_sessions WHERE `+where+` FOR UPDATE`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var token string
+			err := rows.Scan(&token)
+			if err != nil {
+				return err
+			}
+			tokens = append(tokens, token)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		_, err = q.Exec(`DELETE FROM oidc_sessions WHERE `+where, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
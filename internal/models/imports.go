@@ -0,0 +1,76 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ImportedSnippet is a snippet brought in from another service, like a
+// GitHub Gist.
+type ImportedSnippet struct {
+	Title    string
+	Content  string
+	Language string
+	// Created is when the snippet was created on the other service, which
+	// it keeps here too.
+	Created time.Time
+	// Expires is how many days from now the snippet expires in.
+	Expires int
+	// Source identifies where the snippet came from, like
+	// "gist:aa5a315d61ae9438b18d/main.go". Each user can only import a
+	// source once.
+	Source string
+	// HeldReason is set if the moderation checks flagged the snippet.
+	HeldReason string
+}
+
+// Import stores an imported snippet for the user, and returns its ID. If
+// the user has already imported a snippet from the same source, it returns
+// ErrAlreadyImported, so an import which is run again, or retried after it
+// failed part way, skips the snippets it already got.
+func (m *SnippetModel) Import(userID int, s ImportedSnippet) (int, error) {
+	hash := ContentHash(m.Keys, s.Content)
+
+	content, err := m.Keys.Encrypt(s.Content)
+	if err != nil {
+		return 0, err
+	}
+
+	lang := sql.NullString{String: s.Language, Valid: s.Language != ""}
+	held := sql.NullString{String: s.HeldReason, Valid: s.HeldReason != ""}
+
+	// An imported snippet was published when it was created.
+	stmt := `INSERT INTO snippets(title, content, content_hash, language, created, expires, user_id, held_reason, publish_at, imported_from)
+	VALUES(?, ?, ?, ?, ?, DATE_ADD(NOW(), INTERVAL ? DAY), ?, ?, ?, ?)`
+
+	var id int64
+	err = withTx(m.DB, func(q Queries) error {
+		created := s.Created.UTC()
+		result, err := q.Exec(stmt, s.Title, content, hash, lang, created, s.Expires, userID, held, created, s.Source)
+		if err != nil {
+			var mySQLError *mysql.MySQLError
+			if errors.As(err, &mySQLError) && mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "snippets_uc_user_imported_from") {
+				return ErrAlreadyImported
+			}
+			return err
+		}
+
+		id, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		_, err = q.Exec(`INSERT INTO snippet_revisions (snippet_id, revision, title, content, user_id, created)
+		SELECT id, 1, title, content, user_id, created FROM snippets WHERE id = ?`, id)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
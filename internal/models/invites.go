@@ -0,0 +1,166 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+)
+
+// Define an Invite type to hold an invitation to sign up. It can be used
+// MaxUses times until Expiry. CreatedBy is zero if the user who made it has
+// since deleted their account.
+type Invite struct {
+	ID        int
+	Code      string
+	CreatedBy int
+	MaxUses   int
+	Uses      int
+	Expiry    time.Time
+	Created   time.Time
+}
+
+// Usable reports whether the invitation can still be used to sign up.
+func (i *Invite) Usable() bool {
+	return i.Uses < i.MaxUses && time.Now().Before(i.Expiry)
+}
+
+// Define an InviteModel type which wraps a database connection pool.
+type InviteModel struct {
+	DB *sql.DB
+}
+
+// Insert makes a new invitation with a random code.
+func (m *InviteModel) Insert(createdBy, maxUses int, ttl time.Duration) (*Invite, error) {
+	// The codes are made like tokens: 16 random bytes, encoded as 26
+	// characters of base-32.
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, err
+	}
+
+	invite := &Invite{
+		Code:      base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b),
+		CreatedBy: createdBy,
+		MaxUses:   maxUses,
+		Expiry:    time.Now().Add(ttl).UTC(),
+		Created:   time.Now().UTC(),
+	}
+
+	stmt := `INSERT INTO invites (code, created_by, max_uses, expiry, created)
+	VALUES (?, ?, ?, ?, ?)`
+
+	result, err := retrying(m.DB).Exec(stmt, invite.Code, createdBy, maxUses, invite.Expiry, invite.Created)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	invite.ID = int(id)
+
+	return invite, nil
+}
+
+// All returns every invitation, newest first, including ones which have
+// expired or been used up.
+func (m *InviteModel) All() ([]*Invite, error) {
+	stmt := `SELECT id, code, created_by, max_uses, uses, expiry, created
+	FROM invites ORDER BY id DESC`
+
+	rows, err := retrying(m.DB).Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []*Invite
+	for rows.Next() {
+		i := &Invite{}
+		var createdBy sql.NullInt64
+
+		err := rows.Scan(&i.ID, &i.Code, &createdBy, &i.MaxUses, &i.Uses, &i.Expiry, &i.Created)
+		if err != nil {
+			return nil, err
+		}
+		i.CreatedBy = int(createdBy.Int64)
+
+		invites = append(invites, i)
+	}
+
+	return invites, rows.Err()
+}
+
+// Get returns the invitation with the given code, whether or not it can
+// still be used.
+func (m *InviteModel) Get(code string) (*Invite, error) {
+	stmt := `SELECT id, code, created_by, max_uses, uses, expiry, created
+	FROM invites WHERE code = ?`
+
+	i := &Invite{}
+	var createdBy sql.NullInt64
+
+	err := retrying(m.DB).QueryRow(stmt, code).Scan(&i.ID, &i.Code, &createdBy, &i.MaxUses, &i.Uses, &i.Expiry, &i.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	i.CreatedBy = int(createdBy.Int64)
+
+	return i, nil
+}
+
+// Use counts one use of the invitation with the given code. It returns
+// ErrInvalidInvite if there's no such invitation, or it can't be used any
+// more. The check and the count are one statement, so two people can't
+// both take the last use.
+func (m *InviteModel) Use(code string) error {
+	stmt := `UPDATE invites SET uses = uses + 1
+	WHERE code = ? AND uses < max_uses AND expiry > UTC_TIMESTAMP()`
+
+	result, err := retrying(m.DB).Exec(stmt, code)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidInvite
+	}
+
+	return nil
+}
+
+// Release gives back a use of the invitation, for when signing up failed
+// after Use was called.
+func (m *InviteModel) Release(code string) error {
+	_, err := retrying(m.DB).Exec(`UPDATE invites SET uses = uses - 1 WHERE code = ? AND uses > 0`, code)
+	return err
+}
+
+// Revoke deletes an invitation, so that it can't be used any more.
+func (m *InviteModel) Revoke(id int) error {
+	result, err := retrying(m.DB).Exec(`DELETE FROM invites WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
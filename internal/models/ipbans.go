@@ -0,0 +1,98 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Define an IPBan type to hold an address or range which has been banned.
+// CIDR is always in CIDR notation, with a /32 or /128 for single
+// addresses. CreatedBy is zero if the user who made it has since deleted
+// their account.
+type IPBan struct {
+	ID        int
+	CIDR      string
+	Reason    string
+	CreatedBy int
+	Created   time.Time
+}
+
+// Define an IPBanModel type which wraps a database connection pool.
+type IPBanModel struct {
+	DB *sql.DB
+}
+
+// Insert bans an address or range, and returns the ban's ID.
+func (m *IPBanModel) Insert(cidr, reason string, createdBy int) (int, error) {
+	stmt := `INSERT INTO ip_bans (cidr, reason, created_by, created)
+	VALUES (?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := retrying(m.DB).Exec(stmt, cidr, reason, createdBy)
+	if err != nil {
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) {
+			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "ip_bans_uc_cidr") {
+				return 0, ErrDuplicateIPBan
+			}
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// All returns every ban, newest first.
+func (m *IPBanModel) All() ([]*IPBan, error) {
+	stmt := `SELECT id, cidr, reason, created_by, created FROM ip_bans
+	ORDER BY id DESC`
+
+	rows, err := retrying(m.DB).Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bans []*IPBan
+	for rows.Next() {
+		b := &IPBan{}
+		var createdBy sql.NullInt64
+
+		err := rows.Scan(&b.ID, &b.CIDR, &b.Reason, &createdBy, &b.Created)
+		if err != nil {
+			return nil, err
+		}
+		b.CreatedBy = int(createdBy.Int64)
+
+		bans = append(bans, b)
+	}
+
+	return bans, rows.Err()
+}
+
+// Delete lifts a ban, and returns the address or range it was for.
+func (m *IPBanModel) Delete(id int) (string, error) {
+	var cidr string
+	err := withTx(m.DB, func(q Queries) error {
+		err := q.QueryRow(`SELECT cidr FROM ip_bans WHERE id = ?`, id).Scan(&cidr)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNoRecord
+			}
+			return err
+		}
+
+		_, err = q.Exec(`DELETE FROM ip_bans WHERE id = ?`, id)
+		return err
+	})
+
+	return cidr, err
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// LoginFailures summarises the recent failed login attempts for an account
+// and for a client IP address.
+type LoginFailures struct {
+	Account            int
+	LastAccountFailure time.Time
+	IP                 int
+	LastIPFailure      time.Time
+}
+
+// Define a LoginAttemptModel type which wraps a database connection pool. We
+// record every login attempt (successful or not) so that repeated failures
+// can be throttled per account and per IP address.
+type LoginAttemptModel struct {
+	DB *sql.DB
+}
+
+// Begin stores a login attempt before the password is checked, as a failure
+// until Succeeded says otherwise, and returns its ID. Attempts are keyed on
+// the submitted email address rather than a user ID, so that guessing against
+// addresses which don't have an account is throttled in exactly the same way.
+//
+// Because an attempt is counted from the moment it starts, attempts made at
+// the same time can't all get past the throttle before any of them has
+// failed: whichever counts the failures last sees the others.
+func (m *LoginAttemptModel) Begin(email, ip string) (int64, error) {
+	stmt := `INSERT INTO login_attempts (email, ip, succeeded, created)
+	VALUES(?, ?, FALSE, UTC_TIMESTAMP())`
+
+	// An insert which is retried after losing the connection could leave
+	// the attempt counted twice, which only errs on the safe side.
+	res, err := retrying(m.DB).Exec(stmt, normalizeEmail(email), ip)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// Succeeded marks the attempt with the given ID as a successful login.
+func (m *LoginAttemptModel) Succeeded(id int64) error {
+	_, err := retrying(m.DB).Exec("UPDATE login_attempts SET succeeded = TRUE WHERE id = ?", id)
+	return err
+}
+
+// Cancel deletes the attempt with the given ID, for an attempt which the
+// throttle didn't let go ahead.
+func (m *LoginAttemptModel) Cancel(id int64) error {
+	_, err := retrying(m.DB).Exec("DELETE FROM login_attempts WHERE id = ?", id)
+	return err
+}
+
+// Failures returns the number of failed attempts since the given time, not
+// counting the attempt with the ID exclude, which is the one being checked.
+// For the account, only failures after the most recent successful login are
+// counted.
+func (m *LoginAttemptModel) Failures(email, ip string, since time.Time, exclude int64) (*LoginFailures, error) {
+	email = normalizeEmail(email)
+	since = since.UTC()
+
+	var lastSuccess sql.NullTime
+	stmt := `SELECT MAX(created) FROM login_attempts WHERE email = ? AND succeeded = TRUE`
+	err := retrying(m.DB).QueryRow(stmt, email).Scan(&lastSuccess)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := since
+	if lastSuccess.Valid && lastSuccess.Time.After(cutoff) {
+		cutoff = lastSuccess.Time
+	}
+
+	f := &LoginFailures{}
+	var last sql.NullTime
+
+	stmt = `SELECT COUNT(*), MAX(created) FROM login_attempts
+	WHERE email = ? AND succeeded = FALSE AND created > ? AND id <> ?`
+	err = retrying(m.DB).QueryRow(stmt, email, cutoff, exclude).Scan(&f.Account, &last)
+	if err != nil {
+		return nil, err
+	}
+	f.LastAccountFailure = last.Time
+
+	stmt = `SELECT COUNT(*), MAX(created) FROM login_attempts
+	WHERE ip = ? AND succeeded = FALSE AND created > ? AND id <> ?`
+	err = retrying(m.DB).QueryRow(stmt, ip, since, exclude).Scan(&f.IP, &last)
+	if err != nil {
+		return nil, err
+	}
+	f.LastIPFailure = last.Time
+
+	return f, nil
+}
+
+// deleteBatchSize is how many old login attempts DeleteBefore deletes at a
+// time, so that a backlog left by a brute-force attack doesn't hold locks on
+// the table for long while logins are still being recorded.
+const deleteBatchSize = 1000
+
+// DeleteBefore deletes the attempts made before the given time, which are
+// too old for Failures to count, and returns how many it deleted.
+func (m *LoginAttemptModel) DeleteBefore(before time.Time) (int64, error) {
+	stmt := `DELETE FROM login_attempts WHERE created < ? LIMIT ?`
+
+	var deleted int64
+	for {
+		res, err := retrying(m.DB).Exec(stmt, before.UTC(), deleteBatchSize)
+		if err != nil {
+			return deleted, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += n
+		if n < deleteBatchSize {
+			return deleted, nil
+		}
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
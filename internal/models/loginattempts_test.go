@@ -0,0 +1,38 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"snippetbox.floccinau.net/internal/testutils"
+)
+
+func TestLoginAttemptModelDeleteBefore(t *testing.T) {
+	m := &LoginAttemptModel{DB: testutils.NewTestDB(t)}
+
+	now := time.Now().UTC()
+	for _, created := range []time.Time{now.Add(-3 * time.Hour), now.Add(-2 * time.Hour), now} {
+		_, err := m.DB.Exec(`INSERT INTO login_attempts (email, ip, succeeded, created)
+		VALUES('alice@example.com', '192.0.2.1', FALSE, ?)`, created)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := m.DeleteBefore(now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got %d deleted; want 2", n)
+	}
+
+	// The recent failure is still counted.
+	f, err := m.Failures("alice@example.com", "192.0.2.1", now.Add(-time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Account != 1 || f.IP != 1 {
+		t.Errorf("got %d account and %d IP failures; want 1 and 1", f.Account, f.IP)
+	}
+}
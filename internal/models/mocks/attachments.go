@@ -0,0 +1,143 @@
+package mocks
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// AttachmentModel is an in-memory models.AttachmentStore. Unlike the MySQL
+// model, Get doesn't check that the attachment's snippet is unexpired.
+// KnownKeys looks up avatars in Users, if it's set. The zero value is
+// otherwise empty and ready to use, and it's safe to use from multiple
+// goroutines.
+type AttachmentModel struct {
+	Users *UserModel
+
+	mu     sync.Mutex
+	lastID int
+	// attachments are kept in the order they were inserted.
+	attachments []*models.Attachment
+}
+
+var _ models.AttachmentStore = (*AttachmentModel)(nil)
+
+// matching returns copies of the attachments for which keep returns true,
+// oldest first. The caller must hold m.mu.
+func (m *AttachmentModel) matching(keep func(a *models.Attachment) bool) []*models.Attachment {
+	attachments := []*models.Attachment{}
+	for _, a := range m.attachments {
+		if keep(a) {
+			c := *a
+			attachments = append(attachments, &c)
+		}
+	}
+	return attachments
+}
+
+// setStatus changes the scan status of the attachment with the id if from
+// returns true for its current status, and returns ErrNoRecord otherwise.
+// The caller must hold m.mu.
+func (m *AttachmentModel) setStatus(id int, status, threat string, from func(status string) bool) error {
+	for _, a := range m.attachments {
+		if a.ID == id && from(a.ScanStatus) {
+			a.ScanStatus, a.Threat = status, threat
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
+
+func (m *AttachmentModel) Insert(a *models.Attachment) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastID++
+	c := *a
+	c.ID = m.lastID
+	c.Threat = ""
+	c.Created = time.Now().UTC()
+	if c.ScanStatus == "" {
+		c.ScanStatus = models.ScanClean
+	}
+	m.attachments = append(m.attachments, &c)
+	return c.ID, nil
+}
+
+func (m *AttachmentModel) Get(id int) (*models.Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attachments := m.matching(func(a *models.Attachment) bool { return a.ID == id })
+	if len(attachments) == 0 {
+		return nil, models.ErrNoRecord
+	}
+	return attachments[0], nil
+}
+
+func (m *AttachmentModel) ListBySnippet(snippetID int) ([]*models.Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.matching(func(a *models.Attachment) bool { return a.SnippetID == snippetID }), nil
+}
+
+func (m *AttachmentModel) SetScanStatus(id int, status, threat string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.setStatus(id, status, threat, func(s string) bool { return s == models.ScanPending })
+}
+
+func (m *AttachmentModel) Release(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.setStatus(id, models.ScanClean, "", func(s string) bool { return s != models.ScanClean })
+}
+
+func (m *AttachmentModel) ListByScanStatus(status string, limit int) ([]*models.Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attachments := m.matching(func(a *models.Attachment) bool { return a.ScanStatus == status })
+	return attachments[:min(len(attachments), limit)], nil
+}
+
+func (m *AttachmentModel) Count(snippetID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.matching(func(a *models.Attachment) bool { return a.SnippetID == snippetID })), nil
+}
+
+func (m *AttachmentModel) Delete(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.attachments, func(a *models.Attachment) bool { return a.ID == id })
+	if i < 0 {
+		return models.ErrNoRecord
+	}
+	m.attachments = slices.Delete(m.attachments, i, i+1)
+	return nil
+}
+
+func (m *AttachmentModel) KnownKeys(keys []string) (map[string]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	known := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if slices.ContainsFunc(m.attachments, func(a *models.Attachment) bool { return a.StorageKey == key }) {
+			known[key] = true
+		} else if m.Users != nil {
+			if ok, _ := m.Users.HasAvatar(key); ok {
+				known[key] = true
+			}
+		}
+	}
+	return known, nil
+}
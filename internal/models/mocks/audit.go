@@ -0,0 +1,52 @@
+package mocks
+
+import (
+	"sync"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// AuditModel is an in-memory models.AuditStore. The zero value has an empty
+// log, and it's safe to use from multiple goroutines.
+type AuditModel struct {
+	mu     sync.Mutex
+	events []*models.AuditEvent
+}
+
+var _ models.AuditStore = (*AuditModel)(nil)
+
+func (m *AuditModel) Insert(userID int, ip, country, event, detail string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = append(m.events, &models.AuditEvent{
+		ID:      len(m.events) + 1,
+		UserID:  userID,
+		IP:      ip,
+		Country: country,
+		Event:   event,
+		Detail:  detail,
+		Created: time.Now().UTC().Truncate(time.Second),
+	})
+	return nil
+}
+
+func (m *AuditModel) Latest(limit int) ([]*models.AuditEvent, error) {
+	return m.ForIP("", limit)
+}
+
+// ForIP returns the latest events from ip, or from anywhere if it's empty.
+func (m *AuditModel) ForIP(ip string, limit int) ([]*models.AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []*models.AuditEvent{}
+	for i := len(m.events) - 1; i >= 0 && len(events) < limit; i-- {
+		if ip == "" || m.events[i].IP == ip {
+			e := *m.events[i]
+			events = append(events, &e)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,196 @@
+package mocks
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// collection is a stored collection, with the IDs of its snippets in order.
+type collection struct {
+	models.Collection
+	items []int
+}
+
+// clone returns a copy of the collection which the caller can change.
+func (c *collection) clone() *models.Collection {
+	cc := c.Collection
+	cc.ItemCount = len(c.items)
+	return &cc
+}
+
+// CollectionModel is an in-memory models.CollectionStore. Items returns the
+// snippets from Snippets, which must be set. It's safe to use from multiple
+// goroutines.
+type CollectionModel struct {
+	Snippets *SnippetModel
+
+	mu          sync.Mutex
+	lastID      int
+	collections map[int]*collection
+}
+
+var _ models.CollectionStore = (*CollectionModel)(nil)
+
+// taken reports whether the user has a collection other than id with the
+// name, which the MySQL model's unique key would reject. The caller must
+// hold m.mu.
+func (m *CollectionModel) taken(id, userID int, name string) bool {
+	for _, c := range m.collections {
+		if c.ID != id && c.UserID == userID && strings.EqualFold(c.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *CollectionModel) Insert(userID int, name, description string, public bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.taken(0, userID, name) {
+		return 0, models.ErrDuplicateCollection
+	}
+
+	if m.collections == nil {
+		m.collections = make(map[int]*collection)
+	}
+	m.lastID++
+	m.collections[m.lastID] = &collection{Collection: models.Collection{
+		ID:          m.lastID,
+		UserID:      userID,
+		Name:        name,
+		Description: description,
+		Public:      public,
+		Created:     time.Now().UTC(),
+	}}
+	return m.lastID, nil
+}
+
+func (m *CollectionModel) Get(id int) (*models.Collection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.collections[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	return c.clone(), nil
+}
+
+func (m *CollectionModel) ForUser(userID int, private bool) ([]*models.Collection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var collections []*models.Collection
+	for _, c := range m.collections {
+		if c.UserID == userID && (c.Public || private) {
+			collections = append(collections, c.clone())
+		}
+	}
+	slices.SortFunc(collections, func(a, b *models.Collection) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return a.ID - b.ID
+	})
+	return collections, nil
+}
+
+func (m *CollectionModel) Update(id int, name, description string, public bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.collections[id]
+	if !ok {
+		return nil
+	}
+	if m.taken(id, c.UserID, name) {
+		return models.ErrDuplicateCollection
+	}
+	c.Name, c.Description, c.Public = name, description, public
+	return nil
+}
+
+func (m *CollectionModel) Delete(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.collections, id)
+	return nil
+}
+
+func (m *CollectionModel) Items(collectionID int) ([]*models.Snippet, error) {
+	m.mu.Lock()
+	var ids []int
+	if c, ok := m.collections[collectionID]; ok {
+		ids = slices.Clone(c.items)
+	}
+	m.mu.Unlock()
+
+	return m.Snippets.public(ids), nil
+}
+
+func (m *CollectionModel) Containing(userID, snippetID int) (map[int]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make(map[int]bool)
+	for _, c := range m.collections {
+		if c.UserID == userID && slices.Contains(c.items, snippetID) {
+			ids[c.ID] = true
+		}
+	}
+	return ids, nil
+}
+
+func (m *CollectionModel) AddItem(collectionID, snippetID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if c, ok := m.collections[collectionID]; ok && !slices.Contains(c.items, snippetID) {
+		c.items = append(c.items, snippetID)
+	}
+	return nil
+}
+
+func (m *CollectionModel) RemoveItem(collectionID, snippetID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if c, ok := m.collections[collectionID]; ok {
+		c.items = slices.DeleteFunc(c.items, func(id int) bool { return id == snippetID })
+	}
+	return nil
+}
+
+func (m *CollectionModel) MoveItem(collectionID, snippetID int, down bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.collections[collectionID]
+	if !ok {
+		return models.ErrNoRecord
+	}
+	i := slices.Index(c.items, snippetID)
+	if i < 0 {
+		return models.ErrNoRecord
+	}
+
+	// Like the MySQL model, swap with the nearest snippet which Items would
+	// show.
+	step := -1
+	if down {
+		step = 1
+	}
+	for j := i + step; j >= 0 && j < len(c.items); j += step {
+		if len(m.Snippets.public([]int{c.items[j]})) > 0 {
+			c.items[i], c.items[j] = c.items[j], c.items[i]
+			break
+		}
+	}
+	return nil
+}
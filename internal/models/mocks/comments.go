@@ -0,0 +1,141 @@
+package mocks
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// CommentModel is an in-memory models.CommentStore. The comments' authors
+// are looked up in Users, which must be set; like the MySQL model's join,
+// comments by users who aren't there are left out. It's safe to use from
+// multiple goroutines.
+type CommentModel struct {
+	Users *UserModel
+
+	mu     sync.Mutex
+	lastID int
+	// comments are kept oldest first.
+	comments []*models.Comment
+}
+
+var _ models.CommentStore = (*CommentModel)(nil)
+
+// withAuthor returns a copy of the comment with its author filled in, or nil
+// if the author isn't in Users.
+func (m *CommentModel) withAuthor(c *models.Comment) *models.Comment {
+	u, err := m.Users.Get(c.UserID)
+	if err != nil {
+		return nil
+	}
+
+	cc := *c
+	cc.Author = u.Name
+	cc.Commenter = &models.User{
+		ID:        u.ID,
+		Name:      u.Name,
+		Username:  u.Username,
+		Email:     u.Email,
+		AvatarKey: u.AvatarKey,
+	}
+	return &cc
+}
+
+// matching returns copies of the comments for which keep returns true,
+// oldest first. The caller must hold m.mu.
+func (m *CommentModel) matching(keep func(c *models.Comment) bool) []*models.Comment {
+	comments := []*models.Comment{}
+	for _, c := range m.comments {
+		if !keep(c) {
+			continue
+		}
+		if c = m.withAuthor(c); c != nil {
+			comments = append(comments, c)
+		}
+	}
+	return comments
+}
+
+func (m *CommentModel) Insert(snippetID, userID int, content string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastID++
+	m.comments = append(m.comments, &models.Comment{
+		ID:        m.lastID,
+		SnippetID: snippetID,
+		UserID:    userID,
+		Content:   content,
+		Created:   time.Now().UTC(),
+	})
+	return m.lastID, nil
+}
+
+func (m *CommentModel) Get(id int) (*models.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comments := m.matching(func(c *models.Comment) bool { return c.ID == id })
+	if len(comments) == 0 {
+		return nil, models.ErrNoRecord
+	}
+	return comments[0], nil
+}
+
+func (m *CommentModel) ListBySnippet(snippetID, pageNum, pageSize int) ([]*models.Comment, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comments := m.matching(func(c *models.Comment) bool { return c.SnippetID == snippetID })
+	return page(comments, pageNum, pageSize), len(comments), nil
+}
+
+func (m *CommentModel) ListForSnippets(snippetIDs []int, offset, limit int) (map[int][]*models.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	comments := make(map[int][]*models.Comment, len(snippetIDs))
+	for _, id := range snippetIDs {
+		all := m.matching(func(c *models.Comment) bool { return c.SnippetID == id })
+		if len(all) > offset {
+			comments[id] = all[offset:min(len(all), offset+limit)]
+		}
+	}
+	return comments, nil
+}
+
+func (m *CommentModel) Delete(id int, user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, c := range m.comments {
+		if c.ID == id && (c.UserID == user.ID || user.Can(models.PermissionAdminModerate)) {
+			m.comments = append(m.comments[:i], m.comments[i+1:]...)
+			return nil
+		}
+	}
+	return models.ErrNoRecord
+}
+
+func (m *CommentModel) Counts(snippetIDs []int) (map[int]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[int]int, len(snippetIDs))
+	for _, c := range m.comments {
+		if slices.Contains(snippetIDs, c.SnippetID) {
+			counts[c.SnippetID]++
+		}
+	}
+	return counts, nil
+}
+
+func (m *CommentModel) ByUser(ctx context.Context, userID int) ([]*models.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.matching(func(c *models.Comment) bool { return c.UserID == userID }), nil
+}
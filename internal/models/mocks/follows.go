@@ -0,0 +1,79 @@
+package mocks
+
+import (
+	"context"
+	"sync"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// follow is one user following another.
+type follow struct {
+	followerID int
+	followedID int
+}
+
+// FollowModel is an in-memory models.FollowStore. Feed returns the snippets
+// from Snippets, which must be set. It's safe to use from multiple
+// goroutines.
+type FollowModel struct {
+	Snippets *SnippetModel
+
+	mu      sync.Mutex
+	follows map[follow]bool
+}
+
+var _ models.FollowStore = (*FollowModel)(nil)
+
+func (m *FollowModel) Toggle(followerID, followedID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f := follow{followerID: followerID, followedID: followedID}
+	if m.follows[f] {
+		delete(m.follows, f)
+		return false, nil
+	}
+
+	if m.follows == nil {
+		m.follows = make(map[follow]bool)
+	}
+	m.follows[f] = true
+	return true, nil
+}
+
+func (m *FollowModel) IsFollowing(followerID, followedID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.follows[follow{followerID: followerID, followedID: followedID}], nil
+}
+
+func (m *FollowModel) Counts(userID int) (followers, following int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for f := range m.follows {
+		if f.followedID == userID {
+			followers++
+		}
+		if f.followerID == userID {
+			following++
+		}
+	}
+	return followers, following, nil
+}
+
+func (m *FollowModel) Feed(ctx context.Context, userID int) ([]*models.Snippet, error) {
+	m.mu.Lock()
+	followed := make(map[int]bool)
+	for f := range m.follows {
+		if f.followerID == userID {
+			followed[f.followedID] = true
+		}
+	}
+	m.mu.Unlock()
+
+	snippets := m.Snippets.publicBy(followed)
+	return snippets[:min(len(snippets), 10)], nil
+}
@@ -0,0 +1,81 @@
+package mocks
+
+import (
+	"sync"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+type identity struct {
+	issuer  string
+	subject string
+}
+
+type oidcSession struct {
+	token  string
+	id     identity
+	sid    string
+	expiry time.Time
+}
+
+// IdentityModel is an in-memory models.IdentityStore. The zero value has no
+// identities, and it's safe to use from multiple goroutines.
+type IdentityModel struct {
+	mu       sync.Mutex
+	users    map[identity]int
+	sessions []oidcSession
+}
+
+var _ models.IdentityStore = (*IdentityModel)(nil)
+
+func (m *IdentityModel) UserFor(issuer, subject string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, ok := m.users[identity{issuer, subject}]
+	if !ok {
+		return 0, models.ErrNoRecord
+	}
+	return id, nil
+}
+
+func (m *IdentityModel) Link(issuer, subject string, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.users == nil {
+		m.users = make(map[identity]int)
+	}
+	m.users[identity{issuer, subject}] = userID
+	return nil
+}
+
+func (m *IdentityModel) AddSession(token, issuer, subject, sid string, expiry time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions = append(m.sessions, oidcSession{token: token, id: identity{issuer, subject}, sid: sid, expiry: expiry})
+	return nil
+}
+
+func (m *IdentityModel) TakeSessions(issuer, subject, sid string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tokens []string
+	var kept []oidcSession
+	for _, s := range m.sessions {
+		match := s.id.issuer == issuer && s.id.subject == subject
+		if sid != "" {
+			match = s.id.issuer == issuer && s.sid == sid
+		}
+		if match {
+			tokens = append(tokens, s.token)
+		} else {
+			kept = append(kept, s)
+		}
+	}
+	m.sessions = kept
+	return tokens, nil
+}
@@ -0,0 +1,113 @@
+package mocks
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+type loginAttempt struct {
+	id        int64
+	email     string
+	ip        string
+	succeeded bool
+	created   time.Time
+}
+
+// LoginAttemptModel is an in-memory models.LoginAttemptStore. The zero value
+// has no attempts, and it's safe to use from multiple goroutines.
+type LoginAttemptModel struct {
+	mu       sync.Mutex
+	nextID   int64
+	attempts []*loginAttempt
+}
+
+var _ models.LoginAttemptStore = (*LoginAttemptModel)(nil)
+
+func (m *LoginAttemptModel) Begin(email, ip string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	m.attempts = append(m.attempts, &loginAttempt{
+		id:      m.nextID,
+		email:   strings.ToLower(strings.TrimSpace(email)),
+		ip:      ip,
+		created: time.Now().UTC(),
+	})
+	return m.nextID, nil
+}
+
+func (m *LoginAttemptModel) Succeeded(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, a := range m.attempts {
+		if a.id == id {
+			a.succeeded = true
+		}
+	}
+	return nil
+}
+
+func (m *LoginAttemptModel) Cancel(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, a := range m.attempts {
+		if a.id == id {
+			m.attempts = append(m.attempts[:i], m.attempts[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *LoginAttemptModel) Failures(email, ip string, since time.Time, exclude int64) (*models.LoginFailures, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	cutoff := since
+	for _, a := range m.attempts {
+		if a.email == email && a.succeeded && a.created.After(cutoff) {
+			cutoff = a.created
+		}
+	}
+
+	f := &models.LoginFailures{}
+	for _, a := range m.attempts {
+		if a.succeeded || a.id == exclude {
+			continue
+		}
+		if a.email == email && a.created.After(cutoff) {
+			f.Account++
+			f.LastAccountFailure = a.created
+		}
+		if a.ip == ip && a.created.After(since) {
+			f.IP++
+			f.LastIPFailure = a.created
+		}
+	}
+	return f, nil
+}
+
+func (m *LoginAttemptModel) DeleteBefore(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	kept := m.attempts[:0]
+	for _, a := range m.attempts {
+		if a.created.Before(before) {
+			deleted++
+			continue
+		}
+		kept = append(kept, a)
+	}
+	m.attempts = kept
+	return deleted, nil
+}
@@ -0,0 +1,220 @@
+package mocks
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// member is a user's membership of an organization.
+type member struct {
+	orgID   int
+	userID  int
+	role    string
+	created time.Time
+}
+
+// OrgModel is an in-memory models.OrgStore. Members looks up the members'
+// names in Users, which must be set. It's safe to use from multiple
+// goroutines.
+type OrgModel struct {
+	Users *UserModel
+
+	mu      sync.Mutex
+	lastID  int
+	orgs    map[int]*models.Org
+	members []*member
+}
+
+var _ models.OrgStore = (*OrgModel)(nil)
+
+// member returns the user's membership of the organization, or nil. The
+// caller must hold m.mu.
+func (m *OrgModel) member(orgID, userID int) *member {
+	i := slices.IndexFunc(m.members, func(om *member) bool { return om.orgID == orgID && om.userID == userID })
+	if i < 0 {
+		return nil
+	}
+	return m.members[i]
+}
+
+// hasOwner reports whether the organization has an owner. The caller must
+// hold m.mu.
+func (m *OrgModel) hasOwner(orgID int) bool {
+	return slices.ContainsFunc(m.members, func(om *member) bool { return om.orgID == orgID && om.role == models.OrgRoleOwner })
+}
+
+func (m *OrgModel) Insert(name, slug string, ownerID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, o := range m.orgs {
+		if strings.EqualFold(o.Slug, slug) {
+			return 0, models.ErrDuplicateOrgSlug
+		}
+	}
+
+	if m.orgs == nil {
+		m.orgs = make(map[int]*models.Org)
+	}
+	m.lastID++
+	now := time.Now().UTC()
+	m.orgs[m.lastID] = &models.Org{ID: m.lastID, Name: name, Slug: slug, Created: now}
+	m.members = append(m.members, &member{orgID: m.lastID, userID: ownerID, role: models.OrgRoleOwner, created: now})
+	return m.lastID, nil
+}
+
+func (m *OrgModel) Get(id int) (*models.Org, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.orgs[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	c := *o
+	return &c, nil
+}
+
+func (m *OrgModel) GetBySlug(slug string) (*models.Org, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, o := range m.orgs {
+		if strings.EqualFold(o.Slug, slug) {
+			c := *o
+			return &c, nil
+		}
+	}
+	return nil, models.ErrNoRecord
+}
+
+func (m *OrgModel) ForUser(userID int) ([]*models.Org, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	orgs := []*models.Org{}
+	for _, om := range m.members {
+		if om.userID == userID {
+			c := *m.orgs[om.orgID]
+			c.Role = om.role
+			orgs = append(orgs, &c)
+		}
+	}
+	slices.SortFunc(orgs, func(a, b *models.Org) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return a.ID - b.ID
+	})
+	return orgs, nil
+}
+
+func (m *OrgModel) Role(orgID, userID int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	om := m.member(orgID, userID)
+	if om == nil {
+		return "", models.ErrNoRecord
+	}
+	return om.role, nil
+}
+
+func (m *OrgModel) Members(orgID int) ([]*models.OrgMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	members := []*models.OrgMember{}
+	for _, om := range m.members {
+		if om.orgID != orgID {
+			continue
+		}
+		u, err := m.Users.Get(om.userID)
+		if err != nil {
+			continue
+		}
+		members = append(members, &models.OrgMember{
+			UserID:      u.ID,
+			Username:    u.Username,
+			DisplayName: u.DisplayName,
+			Role:        om.role,
+			Created:     om.created,
+		})
+	}
+	slices.SortFunc(members, func(a, b *models.OrgMember) int {
+		if (a.Role == models.OrgRoleOwner) != (b.Role == models.OrgRoleOwner) {
+			if a.Role == models.OrgRoleOwner {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Username, b.Username)
+	})
+	return members, nil
+}
+
+func (m *OrgModel) SetMember(orgID, userID int, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	om := m.member(orgID, userID)
+	if om == nil {
+		m.members = append(m.members, &member{orgID: orgID, userID: userID, role: role, created: time.Now().UTC()})
+		return nil
+	}
+
+	old := om.role
+	om.role = role
+	if !m.hasOwner(orgID) {
+		om.role = old
+		return models.ErrLastOwner
+	}
+	return nil
+}
+
+func (m *OrgModel) RemoveMember(orgID, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	om := m.member(orgID, userID)
+	if om == nil {
+		return models.ErrNoRecord
+	}
+	if om.role == models.OrgRoleOwner {
+		others := slices.ContainsFunc(m.members, func(o *member) bool {
+			return o != om && o.orgID == orgID && o.role == models.OrgRoleOwner
+		})
+		if !others {
+			return models.ErrLastOwner
+		}
+	}
+
+	m.members = slices.DeleteFunc(m.members, func(o *member) bool { return o == om })
+	return nil
+}
+
+func (m *OrgModel) Rename(id int, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if o, ok := m.orgs[id]; ok {
+		o.Name = name
+	}
+	return nil
+}
+
+func (m *OrgModel) Delete(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.orgs[id]; !ok {
+		return models.ErrNoRecord
+	}
+	delete(m.orgs, id)
+	m.members = slices.DeleteFunc(m.members, func(om *member) bool { return om.orgID == id })
+	return nil
+}
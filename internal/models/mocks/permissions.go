@@ -0,0 +1,54 @@
+package mocks
+
+import (
+	"slices"
+	"sync"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// PermissionModel is an in-memory models.PermissionStore. The zero value
+// gives nobody any permissions, and it's safe to use from multiple
+// goroutines.
+type PermissionModel struct {
+	mu          sync.Mutex
+	permissions map[int]models.Permissions
+}
+
+var _ models.PermissionStore = (*PermissionModel)(nil)
+
+func (m *PermissionModel) GetAllForUser(userID int) (models.Permissions, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.permissions[userID]), nil
+}
+
+func (m *PermissionModel) AddForUser(userID int, codes ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.permissions == nil {
+		m.permissions = make(map[int]models.Permissions)
+	}
+	for _, code := range codes {
+		if !m.permissions[userID].Include(code) {
+			m.permissions[userID] = append(m.permissions[userID], code)
+		}
+	}
+	slices.Sort(m.permissions[userID])
+	return nil
+}
+
+func (m *PermissionModel) RemoveForUser(userID int, codes ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.permissions[userID] == nil {
+		return nil
+	}
+	m.permissions[userID] = slices.DeleteFunc(m.permissions[userID], func(code string) bool {
+		return slices.Contains(codes, code)
+	})
+	return nil
+}
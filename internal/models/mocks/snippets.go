@@ -0,0 +1,806 @@
+// Package mocks has in-memory implementations of the model interfaces, so
+// that handlers can be tested without a database. They behave like the MySQL
+// models for the things handlers rely on, like which snippets are visible and
+// which errors are returned, but keep the rest simple: nothing is encrypted,
+// and trending and related snippets are worked out roughly.
+package mocks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// snippet is a stored snippet, with the columns which Snippet doesn't have.
+type snippet struct {
+	models.Snippet
+	passphrase   string
+	heldReason   string
+	pinnedAt     time.Time
+	homePinnedAt time.Time
+	importedFrom string
+}
+
+// SnippetModel is an in-memory models.SnippetStore. The zero value is empty
+// and ready to use, and it's safe to use from multiple goroutines.
+type SnippetModel struct {
+	mu       sync.Mutex
+	lastID   int
+	snippets map[int]*snippet
+	once     map[string]*models.Snippet
+	views    map[int]int
+	// members holds the IDs of the members of each organization, for
+	// GetForUser. Set them with AddOrgMember.
+	members map[int][]int
+}
+
+var _ models.SnippetStore = (*SnippetModel)(nil)
+
+// visible reports whether a snippet would be returned by Get.
+func (s *snippet) visible() bool {
+	now := time.Now()
+	return s.Expires.After(now) && s.heldReason == "" && !s.PublishAt.After(now)
+}
+
+// clone returns a copy of the snippet which the caller can change. Tags are
+// left out, as the MySQL model only loads them when asked to.
+func (s *snippet) clone() *models.Snippet {
+	c := s.Snippet
+	c.Tags = nil
+	return &c
+}
+
+// AddOrgMember records that a user is a member of an organization, so that
+// GetForUser returns the organization's snippets to them.
+func (m *SnippetModel) AddOrgMember(orgID, userID int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.members == nil {
+		m.members = make(map[int][]int)
+	}
+	m.members[orgID] = append(m.members[orgID], userID)
+}
+
+// matching returns copies of the visible snippets which don't belong to an
+// organization and for which keep returns true, newest first.
+func (m *SnippetModel) matching(keep func(s *snippet) bool) []*models.Snippet {
+	return m.find(func(s *snippet) bool { return s.OrgID == 0 && keep(s) })
+}
+
+// find is like matching, but includes snippets belonging to organizations.
+func (m *SnippetModel) find(keep func(s *snippet) bool) []*models.Snippet {
+	var found []*snippet
+	for _, s := range m.snippets {
+		if s.visible() && keep(s) {
+			found = append(found, s)
+		}
+	}
+	slices.SortFunc(found, func(a, b *snippet) int { return b.ID - a.ID })
+
+	snippets := []*models.Snippet{}
+	for _, s := range found {
+		snippets = append(snippets, s.clone())
+	}
+	return snippets
+}
+
+// public returns copies of the snippets with the given IDs which Get would
+// return and which don't belong to an organization, in the order of ids. It's
+// for the other mocks, whose MySQL models join their rows onto snippets.
+func (m *SnippetModel) public(ids []int) []*models.Snippet {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snippets := []*models.Snippet{}
+	for _, id := range ids {
+		if s, ok := m.snippets[id]; ok && s.visible() && s.OrgID == 0 {
+			snippets = append(snippets, s.clone())
+		}
+	}
+	return snippets
+}
+
+// publicBy returns copies of the visible snippets which don't belong to an
+// organization and were created by one of the given users, newest first.
+func (m *SnippetModel) publicBy(userIDs map[int]bool) []*models.Snippet {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.matching(func(s *snippet) bool { return userIDs[s.UserID] })
+}
+
+// page returns one page of snippets, numbered from 1.
+func page[T any](all []T, page, pageSize int) []T {
+	start := min(len(all), (page-1)*pageSize)
+	end := min(len(all), start+pageSize)
+	return all[start:end]
+}
+
+// keysetPage returns the page of snippets that k picks out, like the
+// listings paged through with cursors do. all must be newest first.
+func keysetPage(all []*models.Snippet, k models.Keyset) models.CursorPage {
+	// The snippets are newest first, so the ones newer than a cursor come
+	// before it and the older ones after it.
+	start, end := 0, len(all)
+	switch {
+	case !k.After.IsZero():
+		end = slices.IndexFunc(all, func(s *models.Snippet) bool { return models.CursorFor(s).Compare(k.After) <= 0 })
+		if end < 0 {
+			end = len(all)
+		}
+		start = max(0, end-k.Limit)
+		return models.NewCursorPage(all[start:end], k, start > 0)
+	case !k.Before.IsZero():
+		start = slices.IndexFunc(all, func(s *models.Snippet) bool { return models.CursorFor(s).Compare(k.Before) < 0 })
+		if start < 0 {
+			start = len(all)
+		}
+	}
+
+	end = min(len(all), start+k.Limit)
+	return models.NewCursorPage(all[start:end], k, end < len(all))
+}
+
+func (m *SnippetModel) Insert(ctx context.Context, title string, content string, expires int, userID int, orgID int, passphrase string, language string, heldReason string, publishAt time.Time, tags []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.snippets == nil {
+		m.snippets = make(map[int]*snippet)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if publishAt.IsZero() {
+		publishAt = now
+	}
+
+	m.lastID++
+	m.snippets[m.lastID] = &snippet{
+		Snippet: models.Snippet{
+			ID:        m.lastID,
+			Title:     title,
+			Content:   content,
+			Created:   now,
+			Expires:   now.AddDate(0, 0, expires),
+			UserID:    userID,
+			Protected: passphrase != "",
+			Language:  language,
+			Tags:      slices.Sorted(slices.Values(tags)),
+			Version:   1,
+			PublishAt: publishAt.UTC(),
+			OrgID:     orgID,
+		},
+		passphrase: passphrase,
+		heldReason: heldReason,
+	}
+
+	return m.lastID, nil
+}
+
+func (m *SnippetModel) Get(ctx context.Context, id int) (*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.snippets[id]
+	if !ok || !s.visible() || s.OrgID != 0 {
+		return nil, models.ErrNoRecord
+	}
+	return s.clone(), nil
+}
+
+func (m *SnippetModel) GetForUser(ctx context.Context, id, userID int) (*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.snippets[id]
+	if !ok || !s.visible() || (s.OrgID != 0 && !slices.Contains(m.members[s.OrgID], userID)) {
+		return nil, models.ErrNoRecord
+	}
+	return s.clone(), nil
+}
+
+func (m *SnippetModel) Latest(ctx context.Context) ([]*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	all := m.matching(func(*snippet) bool { return true })
+	return page(all, 1, 10), nil
+}
+
+func (m *SnippetModel) Recent(ctx context.Context, k models.Keyset) (models.CursorPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return keysetPage(m.matching(func(*snippet) bool { return true }), k), nil
+}
+
+func (m *SnippetModel) List(ctx context.Context, filter models.SnippetFilter, f models.Filters) ([]*models.Snippet, models.Metadata, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !slices.Contains(f.SortSafelist, f.Sort) {
+		panic("mocks: unsafe sort parameter: " + f.Sort)
+	}
+
+	all := m.matching(func(s *snippet) bool {
+		return (filter.Tag == "" || slices.Contains(s.Tags, filter.Tag)) &&
+			(filter.Language == "" || s.Language == filter.Language) &&
+			(filter.UserID == 0 || s.UserID == filter.UserID)
+	})
+
+	desc := strings.HasPrefix(f.Sort, "-")
+	slices.SortStableFunc(all, func(a, b *models.Snippet) int {
+		if filter.PinnedFirst {
+			pa, pb := m.snippets[a.ID].pinnedAt, m.snippets[b.ID].pinnedAt
+			if c := pb.Compare(pa); c != 0 {
+				return c
+			}
+		}
+
+		var c int
+		switch strings.TrimPrefix(f.Sort, "-") {
+		case "title":
+			c = strings.Compare(a.Title, b.Title)
+		case "created":
+			c = a.Created.Compare(b.Created)
+		case "expires":
+			c = a.Expires.Compare(b.Expires)
+		}
+		if c == 0 {
+			c = a.ID - b.ID
+		}
+		if desc {
+			c = -c
+		}
+		return c
+	})
+
+	for _, s := range all {
+		s.Tags = slices.Clone(m.snippets[s.ID].Tags)
+	}
+
+	var metadata models.Metadata
+	if len(all) > 0 {
+		metadata = models.Metadata{
+			CurrentPage:  f.Page,
+			PageSize:     f.PageSize,
+			FirstPage:    1,
+			LastPage:     (len(all) + f.PageSize - 1) / f.PageSize,
+			TotalRecords: len(all),
+		}
+	}
+
+	byCreated := strings.TrimPrefix(f.Sort, "-") == "created" && !filter.PinnedFirst
+	if !f.After.IsZero() {
+		if !byCreated {
+			panic("mocks: cursor paging needs a listing sorted by created")
+		}
+
+		start := slices.IndexFunc(all, func(s *models.Snippet) bool {
+			c := models.CursorFor(s).Compare(f.After)
+			return desc && c < 0 || !desc && c > 0
+		})
+		if start < 0 {
+			start = len(all)
+		}
+		all = all[start:]
+
+		metadata = models.Metadata{}
+		if len(all) > 0 {
+			metadata.PageSize = f.PageSize
+		}
+		if len(all) > f.PageSize {
+			all = all[:f.PageSize]
+			metadata.NextCursor = models.CursorFor(all[len(all)-1]).String()
+		}
+		return all, metadata, nil
+	}
+
+	start := (f.Page - 1) * f.PageSize
+	if f.Offset > 0 {
+		start = f.Offset
+	}
+	snippets := all[min(start, len(all)):]
+	snippets = snippets[:min(f.PageSize, len(snippets))]
+	if byCreated && len(snippets) > 0 && start+len(snippets) < len(all) {
+		metadata.NextCursor = models.CursorFor(snippets[len(snippets)-1]).String()
+	}
+	return snippets, metadata, nil
+}
+
+func (m *SnippetModel) Update(ctx context.Context, id, userID int, title, content, language string, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.snippets[id]
+	if !ok || !s.Expires.After(time.Now()) {
+		return models.ErrNoRecord
+	}
+	if version != 0 && version != s.Version {
+		return models.ErrEditConflict
+	}
+
+	s.Title, s.Content, s.Language = title, content, language
+	s.Version++
+	return nil
+}
+
+func (m *SnippetModel) UpdateWithTags(ctx context.Context, id, userID int, title, content, language string, version int, tags []string) error {
+	err := m.Update(ctx, id, userID, title, content, language, version)
+	if err != nil {
+		return err
+	}
+	return m.SetTags(id, tags)
+}
+
+func (m *SnippetModel) Delete(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.snippets[id]; !ok {
+		return models.ErrNoRecord
+	}
+	delete(m.snippets, id)
+	return nil
+}
+
+func (m *SnippetModel) InsertMany(userID int, snippets []models.NewSnippet) ([]int, error) {
+	ids := make([]int, len(snippets))
+	for i, s := range snippets {
+		ids[i], _ = m.Insert(context.Background(), s.Title, s.Content, s.Expires, userID, 0, "", s.Language, s.HeldReason, time.Time{}, s.Tags)
+	}
+	return ids, nil
+}
+
+func (m *SnippetModel) DeleteMany(ids []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		if _, ok := m.snippets[id]; !ok {
+			return models.ErrNoRecord
+		}
+	}
+	for _, id := range ids {
+		delete(m.snippets, id)
+	}
+	return nil
+}
+
+func (m *SnippetModel) Fork(id, userID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.snippets[id]
+	if !ok || !s.visible() {
+		return 0, models.ErrNoRecord
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	m.lastID++
+	m.snippets[m.lastID] = &snippet{
+		Snippet: models.Snippet{
+			ID:         m.lastID,
+			Title:      s.Title,
+			Content:    s.Content,
+			Created:    now,
+			Expires:    s.Expires,
+			UserID:     userID,
+			ForkedFrom: id,
+			Protected:  s.Protected,
+			Language:   s.Language,
+			Tags:       slices.Clone(s.Tags),
+			Version:    1,
+			PublishAt:  now,
+			OrgID:      s.OrgID,
+		},
+		passphrase: s.passphrase,
+	}
+
+	return m.lastID, nil
+}
+
+func (m *SnippetModel) ForksOf(id int) ([]*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.find(func(s *snippet) bool { return s.ForkedFrom == id }), nil
+}
+
+// Related returns the newest snippets which share a tag with the snippet.
+func (m *SnippetModel) Related(ctx context.Context, id, limit int) ([]*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.snippets[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+
+	related := m.matching(func(o *snippet) bool {
+		return o.ID != id && slices.ContainsFunc(o.Tags, func(tag string) bool {
+			return slices.Contains(s.Tags, tag)
+		})
+	})
+	return page(related, 1, limit), nil
+}
+
+// FindDuplicate compares content exactly, rather than ignoring case and
+// whitespace.
+func (m *SnippetModel) FindDuplicate(content string) (*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := m.matching(func(s *snippet) bool { return s.Content == content && s.passphrase == "" })
+	if len(found) == 0 {
+		return nil, models.ErrNoRecord
+	}
+	return found[len(found)-1], nil
+}
+
+func (m *SnippetModel) CheckPassphrase(id int, passphrase string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.snippets[id]
+	if !ok || !s.Expires.After(time.Now()) || s.passphrase == "" {
+		return false, models.ErrNoRecord
+	}
+	return s.passphrase == passphrase, nil
+}
+
+func (m *SnippetModel) SetTags(id int, tags []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.snippets[id]; ok {
+		s.Tags = slices.Sorted(slices.Values(tags))
+	}
+	return nil
+}
+
+func (m *SnippetModel) LoadTags(snippets ...*models.Snippet) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range snippets {
+		s.Tags = nil
+		if stored, ok := m.snippets[s.ID]; ok {
+			s.Tags = slices.Clone(stored.Tags)
+		}
+	}
+	return nil
+}
+
+func (m *SnippetModel) CountTags(tags []string) (map[string]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, s := range m.matching(func(*snippet) bool { return true }) {
+		for _, tag := range m.snippets[s.ID].Tags {
+			if slices.Contains(tags, tag) {
+				counts[tag]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+func (m *SnippetModel) ByMonth(ctx context.Context, year int, month time.Month, k models.Keyset) (models.CursorPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	all := m.matching(func(s *snippet) bool {
+		y, mo, _ := s.Created.UTC().Date()
+		return y == year && mo == month
+	})
+	return keysetPage(all, k), nil
+}
+
+func (m *SnippetModel) ByLanguage(ctx context.Context, language string, k models.Keyset) (models.CursorPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	all := m.matching(func(s *snippet) bool { return s.Language == language })
+	return keysetPage(all, k), nil
+}
+
+func (m *SnippetModel) ByOrg(ctx context.Context, orgID, pageNum, pageSize int) ([]*models.Snippet, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	all := m.find(func(s *snippet) bool { return s.OrgID == orgID })
+	return page(all, pageNum, pageSize), len(all), nil
+}
+
+func (m *SnippetModel) AddViews(counts map[int]int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.views == nil {
+		m.views = make(map[int]int)
+	}
+	for id, n := range counts {
+		if _, ok := m.snippets[id]; ok {
+			m.views[id] += n
+		}
+	}
+	return nil
+}
+
+func (m *SnippetModel) ViewCount(id int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.views[id], nil
+}
+
+// Trending ranks snippets by all their views, whatever the window. Stars
+// aren't counted, since they're kept by another model.
+func (m *SnippetModel) Trending(ctx context.Context, window time.Duration, pageNum, pageSize int) ([]*models.RankedSnippet, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ranked []*models.RankedSnippet
+	for _, s := range m.matching(func(s *snippet) bool { return m.views[s.ID] > 0 }) {
+		views := m.views[s.ID]
+		ranked = append(ranked, &models.RankedSnippet{Snippet: s, Views: views, Score: float64(views)})
+	}
+	slices.SortStableFunc(ranked, func(a, b *models.RankedSnippet) int { return b.Views - a.Views })
+
+	return page(ranked, pageNum, pageSize), len(ranked), nil
+}
+
+func (m *SnippetModel) Held() ([]*models.HeldSnippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var held []*models.HeldSnippet
+	for _, s := range m.snippets {
+		if s.heldReason != "" && s.Expires.After(time.Now()) {
+			held = append(held, &models.HeldSnippet{Snippet: s.clone(), Reason: s.heldReason})
+		}
+	}
+	slices.SortFunc(held, func(a, b *models.HeldSnippet) int { return a.ID - b.ID })
+	return held, nil
+}
+
+func (m *SnippetModel) Hold(id int, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.snippets[id]; ok && s.heldReason == "" {
+		s.heldReason = reason
+	}
+	return nil
+}
+
+func (m *SnippetModel) Approve(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.snippets[id]
+	if !ok || s.heldReason == "" {
+		return models.ErrNoRecord
+	}
+	s.heldReason = ""
+	return nil
+}
+
+func (m *SnippetModel) Reject(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.snippets[id]
+	if !ok || s.heldReason == "" {
+		return models.ErrNoRecord
+	}
+	delete(m.snippets, id)
+	return nil
+}
+
+// scheduled reports whether a snippet would be returned by GetScheduled.
+func (s *snippet) scheduled() bool {
+	now := time.Now()
+	return s.Expires.After(now) && s.heldReason == "" && s.PublishAt.After(now)
+}
+
+func (m *SnippetModel) GetScheduled(id int) (*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.snippets[id]
+	if !ok || !s.scheduled() {
+		return nil, models.ErrNoRecord
+	}
+	return s.clone(), nil
+}
+
+func (m *SnippetModel) Scheduled(userID int) ([]*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var snippets []*models.Snippet
+	for _, s := range m.snippets {
+		if s.UserID == userID && s.scheduled() {
+			snippets = append(snippets, s.clone())
+		}
+	}
+	slices.SortFunc(snippets, func(a, b *models.Snippet) int {
+		if c := a.PublishAt.Compare(b.PublishAt); c != 0 {
+			return c
+		}
+		return a.ID - b.ID
+	})
+	return snippets, nil
+}
+
+func (m *SnippetModel) EachByUser(ctx context.Context, userID int, fn func(*models.Snippet) error) error {
+	m.mu.Lock()
+	var snippets []*models.Snippet
+	for _, s := range m.snippets {
+		if s.UserID == userID {
+			c := s.clone()
+			c.Tags = slices.Clone(s.Tags)
+			snippets = append(snippets, c)
+		}
+	}
+	m.mu.Unlock()
+
+	slices.SortFunc(snippets, func(a, b *models.Snippet) int { return a.ID - b.ID })
+	for _, s := range snippets {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *SnippetModel) Import(userID int, in models.ImportedSnippet) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.snippets {
+		if s.UserID == userID && s.importedFrom == in.Source {
+			return 0, models.ErrAlreadyImported
+		}
+	}
+
+	if m.snippets == nil {
+		m.snippets = make(map[int]*snippet)
+	}
+
+	created := in.Created.UTC().Truncate(time.Second)
+
+	m.lastID++
+	m.snippets[m.lastID] = &snippet{
+		Snippet: models.Snippet{
+			ID:        m.lastID,
+			Title:     in.Title,
+			Content:   in.Content,
+			Created:   created,
+			Expires:   time.Now().UTC().Truncate(time.Second).AddDate(0, 0, in.Expires),
+			UserID:    userID,
+			Language:  in.Language,
+			Version:   1,
+			PublishAt: created,
+		},
+		heldReason:   in.HeldReason,
+		importedFrom: in.Source,
+	}
+
+	return m.lastID, nil
+}
+
+func (m *SnippetModel) InsertOnce(title, content string, expires, userID int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	if m.once == nil {
+		m.once = make(map[string]*models.Snippet)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	m.once[token] = &models.Snippet{
+		Title:   title,
+		Content: content,
+		Created: now,
+		Expires: now.AddDate(0, 0, expires),
+		UserID:  userID,
+	}
+
+	return token, nil
+}
+
+func (m *SnippetModel) OnceExists(token string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.once[token]
+	return ok && s.Expires.After(time.Now()), nil
+}
+
+func (m *SnippetModel) ConsumeOnce(token string) (*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.once[token]
+	if !ok || !s.Expires.After(time.Now()) {
+		return nil, models.ErrNoRecord
+	}
+	delete(m.once, token)
+	return s, nil
+}
+
+func (m *SnippetModel) Pin(id, userID, limit int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.snippets[id]
+	if !ok || s.UserID != userID || !s.Expires.After(time.Now()) {
+		return models.ErrNoRecord
+	}
+	if s.Pinned {
+		return nil
+	}
+
+	pinned := 0
+	for _, o := range m.snippets {
+		if o.UserID == userID && o.Pinned && o.Expires.After(time.Now()) {
+			pinned++
+		}
+	}
+	if pinned >= limit {
+		return models.ErrTooManyPins
+	}
+
+	s.Pinned, s.pinnedAt = true, time.Now()
+	return nil
+}
+
+func (m *SnippetModel) Unpin(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.snippets[id]; ok {
+		s.Pinned, s.pinnedAt = false, time.Time{}
+	}
+	return nil
+}
+
+func (m *SnippetModel) SetAnnouncement(id int, announce bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.snippets[id]; ok {
+		s.Announcement, s.homePinnedAt = announce, time.Time{}
+		if announce {
+			s.homePinnedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (m *SnippetModel) Announcements() ([]*models.Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	announcements := m.matching(func(s *snippet) bool { return s.Announcement })
+	slices.SortStableFunc(announcements, func(a, b *models.Snippet) int {
+		return m.snippets[b.ID].homePinnedAt.Compare(m.snippets[a.ID].homePinnedAt)
+	})
+	return announcements, nil
+}
@@ -0,0 +1,103 @@
+package mocks
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// star is one user's star on a snippet.
+type star struct {
+	userID    int
+	snippetID int
+	created   time.Time
+}
+
+// StarModel is an in-memory models.StarStore. StarredBy returns the starred
+// snippets from Snippets, which must be set. It's safe to use from multiple
+// goroutines.
+type StarModel struct {
+	Snippets *SnippetModel
+
+	mu sync.Mutex
+	// stars are kept in the order they were made.
+	stars []star
+}
+
+var _ models.StarStore = (*StarModel)(nil)
+
+func (m *StarModel) Toggle(userID, snippetID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.stars, func(s star) bool { return s.userID == userID && s.snippetID == snippetID })
+	if i >= 0 {
+		m.stars = slices.Delete(m.stars, i, i+1)
+		return false, nil
+	}
+
+	m.stars = append(m.stars, star{userID: userID, snippetID: snippetID, created: time.Now().UTC()})
+	return true, nil
+}
+
+func (m *StarModel) Count(snippetID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for _, s := range m.stars {
+		if s.snippetID == snippetID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *StarModel) IsStarred(userID, snippetID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.ContainsFunc(m.stars, func(s star) bool { return s.userID == userID && s.snippetID == snippetID }), nil
+}
+
+func (m *StarModel) Counts(snippetIDs []int) (map[int]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[int]int, len(snippetIDs))
+	for _, s := range m.stars {
+		if slices.Contains(snippetIDs, s.snippetID) {
+			counts[s.snippetID]++
+		}
+	}
+	return counts, nil
+}
+
+func (m *StarModel) StarredBy(userID int) ([]*models.Snippet, error) {
+	m.mu.Lock()
+	var ids []int
+	for _, s := range slices.Backward(m.stars) {
+		if s.userID == userID {
+			ids = append(ids, s.snippetID)
+		}
+	}
+	m.mu.Unlock()
+
+	return m.Snippets.public(ids), nil
+}
+
+func (m *StarModel) ByUser(ctx context.Context, userID int) ([]models.Star, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stars := []models.Star{}
+	for _, s := range m.stars {
+		if s.userID == userID {
+			stars = append(stars, models.Star{SnippetID: s.snippetID, Created: s.created})
+		}
+	}
+	return stars, nil
+}
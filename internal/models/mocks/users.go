@@ -0,0 +1,223 @@
+package mocks
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"snippetbox.floccinau.net/internal/models"
+)
+
+// UserModel is an in-memory models.UserStore. The zero value is empty and
+// ready to use, and it's safe to use from multiple goroutines.
+//
+// Tokens are made by the TokenModel, which isn't mocked, so tests give users
+// tokens with AddToken instead. Admins are made by giving them the admin
+// permissions in a PermissionModel.
+type UserModel struct {
+	mu     sync.Mutex
+	lastID int
+	users  map[int]*models.User
+	tokens map[string]int
+}
+
+var _ models.UserStore = (*UserModel)(nil)
+
+// find returns the first user for which match returns true, or nil.
+func (m *UserModel) find(match func(u *models.User) bool) *models.User {
+	for _, u := range m.users {
+		if match(u) {
+			return u
+		}
+	}
+	return nil
+}
+
+func (m *UserModel) Insert(name, username, email, password string) (int, error) {
+	// Passwords are hashed at the lowest cost, so that tests stay quick.
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.find(func(u *models.User) bool { return u.Email == email }) != nil {
+		return 0, models.ErrDuplicateEmail
+	}
+	if m.find(func(u *models.User) bool { return strings.EqualFold(u.Username, username) }) != nil {
+		return 0, models.ErrDuplicateUsername
+	}
+
+	if m.users == nil {
+		m.users = make(map[int]*models.User)
+	}
+
+	m.lastID++
+	m.users[m.lastID] = &models.User{
+		ID:             m.lastID,
+		Name:           name,
+		Username:       username,
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Created:        time.Now().UTC().Truncate(time.Second),
+	}
+
+	return m.lastID, nil
+}
+
+func (m *UserModel) Authenticate(email, password string) (int, error) {
+	m.mu.Lock()
+	u := m.find(func(u *models.User) bool { return u.Email == email })
+	m.mu.Unlock()
+
+	if u == nil {
+		return 0, models.ErrInvalidCredentials
+	}
+
+	err := bcrypt.CompareHashAndPassword(u.HashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return 0, models.ErrInvalidCredentials
+		}
+		return 0, err
+	}
+
+	return u.ID, nil
+}
+
+func (m *UserModel) Get(id int) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return nil, models.ErrNoRecord
+	}
+	c := *u
+	return &c, nil
+}
+
+func (m *UserModel) GetMany(ids []int) (map[int]*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := make(map[int]*models.User, len(ids))
+	for _, id := range ids {
+		if u, ok := m.users[id]; ok {
+			c := *u
+			users[id] = &c
+		}
+	}
+	return users, nil
+}
+
+func (m *UserModel) GetByUsername(username string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.find(func(u *models.User) bool { return strings.EqualFold(u.Username, username) })
+	if u == nil {
+		return nil, models.ErrNoRecord
+	}
+	c := *u
+	return &c, nil
+}
+
+func (m *UserModel) GetByEmail(email string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := m.find(func(u *models.User) bool { return u.Email == email })
+	if u == nil {
+		return nil, models.ErrNoRecord
+	}
+	c := *u
+	return &c, nil
+}
+
+// AddToken gives a user a token, which GetForToken finds them by. Tokens
+// added this way never expire, and have every API scope.
+func (m *UserModel) AddToken(scope, tokenPlaintext string, userID int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.tokens == nil {
+		m.tokens = make(map[string]int)
+	}
+	m.tokens[scope+":"+tokenPlaintext] = userID
+}
+
+func (m *UserModel) GetForToken(scope, tokenPlaintext string) (*models.User, *models.Token, error) {
+	m.mu.Lock()
+	id, ok := m.tokens[scope+":"+tokenPlaintext]
+	m.mu.Unlock()
+
+	if !ok {
+		return nil, nil, models.ErrNoRecord
+	}
+
+	user, err := m.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, &models.Token{UserID: id, Scope: scope, Scopes: models.APIScopes}, nil
+}
+
+func (m *UserModel) UpdateProfile(id int, username, displayName, bio, timeZone string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	taken := m.find(func(u *models.User) bool {
+		return u.ID != id && strings.EqualFold(u.Username, username)
+	})
+	if taken != nil {
+		return models.ErrDuplicateUsername
+	}
+
+	if u, ok := m.users[id]; ok {
+		u.Username, u.DisplayName, u.Bio, u.TimeZone = username, displayName, bio, timeZone
+	}
+	return nil
+}
+
+func (m *UserModel) SetAvatar(id int, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return "", models.ErrNoRecord
+	}
+
+	old := u.AvatarKey
+	u.AvatarKey = key
+	return old, nil
+}
+
+func (m *UserModel) HasAvatar(key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return key != "" && m.find(func(u *models.User) bool { return u.AvatarKey == key }) != nil, nil
+}
+
+func (m *UserModel) Delete(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return models.ErrNoRecord
+	}
+	delete(m.users, id)
+	for token, userID := range m.tokens {
+		if userID == id {
+			delete(m.tokens, token)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// HeldSnippet is a snippet waiting for a moderator, along with the reason it
+// was held.
+type HeldSnippet struct {
+	*Snippet
+	Reason string
+}
+
+// Held returns the unexpired snippets which are held for review, oldest
+// first, so they're reviewed in the order they were posted.
+func (m *SnippetModel) Held() ([]*HeldSnippet, error) {
+	stmt := `SELECT ` + snippetColumns + `, snippets.held_reason
+	FROM snippets
+	WHERE expires > NOW() AND held_reason IS NOT NULL
+	ORDER BY id`
+
+	rows, err := retrying(m.DB).Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var held []*HeldSnippet
+	for rows.Next() {
+		h := &HeldSnippet{}
+		h.Snippet, err = scanSnippet(reasonScanner{rows, &h.Reason}, m.Keys)
+		if err != nil {
+			return nil, err
+		}
+		held = append(held, h)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	snippets := make([]*Snippet, len(held))
+	for i, h := range held {
+		snippets[i] = h.Snippet
+	}
+	if err = m.LoadTags(snippets...); err != nil {
+		return nil, err
+	}
+
+	return held, nil
+}
+
+// reasonScanner scans a trailing held_reason column into reason, and the
+// columns before it into the destinations it's given, so that scanSnippet
+// can be used on rows which end with the reason.
+type reasonScanner struct {
+	scanner
+	reason *string
+}
+
+func (r reasonScanner) Scan(dest ...any) error {
+	return r.scanner.Scan(append(dest, r.reason)...)
+}
+
+// Approve publishes a held snippet. It returns ErrNoRecord if the snippet
+// doesn't exist or isn't held.
+func (m *SnippetModel) Approve(id int) error {
+	result, err := retrying(m.DB).Exec("UPDATE snippets SET held_reason = NULL WHERE id = ? AND held_reason IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Hold hides a published snippet until a moderator has reviewed it. Holding
+// a snippet which is already held changes nothing.
+func (m *SnippetModel) Hold(id int, reason string) error {
+	_, err := retrying(m.DB).Exec("UPDATE snippets SET held_reason = ? WHERE id = ? AND held_reason IS NULL", reason, id)
+	return err
+}
+
+// Reject deletes a held snippet. It returns ErrNoRecord if the snippet
+// doesn't exist or isn't held, so a published snippet can't be deleted by
+// mistake from the moderation queue.
+func (m *SnippetModel) Reject(id int) error {
+	result, err := retrying(m.DB).Exec("DELETE FROM snippets WHERE id = ? AND held_reason IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// ContentHashModel records hashes of posted content, so that the same
+// content being posted over and over can be spotted. It satisfies the
+// moderation.HashStore interface.
+type ContentHashModel struct {
+	DB *sql.DB
+}
+
+// SeenHash records that hash was seen now, and returns how many times it's
+// been seen since the given time. Older records are no longer needed, so
+// they're deleted at the same time.
+func (m *ContentHashModel) SeenHash(ctx context.Context, hash string, since time.Time) (int, error) {
+	_, err := retrying(m.DB).ExecContext(ctx, "DELETE FROM content_hashes WHERE created < ?", since.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = retrying(m.DB).ExecContext(ctx, "INSERT INTO content_hashes (hash, created) VALUES(?, UTC_TIMESTAMP())", hash)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	err = retrying(m.DB).QueryRowContext(ctx, "SELECT COUNT(*) FROM content_hashes WHERE hash = ? AND created >= ?", hash, since.UTC()).Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+
+	"snippetbox.floccinau.net/internal/crypto"
+)
+
+// onceTokenBytes is the length of the random share token, which doubles as
+// the AES-256 key.
+const onceTokenBytes = 32
+
+// onceKey decodes a share token into the encryption key and the hash that the
+// row is stored under.
+func onceKey(token string) (key []byte, hash string, err error) {
+	key, err = base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(key) != onceTokenBytes {
+		return nil, "", ErrNoRecord
+	}
+
+	sum := sha256.Sum256(key)
+	return key, hex.EncodeToString(sum[:]), nil
+}
+
+// InsertOnce stores a burn-after-reading snippet and returns its share token.
+// The token is the only way to read the snippet, and it isn't stored, so it
+// must be shown to the user straight away.
+//
+// Burn-after-reading snippets live in their own once_snippets table, so that
+// they never show up in listings, searches or the API. Their title and
+// content are encrypted with AES-256-GCM under a random key which is only
+// ever given to the person who created the snippet, as the share token. The
+// database just stores a SHA-256 hash of the token to look the row up by, so
+// without the link nobody (including us) can read the snippet.
+func (m *SnippetModel) InsertOnce(title, content string, expires, userID int) (string, error) {
+	key := make([]byte, onceTokenBytes)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(key)
+
+	_, hash, err := onceKey(token)
+	if err != nil {
+		return "", err
+	}
+
+	sealedTitle, err := crypto.Seal(key, []byte(title))
+	if err != nil {
+		return "", err
+	}
+	sealedContent, err := crypto.Seal(key, []byte(content))
+	if err != nil {
+		return "", err
+	}
+
+	stmt := `INSERT INTO once_snippets (token_hash, title, content, user_id, created, expires)
+	VALUES(?, ?, ?, ?, NOW(), DATE_ADD(NOW(), INTERVAL ? DAY))`
+
+	owner := sql.NullInt64{Int64: int64(userID), Valid: userID != 0}
+
+	_, err = retrying(m.DB).Exec(stmt, hash, sealedTitle, sealedContent, owner, expires)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// OnceExists reports whether there is an unread, unexpired burn-after-reading
+// snippet for the token, without reading it.
+func (m *SnippetModel) OnceExists(token string) (bool, error) {
+	_, hash, err := onceKey(token)
+	if err != nil {
+		return false, nil
+	}
+
+	var exists bool
+	stmt := "SELECT EXISTS(SELECT true FROM once_snippets WHERE expires > NOW() AND token_hash = ?)"
+
+	err = retrying(m.DB).QueryRow(stmt, hash).Scan(&exists)
+	return exists, err
+}
+
+// ConsumeOnce returns the burn-after-reading snippet for the token and
+// deletes it, in one transaction, so that it can only ever be read once. If
+// the token is wrong, or the snippet has already been read or has expired,
+// it returns ErrNoRecord. The returned Snippet has no ID, since there is
+// nothing left to link to.
+func (m *SnippetModel) ConsumeOnce(token string) (*Snippet, error) {
+	key, hash, err := onceKey(token)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snippet{}
+	err = withTx(m.DB, func(q Queries) error {
+		// Lock the row, so that two simultaneous requests can't both read it.
+		var id int
+		var sealedTitle, sealedContent []byte
+		var owner sql.NullInt64
+
+		stmt := `SELECT id, title, content, user_id, created, expires FROM once_snippets
+		WHERE expires > NOW() AND token_hash = ? FOR UPDATE`
+
+		err := q.QueryRow(stmt, hash).Scan(&id, &sealedTitle, &sealedContent, &owner, &s.Created, &s.Expires)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNoRecord
+			}
+			return err
+		}
+
+		s.UserID = int(owner.Int64)
+
+		title, err := crypto.Open(key, sealedTitle)
+		if err != nil {
+			return err
+		}
+		content, err := crypto.Open(key, sealedContent)
+		if err != nil {
+			return err
+		}
+		s.Title, s.Content = string(title), string(content)
+
+		_, err = q.Exec("DELETE FROM once_snippets WHERE id = ?", id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
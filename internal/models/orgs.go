@@ -0,0 +1,259 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// The roles a member of an organization can have. Members can see and write
+// the organization's snippets; owners can also change its settings and who
+// its members are.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleMember = "member"
+)
+
+// OrgRoles lists the roles, in the order they're offered in forms.
+var OrgRoles = []string{OrgRoleMember, OrgRoleOwner}
+
+// Define an Org type to hold an organization. Role is the role of the user
+// it was looked up for, and is only set by ForUser.
+type Org struct {
+	ID      int
+	Name    string
+	Slug    string
+	Created time.Time
+	Role    string
+}
+
+// Define an OrgMember type to hold one member of an organization, with the
+// parts of their user record which are shown on the settings page.
+type OrgMember struct {
+	UserID      int
+	Username    string
+	DisplayName string
+	Role        string
+	Created     time.Time
+}
+
+// Define an OrgModel type which wraps a database connection pool.
+type OrgModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a new organization, with the given user as its first owner,
+// and returns its ID.
+func (m *OrgModel) Insert(name, slug string, ownerID int) (int, error) {
+	var id int64
+	err := withTx(m.DB, func(q Queries) error {
+		result, err := q.Exec(`INSERT INTO orgs (name, slug, created) VALUES (?, ?, UTC_TIMESTAMP())`, name, slug)
+		if err != nil {
+			var mySQLError *mysql.MySQLError
+			if errors.As(err, &mySQLError) {
+				if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "orgs_uc_slug") {
+					return ErrDuplicateOrgSlug
+				}
+			}
+			return err
+		}
+
+		id, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		_, err = q.Exec(`INSERT INTO org_members (org_id, user_id, role, created)
+		VALUES (?, ?, ?, UTC_TIMESTAMP())`, id, ownerID, OrgRoleOwner)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Get returns an organization by its ID.
+func (m *OrgModel) Get(id int) (*Org, error) {
+	return m.getWhere("id = ?", id)
+}
+
+// GetBySlug returns an organization by its slug.
+func (m *OrgModel) GetBySlug(slug string) (*Org, error) {
+	return m.getWhere("slug = ?", slug)
+}
+
+func (m *OrgModel) getWhere(where string, arg any) (*Org, error) {
+	o := &Org{}
+
+	err := retrying(m.DB).QueryRow(`SELECT id, name, slug, created FROM orgs WHERE `+where, arg).Scan(&o.ID, &o.Name, &o.Slug, &o.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// ForUser returns the organizations which the user is a member of, in
+// alphabetical order, with Role set to the user's role in each.
+func (m *OrgModel) ForUser(userID int) ([]*Org, error) {
+	stmt := `SELECT orgs.id, orgs.name, orgs.slug, orgs.created, org_members.role
+	FROM orgs INNER JOIN org_members ON org_members.org_id = orgs.id
+	WHERE org_members.user_id = ?
+	ORDER BY orgs.name, orgs.id`
+
+	rows, err := retrying(m.DB).Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*Org{}
+	for rows.Next() {
+		o := &Org{}
+
+		err := rows.Scan(&o.ID, &o.Name, &o.Slug, &o.Created, &o.Role)
+		if err != nil {
+			return nil, err
+		}
+
+		orgs = append(orgs, o)
+	}
+
+	return orgs, rows.Err()
+}
+
+// Role returns the user's role in the organization. It returns ErrNoRecord
+// if they aren't a member.
+func (m *OrgModel) Role(orgID, userID int) (string, error) {
+	var role string
+
+	err := retrying(m.DB).QueryRow(`SELECT role FROM org_members WHERE org_id = ? AND user_id = ?`, orgID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoRecord
+		}
+		return "", err
+	}
+
+	return role, nil
+}
+
+// Members returns the members of the organization, owners first.
+func (m *OrgModel) Members(orgID int) ([]*OrgMember, error) {
+	stmt := `SELECT users.id, users.username, users.display_name, org_members.role, org_members.created
+	FROM org_members INNER JOIN users ON users.id = org_members.user_id
+	WHERE org_members.org_id = ?
+	ORDER BY org_members.role = 'owner' DESC, users.username`
+
+	rows, err := retrying(m.DB).Query(stmt, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*OrgMember{}
+	for rows.Next() {
+		om := &OrgMember{}
+
+		err := rows.Scan(&om.UserID, &om.Username, &om.DisplayName, &om.Role, &om.Created)
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, om)
+	}
+
+	return members, rows.Err()
+}
+
+// SetMember adds the user to the organization with the given role, or
+// changes their role if they're already a member. It returns ErrLastOwner,
+// and changes nothing, if that would leave the organization with no owner.
+func (m *OrgModel) SetMember(orgID, userID int, role string) error {
+	return withTx(m.DB, func(q Queries) error {
+		_, err := q.Exec(`INSERT INTO org_members (org_id, user_id, role, created)
+		VALUES (?, ?, ?, UTC_TIMESTAMP())
+		ON DUPLICATE KEY UPDATE role = VALUES(role)`, orgID, userID, role)
+		if err != nil {
+			return err
+		}
+
+		return checkOwners(q, orgID)
+	})
+}
+
+// RemoveMember takes the user out of the organization. It returns
+// ErrNoRecord if they aren't a member, and ErrLastOwner, changing nothing,
+// if they're its only owner.
+func (m *OrgModel) RemoveMember(orgID, userID int) error {
+	return withTx(m.DB, func(q Queries) error {
+		result, err := q.Exec(`DELETE FROM org_members WHERE org_id = ? AND user_id = ?`, orgID, userID)
+		if err != nil {
+			return err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNoRecord
+		}
+
+		return checkOwners(q, orgID)
+	})
+}
+
+// checkOwners returns ErrLastOwner if the organization has no owners left,
+// so that the transaction it's called in is rolled back. The owners' rows
+// are locked, so that two owners can't both step down at once.
+func checkOwners(q Queries, orgID int) error {
+	rows, err := q.Query(`SELECT user_id FROM org_members WHERE org_id = ? AND role = ? FOR UPDATE`, orgID, OrgRoleOwner)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return ErrLastOwner
+	}
+
+	return nil
+}
+
+// Rename changes the organization's name. Its slug stays the same, so that
+// links to it keep working.
+func (m *OrgModel) Rename(id int, name string) error {
+	_, err := retrying(m.DB).Exec(`UPDATE orgs SET name = ? WHERE id = ?`, name, id)
+	return err
+}
+
+// Delete deletes the organization. Its memberships and snippets are deleted
+// along with it.
+func (m *OrgModel) Delete(id int) error {
+	result, err := retrying(m.DB).Exec(`DELETE FROM orgs WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
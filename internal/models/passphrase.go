@@ -0,0 +1,94 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// The argon2id parameters for snippet passphrases, as recommended by RFC 9106
+// for memory-constrained environments. They're stored in each hash, so they
+// can be raised later without breaking existing snippets.
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonKeyLen  = 32
+	argonSaltLen = 16
+)
+
+// hashPassphrase returns an argon2id hash of the passphrase in the usual PHC
+// string format: $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>.
+func hashPassphrase(passphrase string) (string, error) {
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(passphrase), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkPassphrase reports whether the passphrase matches an encoded hash from
+// hashPassphrase.
+func checkPassphrase(encoded, passphrase string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, errors.New("models: invalid passphrase hash")
+	}
+
+	var version int
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, errors.New("models: unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, errors.New("models: invalid argon2 parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, err
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, err
+	}
+
+	got := argon2.IDKey([]byte(passphrase), salt, time, memory, threads, uint32(len(want)))
+
+	// Compare in constant time, so the comparison doesn't leak how much of
+	// the hash matched.
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+// CheckPassphrase reports whether the passphrase unlocks an unexpired,
+// passphrase-protected snippet. It returns ErrNoRecord if there's no such
+// snippet or it doesn't have a passphrase.
+func (m *SnippetModel) CheckPassphrase(id int, passphrase string) (bool, error) {
+	var hash sql.NullString
+
+	stmt := "SELECT passphrase_hash FROM snippets WHERE expires > NOW() AND id = ?"
+
+	err := retrying(m.DB).QueryRow(stmt, id).Scan(&hash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrNoRecord
+		}
+		return false, err
+	}
+	if !hash.Valid {
+		return false, ErrNoRecord
+	}
+
+	return checkPassphrase(hash.String, passphrase)
+}
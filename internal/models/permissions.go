@@ -0,0 +1,97 @@
+package models
+
+import (
+	"database/sql"
+	"slices"
+)
+
+// The permissions which can be given to users. Everyone who signs up can
+// write snippets; the admin permissions are given out by hand.
+const (
+	PermissionSnippetsWrite = "snippets:write"
+	PermissionAdminModerate = "admin:moderate"
+	PermissionAdminSystem   = "admin:system"
+)
+
+// AllPermissions lists every permission code.
+var AllPermissions = []string{PermissionSnippetsWrite, PermissionAdminModerate, PermissionAdminSystem}
+
+// DefaultPermissions are the permissions a new user is given at signup.
+var DefaultPermissions = []string{PermissionSnippetsWrite}
+
+// Define a Permissions slice, which we will use to hold the permission codes
+// (like "snippets:write" and "admin:moderate") for a single user.
+type Permissions []string
+
+// Include checks whether the Permissions slice contains a specific permission
+// code.
+func (p Permissions) Include(code string) bool {
+	return slices.Contains(p, code)
+}
+
+// Define the PermissionModel type.
+type PermissionModel struct {
+	DB *sql.DB
+}
+
+// GetAllForUser returns all permission codes for a specific user.
+func (m *PermissionModel) GetAllForUser(userID int) (Permissions, error) {
+	stmt := `SELECT permissions.code
+	FROM permissions
+	INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+	WHERE users_permissions.user_id = ?
+	ORDER BY permissions.code`
+
+	rows, err := retrying(m.DB).Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+// AddForUser gives a user the permissions with the given codes. Permissions
+// they already have are left as they are.
+func (m *PermissionModel) AddForUser(userID int, codes ...string) error {
+	for _, code := range codes {
+		stmt := `INSERT IGNORE INTO users_permissions (user_id, permission_id)
+		SELECT ?, permissions.id FROM permissions WHERE permissions.code = ?`
+
+		_, err := retrying(m.DB).Exec(stmt, userID, code)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RemoveForUser takes the permissions with the given codes away from a
+// user. Permissions they don't have are ignored.
+func (m *PermissionModel) RemoveForUser(userID int, codes ...string) error {
+	for _, code := range codes {
+		stmt := `DELETE users_permissions FROM users_permissions
+		INNER JOIN permissions ON permissions.id = users_permissions.permission_id
+		WHERE users_permissions.user_id = ? AND permissions.code = ?`
+
+		_, err := retrying(m.DB).Exec(stmt, userID, code)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Pin pins a snippet to the top of its owner's profile. An owner can have up
+// to limit pinned snippets; pinning another returns ErrTooManyPins. Pinning a
+// snippet which is already pinned does nothing. It returns ErrNoRecord if
+// the snippet doesn't belong to the user.
+func (m *SnippetModel) Pin(id, userID, limit int) error {
+	return withTx(m.DB, func(q Queries) error {
+		var pinnedAt sql.NullTime
+		stmt := `SELECT pinned_at FROM snippets WHERE id = ? AND user_id = ? AND expires > NOW() FOR UPDATE`
+		err := q.QueryRow(stmt, id, userID).Scan(&pinnedAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNoRecord
+			}
+			return err
+		}
+		if pinnedAt.Valid {
+			return nil
+		}
+
+		// Lock the owner's pinned snippets too, so that pinning two at once
+		// can't go over the limit.
+		var pinned int
+		stmt = `SELECT COUNT(*) FROM snippets
+		WHERE user_id = ? AND pinned_at IS NOT NULL AND expires > NOW() FOR UPDATE`
+		err = q.QueryRow(stmt, userID).Scan(&pinned)
+		if err != nil {
+			return err
+		}
+		if pinned >= limit {
+			return ErrTooManyPins
+		}
+
+		_, err = q.Exec("UPDATE snippets SET pinned_at = UTC_TIMESTAMP() WHERE id = ?", id)
+		return err
+	})
+}
+
+// Unpin takes a snippet off the top of its owner's profile.
+func (m *SnippetModel) Unpin(id int) error {
+	_, err := retrying(m.DB).Exec("UPDATE snippets SET pinned_at = NULL WHERE id = ?", id)
+	return err
+}
+
+// SetAnnouncement pins a snippet to the home page as an announcement, or
+// unpins it if announce is false.
+func (m *SnippetModel) SetAnnouncement(id int, announce bool) error {
+	_, err := retrying(m.DB).Exec("UPDATE snippets SET home_pinned_at = IF(?, UTC_TIMESTAMP(), NULL) WHERE id = ?", announce, id)
+	return err
+}
+
+// Announcements returns the unexpired snippets which admins have pinned to
+// the home page, most recently pinned first.
+func (m *SnippetModel) Announcements() ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets
+	WHERE home_pinned_at IS NOT NULL AND expires > NOW() AND held_reason IS NULL
+	AND publish_at <= UTC_TIMESTAMP() AND org_id IS NULL
+	ORDER BY home_pinned_at DESC, id DESC`
+
+	rows, err := retrying(m.DB).Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []*Snippet
+	for rows.Next() {
+		s, err := scanSnippet(rows, m.Keys)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	return snippets, rows.Err()
+}
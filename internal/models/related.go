@@ -0,0 +1,142 @@
+package models
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// relatedCandidates is the most snippets Related scores. The candidates are
+// the newest snippets sharing a tag or a title word with the snippet.
+const relatedCandidates = 200
+
+// tagWeight is how many title words a shared tag counts as when Related
+// scores snippets.
+const tagWeight = 3
+
+// stopWords are common words which don't say anything about what a snippet
+// is about, so they're ignored when comparing titles.
+var stopWords = map[string]bool{
+	"and": true, "are": true, "but": true, "for": true, "from": true,
+	"how": true, "into": true, "not": true, "the": true, "this": true,
+	"that": true, "use": true, "using": true, "with": true, "you": true,
+	"your": true, "what": true, "when": true, "why": true,
+}
+
+// titleTerms returns the distinct words of a title which are worth comparing:
+// lower case, at least three characters long and not stop words.
+func titleTerms(title string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var terms []string
+	for _, f := range fields {
+		if len([]rune(f)) < 3 || stopWords[f] || slices.Contains(terms, f) {
+			continue
+		}
+		terms = append(terms, f)
+	}
+	return terms
+}
+
+// Related returns up to limit unexpired snippets which are like the one with
+// the given ID, most alike first. Snippets are alike when they share tags and
+// words in their titles, with each shared tag counting for tagWeight words.
+// Snippets with nothing in common aren't returned.
+func (m *SnippetModel) Related(ctx context.Context, id, limit int) ([]*Snippet, error) {
+	var title string
+	err := retrying(m.DB).QueryRowContext(ctx, `SELECT title FROM snippets WHERE id = ?`, id).Scan(&title)
+	if err != nil {
+		return nil, err
+	}
+	terms := titleTerms(title)
+
+	// Candidates share a tag, or have a title containing one of the words.
+	// The words are compared properly once they've been fetched, since LIKE
+	// also matches parts of words.
+	match := []string{`EXISTS (SELECT 1 FROM snippet_tags a
+		INNER JOIN snippet_tags b ON b.tag = a.tag
+		WHERE a.snippet_id = ? AND b.snippet_id = snippets.id)`}
+	// The ID is used for the shared tag count, to leave out the snippet
+	// itself and for the tag match, in that order.
+	args := []any{id, id, id}
+	for _, term := range terms {
+		// Terms are only letters and digits, so there's nothing in them for
+		// LIKE to treat specially.
+		match = append(match, `snippets.title LIKE ?`)
+		args = append(args, "%"+term+"%")
+	}
+
+	stmt := `SELECT ` + snippetColumns + `, (SELECT COUNT(*) FROM snippet_tags a
+		INNER JOIN snippet_tags b ON b.tag = a.tag
+		WHERE a.snippet_id = ? AND b.snippet_id = snippets.id)
+	FROM snippets
+	WHERE snippets.id <> ? AND snippets.expires > NOW() AND snippets.held_reason IS NULL
+	AND snippets.publish_at <= UTC_TIMESTAMP() AND snippets.org_id IS NULL
+	AND (` + strings.Join(match, " OR ") + `)
+	ORDER BY snippets.created DESC, snippets.id DESC
+	LIMIT ?`
+
+	args = append(args, relatedCandidates)
+
+	rows, err := retrying(m.DB).QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type candidate struct {
+		snippet *Snippet
+		score   int
+	}
+	var candidates []candidate
+
+	for rows.Next() {
+		var sharedTags int
+		s, err := scanSnippet(trailingIntScanner{rows, &sharedTags}, m.Keys)
+		if err != nil {
+			return nil, err
+		}
+
+		score := tagWeight * sharedTags
+		for _, term := range titleTerms(s.Title) {
+			if slices.Contains(terms, term) {
+				score++
+			}
+		}
+		if score > 0 {
+			candidates = append(candidates, candidate{s, score})
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The candidates are newest first, so a stable sort keeps newer snippets
+	// ahead of older ones with the same score.
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		return b.score - a.score
+	})
+
+	related := make([]*Snippet, 0, min(limit, len(candidates)))
+	for _, c := range candidates[:min(limit, len(candidates))] {
+		related = append(related, c.snippet)
+	}
+
+	return related, nil
+}
+
+// trailingIntScanner scans a trailing integer column into n, and the columns
+// before it into the destinations it's given, so that scanSnippet can be used
+// on rows which end with one.
+type trailingIntScanner struct {
+	scanner
+	n *int
+}
+
+func (t trailingIntScanner) Scan(dest ...any) error {
+	return t.scanner.Scan(append(dest, t.n)...)
+}
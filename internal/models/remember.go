@@ -0,0 +1,159 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+// rememberGrace is how long the previous verifier of a remember-me token
+// is still accepted after it's rotated. Browsers often send several
+// requests at once, and all but the first carry the old cookie.
+const rememberGrace = time.Minute
+
+// Define a RememberToken type to hold a remember-me token. Verifier is the
+// plaintext, which is only known when the token is made or rotated.
+type RememberToken struct {
+	Selector string
+	Verifier string
+	UserID   int
+	Expiry   time.Time
+}
+
+// randomString returns n random bytes encoded as URL-safe base64.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Define a RememberTokenModel type which wraps a database connection pool.
+type RememberTokenModel struct {
+	DB *sql.DB
+}
+
+// New makes a remember-me token for the user which lasts for ttl.
+func (m *RememberTokenModel) New(userID int, ttl time.Duration) (*RememberToken, error) {
+	selector, err := randomString(18)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &RememberToken{
+		Selector: selector,
+		Verifier: verifier,
+		UserID:   userID,
+		Expiry:   time.Now().Add(ttl),
+	}
+
+	stmt := `INSERT INTO remember_tokens (selector, hash, rotated, user_id, expiry, created)
+	VALUES (?, ?, UTC_TIMESTAMP(), ?, ?, UTC_TIMESTAMP())`
+
+	hash := sha256.Sum256([]byte(verifier))
+	_, err = retrying(m.DB).Exec(stmt, selector, hash[:], userID, token.Expiry.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Use checks a remember-me cookie's selector and verifier, and returns the
+// token with a new verifier to send back in place of the old one. If the
+// previous verifier is presented within rememberGrace of it being replaced,
+// the token is returned with an empty Verifier, and the cookie should be
+// left as it is. It returns ErrNoRecord if there's no such token or it has
+// expired.
+//
+// Any other verifier means the cookie was copied and has been used by
+// someone else since. Every one of the user's tokens is deleted, and
+// ErrRememberTokenReused is returned along with the token, so that the
+// caller knows whose they were.
+func (m *RememberTokenModel) Use(selector, verifier string) (*RememberToken, error) {
+	token := &RememberToken{Selector: selector}
+
+	// An expired or reused token is deleted, and the transaction must be
+	// committed for that to stick, so the callback only notes which it was
+	// and the error is returned afterwards.
+	var expired, reused bool
+
+	err := withTx(m.DB, func(q Queries) error {
+		expired, reused = false, false
+
+		stmt := `SELECT hash, previous_hash, rotated, user_id, expiry FROM remember_tokens
+		WHERE selector = ? FOR UPDATE`
+
+		var hash, previousHash []byte
+		var rotated time.Time
+		err := q.QueryRow(stmt, selector).Scan(&hash, &previousHash, &rotated, &token.UserID, &token.Expiry)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNoRecord
+			}
+			return err
+		}
+
+		if time.Now().After(token.Expiry) {
+			expired = true
+			_, err := q.Exec(`DELETE FROM remember_tokens WHERE selector = ?`, selector)
+			return err
+		}
+
+		presented := sha256.Sum256([]byte(verifier))
+		switch {
+		case subtle.ConstantTimeCompare(presented[:], hash) == 1:
+			token.Verifier, err = randomString(32)
+			if err != nil {
+				return err
+			}
+
+			next := sha256.Sum256([]byte(token.Verifier))
+			stmt := `UPDATE remember_tokens SET hash = ?, previous_hash = ?, rotated = UTC_TIMESTAMP()
+			WHERE selector = ?`
+
+			_, err = q.Exec(stmt, next[:], hash, selector)
+			return err
+		case previousHash != nil && subtle.ConstantTimeCompare(presented[:], previousHash) == 1 && time.Since(rotated) < rememberGrace:
+			return nil
+		}
+
+		reused = true
+		_, err = q.Exec(`DELETE FROM remember_tokens WHERE user_id = ?`, token.UserID)
+		return err
+	})
+	switch {
+	case err != nil:
+		return nil, err
+	case expired:
+		return nil, ErrNoRecord
+	case reused:
+		return token, ErrRememberTokenReused
+	}
+
+	return token, nil
+}
+
+// Delete deletes the remember-me token with the selector, when the user
+// logs out. It's not an error if there isn't one.
+func (m *RememberTokenModel) Delete(selector string) error {
+	_, err := retrying(m.DB).Exec(`DELETE FROM remember_tokens WHERE selector = ?`, selector)
+	return err
+}
+
+// DeleteAllForUser deletes all of the user's remember-me tokens.
+func (m *RememberTokenModel) DeleteAllForUser(userID int) error {
+	_, err := retrying(m.DB).Exec(`DELETE FROM remember_tokens WHERE user_id = ?`, userID)
+	return err
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"snippetbox.floccinau.net/internal/testutils"
+)
+
+// countRememberTokens returns how many remember-me tokens the user has.
+func countRememberTokens(t *testing.T, m *RememberTokenModel, userID int) int {
+	t.Helper()
+
+	var n int
+	err := m.DB.QueryRow("SELECT COUNT(*) FROM remember_tokens WHERE user_id = ?", userID).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestRememberTokenModelUse(t *testing.T) {
+	m := &RememberTokenModel{DB: testutils.NewTestDB(t)}
+
+	// Alice, from the fixtures, is user 1.
+	const userID = 1
+
+	t.Run("Rotated", func(t *testing.T) {
+		token, err := m.New(userID, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := m.Use(token.Selector, token.Verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.UserID != userID {
+			t.Errorf("got user %d; want %d", got.UserID, userID)
+		}
+		if got.Verifier == "" || got.Verifier == token.Verifier {
+			t.Errorf("want a new verifier")
+		}
+
+		err = m.DeleteAllForUser(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		token, err := m.New(userID, -time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = m.Use(token.Selector, token.Verifier)
+		if !errors.Is(err, ErrNoRecord) {
+			t.Fatalf("got error %v; want %v", err, ErrNoRecord)
+		}
+		if n := countRememberTokens(t, m, userID); n != 0 {
+			t.Errorf("got %d tokens after using an expired one; want 0", n)
+		}
+	})
+
+	t.Run("Reused", func(t *testing.T) {
+		token, err := m.New(userID, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		other, err := m.New(userID, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := m.Use(token.Selector, "a verifier from a copied cookie")
+		if !errors.Is(err, ErrRememberTokenReused) {
+			t.Fatalf("got error %v; want %v", err, ErrRememberTokenReused)
+		}
+		if got == nil || got.UserID != userID {
+			t.Fatalf("got token %+v; want one for user %d", got, userID)
+		}
+
+		// Every one of the user's tokens is gone, not just the reused one.
+		if n := countRememberTokens(t, m, userID); n != 0 {
+			t.Errorf("got %d tokens after a reuse; want 0", n)
+		}
+		_, err = m.Use(other.Selector, other.Verifier)
+		if !errors.Is(err, ErrNoRecord) {
+			t.Errorf("got error %v using another token; want %v", err, ErrNoRecord)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Replicas sends read-only queries to read replicas of the primary database,
+// taking turns between them. A replica which can't be reached is taken out
+// of rotation until Check finds it answering again, and while none are left
+// reads go to the primary. Writes always go to the primary. A nil *Replicas
+// has no replicas, so everything goes to the primary.
+type Replicas struct {
+	replicas []*replica
+	next     atomic.Uint32
+}
+
+// replica is the connection pool for one read replica, with the statements
+// prepared on it.
+type replica struct {
+	name    string
+	stmts   *StmtCache
+	healthy atomic.Bool
+
+	mu  sync.Mutex
+	err error
+}
+
+// ReplicaStatus is the health of a replica, as of its last check or the last
+// query which couldn't reach it.
+type ReplicaStatus struct {
+	Name    string      `json:"name"`
+	Healthy bool        `json:"healthy"`
+	Error   string      `json:"error,omitempty"`
+	Pool    sql.DBStats `json:"pool"`
+}
+
+// Add adds the connection pool for a replica, with a name to report it by,
+// like its address. It's taken to be healthy until it's checked. Add must
+// only be called before r is used.
+func (r *Replicas) Add(name string, db *sql.DB) {
+	rep := &replica{name: name, stmts: NewStmtCache(db)}
+	rep.healthy.Store(true)
+	r.replicas = append(r.replicas, rep)
+}
+
+// Len returns how many replicas there are, healthy or not.
+func (r *Replicas) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.replicas)
+}
+
+// Check pings each replica, putting those which answer back into rotation
+// and taking out those which don't. It returns the status of each replica
+// whose health changed.
+func (r *Replicas) Check(ctx context.Context) []ReplicaStatus {
+	if r == nil {
+		return nil
+	}
+
+	// The replicas are pinged at once, so that one which hangs doesn't use
+	// up the time the others have to answer.
+	errs := make([]error, len(r.replicas))
+	var wg sync.WaitGroup
+	for i, rep := range r.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = rep.stmts.DB.PingContext(ctx)
+		}()
+	}
+	wg.Wait()
+
+	var changed []ReplicaStatus
+	for i, rep := range r.replicas {
+		if rep.set(errs[i]) {
+			changed = append(changed, rep.status())
+		}
+	}
+	return changed
+}
+
+// Status returns the health of each replica.
+func (r *Replicas) Status() []ReplicaStatus {
+	if r == nil {
+		return nil
+	}
+
+	statuses := make([]ReplicaStatus, len(r.replicas))
+	for i, rep := range r.replicas {
+		statuses[i] = rep.status()
+	}
+	return statuses
+}
+
+// Close closes the statements prepared on the replicas, and then their
+// connection pools.
+func (r *Replicas) Close() error {
+	if r == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, rep := range r.replicas {
+		errs = append(errs, rep.stmts.Close(), rep.stmts.DB.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// reader returns the next healthy replica, or nil if there isn't one.
+func (r *Replicas) reader() *replica {
+	if r == nil || len(r.replicas) == 0 {
+		return nil
+	}
+
+	start := int(r.next.Add(1))
+	for i := range r.replicas {
+		rep := r.replicas[(start+i)%len(r.replicas)]
+		if rep.healthy.Load() {
+			return rep
+		}
+	}
+	return nil
+}
+
+// set records the result of reaching the replica, taking it out of rotation
+// if err isn't nil, and reports whether its health changed.
+func (rep *replica) set(err error) bool {
+	rep.mu.Lock()
+	rep.err = err
+	rep.mu.Unlock()
+
+	return rep.healthy.Swap(err == nil) != (err == nil)
+}
+
+func (rep *replica) status() ReplicaStatus {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+
+	s := ReplicaStatus{Name: rep.name, Healthy: rep.healthy.Load(), Pool: rep.stmts.DB.Stats()}
+	if rep.err != nil {
+		s.Error = rep.err.Error()
+	}
+	return s
+}
+
+// readFrom runs a read-only query on a healthy replica, or on primary if
+// there isn't one. If the replica can't be reached, it's taken out of
+// rotation and the query is run on primary instead. So is a query for a
+// record which the replica doesn't have, since a replica can lag a moment
+// behind the primary, and the record may have only just been created. A
+// query on primary which fails with a transient error is retried.
+func readFrom[T any](r *Replicas, primary *StmtCache, query func(stmts *StmtCache) (T, error)) (T, error) {
+	onPrimary := func() (T, error) {
+		var v T
+		err := retry(func() error {
+			var err error
+			v, err = query(primary)
+			return err
+		})
+		return v, err
+	}
+
+	rep := r.reader()
+	if rep == nil {
+		return onPrimary()
+	}
+
+	v, err := query(rep.stmts)
+	if err == nil {
+		return v, nil
+	}
+
+	if isConnError(err) {
+		rep.set(err)
+		return onPrimary()
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return onPrimary()
+	}
+	return v, err
+}
+
+// isConnError reports whether err means that the database couldn't be
+// reached, rather than that there was something wrong with the query, so
+// that the query can be tried somewhere else. A query which was cancelled or
+// ran out of time isn't put down to the database.
+func isConnError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) || errors.As(err, &netErr)
+}
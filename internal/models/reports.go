@@ -0,0 +1,99 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// The reasons a snippet can be reported for, in the order they're shown in
+// the report form.
+var ReportReasons = []string{"spam", "abuse", "illegal", "personal", "other"}
+
+// Report is one person's report of a snippet.
+type Report struct {
+	ID        int
+	SnippetID int
+	UserID    int
+	Reason    string
+	Details   string
+	Created   time.Time
+}
+
+// ReportedSnippet is a snippet with the reports against it.
+type ReportedSnippet struct {
+	SnippetID int
+	Title     string
+	Hidden    bool
+	Reports   []*Report
+}
+
+// Define a ReportModel type which wraps a database connection pool.
+type ReportModel struct {
+	DB *sql.DB
+}
+
+// Insert records a report of a snippet and returns how many reports the
+// snippet now has. The reporter identifies who made the report (like a user
+// ID or an IP address); each reporter can only report a snippet once, and
+// reporting it again changes nothing.
+func (m *ReportModel) Insert(snippetID, userID int, reporter, reason, details string) (int, error) {
+	stmt := `INSERT IGNORE INTO reports (snippet_id, user_id, reporter, reason, details, created)
+	VALUES(?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	user := sql.NullInt64{Int64: int64(userID), Valid: userID != 0}
+
+	_, err := retrying(m.DB).Exec(stmt, snippetID, user, reporter, reason, details)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	err = retrying(m.DB).QueryRow("SELECT COUNT(*) FROM reports WHERE snippet_id = ?", snippetID).Scan(&n)
+	return n, err
+}
+
+// Open returns the snippets which have been reported, with their reports,
+// oldest report first.
+func (m *ReportModel) Open() ([]*ReportedSnippet, error) {
+	stmt := `SELECT r.id, r.snippet_id, s.title, s.held_reason IS NOT NULL, r.user_id, r.reason, r.details, r.created
+	FROM reports r INNER JOIN snippets s ON s.id = r.snippet_id
+	WHERE s.expires > NOW()
+	ORDER BY r.snippet_id, r.id`
+
+	rows, err := retrying(m.DB).Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reported []*ReportedSnippet
+	var current *ReportedSnippet
+
+	for rows.Next() {
+		r := &Report{}
+		var title string
+		var hidden bool
+		var user sql.NullInt64
+
+		err := rows.Scan(&r.ID, &r.SnippetID, &title, &hidden, &user, &r.Reason, &r.Details, &r.Created)
+		if err != nil {
+			return nil, err
+		}
+		r.UserID = int(user.Int64)
+
+		if current == nil || current.SnippetID != r.SnippetID {
+			current = &ReportedSnippet{SnippetID: r.SnippetID, Title: title, Hidden: hidden}
+			reported = append(reported, current)
+		}
+		current.Reports = append(current.Reports, r)
+	}
+
+	return reported, rows.Err()
+}
+
+// Dismiss deletes the reports of a snippet, once a moderator has decided
+// that it's fine.
+func (m *ReportModel) Dismiss(snippetID int) error {
+	_, err := retrying(m.DB).Exec("DELETE FROM reports WHERE snippet_id = ?", snippetID)
+	return err
+}
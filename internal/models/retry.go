@@ -0,0 +1,222 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// RetryPolicy says how many times to try a model operation which fails with
+// a transient error, and how long to wait in between. The waits double from
+// BaseDelay up to MaxDelay, and each is jittered by up to half, so that
+// operations which failed together don't all try again at once.
+type RetryPolicy struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Retries is the policy which model operations are retried with. It must
+// only be changed before the models are used.
+var Retries = RetryPolicy{Attempts: 3, BaseDelay: 20 * time.Millisecond, MaxDelay: time.Second}
+
+// The kinds of transient error which operations are retried after.
+const (
+	retryDeadlock   = "deadlock"
+	retryLockWait   = "lock_wait_timeout"
+	retryConnection = "connection"
+)
+
+// RetryStats counts the retries of model operations, for /debug/vars:
+// Retries is how many tries were made again, by the kind of error which the
+// try before failed with; Recovered is how many operations succeeded after
+// being retried, and Exhausted how many failed every try.
+type RetryStats struct {
+	Retries   map[string]int64 `json:"retries"`
+	Recovered int64            `json:"recovered"`
+	Exhausted int64            `json:"exhausted"`
+}
+
+var retryCounts struct {
+	deadlock, lockWait, connection atomic.Int64
+	recovered, exhausted           atomic.Int64
+}
+
+// RetryCounts returns the retry counts since the application started.
+func RetryCounts() RetryStats {
+	return RetryStats{
+		Retries: map[string]int64{
+			retryDeadlock:   retryCounts.deadlock.Load(),
+			retryLockWait:   retryCounts.lockWait.Load(),
+			retryConnection: retryCounts.connection.Load(),
+		},
+		Recovered: retryCounts.recovered.Load(),
+		Exhausted: retryCounts.exhausted.Load(),
+	}
+}
+
+// finalError wraps an error which mustn't be retried even though it looks
+// transient, like a lost connection while committing, after which the
+// transaction may or may not have been committed.
+type finalError struct {
+	err error
+}
+
+func (e finalError) Error() string { return e.err.Error() }
+func (e finalError) Unwrap() error { return e.err }
+
+// retry runs op, and runs it again if it fails with a transient error, up to
+// Retries.Attempts tries in all. op must be safe to run again after failing
+// that way, like a transaction which was rolled back, or a read. It can
+// return a finalError to stop it being retried.
+func retry(op func() error) error {
+	delay := Retries.BaseDelay
+	for try := 1; ; try++ {
+		err := op()
+
+		var final finalError
+		if errors.As(err, &final) {
+			return final.err
+		}
+
+		kind := transientError(err)
+		if kind == "" {
+			if err == nil && try > 1 {
+				retryCounts.recovered.Add(1)
+			}
+			return err
+		}
+		if try >= Retries.Attempts {
+			if try > 1 {
+				retryCounts.exhausted.Add(1)
+			}
+			return err
+		}
+
+		switch kind {
+		case retryDeadlock:
+			retryCounts.deadlock.Add(1)
+		case retryLockWait:
+			retryCounts.lockWait.Add(1)
+		case retryConnection:
+			retryCounts.connection.Add(1)
+		}
+
+		if delay > 0 {
+			time.Sleep(delay/2 + rand.N(delay/2+1))
+		}
+		delay = min(delay*2, Retries.MaxDelay)
+	}
+}
+
+// transientError returns the kind of transient error that err is, or "" if
+// it isn't one: a deadlock (1213) or lock wait timeout (1205), after which
+// MySQL has rolled the statement or transaction back, or a connection which
+// was lost or reset.
+func transientError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var mySQLError *mysql.MySQLError
+	if errors.As(err, &mySQLError) {
+		switch mySQLError.Number {
+		case 1213:
+			return retryDeadlock
+		case 1205:
+			return retryLockWait
+		}
+		return ""
+	}
+
+	if isConnError(err) {
+		return retryConnection
+	}
+	return ""
+}
+
+// retryingDB runs single statements on a *sql.DB, outside a transaction, and
+// runs them again if they fail with a transient error, as Retries says. It
+// has the same methods as *sql.DB, so a model method calls
+// retrying(m.DB).Exec(...) where it would call m.DB.Exec(...).
+type retryingDB struct {
+	db *sql.DB
+}
+
+// retrying returns db wrapped so that its statements are retried.
+func retrying(db *sql.DB) retryingDB {
+	return retryingDB{db: db}
+}
+
+// Exec executes a statement which doesn't return rows.
+func (r retryingDB) Exec(query string, args ...any) (sql.Result, error) {
+	return r.ExecContext(context.Background(), query, args...)
+}
+
+// ExecContext executes a statement which doesn't return rows. A deadlock or
+// lock wait timeout means MySQL rolled the statement back, so it's run
+// again, but if the connection is lost there's no telling whether the
+// statement was executed, so it isn't.
+func (r retryingDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	var res sql.Result
+	err := retry(func() error {
+		var err error
+		res, err = r.db.ExecContext(ctx, query, args...)
+		if isConnError(err) {
+			return finalError{err}
+		}
+		return err
+	})
+	return res, err
+}
+
+// Query executes a query which returns rows. Only running the query is
+// retried; an error part way through reading the rows is returned by
+// rows.Err() as usual.
+func (r retryingDB) Query(query string, args ...any) (*sql.Rows, error) {
+	return r.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext is like Query, with a context.
+func (r retryingDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := retry(func() error {
+		var err error
+		rows, err = r.db.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// QueryRow executes a query which returns at most one row. As with
+// *sql.DB, any error is deferred until the row is scanned.
+func (r retryingDB) QueryRow(query string, args ...any) retryingRow {
+	return r.QueryRowContext(context.Background(), query, args...)
+}
+
+// QueryRowContext is like QueryRow, with a context.
+func (r retryingDB) QueryRowContext(ctx context.Context, query string, args ...any) retryingRow {
+	return retryingRow{db: r.db, ctx: ctx, query: query, args: args}
+}
+
+// retryingRow is the result of retryingDB.QueryRow. The query is only run
+// when the row is scanned, so that a transient error can be retried.
+type retryingRow struct {
+	db    *sql.DB
+	ctx   context.Context
+	query string
+	args  []any
+}
+
+// Scan runs the query and copies the columns of the row it returns into
+// dest. It returns sql.ErrNoRows if there's no row.
+func (r retryingRow) Scan(dest ...any) error {
+	return retry(func() error {
+		return r.db.QueryRowContext(r.ctx, r.query, r.args...).Scan(dest...)
+	})
+}
@@ -0,0 +1,257 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// noRetryDelay makes retries in the test immediate, and puts the policy
+// back when it finishes.
+func noRetryDelay(t *testing.T) {
+	t.Helper()
+
+	saved := Retries
+	Retries.BaseDelay = 0
+	Retries.MaxDelay = 0
+	t.Cleanup(func() { Retries = saved })
+}
+
+// retryCountsSince returns how much the retry counts have gone up since
+// before.
+func retryCountsSince(before RetryStats) RetryStats {
+	now := RetryCounts()
+	diff := RetryStats{
+		Retries:   map[string]int64{},
+		Recovered: now.Recovered - before.Recovered,
+		Exhausted: now.Exhausted - before.Exhausted,
+	}
+	for kind, n := range now.Retries {
+		if n -= before.Retries[kind]; n != 0 {
+			diff.Retries[kind] = n
+		}
+	}
+	return diff
+}
+
+// checkRetryCounts fails the test if the retry counts went up by other than
+// retries of kind, recovered and exhausted.
+func checkRetryCounts(t *testing.T, got RetryStats, kind string, retries, recovered, exhausted int64) {
+	t.Helper()
+
+	want := map[string]int64{}
+	if retries > 0 {
+		want[kind] = retries
+	}
+	if fmt.Sprint(got.Retries) != fmt.Sprint(want) {
+		t.Errorf("got retries %v; want %v", got.Retries, want)
+	}
+	if got.Recovered != recovered {
+		t.Errorf("got %d recovered; want %d", got.Recovered, recovered)
+	}
+	if got.Exhausted != exhausted {
+		t.Errorf("got %d exhausted; want %d", got.Exhausted, exhausted)
+	}
+}
+
+func TestTransientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"Deadlock", &mysql.MySQLError{Number: 1213}, retryDeadlock},
+		{"Lock wait timeout", &mysql.MySQLError{Number: 1205}, retryLockWait},
+		{"Wrapped", fmt.Errorf("models: %w", &mysql.MySQLError{Number: 1213}), retryDeadlock},
+		{"Bad connection", driver.ErrBadConn, retryConnection},
+		{"Invalid connection", mysql.ErrInvalidConn, retryConnection},
+		{"Duplicate entry", &mysql.MySQLError{Number: 1062}, ""},
+		{"Canceled", context.Canceled, ""},
+		{"Other", errors.New("models: something else"), ""},
+		{"Nil", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transientError(tt.err); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	noRetryDelay(t)
+	Retries.Attempts = 3
+
+	nonTransient := errors.New("models: not transient")
+
+	tests := []struct {
+		name      string
+		err       error
+		failures  int
+		kind      string
+		wantTries int
+		wantErr   error
+		recovered int64
+		exhausted int64
+	}{
+		{"Deadlock recovered", &mysql.MySQLError{Number: 1213}, 1, retryDeadlock, 2, nil, 1, 0},
+		{"Deadlock exhausted", &mysql.MySQLError{Number: 1213}, 5, retryDeadlock, 3, &mysql.MySQLError{Number: 1213}, 0, 1},
+		{"Lock wait recovered", &mysql.MySQLError{Number: 1205}, 2, retryLockWait, 3, nil, 1, 0},
+		{"Lock wait exhausted", &mysql.MySQLError{Number: 1205}, 5, retryLockWait, 3, &mysql.MySQLError{Number: 1205}, 0, 1},
+		{"Bad connection recovered", driver.ErrBadConn, 1, retryConnection, 2, nil, 1, 0},
+		{"Bad connection exhausted", driver.ErrBadConn, 5, retryConnection, 3, driver.ErrBadConn, 0, 1},
+		{"Not transient", nonTransient, 5, "", 1, nonTransient, 0, 0},
+		{"Final", finalError{driver.ErrBadConn}, 5, "", 1, driver.ErrBadConn, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := RetryCounts()
+
+			tries := 0
+			err := retry(func() error {
+				tries++
+				if tries <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+
+			if tries != tt.wantTries {
+				t.Errorf("got %d tries; want %d", tries, tt.wantTries)
+			}
+			if fmt.Sprint(err) != fmt.Sprint(tt.wantErr) {
+				t.Errorf("got error %v; want %v", err, tt.wantErr)
+			}
+			checkRetryCounts(t, retryCountsSince(before), tt.kind, int64(tt.wantTries-1), tt.recovered, tt.exhausted)
+		})
+	}
+}
+
+func TestRetryAttempts(t *testing.T) {
+	noRetryDelay(t)
+
+	deadlock := &mysql.MySQLError{Number: 1213}
+
+	for _, attempts := range []int{1, 2, 5} {
+		t.Run(fmt.Sprint(attempts), func(t *testing.T) {
+			Retries.Attempts = attempts
+			before := RetryCounts()
+
+			tries := 0
+			err := retry(func() error {
+				tries++
+				return deadlock
+			})
+
+			if !errors.Is(err, deadlock) {
+				t.Errorf("got error %v; want %v", err, deadlock)
+			}
+			if tries != attempts {
+				t.Errorf("got %d tries; want %d", tries, attempts)
+			}
+
+			// With only one attempt, nothing was retried, so it doesn't
+			// count as exhausting the retries either.
+			var exhausted int64
+			if attempts > 1 {
+				exhausted = 1
+			}
+			checkRetryCounts(t, retryCountsSince(before), retryDeadlock, int64(attempts-1), 0, exhausted)
+		})
+	}
+}
+
+// The connection errors in these tests are mysql.ErrInvalidConn rather than
+// driver.ErrBadConn: database/sql tries a statement again on another
+// connection itself when the driver returns driver.ErrBadConn, which the
+// driver only does when the statement was never sent.
+
+func TestRetryingDBExec(t *testing.T) {
+	noRetryDelay(t)
+	Retries.Attempts = 3
+
+	nonTransient := &mysql.MySQLError{Number: 1062}
+
+	tests := []struct {
+		name      string
+		err       error
+		kind      string
+		wantExecs int
+	}{
+		{"Deadlock", &mysql.MySQLError{Number: 1213}, retryDeadlock, 3},
+		{"Lock wait timeout", &mysql.MySQLError{Number: 1205}, retryLockWait, 3},
+		// The statement may or may not have been executed before the
+		// connection was lost, and it might not be safe to execute twice,
+		// so it isn't retried.
+		{"Connection", mysql.ErrInvalidConn, "", 1},
+		{"Not transient", nonTransient, "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB(t)
+			fake.failNext(tt.err, tt.err, tt.err, tt.err, tt.err)
+			before := RetryCounts()
+
+			_, err := retrying(db).Exec("UPDATE snippets SET views = views + 1")
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got error %v; want %v", err, tt.err)
+			}
+			if _, execs, _ := fake.counts(); execs != tt.wantExecs {
+				t.Errorf("got %d executions; want %d", execs, tt.wantExecs)
+			}
+
+			var exhausted int64
+			if tt.wantExecs > 1 {
+				exhausted = 1
+			}
+			checkRetryCounts(t, retryCountsSince(before), tt.kind, int64(tt.wantExecs-1), 0, exhausted)
+		})
+	}
+}
+
+func TestRetryingRowScan(t *testing.T) {
+	noRetryDelay(t)
+	Retries.Attempts = 3
+
+	tests := []struct {
+		name        string
+		err         error
+		kind        string
+		wantQueries int
+	}{
+		{"Deadlock", &mysql.MySQLError{Number: 1213}, retryDeadlock, 2},
+		{"Lock wait timeout", &mysql.MySQLError{Number: 1205}, retryLockWait, 2},
+		// Unlike Exec, a read is safe to run again after the connection
+		// was lost.
+		{"Connection", mysql.ErrInvalidConn, retryConnection, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB(t)
+			fake.failNext(tt.err)
+			before := RetryCounts()
+
+			var n int
+			err := retrying(db).QueryRow("SELECT COUNT(*) FROM snippets").Scan(&n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 1 {
+				t.Errorf("got n = %d; want 1", n)
+			}
+			if _, _, queries := fake.counts(); queries != tt.wantQueries {
+				t.Errorf("got %d queries; want %d", queries, tt.wantQueries)
+			}
+			checkRetryCounts(t, retryCountsSince(before), tt.kind, int64(tt.wantQueries-1), 1, 0)
+		})
+	}
+}
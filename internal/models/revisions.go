@@ -0,0 +1,98 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"snippetbox.floccinau.net/internal/crypto"
+)
+
+// Define a Revision type to hold one recorded version of a snippet. Revisions
+// are numbered from 1 for each snippet.
+type Revision struct {
+	ID        int
+	SnippetID int
+	Number    int
+	Title     string
+	Content   string
+	UserID    int
+	Author    string
+	Created   time.Time
+}
+
+// Define a RevisionModel type which wraps a database connection pool.
+// Revisions are written by SnippetModel.Insert, Fork and Update; this model
+// only reads them.
+// Keys must be the same keyring as the SnippetModel's, to decrypt content.
+type RevisionModel struct {
+	DB   *sql.DB
+	Keys *crypto.Keyring
+}
+
+// List returns all the revisions of a snippet, newest first.
+func (m *RevisionModel) List(snippetID int) ([]*Revision, error) {
+	stmt := `SELECT r.id, r.snippet_id, r.revision, r.title, r.content, r.user_id, COALESCE(u.name, ''), r.created
+	FROM snippet_revisions r LEFT JOIN users u ON u.id = r.user_id
+	WHERE r.snippet_id = ?
+	ORDER BY r.revision DESC`
+
+	rows, err := retrying(m.DB).Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*Revision{}
+
+	for rows.Next() {
+		r, err := scanRevision(rows, m.Keys)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Get returns a specific revision of a snippet.
+func (m *RevisionModel) Get(snippetID, number int) (*Revision, error) {
+	stmt := `SELECT r.id, r.snippet_id, r.revision, r.title, r.content, r.user_id, COALESCE(u.name, ''), r.created
+	FROM snippet_revisions r LEFT JOIN users u ON u.id = r.user_id
+	WHERE r.snippet_id = ? AND r.revision = ?`
+
+	r, err := scanRevision(retrying(m.DB).QueryRow(stmt, snippetID, number), m.Keys)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func scanRevision(sc scanner, keys *crypto.Keyring) (*Revision, error) {
+	r := &Revision{}
+	var userID sql.NullInt64
+
+	err := sc.Scan(&r.ID, &r.SnippetID, &r.Number, &r.Title, &r.Content, &userID, &r.Author, &r.Created)
+	if err != nil {
+		return nil, err
+	}
+
+	r.UserID = int(userID.Int64)
+
+	r.Content, err = keys.Decrypt(r.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// GetScheduled returns an unexpired snippet which is scheduled to be
+// published later, and so isn't returned by Get yet. It returns ErrNoRecord
+// if there's no such snippet.
+func (m *SnippetModel) GetScheduled(id int) (*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets
+	WHERE expires > NOW() AND held_reason IS NULL AND publish_at > UTC_TIMESTAMP() AND id = ?`
+
+	s, err := scanSnippet(retrying(m.DB).QueryRow(stmt, id), m.Keys)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Scheduled returns a user's unexpired snippets which are scheduled to be
+// published later, soonest first.
+func (m *SnippetModel) Scheduled(userID int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets
+	WHERE user_id = ? AND expires > NOW() AND held_reason IS NULL AND publish_at > UTC_TIMESTAMP()
+	ORDER BY publish_at, id`
+
+	rows, err := retrying(m.DB).Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []*Snippet
+	for rows.Next() {
+		s, err := scanSnippet(rows, m.Keys)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	return snippets, rows.Err()
+}
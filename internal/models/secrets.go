@@ -0,0 +1,83 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// The outcomes of a submission in which the secret scanner found something.
+const (
+	SecretsBlocked  = "blocked"
+	SecretsRedacted = "redacted"
+	SecretsWarned   = "warned"
+)
+
+// Define a SecretFinding type to hold a submission in which the secret
+// scanner found something. Rules lists the IDs of the rules which matched,
+// separated by commas. SnippetID is zero if the snippet wasn't published,
+// or has since been deleted, and UserID is zero for anonymous snippets.
+type SecretFinding struct {
+	ID        int
+	SnippetID int
+	UserID    int
+	IP        string
+	Rules     string
+	Outcome   string
+	Created   time.Time
+}
+
+// Define a SecretFindingModel type which wraps a database connection pool.
+type SecretFindingModel struct {
+	DB *sql.DB
+}
+
+// Insert records a submission in which the secret scanner found something.
+func (m *SecretFindingModel) Insert(snippetID, userID int, ip, rules, outcome string) error {
+	stmt := `INSERT INTO secret_findings (snippet_id, user_id, ip, rules, outcome, created)
+	VALUES (?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	var sid, uid sql.NullInt64
+	if snippetID > 0 {
+		sid = sql.NullInt64{Int64: int64(snippetID), Valid: true}
+	}
+	if userID > 0 {
+		uid = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
+
+	// Keep the list of rules within the size of the column.
+	if len(rules) > 255 {
+		rules = rules[:255]
+	}
+
+	_, err := retrying(m.DB).Exec(stmt, sid, uid, ip, rules, outcome)
+	return err
+}
+
+// Latest returns the most recent findings, newest first.
+func (m *SecretFindingModel) Latest(limit int) ([]*SecretFinding, error) {
+	stmt := `SELECT id, snippet_id, user_id, ip, rules, outcome, created
+	FROM secret_findings ORDER BY id DESC LIMIT ?`
+
+	rows, err := retrying(m.DB).Query(stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var findings []*SecretFinding
+	for rows.Next() {
+		f := &SecretFinding{}
+		var sid, uid sql.NullInt64
+
+		err := rows.Scan(&f.ID, &sid, &uid, &f.IP, &f.Rules, &f.Outcome, &f.Created)
+		if err != nil {
+			return nil, err
+		}
+		f.SnippetID = int(sid.Int64)
+		f.UserID = int(uid.Int64)
+
+		findings = append(findings, f)
+	}
+
+	return findings, rows.Err()
+}
@@ -1,9 +1,14 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
+
+	"snippetbox.floccinau.net/internal/crypto"
 )
 
 // Chapter 4.5: Designing a database model |
@@ -11,75 +16,159 @@ import (
 // the fields of the struct correspond to the fields in our MySQL snippets
 // table?
 type Snippet struct {
-	ID      int
-	title   string
-	content string
-	created time.Time
-	expires time.Time
+	ID         int       `json:"id"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+	UserID     int       `json:"user_id,omitempty"`
+	ForkedFrom int       `json:"forked_from,omitempty"`
+	Protected  bool      `json:"protected,omitempty"`
+	Language   string    `json:"language,omitempty"`
+	Tags       []string  `json:"tags,omitempty"`
+	Version    int       `json:"version"`
+	// PublishAt is when the snippet becomes visible. It's the same as Created
+	// unless the snippet was scheduled to be published later.
+	PublishAt time.Time `json:"publish_at"`
+	// Pinned is set when the owner has pinned the snippet to their profile,
+	// and Announcement when an admin has pinned it to the home page.
+	Pinned       bool `json:"pinned,omitempty"`
+	Announcement bool `json:"announcement,omitempty"`
+	// OrgID is the organization the snippet belongs to, or 0 for a public
+	// snippet. Only the organization's members can see it.
+	OrgID int `json:"org_id,omitempty"`
 }
 
-// *Chapter 4.9: Transactions and other details |
-// We need somewhere to store the prepared statement for the lifetime of our
-// web application. A neat way is to embed in the model alongside the connection
-// pool.
-// Chapter 4.5: Designing a database model |
-// Define a SnippetModel type which wraps a sql.DB connection pool.
-type SnippetModel struct {
-	DB         *sql.DB
-	InsertStmt *sql.Stmt
-	GetStmt    *sql.Stmt
-	LatestStmt *sql.Stmt
+// snippetColumns lists the columns which scanSnippet expects, in order. Use
+// it in the SELECT clause of any query that returns whole snippets. The names
+// are qualified so that it can be used in joins too.
+const snippetColumns = `snippets.id, snippets.title, snippets.content, snippets.created,
+	snippets.expires, snippets.user_id, snippets.forked_from,
+	snippets.passphrase_hash IS NOT NULL, snippets.language, snippets.version,
+	snippets.pinned_at IS NOT NULL, snippets.home_pinned_at IS NOT NULL,
+	snippets.publish_at, snippets.org_id`
+
+// scanner is satisfied by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
 }
 
-// *Chapter 4.9: Transactions and other details |
-// Create a constructor for the model, in which we set up the prepared
-// statement.
-func NewSnippetModel(db *sql.DB) (*SnippetModel, error) {
-	// *Chapter 4.9: Transactions and other details |
-	// Use the Prepare method to create a new prepared statement for the
-	// current connection pool. This returns a sql.Stmt object which represents
-	// the prepared statement
-	var insertStmt, getStmt, latestStmt *sql.Stmt
-	var err error
-	insertStmt, err = db.Prepare(
-		`INSERT INTO snippets(title, content, created, expires)
-		VALUES(?, ?, NOW(), DATE_ADD(NOW(), INTERVAL ? DAY))`,
-	)
+// scanSnippet copies the snippetColumns of the current row into a new
+// Snippet, decrypting the content with keys. The owner, fork, language and
+// organization columns are nullable, and NULL is mapped to the zero value.
+// Tags are stored in their own table and aren't loaded; see LoadTags.
+func scanSnippet(sc scanner, keys *crypto.Keyring) (*Snippet, error) {
+	s := &Snippet{}
+	ss := snippetScanner{keys: keys}
+	err := ss.scan(sc, s)
 	if err != nil {
 		return nil, err
 	}
+	return s, nil
+}
 
-	getStmt, err = db.Prepare(
-		`SELECT id, title, content, created, expires
-		FROM snippets
-		WHERE expires > NOW() AND id = ?`,
-	)
+// snippetScanner scans rows of snippetColumns into Snippets, like
+// scanSnippet. The busiest listings keep one for all of their rows and scan
+// into a slice of Snippet values, so that the Scan destinations and the
+// Snippets themselves aren't allocated again for every row.
+type snippetScanner struct {
+	keys                      *crypto.Keyring
+	userID, forkedFrom, orgID sql.NullInt64
+	language                  sql.NullString
+	dest                      []any
+}
+
+// scan copies the current row into s. Any leading destinations are scanned
+// first, for queries which select other columns before snippetColumns, like
+// COUNT(*) OVER().
+func (ss *snippetScanner) scan(sc scanner, s *Snippet, leading ...any) error {
+	ss.dest = append(ss.dest[:0], leading...)
+	ss.dest = append(ss.dest, &s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &ss.userID, &ss.forkedFrom, &s.Protected,
+		&ss.language, &s.Version, &s.Pinned, &s.Announcement, &s.PublishAt, &ss.orgID)
+
+	err := sc.Scan(ss.dest...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	latestStmt, err = db.Prepare(
-		`SELECT id, title, content, created, expires
-		FROM snippets
-		ORDER BY id DESC LIMIT 10`,
-	)
-	if err != nil {
-		return nil, err
+	s.UserID = int(ss.userID.Int64)
+	s.ForkedFrom = int(ss.forkedFrom.Int64)
+	s.OrgID = int(ss.orgID.Int64)
+	s.Language = ss.language.String
+
+	s.Content, err = ss.keys.Decrypt(s.Content)
+	return err
+}
+
+// snippetPointers returns pointers to each of the snippets, which is what
+// the listing methods return.
+func snippetPointers(snippets []Snippet) []*Snippet {
+	ptrs := make([]*Snippet, len(snippets))
+	for i := range snippets {
+		ptrs[i] = &snippets[i]
 	}
+	return ptrs
+}
 
-	// *Chapter 4.9: Transactions and other details |
-	// Store it in our SnippetModel object, alongside the connection pool.
-	return &SnippetModel{
-		DB:         db,
-		InsertStmt: insertStmt,
-		GetStmt:    getStmt,
-		LatestStmt: latestStmt,
-	}, nil
+// *Chapter 4.9: Transactions and other details |
+// We need somewhere to store the prepared statements for the lifetime of our
+// web application. A neat way is to embed them in the model alongside the
+// connection pool, in Stmts.
+// Chapter 4.5: Designing a database model |
+// Define a SnippetModel type which wraps a sql.DB connection pool.
+//
+// Snippet content is encrypted at rest with Keys. If Keys is nil or empty,
+// content is stored in plain text.
+type SnippetModel struct {
+	DB    *sql.DB
+	Keys  *crypto.Keyring
+	Stmts *StmtCache
+	// Replicas, if it isn't nil, takes the busiest reads (Get, Latest and
+	// List) off the primary.
+	Replicas *Replicas
+}
+
+// The queries which are run most, whose statements are kept prepared in
+// Stmts, and in the replicas' caches too for the reads.
+const (
+	insertSnippetSQL = `INSERT INTO snippets(title, content, content_hash, language, created, expires, user_id, org_id, passphrase_hash, held_reason, publish_at)
+		VALUES(?, ?, ?, ?, NOW(), DATE_ADD(NOW(), INTERVAL ? DAY), ?, ?, ?, ?, COALESCE(?, UTC_TIMESTAMP()))`
+	getSnippetSQL = `SELECT ` + snippetColumns + `
+		FROM snippets
+		WHERE expires > NOW() AND held_reason IS NULL AND publish_at <= UTC_TIMESTAMP() AND org_id IS NULL AND id = ?`
+	latestSnippetsSQL = `SELECT ` + snippetColumns + `
+		FROM snippets
+		WHERE expires > NOW() AND held_reason IS NULL AND publish_at <= UTC_TIMESTAMP() AND org_id IS NULL
+		ORDER BY created DESC, id DESC LIMIT 10`
+)
+
+// *Chapter 4.9: Transactions and other details |
+// Create a constructor for the model. The statements aren't prepared up
+// front any more: Stmts prepares each one the first time it's run, and again
+// if it goes stale.
+func NewSnippetModel(db *sql.DB) *SnippetModel {
+	return &SnippetModel{DB: db, Stmts: NewStmtCache(db)}
+}
+
+// Close closes the primary's statement cache. The replicas' caches aren't
+// touched; they're closed along with the replicas by Replicas.Close.
+func (m *SnippetModel) Close() error {
+	return m.Stmts.Close()
 }
 
 // Chapter 4.5: Designing a database model |
-// This will insert a new snippet into the database.
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+// This will insert a new snippet into the database. The snippet belongs to
+// the user with the given ID, or to nobody if it's 0, and to the organization
+// with the given ID, or to no organization if it's 0. If passphrase isn't
+// empty, the snippet can only be viewed by people who know it; only an
+// argon2id hash of it is stored. An empty language is stored as NULL. If
+// heldReason isn't empty, the snippet is held for review and isn't shown
+// anywhere until a moderator approves it. If publishAt is set, the snippet
+// isn't shown anywhere until then either.
+//
+// The snippet, its tags and its first revision are written in one
+// transaction, so a snippet is never seen without them.
+func (m *SnippetModel) Insert(ctx context.Context, title string, content string, expires int, userID int, orgID int, passphrase string, language string, heldReason string, publishAt time.Time, tags []string) (int, error) {
 	// Chapter 4.6: Executing SQL statements |
 	// Write the SQL statement we want to execute. I've split it over two lines
 	// for readability (which is why it's surrounded with backquotes instead
@@ -102,15 +191,62 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (int, e
 	// Notice how we call Exec directly against the prepared statement, rather
 	// than against the connection pool? Prepared statements also support the
 	// Query and QueryRow methods
-	result, err := m.InsertStmt.Exec(title, content, expires)
+	owner := sql.NullInt64{Int64: int64(userID), Valid: userID != 0}
+	org := sql.NullInt64{Int64: int64(orgID), Valid: orgID != 0}
+
+	// The hash is of the plain text, so that duplicates can be found however
+	// the content is encrypted.
+	hash := ContentHash(m.Keys, content)
+
+	content, err := m.Keys.Encrypt(content)
 	if err != nil {
 		return 0, err
 	}
 
-	// Chapter 4.6: Executing SQL statements |
-	// Use the LastInsertId() method on the result to get the ID of our
-	// newly inserted record in the snippets table.
-	id, err := result.LastInsertId()
+	var passphraseHash sql.NullString
+	if passphrase != "" {
+		hash, err := hashPassphrase(passphrase)
+		if err != nil {
+			return 0, err
+		}
+		passphraseHash = sql.NullString{String: hash, Valid: true}
+	}
+
+	lang := sql.NullString{String: language, Valid: language != ""}
+	held := sql.NullString{String: heldReason, Valid: heldReason != ""}
+	publish := sql.NullTime{Time: publishAt.UTC(), Valid: !publishAt.IsZero()}
+
+	insert, err := m.Stmts.Prepare(ctx, insertSnippetSQL)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err = withTxContext(ctx, m.DB, func(q Queries) error {
+		result, err := q.Stmt(insert).ExecContext(ctx, title, content, hash, lang, expires, owner, org, passphraseHash, held, publish)
+		if err != nil {
+			return err
+		}
+
+		// Chapter 4.6: Executing SQL statements |
+		// Use the LastInsertId() method on the result to get the ID of our
+		// newly inserted record in the snippets table.
+		id, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		err = setTags(q, int(id), tags)
+		if err != nil {
+			return err
+		}
+
+		// The first revision is copied from the row just written, so that
+		// it has exactly the same creation time.
+		_, err = q.Exec(`INSERT INTO snippet_revisions (snippet_id, revision, title, content, user_id, created)
+		SELECT id, 1, title, content, user_id, created FROM snippets WHERE id = ?`, id)
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -122,8 +258,9 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (int, e
 }
 
 // Chapter 4.5: Designing a database model |
-// This will return a specific snippet based on its id.
-func (m *SnippetModel) Get(id int) (*Snippet, error) {
+// This will return a specific snippet based on its id. Snippets which belong
+// to an organization aren't returned; use GetForUser for those.
+func (m *SnippetModel) Get(ctx context.Context, id int) (*Snippet, error) {
 	// Chapter 4.7: Single-record SQL queries |
 	// Write the SQL statement we want to execute. Again,I've split it over three
 	// lines for readability.
@@ -138,19 +275,21 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 	// row := m.DB.QueryRow(stmt, id)
 
 	// *Chapter 4.9: Transactions and other details |
-	row := m.GetStmt.QueryRow(id)
-
-	// Chapter 4.7: Single-record SQL queries
-	// Initialize a pointer to a new zeroed Snippet struct
-	s := &Snippet{}
+	// row := m.GetStmt.QueryRow(id)
 
 	// Chapter 4.7: Single-record SQL queries
 	// Use row.Scan() to copy the values from each field in sql.Row to the
 	// corresponding field in the Snippet struct. Notice that the arguments
 	// to row.Scan are *pointers* to the place you want to copy the data into,
 	// and the number of arguments must be exactly the same as the number of
-	// columns returned by your statement.
-	err := row.Scan(&s.ID, &s.title, &s.content, &s.created, &s.expires)
+	// columns returned by your statement. The scanSnippet helper does this
+	// for us now that there are nullable columns to deal with.
+	//
+	// The snippet is read from a replica if there are any, and from the
+	// primary if not, with the statement prepared there.
+	s, err := readFrom(m.Replicas, m.Stmts, func(stmts *StmtCache) (*Snippet, error) {
+		return scanSnippet(stmts.QueryRow(ctx, getSnippetSQL, id), m.Keys)
+	})
 	if err != nil {
 		// Chapter 4.7: Single-record SQL queries |
 		// If the query returns no rows, then row.Scan() will return a
@@ -168,9 +307,28 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 	return s, nil
 }
 
+// GetForUser is like Get, but also returns snippets belonging to the
+// organizations which the user with the given ID is a member of. Pass 0 for
+// someone who isn't logged in.
+func (m *SnippetModel) GetForUser(ctx context.Context, id, userID int) (*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets
+	WHERE expires > NOW() AND held_reason IS NULL AND publish_at <= UTC_TIMESTAMP() AND id = ?
+	AND (org_id IS NULL OR org_id IN (SELECT org_id FROM org_members WHERE user_id = ?))`
+
+	s, err := scanSnippet(retrying(m.DB).QueryRowContext(ctx, stmt, id, userID), m.Keys)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
 // Chapter 4.5: Designing a database model |
 // This will return the 10 most recently created snippets.
-func (m *SnippetModel) Latest() ([]*Snippet, error) {
+func (m *SnippetModel) Latest(ctx context.Context) ([]*Snippet, error) {
 	// Chapter 4.8: Multiple-record SQL queries |
 	//  Write the SQL statement we want to execute
 	// stmt := `SELECT id, title, content, created, expires
@@ -188,7 +346,10 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	// }
 
 	// *Chapter 4.9: Transactions and other details |
-	rows, err := m.LatestStmt.Query()
+	// The snippets are read from a replica if there are any.
+	rows, err := readFrom(m.Replicas, m.Stmts, func(stmts *StmtCache) (*sql.Rows, error) {
+		return stmts.Query(ctx, latestSnippetsSQL)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -202,8 +363,11 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	defer rows.Close()
 
 	// Chapter 4.8: Multiple-record SQL queries |
-	// Initialize an empty slice to hold the Snippet structs.
-	snippets := []*Snippet{}
+	// Initialize an empty slice to hold the Snippet structs. There are never
+	// more than ten, so the slice is made big enough for all of them up
+	// front, and every row is scanned straight into it.
+	snippets := make([]Snippet, 0, 10)
+	ss := snippetScanner{keys: m.Keys}
 
 	// Chapter 4.8: Multiple-record SQL queries |
 	// Use rows.Next to iterate through the rows in the resultset. This
@@ -213,22 +377,16 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	// database connection.
 	for rows.Next() {
 		// Chapter 4.8: Multiple-record SQL queries |
-		// Create a pointer to a new zeroed Snippet struct.
-		s := &Snippet{}
-		// Chapter 4.8: Multiple-record SQL queries |
-		// Use rows.Scan() to copy the values from each field in the row to the
-		// new Snippet object that we created. Again, the arguments to row.Scan()
-		// must be pointers to the place you want to copy the data into, and the
-		// number of arguments must be exactly the same as the number of
+		// Use rows.Scan() to copy the values from each field in the row to
+		// the next Snippet in the slice. Again, the arguments to row.Scan()
+		// must be pointers to the place you want to copy the data into, and
+		// the number of arguments must be exactly the same as the number of
 		// columns returned by your statement.
-		err = rows.Scan(&s.ID, &s.title, &s.content, &s.created, &s.expires)
+		snippets = append(snippets, Snippet{})
+		err := ss.scan(rows, &snippets[len(snippets)-1])
 		if err != nil {
 			return nil, err
 		}
-
-		// Chapter 4.8: Multiple-record SQL queries |
-		// Append it to the slice of snippets
-		snippets = append(snippets, s)
 	}
 
 	// Chapter 4.8: Multiple-record SQL queries |
@@ -242,5 +400,326 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 
 	// Chapter 4.8: Multiple-record SQL queries
 	// If everything went OK then return the Snippets slice.
+	return snippetPointers(snippets), nil
+}
+
+// Fork copies an unexpired snippet to the given user, recording the original
+// in forked_from. The fork keeps the original's expiry time, passphrase,
+// language, tags and organization. It starts its own history with the
+// original's current version as revision 1. It returns the ID of the new
+// snippet.
+func (m *SnippetModel) Fork(id, userID int) (int, error) {
+	stmt := `INSERT INTO snippets (title, content, content_hash, language, created, expires, user_id, org_id, forked_from, passphrase_hash, publish_at)
+	SELECT title, content, content_hash, language, NOW(), expires, ?, org_id, id, passphrase_hash, UTC_TIMESTAMP()
+	FROM snippets
+	WHERE expires > NOW() AND held_reason IS NULL AND publish_at <= UTC_TIMESTAMP() AND id = ?`
+
+	var newID int64
+	err := withTx(m.DB, func(q Queries) error {
+		result, err := q.Exec(stmt, userID, id)
+		if err != nil {
+			return err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNoRecord
+		}
+
+		newID, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		_, err = q.Exec(`INSERT INTO snippet_tags (snippet_id, tag)
+		SELECT ?, tag FROM snippet_tags WHERE snippet_id = ?`, newID, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = q.Exec(`INSERT INTO snippet_revisions (snippet_id, revision, title, content, user_id, created)
+		SELECT id, 1, title, content, user_id, created FROM snippets WHERE id = ?`, newID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(newID), nil
+}
+
+// ForksOf returns the unexpired snippets which were forked from the given
+// snippet, newest first.
+func (m *SnippetModel) ForksOf(id int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets
+	WHERE expires > NOW() AND held_reason IS NULL AND publish_at <= UTC_TIMESTAMP() AND forked_from = ?
+	ORDER BY id DESC`
+
+	rows, err := retrying(m.DB).Query(stmt, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s, err := scanSnippet(rows, m.Keys)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return snippets, nil
 }
+
+// Update changes the title, content and language of an unexpired snippet and
+// records the edit in the snippet_revisions table, all in one transaction.
+// Snippets start with their original version as revision 1; for older ones,
+// which don't, it's saved the first time they're edited, so the history
+// always starts from what was first published.
+//
+// Every update increments the snippet's version. If version isn't 0 it must
+// match the current version, or else someone else has changed the snippet
+// since it was read and ErrEditConflict is returned.
+func (m *SnippetModel) Update(ctx context.Context, id, userID int, title, content, language string, version int) error {
+	return withTxContext(ctx, m.DB, func(q Queries) error {
+		return m.update(q, id, userID, title, content, language, version)
+	})
+}
+
+// UpdateWithTags is like Update, but also replaces the snippet's tags, in
+// the same transaction as the new revision.
+func (m *SnippetModel) UpdateWithTags(ctx context.Context, id, userID int, title, content, language string, version int, tags []string) error {
+	return withTxContext(ctx, m.DB, func(q Queries) error {
+		err := m.update(q, id, userID, title, content, language, version)
+		if err != nil {
+			return err
+		}
+		return setTags(q, id, tags)
+	})
+}
+
+// update does the work of Update as part of a larger transaction.
+func (m *SnippetModel) update(q Queries, id, userID int, title, content, language string, version int) error {
+	// Lock the snippet row so that concurrent edits get consecutive
+	// revision numbers.
+	var current Snippet
+	var owner sql.NullInt64
+	stmt := `SELECT title, content, created, user_id, version FROM snippets
+	WHERE expires > NOW() AND id = ? FOR UPDATE`
+	err := q.QueryRow(stmt, id).Scan(&current.Title, &current.Content, &current.Created, &owner, &current.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	if version != 0 && version != current.Version {
+		return ErrEditConflict
+	}
+
+	// The current content is already encrypted, so it can be copied into
+	// the first revision as it is. The new content needs encrypting.
+	hash := ContentHash(m.Keys, content)
+	content, err = m.Keys.Encrypt(content)
+	if err != nil {
+		return err
+	}
+
+	var latest int
+	err = q.QueryRow("SELECT COALESCE(MAX(revision), 0) FROM snippet_revisions WHERE snippet_id = ?", id).Scan(&latest)
+	if err != nil {
+		return err
+	}
+
+	insertRevision := `INSERT INTO snippet_revisions (snippet_id, revision, title, content, user_id, created)
+	VALUES(?, ?, ?, ?, ?, ?)`
+
+	if latest == 0 {
+		_, err = q.Exec(insertRevision, id, 1, current.Title, current.Content, owner, current.Created)
+		if err != nil {
+			return err
+		}
+		latest = 1
+	}
+
+	lang := sql.NullString{String: language, Valid: language != ""}
+
+	_, err = q.Exec("UPDATE snippets SET title = ?, content = ?, content_hash = ?, language = ?, version = version + 1 WHERE id = ?", title, content, hash, lang, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(`INSERT INTO snippet_revisions (snippet_id, revision, title, content, user_id, created)
+	VALUES(?, ?, ?, ?, ?, NOW())`, id, latest+1, title, content, userID)
+	return err
+}
+
+// Delete removes a snippet. Its comments, stars, revisions, tags and
+// attachment records go with it, by their foreign keys; the attachment files
+// are left for the blob collector.
+func (m *SnippetModel) Delete(id int) error {
+	result, err := retrying(m.DB).Exec("DELETE FROM snippets WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// SnippetFilter narrows down the snippets returned by List. Zero values
+// don't filter anything.
+type SnippetFilter struct {
+	Tag      string
+	Language string
+	UserID   int
+	// PinnedFirst puts pinned snippets ahead of the others, most recently
+	// pinned first, whatever the sort order. It's used for profiles.
+	PinnedFirst bool
+}
+
+// List returns one page of the unexpired snippets which match the filter,
+// sorted as the filters say, along with the paging metadata. The tags of the
+// returned snippets are loaded too. Listings sorted by creation time, without
+// PinnedFirst, can be paged through with the cursors in the metadata too.
+func (m *SnippetModel) List(ctx context.Context, filter SnippetFilter, f Filters) ([]*Snippet, Metadata, error) {
+	var where []string
+	var args []any
+
+	where = append(where, "snippets.expires > NOW()", "snippets.held_reason IS NULL", "snippets.publish_at <= UTC_TIMESTAMP()", "snippets.org_id IS NULL")
+	if filter.Tag != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM snippet_tags t WHERE t.snippet_id = snippets.id AND t.tag = ?)")
+		args = append(args, filter.Tag)
+	}
+	if filter.Language != "" {
+		where = append(where, "snippets.language = ?")
+		args = append(args, filter.Language)
+	}
+	if filter.UserID != 0 {
+		where = append(where, "snippets.user_id = ?")
+		args = append(args, filter.UserID)
+	}
+
+	// The sort column and direction come from the safelist, so it's safe to
+	// put them in the query. The ID is a tie-breaker, so that paging is
+	// stable when several snippets have the same title or creation time.
+	var pinned string
+	if filter.PinnedFirst {
+		pinned = "snippets.pinned_at IS NULL, snippets.pinned_at DESC, "
+	}
+
+	// A page after a cursor picks up where the previous page ended, rather
+	// than skipping the pages before it, and nothing is counted, so it costs
+	// the same however deep it is. 0 stands in for the count, and one more
+	// snippet than the page holds is fetched to tell whether there's another
+	// page after it.
+	count, limit, offset := "COUNT(*) OVER()", f.limit(), f.offset()
+	keyset := !f.After.IsZero()
+	if keyset {
+		if !f.byCreated() || filter.PinnedFirst {
+			panic("models: cursor paging needs a listing sorted by created")
+		}
+
+		op := "<"
+		if f.sortDirection() == "ASC" {
+			op = ">"
+		}
+		cond, condArgs := f.After.where(op)
+		where = append(where, cond)
+		args = append(args, condArgs...)
+
+		count, limit, offset = "0", limit+1, 0
+	}
+
+	stmt := fmt.Sprintf(`SELECT %s, %s
+	FROM snippets
+	WHERE %s
+	ORDER BY %s snippets.%s %s, snippets.id %[6]s
+	LIMIT ? OFFSET ?`, count, snippetColumns, strings.Join(where, " AND "), pinned, f.sortColumn(), f.sortDirection())
+
+	args = append(args, limit, offset)
+
+	// The SQL depends on the filters, so it isn't kept prepared.
+	rows, err := readFrom(m.Replicas, m.Stmts, func(stmts *StmtCache) (*sql.Rows, error) {
+		return stmts.DB.QueryContext(ctx, stmt, args...)
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	// Like Latest, the rows are scanned into one slice of Snippets, which
+	// is made big enough for a whole page.
+	values := make([]Snippet, 0, limit)
+	ss := snippetScanner{keys: m.Keys}
+	totalRecords := 0
+
+	for rows.Next() {
+		values = append(values, Snippet{})
+		err := ss.scan(rows, &values[len(values)-1], &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	var metadata Metadata
+	if keyset {
+		more := len(values) > f.limit()
+		if more {
+			values = values[:f.limit()]
+		}
+		if len(values) > 0 {
+			metadata.PageSize = f.PageSize
+		}
+		if more {
+			metadata.NextCursor = CursorFor(&values[len(values)-1]).String()
+		}
+	} else {
+		metadata = calculateMetadata(totalRecords, f.Page, f.PageSize)
+		if f.byCreated() && !filter.PinnedFirst && len(values) > 0 && f.offset()+len(values) < totalRecords {
+			metadata.NextCursor = CursorFor(&values[len(values)-1]).String()
+		}
+	}
+
+	snippets := snippetPointers(values)
+	if err = m.LoadTags(snippets...); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return snippets, metadata, nil
+}
+
+// countingScanner scans a leading total count column into count, and the
+// rest of the columns into the destinations it's given, so that scanSnippet
+// can be used on rows which start with COUNT(*) OVER().
+type countingScanner struct {
+	scanner
+	count *int
+}
+
+func (c countingScanner) Scan(dest ...any) error {
+	return c.scanner.Scan(append([]any{c.count}, dest...)...)
+}
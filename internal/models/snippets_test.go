@@ -0,0 +1,88 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// benchRows stands in for *sql.Rows, handing out the same row of
+// snippetColumns n times, so that the benchmarks measure the scanning
+// rather than the driver.
+type benchRows struct {
+	n, i int
+	row  []any
+}
+
+func (r *benchRows) Next() bool {
+	r.i++
+	return r.i <= r.n
+}
+
+func (r *benchRows) Scan(dest ...any) error {
+	for i, d := range dest {
+		switch d := d.(type) {
+		case *int:
+			*d = r.row[i].(int)
+		case *string:
+			*d = r.row[i].(string)
+		case *bool:
+			*d = r.row[i].(bool)
+		case *time.Time:
+			*d = r.row[i].(time.Time)
+		case *sql.NullInt64:
+			*d = r.row[i].(sql.NullInt64)
+		case *sql.NullString:
+			*d = r.row[i].(sql.NullString)
+		default:
+			return fmt.Errorf("benchRows: can't scan into %T", d)
+		}
+	}
+	return nil
+}
+
+// BenchmarkScanSnippets scans a page of listing rows one new *Snippet at a
+// time with scanSnippet, as the listings used to, and into a slice of
+// Snippet values with one snippetScanner, as Latest and List do now.
+func BenchmarkScanSnippets(b *testing.B) {
+	created := time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC)
+	row := []any{
+		42, "An old silent pond", "An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.",
+		created, created.AddDate(1, 0, 0), sql.NullInt64{Int64: 7, Valid: true}, sql.NullInt64{},
+		false, sql.NullString{String: "go", Valid: true}, 1, false, false, created, sql.NullInt64{},
+	}
+
+	for _, size := range []int{10, 100} {
+		b.Run(fmt.Sprintf("scanSnippet/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				rows := &benchRows{n: size, row: row}
+				snippets := []*Snippet{}
+				for rows.Next() {
+					s, err := scanSnippet(rows, nil)
+					if err != nil {
+						b.Fatal(err)
+					}
+					snippets = append(snippets, s)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("snippetScanner/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				rows := &benchRows{n: size, row: row}
+				values := make([]Snippet, 0, size)
+				ss := snippetScanner{}
+				for rows.Next() {
+					values = append(values, Snippet{})
+					if err := ss.scan(rows, &values[len(values)-1]); err != nil {
+						b.Fatal(err)
+					}
+				}
+				snippetPointers(values)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+
+	"snippetbox.floccinau.net/internal/crypto"
+)
+
+// Define a StarModel type which wraps a database connection pool. A star is a
+// (user, snippet) pair, so a user can star each snippet at most once. Keys
+// decrypts the content of the snippets returned by StarredBy.
+type StarModel struct {
+	DB   *sql.DB
+	Keys *crypto.Keyring
+}
+
+// Toggle stars the snippet for the user if they haven't starred it yet, or
+// removes their star if they have. It reports whether the snippet is starred
+// afterwards.
+func (m *StarModel) Toggle(userID, snippetID int) (bool, error) {
+	result, err := retrying(m.DB).Exec("DELETE FROM stars WHERE user_id = ? AND snippet_id = ?", userID, snippetID)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n > 0 {
+		return false, nil
+	}
+
+	stmt := `INSERT IGNORE INTO stars (user_id, snippet_id, created)
+	VALUES(?, ?, UTC_TIMESTAMP())`
+
+	_, err = retrying(m.DB).Exec(stmt, userID, snippetID)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Count returns the number of users who have starred the snippet.
+func (m *StarModel) Count(snippetID int) (int, error) {
+	var n int
+	err := retrying(m.DB).QueryRow("SELECT COUNT(*) FROM stars WHERE snippet_id = ?", snippetID).Scan(&n)
+	return n, err
+}
+
+// IsStarred reports whether the user has starred the snippet.
+func (m *StarModel) IsStarred(userID, snippetID int) (bool, error) {
+	var exists bool
+	stmt := "SELECT EXISTS(SELECT true FROM stars WHERE user_id = ? AND snippet_id = ?)"
+	err := retrying(m.DB).QueryRow(stmt, userID, snippetID).Scan(&exists)
+	return exists, err
+}
+
+// Counts returns the number of stars on each of the given snippets, keyed by
+// snippet ID. Snippets without stars are left out of the map.
+func (m *StarModel) Counts(snippetIDs []int) (map[int]int, error) {
+	counts := make(map[int]int, len(snippetIDs))
+	if len(snippetIDs) == 0 {
+		return counts, nil
+	}
+
+	args := make([]any, len(snippetIDs))
+	for i, id := range snippetIDs {
+		args[i] = id
+	}
+
+	stmt := `SELECT snippet_id, COUNT(*) FROM stars
+	WHERE snippet_id IN (?` + strings.Repeat(", ?", len(snippetIDs)-1) + `)
+	GROUP BY snippet_id`
+
+	rows, err := retrying(m.DB).Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// StarredBy returns the unexpired snippets which the user has starred, most
+// recently starred first.
+func (m *StarModel) StarredBy(userID int) ([]*Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + `
+	FROM snippets INNER JOIN stars ON stars.snippet_id = snippets.id
+	WHERE stars.user_id = ? AND snippets.expires > NOW() AND snippets.held_reason IS NULL
+	AND snippets.publish_at <= UTC_TIMESTAMP() AND snippets.org_id IS NULL
+	ORDER BY stars.created DESC`
+
+	rows, err := retrying(m.DB).Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := []*Snippet{}
+
+	for rows.Next() {
+		s, err := scanSnippet(rows, m.Keys)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// errStmtCacheClosed is returned for statements asked of a StmtCache after
+// it's been closed.
+var errStmtCacheClosed = errors.New("models: statement cache is closed")
+
+// StmtCache holds prepared statements for the queries which are run most,
+// keyed by their SQL text. Each statement is prepared the first time it's
+// run, rather than up front, and one which stops working, because the
+// connections it was prepared on went away or the server forgot it, is
+// prepared again. It's safe for concurrent use.
+//
+// A statement which goes stale while other queries are running it isn't
+// closed under them: the last of them to finish closes it.
+//
+// Only queries with fixed SQL text belong in a StmtCache. Queries built from
+// filters, or with a placeholder for each item of a list, would fill it with
+// statements which are hardly ever used again.
+type StmtCache struct {
+	DB *sql.DB
+
+	mu     sync.Mutex
+	stmts  map[string]*cachedStmt
+	closed bool
+}
+
+// cachedStmt is a statement in a StmtCache. users counts the withStmt calls
+// which are running it, and forgotten is set once it's been dropped from the
+// cache, so that it's closed when users gets back to zero.
+type cachedStmt struct {
+	stmt      *sql.Stmt
+	users     int
+	forgotten bool
+}
+
+// NewStmtCache returns an empty StmtCache for the connection pool db.
+func NewStmtCache(db *sql.DB) *StmtCache {
+	return &StmtCache{DB: db, stmts: make(map[string]*cachedStmt)}
+}
+
+// Prepare returns the prepared statement for query, preparing it if it
+// hasn't been already. It's meant to be passed to Tx.Stmt, which prepares
+// the statement again on the transaction's connection if it has been
+// closed since.
+func (c *StmtCache) Prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	cs, err := c.acquire(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.release(cs)
+
+	return cs.stmt, nil
+}
+
+// acquire returns the cached statement for query, preparing it if it hasn't
+// been already, and counts the caller as one of its users until it calls
+// release.
+func (c *StmtCache) acquire(ctx context.Context, query string) (*cachedStmt, error) {
+	c.mu.Lock()
+	cs, ok := c.stmts[query]
+	if ok {
+		cs.users++
+	}
+	closed := c.closed
+	c.mu.Unlock()
+
+	if ok {
+		return cs, nil
+	}
+	if closed {
+		return nil, errStmtCacheClosed
+	}
+
+	// The statement is prepared without holding the lock, so that queries
+	// whose statements are ready aren't held up behind it. If the same
+	// statement is prepared twice at once, the first one to be stored is
+	// kept and the other closed.
+	stmt, err := c.DB.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		stmt.Close()
+		return nil, errStmtCacheClosed
+	}
+	if kept, ok := c.stmts[query]; ok {
+		stmt.Close()
+		kept.users++
+		return kept, nil
+	}
+
+	cs = &cachedStmt{stmt: stmt, users: 1}
+	c.stmts[query] = cs
+	return cs, nil
+}
+
+// release ends a use of cs which began with acquire. If cs has been
+// forgotten, and this was the last use of it, it's closed.
+func (c *StmtCache) release(cs *cachedStmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cs.users--
+	if cs.forgotten && cs.users == 0 {
+		cs.stmt.Close()
+	}
+}
+
+// Query runs a query which returns rows, with the prepared statement for it.
+func (c *StmtCache) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return withStmt(ctx, c, query, func(stmt *sql.Stmt) (*sql.Rows, error) {
+		return stmt.QueryContext(ctx, args...)
+	})
+}
+
+// QueryRow runs a query which returns at most one row, with the prepared
+// statement for it. As with sql.DB's QueryRow, errors are deferred until the
+// row is scanned. If the statement can't be prepared, the query is run
+// without it, so that the error is still reported that way.
+func (c *StmtCache) QueryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	// The row carries any error from running the query, so only a failure
+	// to prepare the statement leaves it nil.
+	row, _ := withStmt(ctx, c, query, func(stmt *sql.Stmt) (*sql.Row, error) {
+		row := stmt.QueryRowContext(ctx, args...)
+		return row, row.Err()
+	})
+	if row == nil {
+		return c.DB.QueryRowContext(ctx, query, args...)
+	}
+	return row
+}
+
+// Close closes all of the statements, or, for those which are being run,
+// leaves them to be closed when the queries finish. The cache prepares no
+// more after it's closed.
+func (c *StmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+
+	var errs []error
+	for query, cs := range c.stmts {
+		delete(c.stmts, query)
+		cs.forgotten = true
+		if cs.users == 0 {
+			errs = append(errs, cs.stmt.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// forget drops cs, the statement for query, from the cache, so that the
+// statement is prepared afresh the next time it's run. It's closed once
+// nothing is running it any more. A statement which has already been
+// replaced is left alone.
+func (c *StmtCache) forget(query string, cs *cachedStmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stmts[query] == cs {
+		delete(c.stmts, query)
+		cs.forgotten = true
+		if cs.users == 0 {
+			cs.stmt.Close()
+		}
+	}
+}
+
+// withStmt runs fn with the prepared statement for query. If the statement
+// has gone stale, it's prepared again and fn is run once more.
+func withStmt[T any](ctx context.Context, c *StmtCache, query string, fn func(stmt *sql.Stmt) (T, error)) (T, error) {
+	cs, err := c.acquire(ctx, query)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	v, err := fn(cs.stmt)
+	if err == nil || !isStaleStmt(err) {
+		c.release(cs)
+		return v, err
+	}
+
+	c.forget(query, cs)
+	c.release(cs)
+
+	cs, err = c.acquire(ctx, query)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	defer c.release(cs)
+
+	return fn(cs.stmt)
+}
+
+// isStaleStmt reports whether err means that a prepared statement can't be
+// used any more and should be prepared again: the connections it was
+// prepared on went away, or the server has forgotten it (1243), or a table
+// it uses has changed under it (1615).
+func isStaleStmt(err error) bool {
+	var mySQLError *mysql.MySQLError
+	if errors.As(err, &mySQLError) {
+		return mySQLError.Number == 1243 || mySQLError.Number == 1615
+	}
+	return isConnError(err)
+}
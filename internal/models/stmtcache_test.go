@@ -0,0 +1,208 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// stmtClosed reports whether stmt has been closed. database/sql doesn't
+// export the error for running a closed statement, so it's matched by its
+// text.
+func stmtClosed(t *testing.T, stmt *sql.Stmt) bool {
+	t.Helper()
+
+	var n int
+	err := stmt.QueryRow().Scan(&n)
+	switch {
+	case err == nil:
+		return false
+	case err.Error() == "sql: statement is closed":
+		return true
+	}
+	t.Fatal(err)
+	return false
+}
+
+func TestStmtCacheConcurrentAcquire(t *testing.T) {
+	db, _ := newFakeDB(t)
+	c := NewStmtCache(db)
+	defer c.Close()
+
+	const query = "SELECT n FROM snippets"
+	const goroutines = 50
+
+	var wg sync.WaitGroup
+	got := make([]*cachedStmt, goroutines)
+	for i := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			cs, err := c.acquire(context.Background(), query)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			got[i] = cs
+			c.release(cs)
+		}()
+	}
+	wg.Wait()
+
+	// However many of them prepared the statement at once, only one was
+	// kept, and they were all handed it.
+	if len(c.stmts) != 1 {
+		t.Fatalf("got %d cached statements; want 1", len(c.stmts))
+	}
+	kept := c.stmts[query]
+	for i, cs := range got {
+		if cs != kept {
+			t.Errorf("goroutine %d got a statement other than the cached one", i)
+		}
+	}
+	if kept.users != 0 {
+		t.Errorf("got %d users after every release; want 0", kept.users)
+	}
+	if stmtClosed(t, kept.stmt) {
+		t.Error("the cached statement was closed")
+	}
+}
+
+func TestStmtCacheCloseInUse(t *testing.T) {
+	db, _ := newFakeDB(t)
+	c := NewStmtCache(db)
+
+	const query = "SELECT n FROM snippets"
+
+	cs, err := c.acquire(context.Background(), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The statement is still being used, so it's left open until it's
+	// released.
+	if stmtClosed(t, cs.stmt) {
+		t.Fatal("the statement was closed while it was in use")
+	}
+	c.release(cs)
+	if !stmtClosed(t, cs.stmt) {
+		t.Error("the statement wasn't closed when its last use was released")
+	}
+
+	_, err = c.acquire(context.Background(), query)
+	if !errors.Is(err, errStmtCacheClosed) {
+		t.Errorf("got error %v acquiring after Close; want %v", err, errStmtCacheClosed)
+	}
+}
+
+func TestStmtCacheForget(t *testing.T) {
+	db, fake := newFakeDB(t)
+	c := NewStmtCache(db)
+	defer c.Close()
+
+	const query = "SELECT n FROM snippets"
+
+	t.Run("Reprepared", func(t *testing.T) {
+		old, err := c.acquire(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.forget(query, old)
+
+		cs, err := c.acquire(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cs == old {
+			t.Fatal("got the forgotten statement back; want a new one")
+		}
+
+		// The forgotten statement is closed only once nothing is using
+		// it, and the new one is left open.
+		if stmtClosed(t, old.stmt) {
+			t.Fatal("the forgotten statement was closed while it was in use")
+		}
+		c.release(old)
+		if !stmtClosed(t, old.stmt) {
+			t.Error("the forgotten statement wasn't closed when it was released")
+		}
+		c.release(cs)
+		if stmtClosed(t, cs.stmt) {
+			t.Error("the new statement was closed")
+		}
+	})
+
+	t.Run("Replaced", func(t *testing.T) {
+		cs, err := c.acquire(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.release(cs)
+
+		// Forgetting a statement which has already been replaced leaves
+		// its replacement alone.
+		stale := &cachedStmt{stmt: cs.stmt}
+		c.forget(query, stale)
+		if c.stmts[query] != cs {
+			t.Error("forgetting a replaced statement dropped its replacement")
+		}
+	})
+
+	t.Run("Stale", func(t *testing.T) {
+		prepares, _, _ := fake.counts()
+
+		// The server has forgotten the statement, so withStmt prepares it
+		// again and runs it once more.
+		fake.failNext(&mysql.MySQLError{Number: 1243})
+
+		var n int
+		err := c.QueryRow(context.Background(), query).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("got n = %d; want 1", n)
+		}
+		if got, _, _ := fake.counts(); got != prepares+1 {
+			t.Errorf("got %d prepares; want %d", got-prepares, 1)
+		}
+	})
+}
+
+func TestIsStaleStmt(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"Unknown statement", &mysql.MySQLError{Number: 1243}, true},
+		{"Prepared statement needs re-preparing", &mysql.MySQLError{Number: 1615}, true},
+		{"Wrapped", fmt.Errorf("models: %w", &mysql.MySQLError{Number: 1243}), true},
+		{"Bad connection", driver.ErrBadConn, true},
+		{"Invalid connection", mysql.ErrInvalidConn, true},
+		{"Deadlock", &mysql.MySQLError{Number: 1213}, false},
+		{"Duplicate entry", &mysql.MySQLError{Number: 1062}, false},
+		{"Canceled", context.Canceled, false},
+		{"No rows", sql.ErrNoRows, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isStaleStmt(tt.err); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// SnippetStore is the set of snippet methods which the web application uses.
+// SnippetModel implements it against MySQL, and mocks.SnippetModel in
+// memory, so that handlers can be tested without a database.
+type SnippetStore interface {
+	Insert(ctx context.Context, title string, content string, expires int, userID int, orgID int, passphrase string, language string, heldReason string, publishAt time.Time, tags []string) (int, error)
+	Get(ctx context.Context, id int) (*Snippet, error)
+	GetForUser(ctx context.Context, id, userID int) (*Snippet, error)
+	Latest(ctx context.Context) ([]*Snippet, error)
+	Recent(ctx context.Context, k Keyset) (CursorPage, error)
+	List(ctx context.Context, filter SnippetFilter, f Filters) ([]*Snippet, Metadata, error)
+	Update(ctx context.Context, id, userID int, title, content, language string, version int) error
+	UpdateWithTags(ctx context.Context, id, userID int, title, content, language string, version int, tags []string) error
+	Delete(id int) error
+	InsertMany(userID int, snippets []NewSnippet) ([]int, error)
+	DeleteMany(ids []int) error
+	Fork(id, userID int) (int, error)
+	ForksOf(id int) ([]*Snippet, error)
+	Related(ctx context.Context, id, limit int) ([]*Snippet, error)
+	FindDuplicate(content string) (*Snippet, error)
+	CheckPassphrase(id int, passphrase string) (bool, error)
+
+	SetTags(id int, tags []string) error
+	LoadTags(snippets ...*Snippet) error
+	CountTags(tags []string) (map[string]int, error)
+
+	ByMonth(ctx context.Context, year int, month time.Month, k Keyset) (CursorPage, error)
+	ByLanguage(ctx context.Context, language string, k Keyset) (CursorPage, error)
+	ByOrg(ctx context.Context, orgID, page, pageSize int) ([]*Snippet, int, error)
+
+	AddViews(counts map[int]int) error
+	ViewCount(id int) (int, error)
+	Trending(ctx context.Context, window time.Duration, page, pageSize int) ([]*RankedSnippet, int, error)
+
+	Held() ([]*HeldSnippet, error)
+	Hold(id int, reason string) error
+	Approve(id int) error
+	Reject(id int) error
+
+	GetScheduled(id int) (*Snippet, error)
+	Scheduled(userID int) ([]*Snippet, error)
+	EachByUser(ctx context.Context, userID int, fn func(*Snippet) error) error
+	Import(userID int, s ImportedSnippet) (int, error)
+
+	InsertOnce(title, content string, expires, userID int) (string, error)
+	OnceExists(token string) (bool, error)
+	ConsumeOnce(token string) (*Snippet, error)
+
+	Pin(id, userID, limit int) error
+	Unpin(id int) error
+	SetAnnouncement(id int, announce bool) error
+	Announcements() ([]*Snippet, error)
+}
+
+// UserStore is the set of user methods which the web application uses.
+// UserModel implements it against MySQL, and mocks.UserModel in memory.
+type UserStore interface {
+	Insert(name, username, email, password string) (int, error)
+	Authenticate(email, password string) (int, error)
+	Get(id int) (*User, error)
+	GetMany(ids []int) (map[int]*User, error)
+	GetByUsername(username string) (*User, error)
+	GetByEmail(email string) (*User, error)
+	GetForToken(scope, tokenPlaintext string) (*User, *Token, error)
+	UpdateProfile(id int, username, displayName, bio, timeZone string) error
+	SetAvatar(id int, key string) (string, error)
+	HasAvatar(key string) (bool, error)
+	Delete(id int) error
+}
+
+// PermissionStore is the set of permission methods which the web
+// application uses. PermissionModel implements it against MySQL, and
+// mocks.PermissionModel in memory.
+type PermissionStore interface {
+	GetAllForUser(userID int) (Permissions, error)
+	AddForUser(userID int, codes ...string) error
+	RemoveForUser(userID int, codes ...string) error
+}
+
+// OrgStore is the set of organization methods which the web application
+// uses. OrgModel implements it against MySQL, and mocks.OrgModel in memory.
+type OrgStore interface {
+	Insert(name, slug string, ownerID int) (int, error)
+	Get(id int) (*Org, error)
+	GetBySlug(slug string) (*Org, error)
+	ForUser(userID int) ([]*Org, error)
+	Role(orgID, userID int) (string, error)
+	Members(orgID int) ([]*OrgMember, error)
+	SetMember(orgID, userID int, role string) error
+	RemoveMember(orgID, userID int) error
+	Rename(id int, name string) error
+	Delete(id int) error
+}
+
+// CommentStore is the set of comment methods which the web application
+// uses. CommentModel implements it against MySQL, and mocks.CommentModel in
+// memory.
+type CommentStore interface {
+	Insert(snippetID, userID int, content string) (int, error)
+	Get(id int) (*Comment, error)
+	ListBySnippet(snippetID, page, pageSize int) ([]*Comment, int, error)
+	ListForSnippets(snippetIDs []int, offset, limit int) (map[int][]*Comment, error)
+	Delete(id int, user *User) error
+	Counts(snippetIDs []int) (map[int]int, error)
+	ByUser(ctx context.Context, userID int) ([]*Comment, error)
+}
+
+// StarStore is the set of star methods which the web application uses.
+// StarModel implements it against MySQL, and mocks.StarModel in memory.
+type StarStore interface {
+	Toggle(userID, snippetID int) (bool, error)
+	Count(snippetID int) (int, error)
+	IsStarred(userID, snippetID int) (bool, error)
+	Counts(snippetIDs []int) (map[int]int, error)
+	StarredBy(userID int) ([]*Snippet, error)
+	ByUser(ctx context.Context, userID int) ([]Star, error)
+}
+
+// FollowStore is the set of follow methods which the web application uses.
+// FollowModel implements it against MySQL, and mocks.FollowModel in memory.
+type FollowStore interface {
+	Toggle(followerID, followedID int) (bool, error)
+	IsFollowing(followerID, followedID int) (bool, error)
+	Counts(userID int) (followers, following int, err error)
+	Feed(ctx context.Context, userID int) ([]*Snippet, error)
+}
+
+// CollectionStore is the set of collection methods which the web
+// application uses. CollectionModel implements it against MySQL, and
+// mocks.CollectionModel in memory.
+type CollectionStore interface {
+	Insert(userID int, name, description string, public bool) (int, error)
+	Get(id int) (*Collection, error)
+	ForUser(userID int, private bool) ([]*Collection, error)
+	Update(id int, name, description string, public bool) error
+	Delete(id int) error
+	Items(collectionID int) ([]*Snippet, error)
+	Containing(userID, snippetID int) (map[int]bool, error)
+	AddItem(collectionID, snippetID int) error
+	RemoveItem(collectionID, snippetID int) error
+	MoveItem(collectionID, snippetID int, down bool) error
+}
+
+// LoginAttemptStore is the set of login attempt methods which the web
+// application uses. LoginAttemptModel implements it against MySQL, and
+// mocks.LoginAttemptModel in memory.
+type LoginAttemptStore interface {
+	Begin(email, ip string) (int64, error)
+	Succeeded(id int64) error
+	Cancel(id int64) error
+	Failures(email, ip string, since time.Time, exclude int64) (*LoginFailures, error)
+	DeleteBefore(before time.Time) (int64, error)
+}
+
+// AuditStore is the set of audit log methods which the web application
+// uses. AuditModel implements it against MySQL, and mocks.AuditModel in
+// memory.
+type AuditStore interface {
+	Insert(userID int, ip, country, event, detail string) error
+	Latest(limit int) ([]*AuditEvent, error)
+	ForIP(ip string, limit int) ([]*AuditEvent, error)
+}
+
+// IdentityStore is the set of OpenID Connect identity methods which the web
+// application uses. IdentityModel implements it against MySQL, and
+// mocks.IdentityModel in memory.
+type IdentityStore interface {
+	UserFor(issuer, subject string) (int, error)
+	Link(issuer, subject string, userID int) error
+	AddSession(token, issuer, subject, sid string, expiry time.Time) error
+	TakeSessions(issuer, subject, sid string) ([]string, error)
+}
+
+// AttachmentStore is the set of attachment methods which the web
+// application uses. AttachmentModel implements it against MySQL, and
+// mocks.AttachmentModel in memory.
+type AttachmentStore interface {
+	Insert(a *Attachment) (int, error)
+	Get(id int) (*Attachment, error)
+	ListBySnippet(snippetID int) ([]*Attachment, error)
+	SetScanStatus(id int, status, threat string) error
+	Release(id int) error
+	ListByScanStatus(status string, limit int) ([]*Attachment, error)
+	Count(snippetID int) (int, error)
+	Delete(id int) error
+	KnownKeys(keys []string) (map[string]bool, error)
+}
+
+// Check that the models implement the interfaces, so that a change to one
+// which isn't made to the other is caught when building.
+var (
+	_ SnippetStore    = (*SnippetModel)(nil)
+	_ UserStore       = (*UserModel)(nil)
+	_ PermissionStore = (*PermissionModel)(nil)
+	_ OrgStore        = (*OrgModel)(nil)
+	_ CommentStore    = (*CommentModel)(nil)
+	_ StarStore       = (*StarModel)(nil)
+	_ FollowStore     = (*FollowModel)(nil)
+	_ CollectionStore = (*CollectionModel)(nil)
+	_ AttachmentStore = (*AttachmentModel)(nil)
+
+	_ LoginAttemptStore = (*LoginAttemptModel)(nil)
+	_ IdentityStore     = (*IdentityModel)(nil)
+	_ AuditStore        = (*AuditModel)(nil)
+)
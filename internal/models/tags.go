@@ -0,0 +1,108 @@
+package models
+
+import (
+	"strings"
+)
+
+// SetTags replaces the tags of a snippet. Tags should already be normalized
+// and free of duplicates; see the web application's parseTags.
+func (m *SnippetModel) SetTags(id int, tags []string) error {
+	return withTx(m.DB, func(q Queries) error {
+		return setTags(q, id, tags)
+	})
+}
+
+// setTags replaces the tags of a snippet as part of a larger transaction.
+func setTags(q Queries, id int, tags []string) error {
+	_, err := q.Exec("DELETE FROM snippet_tags WHERE snippet_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		_, err = q.Exec("INSERT INTO snippet_tags (snippet_id, tag) VALUES(?, ?)", id, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadTags fills in the Tags field of each of the snippets, with one query
+// however many snippets there are. Tags are sorted alphabetically.
+func (m *SnippetModel) LoadTags(snippets ...*Snippet) error {
+	if len(snippets) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*Snippet, len(snippets))
+	args := make([]any, len(snippets))
+	for i, s := range snippets {
+		byID[s.ID] = s
+		s.Tags = nil
+		args[i] = s.ID
+	}
+
+	stmt := `SELECT snippet_id, tag FROM snippet_tags
+	WHERE snippet_id IN (?` + strings.Repeat(", ?", len(snippets)-1) + `)
+	ORDER BY snippet_id, tag`
+
+	rows, err := retrying(m.DB).Query(stmt, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		if s, ok := byID[id]; ok {
+			s.Tags = append(s.Tags, tag)
+		}
+	}
+
+	return rows.Err()
+}
+
+// CountTags returns how many listed snippets have each of the given tags:
+// the ones which List would find when filtering by the tag. Tags which no
+// listed snippet has are left out of the map.
+func (m *SnippetModel) CountTags(tags []string) (map[string]int, error) {
+	counts := make(map[string]int, len(tags))
+	if len(tags) == 0 {
+		return counts, nil
+	}
+
+	args := make([]any, len(tags))
+	for i, tag := range tags {
+		args[i] = tag
+	}
+
+	stmt := `SELECT t.tag, COUNT(*) FROM snippet_tags t
+	JOIN snippets ON snippets.id = t.snippet_id
+	WHERE t.tag IN (?` + strings.Repeat(", ?", len(tags)-1) + `)
+	AND snippets.expires > NOW() AND snippets.held_reason IS NULL
+	AND snippets.publish_at <= UTC_TIMESTAMP() AND snippets.org_id IS NULL
+	GROUP BY t.tag`
+
+	rows, err := retrying(m.DB).Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag string
+		var n int
+		if err := rows.Scan(&tag, &n); err != nil {
+			return nil, err
+		}
+		counts[tag] = n
+	}
+
+	return counts, rows.Err()
+}
@@ -0,0 +1,209 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Define constants for the token scopes. For now we only use tokens for
+// stateless API authentication.
+const (
+	ScopeAuthentication = "authentication"
+)
+
+// The API scopes limit what an authentication token can be used for. Read
+// lets it see the user's account and private snippets through the API, and
+// write lets it create and change snippets. They're separate from a token's
+// Scope, which says what kind of token it is.
+const (
+	APIScopeRead  = "read"
+	APIScopeWrite = "write"
+)
+
+// APIScopes lists every API scope, in the order they're shown in forms.
+// Tokens made by logging in through the API have all of them.
+var APIScopes = []string{APIScopeRead, APIScopeWrite}
+
+// Define a Token type to hold the data for an individual token. The plaintext
+// version is only ever sent back to the client once; the database only sees
+// the hash. Tokens made on the API keys page have a name; LastUsed is the
+// zero time until the token is first used.
+type Token struct {
+	ID        int       `json:"-"`
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	UserID    int       `json:"-"`
+	Name      string    `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	Scope     string    `json:"-"`
+	Scopes    []string  `json:"scopes"`
+	Created   time.Time `json:"-"`
+	LastUsed  time.Time `json:"-"`
+}
+
+// HasScope reports whether the token was given the API scope.
+func (t *Token) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+func generateToken(userID int, ttl time.Duration, scope string) (*Token, error) {
+	token := &Token{
+		UserID:  userID,
+		Expiry:  time.Now().Add(ttl),
+		Scope:   scope,
+		Scopes:  APIScopes,
+		Created: time.Now(),
+	}
+
+	// Fill a byte slice with 16 random bytes from the operating system's
+	// CSPRNG and encode it to a base-32 string without padding. This gives
+	// us a 26 character token, for example "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU".
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+
+	return token, nil
+}
+
+// Define a TokenModel type which wraps a database connection pool.
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// New creates a new token for the user and stores its hash in the tokens
+// table.
+func (m *TokenModel) New(userID int, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(token)
+	return token, err
+}
+
+// NewNamed creates a named authentication token for the user, limited to
+// the given API scopes, as made on the API keys page.
+func (m *TokenModel) NewNamed(userID int, name string, scopes []string, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+	token.Name = name
+	token.Scopes = scopes
+
+	err = m.Insert(token)
+	return token, err
+}
+
+// Insert adds the data for a specific token to the tokens table, and sets
+// its ID.
+func (m *TokenModel) Insert(token *Token) error {
+	stmt := `INSERT INTO tokens (hash, user_id, name, expiry, scope, scopes, created)
+	VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := retrying(m.DB).Exec(stmt, token.Hash, token.UserID, token.Name, token.Expiry.UTC(),
+		token.Scope, strings.Join(token.Scopes, ","), token.Created.UTC())
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	token.ID = int(id)
+
+	return nil
+}
+
+// ForUser returns the user's unexpired authentication tokens, newest first.
+// Their plaintext and hash aren't filled in.
+func (m *TokenModel) ForUser(userID int) ([]*Token, error) {
+	stmt := `SELECT id, name, expiry, scopes, created, last_used_at FROM tokens
+	WHERE user_id = ? AND scope = ? AND expiry > UTC_TIMESTAMP()
+	ORDER BY id DESC`
+
+	rows, err := retrying(m.DB).Query(stmt, userID, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*Token
+	for rows.Next() {
+		t := &Token{UserID: userID, Scope: ScopeAuthentication}
+		var scopes string
+		var lastUsed sql.NullTime
+
+		err := rows.Scan(&t.ID, &t.Name, &t.Expiry, &scopes, &t.Created, &lastUsed)
+		if err != nil {
+			return nil, err
+		}
+		t.Scopes = splitScopes(scopes)
+		t.LastUsed = lastUsed.Time
+
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+// Revoke deletes one of the user's tokens. It returns ErrNoRecord if the
+// user has no token with that ID.
+func (m *TokenModel) Revoke(id, userID int) error {
+	result, err := retrying(m.DB).Exec(`DELETE FROM tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Touch records that a token has just been used. The time is only updated
+// once a minute, so that a busy script doesn't write to the table on every
+// request.
+func (m *TokenModel) Touch(id int) error {
+	stmt := `UPDATE tokens SET last_used_at = UTC_TIMESTAMP()
+	WHERE id = ? AND (last_used_at IS NULL OR last_used_at < UTC_TIMESTAMP() - INTERVAL 1 MINUTE)`
+
+	_, err := retrying(m.DB).Exec(stmt, id)
+	return err
+}
+
+// splitScopes turns the comma-separated scopes column back into a slice.
+func splitScopes(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// DeleteAllForUser deletes all tokens with the given scope for a specific
+// user.
+func (m *TokenModel) DeleteAllForUser(scope string, userID int) error {
+	stmt := `DELETE FROM tokens WHERE scope = ? AND user_id = ?`
+
+	_, err := retrying(m.DB).Exec(stmt, scope, userID)
+	return err
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// starWeight is how many views a star counts as in the popularity score.
+const starWeight = 10
+
+// RankedSnippet is a snippet with its views and popularity score over a
+// period of time.
+type RankedSnippet struct {
+	*Snippet
+	Views int
+	Score float64
+}
+
+// AddViews adds to the view counts of snippets for today, keyed by snippet
+// ID. Views are counted in memory and added in batches, so that a popular
+// snippet's row isn't updated on every view. Views of snippets which have
+// been deleted since are dropped.
+func (m *SnippetModel) AddViews(counts map[int]int) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	// Sort the IDs so that concurrent batches lock rows in the same order.
+	ids := make([]int, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	args := make([]any, 0, 2*len(ids))
+	for _, id := range ids {
+		args = append(args, id, counts[id])
+	}
+
+	stmt := `INSERT INTO snippet_views (snippet_id, day, views)
+	SELECT v.snippet_id, UTC_DATE(), v.views
+	FROM (` + strings.TrimSuffix(strings.Repeat("SELECT ? AS snippet_id, ? AS views UNION ALL ", len(ids)), " UNION ALL ") + `) v
+	INNER JOIN snippets ON snippets.id = v.snippet_id
+	ON DUPLICATE KEY UPDATE views = snippet_views.views + VALUES(views)`
+
+	_, err := retrying(m.DB).Exec(stmt, args...)
+	return err
+}
+
+// Trending returns one page of the unexpired snippets which have been viewed
+// or starred within the window, most popular first, along with how many such
+// snippets there are. Pages are numbered from 1.
+//
+// Views are counted per snippet and day. A day's views (and stars) count for
+// half as much with each day that passes, so that trending snippets are the
+// ones which are popular now rather than the ones which were popular once.
+func (m *SnippetModel) Trending(ctx context.Context, window time.Duration, page, pageSize int) ([]*RankedSnippet, int, error) {
+	days := max(1, int(window/(24*time.Hour)))
+
+	// Today counts as the first day of the window.
+	since := fmt.Sprintf("UTC_DATE() - INTERVAL %d DAY", days-1)
+
+	stmt := `SELECT COUNT(*) OVER(), ` + snippetColumns + `, COALESCE(v.views, 0),
+		COALESCE(v.score, 0) + ? * COALESCE(st.score, 0) AS score
+	FROM snippets
+	LEFT JOIN (
+		SELECT snippet_id, SUM(views) AS views, SUM(views * POW(0.5, DATEDIFF(UTC_DATE(), day))) AS score
+		FROM snippet_views WHERE day >= ` + since + `
+		GROUP BY snippet_id
+	) v ON v.snippet_id = snippets.id
+	LEFT JOIN (
+		SELECT snippet_id, SUM(POW(0.5, DATEDIFF(UTC_DATE(), DATE(created)))) AS score
+		FROM stars WHERE created >= ` + since + `
+		GROUP BY snippet_id
+	) st ON st.snippet_id = snippets.id
+	WHERE snippets.expires > NOW() AND snippets.held_reason IS NULL AND snippets.publish_at <= UTC_TIMESTAMP()
+	AND snippets.org_id IS NULL AND (v.snippet_id IS NOT NULL OR st.snippet_id IS NOT NULL)
+	ORDER BY score DESC, snippets.id DESC
+	LIMIT ? OFFSET ?`
+
+	rows, err := retrying(m.DB).QueryContext(ctx, stmt, starWeight, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var ranked []*RankedSnippet
+	total := 0
+
+	for rows.Next() {
+		rs := &RankedSnippet{}
+		sc := countingScanner{rankScanner{rows, &rs.Views, &rs.Score}, &total}
+		rs.Snippet, err = scanSnippet(sc, m.Keys)
+		if err != nil {
+			return nil, 0, err
+		}
+		ranked = append(ranked, rs)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return ranked, total, nil
+}
+
+// rankScanner scans trailing views and score columns into views and score,
+// and the columns before them into the destinations it's given, so that
+// scanSnippet can be used on rows which end with them.
+type rankScanner struct {
+	scanner
+	views *int
+	score *float64
+}
+
+func (r rankScanner) Scan(dest ...any) error {
+	return r.scanner.Scan(append(dest, r.views, r.score)...)
+}
+
+// ViewCount returns how many times a snippet has been viewed in all. Views
+// still waiting to be added aren't included.
+func (m *SnippetModel) ViewCount(id int) (int, error) {
+	var views int
+	err := retrying(m.DB).QueryRow(`SELECT COALESCE(SUM(views), 0) FROM snippet_views WHERE snippet_id = ?`, id).Scan(&views)
+	return views, err
+}
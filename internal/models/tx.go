@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Queries runs statements inside a transaction begun by withTx. It has the
+// same methods as *sql.DB, so code which runs in a transaction reads just
+// like code which doesn't, but it can't commit or roll back: withTx does
+// that when the closure returns. Every statement is run with the context
+// the transaction was begun with.
+type Queries struct {
+	ctx context.Context
+	tx  *sql.Tx
+}
+
+// Exec executes a statement which doesn't return rows.
+func (q Queries) Exec(query string, args ...any) (sql.Result, error) {
+	return q.tx.ExecContext(q.ctx, query, args...)
+}
+
+// Query executes a query which returns rows.
+func (q Queries) Query(query string, args ...any) (*sql.Rows, error) {
+	return q.tx.QueryContext(q.ctx, query, args...)
+}
+
+// QueryRow executes a query which returns at most one row.
+func (q Queries) QueryRow(query string, args ...any) *sql.Row {
+	return q.tx.QueryRowContext(q.ctx, query, args...)
+}
+
+// Stmt returns a copy of a prepared statement which runs in the transaction.
+func (q Queries) Stmt(stmt *sql.Stmt) *sql.Stmt {
+	return q.tx.StmtContext(q.ctx, stmt)
+}
+
+// withTx begins a transaction on db and passes it to fn. The transaction is
+// committed if fn returns nil, and rolled back if it returns an error or
+// panics, so fn can return as soon as anything goes wrong.
+//
+// A transaction which fails with a transient error, like a deadlock, is
+// rolled back and run again from the start, as Retries says. So fn may be
+// called more than once, and mustn't leave anything behind from a call which
+// failed, like rows appended to a slice outside it.
+func withTx(db *sql.DB, fn func(q Queries) error) error {
+	return withTxContext(context.Background(), db, fn)
+}
+
+// withTxContext is like withTx, with a context. If ctx is cancelled before
+// the transaction is committed, it's rolled back.
+func withTxContext(ctx context.Context, db *sql.DB, fn func(q Queries) error) error {
+	return retry(func() error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		// Rollback is a no-op once the transaction has been committed, and
+		// it runs while a panic unwinds too.
+		defer tx.Rollback()
+
+		if err := fn(Queries{ctx: ctx, tx: tx}); err != nil {
+			return err
+		}
+
+		// If the connection is lost while committing, there's no telling
+		// whether the commit went through, so it isn't tried again.
+		err = tx.Commit()
+		if isConnError(err) {
+			return finalError{err}
+		}
+		return err
+	})
+}
@@ -0,0 +1,331 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Define a User type. Notice how the field names and types align with the
+// columns in the database users table?
+type User struct {
+	ID             int       `json:"id"`
+	Name           string    `json:"name"`
+	Username       string    `json:"username"`
+	Email          string    `json:"email"`
+	HashedPassword []byte    `json:"-"`
+	Created        time.Time `json:"created"`
+	DisplayName    string    `json:"display_name,omitempty"`
+	Bio            string    `json:"bio,omitempty"`
+	TimeZone       string    `json:"-"`
+	AvatarKey      string    `json:"-"`
+
+	// Permissions aren't loaded with the user; the authentication
+	// middleware fills them in from the PermissionModel.
+	Permissions Permissions `json:"-"`
+}
+
+// Can reports whether the user has the permission with the given code.
+func (u *User) Can(code string) bool {
+	return u.Permissions.Include(code)
+}
+
+// ShownName returns the name to show for the user on their profile and
+// next to their snippets: their display name if they've set one, or else
+// the name they signed up with.
+func (u *User) ShownName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Name
+}
+
+// Initial returns the first letter of the user's shown name, in upper case,
+// for drawing a placeholder avatar.
+func (u *User) Initial() string {
+	for _, r := range u.ShownName() {
+		return strings.ToUpper(string(r))
+	}
+	return "?"
+}
+
+// userColumns lists the columns which scanUser expects, in order.
+const userColumns = `users.id, users.name, users.username, users.email, users.hashed_password,
+	users.created, users.display_name, users.bio, users.time_zone, users.avatar_key`
+
+// scanUser copies the userColumns of the current row into a new User. Any
+// columns selected after them are scanned into trailing.
+func scanUser(sc scanner, trailing ...any) (*User, error) {
+	u := &User{}
+	var avatarKey sql.NullString
+
+	dest := []any{&u.ID, &u.Name, &u.Username, &u.Email, &u.HashedPassword,
+		&u.Created, &u.DisplayName, &u.Bio, &u.TimeZone, &avatarKey}
+	err := sc.Scan(append(dest, trailing...)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	u.AvatarKey = avatarKey.String
+
+	return u, nil
+}
+
+// AnonymousUser represents a request which carries no authentication token.
+var AnonymousUser = &User{}
+
+// IsAnonymous reports whether the User is the AnonymousUser.
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
+// Define a UserModel type which wraps a database connection pool.
+type UserModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a new record to the users table and returns its ID. The
+// password is stored as a bcrypt hash, never in plain text.
+func (m *UserModel) Insert(name, username, email, password string) (int, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `INSERT INTO users (name, username, email, hashed_password, created)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := retrying(m.DB).Exec(stmt, name, username, email, string(hashedPassword))
+	if err != nil {
+		// If this returns an error, we use the errors.As() function to check
+		// whether the error has the type *mysql.MySQLError. If it does, the
+		// error will be assigned to the mySQLError variable. We can then check
+		// whether or not the error relates to our users_uc_email key by
+		// checking if the error code equals 1062 and the contents of the error
+		// message string.
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) {
+			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
+				return 0, ErrDuplicateEmail
+			}
+		}
+		return 0, duplicateUsername(err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// duplicateUsername returns ErrDuplicateUsername if err is a violation of
+// the users_uc_username key, and err otherwise.
+func duplicateUsername(err error) error {
+	var mySQLError *mysql.MySQLError
+	if errors.As(err, &mySQLError) {
+		if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_username") {
+			return ErrDuplicateUsername
+		}
+	}
+	return err
+}
+
+// Authenticate verifies whether a user exists with the provided email address
+// and password. This will return the relevant user ID if they do.
+func (m *UserModel) Authenticate(email, password string) (int, error) {
+	var id int
+	var hashedPassword []byte
+
+	stmt := "SELECT id, hashed_password FROM users WHERE email = ?"
+
+	err := retrying(m.DB).QueryRow(stmt, email).Scan(&id, &hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidCredentials
+		} else {
+			return 0, err
+		}
+	}
+
+	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return 0, ErrInvalidCredentials
+		} else {
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+// Get returns the user with the given ID.
+func (m *UserModel) Get(id int) (*User, error) {
+	stmt := "SELECT " + userColumns + " FROM users WHERE id = ?"
+
+	return scanUser(retrying(m.DB).QueryRow(stmt, id))
+}
+
+// GetMany returns the users with the given IDs, keyed by ID, with one query
+// however many there are. IDs which don't belong to a user are left out.
+func (m *UserModel) GetMany(ids []int) (map[int]*User, error) {
+	users := make(map[int]*User, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	stmt := "SELECT " + userColumns + " FROM users WHERE id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+
+	rows, err := retrying(m.DB).Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users[u.ID] = u
+	}
+
+	return users, rows.Err()
+}
+
+// GetByUsername returns the user with the given username.
+func (m *UserModel) GetByUsername(username string) (*User, error) {
+	stmt := "SELECT " + userColumns + " FROM users WHERE username = ?"
+
+	return scanUser(retrying(m.DB).QueryRow(stmt, username))
+}
+
+// GetByEmail returns the user with the given email address.
+func (m *UserModel) GetByEmail(email string) (*User, error) {
+	stmt := "SELECT " + userColumns + " FROM users WHERE email = ?"
+
+	return scanUser(retrying(m.DB).QueryRow(stmt, email))
+}
+
+// GetForToken looks up the user that owns an unexpired token with the given
+// scope, and returns the token too, with its ID and API scopes. We only ever
+// store the SHA-256 hash of a token, so the plaintext is hashed here before
+// the lookup.
+func (m *UserModel) GetForToken(scope, tokenPlaintext string) (*User, *Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	stmt := `SELECT ` + userColumns + `, tokens.id, tokens.scopes
+	FROM users
+	INNER JOIN tokens ON users.id = tokens.user_id
+	WHERE tokens.hash = ? AND tokens.scope = ? AND tokens.expiry > UTC_TIMESTAMP()`
+
+	token := &Token{Hash: tokenHash[:], Scope: scope}
+	var scopes string
+
+	user, err := scanUser(retrying(m.DB).QueryRow(stmt, tokenHash[:], scope), &token.ID, &scopes)
+	if err != nil {
+		return nil, nil, err
+	}
+	token.UserID = user.ID
+	token.Scopes = splitScopes(scopes)
+
+	return user, token, nil
+}
+
+// UpdateProfile changes the public profile of a user, and their time zone.
+// It returns ErrDuplicateUsername if someone else has the username.
+func (m *UserModel) UpdateProfile(id int, username, displayName, bio, timeZone string) error {
+	stmt := `UPDATE users SET username = ?, display_name = ?, bio = ?, time_zone = ?
+	WHERE id = ?`
+
+	_, err := retrying(m.DB).Exec(stmt, username, displayName, bio, timeZone, id)
+	if err != nil {
+		return duplicateUsername(err)
+	}
+
+	return nil
+}
+
+// SetAvatar changes the storage key of a user's uploaded avatar, and returns
+// the key of the avatar it replaced, if any, so that its blob can be
+// deleted. An empty key removes the avatar.
+func (m *UserModel) SetAvatar(id int, key string) (string, error) {
+	var old sql.NullString
+	err := withTx(m.DB, func(q Queries) error {
+		err := q.QueryRow("SELECT avatar_key FROM users WHERE id = ? FOR UPDATE", id).Scan(&old)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNoRecord
+			}
+			return err
+		}
+
+		_, err = q.Exec("UPDATE users SET avatar_key = ? WHERE id = ?", sql.NullString{String: key, Valid: key != ""}, id)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return old.String, nil
+}
+
+// HasAvatar reports whether key is the storage key of someone's avatar.
+func (m *UserModel) HasAvatar(key string) (bool, error) {
+	var exists bool
+	err := retrying(m.DB).QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE avatar_key = ?)", key).Scan(&exists)
+	return exists, err
+}
+
+// Delete deletes a user's account, along with their snippets and everything
+// which belongs to them: their comments, stars, follows, collections,
+// webhooks and tokens go with them through the foreign keys. Revisions they
+// made of other people's snippets and reports they filed are kept without
+// their name, and their entries in the audit log and their login attempts
+// are anonymized or removed. It's all done in one transaction, so an
+// account is never left half deleted. The files of their avatar and
+// attachments are removed later by the blob collector, once nothing refers
+// to them.
+func (m *UserModel) Delete(id int) error {
+	return withTx(m.DB, func(q Queries) error {
+		var email string
+		err := q.QueryRow("SELECT email FROM users WHERE id = ? FOR UPDATE", id).Scan(&email)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNoRecord
+			}
+			return err
+		}
+
+		stmts := []struct {
+			query string
+			arg   any
+		}{
+			{"DELETE FROM snippets WHERE user_id = ?", id},
+			{"UPDATE audit_log SET user_id = NULL, ip = '' WHERE user_id = ?", id},
+			{"DELETE FROM login_attempts WHERE email = ?", email},
+			{"DELETE FROM users WHERE id = ?", id},
+		}
+		for _, stmt := range stmts {
+			if _, err := q.Exec(stmt.query, stmt.arg); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
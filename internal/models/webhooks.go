@@ -0,0 +1,289 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"snippetbox.floccinau.net/internal/crypto"
+)
+
+// The events which webhooks can subscribe to.
+const (
+	EventSnippetCreated = "snippet.created"
+	EventSnippetUpdated = "snippet.updated"
+	EventSnippetDeleted = "snippet.deleted"
+
+	EventAttachmentQuarantined = "attachment.quarantined"
+)
+
+// WebhookEvents lists every event, in the order they're shown in forms.
+var WebhookEvents = []string{EventSnippetCreated, EventSnippetUpdated, EventSnippetDeleted, EventAttachmentQuarantined}
+
+// The states a webhook delivery can be in. Pending deliveries are retried
+// until they succeed or run out of attempts and fail.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Define a Webhook type to hold an endpoint which a user wants their snippet
+// events sent to. Payloads are signed with Secret so the endpoint can check
+// that they came from us.
+type Webhook struct {
+	ID      int
+	UserID  int
+	URL     string
+	Secret  string
+	Events  []string
+	Created time.Time
+}
+
+// WebhookDelivery is one event sent (or to be sent) to a webhook, along with
+// the outcome of the latest attempt.
+type WebhookDelivery struct {
+	ID           int
+	WebhookID    int
+	Event        string
+	Payload      string
+	Status       string
+	Attempts     int
+	ResponseCode int
+	Error        string
+	NextAttempt  time.Time
+	Created      time.Time
+}
+
+// Define a WebhookModel type which wraps a database connection pool. Webhook
+// secrets and delivery payloads (which contain snippet content) are
+// encrypted at rest with Keys.
+type WebhookModel struct {
+	DB   *sql.DB
+	Keys *crypto.Keyring
+}
+
+const webhookColumns = `id, user_id, url, secret, events, created`
+
+func (m *WebhookModel) scanWebhook(sc scanner) (*Webhook, error) {
+	w := &Webhook{}
+	var events string
+
+	err := sc.Scan(&w.ID, &w.UserID, &w.URL, &w.Secret, &events, &w.Created)
+	if err != nil {
+		return nil, err
+	}
+
+	w.Events = strings.Split(events, ",")
+	w.Secret, err = m.Keys.Decrypt(w.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Insert adds a new webhook for the user and returns its ID.
+func (m *WebhookModel) Insert(userID int, url, secret string, events []string) (int, error) {
+	secret, err := m.Keys.Encrypt(secret)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `INSERT INTO webhooks (user_id, url, secret, events, created)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := retrying(m.DB).Exec(stmt, userID, url, secret, strings.Join(events, ","))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Get returns a webhook by its ID.
+func (m *WebhookModel) Get(id int) (*Webhook, error) {
+	stmt := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = ?`
+
+	w, err := m.scanWebhook(retrying(m.DB).QueryRow(stmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// ForUser returns the user's webhooks, oldest first.
+func (m *WebhookModel) ForUser(userID int) ([]*Webhook, error) {
+	stmt := `SELECT ` + webhookColumns + ` FROM webhooks WHERE user_id = ? ORDER BY id`
+
+	rows, err := retrying(m.DB).Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*Webhook
+	for rows.Next() {
+		w, err := m.scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// Delete removes a webhook and its delivery log.
+func (m *WebhookModel) Delete(id int) error {
+	_, err := retrying(m.DB).Exec("DELETE FROM webhooks WHERE id = ?", id)
+	return err
+}
+
+// QueueDeliveries records a pending delivery of the payload to each of the
+// user's webhooks which subscribe to event, and returns the IDs of the new
+// deliveries. Sending them is up to the caller.
+func (m *WebhookModel) QueueDeliveries(userID int, event string, payload []byte) ([]int, error) {
+	rows, err := retrying(m.DB).Query("SELECT id FROM webhooks WHERE user_id = ? AND FIND_IN_SET(?, events)", userID, event)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhookIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		webhookIDs = append(webhookIDs, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(webhookIDs) == 0 {
+		return nil, nil
+	}
+
+	encrypted, err := m.Keys.Encrypt(string(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := `INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt, created)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP())`
+
+	var ids []int
+	for _, webhookID := range webhookIDs {
+		result, err := retrying(m.DB).Exec(stmt, webhookID, event, encrypted, DeliveryPending)
+		if err != nil {
+			return nil, err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, int(id))
+	}
+
+	return ids, nil
+}
+
+const deliveryColumns = `id, webhook_id, event, payload, status, attempts, response_code, error, next_attempt, created`
+
+func (m *WebhookModel) scanDelivery(sc scanner) (*WebhookDelivery, error) {
+	d := &WebhookDelivery{}
+	var code sql.NullInt64
+	var msg sql.NullString
+
+	err := sc.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &code, &msg, &d.NextAttempt, &d.Created)
+	if err != nil {
+		return nil, err
+	}
+
+	d.ResponseCode = int(code.Int64)
+	d.Error = msg.String
+	d.Payload, err = m.Keys.Decrypt(d.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// RecordAttempt records the outcome of an attempt to send a delivery: its
+// new status, the response code (0 if there wasn't a response) and error,
+// and when to try again if it's still pending.
+func (m *WebhookModel) RecordAttempt(id int, status string, code int, msg string, next time.Time) error {
+	// Keep the error message within the size of the column.
+	if r := []rune(msg); len(r) > 255 {
+		msg = string(r[:255])
+	}
+
+	stmt := `UPDATE webhook_deliveries
+	SET status = ?, attempts = attempts + 1, response_code = ?, error = ?, next_attempt = ?
+	WHERE id = ?`
+
+	_, err := retrying(m.DB).Exec(stmt, status, sql.NullInt64{Int64: int64(code), Valid: code != 0},
+		sql.NullString{String: msg, Valid: msg != ""}, next.UTC(), id)
+	return err
+}
+
+// Deliveries returns the latest limit deliveries to a webhook, newest first.
+func (m *WebhookModel) Deliveries(webhookID, limit int) ([]*WebhookDelivery, error) {
+	stmt := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries
+	WHERE webhook_id = ? ORDER BY created DESC, id DESC LIMIT ?`
+
+	rows, err := retrying(m.DB).Query(stmt, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		d, err := m.scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// GetDelivery returns a delivery by its ID.
+func (m *WebhookModel) GetDelivery(id int) (*WebhookDelivery, error) {
+	stmt := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE id = ?`
+
+	d, err := m.scanDelivery(retrying(m.DB).QueryRow(stmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Redeliver queues a delivery to be sent again straight away, with a fresh
+// set of attempts.
+func (m *WebhookModel) Redeliver(id int) error {
+	stmt := `UPDATE webhook_deliveries
+	SET status = ?, attempts = 0, next_attempt = UTC_TIMESTAMP() WHERE id = ?`
+
+	_, err := retrying(m.DB).Exec(stmt, DeliveryPending, id)
+	return err
+}
@@ -0,0 +1,208 @@
+package moderation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// linkRX matches links written out in full, which is how spam is posted.
+var linkRX = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// LinkDensity flags content with more than MaxLinks links, or where links
+// make up more than MaxRatio of the text. Code often has a link or two in
+// it; content which is mostly links usually isn't code.
+type LinkDensity struct {
+	MaxLinks int
+	MaxRatio float64
+}
+
+func (l LinkDensity) Check(ctx context.Context, c *Content) (string, error) {
+	text := c.Text()
+	links := linkRX.FindAllString(text, -1)
+	if len(links) == 0 {
+		return "", nil
+	}
+
+	if l.MaxLinks > 0 && len(links) > l.MaxLinks {
+		return fmt.Sprintf("has %d links", len(links)), nil
+	}
+
+	linkChars := 0
+	for _, link := range links {
+		linkChars += utf8.RuneCountInString(link)
+	}
+	ratio := float64(linkChars) / float64(utf8.RuneCountInString(strings.TrimSpace(text)))
+	if l.MaxRatio > 0 && ratio > l.MaxRatio {
+		return fmt.Sprintf("is %.0f%% links", ratio*100), nil
+	}
+
+	return "", nil
+}
+
+// BannedWords flags content which contains any of a list of words or
+// phrases, ignoring case. Words only match whole, so "ass" doesn't match
+// "class".
+type BannedWords struct {
+	rx *regexp.Regexp
+}
+
+// NewBannedWords returns a check for the given words.
+func NewBannedWords(words []string) *BannedWords {
+	var quoted []string
+	for _, w := range words {
+		w = strings.TrimSpace(w)
+		if w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) == 0 {
+		return &BannedWords{}
+	}
+
+	return &BannedWords{rx: regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)}
+}
+
+// LoadBannedWords reads a banned word list from a file with one word or
+// phrase on each line. Blank lines and lines starting with # are ignored.
+func LoadBannedWords(path string) (*BannedWords, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var words []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewBannedWords(words), nil
+}
+
+func (b *BannedWords) Check(ctx context.Context, c *Content) (string, error) {
+	if b.rx == nil {
+		return "", nil
+	}
+
+	if w := b.rx.FindString(c.Text()); w != "" {
+		return fmt.Sprintf("contains banned word %q", strings.ToLower(w)), nil
+	}
+
+	return "", nil
+}
+
+// HashStore records content hashes and counts how often each has been seen.
+type HashStore interface {
+	// SeenHash records that hash was seen now, and returns how many times
+	// it was seen since the given time, including this one.
+	SeenHash(ctx context.Context, hash string, since time.Time) (int, error)
+}
+
+// Duplicates flags content which has been posted more than Max times within
+// Window. The same thing posted over and over is a sign of a spam run.
+// Content is compared after ContentHash normalizes it, so changing the case
+// or whitespace doesn't get around the check.
+type Duplicates struct {
+	Store  HashStore
+	Max    int
+	Window time.Duration
+}
+
+func (d Duplicates) Check(ctx context.Context, c *Content) (string, error) {
+	n, err := d.Store.SeenHash(ctx, ContentHash(c.Body), time.Now().Add(-d.Window))
+	if err != nil {
+		return "", err
+	}
+
+	if n > d.Max {
+		return fmt.Sprintf("posted %d times in %s", n, d.Window), nil
+	}
+
+	return "", nil
+}
+
+// ContentHash returns the hex-encoded SHA-256 hash of text, after lowering
+// its case and collapsing runs of whitespace.
+func ContentHash(text string) string {
+	normalized := strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// External asks an outside spam-checking service about content. The content
+// is POSTed to URL as JSON, with "title", "content" and "ip" fields, and the
+// service replies with {"spam": true, "reason": "..."} or {"spam": false}.
+type External struct {
+	URL    string
+	Client *http.Client
+}
+
+type externalRequest struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	IP      string `json:"ip,omitempty"`
+}
+
+type externalResponse struct {
+	Spam   bool   `json:"spam"`
+	Reason string `json:"reason"`
+}
+
+func (e External) Check(ctx context.Context, c *Content) (string, error) {
+	body, err := json.Marshal(externalRequest{Title: c.Title, Content: c.Body, IP: c.IP})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("moderation: %s replied %s", e.URL, resp.Status)
+	}
+
+	var res externalResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", fmt.Errorf("moderation: decoding reply from %s: %w", e.URL, err)
+	}
+
+	if !res.Spam {
+		return "", nil
+	}
+	if res.Reason == "" {
+		return "flagged by spam service", nil
+	}
+	return "flagged by spam service: " + res.Reason, nil
+}
@@ -0,0 +1,80 @@
+// Package moderation decides whether new content can be published straight
+// away or should be held for a person to review. Content is run through a
+// Pipeline of Checks; any check can flag it, and the reasons are kept so the
+// reviewer knows what to look at.
+package moderation
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Content is something posted by a user, like a snippet.
+type Content struct {
+	Title  string
+	Body   string
+	UserID int
+	IP     string
+}
+
+// Text returns the title and body together, which is what most checks look
+// at.
+func (c *Content) Text() string {
+	return c.Title + "\n" + c.Body
+}
+
+// Check looks at content and returns a short reason why it should be held
+// for review, or an empty string if it's fine.
+type Check interface {
+	Check(ctx context.Context, c *Content) (string, error)
+}
+
+// CheckFunc lets an ordinary function be used as a Check.
+type CheckFunc func(ctx context.Context, c *Content) (string, error)
+
+func (f CheckFunc) Check(ctx context.Context, c *Content) (string, error) {
+	return f(ctx, c)
+}
+
+// Verdict is the outcome of running content through a Pipeline.
+type Verdict struct {
+	Reasons []string
+}
+
+// Held reports whether the content should be held for review.
+func (v Verdict) Held() bool {
+	return len(v.Reasons) > 0
+}
+
+// Reason returns the reasons joined into one string.
+func (v Verdict) Reason() string {
+	return strings.Join(v.Reasons, "; ")
+}
+
+// Pipeline runs content through each of its checks.
+type Pipeline struct {
+	Checks []Check
+}
+
+// Run runs every check, and returns the verdict along with any errors from
+// checks which couldn't run. A check which fails doesn't flag the content,
+// so callers can choose to publish content when, say, an external service
+// is down.
+func (p *Pipeline) Run(ctx context.Context, c *Content) (Verdict, error) {
+	var v Verdict
+	var errs []error
+
+	for _, check := range p.Checks {
+		reason, err := check.Check(ctx, c)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if reason != "" {
+			v.Reasons = append(v.Reasons, reason)
+		}
+	}
+
+	return v, errors.Join(errs...)
+}
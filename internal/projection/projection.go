@@ -0,0 +1,121 @@
+// Package projection trims API resources down to the fields a client asks
+// for, and embeds the related resources it asks to have expanded, as with
+// the ?fields=id,title and ?expand=user query parameters. It works on the
+// JSON encoding of a resource, so the fields are named as they are in the
+// JSON, and a resource is projected the same way whatever its Go type.
+package projection
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Projection says which fields of a resource to keep, and which related
+// resources to embed in it. The zero value keeps every field and embeds
+// nothing.
+type Projection struct {
+	fields []string
+	expand []string
+}
+
+// New returns a projection which keeps the given fields, or all of them if
+// fields is empty, and embeds the given related resources.
+func New(fields, expand []string) Projection {
+	return Projection{fields: fields, expand: expand}
+}
+
+// IsZero reports whether p leaves resources as they are, so that they can
+// be sent without being projected at all.
+func (p Projection) IsZero() bool {
+	return len(p.fields) == 0 && len(p.expand) == 0
+}
+
+// Expands reports whether p embeds the related resource called name.
+func (p Projection) Expands(name string) bool {
+	return slices.Contains(p.expand, name)
+}
+
+// Apply returns v, which must encode to a JSON object, with just the fields
+// which p keeps. The embeds are added to it as they are, whether or not
+// they're among the fields, and replace any field of the same name.
+func (p Projection) Apply(v any, embeds map[string]any) (map[string]any, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// The fields are kept encoded, so that numbers and times come out
+	// exactly as they went in.
+	var all map[string]json.RawMessage
+	err = json.Unmarshal(js, &all)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]any, len(all)+len(embeds))
+	for name, value := range all {
+		if len(p.fields) == 0 || slices.Contains(p.fields, name) {
+			out[name] = value
+		}
+	}
+	for name, value := range embeds {
+		out[name] = value
+	}
+
+	return out, nil
+}
+
+// ParseList splits a comma-separated list of names, like the value of a
+// fields or expand query parameter. Spaces and empty names are dropped, and
+// so are repeats.
+func ParseList(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Unknown returns the first of names which isn't in allowed, or "" if they
+// all are.
+func Unknown(names, allowed []string) string {
+	for _, name := range names {
+		if !slices.Contains(allowed, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// FieldNames returns the names of the fields in the JSON encoding of v,
+// which must be a struct or a pointer to one, in the order they're declared.
+// Fields tagged "-" are left out.
+func FieldNames(v any) []string {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,166 @@
+// Package pubsub is a small in-process publish/subscribe hub, for pushing
+// events to clients which hold a connection open, like Server-Sent Events
+// streams. Each subscriber has its own buffer, so publishing never blocks: a
+// subscriber which falls so far behind that its buffer fills up is evicted
+// instead of holding up everyone else.
+package pubsub
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned by Subscribe once the hub has been closed.
+var ErrClosed = errors.New("pubsub: hub closed")
+
+// ErrTooManySubscribers is returned by Subscribe when the hub already has
+// its maximum number of subscribers.
+var ErrTooManySubscribers = errors.New("pubsub: too many subscribers")
+
+// Message is an event published to a topic. ID and Event are optional.
+type Message struct {
+	ID    string
+	Event string
+	Data  []byte
+}
+
+// Hub holds the subscribers to each topic.
+type Hub struct {
+	mu     sync.Mutex
+	topics map[string]map[*Subscription]struct{}
+	count  int
+	buffer int
+	max    int
+	closed bool
+}
+
+// NewHub returns a new Hub. Each subscriber can have up to buffer messages
+// waiting before it's evicted, and there can be at most max subscribers
+// across all topics (or any number if max is 0).
+func NewHub(buffer, max int) *Hub {
+	return &Hub{
+		topics: make(map[string]map[*Subscription]struct{}),
+		buffer: buffer,
+		max:    max,
+	}
+}
+
+// Subscription receives the messages published to a topic.
+type Subscription struct {
+	hub     *Hub
+	topic   string
+	c       chan Message
+	evicted bool
+}
+
+// Subscribe starts receiving the messages published to topic. The caller
+// must call Close when it's done with the subscription.
+func (h *Hub) Subscribe(topic string) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrClosed
+	}
+	if h.max > 0 && h.count >= h.max {
+		return nil, ErrTooManySubscribers
+	}
+
+	s := &Subscription{hub: h, topic: topic, c: make(chan Message, h.buffer)}
+
+	subs, ok := h.topics[topic]
+	if !ok {
+		subs = make(map[*Subscription]struct{})
+		h.topics[topic] = subs
+	}
+	subs[s] = struct{}{}
+	h.count++
+
+	return s, nil
+}
+
+// Publish sends msg to every subscriber to topic, evicting any whose buffer
+// is full. It returns how many subscribers the message was sent to.
+func (h *Hub) Publish(topic string, msg Message) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := 0
+	for s := range h.topics[topic] {
+		select {
+		case s.c <- msg:
+			n++
+		default:
+			s.evicted = true
+			h.remove(s)
+		}
+	}
+
+	return n
+}
+
+// Subscribers returns the number of subscribers to topic.
+func (h *Hub) Subscribers(topic string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.topics[topic])
+}
+
+// Close ends every subscription and stops new ones being made. It's meant
+// for shutting down, so that long-lived connections waiting on a
+// subscription can finish.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for _, subs := range h.topics {
+		for s := range subs {
+			h.remove(s)
+		}
+	}
+}
+
+// remove deletes a subscription and closes its channel. The caller must
+// hold h.mu.
+func (h *Hub) remove(s *Subscription) {
+	subs, ok := h.topics[s.topic]
+	if !ok {
+		return
+	}
+	if _, ok := subs[s]; !ok {
+		return
+	}
+
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(h.topics, s.topic)
+	}
+	h.count--
+	close(s.c)
+}
+
+// C returns the channel which messages are delivered on. It's closed when
+// the subscription ends, whether because Close was called, the subscriber
+// was evicted or the hub was closed.
+func (s *Subscription) C() <-chan Message {
+	return s.c
+}
+
+// Evicted reports whether the subscription was ended because the
+// subscriber fell behind. It's only meaningful once C has been closed.
+func (s *Subscription) Evicted() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	return s.evicted
+}
+
+// Close ends the subscription. It's safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.remove(s)
+}
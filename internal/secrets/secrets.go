@@ -0,0 +1,189 @@
+// Package secrets finds credentials, like cloud access keys, private keys
+// and API tokens, in text before it's published. Each Rule is a regular
+// expression with an Action saying what to do when it matches: warn the
+// author, replace the match with a placeholder, or refuse the text.
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Action is what happens to text which a rule matches.
+type Action string
+
+const (
+	// Warn lets the text through, but the author is asked to check it
+	// first.
+	Warn Action = "warn"
+	// Redact replaces each match with Placeholder.
+	Redact Action = "redact"
+	// Block refuses the text until the match is taken out.
+	Block Action = "block"
+)
+
+// Placeholder is what redacted matches are replaced with.
+const Placeholder = "[REDACTED]"
+
+// Rule describes one kind of secret. Rules are read from JSON, so the
+// fields are tagged to match.
+type Rule struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+	Pattern     string `json:"pattern"`
+	Action      Action `json:"action"`
+
+	rx *regexp.Regexp
+}
+
+// DefaultRules returns the rules used when none are configured. Keys which
+// can't be anything else are blocked or redacted; patterns which also match
+// placeholders and test values only warn.
+func DefaultRules() []*Rule {
+	return []*Rule{
+		{ID: "private-key", Description: "Private key", Pattern: `-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`, Action: Block},
+		{ID: "aws-access-key-id", Description: "AWS access key ID", Pattern: `\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`, Action: Block},
+		{ID: "aws-secret-access-key", Description: "AWS secret access key", Pattern: `(?i)\baws_?secret_?access_?key\b["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}\b`, Action: Block},
+		{ID: "github-token", Description: "GitHub token", Pattern: `\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{82})\b`, Action: Redact},
+		{ID: "gitlab-token", Description: "GitLab token", Pattern: `\bglpat-[A-Za-z0-9_-]{20}\b`, Action: Redact},
+		{ID: "slack-token", Description: "Slack token", Pattern: `\bxox[abposr]-[A-Za-z0-9-]{10,}\b`, Action: Redact},
+		{ID: "stripe-key", Description: "Stripe secret key", Pattern: `\b[rs]k_live_[A-Za-z0-9]{24,}\b`, Action: Redact},
+		{ID: "google-api-key", Description: "Google API key", Pattern: `\bAIza[0-9A-Za-z_-]{35}\b`, Action: Redact},
+		{ID: "jwt", Description: "JSON Web Token", Pattern: `\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`, Action: Warn},
+		{ID: "password-assignment", Description: "Password or API key in code", Pattern: `(?i)\b(?:password|passwd|pwd|secret|api_?key|access_?token|auth_?token)\b["']?\s*[:=]\s*["'][^"'\s]{8,}["']`, Action: Warn},
+	}
+}
+
+// LoadRules reads rules from a JSON file holding an array of rules, like
+// [{"id": "...", "description": "...", "pattern": "...", "action": "warn"}].
+func LoadRules(path string) ([]*Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []*Rule
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: %s: %w", path, err)
+	}
+
+	return rules, nil
+}
+
+// Scanner checks text against a set of rules.
+type Scanner struct {
+	rules []*Rule
+}
+
+// NewScanner compiles the rules' patterns and returns a scanner for them.
+func NewScanner(rules []*Rule) (*Scanner, error) {
+	for _, rule := range rules {
+		if rule.ID == "" {
+			return nil, fmt.Errorf("secrets: rule %q has no id", rule.Pattern)
+		}
+		switch rule.Action {
+		case Warn, Redact, Block:
+		default:
+			return nil, fmt.Errorf("secrets: rule %s: unknown action %q", rule.ID, rule.Action)
+		}
+
+		rx, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("secrets: rule %s: %w", rule.ID, err)
+		}
+		rule.rx = rx
+	}
+
+	return &Scanner{rules: rules}, nil
+}
+
+// Finding is a place where a rule matched.
+type Finding struct {
+	Rule *Rule
+	// Line is the line number the match starts on, counting from 1.
+	Line int
+}
+
+// Result is what a scan found.
+type Result struct {
+	Findings []Finding
+	// Text is the scanned text with any matches of Redact rules replaced
+	// by Placeholder.
+	Text string
+}
+
+// Scan checks text against every rule. A nil scanner finds nothing.
+func (s *Scanner) Scan(text string) Result {
+	res := Result{Text: text}
+	if s == nil {
+		return res
+	}
+
+	for _, rule := range s.rules {
+		matches := rule.rx.FindAllStringIndex(text, -1)
+		for _, m := range matches {
+			res.Findings = append(res.Findings, Finding{
+				Rule: rule,
+				Line: strings.Count(text[:m[0]], "\n") + 1,
+			})
+		}
+
+		if len(matches) > 0 && rule.Action == Redact {
+			res.Text = rule.rx.ReplaceAllLiteralString(res.Text, Placeholder)
+		}
+	}
+
+	return res
+}
+
+// Has reports whether any rule with the given action matched.
+func (r Result) Has(action Action) bool {
+	return slices.ContainsFunc(r.Findings, func(f Finding) bool {
+		return f.Rule.Action == action
+	})
+}
+
+// Descriptions returns the descriptions of the rules with the given action
+// which matched, each once, with the lines they matched on.
+func (r Result) Descriptions(action Action) []string {
+	var order []string
+	lines := make(map[string][]string)
+	for _, f := range r.Findings {
+		if f.Rule.Action != action {
+			continue
+		}
+		d := f.Rule.Description
+		if _, ok := lines[d]; !ok {
+			order = append(order, d)
+		}
+		lines[d] = append(lines[d], fmt.Sprint(f.Line))
+	}
+
+	descriptions := make([]string, len(order))
+	for i, d := range order {
+		l := slices.Compact(lines[d])
+		if len(l) == 1 {
+			descriptions[i] = fmt.Sprintf("%s (line %s)", d, l[0])
+		} else {
+			descriptions[i] = fmt.Sprintf("%s (lines %s)", d, strings.Join(l, ", "))
+		}
+	}
+	return descriptions
+}
+
+// RuleIDs returns the IDs of the rules which matched, each once, separated
+// by commas.
+func (r Result) RuleIDs() string {
+	var ids []string
+	for _, f := range r.Findings {
+		if !slices.Contains(ids, f.Rule.ID) {
+			ids = append(ids, f.Rule.ID)
+		}
+	}
+	return strings.Join(ids, ",")
+}
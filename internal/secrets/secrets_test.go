@@ -0,0 +1,225 @@
+package secrets
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// The fake tokens are built up in pieces, so that other secret scanners
+// don't take this file for a leak.
+var (
+	alnum36 = strings.Repeat("a1B2", 9)
+	alnum40 = strings.Repeat("wJalr/K7MD", 4)
+)
+
+func newDefaultScanner(t *testing.T) *Scanner {
+	t.Helper()
+
+	s, err := NewScanner(DefaultRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestDefaultRules(t *testing.T) {
+	s := newDefaultScanner(t)
+
+	// Each sample which should match is matched by its rule and no other,
+	// and each which shouldn't is matched by no rule at all.
+	tests := []struct {
+		id      string
+		match   []string
+		noMatch []string
+	}{
+		{
+			id: "private-key",
+			match: []string{
+				"-----BEGIN RSA " + "PRIVATE KEY-----\nMIIEpAIBAAKCAQEA\n-----END RSA PRIVATE KEY-----",
+				"-----BEGIN OPENSSH " + "PRIVATE KEY-----",
+				"-----BEGIN " + "PRIVATE KEY-----",
+			},
+			noMatch: []string{
+				"-----BEGIN PUBLIC KEY-----\nMIIBIjANBgkqhkiG9w0BAQEF\n-----END PUBLIC KEY-----",
+				"-----BEGIN CERTIFICATE-----",
+			},
+		},
+		{
+			id: "aws-access-key-id",
+			match: []string{
+				"AKIA" + "IOSFODNN7EXAMPLE",
+				`aws_access_key_id = "ASIA` + `IOSFODNN7EXAMPLE"`,
+			},
+			noMatch: []string{
+				"AKIA" + "IOSFODNN7EXAMPL",
+				"AKIA" + "iosfodnn7example",
+				"AKIA is a prefix of AWS access key IDs",
+			},
+		},
+		{
+			id: "aws-secret-access-key",
+			match: []string{
+				"aws_secret_access_key = " + alnum40,
+				`AWS_SECRET_ACCESS_KEY: "` + alnum40 + `"`,
+			},
+			noMatch: []string{
+				"aws_secret_access_key = ${AWS_SECRET_ACCESS_KEY}",
+				"aws_secret_access_key = " + alnum40[:30],
+			},
+		},
+		{
+			id: "github-token",
+			match: []string{
+				"ghp_" + alnum36,
+				"token: gho_" + alnum36,
+				"github_pat_" + strings.Repeat("a1_B2", 16) + "ab",
+			},
+			noMatch: []string{
+				"ghp_" + alnum36[:20],
+				"ghx_" + alnum36,
+			},
+		},
+		{
+			id: "gitlab-token",
+			match: []string{
+				"glpat-" + alnum36[:20],
+			},
+			noMatch: []string{
+				"glpat-" + alnum36[:19],
+				"glpat-xxxxxxxx",
+			},
+		},
+		{
+			id: "slack-token",
+			match: []string{
+				"xoxb-" + "1234567890-abcdefghij",
+				"xoxp-" + "1234567890",
+			},
+			noMatch: []string{
+				"xoxb-" + "123",
+				"xoxz-" + "1234567890",
+			},
+		},
+		{
+			id: "stripe-key",
+			match: []string{
+				"sk_live_" + alnum36[:24],
+				"rk_live_" + alnum36,
+			},
+			noMatch: []string{
+				"sk_test_" + alnum36[:24],
+				"pk_live_" + alnum36[:24],
+				"sk_live_" + alnum36[:10],
+			},
+		},
+		{
+			id: "google-api-key",
+			match: []string{
+				"AIza" + alnum36[:35],
+				"key=AIza" + strings.Repeat("Sy-_x", 7),
+			},
+			noMatch: []string{
+				"AIza" + alnum36[:20],
+			},
+		},
+		{
+			id: "jwt",
+			match: []string{
+				"eyJhbGciOiJIUzI1NiJ9" + ".eyJzdWIiOiIxMjM0NTY3ODkwIn0" + ".dozjgNryP4J3jVmNHl0w5N_XgL0n3I9PlFUP0THsR8U",
+			},
+			noMatch: []string{
+				"eyJhbGciOiJIUzI1NiJ9",
+				"eyJhbGciOiJIUzI1NiJ9" + ".eyJ" + ".abc",
+			},
+		},
+		{
+			id: "password-assignment",
+			match: []string{
+				`password = "` + "correct-horse" + `"`,
+				`"api_key": "` + alnum36[:16] + `"`,
+				`AUTH_TOKEN='` + alnum36[:12] + `'`,
+			},
+			noMatch: []string{
+				`password = os.Getenv("DB_PASSWORD")`,
+				`password = "short"`,
+				`password := ""`,
+				`// the password must be at least 8 characters`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			for _, text := range tt.match {
+				if got := s.Scan(text).RuleIDs(); got != tt.id {
+					t.Errorf("got rules %q for %q; want %q", got, text, tt.id)
+				}
+			}
+			for _, text := range tt.noMatch {
+				if got := s.Scan(text).RuleIDs(); got != "" {
+					t.Errorf("got rules %q for %q; want none", got, text)
+				}
+			}
+		})
+	}
+
+	// Every default rule has samples.
+	sampled := make(map[string]bool)
+	for _, tt := range tests {
+		sampled[tt.id] = true
+	}
+	for _, rule := range DefaultRules() {
+		if !sampled[rule.ID] {
+			t.Errorf("rule %s has no samples", rule.ID)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	s := newDefaultScanner(t)
+
+	token := "ghp_" + alnum36
+	text := "package main\n\nconst token = \"" + token + "\"\n\n// AKIA" + "IOSFODNN7EXAMPLE\n"
+
+	res := s.Scan(text)
+
+	if !res.Has(Block) || !res.Has(Redact) || res.Has(Warn) {
+		t.Errorf("got findings %q; want a block and a redaction only", res.RuleIDs())
+	}
+	if strings.Contains(res.Text, token) {
+		t.Error("the GitHub token wasn't redacted")
+	}
+	if !strings.Contains(res.Text, `const token = "`+Placeholder+`"`) {
+		t.Errorf("got text %q; want the token replaced with %s", res.Text, Placeholder)
+	}
+
+	want := []string{"AWS access key ID (line 5)"}
+	if got := res.Descriptions(Block); !slices.Equal(got, want) {
+		t.Errorf("got block descriptions %q; want %q", got, want)
+	}
+
+	var nilScanner *Scanner
+	if res := nilScanner.Scan(text); len(res.Findings) != 0 || res.Text != text {
+		t.Error("a nil scanner found something")
+	}
+}
+
+func TestNewScanner(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"No id", Rule{Pattern: `x`, Action: Warn}},
+		{"Unknown action", Rule{ID: "x", Pattern: `x`, Action: "delete"}},
+		{"Bad pattern", Rule{ID: "x", Pattern: `(`, Action: Warn}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewScanner([]*Rule{&tt.rule}); err == nil {
+				t.Error("got no error; want one")
+			}
+		})
+	}
+}
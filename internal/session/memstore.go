@@ -0,0 +1,85 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+type item struct {
+	object     []byte
+	expiration int64
+}
+
+// MemStore represents an in-memory session store. It's useful for
+// development and tests, but sessions are lost when the process restarts.
+type MemStore struct {
+	items map[string]item
+	mu    sync.RWMutex
+}
+
+// NewMemStore returns a new MemStore instance.
+func NewMemStore() *MemStore {
+	return &MemStore{
+		items: make(map[string]item),
+	}
+}
+
+// Find returns the data for a given session token from the MemStore instance.
+// If the session token is not found or is expired, the returned exists flag
+// will be set to false.
+func (m *MemStore) Find(token string) ([]byte, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	item, found := m.items[token]
+	if !found {
+		return nil, false, nil
+	}
+
+	if time.Now().UnixNano() > item.expiration {
+		return nil, false, nil
+	}
+
+	return item.object, true, nil
+}
+
+// Commit adds a session token and data to the MemStore instance with the
+// given expiry time. If the session token already exists, then the data and
+// expiry time are updated.
+func (m *MemStore) Commit(token string, b []byte, expiry time.Time) error {
+	m.mu.Lock()
+	m.items[token] = item{
+		object:     b,
+		expiration: expiry.UnixNano(),
+	}
+	m.mu.Unlock()
+
+	return nil
+}
+
+// All returns the data for every unexpired session in the MemStore
+// instance, by token.
+func (m *MemStore) All() (map[string][]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sessions := make(map[string][]byte)
+	now := time.Now().UnixNano()
+	for token, item := range m.items {
+		if now < item.expiration {
+			sessions[token] = item.object
+		}
+	}
+
+	return sessions, nil
+}
+
+// Delete removes a session token and corresponding data from the MemStore
+// instance.
+func (m *MemStore) Delete(token string) error {
+	m.mu.Lock()
+	delete(m.items, token)
+	m.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package session
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// MySQLStore represents the session store. It expects a sessions table
+// created with the following schema:
+//
+//	CREATE TABLE sessions (
+//		token CHAR(43) PRIMARY KEY,
+//		data BLOB NOT NULL,
+//		expiry TIMESTAMP(6) NOT NULL
+//	);
+type MySQLStore struct {
+	db          *sql.DB
+	errorLog    *log.Logger
+	stopCleanup chan bool
+}
+
+// NewMySQLStore returns a new MySQLStore instance, with a background cleanup
+// goroutine that runs every 5 minutes to remove expired session data. Errors
+// from the cleanup are written to errorLog, or to the standard logger if it's
+// nil.
+func NewMySQLStore(db *sql.DB, errorLog *log.Logger) *MySQLStore {
+	return NewMySQLStoreWithCleanupInterval(db, errorLog, 5*time.Minute)
+}
+
+// NewMySQLStoreWithCleanupInterval returns a new MySQLStore instance. The
+// cleanupInterval parameter controls how frequently expired session data is
+// removed by the background cleanup goroutine. Setting it to 0 prevents the
+// cleanup goroutine from running.
+func NewMySQLStoreWithCleanupInterval(db *sql.DB, errorLog *log.Logger, cleanupInterval time.Duration) *MySQLStore {
+	if errorLog == nil {
+		errorLog = log.Default()
+	}
+
+	m := &MySQLStore{db: db, errorLog: errorLog}
+	if cleanupInterval > 0 {
+		go m.startCleanup(cleanupInterval)
+	}
+	return m
+}
+
+// Find returns the data for a given session token from the MySQLStore
+// instance. If the session token is not found or is expired, the returned
+// exists flag will be set to false.
+func (m *MySQLStore) Find(token string) ([]byte, bool, error) {
+	var b []byte
+	stmt := "SELECT data FROM sessions WHERE token = ? AND UTC_TIMESTAMP(6) < expiry"
+	err := m.db.QueryRow(stmt, token).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+// Commit adds a session token and data to the MySQLStore instance with the
+// given expiry time. If the session token already exists, then the data and
+// expiry time are updated.
+func (m *MySQLStore) Commit(token string, b []byte, expiry time.Time) error {
+	stmt := `INSERT INTO sessions (token, data, expiry) VALUES (?, ?, ?)
+	ON DUPLICATE KEY UPDATE data = VALUES(data), expiry = VALUES(expiry)`
+	_, err := m.db.Exec(stmt, token, b, expiry.UTC())
+	return err
+}
+
+// All returns the data for every unexpired session in the MySQLStore
+// instance, by token.
+func (m *MySQLStore) All() (map[string][]byte, error) {
+	rows, err := m.db.Query("SELECT token, data FROM sessions WHERE UTC_TIMESTAMP(6) < expiry")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make(map[string][]byte)
+	for rows.Next() {
+		var token string
+		var b []byte
+		if err := rows.Scan(&token, &b); err != nil {
+			return nil, err
+		}
+		sessions[token] = b
+	}
+
+	return sessions, rows.Err()
+}
+
+// Delete removes a session token and corresponding data from the MySQLStore
+// instance.
+func (m *MySQLStore) Delete(token string) error {
+	_, err := m.db.Exec("DELETE FROM sessions WHERE token = ?", token)
+	return err
+}
+
+func (m *MySQLStore) startCleanup(interval time.Duration) {
+	m.stopCleanup = make(chan bool)
+	ticker := time.NewTicker(interval)
+	for {
+		select {
+		case <-ticker.C:
+			err := m.deleteExpired()
+			if err != nil {
+				m.errorLog.Printf("session: deleting expired sessions: %v", err)
+			}
+		case <-m.stopCleanup:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// StopCleanup terminates the background cleanup goroutine for the MySQLStore
+// instance. It's rare to terminate this; generally MySQLStore instances and
+// their cleanup goroutines are intended to be long-lived and run for the
+// lifetime of your application.
+func (m *MySQLStore) StopCleanup() {
+	if m.stopCleanup != nil {
+		m.stopCleanup <- true
+	}
+}
+
+func (m *MySQLStore) deleteExpired() error {
+	_, err := m.db.Exec("DELETE FROM sessions WHERE expiry < UTC_TIMESTAMP(6)")
+	return err
+}
@@ -0,0 +1,631 @@
+// Package session provides cookie-based HTTP session management with
+// server-side storage. The session data for a request is loaded by the
+// LoadAndSave middleware (or LoadAndStream, for responses too big to buffer),
+// read and modified through the Manager methods using the request context, and
+// committed back to the Store before the response is written.
+package session
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Store is the interface for session stores. Find should return found=false
+// (and no error) if the token doesn't exist or has expired.
+type Store interface {
+	Find(token string) (b []byte, found bool, err error)
+	Commit(token string, b []byte, expiry time.Time) error
+	Delete(token string) error
+}
+
+// IterableStore is implemented by stores which can list every session they
+// hold, which Iterate needs. All should leave out expired sessions.
+type IterableStore interface {
+	All() (map[string][]byte, error)
+}
+
+// ErrNotIterable is returned by Iterate when the store isn't an
+// IterableStore.
+var ErrNotIterable = errors.New("session: store does not support iteration")
+
+func init() {
+	// Session values are stored as interfaces, so gob has to be told about
+	// the types which aren't built in.
+	gob.Register(time.Time{})
+}
+
+// Cookie holds the settings for the session cookie.
+type Cookie struct {
+	Name     string
+	Domain   string
+	Path     string
+	Persist  bool
+	HttpOnly bool
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// Manager holds the configuration settings for your sessions.
+type Manager struct {
+	// Lifetime controls the maximum length of time that a session is valid
+	// for before it expires.
+	Lifetime time.Duration
+
+	// Store controls the session store where the session data is persisted.
+	Store Store
+
+	// Cookie contains the configuration settings for session cookies.
+	Cookie Cookie
+
+	// ErrorFunc is called when there is a problem loading or committing the
+	// session. By default it sends a plain-text 500 response.
+	ErrorFunc func(http.ResponseWriter, *http.Request, error)
+
+	contextKey contextKey
+}
+
+type contextKey string
+
+type status int
+
+const (
+	unmodified status = iota
+	modified
+	destroyed
+)
+
+type sessionData struct {
+	mu       sync.Mutex
+	deadline time.Time
+	status   status
+	token    string
+	values   map[string]any
+}
+
+// New returns a new session manager with the default options. It is safe for
+// concurrent use.
+func New() *Manager {
+	return &Manager{
+		Lifetime: 24 * time.Hour,
+		Store:    NewMemStore(),
+		Cookie: Cookie{
+			Name:     "session",
+			Path:     "/",
+			Persist:  true,
+			HttpOnly: true,
+			Secure:   false,
+			SameSite: http.SameSiteLaxMode,
+		},
+		ErrorFunc: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		},
+		contextKey: contextKey("session"),
+	}
+}
+
+// LoadAndSave provides middleware which automatically loads and saves session
+// data for the current request, and communicates the session token to and
+// from the client in a cookie.
+func (m *Manager) LoadAndSave(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Cookie")
+
+		var token string
+		cookie, err := r.Cookie(m.Cookie.Name)
+		if err == nil {
+			token = cookie.Value
+		}
+
+		ctx, err := m.load(r.Context(), token)
+		if err != nil {
+			m.ErrorFunc(w, r, err)
+			return
+		}
+
+		sr := r.WithContext(ctx)
+
+		// We buffer the response so that the session can be committed, and
+		// the cookie header set, after the handler has finished with it.
+		bw := &bufferedResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(bw, sr)
+
+		if err := m.commitAndWriteCookie(w, sr); err != nil {
+			m.ErrorFunc(w, r, err)
+			return
+		}
+
+		if bw.code != 0 {
+			w.WriteHeader(bw.code)
+		}
+		w.Write(bw.buf.Bytes())
+	})
+}
+
+// LoadAndStream is like LoadAndSave, but for handlers whose responses are
+// too big to buffer. It passes the response straight through, and commits
+// the session just before the header is written instead, so any changes a
+// handler makes to the session once it's started writing are lost.
+func (m *Manager) LoadAndStream(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Cookie")
+
+		var token string
+		cookie, err := r.Cookie(m.Cookie.Name)
+		if err == nil {
+			token = cookie.Value
+		}
+
+		ctx, err := m.load(r.Context(), token)
+		if err != nil {
+			m.ErrorFunc(w, r, err)
+			return
+		}
+
+		sr := r.WithContext(ctx)
+
+		cw := &committingResponseWriter{ResponseWriter: w, m: m, r: sr}
+		next.ServeHTTP(cw, sr)
+
+		// A handler which writes nothing still gets its session saved.
+		cw.commit()
+	})
+}
+
+func (m *Manager) load(ctx context.Context, token string) (context.Context, error) {
+	if _, ok := ctx.Value(m.contextKey).(*sessionData); ok {
+		return ctx, nil
+	}
+
+	if token == "" {
+		return m.addSessionData(ctx, newSessionData(m.Lifetime)), nil
+	}
+
+	b, found, err := m.Store.Find(token)
+	if err != nil {
+		return nil, err
+	} else if !found {
+		return m.addSessionData(ctx, newSessionData(m.Lifetime)), nil
+	}
+
+	sd := &sessionData{
+		status: unmodified,
+		token:  token,
+	}
+	sd.deadline, sd.values, err = decode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.addSessionData(ctx, sd), nil
+}
+
+func (m *Manager) commitAndWriteCookie(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	switch m.Status(ctx) {
+	case modified:
+		token, expiry, err := m.commit(ctx)
+		if err != nil {
+			return err
+		}
+		m.writeCookie(w, token, expiry)
+	case destroyed:
+		m.writeCookie(w, "", time.Time{})
+	}
+
+	return nil
+}
+
+func (m *Manager) commit(ctx context.Context) (string, time.Time, error) {
+	sd := m.getSessionDataFromContext(ctx)
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	if sd.token == "" {
+		var err error
+		if sd.token, err = generateToken(); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+
+	b, err := encode(sd.deadline, sd.values)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if err := m.Store.Commit(sd.token, b, sd.deadline); err != nil {
+		return "", time.Time{}, err
+	}
+
+	return sd.token, sd.deadline, nil
+}
+
+func (m *Manager) writeCookie(w http.ResponseWriter, token string, expiry time.Time) {
+	cookie := &http.Cookie{
+		Name:     m.Cookie.Name,
+		Value:    token,
+		Path:     m.Cookie.Path,
+		Domain:   m.Cookie.Domain,
+		Secure:   m.Cookie.Secure,
+		HttpOnly: m.Cookie.HttpOnly,
+		SameSite: m.Cookie.SameSite,
+	}
+
+	if expiry.IsZero() {
+		cookie.Expires = time.Unix(1, 0)
+		cookie.MaxAge = -1
+	} else if m.Cookie.Persist {
+		cookie.Expires = time.Unix(expiry.Unix()+1, 0)
+		cookie.MaxAge = int(time.Until(expiry).Seconds() + 1)
+	}
+
+	w.Header().Add("Set-Cookie", cookie.String())
+	w.Header().Add("Cache-Control", `no-cache="Set-Cookie"`)
+}
+
+// Status returns the current status of the session data.
+func (m *Manager) Status(ctx context.Context) status {
+	sd := m.getSessionDataFromContext(ctx)
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	return sd.status
+}
+
+// Token returns the session token, or an empty string if the session hasn't
+// been saved yet.
+func (m *Manager) Token(ctx context.Context) string {
+	sd := m.getSessionDataFromContext(ctx)
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	return sd.token
+}
+
+// Put adds a key and corresponding value to the session data. Any existing
+// value for the key will be replaced.
+func (m *Manager) Put(ctx context.Context, key string, val any) {
+	sd := m.getSessionDataFromContext(ctx)
+
+	sd.mu.Lock()
+	sd.values[key] = val
+	sd.status = modified
+	sd.mu.Unlock()
+}
+
+// Get returns the value for a given key from the session data, or nil if the
+// key does not exist.
+func (m *Manager) Get(ctx context.Context, key string) any {
+	sd := m.getSessionDataFromContext(ctx)
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	return sd.values[key]
+}
+
+// Pop acts like a one-time Get. It returns the value for a given key from the
+// session data and deletes the key and value from the session data.
+func (m *Manager) Pop(ctx context.Context, key string) any {
+	sd := m.getSessionDataFromContext(ctx)
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	val, exists := sd.values[key]
+	if !exists {
+		return nil
+	}
+	delete(sd.values, key)
+	sd.status = modified
+
+	return val
+}
+
+// Remove deletes the given key and corresponding value from the session data.
+func (m *Manager) Remove(ctx context.Context, key string) {
+	sd := m.getSessionDataFromContext(ctx)
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	if _, exists := sd.values[key]; !exists {
+		return
+	}
+
+	delete(sd.values, key)
+	sd.status = modified
+}
+
+// Exists returns true if the given key is present in the session data.
+func (m *Manager) Exists(ctx context.Context, key string) bool {
+	sd := m.getSessionDataFromContext(ctx)
+
+	sd.mu.Lock()
+	_, exists := sd.values[key]
+	sd.mu.Unlock()
+
+	return exists
+}
+
+// RenewToken updates the session data to have a new session token while
+// retaining the current session data. The old session is deleted from the
+// store. To mitigate the risk of session fixation attacks, it's important
+// that you call RenewToken before making any changes to privilege levels
+// (e.g. login and logout operations).
+func (m *Manager) RenewToken(ctx context.Context) error {
+	sd := m.getSessionDataFromContext(ctx)
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	if sd.token != "" {
+		if err := m.Store.Delete(sd.token); err != nil {
+			return err
+		}
+	}
+
+	newToken, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	sd.token = newToken
+	sd.deadline = time.Now().Add(m.Lifetime).UTC()
+	sd.status = modified
+
+	return nil
+}
+
+// Iterate calls fn once for each unexpired session in the store, with a
+// context holding that session, so that it can be read and changed with the
+// usual methods. Changes fn makes are committed, and calling Destroy
+// deletes the session. Iteration stops at the first error fn returns.
+func (m *Manager) Iterate(ctx context.Context, fn func(context.Context) error) error {
+	store, ok := m.Store.(IterableStore)
+	if !ok {
+		return ErrNotIterable
+	}
+
+	all, err := store.All()
+	if err != nil {
+		return err
+	}
+
+	for token, b := range all {
+		sd := &sessionData{
+			status: unmodified,
+			token:  token,
+		}
+		sd.deadline, sd.values, err = decode(b)
+		if err != nil {
+			return err
+		}
+
+		sctx := m.addSessionData(ctx, sd)
+
+		err = fn(sctx)
+		if err != nil {
+			return err
+		}
+
+		if m.Status(sctx) == modified {
+			_, _, err = m.commit(sctx)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Deadline returns when the session expires.
+func (m *Manager) Deadline(ctx context.Context) time.Time {
+	sd := m.getSessionDataFromContext(ctx)
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	return sd.deadline
+}
+
+// Destroy deletes the session data from the session store and sets the
+// session status to destroyed. Any further operations in the same request
+// cycle will result in a new session being created.
+func (m *Manager) Destroy(ctx context.Context) error {
+	sd := m.getSessionDataFromContext(ctx)
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	if err := m.Store.Delete(sd.token); err != nil {
+		return err
+	}
+
+	sd.status = destroyed
+
+	// Reset everything else to defaults.
+	sd.token = ""
+	sd.deadline = time.Now().Add(m.Lifetime).UTC()
+	for key := range sd.values {
+		delete(sd.values, key)
+	}
+
+	return nil
+}
+
+// GetString returns the string value for a given key from the session data.
+// The zero value for a string ("") is returned if the key does not exist or
+// the value could not be type asserted to a string.
+func (m *Manager) GetString(ctx context.Context, key string) string {
+	str, _ := m.Get(ctx, key).(string)
+	return str
+}
+
+// GetInt returns the int value for a given key from the session data. The
+// zero value for an int (0) is returned if the key does not exist or the
+// value could not be type asserted to an int.
+func (m *Manager) GetInt(ctx context.Context, key string) int {
+	i, _ := m.Get(ctx, key).(int)
+	return i
+}
+
+// GetBool returns the bool value for a given key from the session data. The
+// zero value for a bool (false) is returned if the key does not exist or the
+// value could not be type asserted to a bool.
+func (m *Manager) GetBool(ctx context.Context, key string) bool {
+	b, _ := m.Get(ctx, key).(bool)
+	return b
+}
+
+// GetTime returns the time.Time value for a given key from the session data.
+// The zero value for a time.Time object is returned if the key does not exist
+// or the value could not be type asserted to a time.Time.
+func (m *Manager) GetTime(ctx context.Context, key string) time.Time {
+	t, _ := m.Get(ctx, key).(time.Time)
+	return t
+}
+
+// PopString returns the string value for a given key and then deletes it
+// from the session data.
+func (m *Manager) PopString(ctx context.Context, key string) string {
+	str, _ := m.Pop(ctx, key).(string)
+	return str
+}
+
+func (m *Manager) addSessionData(ctx context.Context, sd *sessionData) context.Context {
+	return context.WithValue(ctx, m.contextKey, sd)
+}
+
+func (m *Manager) getSessionDataFromContext(ctx context.Context) *sessionData {
+	c, ok := ctx.Value(m.contextKey).(*sessionData)
+	if !ok {
+		panic("session: no session data in context")
+	}
+	return c
+}
+
+func newSessionData(lifetime time.Duration) *sessionData {
+	return &sessionData{
+		deadline: time.Now().Add(lifetime).UTC(),
+		status:   unmodified,
+		values:   make(map[string]any),
+	}
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func encode(deadline time.Time, values map[string]any) ([]byte, error) {
+	aux := &struct {
+		Deadline time.Time
+		Values   map[string]any
+	}{
+		Deadline: deadline,
+		Values:   values,
+	}
+
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(&aux); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func decode(b []byte) (time.Time, map[string]any, error) {
+	aux := &struct {
+		Deadline time.Time
+		Values   map[string]any
+	}{}
+
+	r := bytes.NewReader(b)
+	if err := gob.NewDecoder(r).Decode(&aux); err != nil {
+		return time.Time{}, nil, err
+	}
+
+	return aux.Deadline, aux.Values, nil
+}
+
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	buf         bytes.Buffer
+	code        int
+	wroteHeader bool
+}
+
+func (bw *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return bw.buf.Write(b)
+}
+
+func (bw *bufferedResponseWriter) WriteHeader(code int) {
+	if !bw.wroteHeader {
+		bw.code = code
+		bw.wroteHeader = true
+	}
+}
+
+func (bw *bufferedResponseWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
+
+var errCommitFailed = errors.New("session: the session couldn't be committed")
+
+// committingResponseWriter commits the session the first time anything is
+// written. If that fails the error is sent in place of the response, and
+// whatever the handler goes on to write is discarded.
+type committingResponseWriter struct {
+	http.ResponseWriter
+	m         *Manager
+	r         *http.Request
+	committed bool
+	failed    bool
+}
+
+func (cw *committingResponseWriter) commit() {
+	if cw.committed {
+		return
+	}
+	cw.committed = true
+
+	if err := cw.m.commitAndWriteCookie(cw.ResponseWriter, cw.r); err != nil {
+		cw.failed = true
+		cw.m.ErrorFunc(cw.ResponseWriter, cw.r, err)
+	}
+}
+
+func (cw *committingResponseWriter) Write(b []byte) (int, error) {
+	cw.commit()
+	if cw.failed {
+		return 0, errCommitFailed
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *committingResponseWriter) WriteHeader(code int) {
+	cw.commit()
+	if !cw.failed {
+		cw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (cw *committingResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,5 @@
+// Package snippetboxv1 holds the snippetbox.v1 gRPC service, which is
+// generated from snippetbox.proto with protoc-gen-go and protoc-gen-go-grpc.
+package snippetboxv1
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative snippetbox.proto
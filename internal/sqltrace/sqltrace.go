@@ -0,0 +1,402 @@
+// Package sqltrace wraps a database/sql driver so that every query is timed.
+// Each query is put down to the function which made it (by default the
+// nearest caller in the models package), and running totals are kept for
+// each of them. Queries which take longer than a threshold are logged along
+// with their caller, duration and the number of rows they affected or
+// returned.
+//
+// Wrap a connector and open the pool with sql.OpenDB:
+//
+//	db := sql.OpenDB(sqltrace.Wrap(connector, tracer))
+package sqltrace
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Query describes one finished query.
+type Query struct {
+	// Caller is the function which made the query, like
+	// "models.(*SnippetModel).Get".
+	Caller   string
+	SQL      string
+	Duration time.Duration
+	// Rows is the number of rows affected by a statement, or returned by a
+	// query. It's -1 if it isn't known.
+	Rows int64
+	Err  error
+}
+
+// Stats are the running totals for the queries made by one caller. Times are
+// in milliseconds.
+type Stats struct {
+	Count  int64   `json:"count"`
+	Errors int64   `json:"errors"`
+	Slow   int64   `json:"slow"`
+	Total  float64 `json:"total_ms"`
+	Mean   float64 `json:"mean_ms"`
+	Max    float64 `json:"max_ms"`
+}
+
+type totals struct {
+	count, errors, slow int64
+	total, max          time.Duration
+}
+
+// Tracer records the queries made through the connectors it wraps. It's
+// safe to use from multiple goroutines.
+type Tracer struct {
+	// SlowThreshold is how long a query can take before it's passed to
+	// OnSlow. Zero means no query is slow.
+	SlowThreshold time.Duration
+
+	// OnSlow is called with each slow query.
+	OnSlow func(Query)
+
+	// CallerPrefix picks the caller a query is put down to: the nearest
+	// function whose package path contains it, like "/internal/models.".
+	// If no function matches, the caller is the function which called
+	// database/sql.
+	CallerPrefix string
+
+	mu     sync.Mutex
+	totals map[string]*totals
+}
+
+// Stats returns the running totals, keyed by caller.
+func (t *Tracer) Stats() map[string]Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make(map[string]Stats, len(t.totals))
+	for caller, tt := range t.totals {
+		stats[caller] = Stats{
+			Count:  tt.count,
+			Errors: tt.errors,
+			Slow:   tt.slow,
+			Total:  msec(tt.total),
+			Mean:   msec(tt.total) / float64(tt.count),
+			Max:    msec(tt.max),
+		}
+	}
+	return stats
+}
+
+func msec(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// record adds a finished query to the totals, and passes it to OnSlow if it
+// was slow.
+func (t *Tracer) record(q Query) {
+	slow := t.SlowThreshold > 0 && q.Duration >= t.SlowThreshold
+
+	t.mu.Lock()
+	if t.totals == nil {
+		t.totals = make(map[string]*totals)
+	}
+	tt, ok := t.totals[q.Caller]
+	if !ok {
+		tt = &totals{}
+		t.totals[q.Caller] = tt
+	}
+	tt.count++
+	tt.total += q.Duration
+	tt.max = max(tt.max, q.Duration)
+	if q.Err != nil {
+		tt.errors++
+	}
+	if slow {
+		tt.slow++
+	}
+	t.mu.Unlock()
+
+	if slow && t.OnSlow != nil {
+		t.OnSlow(q)
+	}
+}
+
+// caller returns the name of the function a query is put down to.
+func (t *Tracer) caller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var outside string
+	for {
+		frame, more := frames.Next()
+		fn := frame.Function
+
+		if t.CallerPrefix != "" && strings.Contains(fn, t.CallerPrefix) {
+			return shortName(fn)
+		}
+		if outside == "" && !strings.HasPrefix(fn, "database/sql.") && !strings.Contains(fn, "/internal/sqltrace.") {
+			outside = shortName(fn)
+		}
+		if !more {
+			break
+		}
+	}
+
+	if outside == "" {
+		return "unknown"
+	}
+	return outside
+}
+
+// shortName trims the package path from a function name, leaving
+// "models.(*SnippetModel).Get".
+func shortName(fn string) string {
+	if i := strings.LastIndex(fn, "/"); i >= 0 {
+		return fn[i+1:]
+	}
+	return fn
+}
+
+// Wrap returns a connector which makes connections with c, and traces the
+// queries made on them with t.
+func Wrap(c driver.Connector, t *Tracer) driver.Connector {
+	return &connector{Connector: c, tracer: t}
+}
+
+type connector struct {
+	driver.Connector
+	tracer *Tracer
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn, tracer: c.tracer}, nil
+}
+
+// tracedConn wraps a driver connection. Every optional interface is passed
+// through, so database/sql uses the driver just as it would unwrapped.
+type tracedConn struct {
+	driver.Conn
+	tracer *Tracer
+}
+
+func (c *tracedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tracedStmt{Stmt: stmt, query: query, tracer: c.tracer}, nil
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	// The driver may skip the query, so that database/sql prepares it
+	// instead. It's traced as a prepared statement then.
+	caller := c.tracer.caller()
+	start := time.Now()
+	result, err := e.ExecContext(ctx, query, args)
+	if errors.Is(err, driver.ErrSkip) {
+		return nil, err
+	}
+	c.tracer.record(Query{Caller: caller, SQL: query, Duration: time.Since(start), Rows: rowsAffected(result, err), Err: err})
+	return result, err
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	caller := c.tracer.caller()
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, query, args)
+	if errors.Is(err, driver.ErrSkip) {
+		return nil, err
+	}
+	if err != nil {
+		c.tracer.record(Query{Caller: caller, SQL: query, Duration: time.Since(start), Rows: -1, Err: err})
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, query: Query{Caller: caller, SQL: query}, start: start, tracer: c.tracer}, nil
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *tracedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// tracedStmt wraps a prepared statement.
+type tracedStmt struct {
+	driver.Stmt
+	query  string
+	tracer *Tracer
+}
+
+func (s *tracedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	caller := s.tracer.caller()
+	start := time.Now()
+
+	var result driver.Result
+	var err error
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = e.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		values, err = namedValues(args)
+		if err == nil {
+			result, err = s.Stmt.Exec(values)
+		}
+	}
+
+	s.tracer.record(Query{Caller: caller, SQL: s.query, Duration: time.Since(start), Rows: rowsAffected(result, err), Err: err})
+	return result, err
+}
+
+func (s *tracedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	caller := s.tracer.caller()
+	start := time.Now()
+
+	var rows driver.Rows
+	var err error
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		values, err = namedValues(args)
+		if err == nil {
+			rows, err = s.Stmt.Query(values)
+		}
+	}
+
+	if err != nil {
+		s.tracer.record(Query{Caller: caller, SQL: s.query, Duration: time.Since(start), Rows: -1, Err: err})
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, query: Query{Caller: caller, SQL: s.query}, start: start, tracer: s.tracer}, nil
+}
+
+func (s *tracedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// tracedRows wraps the rows returned by a query. The query is recorded when
+// the rows are closed, so its duration includes reading them.
+type tracedRows struct {
+	driver.Rows
+	query  Query
+	start  time.Time
+	tracer *Tracer
+	closed bool
+}
+
+func (r *tracedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err == nil {
+		r.query.Rows++
+	}
+	return err
+}
+
+func (r *tracedRows) HasNextResultSet() bool {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *tracedRows) NextResultSet() error {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *tracedRows) Close() error {
+	err := r.Rows.Close()
+	if !r.closed {
+		r.closed = true
+		r.query.Duration = time.Since(r.start)
+		r.query.Err = err
+		r.tracer.record(r.query)
+	}
+	return err
+}
+
+// rowsAffected returns the number of rows a statement affected, or -1 if it
+// isn't known.
+func rowsAffected(result driver.Result, err error) int64 {
+	if err != nil || result == nil {
+		return -1
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// namedValues converts arguments for drivers which don't support names.
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, driver.ErrSkip
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3PartSize is the size of each part of a multipart upload. Blobs bigger
+// than this are uploaded in several parts, in parallel.
+const s3PartSize = 16 << 20
+
+// S3Config holds the settings for an S3 (or S3-compatible, like MinIO)
+// bucket.
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// S3ConfigFromEnv reads the S3 settings from the environment:
+// SNIPPETBOX_S3_ENDPOINT (like "s3.amazonaws.com" or "localhost:9000"),
+// SNIPPETBOX_S3_REGION, SNIPPETBOX_S3_BUCKET, SNIPPETBOX_S3_ACCESS_KEY,
+// SNIPPETBOX_S3_SECRET_KEY and SNIPPETBOX_S3_USE_SSL (true by default).
+func S3ConfigFromEnv() (S3Config, error) {
+	cfg := S3Config{
+		Endpoint:  os.Getenv("SNIPPETBOX_S3_ENDPOINT"),
+		Region:    os.Getenv("SNIPPETBOX_S3_REGION"),
+		Bucket:    os.Getenv("SNIPPETBOX_S3_BUCKET"),
+		AccessKey: os.Getenv("SNIPPETBOX_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("SNIPPETBOX_S3_SECRET_KEY"),
+		UseSSL:    true,
+	}
+
+	if v := os.Getenv("SNIPPETBOX_S3_USE_SSL"); v != "" {
+		useSSL, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("storage: SNIPPETBOX_S3_USE_SSL: %w", err)
+		}
+		cfg.UseSSL = useSSL
+	}
+
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return cfg, errors.New("storage: SNIPPETBOX_S3_ENDPOINT and SNIPPETBOX_S3_BUCKET must be set")
+	}
+
+	return cfg, nil
+}
+
+// S3 stores blobs as objects in an S3 bucket.
+type S3 struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3 connects to the bucket described by cfg, and checks that it exists.
+func NewS3(ctx context.Context, cfg S3Config) (*S3, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("storage: bucket %q does not exist", cfg.Bucket)
+	}
+
+	return &S3{client: client, bucket: cfg.Bucket}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if !validKey(key) {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    s3PartSize,
+	})
+	return err
+}
+
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if !validKey(key) {
+		return nil, fmt.Errorf("storage: invalid key %q", key)
+	}
+
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// GetObject doesn't make a request until the object is read, so Stat it
+	// to find out whether it exists.
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+// SignedURL returns a presigned URL which downloads the blob directly from
+// the bucket until it expires, saving it as filename.
+func (s *S3) SignedURL(ctx context.Context, key, filename, disposition string, expires time.Duration) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+
+	params := url.Values{}
+	params.Set("response-content-disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, expires, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// Walk calls fn for every blob in the bucket.
+func (s *S3) Walk(ctx context.Context, fn func(key string, modified time.Time) error) error {
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		if !validKey(obj.Key) {
+			continue
+		}
+		if err := fn(obj.Key, obj.LastModified); err != nil {
+			return err
+		}
+	}
+	return nil
+}
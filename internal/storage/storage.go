@@ -0,0 +1,61 @@
+// Package storage holds the uploaded files (blobs) behind snippet
+// attachments. The database only records a blob's key; the bytes live in a
+// Blobs implementation: either the local disk or an S3-compatible bucket.
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when there's no blob with the given key.
+var ErrNotFound = errors.New("storage: blob not found")
+
+// Blobs stores and retrieves opaque blobs by key. Keys are generated with
+// NewKey, so implementations can assume they're short and URL-safe.
+type Blobs interface {
+	// Put stores size bytes read from r under key, replacing any blob with
+	// the same key.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+
+	// Open returns a reader for the blob. The caller must close it.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes the blob. Deleting a blob which doesn't exist isn't an
+	// error.
+	Delete(ctx context.Context, key string) error
+
+	// Walk calls fn with the key and modification time of every blob. If
+	// fn returns an error, Walk stops and returns it.
+	Walk(ctx context.Context, fn func(key string, modified time.Time) error) error
+}
+
+// URLSigner is implemented by stores which can give out URLs for downloading
+// a blob directly, like presigned S3 URLs. disposition is "inline" or
+// "attachment".
+type URLSigner interface {
+	SignedURL(ctx context.Context, key, filename, disposition string, expires time.Duration) (string, error)
+}
+
+// NewKey returns a new random key for a blob.
+func NewKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validKey reports whether key looks like one from NewKey, so that a bad key
+// can never be used to reach outside of the store.
+func validKey(key string) bool {
+	if len(key) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
@@ -0,0 +1,115 @@
+package testutils
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// testDSNEnv names the environment variable holding the data source name of
+// the test database. The database must already exist and be empty; its
+// tables are created for each test and dropped again afterwards, so it must
+// never be a database with data worth keeping in it.
+const testDSNEnv = "SNIPPETBOX_TEST_DSN"
+
+// defaultTestDSN is used when testDSNEnv isn't set. Create the database and
+// user with:
+//
+//	CREATE DATABASE test_snippetbox CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
+//	CREATE USER 'test_web'@'localhost';
+//	GRANT CREATE, DROP, ALTER, INDEX, SELECT, INSERT, UPDATE, DELETE, REFERENCES ON test_snippetbox.* TO 'test_web'@'localhost';
+//	ALTER USER 'test_web'@'localhost' IDENTIFIED BY 'pass';
+const defaultTestDSN = "test_web:pass@/test_snippetbox"
+
+// dir is this package's source directory. The scripts are found from it,
+// rather than from the working directory, which is the directory of whichever
+// package's tests are running.
+func dir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}
+
+// NewTestDB opens the test database and sets it up: the migrations are run
+// to create the tables, and then testdata/setup.sql adds the fixtures. When
+// the test finishes, testdata/teardown.sql drops the tables again and the
+// pool is closed.
+//
+// Database tests are slow, so they're skipped when tests are run with
+// -short. They're also skipped when the test database can't be reached, so
+// that the other tests can be run without one.
+func NewTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("testutils: skipping database test")
+	}
+
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		dsn = defaultTestDSN
+	}
+
+	// The scripts have several statements each, and the models expect
+	// DATETIME columns to be scanned into time.Time.
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.MultiStatements = true
+	cfg.ParseTime = true
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		t.Skipf("testutils: skipping database test: %v", err)
+	}
+
+	teardown := filepath.Join(dir(), "testdata", "teardown.sql")
+
+	// Drop anything left over from a test which didn't finish, so that the
+	// migrations start from nothing.
+	execScript(t, db, teardown)
+
+	t.Cleanup(func() {
+		defer db.Close()
+		execScript(t, db, teardown)
+	})
+
+	migrations, err := filepath.Glob(filepath.Join(dir(), "..", "..", "migrations", "*.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The file names start with a zero-padded number, so Glob's sorted
+	// order is the order they must run in.
+	for _, path := range migrations {
+		execScript(t, db, path)
+	}
+
+	execScript(t, db, filepath.Join(dir(), "testdata", "setup.sql"))
+
+	return db
+}
+
+// execScript runs the SQL statements in a file, failing the test if any of
+// them fails.
+func execScript(t *testing.T, db *sql.DB, path string) {
+	t.Helper()
+
+	script, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(string(script))
+	if err != nil {
+		t.Fatalf("%s: %v", filepath.Base(path), err)
+	}
+}
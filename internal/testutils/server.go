@@ -0,0 +1,111 @@
+// Package testutils has helpers for end-to-end tests of the web application:
+// a test server which keeps cookies between requests like a browser does,
+// a way to pull the CSRF token out of a page so that forms can be posted, and
+// a test database set up from the migrations and fixtures.
+//
+// A handler test builds the application, with the mocks or a test database,
+// and serves its routes:
+//
+//	ts := testutils.NewTestServer(t, app.routes())
+//	code, _, body := ts.Get(t, "/user/signup")
+//	form := url.Values{"csrf_token": {testutils.ExtractCSRFToken(t, body)}}
+//	code, headers, body = ts.PostForm(t, "/user/signup", form)
+package testutils
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+// TestServer is an HTTPS test server with a client which keeps cookies, so
+// a session carries on from one request to the next.
+type TestServer struct {
+	*httptest.Server
+}
+
+// NewTestServer starts serving h over TLS, and closes the server when the
+// test finishes. The client doesn't follow redirects, so that tests can
+// check where they go.
+func NewTestServer(t *testing.T, h http.Handler) *TestServer {
+	t.Helper()
+
+	ts := httptest.NewTLSServer(h)
+	t.Cleanup(ts.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar = jar
+
+	ts.Client().CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &TestServer{ts}
+}
+
+// Get requests a path from the server, and returns the response's status
+// code, headers and body.
+func (ts *TestServer) Get(t *testing.T, urlPath string) (int, http.Header, string) {
+	t.Helper()
+
+	rs, err := ts.Client().Get(ts.URL + urlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return readResponse(t, rs)
+}
+
+// PostForm posts form to a path on the server, and returns the response's
+// status code, headers and body. Pages with forms need a CSRF token in the
+// form; see ExtractCSRFToken.
+func (ts *TestServer) PostForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
+	t.Helper()
+
+	rs, err := ts.Client().PostForm(ts.URL+urlPath, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return readResponse(t, rs)
+}
+
+func readResponse(t *testing.T, rs *http.Response) (int, http.Header, string) {
+	t.Helper()
+
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, string(bytes.TrimSpace(body))
+}
+
+// csrfTokenRX matches the hidden CSRF token field of the forms in the
+// templates.
+var csrfTokenRX = regexp.MustCompile(`<input type='hidden' name='csrf_token' value='(.+?)'>`)
+
+// ExtractCSRFToken returns the CSRF token from the first form in a page,
+// failing the test if there isn't one.
+func ExtractCSRFToken(t *testing.T, body string) string {
+	t.Helper()
+
+	matches := csrfTokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("testutils: no csrf token found in body")
+	}
+
+	// The token is URL-safe base64, which html/template leaves alone, but
+	// it's unescaped anyway in case that ever changes.
+	return html.UnescapeString(matches[1])
+}
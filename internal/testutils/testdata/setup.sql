@@ -0,0 +1,34 @@
+INSERT INTO users (name, username, email, hashed_password, created) VALUES (
+    'Alice Jones',
+    'alice',
+    'alice@example.com',
+    '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG',
+    '2022-01-01 09:18:24'
+);
+
+INSERT INTO users (name, username, email, hashed_password, created) VALUES (
+    'Bob Admin',
+    'bob',
+    'bob@example.com',
+    '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG',
+    '2022-01-01 09:20:11'
+);
+
+-- Both users can write snippets, and Bob has the admin permissions too.
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users.id, permissions.id FROM users, permissions
+WHERE permissions.code = 'snippets:write'
+OR (users.username = 'bob' AND permissions.code IN ('admin:moderate', 'admin:system'));
+
+INSERT INTO snippets (title, content, content_hash, created, expires, user_id, publish_at) VALUES (
+    'An old silent pond',
+    'An old silent pond...\nA frog jumps into the pond,\nsplash! Silence again.\n\n– Matsuo Bashō',
+    NULL,
+    '2022-01-01 10:00:00',
+    '2099-01-01 10:00:00',
+    1,
+    '2022-01-01 10:00:00'
+);
+
+INSERT INTO snippet_revisions (snippet_id, revision, title, content, user_id, created)
+SELECT id, 1, title, content, user_id, created FROM snippets WHERE id = 1;
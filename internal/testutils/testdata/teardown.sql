@@ -0,0 +1,35 @@
+SET FOREIGN_KEY_CHECKS = 0;
+
+DROP TABLE IF EXISTS secret_findings;
+DROP TABLE IF EXISTS ip_bans;
+DROP TABLE IF EXISTS remember_tokens;
+DROP TABLE IF EXISTS oidc_sessions;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS org_members;
+DROP TABLE IF EXISTS orgs;
+DROP TABLE IF EXISTS invites;
+DROP TABLE IF EXISTS users_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS collection_items;
+DROP TABLE IF EXISTS collections;
+DROP TABLE IF EXISTS snippet_views;
+DROP TABLE IF EXISTS follows;
+DROP TABLE IF EXISTS reports;
+DROP TABLE IF EXISTS content_hashes;
+DROP TABLE IF EXISTS jobs;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
+DROP TABLE IF EXISTS snippet_tags;
+DROP TABLE IF EXISTS attachments;
+DROP TABLE IF EXISTS once_snippets;
+DROP TABLE IF EXISTS snippet_revisions;
+DROP TABLE IF EXISTS stars;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS tokens;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS snippets;
+
+SET FOREIGN_KEY_CHECKS = 1;
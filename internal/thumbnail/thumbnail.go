@@ -0,0 +1,152 @@
+// Package thumbnail makes small copies of uploaded images.
+//
+// Uploaded images are untrusted, so every image is checked before it's
+// decoded: a tiny file can claim to be a gigantic image (a "decompression
+// bomb") and exhaust memory as soon as it's decoded. The header is read first
+// and anything too big is rejected with ErrTooLarge.
+//
+// Thumbnails are always re-encoded from the decoded pixels, so none of the
+// original file's metadata (EXIF camera details, GPS locations, comments)
+// survives. The EXIF orientation of JPEG photos is applied to the pixels
+// before the metadata is dropped, so that they still appear the right way up.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+
+	// Register the decoders for the other image types which can be uploaded.
+	_ "image/gif"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxPixels is the largest image, in pixels, which will be decoded. At
+	// four bytes a pixel it needs 160MB of memory.
+	MaxPixels = 40_000_000
+
+	// MaxDimension is the longest side, in pixels, an image may have.
+	MaxDimension = 16384
+)
+
+// The output formats.
+const (
+	PNG  = "image/png"
+	JPEG = "image/jpeg"
+)
+
+var (
+	// ErrTooLarge is returned for images which are too big to decode safely.
+	ErrTooLarge = errors.New("thumbnail: image is too large")
+
+	// ErrUnsupported is returned for data which isn't an image in one of the
+	// supported formats.
+	ErrUnsupported = errors.New("thumbnail: unsupported image format")
+)
+
+// Make decodes the image in src, scales it down to fit in a size×size box,
+// and writes it to w in the given format (PNG or JPEG). Images which are
+// already small enough are re-encoded at their original size.
+func Make(w io.Writer, src []byte, size int, format string) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(src))
+	if err != nil {
+		return ErrUnsupported
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 ||
+		cfg.Width > MaxDimension || cfg.Height > MaxDimension ||
+		cfg.Width*cfg.Height > MaxPixels {
+		return ErrTooLarge
+	}
+
+	img, kind, err := image.Decode(bytes.NewReader(src))
+	if err != nil {
+		return ErrUnsupported
+	}
+
+	// Scaling first means only the small copy has to be turned around. The
+	// box is square, so the result fits either way.
+	dst := scale(img, size)
+	if kind == "jpeg" {
+		dst = orient(dst, jpegOrientation(src))
+	}
+
+	switch format {
+	case JPEG:
+		return jpeg.Encode(w, dst, &jpeg.Options{Quality: 85})
+	default:
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		return enc.Encode(w, dst)
+	}
+}
+
+// scale resizes img to fit in a size×size box, keeping its aspect ratio. It
+// never makes an image bigger.
+func scale(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// Negotiate picks the output format for a thumbnail from the request's Accept
+// header and the type of the original image. Photos are best as JPEG, and
+// anything which may be transparent is best as PNG; if the browser says it
+// doesn't accept the best format, the other is used instead.
+//
+// WebP would usually beat both. WebP uploads can be read, but there's no WebP
+// encoder in the Go standard library or golang.org/x/image, so thumbnails are
+// never WebP.
+func Negotiate(accept, sourceType string) string {
+	preferred, fallback := PNG, JPEG
+	if sourceType == JPEG {
+		preferred, fallback = JPEG, PNG
+	}
+
+	if accepts(accept, preferred) || !accepts(accept, fallback) {
+		return preferred
+	}
+	return fallback
+}
+
+// accepts reports whether an Accept header allows the media type. An empty
+// header accepts anything.
+func accepts(header, mediaType string) bool {
+	if strings.TrimSpace(header) == "" {
+		return true
+	}
+
+	major, _, _ := strings.Cut(mediaType, "/")
+
+	for _, part := range strings.Split(header, ",") {
+		t, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		if t == mediaType || t == major+"/*" || t == "*/*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,347 @@
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// halves returns a w×h image whose left half is red and right half blue.
+func halves(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// encodePNG returns img as a PNG file.
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pngClaiming returns a tiny PNG file whose header claims it's w×h, with
+// the header's checksum fixed up to match so that it's still read.
+func pngClaiming(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	b := encodePNG(t, image.NewGray(image.Rect(0, 0, 1, 1)))
+
+	// The IHDR chunk comes straight after the 8-byte signature: 4 bytes of
+	// length, 4 of type, then the width and height, and the CRC of the type
+	// and data after its 13 bytes of data.
+	ihdr := b[12 : 12+4+13]
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(w))
+	binary.BigEndian.PutUint32(ihdr[8:], uint32(h))
+	binary.BigEndian.PutUint32(b[12+4+13:], crc32.ChecksumIEEE(ihdr))
+	return b
+}
+
+// exifJPEG returns img as a JPEG file with an EXIF segment giving the
+// orientation in the byte order ("II" or "MM"), followed by extra, which
+// stands in for the rest of the metadata.
+func exifJPEG(t *testing.T, img image.Image, byteOrder string, orientation int, extra string) []byte {
+	t.Helper()
+
+	var order binary.AppendByteOrder = binary.LittleEndian
+	if byteOrder == "MM" {
+		order = binary.BigEndian
+	}
+
+	// A TIFF header pointing at an IFD with the one entry, a SHORT, and no
+	// next IFD.
+	tiff := []byte(byteOrder)
+	tiff = order.AppendUint16(tiff, 42)
+	tiff = order.AppendUint32(tiff, 8)
+	tiff = order.AppendUint16(tiff, 1)
+	tiff = order.AppendUint16(tiff, 0x0112)
+	tiff = order.AppendUint16(tiff, 3)
+	tiff = order.AppendUint32(tiff, 1)
+	tiff = order.AppendUint16(tiff, uint16(orientation))
+	tiff = order.AppendUint16(tiff, 0)
+	tiff = order.AppendUint32(tiff, 0)
+	tiff = append(tiff, extra...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	// The segment goes straight after the start of image marker.
+	return append(append(append([]byte{}, b[:2]...), app1...), b[2:]...)
+}
+
+// isRed and isBlue report whether a decoded pixel is mostly red or blue,
+// allowing for JPEG's losses.
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xC000 && g < 0x4000 && b < 0x4000
+}
+
+func isBlue(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return b > 0xC000 && r < 0x4000 && g < 0x4000
+}
+
+func TestMakeRejectsLargeImages(t *testing.T) {
+	tests := []struct {
+		name string
+		w, h int
+	}{
+		{"Too wide", MaxDimension + 1, 1},
+		{"Too tall", 1, MaxDimension + 1},
+		{"Too many pixels", 10000, 10000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := Make(&buf, pngClaiming(t, tt.w, tt.h), 100, PNG)
+			if !errors.Is(err, ErrTooLarge) {
+				t.Errorf("got error %v; want %v", err, ErrTooLarge)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("got %d bytes written; want none", buf.Len())
+			}
+		})
+	}
+}
+
+func TestMakeRejectsUnsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		src  []byte
+	}{
+		{"Empty", nil},
+		{"Text", []byte("An old silent pond")},
+		{"Truncated PNG", encodePNG(t, halves(8, 8))[:40]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Make(&bytes.Buffer{}, tt.src, 100, PNG)
+			if !errors.Is(err, ErrUnsupported) {
+				t.Errorf("got error %v; want %v", err, ErrUnsupported)
+			}
+		})
+	}
+}
+
+func TestMakeScales(t *testing.T) {
+	tests := []struct {
+		name   string
+		w, h   int
+		size   int
+		format string
+		wantW  int
+		wantH  int
+	}{
+		{"Wide", 40, 20, 10, PNG, 10, 5},
+		{"Tall", 20, 40, 10, JPEG, 5, 10},
+		{"Small enough", 8, 6, 10, PNG, 8, 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := Make(&buf, encodePNG(t, halves(tt.w, tt.h)), tt.size, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, kind, err := image.DecodeConfig(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := tt.format[len("image/"):]; kind != want {
+				t.Errorf("got a %s thumbnail; want %s", kind, want)
+			}
+			if cfg.Width != tt.wantW || cfg.Height != tt.wantH {
+				t.Errorf("got %d×%d; want %d×%d", cfg.Width, cfg.Height, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestMakeOrientsAndStripsEXIF(t *testing.T) {
+	const secret = "GPS 51.5007N 0.1246W"
+
+	for _, byteOrder := range []string{"II", "MM"} {
+		t.Run(byteOrder, func(t *testing.T) {
+			// Orientation 6 means the camera was turned, so the stored 32×16
+			// image must be rotated 90° clockwise: the red left half ends up
+			// on top.
+			src := exifJPEG(t, halves(32, 16), byteOrder, 6, secret)
+
+			for _, format := range []string{PNG, JPEG} {
+				var buf bytes.Buffer
+				err := Make(&buf, src, 100, format)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if bytes.Contains(buf.Bytes(), []byte("Exif")) || bytes.Contains(buf.Bytes(), []byte(secret)) {
+					t.Errorf("%s: got the EXIF metadata in the thumbnail; want it stripped", format)
+				}
+
+				img, _, err := image.Decode(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b := img.Bounds()
+				if b.Dx() != 16 || b.Dy() != 32 {
+					t.Fatalf("%s: got %d×%d; want 16×32", format, b.Dx(), b.Dy())
+				}
+				if top := img.At(8, 4); !isRed(top) {
+					t.Errorf("%s: got %v at the top; want red", format, top)
+				}
+				if bottom := img.At(8, 28); !isBlue(bottom) {
+					t.Errorf("%s: got %v at the bottom; want blue", format, bottom)
+				}
+			}
+		})
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	img := halves(4, 4)
+
+	var plain bytes.Buffer
+	if err := jpeg.Encode(&plain, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"Little-endian", exifJPEG(t, img, "II", 8, ""), 8},
+		{"Big-endian", exifJPEG(t, img, "MM", 3, ""), 3},
+		{"No EXIF", plain.Bytes(), 1},
+		{"Out of range", exifJPEG(t, img, "II", 9, ""), 1},
+		{"Truncated", exifJPEG(t, img, "II", 6, "")[:20], 1},
+		{"Not a JPEG", encodePNG(t, img), 1},
+		{"Empty", nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Errorf("got %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// The source is
+	//
+	//	a b c
+	//	d e f
+	//
+	// and each orientation is what it looks like once it's been turned the
+	// right way up.
+	src := []string{"abc", "def"}
+
+	tests := []struct {
+		orientation int
+		want        []string
+	}{
+		{1, []string{"abc", "def"}},
+		{2, []string{"cba", "fed"}},
+		{3, []string{"fed", "cba"}},
+		{4, []string{"def", "abc"}},
+		{5, []string{"ad", "be", "cf"}},
+		{6, []string{"da", "eb", "fc"}},
+		{7, []string{"fc", "eb", "da"}},
+		{8, []string{"cf", "be", "ad"}},
+	}
+
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	for y, row := range src {
+		for x, c := range row {
+			img.SetGray(x, y, color.Gray{Y: uint8(c)})
+		}
+	}
+
+	for _, tt := range tests {
+		got := orient(img, tt.orientation)
+
+		b := got.Bounds()
+		var rows []string
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			var row []byte
+			for x := b.Min.X; x < b.Max.X; x++ {
+				row = append(row, color.GrayModel.Convert(got.At(x, y)).(color.Gray).Y)
+			}
+			rows = append(rows, string(row))
+		}
+
+		if len(rows) != len(tt.want) {
+			t.Errorf("orientation %d: got %q; want %q", tt.orientation, rows, tt.want)
+			continue
+		}
+		for i := range rows {
+			if rows[i] != tt.want[i] {
+				t.Errorf("orientation %d: got %q; want %q", tt.orientation, rows, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name       string
+		accept     string
+		sourceType string
+		want       string
+	}{
+		{"Empty header, photo", "", JPEG, JPEG},
+		{"Empty header, PNG", "", PNG, PNG},
+		{"Empty header, GIF", "   ", "image/gif", PNG},
+		{"Anything", "*/*", JPEG, JPEG},
+		{"Any image", "image/*", PNG, PNG},
+		{"Browser", "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8", JPEG, JPEG},
+		{"Only JPEG", "image/jpeg", PNG, JPEG},
+		{"Only PNG", "image/png", JPEG, PNG},
+		{"PNG refused", "image/png;q=0, image/jpeg", PNG, JPEG},
+		{"JPEG refused", "image/jpeg; q=0, image/png", JPEG, PNG},
+		{"Both refused", "image/png;q=0, image/jpeg;q=0", PNG, PNG},
+		{"Neither listed", "text/html", JPEG, JPEG},
+		{"Malformed", "image/png;;, image/jpeg", PNG, JPEG},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Negotiate(tt.accept, tt.sourceType); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package validator
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// CleanText prepares submitted text for storing. It puts the text into
+// Unicode Normalization Form C, so that text which looks the same is stored
+// the same way and its length in characters is what a reader would count.
+// It also removes characters which can make text display differently from
+// how it reads: control characters other than tab, newline and carriage
+// return, and the bidirectional embedding, override and isolate characters
+// used in "Trojan Source" attacks. Invalid UTF-8 is replaced with U+FFFD.
+// CleanText reports whether anything was removed or replaced, so that the
+// user can be told.
+func CleanText(s string) (string, bool) {
+	changed := false
+
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "\uFFFD")
+		changed = true
+	}
+
+	s = strings.Map(func(r rune) rune {
+		if unsafeRune(r) {
+			changed = true
+			return -1
+		}
+		return r
+	}, s)
+
+	return norm.NFC.String(s), changed
+}
+
+// unsafeRune reports whether r is one of the characters CleanText removes.
+func unsafeRune(r rune) bool {
+	switch {
+	case r == '\t' || r == '\n' || r == '\r':
+		return false
+	case r < 0x20 || (r >= 0x7f && r <= 0x9f):
+		return true
+	case r >= 0x202a && r <= 0x202e:
+		// LRE, RLE, PDF, LRO and RLO.
+		return true
+	case r >= 0x2066 && r <= 0x2069:
+		// LRI, RLI, FSI and PDI.
+		return true
+	}
+	return false
+}
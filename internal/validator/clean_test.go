@@ -0,0 +1,33 @@
+package validator
+
+import "testing"
+
+func TestCleanText(t *testing.T) {
+	tests := []struct {
+		name        string
+		s           string
+		want        string
+		wantChanged bool
+	}{
+		{"Plain", "An old silent pond", "An old silent pond", false},
+		{"Tabs and newlines", "a\tb\r\nc\n", "a\tb\r\nc\n", false},
+		// Normalizing isn't counted as a change: the text looks the same.
+		{"Decomposed", "cafe\u0301", "caf\u00e9", false},
+		{"Control characters", "a\x00b\x1bc\x7f", "abc", true},
+		{"C1 control", "a\u0085b", "ab", true},
+		{"Bidi override", "admin\u202e\u2066txt.exe\u2069", "admintxt.exe", true},
+		{"Invalid UTF-8", "a\xffb", "a\ufffdb", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := CleanText(tt.s)
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("got changed %t; want %t", changed, tt.wantChanged)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Package validator collects validation errors for HTML forms and JSON API
+// input. Embed a Validator in a form struct and the errors are available to
+// templates as .Form.FieldErrors and .Form.NonFieldErrors; API handlers send
+// FieldErrors back to the client as a field→message map.
+package validator
+
+import (
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validator holds the validation errors found so far. FieldErrors is keyed
+// by field (or query parameter) name; NonFieldErrors holds errors which
+// aren't about any one field, like wrong login details. The zero value is
+// ready to use.
+type Validator struct {
+	FieldErrors    map[string]string
+	NonFieldErrors []string
+}
+
+// Valid returns true if no errors have been added.
+func (v *Validator) Valid() bool {
+	return len(v.FieldErrors) == 0 && len(v.NonFieldErrors) == 0
+}
+
+// AddError adds an error message for a field, unless the field already has
+// one. The first problem found with a field is usually the most useful one
+// to report.
+func (v *Validator) AddError(key, message string) {
+	if v.FieldErrors == nil {
+		v.FieldErrors = make(map[string]string)
+	}
+
+	if _, exists := v.FieldErrors[key]; !exists {
+		v.FieldErrors[key] = message
+	}
+}
+
+// AddNonFieldError adds an error message which isn't about a specific field.
+func (v *Validator) AddNonFieldError(message string) {
+	v.NonFieldErrors = append(v.NonFieldErrors, message)
+}
+
+// Check adds an error message for a field if a validation check isn't ok.
+func (v *Validator) Check(ok bool, key, message string) {
+	if !ok {
+		v.AddError(key, message)
+	}
+}
+
+// NotBlank returns true if a value contains something other than whitespace.
+func NotBlank(value string) bool {
+	return strings.TrimSpace(value) != ""
+}
+
+// MaxChars returns true if a value contains no more than n characters.
+func MaxChars(value string, n int) bool {
+	return utf8.RuneCountInString(value) <= n
+}
+
+// MaxBytes returns true if a value is no more than n bytes long.
+func MaxBytes(value string, n int64) bool {
+	return int64(len(value)) <= n
+}
+
+// MinChars returns true if a value contains at least n characters.
+func MinChars(value string, n int) bool {
+	return utf8.RuneCountInString(value) >= n
+}
+
+// PermittedValue returns true if a value is one of the permitted values.
+func PermittedValue[T comparable](value T, permittedValues ...T) bool {
+	return slices.Contains(permittedValues, value)
+}
+
+// Matches returns true if a value matches the regular expression.
+func Matches(value string, rx *regexp.Regexp) bool {
+	return rx.MatchString(value)
+}
+
+// IsEmail returns true if a value can be parsed as an email address.
+func IsEmail(value string) bool {
+	_, err := mail.ParseAddress(value)
+	return err == nil
+}
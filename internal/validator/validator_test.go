@@ -0,0 +1,223 @@
+package validator
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNotBlank(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"Text", "An old silent pond", true},
+		{"Padded", "  pond  ", true},
+		{"Empty", "", false},
+		{"Spaces", "   ", false},
+		{"Whitespace", " \t\r\n", false},
+		{"No-break space", "\u00a0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NotBlank(tt.value); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxChars(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		n     int
+		want  bool
+	}{
+		{"Under", "pond", 5, true},
+		{"Exactly", "ponds", 5, true},
+		{"Over", "ponds!", 5, false},
+		{"Empty", "", 0, true},
+		// Characters are counted, not bytes: each of these is three bytes.
+		{"Multibyte", "古池や蛙飛", 5, true},
+		{"Multibyte over", "古池や蛙飛び", 5, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MaxChars(tt.value, tt.n); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		n     int64
+		want  bool
+	}{
+		{"Under", "pond", 5, true},
+		{"Exactly", "ponds", 5, true},
+		{"Over", "ponds!", 5, false},
+		{"Multibyte", "古池", 5, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MaxBytes(tt.value, tt.n); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinChars(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		n     int
+		want  bool
+	}{
+		{"Over", "password1", 8, true},
+		{"Exactly", "password", 8, true},
+		{"Under", "passwor", 8, false},
+		{"Empty", "", 1, false},
+		{"Multibyte", "古池や蛙", 4, true},
+		// Four characters, but twelve bytes.
+		{"Multibyte under", "古池や蛙", 5, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MinChars(tt.value, tt.n); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPermittedValue(t *testing.T) {
+	t.Run("Int", func(t *testing.T) {
+		tests := []struct {
+			value int
+			want  bool
+		}{
+			{1, true},
+			{7, true},
+			{365, true},
+			{0, false},
+			{2, false},
+		}
+
+		for _, tt := range tests {
+			if got := PermittedValue(tt.value, 1, 7, 365); got != tt.want {
+				t.Errorf("PermittedValue(%d) = %t; want %t", tt.value, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("String", func(t *testing.T) {
+		tests := []struct {
+			value string
+			want  bool
+		}{
+			{"public", true},
+			{"private", true},
+			{"Public", false},
+			{"", false},
+		}
+
+		for _, tt := range tests {
+			if got := PermittedValue(tt.value, "public", "private"); got != tt.want {
+				t.Errorf("PermittedValue(%q) = %t; want %t", tt.value, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("None", func(t *testing.T) {
+		if PermittedValue("public") {
+			t.Error("got true with no permitted values; want false")
+		}
+	})
+}
+
+func TestMatches(t *testing.T) {
+	rx := regexp.MustCompile(`^[a-z0-9-]+$`)
+
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"go-snippets", true},
+		{"Go", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := Matches(tt.value, rx); got != tt.want {
+			t.Errorf("Matches(%q) = %t; want %t", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIsEmail(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"Plain", "alice@example.com", true},
+		{"Subaddress", "alice+snippets@example.com", true},
+		{"Subdomain", "bob@mail.example.co.uk", true},
+		{"Empty", "", false},
+		{"No at", "alice.example.com", false},
+		{"No domain", "alice@", false},
+		{"No local part", "@example.com", false},
+		{"Two ats", "alice@@example.com", false},
+		{"Space", "alice smith@example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsEmail(tt.value); got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidator(t *testing.T) {
+	var v Validator
+	if !v.Valid() {
+		t.Fatal("the zero Validator isn't valid")
+	}
+
+	v.Check(NotBlank("pond"), "title", "This field cannot be blank")
+	if !v.Valid() {
+		t.Fatal("a passing check made the Validator invalid")
+	}
+
+	// Only the first error for a field is kept.
+	v.Check(NotBlank(""), "title", "This field cannot be blank")
+	v.Check(MaxChars(strings.Repeat("a", 101), 100), "title", "This field cannot be more than 100 characters long")
+	if v.Valid() {
+		t.Fatal("a failing check left the Validator valid")
+	}
+	if got := v.FieldErrors["title"]; got != "This field cannot be blank" {
+		t.Errorf("got title error %q; want the first one", got)
+	}
+
+	v = Validator{}
+	v.AddNonFieldError("Email or password is incorrect")
+	if v.Valid() {
+		t.Error("a non-field error left the Validator valid")
+	}
+	if len(v.FieldErrors) != 0 {
+		t.Errorf("got field errors %v; want none", v.FieldErrors)
+	}
+}
@@ -0,0 +1,92 @@
+package virusscan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// chunkSize is how much of a file is sent to clamd at a time.
+const chunkSize = 32 << 10
+
+// ClamAV scans files with clamd, the ClamAV daemon, using its INSTREAM
+// command. clamd refuses files bigger than its StreamMaxLength setting
+// (25 MB by default), which should be at least the largest upload allowed.
+type ClamAV struct {
+	// Network is "tcp" or "unix".
+	Network string
+	// Address is a host and port, or the path of a Unix socket.
+	Address string
+}
+
+// Scan sends r to clamd and reads its verdict.
+func (c *ClamAV) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	conn, err := dial(ctx, c.Network, c.Address)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+
+	err = c.send(conn, r)
+	var rerr readError
+	if errors.As(err, &rerr) {
+		return Result{}, rerr.err
+	}
+
+	// clamd hangs up part way through a file which is too big, after
+	// saying why, so the reply is read even if sending failed.
+	reply, replyErr := bufio.NewReader(conn).ReadString(0)
+	reply = strings.TrimSpace(strings.TrimSuffix(reply, "\x00"))
+	if reply == "" {
+		return Result{}, fmt.Errorf("virusscan: clamd: %w", errors.Join(err, replyErr))
+	}
+
+	// The reply is "stream: OK", "stream: <name> FOUND" or
+	// "<message> ERROR".
+	verdict := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case verdict == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{Infected: true, Threat: strings.TrimSuffix(verdict, " FOUND")}, nil
+	}
+	return Result{}, fmt.Errorf("virusscan: clamd: %s", reply)
+}
+
+// readError is an error reading the file being scanned, rather than
+// talking to clamd.
+type readError struct{ err error }
+
+func (e readError) Error() string { return e.err.Error() }
+
+// send writes the INSTREAM command, then r in chunks, each prefixed with
+// its length, then a zero length to end the stream.
+func (c *ClamAV) send(w io.Writer, r io.Reader) error {
+	_, err := io.WriteString(w, "zINSTREAM\x00")
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, rerr := r.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := w.Write(buf[:4+n]); err != nil {
+				return err
+			}
+		}
+		if errors.Is(rerr, io.EOF) {
+			break
+		} else if rerr != nil {
+			return readError{rerr}
+		}
+	}
+
+	_, err = w.Write([]byte{0, 0, 0, 0})
+	return err
+}
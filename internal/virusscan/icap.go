@@ -0,0 +1,111 @@
+package virusscan
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+)
+
+// httpHeader is the HTTP response the file is wrapped in, since ICAP scans
+// HTTP messages rather than files.
+const httpHeader = "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\n\r\n"
+
+// ICAP scans files with an ICAP server (RFC 3507), such as c-icap with
+// ClamAV, or a commercial antivirus gateway. The file is sent to the
+// RESPMOD service as the body of an HTTP response.
+type ICAP struct {
+	// Address is the server's host and port.
+	Address string
+	// Service is the path of the RESPMOD service, like "/avscan".
+	Service string
+}
+
+// Scan sends r to the ICAP server and reads its verdict. A 204 reply means
+// the file is clean. Any other successful reply means the server wanted to
+// change or block the file, and the threat is taken from the
+// X-Infection-Found or X-Virus-ID header if there is one.
+func (c *ICAP) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	conn, err := dial(ctx, "tcp", c.Address)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "RESPMOD icap://%s%s ICAP/1.0\r\n", c.Address, c.Service)
+	fmt.Fprintf(w, "Host: %s\r\n", c.Address)
+	fmt.Fprintf(w, "Allow: 204\r\n")
+	fmt.Fprintf(w, "Encapsulated: res-hdr=0, res-body=%d\r\n", len(httpHeader))
+	fmt.Fprintf(w, "Connection: close\r\n\r\n")
+	io.WriteString(w, httpHeader)
+
+	err = writeChunked(w, r)
+	if err != nil {
+		return Result{}, err
+	}
+	err = w.Flush()
+	if err != nil {
+		return Result{}, fmt.Errorf("virusscan: icap: %w", err)
+	}
+
+	tp := textproto.NewReader(bufio.NewReader(conn))
+	line, err := tp.ReadLine()
+	if err != nil {
+		return Result{}, fmt.Errorf("virusscan: icap: %w", err)
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Result{}, fmt.Errorf("virusscan: icap: %w", err)
+	}
+
+	// The status line looks like "ICAP/1.0 204 No Content".
+	_, status, _ := strings.Cut(line, " ")
+	code, _, _ := strings.Cut(status, " ")
+	switch code {
+	case "204":
+		return Result{}, nil
+	case "200":
+		return Result{Infected: true, Threat: icapThreat(header)}, nil
+	}
+	return Result{}, fmt.Errorf("virusscan: icap: %s", line)
+}
+
+// writeChunked writes r to w with HTTP chunked encoding.
+func writeChunked(w io.Writer, r io.Reader) error {
+	buf := make([]byte, chunkSize)
+	for {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(w, "%x\r\n", n)
+			w.Write(buf[:n])
+			io.WriteString(w, "\r\n")
+		}
+		if errors.Is(rerr, io.EOF) {
+			break
+		} else if rerr != nil {
+			return rerr
+		}
+	}
+
+	_, err := io.WriteString(w, "0\r\n\r\n")
+	return err
+}
+
+// icapThreat finds the name of what was found in an ICAP reply's headers.
+// X-Infection-Found looks like "Type=0; Resolution=2; Threat=Eicar;".
+func icapThreat(header textproto.MIMEHeader) string {
+	for _, field := range strings.Split(header.Get("X-Infection-Found"), ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		if strings.EqualFold(name, "Threat") && value != "" {
+			return value
+		}
+	}
+	if id := strings.TrimSpace(header.Get("X-Virus-ID")); id != "" {
+		return id
+	}
+	return "blocked by the ICAP server"
+}
@@ -0,0 +1,99 @@
+// Package virusscan checks uploaded files for viruses and other malware
+// with an external scanner. Scanners are reached over the network: clamd,
+// the ClamAV daemon, or any antivirus server which speaks ICAP.
+package virusscan
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Result is what a scan found.
+type Result struct {
+	Infected bool
+	// Threat names what was found, like "Eicar-Signature", if the scanner
+	// said.
+	Threat string
+}
+
+// Scanner is the interface for virus scanners. Scan reads r to the end and
+// reports whether it's infected. An error means the file couldn't be
+// scanned, not that it's infected, and the scan can be tried again.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// defaultTimeout is how long a scan may take, when the context doesn't say.
+const defaultTimeout = 2 * time.Minute
+
+// New returns a scanner for the address in rawURL:
+//
+//	clamav://host:3310            clamd listening on TCP
+//	clamav:///run/clamav/clamd.ctl clamd listening on a Unix socket
+//	icap://host:1344/avscan        an ICAP server's RESPMOD service
+func New(rawURL string) (Scanner, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("virusscan: %w", err)
+	}
+
+	switch u.Scheme {
+	case "clamav":
+		if u.Host == "" {
+			if u.Path == "" {
+				return nil, fmt.Errorf("virusscan: %s: no host or socket", rawURL)
+			}
+			return &ClamAV{Network: "unix", Address: u.Path}, nil
+		}
+		return &ClamAV{Network: "tcp", Address: withPort(u.Host, "3310")}, nil
+	case "icap":
+		if u.Host == "" {
+			return nil, fmt.Errorf("virusscan: %s: no host", rawURL)
+		}
+		return &ICAP{Address: withPort(u.Host, "1344"), Service: u.Path}, nil
+	}
+
+	return nil, fmt.Errorf("virusscan: unknown scanner %q", u.Scheme)
+}
+
+// withPort adds port to host if it doesn't have one.
+func withPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// dial connects to a scanner, with the context's deadline, or
+// defaultTimeout, as the deadline for the whole conversation.
+func dial(ctx context.Context, network, address string) (net.Conn, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultTimeout)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, fmt.Errorf("virusscan: %w", err)
+	}
+	conn.SetDeadline(deadline)
+
+	// Stop waiting on the scanner as soon as the context is cancelled.
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	return &stopConn{Conn: conn, stop: stop}, nil
+}
+
+type stopConn struct {
+	net.Conn
+	stop func() bool
+}
+
+func (c *stopConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
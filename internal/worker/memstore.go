@@ -0,0 +1,109 @@
+package worker
+
+import (
+	"sync"
+	"time"
+)
+
+// MemStore represents an in-memory job store. It's useful for development
+// and tests, but queued jobs are lost when the process restarts.
+type MemStore struct {
+	mu     sync.Mutex
+	nextID int64
+	jobs   map[int64]*Job
+	dead   []*Job
+}
+
+// NewMemStore returns a new MemStore instance.
+func NewMemStore() *MemStore {
+	return &MemStore{jobs: make(map[int64]*Job)}
+}
+
+// Enqueue adds a job to the MemStore instance, setting its ID.
+func (m *MemStore) Enqueue(job *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	j := *job
+	j.ID = m.nextID
+	m.jobs[j.ID] = &j
+	job.ID = j.ID
+
+	return nil
+}
+
+// Claim returns a copy of the due job which has waited longest, and holds
+// it for lease.
+func (m *MemStore) Claim(lease time.Duration) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	var due *Job
+	for _, j := range m.jobs {
+		if !j.RunAt.After(now) && (due == nil || j.RunAt.Before(due.RunAt)) {
+			due = j
+		}
+	}
+	if due == nil {
+		return nil, nil
+	}
+
+	due.Attempts++
+	due.RunAt = now.Add(lease)
+
+	j := *due
+	return &j, nil
+}
+
+// Complete removes a finished job.
+func (m *MemStore) Complete(id int64) error {
+	m.mu.Lock()
+	delete(m.jobs, id)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Retry schedules a job to run again at runAt.
+func (m *MemStore) Retry(id int64, runAt time.Time, lastError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if j, ok := m.jobs[id]; ok {
+		j.RunAt = runAt
+		j.LastError = lastError
+	}
+
+	return nil
+}
+
+// Bury moves a job to the dead-letter list.
+func (m *MemStore) Bury(id int64, lastError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if j, ok := m.jobs[id]; ok {
+		j.LastError = lastError
+		m.dead = append(m.dead, j)
+		delete(m.jobs, id)
+	}
+
+	return nil
+}
+
+// Dead returns copies of the buried jobs.
+func (m *MemStore) Dead() []*Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dead := make([]*Job, len(m.dead))
+	for i, j := range m.dead {
+		c := *j
+		dead[i] = &c
+	}
+
+	return dead
+}
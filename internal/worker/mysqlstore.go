@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// The states of a job in the jobs table. Finished jobs are deleted.
+const (
+	statusReady = "ready"
+	statusDead  = "dead"
+)
+
+// MySQLStore represents a job store in MySQL, which lets several instances
+// of the application share one queue. It expects a jobs table created with
+// the following schema:
+//
+//	CREATE TABLE jobs (
+//		id BIGINT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+//		kind VARCHAR(64) NOT NULL,
+//		payload BLOB NOT NULL,
+//		status VARCHAR(16) NOT NULL,
+//		attempts INTEGER NOT NULL DEFAULT 0,
+//		max_attempts INTEGER NOT NULL,
+//		run_at DATETIME(6) NOT NULL,
+//		last_error VARCHAR(255) NULL,
+//		created DATETIME NOT NULL
+//	);
+//	CREATE INDEX idx_jobs_ready ON jobs(status, run_at);
+type MySQLStore struct {
+	db *sql.DB
+}
+
+// NewMySQLStore returns a new MySQLStore instance.
+func NewMySQLStore(db *sql.DB) *MySQLStore {
+	return &MySQLStore{db: db}
+}
+
+// Enqueue inserts a job, setting its ID.
+func (m *MySQLStore) Enqueue(job *Job) error {
+	stmt := `INSERT INTO jobs (kind, payload, status, max_attempts, run_at, created)
+	VALUES(?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.db.Exec(stmt, job.Kind, job.Payload, statusReady, job.MaxAttempts, job.RunAt.UTC())
+	if err != nil {
+		return err
+	}
+
+	job.ID, err = result.LastInsertId()
+	return err
+}
+
+// Claim returns the due job which has waited longest, and holds it for
+// lease by moving its run_at into the future. SKIP LOCKED lets workers
+// claim jobs at the same time without waiting for each other.
+func (m *MySQLStore) Claim(lease time.Duration) (*Job, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	stmt := `SELECT id, kind, payload, attempts, max_attempts, run_at, last_error FROM jobs
+	WHERE status = ? AND run_at <= UTC_TIMESTAMP(6)
+	ORDER BY run_at LIMIT 1 FOR UPDATE SKIP LOCKED`
+
+	j := &Job{}
+	var lastError sql.NullString
+
+	err = tx.QueryRow(stmt, statusReady).Scan(&j.ID, &j.Kind, &j.Payload, &j.Attempts, &j.MaxAttempts, &j.RunAt, &lastError)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	j.LastError = lastError.String
+	j.Attempts++
+
+	_, err = tx.Exec("UPDATE jobs SET attempts = ?, run_at = ? WHERE id = ?", j.Attempts, time.Now().UTC().Add(lease), j.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return j, tx.Commit()
+}
+
+// Complete deletes a finished job.
+func (m *MySQLStore) Complete(id int64) error {
+	_, err := m.db.Exec("DELETE FROM jobs WHERE id = ?", id)
+	return err
+}
+
+// Retry schedules a job to run again at runAt.
+func (m *MySQLStore) Retry(id int64, runAt time.Time, lastError string) error {
+	_, err := m.db.Exec("UPDATE jobs SET run_at = ?, last_error = ? WHERE id = ?", runAt.UTC(), lastError, id)
+	return err
+}
+
+// Bury moves a job to the dead-letter state, where it stays until it's
+// deleted or its status is set back to ready by hand.
+func (m *MySQLStore) Bury(id int64, lastError string) error {
+	_, err := m.db.Exec("UPDATE jobs SET status = ?, last_error = ? WHERE id = ?", statusDead, lastError, id)
+	return err
+}
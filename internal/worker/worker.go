@@ -0,0 +1,331 @@
+// Package worker runs background jobs from a queue. Jobs are enqueued by
+// kind with a JSON payload, stored in a Store, and run by a pool of workers
+// which call the Handler registered for their kind. A job whose handler
+// returns an error is retried with exponential backoff until it runs out of
+// attempts, when it's moved to the dead-letter state and kept for
+// inspection instead of being deleted.
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Job is a unit of work taken from the queue. Attempts counts the current
+// attempt, so it's 1 the first time a job runs.
+type Job struct {
+	ID          int64
+	Kind        string
+	Payload     []byte
+	Attempts    int
+	MaxAttempts int
+	RunAt       time.Time
+	LastError   string
+}
+
+// Decode unmarshals the job's JSON payload into v.
+func (j *Job) Decode(v any) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Store is the interface for job stores. Claim should return a nil job (and
+// no error) if no job is due. A claimed job mustn't be claimed again until
+// lease has passed, so that a job whose worker died is eventually retried.
+type Store interface {
+	Enqueue(job *Job) error
+	Claim(lease time.Duration) (*Job, error)
+	Complete(id int64) error
+	Retry(id int64, runAt time.Time, lastError string) error
+	Bury(id int64, lastError string) error
+}
+
+// Handler runs a job. Returning an error retries the job later, unless the
+// error was wrapped with Permanent.
+type Handler func(ctx context.Context, job *Job) error
+
+// Options control how jobs of one kind are run. Zero values get the
+// defaults.
+type Options struct {
+	// MaxAttempts is how many times a job is tried before it's buried.
+	// The default is 5.
+	MaxAttempts int
+
+	// Timeout is how long one attempt may take before its context is
+	// cancelled. The default is one minute. It must be shorter than the
+	// queue's Lease.
+	Timeout time.Duration
+
+	// Backoff returns how long to wait before retrying after the given
+	// attempt failed. The default starts at 10 seconds and doubles each
+	// time, up to an hour.
+	Backoff func(attempt int) time.Duration
+}
+
+// DefaultBackoff waits 10 seconds after the first failed attempt and twice
+// as long after each one after that, up to an hour, with up to 10% jitter
+// so that jobs which failed together don't all retry together.
+func DefaultBackoff(attempt int) time.Duration {
+	delay := time.Hour
+	if attempt <= 16 {
+		delay = min(10*time.Second<<(attempt-1), time.Hour)
+	}
+	return delay + rand.N(delay/10+1)
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps an error to say that retrying won't help, so the job is
+// buried straight away.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e retryAfterError) Error() string { return e.err.Error() }
+func (e retryAfterError) Unwrap() error { return e.err }
+
+// RetryAfter wraps an error to retry the job after delay, rather than after
+// the delay its Backoff function gives.
+func RetryAfter(err error, delay time.Duration) error {
+	return retryAfterError{err, delay}
+}
+
+type registration struct {
+	handler Handler
+	opts    Options
+}
+
+// Queue runs jobs from a Store on a pool of workers. Register the handlers
+// before calling Start.
+type Queue struct {
+	// Workers is how many jobs can run at once. The default is 4.
+	Workers int
+
+	// PollInterval is how often idle workers check the store for jobs
+	// which were enqueued elsewhere or have become due. Jobs enqueued
+	// through this Queue are picked up straight away. The default is 5
+	// seconds.
+	PollInterval time.Duration
+
+	// Lease is how long a claimed job is held before another worker may
+	// claim it again. The default is 5 minutes.
+	Lease time.Duration
+
+	// ErrorLog receives errors from the store and from failed jobs. The
+	// default is the standard logger.
+	ErrorLog *log.Logger
+
+	store    Store
+	handlers map[string]registration
+	wake     chan struct{}
+	quit     chan struct{}
+	stopOnce sync.Once
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// New returns a Queue which takes its jobs from store.
+func New(store Store) *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Queue{
+		Workers:      4,
+		PollInterval: 5 * time.Second,
+		Lease:        5 * time.Minute,
+		ErrorLog:     log.Default(),
+		store:        store,
+		handlers:     make(map[string]registration),
+		wake:         make(chan struct{}, 1),
+		quit:         make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// Register sets the handler for jobs of the given kind.
+func (q *Queue) Register(kind string, h Handler, opts Options) {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Minute
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = DefaultBackoff
+	}
+
+	q.handlers[kind] = registration{handler: h, opts: opts}
+}
+
+// Enqueue adds a job of the given kind to the queue, to run as soon as a
+// worker is free. The payload is encoded as JSON.
+func (q *Queue) Enqueue(kind string, payload any) error {
+	return q.EnqueueAt(kind, payload, time.Now())
+}
+
+// EnqueueAt adds a job of the given kind to the queue, to run no earlier
+// than runAt.
+func (q *Queue) EnqueueAt(kind string, payload any, runAt time.Time) error {
+	reg, ok := q.handlers[kind]
+	if !ok {
+		return fmt.Errorf("worker: no handler registered for %q jobs", kind)
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	err = q.store.Enqueue(&Job{Kind: kind, Payload: b, MaxAttempts: reg.opts.MaxAttempts, RunAt: runAt})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Start starts the workers.
+func (q *Queue) Start() {
+	for i := 0; i < q.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+// Shutdown stops the workers from taking new jobs and waits for the running
+// ones to finish. If ctx is done first, the running jobs' contexts are
+// cancelled and Shutdown returns ctx.Err() once their handlers return. Jobs
+// which were cut short are retried when their lease runs out.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.stopOnce.Do(func() { close(q.quit) })
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-q.quit:
+			return
+		default:
+		}
+
+		job, err := q.store.Claim(q.Lease)
+		if err != nil {
+			q.ErrorLog.Printf("worker: claiming job: %v", err)
+		}
+
+		if job == nil {
+			select {
+			case <-q.quit:
+				return
+			case <-q.wake:
+			case <-time.After(q.PollInterval):
+			}
+			continue
+		}
+
+		q.run(job)
+	}
+}
+
+// run runs one job and records the outcome.
+func (q *Queue) run(job *Job) {
+	reg, ok := q.handlers[job.Kind]
+	if !ok {
+		q.bury(job, fmt.Errorf("no handler registered for %q jobs", job.Kind))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(q.ctx, reg.opts.Timeout)
+	err := safely(ctx, reg.handler, job)
+	cancel()
+
+	var permanent permanentError
+	var retryAfter retryAfterError
+
+	switch {
+	case err == nil:
+		err = q.store.Complete(job.ID)
+		if err != nil {
+			q.ErrorLog.Printf("worker: completing job %d: %v", job.ID, err)
+		}
+	case errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts:
+		q.bury(job, err)
+	default:
+		delay := reg.opts.Backoff(job.Attempts)
+		if errors.As(err, &retryAfter) {
+			delay = retryAfter.delay
+		}
+
+		err = q.store.Retry(job.ID, time.Now().Add(delay), truncate(err.Error()))
+		if err != nil {
+			q.ErrorLog.Printf("worker: retrying job %d: %v", job.ID, err)
+		}
+	}
+}
+
+// bury moves a job to the dead-letter state.
+func (q *Queue) bury(job *Job, cause error) {
+	q.ErrorLog.Printf("worker: %s job %d failed after %d attempts: %v", job.Kind, job.ID, job.Attempts, cause)
+
+	err := q.store.Bury(job.ID, truncate(cause.Error()))
+	if err != nil {
+		q.ErrorLog.Printf("worker: burying job %d: %v", job.ID, err)
+	}
+}
+
+// safely calls a handler, turning a panic into an error so that one bad job
+// can't take down the worker (or the application).
+func safely(ctx context.Context, h Handler, job *Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = Permanent(fmt.Errorf("panic: %v\n%s", p, debug.Stack()))
+		}
+	}()
+
+	return h(ctx, job)
+}
+
+// truncate shortens an error message to fit the last_error column.
+func truncate(s string) string {
+	if r := []rune(s); len(r) > 255 {
+		return string(r[:255])
+	}
+	return s
+}
@@ -0,0 +1,336 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+// newTestQueue returns a queue on a new MemStore which doesn't log, with
+// one worker and a poll interval long enough that jobs are only picked up
+// when they're enqueued.
+func newTestQueue() (*Queue, *MemStore) {
+	store := NewMemStore()
+	q := New(store)
+	q.Workers = 1
+	q.PollInterval = time.Hour
+	q.ErrorLog = log.New(io.Discard, "", 0)
+	return q, store
+}
+
+// stored returns a copy of the job with the given ID as the store holds it,
+// or nil if it's been completed or buried.
+func stored(m *MemStore, id int64) *Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil
+	}
+	c := *j
+	return &c
+}
+
+// claimOne enqueues a job of the given kind and claims it, failing the test
+// if it isn't the job claimed.
+func claimOne(t *testing.T, q *Queue, store *MemStore, kind string) *Job {
+	t.Helper()
+
+	err := q.Enqueue(kind, map[string]int{"n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := store.Claim(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil {
+		t.Fatal("got no job to claim")
+	}
+	return job
+}
+
+func TestMemStoreClaim(t *testing.T) {
+	store := NewMemStore()
+	now := time.Now()
+
+	later := &Job{Kind: "later", RunAt: now.Add(time.Hour)}
+	newer := &Job{Kind: "newer", RunAt: now.Add(-time.Minute)}
+	older := &Job{Kind: "older", RunAt: now.Add(-time.Hour)}
+	for _, j := range []*Job{later, newer, older} {
+		if err := store.Enqueue(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The due job which has waited longest comes first, and is held for
+	// the lease.
+	job, err := store.Claim(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || job.ID != older.ID {
+		t.Fatalf("got job %v; want job %d", job, older.ID)
+	}
+	if job.Attempts != 1 {
+		t.Errorf("got %d attempts; want 1", job.Attempts)
+	}
+	if !job.RunAt.After(now) {
+		t.Errorf("got run at %v; want it held past %v", job.RunAt, now)
+	}
+
+	job, err = store.Claim(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || job.ID != newer.ID {
+		t.Fatalf("got job %v; want job %d", job, newer.ID)
+	}
+
+	// Both due jobs are leased, and the other isn't due yet.
+	job, err = store.Claim(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job != nil {
+		t.Fatalf("got job %d; want none", job.ID)
+	}
+
+	// A retried job can be claimed again once it's due, and its attempts
+	// carry on from before.
+	err = store.Retry(older.ID, now.Add(-time.Second), "boom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err = store.Claim(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || job.ID != older.ID {
+		t.Fatalf("got job %v; want job %d", job, older.ID)
+	}
+	if job.Attempts != 2 {
+		t.Errorf("got %d attempts; want 2", job.Attempts)
+	}
+	if job.LastError != "boom" {
+		t.Errorf("got last error %q; want %q", job.LastError, "boom")
+	}
+}
+
+func TestMemStoreBury(t *testing.T) {
+	store := NewMemStore()
+
+	job := &Job{Kind: "doomed", RunAt: time.Now()}
+	if err := store.Enqueue(job); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Bury(job.ID, "gave up"); err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := store.Claim(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed != nil {
+		t.Errorf("got job %d claimed; want none", claimed.ID)
+	}
+
+	dead := store.Dead()
+	if len(dead) != 1 || dead[0].ID != job.ID {
+		t.Fatalf("got dead jobs %v; want job %d", dead, job.ID)
+	}
+	if dead[0].LastError != "gave up" {
+		t.Errorf("got last error %q; want %q", dead[0].LastError, "gave up")
+	}
+}
+
+func TestQueueRun(t *testing.T) {
+	const backoff = time.Hour
+
+	tests := []struct {
+		name        string
+		err         error
+		panics      bool
+		maxAttempts int
+		wantRetry   time.Duration
+		wantBuried  bool
+	}{
+		{name: "Success"},
+		{name: "Failure", err: errors.New("boom"), wantRetry: backoff},
+		{name: "Last attempt", err: errors.New("boom"), maxAttempts: 1, wantBuried: true},
+		{name: "Permanent", err: Permanent(errors.New("boom")), wantBuried: true},
+		{name: "Retry after", err: RetryAfter(errors.New("boom"), time.Minute), wantRetry: time.Minute},
+		{name: "Wrapped retry after", err: fmt.Errorf("job: %w", RetryAfter(errors.New("boom"), time.Minute)), wantRetry: time.Minute},
+		{name: "Panic", panics: true, wantBuried: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, store := newTestQueue()
+			q.Register("test", func(ctx context.Context, job *Job) error {
+				if tt.panics {
+					panic("boom")
+				}
+				return tt.err
+			}, Options{MaxAttempts: tt.maxAttempts, Backoff: func(int) time.Duration { return backoff }})
+
+			job := claimOne(t, q, store, "test")
+			start := time.Now()
+			q.run(job)
+
+			buried := len(store.Dead()) == 1
+			if buried != tt.wantBuried {
+				t.Errorf("got buried %t; want %t", buried, tt.wantBuried)
+			}
+
+			left := stored(store, job.ID)
+			switch {
+			case tt.wantRetry > 0:
+				if left == nil {
+					t.Fatal("got the job gone; want it retried")
+				}
+				if delay := left.RunAt.Sub(start); delay < tt.wantRetry || delay > tt.wantRetry+time.Second {
+					t.Errorf("got retried after %v; want %v", delay, tt.wantRetry)
+				}
+				if left.LastError != tt.err.Error() {
+					t.Errorf("got last error %q; want %q", left.LastError, tt.err.Error())
+				}
+			case left != nil:
+				t.Errorf("got the job still queued; want it gone")
+			}
+		})
+	}
+}
+
+func TestQueueRunUnregistered(t *testing.T) {
+	q, store := newTestQueue()
+
+	job := &Job{Kind: "unknown", MaxAttempts: 5, RunAt: time.Now()}
+	if err := store.Enqueue(job); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := store.Claim(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.run(claimed)
+
+	if dead := store.Dead(); len(dead) != 1 || dead[0].ID != job.ID {
+		t.Errorf("got dead jobs %v; want job %d", dead, job.ID)
+	}
+}
+
+func TestQueueEnqueueUnregistered(t *testing.T) {
+	q, _ := newTestQueue()
+
+	if err := q.Enqueue("unknown", nil); err == nil {
+		t.Error("got no error; want one")
+	}
+}
+
+func TestQueueShutdownDrains(t *testing.T) {
+	q, store := newTestQueue()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	q.Register("slow", func(ctx context.Context, job *Job) error {
+		close(started)
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, Options{})
+
+	q.Start()
+	if err := q.Enqueue("slow", nil); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	done := make(chan error)
+	go func() { done <- q.Shutdown(context.Background()) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("got Shutdown returning %v with a job running; want it to wait", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("got error %v; want nil", err)
+	}
+
+	store.mu.Lock()
+	left := len(store.jobs)
+	store.mu.Unlock()
+	if left != 0 {
+		t.Errorf("got %d jobs left; want the job completed", left)
+	}
+}
+
+func TestQueueShutdownCancels(t *testing.T) {
+	q, store := newTestQueue()
+
+	started := make(chan struct{})
+	var handlerErr error
+	q.Register("stuck", func(ctx context.Context, job *Job) error {
+		close(started)
+		<-ctx.Done()
+		handlerErr = ctx.Err()
+		return handlerErr
+	}, Options{})
+
+	q.Start()
+	if err := q.Enqueue("stuck", nil); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := q.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v; want %v", err, context.DeadlineExceeded)
+	}
+	if !errors.Is(handlerErr, context.Canceled) {
+		t.Errorf("got the handler's context ending with %v; want %v", handlerErr, context.Canceled)
+	}
+
+	// The job was cut short, so it's left to be retried.
+	store.mu.Lock()
+	left := len(store.jobs)
+	store.mu.Unlock()
+	if left != 1 {
+		t.Errorf("got %d jobs left; want the job kept for a retry", left)
+	}
+}
+
+func TestDefaultBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{10, time.Hour},
+		{100, time.Hour},
+	}
+
+	for _, tt := range tests {
+		got := DefaultBackoff(tt.attempt)
+		if got < tt.want || got > tt.want+tt.want/10 {
+			t.Errorf("attempt %d: got %v; want between %v and %v", tt.attempt, got, tt.want, tt.want+tt.want/10)
+		}
+	}
+}
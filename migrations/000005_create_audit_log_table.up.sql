@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGINT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NULL,
+    ip VARCHAR(45) NOT NULL,
+    event VARCHAR(100) NOT NULL,
+    detail VARCHAR(1000) NOT NULL DEFAULT '',
+    created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_audit_log_created ON audit_log(created);
+CREATE INDEX idx_audit_log_event ON audit_log(event, created);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id BIGINT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    email VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    succeeded BOOLEAN NOT NULL,
+    created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_login_attempts_email_created ON login_attempts(email, created);
+CREATE INDEX idx_login_attempts_ip_created ON login_attempts(ip, created);
@@ -0,0 +1,4 @@
+ALTER TABLE snippets DROP FOREIGN KEY fk_snippets_forked_from;
+ALTER TABLE snippets DROP FOREIGN KEY fk_snippets_user;
+ALTER TABLE snippets DROP COLUMN forked_from;
+ALTER TABLE snippets DROP COLUMN user_id;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS once_snippets;
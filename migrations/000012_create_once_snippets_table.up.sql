@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS once_snippets (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    token_hash CHAR(64) NOT NULL,
+    title BLOB NOT NULL,
+    content MEDIUMBLOB NOT NULL,
+    user_id INTEGER NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    CONSTRAINT once_snippets_uc_token_hash UNIQUE (token_hash),
+    CONSTRAINT fk_once_snippets_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_once_snippets_expires ON once_snippets(expires);
@@ -0,0 +1 @@
+ALTER TABLE snippets ADD COLUMN passphrase_hash VARCHAR(255) NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE snippet_revisions MODIFY content TEXT NOT NULL;
+ALTER TABLE snippets MODIFY content TEXT NOT NULL;
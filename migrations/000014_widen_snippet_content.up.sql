@@ -0,0 +1,4 @@
+-- Encrypted content is base64 encoded and carries a wrapped key, so it's
+-- about a third larger than the plain text and may not fit in a TEXT column.
+ALTER TABLE snippets MODIFY content MEDIUMTEXT NOT NULL;
+ALTER TABLE snippet_revisions MODIFY content MEDIUMTEXT NOT NULL;
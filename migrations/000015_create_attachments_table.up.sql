@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS attachments (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    user_id INTEGER NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key CHAR(32) NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT attachments_uc_storage_key UNIQUE (storage_key),
+    CONSTRAINT fk_attachments_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE,
+    CONSTRAINT fk_attachments_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_attachments_snippet ON attachments(snippet_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS snippet_tags;
+ALTER TABLE snippets DROP INDEX idx_snippets_language;
+ALTER TABLE snippets DROP COLUMN language;
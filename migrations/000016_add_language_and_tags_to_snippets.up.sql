@@ -0,0 +1,12 @@
+ALTER TABLE snippets ADD COLUMN language VARCHAR(32) NULL;
+
+CREATE INDEX idx_snippets_language ON snippets(language);
+
+CREATE TABLE IF NOT EXISTS snippet_tags (
+    snippet_id INTEGER NOT NULL,
+    tag VARCHAR(32) NOT NULL,
+    PRIMARY KEY (snippet_id, tag),
+    CONSTRAINT fk_snippet_tags_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_snippet_tags_tag ON snippet_tags(tag);
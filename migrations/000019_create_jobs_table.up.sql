@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS jobs (
+    id BIGINT NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    kind VARCHAR(64) NOT NULL,
+    payload BLOB NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    run_at DATETIME(6) NOT NULL,
+    last_error VARCHAR(255) NULL,
+    created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_jobs_ready ON jobs(status, run_at);
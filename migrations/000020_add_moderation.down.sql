@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS content_hashes;
+ALTER TABLE snippets DROP INDEX idx_snippets_held;
+ALTER TABLE snippets DROP COLUMN held_reason;
@@ -0,0 +1,10 @@
+ALTER TABLE snippets ADD COLUMN held_reason VARCHAR(255) NULL;
+
+CREATE INDEX idx_snippets_held ON snippets(held_reason);
+
+CREATE TABLE IF NOT EXISTS content_hashes (
+    hash CHAR(64) NOT NULL,
+    created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_content_hashes_hash ON content_hashes(hash, created);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS reports (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    user_id INTEGER NULL,
+    reporter VARCHAR(64) NOT NULL,
+    reason VARCHAR(16) NOT NULL,
+    details VARCHAR(500) NOT NULL DEFAULT '',
+    created DATETIME NOT NULL,
+    CONSTRAINT reports_uc_reporter UNIQUE (snippet_id, reporter),
+    CONSTRAINT fk_reports_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE,
+    CONSTRAINT fk_reports_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
@@ -0,0 +1,5 @@
+ALTER TABLE users DROP INDEX users_uc_username;
+ALTER TABLE users DROP COLUMN time_zone;
+ALTER TABLE users DROP COLUMN bio;
+ALTER TABLE users DROP COLUMN display_name;
+ALTER TABLE users DROP COLUMN username;
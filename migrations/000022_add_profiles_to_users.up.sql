@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN username VARCHAR(32) NULL;
+ALTER TABLE users ADD COLUMN display_name VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN bio VARCHAR(500) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT '';
+
+-- Existing users get a username made from their ID, which they can change
+-- on their profile.
+UPDATE users SET username = CONCAT('user', id);
+
+ALTER TABLE users MODIFY username VARCHAR(32) NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_uc_username UNIQUE (username);
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP INDEX idx_users_avatar_key;
+ALTER TABLE users DROP COLUMN avatar_key;
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN avatar_key CHAR(32) NULL;
+
+CREATE INDEX idx_users_avatar_key ON users(avatar_key);
@@ -0,0 +1,5 @@
+ALTER TABLE snippets DROP INDEX idx_snippets_held_created;
+CREATE INDEX idx_snippets_held ON snippets(held_reason);
+
+ALTER TABLE snippets DROP INDEX idx_snippets_language_created;
+CREATE INDEX idx_snippets_language ON snippets(language);
@@ -0,0 +1,7 @@
+-- The archive pages list a language's or a month's snippets newest first, so
+-- their indexes lead with the column they filter on and end with created.
+ALTER TABLE snippets DROP INDEX idx_snippets_language;
+CREATE INDEX idx_snippets_language_created ON snippets(language, created);
+
+ALTER TABLE snippets DROP INDEX idx_snippets_held;
+CREATE INDEX idx_snippets_held_created ON snippets(held_reason, created);
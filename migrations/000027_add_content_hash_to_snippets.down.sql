@@ -0,0 +1,2 @@
+ALTER TABLE snippets DROP INDEX idx_snippets_content_hash;
+ALTER TABLE snippets DROP COLUMN content_hash;
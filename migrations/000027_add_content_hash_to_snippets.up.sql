@@ -0,0 +1,6 @@
+-- Content is encrypted, so the hashes of existing snippets can't be worked
+-- out here. They're left NULL, and only snippets created or edited from now
+-- on are checked for duplicates.
+ALTER TABLE snippets ADD COLUMN content_hash CHAR(64) NULL;
+
+CREATE INDEX idx_snippets_content_hash ON snippets(content_hash);
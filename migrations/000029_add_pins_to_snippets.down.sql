@@ -0,0 +1,4 @@
+ALTER TABLE snippets DROP INDEX idx_snippets_home_pinned;
+ALTER TABLE snippets DROP INDEX idx_snippets_user_pinned;
+ALTER TABLE snippets DROP COLUMN home_pinned_at;
+ALTER TABLE snippets DROP COLUMN pinned_at;
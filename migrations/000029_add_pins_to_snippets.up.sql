@@ -0,0 +1,8 @@
+-- pinned_at is set when a snippet's owner pins it to the top of their
+-- profile, and home_pinned_at when an admin pins it to the home page as an
+-- announcement.
+ALTER TABLE snippets ADD COLUMN pinned_at DATETIME NULL;
+ALTER TABLE snippets ADD COLUMN home_pinned_at DATETIME NULL;
+
+CREATE INDEX idx_snippets_user_pinned ON snippets(user_id, pinned_at);
+CREATE INDEX idx_snippets_home_pinned ON snippets(home_pinned_at);
@@ -0,0 +1,2 @@
+ALTER TABLE snippets DROP INDEX idx_snippets_publish_at;
+ALTER TABLE snippets DROP COLUMN publish_at;
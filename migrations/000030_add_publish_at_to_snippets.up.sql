@@ -0,0 +1,9 @@
+-- Snippets are only shown once publish_at (in UTC) has passed. Existing
+-- snippets were published when they were created.
+ALTER TABLE snippets ADD COLUMN publish_at DATETIME NULL;
+
+UPDATE snippets SET publish_at = LEAST(created, UTC_TIMESTAMP());
+
+ALTER TABLE snippets MODIFY publish_at DATETIME NOT NULL;
+
+CREATE INDEX idx_snippets_publish_at ON snippets(publish_at);
@@ -0,0 +1,2 @@
+ALTER TABLE snippets DROP INDEX snippets_uc_user_imported_from;
+ALTER TABLE snippets DROP COLUMN imported_from;
@@ -0,0 +1,6 @@
+-- imported_from records where an imported snippet came from, like
+-- "gist:aa5a315d61ae9438b18d/main.go", so that importing again doesn't make
+-- copies of snippets which were already imported.
+ALTER TABLE snippets ADD COLUMN imported_from VARCHAR(255) NULL;
+
+ALTER TABLE snippets ADD CONSTRAINT snippets_uc_user_imported_from UNIQUE (user_id, imported_from);
@@ -0,0 +1,8 @@
+-- Tokens made on the API keys page have a name and a set of scopes, and
+-- record when they were last used. They need an ID so that they can be
+-- revoked without knowing their hash. Existing tokens keep full access.
+ALTER TABLE tokens ADD COLUMN id INTEGER NOT NULL AUTO_INCREMENT UNIQUE FIRST;
+ALTER TABLE tokens ADD COLUMN name VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN scopes VARCHAR(255) NOT NULL DEFAULT 'read,write';
+ALTER TABLE tokens ADD COLUMN created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE tokens ADD COLUMN last_used_at DATETIME NULL;
@@ -0,0 +1,10 @@
+ALTER TABLE users ADD COLUMN admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users SET admin = TRUE WHERE id IN (
+    SELECT users_permissions.user_id FROM users_permissions
+    INNER JOIN permissions ON permissions.id = users_permissions.permission_id
+    WHERE permissions.code = 'admin:system'
+);
+
+DROP TABLE IF EXISTS users_permissions;
+DROP TABLE IF EXISTS permissions;
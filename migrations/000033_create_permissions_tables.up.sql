@@ -0,0 +1,26 @@
+-- Permissions replace the admin flag on users, so that users can be given
+-- some administrative powers without all of them. Everyone who already has
+-- an account can write snippets, and admins get the admin permissions.
+CREATE TABLE IF NOT EXISTS permissions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    code VARCHAR(100) NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id INTEGER NOT NULL,
+    permission_id INTEGER NOT NULL,
+    PRIMARY KEY (user_id, permission_id),
+    CONSTRAINT fk_users_permissions_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_users_permissions_permission FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+);
+
+INSERT INTO permissions (code) VALUES ('snippets:write'), ('admin:moderate'), ('admin:system');
+
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users.id, permissions.id FROM users, permissions WHERE permissions.code = 'snippets:write';
+
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users.id, permissions.id FROM users, permissions
+WHERE users.admin = TRUE AND permissions.code IN ('admin:moderate', 'admin:system');
+
+ALTER TABLE users DROP COLUMN admin;
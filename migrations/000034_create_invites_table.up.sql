@@ -0,0 +1,12 @@
+-- Invitations let people sign up when registration is invite-only. Each
+-- code can be used max_uses times before it expires.
+CREATE TABLE IF NOT EXISTS invites (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    code VARCHAR(32) NOT NULL UNIQUE,
+    created_by INTEGER NULL,
+    max_uses INTEGER NOT NULL,
+    uses INTEGER NOT NULL DEFAULT 0,
+    expiry DATETIME NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT fk_invites_user FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
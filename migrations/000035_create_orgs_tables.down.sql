@@ -0,0 +1,5 @@
+ALTER TABLE snippets DROP FOREIGN KEY fk_snippets_org;
+ALTER TABLE snippets DROP COLUMN org_id;
+
+DROP TABLE IF EXISTS org_members;
+DROP TABLE IF EXISTS orgs;
@@ -0,0 +1,24 @@
+-- Organizations are shared workspaces. Snippets with an org_id are only
+-- visible to the members of that organization.
+CREATE TABLE IF NOT EXISTS orgs (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    slug VARCHAR(50) NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT orgs_uc_slug UNIQUE (slug)
+);
+
+CREATE TABLE IF NOT EXISTS org_members (
+    org_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (org_id, user_id),
+    CONSTRAINT fk_org_members_org FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE,
+    CONSTRAINT fk_org_members_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_org_members_user ON org_members(user_id);
+
+ALTER TABLE snippets ADD COLUMN org_id INTEGER NULL;
+ALTER TABLE snippets ADD CONSTRAINT fk_snippets_org FOREIGN KEY (org_id) REFERENCES orgs(id) ON DELETE CASCADE;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS oidc_sessions;
+DROP TABLE IF EXISTS user_identities;
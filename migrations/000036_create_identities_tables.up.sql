@@ -0,0 +1,26 @@
+-- user_identities links users to the accounts they log in with at an
+-- OpenID Connect provider, by the provider's issuer and subject.
+CREATE TABLE IF NOT EXISTS user_identities (
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id INTEGER NOT NULL,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (issuer, subject),
+    CONSTRAINT fk_user_identities_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_identities_user ON user_identities(user_id);
+
+-- oidc_sessions records which session each OpenID Connect login made, so
+-- that the provider can end it with a backchannel logout.
+CREATE TABLE IF NOT EXISTS oidc_sessions (
+    session_token CHAR(43) NOT NULL PRIMARY KEY,
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    sid VARCHAR(255) NULL,
+    expiry DATETIME NOT NULL
+);
+
+CREATE INDEX idx_oidc_sessions_subject ON oidc_sessions(issuer, subject);
+CREATE INDEX idx_oidc_sessions_sid ON oidc_sessions(issuer, sid);
+CREATE INDEX idx_oidc_sessions_expiry ON oidc_sessions(expiry);
@@ -0,0 +1,18 @@
+-- Remember-me tokens log users back in after their session expires. The
+-- cookie holds the selector, which finds the row, and a verifier, whose hash
+-- is stored. The verifier changes every time the cookie is used; the last
+-- one is kept for a short while so that requests made at the same moment
+-- aren't taken for a stolen cookie.
+CREATE TABLE IF NOT EXISTS remember_tokens (
+    selector CHAR(24) NOT NULL PRIMARY KEY,
+    hash BINARY(32) NOT NULL,
+    previous_hash BINARY(32) NULL,
+    rotated DATETIME NOT NULL,
+    user_id INTEGER NOT NULL,
+    expiry DATETIME NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT fk_remember_tokens_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_remember_tokens_user ON remember_tokens(user_id);
+CREATE INDEX idx_remember_tokens_expiry ON remember_tokens(expiry);
@@ -0,0 +1,12 @@
+-- IP bans are addresses and CIDR ranges which administrators have banned,
+-- usually after finding them in the audit log. Requests from them are
+-- turned away before they reach any page.
+CREATE TABLE IF NOT EXISTS ip_bans (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    cidr VARCHAR(49) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    created_by INTEGER NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT ip_bans_uc_cidr UNIQUE (cidr),
+    CONSTRAINT fk_ip_bans_user FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
@@ -0,0 +1 @@
+DROP INDEX idx_audit_log_ip ON audit_log;
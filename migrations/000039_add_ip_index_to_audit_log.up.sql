@@ -0,0 +1,2 @@
+-- The admin audit page can show everything one address has done.
+CREATE INDEX idx_audit_log_ip ON audit_log(ip, id);
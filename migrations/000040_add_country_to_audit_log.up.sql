@@ -0,0 +1,2 @@
+-- The country each event came from, when there's a GeoIP database.
+ALTER TABLE audit_log ADD COLUMN country CHAR(2) NOT NULL DEFAULT '';
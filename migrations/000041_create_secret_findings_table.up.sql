@@ -0,0 +1,17 @@
+-- Secret findings record submissions in which the secret scanner found
+-- something that looked like a password, key or token, for administrators
+-- to look over. The secrets themselves are never stored, only which rules
+-- matched and what was done about it.
+CREATE TABLE IF NOT EXISTS secret_findings (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NULL,
+    user_id INTEGER NULL,
+    ip VARCHAR(45) NOT NULL,
+    rules VARCHAR(255) NOT NULL,
+    outcome VARCHAR(16) NOT NULL,
+    created DATETIME NOT NULL,
+    CONSTRAINT fk_secret_findings_snippet FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE SET NULL,
+    CONSTRAINT fk_secret_findings_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_secret_findings_created ON secret_findings(created);
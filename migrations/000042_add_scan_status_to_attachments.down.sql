@@ -0,0 +1,3 @@
+DROP INDEX idx_attachments_scan_status ON attachments;
+ALTER TABLE attachments DROP COLUMN threat;
+ALTER TABLE attachments DROP COLUMN scan_status;
@@ -0,0 +1,8 @@
+-- Attachments are checked for viruses after they're uploaded. They can't
+-- be downloaded while they're pending, or once they've been quarantined,
+-- until a moderator releases them. Attachments uploaded before scanning
+-- was added count as clean.
+ALTER TABLE attachments ADD COLUMN scan_status VARCHAR(16) NOT NULL DEFAULT 'clean';
+ALTER TABLE attachments ADD COLUMN threat VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_attachments_scan_status ON attachments(scan_status);
@@ -0,0 +1,3 @@
+-- Login attempts older than the throttle window are deleted every few
+-- minutes, so they're looked up by age alone.
+CREATE INDEX idx_login_attempts_created ON login_attempts(created);
@@ -5,4 +5,339 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// Highlight the line or range of lines named in the URL fragment, e.g. #L10
+// or #L10-L20, on the snippet view page.
+function highlightLines() {
+	var lines = document.querySelectorAll("pre.numbered .line");
+	for (var i = 0; i < lines.length; i++) {
+		lines[i].classList.remove("highlight");
+	}
+
+	var match = /^#L(\d+)(?:-L(\d+))?$/.exec(window.location.hash);
+	if (!match) {
+		return;
+	}
+
+	var from = parseInt(match[1], 10);
+	var to = match[2] ? parseInt(match[2], 10) : from;
+	if (to < from) {
+		var tmp = from;
+		from = to;
+		to = tmp;
+	}
+
+	for (var n = from; n <= to; n++) {
+		var line = document.getElementById("L" + n);
+		if (line) {
+			line.classList.add("highlight");
+		}
+	}
+
+	var first = document.getElementById("L" + from);
+	if (first) {
+		first.scrollIntoView({block: "center"});
+	}
+}
+
+// Clicking a line number selects that line; shift-clicking selects the range
+// from the currently selected line.
+function selectLine(e) {
+	var current = /^#L(\d+)/.exec(window.location.hash);
+	if (e.shiftKey && current) {
+		e.preventDefault();
+		window.location.hash = "#L" + current[1] + "-L" + this.getAttribute("data-line");
+	}
+}
+
+var lineNumbers = document.querySelectorAll("pre.numbered a.lineno");
+for (var i = 0; i < lineNumbers.length; i++) {
+	lineNumbers[i].addEventListener("click", selectLine);
+}
+
+if (lineNumbers.length > 0) {
+	window.addEventListener("hashchange", highlightLines);
+	highlightLines();
+}
+
+// Tell the server which time zone to show times in. It takes effect from the
+// next page that's loaded.
+if (window.Intl) {
+	var zone = encodeURIComponent(Intl.DateTimeFormat().resolvedOptions().timeZone || "");
+	var current = document.cookie.match(/(?:^|; )tz=([^;]*)/);
+	if (zone && (!current || current[1] !== zone)) {
+		document.cookie = "tz=" + zone + "; path=/; max-age=31536000; samesite=lax";
+	}
+}
+
+var months = ["Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"];
+
+// The page's language, and the translated layout of humanDate in it.
+var pageLang = document.documentElement.lang || "en";
+var dateLayout = document.documentElement.getAttribute("data-date-layout") || "%s %s %d at %s";
+var monthFormat = window.Intl ? new Intl.DateTimeFormat(pageLang, {month: "short"}) : null;
+
+function pad(n) {
+	return n < 10 ? "0" + n : "" + n;
+}
+
+// Format a date the same way as the humanDate template function, in the
+// page's language and the browser's time zone.
+function humanDate(d) {
+	var month = monthFormat ? monthFormat.format(d).replace(".", "") : months[d.getMonth()];
+	var parts = [pad(d.getDate()), month, d.getFullYear(), pad(d.getHours()) + ":" + pad(d.getMinutes())];
+	return dateLayout.replace(/%[sd]/g, function() {
+		return parts.shift();
+	});
+}
+
+// Add new snippets to the top of the latest snippets table on the home page
+// as they're created, keeping it to 10 rows like the server does. The table
+// only has a data-events attribute when it shows everyone's snippets.
+var latest = document.getElementById("latest-snippets");
+if (latest && latest.hasAttribute("data-events") && window.EventSource) {
+	var cell = function(row, text) {
+		var td = document.createElement("td");
+		td.textContent = text;
+		row.appendChild(td);
+		return td;
+	};
+
+	var events = new EventSource(latest.getAttribute("data-events"));
+	events.addEventListener("snippet", function(e) {
+		var snippet = JSON.parse(e.data);
+		if (document.getElementById("snippet-" + snippet.id)) {
+			return;
+		}
+
+		var row = document.createElement("tr");
+		row.id = "snippet-" + snippet.id;
+		row.className = "new";
+
+		var link = document.createElement("a");
+		link.href = snippet.url;
+		link.textContent = snippet.title;
+		cell(row, "").appendChild(link);
+		cell(row, humanDate(new Date(snippet.created)));
+		cell(row, "0");
+		cell(row, "0");
+		cell(row, "#" + snippet.id);
+
+		var header = latest.querySelector("tr");
+		header.parentNode.insertBefore(row, header.nextSibling);
+
+		var rows = latest.querySelectorAll("tr");
+		for (var i = 11; i < rows.length; i++) {
+			rows[i].parentNode.removeChild(rows[i]);
+		}
+
+		latest.hidden = false;
+		var empty = document.getElementById("no-snippets");
+		if (empty) {
+			empty.parentNode.removeChild(empty);
+		}
+	});
+}
+
+// Keep the snippet view page up to date while it's open: the server pushes
+// edits and comments down a WebSocket. If the connection drops, try again
+// with an increasing delay, up to a minute.
+var viewed = document.getElementById("snippet");
+if (viewed && window.WebSocket) {
+	var socketURL = (location.protocol == "https:" ? "wss://" : "ws://") + location.host + viewed.getAttribute("data-socket");
+	var retryDelay = 1000;
+
+	var notice = function(text) {
+		var div = document.createElement("div");
+		div.className = "flash";
+		div.textContent = text;
+		viewed.parentNode.insertBefore(div, viewed);
+	};
+
+	var showSnippet = function(snippet) {
+		viewed.querySelector(".title").textContent = snippet.title;
+
+		var code = viewed.querySelector("pre.numbered code");
+		while (code.firstChild) {
+			code.removeChild(code.firstChild);
+		}
+
+		var content = snippet.content.replace(/\r\n/g, "\n").replace(/\n$/, "");
+		var parts = content.split("\n");
+		for (var i = 0; i < parts.length; i++) {
+			var n = i + 1;
+			var line = document.createElement("span");
+			line.className = "line";
+			line.id = "L" + n;
+
+			var a = document.createElement("a");
+			a.className = "lineno";
+			a.href = "#L" + n;
+			a.setAttribute("data-line", n);
+			a.textContent = n;
+			a.addEventListener("click", selectLine);
+
+			line.appendChild(a);
+			line.appendChild(document.createTextNode(parts[i]));
+			code.appendChild(line);
+			code.appendChild(document.createTextNode("\n"));
+		}
+
+		highlightLines();
+	};
+
+	var countComments = function(delta) {
+		var count = document.getElementById("comment-count");
+		count.textContent = parseInt(count.textContent, 10) + delta;
+	};
+
+	var showComment = function(comment) {
+		if (document.getElementById("comment-" + comment.id)) {
+			return;
+		}
+
+		var div = document.createElement("div");
+		div.className = "comment new";
+		div.id = "comment-" + comment.id;
+
+		var meta = document.createElement("div");
+		meta.className = "metadata";
+		if (comment.avatar) {
+			var img = document.createElement("img");
+			img.className = "avatar";
+			img.src = comment.avatar;
+			img.width = img.height = 32;
+			img.alt = "";
+			meta.appendChild(img);
+		}
+		var author = document.createElement("strong");
+		author.textContent = comment.author;
+		var time = document.createElement("time");
+		time.textContent = humanDate(new Date(comment.created));
+		meta.appendChild(author);
+		meta.appendChild(document.createTextNode(" "));
+		meta.appendChild(time);
+
+		var p = document.createElement("p");
+		p.textContent = comment.content;
+
+		div.appendChild(meta);
+		div.appendChild(p);
+
+		// New comments go after the last one on the page, or where the
+		// "No comments yet" message was.
+		var empty = document.getElementById("no-comments");
+		var comments = document.querySelectorAll("#comments .comment");
+		if (empty) {
+			empty.parentNode.replaceChild(div, empty);
+		} else if (comments.length > 0) {
+			var last = comments[comments.length - 1];
+			last.parentNode.insertBefore(div, last.nextSibling);
+		} else {
+			return;
+		}
+
+		countComments(1);
+	};
+
+	var connect = function() {
+		var socket = new WebSocket(socketURL);
+
+		socket.onopen = function() {
+			retryDelay = 1000;
+		};
+
+		socket.onmessage = function(e) {
+			var msg = JSON.parse(e.data);
+			switch (msg.type) {
+			case "snippet.updated":
+				showSnippet(msg.snippet);
+				break;
+			case "snippet.deleted":
+				notice("This snippet has been deleted.");
+				break;
+			case "comment.created":
+				showComment(msg.comment);
+				break;
+			case "comment.deleted":
+				var div = document.getElementById("comment-" + msg.comment.id);
+				if (div) {
+					div.parentNode.removeChild(div);
+					countComments(-1);
+				}
+				break;
+			}
+		};
+
+		socket.onclose = function(e) {
+			// 1000 is a normal closure, which the server only sends once
+			// the snippet has been deleted.
+			if (e.code == 1000) {
+				return;
+			}
+			setTimeout(connect, retryDelay);
+			retryDelay = Math.min(retryDelay * 2, 60000);
+		};
+	};
+
+	connect();
+}
+
+// Solve the proof-of-work challenge on the create form for people posting
+// without an account: find a number which, appended to the nonce, gives a
+// SHA-256 hash starting with the required number of zero bits. Work starts
+// as soon as the page loads, and submitting waits for it to finish.
+var challenged = document.getElementById("challenged");
+if (challenged && challenged.getAttribute("data-challenge") == "pow" && window.crypto && crypto.subtle) {
+	var nonce = challenged.getAttribute("data-nonce");
+	var difficulty = parseInt(challenged.getAttribute("data-difficulty"), 10);
+	var encoder = new TextEncoder();
+
+	var zeroBits = function(hash) {
+		var bytes = new Uint8Array(hash);
+		var n = 0;
+		for (var i = 0; i < bytes.length; i++) {
+			if (bytes[i] == 0) {
+				n += 8;
+				continue;
+			}
+			return n + Math.clz32(bytes[i]) - 24;
+		}
+		return n;
+	};
+
+	// Hash a batch of candidates at a time, which is much quicker than
+	// waiting for each one.
+	var solve = function(start) {
+		var batch = [];
+		for (var i = 0; i < 1000; i++) {
+			batch.push(crypto.subtle.digest("SHA-256", encoder.encode(nonce + ":" + (start + i))));
+		}
+		return Promise.all(batch).then(function(hashes) {
+			for (var i = 0; i < hashes.length; i++) {
+				if (zeroBits(hashes[i]) >= difficulty) {
+					return start + i;
+				}
+			}
+			return solve(start + hashes.length);
+		});
+	};
+
+	var submitted = false;
+	solve(0).then(function(answer) {
+		challenged.querySelector("input[name='pow']").value = answer;
+		if (submitted) {
+			challenged.submit();
+		}
+	});
+
+	challenged.addEventListener("submit", function(e) {
+		if (challenged.querySelector("input[name='pow']").value) {
+			return;
+		}
+		e.preventDefault();
+		submitted = true;
+		challenged.querySelector("input[type='submit']").value = "Checking your browser...";
+	});
+}